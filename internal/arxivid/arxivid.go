@@ -0,0 +1,237 @@
+package arxivid
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Scheme identifies which arXiv identifier scheme an ID follows.
+// See: https://info.arxiv.org/help/arxiv_identifier.html
+type Scheme int
+
+const (
+	// SchemeNew is the YYMM.NNNNN scheme used since April 2007 (e.g., "2301.00001")
+	SchemeNew Scheme = iota
+	// SchemeOld is the archive/YYMMNNN scheme used before April 2007 (e.g., "hep-th/9901001")
+	SchemeOld
+)
+
+func (s Scheme) String() string {
+	if s == SchemeOld {
+		return "old"
+	}
+	return "new"
+}
+
+// ID is a parsed arXiv identifier
+type ID struct {
+	Scheme Scheme
+	// Archive is the archive of an old-style ID (e.g., "hep-th", "math"); empty for new-style IDs
+	Archive string
+	// SubjectClass is the optional subject class of an old-style ID (e.g., "GT" in "math.GT/0309136")
+	SubjectClass string
+	// Number is the sequence part of the ID (e.g., "2301.00001" or "9901001")
+	Number string
+	// Version is the explicit version number, or 0 when the ID is unversioned
+	Version int
+}
+
+var (
+	newStyleRegex = regexp.MustCompile(`^(\d{2})(\d{2})\.(\d{4,5})(?:[vV](\d+))?$`)
+	oldStyleRegex = regexp.MustCompile(`^([a-zA-Z]+(?:-[a-zA-Z]+)?)(?:\.([a-zA-Z]{2}))?/(\d{2})(\d{2})(\d{3})(?:[vV](\d+))?$`)
+	urlPrefixes   = []string{"arxiv.org/abs/", "arxiv.org/pdf/", "export.arxiv.org/abs/", "export.arxiv.org/pdf/", "www.arxiv.org/abs/", "www.arxiv.org/pdf/"}
+	// categorySuffixRegex matches the bracketed primary category that citations append, e.g., " [cs.CL]"
+	categorySuffixRegex = regexp.MustCompile(`\s*\[[^\[\]]*\]$`)
+	// doiResolverPrefixes are the forms in which a DOI may be written before the DOI name itself
+	doiResolverPrefixes = []string{"https://doi.org/", "http://doi.org/", "https://dx.doi.org/", "http://dx.doi.org/", "doi.org/", "doi:"}
+)
+
+// doiPrefix is the DataCite DOI prefix under which arXiv registers its articles
+const doiPrefix = "10.48550/arxiv."
+
+// Parse parses an arXiv identifier. Surrounding whitespace, an "arXiv:" prefix (in any case),
+// a bracketed category suffix (e.g., "arXiv:2405.12345v2 [cs.CL]"), abs/pdf URLs and DataCite
+// DOIs (10.48550/arXiv.<id>, optionally as a doi: or https://doi.org/ reference) are accepted
+// around the bare ID.
+func Parse(s string) (ID, error) {
+	raw := s
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ID{}, fmt.Errorf("empty arXiv identifier")
+	}
+
+	// Citation decorations: "arXiv preprint arXiv:2405.12345 [cs.CL]" → "arXiv:2405.12345"
+	s = categorySuffixRegex.ReplaceAllString(s, "")
+	if lower := strings.ToLower(s); strings.HasPrefix(lower, "arxiv preprint ") {
+		s = strings.TrimSpace(s[len("arxiv preprint "):])
+	}
+	for _, prefix := range doiResolverPrefixes {
+		if strings.HasPrefix(strings.ToLower(s), prefix) {
+			s = strings.TrimSpace(s[len(prefix):])
+			break
+		}
+	}
+
+	lower := strings.ToLower(s)
+	switch {
+	case strings.HasPrefix(lower, "arxiv:"):
+		s = strings.TrimSpace(s[len("arxiv:"):])
+	case strings.HasPrefix(lower, doiPrefix):
+		s = s[len(doiPrefix):]
+	default:
+		if rest, ok := trimURL(s); ok {
+			s = strings.TrimSuffix(rest, ".pdf")
+		}
+	}
+
+	if m := newStyleRegex.FindStringSubmatch(s); m != nil {
+		if !validMonth(m[2]) {
+			return ID{}, fmt.Errorf("invalid arXiv identifier %q: month %s is out of range", raw, m[2])
+		}
+		version, err := parseVersion(m[4])
+		if err != nil {
+			return ID{}, fmt.Errorf("invalid arXiv identifier %q: %w", raw, err)
+		}
+		// Five-digit sequence numbers were introduced in January 2015
+		if len(m[3]) == 5 && m[1]+m[2] < "1501" {
+			return ID{}, fmt.Errorf("invalid arXiv identifier %q: five-digit numbers are only used from 1501 onwards", raw)
+		}
+		if len(m[3]) == 4 && m[1]+m[2] >= "1501" {
+			return ID{}, fmt.Errorf("invalid arXiv identifier %q: four-digit numbers are only used before 1501", raw)
+		}
+		return ID{
+			Scheme:  SchemeNew,
+			Number:  m[1] + m[2] + "." + m[3],
+			Version: version,
+		}, nil
+	}
+
+	if m := oldStyleRegex.FindStringSubmatch(s); m != nil {
+		if !validMonth(m[4]) {
+			return ID{}, fmt.Errorf("invalid arXiv identifier %q: month %s is out of range", raw, m[4])
+		}
+		version, err := parseVersion(m[6])
+		if err != nil {
+			return ID{}, fmt.Errorf("invalid arXiv identifier %q: %w", raw, err)
+		}
+		return ID{
+			Scheme:       SchemeOld,
+			Archive:      strings.ToLower(m[1]),
+			SubjectClass: strings.ToUpper(m[2]),
+			Number:       m[3] + m[4] + m[5],
+			Version:      version,
+		}, nil
+	}
+
+	return ID{}, fmt.Errorf("invalid arXiv identifier %q: expected YYMM.NNNNN or archive/YYMMNNN, optionally followed by vN", raw)
+}
+
+// MustParse is like Parse but panics if the identifier cannot be parsed.
+// It is intended for constants and tests.
+func MustParse(s string) ID {
+	id, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// IsValid reports whether s can be parsed as an arXiv identifier.
+func IsValid(s string) bool {
+	_, err := Parse(s)
+	return err == nil
+}
+
+// Canonical returns the canonical form of the ID, e.g., "2301.00001v2" or "math.GT/0309136".
+func (id ID) Canonical() string {
+	s := id.Base()
+	if id.Version > 0 {
+		s += "v" + strconv.Itoa(id.Version)
+	}
+	return s
+}
+
+// String implements fmt.Stringer and returns the canonical form of the ID.
+func (id ID) String() string {
+	return id.Canonical()
+}
+
+// Base returns the canonical form of the ID without its version suffix.
+func (id ID) Base() string {
+	if id.Scheme == SchemeOld {
+		archive := id.Archive
+		if id.SubjectClass != "" {
+			archive += "." + id.SubjectClass
+		}
+		return archive + "/" + id.Number
+	}
+	return id.Number
+}
+
+// WithVersion returns a copy of the ID pinned to version n. A value of 0 removes the version.
+func (id ID) WithVersion(n int) ID {
+	if n < 0 {
+		n = 0
+	}
+	id.Version = n
+	return id
+}
+
+// StorageKey returns a slash-free form of the canonical ID suitable for use as an object name,
+// e.g., "hep-th/9901001v1" → "hep-th_9901001v1".
+func (id ID) StorageKey() string {
+	return strings.ReplaceAll(id.Canonical(), "/", "_")
+}
+
+// AbsURL returns the abstract page URL for the ID under the given base, e.g., "https://arxiv.org/abs/".
+func (id ID) AbsURL(base string) string {
+	return joinURL(base, id.Canonical())
+}
+
+// PDFURL returns the PDF URL for the ID under the given base, e.g., "https://arxiv.org/pdf/".
+func (id ID) PDFURL(base string) string {
+	return joinURL(base, id.Canonical())
+}
+
+func joinURL(base, path string) string {
+	return strings.TrimSuffix(base, "/") + "/" + path
+}
+
+// trimURL strips the scheme, host and abs/pdf path from an arXiv URL.
+func trimURL(s string) (string, bool) {
+	lower := strings.ToLower(s)
+	for _, scheme := range []string{"https://", "http://", ""} {
+		if !strings.HasPrefix(lower, scheme) {
+			continue
+		}
+		for _, prefix := range urlPrefixes {
+			if strings.HasPrefix(lower[len(scheme):], prefix) {
+				rest := s[len(scheme)+len(prefix):]
+				// Drop query strings and fragments
+				if idx := strings.IndexAny(rest, "?#"); idx >= 0 {
+					rest = rest[:idx]
+				}
+				return strings.TrimSuffix(rest, "/"), true
+			}
+		}
+	}
+	return "", false
+}
+
+func validMonth(mm string) bool {
+	month, err := strconv.Atoi(mm)
+	return err == nil && month >= 1 && month <= 12
+}
+
+func parseVersion(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("version must be a positive integer, got %q", v)
+	}
+	return n, nil
+}
@@ -0,0 +1,224 @@
+package arxivid
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		wantCanonical string
+		wantScheme    Scheme
+		wantVersion   int
+		wantError     bool
+	}{
+		// --- New-style identifiers ---
+		{"New style five digits", "2301.00001", "2301.00001", SchemeNew, 0, false},
+		{"New style four digits", "0704.0001", "0704.0001", SchemeNew, 0, false},
+		{"New style with version", "2301.00001v2", "2301.00001v2", SchemeNew, 2, false},
+		{"New style uppercase version", "2301.00001V3", "2301.00001v3", SchemeNew, 3, false},
+		{"New style multi-digit version", "1706.03762v12", "1706.03762v12", SchemeNew, 12, false},
+
+		// --- Old-style identifiers ---
+		{"Old style", "hep-th/9901001", "hep-th/9901001", SchemeOld, 0, false},
+		{"Old style with version", "cs/0112017v2", "cs/0112017v2", SchemeOld, 2, false},
+		{"Old style with subject class", "math.GT/0309136", "math.GT/0309136", SchemeOld, 0, false},
+		{"Old style mixed case", "Math.gt/0309136V1", "math.GT/0309136v1", SchemeOld, 1, false},
+
+		// --- Whitespace and prefixes ---
+		{"Surrounding whitespace", "  2301.00001\t\n", "2301.00001", SchemeNew, 0, false},
+		{"arXiv prefix", "arXiv:2301.00001", "2301.00001", SchemeNew, 0, false},
+		{"Uppercase ArXiv prefix", "ArXiv:2301.00001v1", "2301.00001v1", SchemeNew, 1, false},
+		{"All caps ARXIV prefix with space", "ARXIV: hep-th/9901001", "hep-th/9901001", SchemeOld, 0, false},
+
+		// --- URLs ---
+		{"Abs URL", "https://arxiv.org/abs/2301.00001", "2301.00001", SchemeNew, 0, false},
+		{"PDF URL with extension", "https://arxiv.org/pdf/2301.00001v2.pdf", "2301.00001v2", SchemeNew, 2, false},
+		{"Old style PDF URL", "http://arxiv.org/pdf/hep-th/9901001", "hep-th/9901001", SchemeOld, 0, false},
+		{"Export mirror URL", "https://export.arxiv.org/abs/2301.00001", "2301.00001", SchemeNew, 0, false},
+		{"URL with query string", "https://arxiv.org/abs/2301.00001?context=cs", "2301.00001", SchemeNew, 0, false},
+
+		// --- DOIs ---
+		{"DataCite DOI", "10.48550/arXiv.2405.12345", "2405.12345", SchemeNew, 0, false},
+		{"DataCite DOI lowercase", "10.48550/arxiv.2405.12345", "2405.12345", SchemeNew, 0, false},
+
+		// --- Rejection cases ---
+		{"Empty string", "", "", SchemeNew, 0, true},
+		{"Only whitespace", "   ", "", SchemeNew, 0, true},
+		{"Invalid month", "2313.00001", "", SchemeNew, 0, true},
+		{"Month zero", "2300.00001", "", SchemeNew, 0, true},
+		{"Too few digits", "2301.001", "", SchemeNew, 0, true},
+		{"Too many digits", "2301.000001", "", SchemeNew, 0, true},
+		{"Four digits after 2015", "2301.0001", "", SchemeNew, 0, true},
+		{"Five digits before 2015", "1312.00001", "", SchemeNew, 0, true},
+		{"Version zero", "2301.00001v0", "", SchemeNew, 0, true},
+		{"Dangling version", "2301.00001v", "", SchemeNew, 0, true},
+		{"Old style missing archive", "/9901001", "", SchemeNew, 0, true},
+		{"Old style short number", "hep-th/990100", "", SchemeNew, 0, true},
+		{"Path traversal", "../2301.00001", "", SchemeNew, 0, true},
+		{"Non-arXiv URL", "https://example.com/abs/2301.00001", "", SchemeNew, 0, true},
+		{"Non-arXiv DOI", "10.1000/xyz123", "", SchemeNew, 0, true},
+		{"Free text", "attention is all you need", "", SchemeNew, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("\nInput: %q\nExpected error but got %q", tt.input, got.Canonical())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("\nInput: %q\nUnexpected error: %v", tt.input, err)
+			}
+			if got.Canonical() != tt.wantCanonical {
+				t.Errorf("\nInput: %q\nGot:   %q\nWant:  %q", tt.input, got.Canonical(), tt.wantCanonical)
+			}
+			if got.Scheme != tt.wantScheme {
+				t.Errorf("\nInput: %q\nScheme got %v, want %v", tt.input, got.Scheme, tt.wantScheme)
+			}
+			if got.Version != tt.wantVersion {
+				t.Errorf("\nInput: %q\nVersion got %d, want %d", tt.input, got.Version, tt.wantVersion)
+			}
+		})
+	}
+}
+
+// TestParseCitationFormats covers identifier strings as they appear in real-world citations
+// and reference managers, which LLMs tend to pass through verbatim.
+func TestParseCitationFormats(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"arXiv:2405.12345", "2405.12345"},
+		{"arXiv:2405.12345v2", "2405.12345v2"},
+		{"arXiv:2405.12345v2 [cs.CL]", "2405.12345v2"},
+		{"arXiv:1706.03762 [cs.CL]", "1706.03762"},
+		{"2405.12345 [stat.ML]", "2405.12345"},
+		{"arXiv:hep-th/9901001 [hep-th]", "hep-th/9901001"},
+		{"arXiv preprint arXiv:2405.12345", "2405.12345"},
+		{"arXiv preprint arXiv:1810.04805 (2018)", ""},
+		{"10.48550/arXiv.2405.12345", "2405.12345"},
+		{"doi:10.48550/arXiv.2405.12345", "2405.12345"},
+		{"DOI: 10.48550/ARXIV.2405.12345", "2405.12345"},
+		{"https://doi.org/10.48550/arXiv.2405.12345", "2405.12345"},
+		{"https://dx.doi.org/10.48550/arXiv.1706.03762", "1706.03762"},
+		{"https://arxiv.org/abs/2405.12345v3", "2405.12345v3"},
+		{"https://arxiv.org/pdf/2405.12345v3.pdf", "2405.12345v3"},
+		{"arxiv.org/abs/2405.12345", "2405.12345"},
+		{"[cs.CL]", ""},
+		{"10.1145/3292500.3330701", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("\nInput: %q\nExpected error but got %q", tt.input, got.Canonical())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("\nInput: %q\nUnexpected error: %v", tt.input, err)
+			}
+			if got.Canonical() != tt.want {
+				t.Errorf("\nInput: %q\nGot:   %q\nWant:  %q", tt.input, got.Canonical(), tt.want)
+			}
+		})
+	}
+}
+
+func TestIsValid(t *testing.T) {
+	if !IsValid("2301.00001") {
+		t.Error("expected 2301.00001 to be valid")
+	}
+	if IsValid("not-an-id") {
+		t.Error("expected not-an-id to be invalid")
+	}
+}
+
+func TestMustParse(t *testing.T) {
+	if got := MustParse("cs/0112017v2").Canonical(); got != "cs/0112017v2" {
+		t.Errorf("MustParse() = %q, want %q", got, "cs/0112017v2")
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("MustParse() should panic on an invalid identifier")
+		}
+	}()
+	MustParse("invalid")
+}
+
+func TestFormatting(t *testing.T) {
+	tests := []struct {
+		name           string
+		id             ID
+		wantBase       string
+		wantStorageKey string
+		wantAbsURL     string
+		wantPDFURL     string
+	}{
+		{
+			name:           "New style",
+			id:             MustParse("2301.00001v2"),
+			wantBase:       "2301.00001",
+			wantStorageKey: "2301.00001v2",
+			wantAbsURL:     "https://arxiv.org/abs/2301.00001v2",
+			wantPDFURL:     "https://arxiv.org/pdf/2301.00001v2",
+		},
+		{
+			name:           "Old style",
+			id:             MustParse("hep-th/9901001"),
+			wantBase:       "hep-th/9901001",
+			wantStorageKey: "hep-th_9901001",
+			wantAbsURL:     "https://arxiv.org/abs/hep-th/9901001",
+			wantPDFURL:     "https://arxiv.org/pdf/hep-th/9901001",
+		},
+		{
+			name:           "Old style with subject class and version",
+			id:             MustParse("math.GT/0309136v1"),
+			wantBase:       "math.GT/0309136",
+			wantStorageKey: "math.GT_0309136v1",
+			wantAbsURL:     "https://arxiv.org/abs/math.GT/0309136v1",
+			wantPDFURL:     "https://arxiv.org/pdf/math.GT/0309136v1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.id.Base(); got != tt.wantBase {
+				t.Errorf("Base() = %q, want %q", got, tt.wantBase)
+			}
+			if got := tt.id.StorageKey(); got != tt.wantStorageKey {
+				t.Errorf("StorageKey() = %q, want %q", got, tt.wantStorageKey)
+			}
+			if got := tt.id.AbsURL("https://arxiv.org/abs/"); got != tt.wantAbsURL {
+				t.Errorf("AbsURL() = %q, want %q", got, tt.wantAbsURL)
+			}
+			// The base URL should work with or without a trailing slash
+			if got := tt.id.PDFURL("https://arxiv.org/pdf"); got != tt.wantPDFURL {
+				t.Errorf("PDFURL() = %q, want %q", got, tt.wantPDFURL)
+			}
+		})
+	}
+}
+
+func TestWithVersion(t *testing.T) {
+	id := MustParse("2301.00001")
+	if got := id.WithVersion(3).Canonical(); got != "2301.00001v3" {
+		t.Errorf("WithVersion(3) = %q, want %q", got, "2301.00001v3")
+	}
+	if got := MustParse("2301.00001v3").WithVersion(0).Canonical(); got != "2301.00001" {
+		t.Errorf("WithVersion(0) = %q, want %q", got, "2301.00001")
+	}
+	// The original ID must be unchanged
+	if id.Version != 0 {
+		t.Errorf("WithVersion() modified the receiver, version = %d", id.Version)
+	}
+}
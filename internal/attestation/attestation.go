@@ -0,0 +1,151 @@
+package attestation
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Algorithm is the signature algorithm used for attestations
+const Algorithm = "ed25519"
+
+// Claim is the statement an attestation vouches for: that an object with the given content
+// digest and size was stored in the bucket from the source URL at the given time.
+//
+// The fields are declared in lexicographic order of their JSON names so that the encoding
+// produced by Canonical is stable and can be reproduced by other implementations.
+type Claim struct {
+	Bucket     string `json:"bucket" jsonschema:"The S3 bucket the object was stored in"`
+	ObjectName string `json:"objectName" jsonschema:"The name/path of the object in the bucket"`
+	SHA256     string `json:"sha256" jsonschema:"Lowercase hex-encoded SHA-256 digest of the object content"`
+	Size       int64  `json:"size" jsonschema:"Size of the object in bytes"`
+	SourceURL  string `json:"sourceUrl" jsonschema:"The URL the object was downloaded from"`
+	Timestamp  string `json:"timestamp" jsonschema:"RFC 3339 time at which the object was stored"`
+}
+
+// Canonical returns the canonical JSON encoding of the claim, which is the message that gets signed:
+// a single JSON object with keys in lexicographic order, no insignificant whitespace and no HTML escaping.
+func (c Claim) Canonical() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	// Encode appends a newline which is not part of the canonical form
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Attestation is a claim together with a detached signature over its canonical encoding
+type Attestation struct {
+	Claim     Claim  `json:"claim" jsonschema:"The signed claim about the stored object"`
+	Algorithm string `json:"algorithm" jsonschema:"The signature algorithm, always 'ed25519'"`
+	KeyID     string `json:"keyId" jsonschema:"Identifier of the signing key: the first 16 hex characters of the SHA-256 digest of the public key"`
+	Signature string `json:"signature" jsonschema:"Base64 (standard encoding) signature over the canonical JSON encoding of the claim"`
+}
+
+// Signer signs claims with an Ed25519 private key
+type Signer struct {
+	privateKey ed25519.PrivateKey
+	keyID      string
+}
+
+// NewSigner creates a signer for the given private key.
+func NewSigner(privateKey ed25519.PrivateKey) *Signer {
+	return &Signer{
+		privateKey: privateKey,
+		keyID:      KeyID(privateKey.Public().(ed25519.PublicKey)),
+	}
+}
+
+// PublicKey returns the public key matching the signer's private key.
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.privateKey.Public().(ed25519.PublicKey)
+}
+
+// KeyID returns the identifier of the signer's key.
+func (s *Signer) KeyID() string {
+	return s.keyID
+}
+
+// Sign produces an attestation for the given claim.
+func (s *Signer) Sign(claim Claim) (*Attestation, error) {
+	message, err := claim.Canonical()
+	if err != nil {
+		return nil, fmt.Errorf("failed to canonicalise claim: %w", err)
+	}
+	return &Attestation{
+		Claim:     claim,
+		Algorithm: Algorithm,
+		KeyID:     s.keyID,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(s.privateKey, message)),
+	}, nil
+}
+
+// ErrInvalidSignature is returned when an attestation's signature does not match its claim
+var ErrInvalidSignature = errors.New("attestation signature is invalid")
+
+// Verify checks that the attestation was signed by the given public key and that its claim
+// has not been altered since.
+func Verify(publicKey ed25519.PublicKey, a *Attestation) error {
+	if a == nil {
+		return errors.New("attestation is missing")
+	}
+	if a.Algorithm != Algorithm {
+		return fmt.Errorf("unsupported attestation algorithm %q", a.Algorithm)
+	}
+	if a.KeyID != KeyID(publicKey) {
+		return fmt.Errorf("attestation was signed by key %q, not by this server's key %q", a.KeyID, KeyID(publicKey))
+	}
+	signature, err := base64.StdEncoding.DecodeString(a.Signature)
+	if err != nil {
+		return fmt.Errorf("attestation signature is not valid base64: %w", err)
+	}
+	message, err := a.Claim.Canonical()
+	if err != nil {
+		return fmt.Errorf("failed to canonicalise claim: %w", err)
+	}
+	if !ed25519.Verify(publicKey, message, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// KeyID derives a short, stable identifier for a public key.
+func KeyID(publicKey ed25519.PublicKey) string {
+	digest := sha256.Sum256(publicKey)
+	return hex.EncodeToString(digest[:])[:16]
+}
+
+// LoadSigningKey reads an Ed25519 private key from a PEM file containing a PKCS #8 "PRIVATE KEY" block,
+// as produced by `openssl genpkey -algorithm ed25519`.
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- the path is operator-supplied configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key file %s does not contain a PEM block", path)
+	}
+	if block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("signing key file %s contains a %q PEM block, expected \"PRIVATE KEY\"", path, block.Type)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key file %s contains a %T, expected an Ed25519 key", path, key)
+	}
+	return privateKey, nil
+}
@@ -0,0 +1,180 @@
+package attestation
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testClaim() Claim {
+	return Claim{
+		Bucket:     "opus-mcp-articles",
+		ObjectName: "arxiv/2405.12345.pdf",
+		SHA256:     "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		Size:       123456,
+		SourceURL:  "https://arxiv.org/pdf/2405.12345?a=1&b=2",
+		Timestamp:  "2026-01-07T10:00:00Z",
+	}
+}
+
+// writePEM writes a PEM block to a file in a temporary directory and returns its path
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	return path
+}
+
+func newTestKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return privateKey
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	privateKey := newTestKey(t)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ECDSA key: %v", err)
+	}
+	ecDER, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("failed to marshal ECDSA key: %v", err)
+	}
+
+	garbagePath := filepath.Join(t.TempDir(), "garbage.pem")
+	if err := os.WriteFile(garbagePath, []byte("not a key"), 0o600); err != nil {
+		t.Fatalf("failed to write garbage file: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		wantError string
+	}{
+		{"Valid Ed25519 PKCS8 key", writePEM(t, "PRIVATE KEY", der), ""},
+		{"Missing file", filepath.Join(t.TempDir(), "missing.pem"), "failed to read"},
+		{"Not PEM", garbagePath, "does not contain a PEM block"},
+		{"Wrong PEM block type", writePEM(t, "PUBLIC KEY", der), "expected \"PRIVATE KEY\""},
+		{"Corrupt DER", writePEM(t, "PRIVATE KEY", []byte{0x01, 0x02}), "failed to parse"},
+		{"Non-Ed25519 key", writePEM(t, "PRIVATE KEY", ecDER), "expected an Ed25519 key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadSigningKey(tt.path)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Errorf("LoadSigningKey() error = %v, want error containing %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadSigningKey() unexpected error: %v", err)
+			}
+			if !got.Equal(privateKey) {
+				t.Error("LoadSigningKey() returned a different key")
+			}
+		})
+	}
+}
+
+func TestClaimCanonical(t *testing.T) {
+	got, err := testClaim().Canonical()
+	if err != nil {
+		t.Fatalf("Canonical() unexpected error: %v", err)
+	}
+	// Keys sorted, no whitespace, no HTML escaping of '&'
+	want := `{"bucket":"opus-mcp-articles","objectName":"arxiv/2405.12345.pdf","sha256":"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08","size":123456,"sourceUrl":"https://arxiv.org/pdf/2405.12345?a=1&b=2","timestamp":"2026-01-07T10:00:00Z"}`
+	if string(got) != want {
+		t.Errorf("Canonical()\nGot:  %s\nWant: %s", got, want)
+	}
+
+	// Encoding the same claim twice must produce identical bytes
+	again, err := testClaim().Canonical()
+	if err != nil {
+		t.Fatalf("Canonical() unexpected error: %v", err)
+	}
+	if string(again) != string(got) {
+		t.Error("Canonical() is not deterministic")
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	signer := NewSigner(newTestKey(t))
+	attestation, err := signer.Sign(testClaim())
+	if err != nil {
+		t.Fatalf("Sign() unexpected error: %v", err)
+	}
+	if attestation.Algorithm != Algorithm {
+		t.Errorf("Algorithm = %q, want %q", attestation.Algorithm, Algorithm)
+	}
+	if attestation.KeyID != signer.KeyID() || len(attestation.KeyID) != 16 {
+		t.Errorf("KeyID = %q, want the 16 character signer key ID %q", attestation.KeyID, signer.KeyID())
+	}
+	if err := Verify(signer.PublicKey(), attestation); err != nil {
+		t.Fatalf("Verify() of an untampered attestation failed: %v", err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	signer := NewSigner(newTestKey(t))
+	otherSigner := NewSigner(newTestKey(t))
+
+	tests := []struct {
+		name      string
+		tamper    func(a *Attestation)
+		publicKey func() ed25519.PublicKey
+		wantError string
+	}{
+		{"Bucket changed", func(a *Attestation) { a.Claim.Bucket = "other-bucket" }, signer.PublicKey, "signature is invalid"},
+		{"Object name changed", func(a *Attestation) { a.Claim.ObjectName = "arxiv/2405.99999.pdf" }, signer.PublicKey, "signature is invalid"},
+		{"Digest changed", func(a *Attestation) { a.Claim.SHA256 = strings.Repeat("0", 64) }, signer.PublicKey, "signature is invalid"},
+		{"Size changed", func(a *Attestation) { a.Claim.Size++ }, signer.PublicKey, "signature is invalid"},
+		{"Source URL changed", func(a *Attestation) { a.Claim.SourceURL = "https://evil.example/paper.pdf" }, signer.PublicKey, "signature is invalid"},
+		{"Timestamp changed", func(a *Attestation) { a.Claim.Timestamp = "2027-01-01T00:00:00Z" }, signer.PublicKey, "signature is invalid"},
+		{"Signature not base64", func(a *Attestation) { a.Signature = "%%%" }, signer.PublicKey, "not valid base64"},
+		{"Unsupported algorithm", func(a *Attestation) { a.Algorithm = "rsa" }, signer.PublicKey, "unsupported attestation algorithm"},
+		{"Different key", func(a *Attestation) {}, otherSigner.PublicKey, "signed by key"},
+		{"Key ID forged to match a different key", func(a *Attestation) { a.KeyID = otherSigner.KeyID() }, otherSigner.PublicKey, "signature is invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attestation, err := signer.Sign(testClaim())
+			if err != nil {
+				t.Fatalf("Sign() unexpected error: %v", err)
+			}
+			tt.tamper(attestation)
+			err = Verify(tt.publicKey(), attestation)
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("Verify() error = %v, want error containing %q", err, tt.wantError)
+			}
+			if strings.Contains(tt.wantError, "signature is invalid") && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Verify() error should wrap ErrInvalidSignature, got %v", err)
+			}
+		})
+	}
+
+	if err := Verify(signer.PublicKey(), nil); err == nil {
+		t.Error("Verify() of a nil attestation should fail")
+	}
+}
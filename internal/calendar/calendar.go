@@ -0,0 +1,230 @@
+// Package calendar computes arXiv announcement days and the submission windows they cover.
+//
+// arXiv announces new submissions at 20:00 US Eastern time from Sunday to Thursday. Each
+// announcement covers the submissions received since the previous submission deadline, which is
+// 14:00 US Eastern time on weekdays: the Sunday announcement covers Thursday 14:00 to Friday 14:00,
+// the Monday announcement covers Friday 14:00 to Monday 14:00, and so on. When a holiday suspends
+// an announcement, its submissions roll over into the next announcement.
+package calendar
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // Ensure America/New_York is available on systems without a zoneinfo database
+)
+
+// DateLayout is the ISO 8601 calendar date layout used for announcement dates
+const DateLayout = "2006-01-02"
+
+// MonthLayout is the ISO 8601 calendar month layout used for monthly announcement periods
+const MonthLayout = "2006-01"
+
+const (
+	// deadlineHour is the hour (US Eastern) of the daily submission deadline
+	deadlineHour = 14
+	// searchLayout is the layout of timestamps in arXiv API submittedDate ranges, which are in UTC
+	searchLayout = "200601021504"
+	// maxScanDays bounds the search for adjacent announcement days when many holidays are configured
+	maxScanDays = 60
+)
+
+// eastern is the time zone in which arXiv schedules announcements and deadlines
+var eastern = mustLoadLocation("America/New_York")
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(fmt.Sprintf("failed to load time zone %s: %v", name, err))
+	}
+	return loc
+}
+
+// Calendar is an arXiv announcement calendar with an optional set of holidays on which no
+// announcement is made
+type Calendar struct {
+	holidays map[string]bool
+}
+
+// New creates a calendar with the given holidays, as ISO dates (e.g., 2024-12-25) of the
+// announcement evenings that are skipped
+func New(holidays []string) (*Calendar, error) {
+	c := &Calendar{holidays: make(map[string]bool, len(holidays))}
+	for _, holiday := range holidays {
+		holiday = strings.TrimSpace(holiday)
+		if holiday == "" {
+			continue
+		}
+		if _, err := time.Parse(DateLayout, holiday); err != nil {
+			return nil, fmt.Errorf("invalid holiday date %q: %w", holiday, err)
+		}
+		c.holidays[holiday] = true
+	}
+	return c, nil
+}
+
+// ParseDate parses an ISO date as a calendar day in US Eastern time
+func ParseDate(s string) (time.Time, error) {
+	d, err := time.ParseInLocation(DateLayout, strings.TrimSpace(s), eastern)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD: %w", s, err)
+	}
+	return d, nil
+}
+
+// IsAnnouncementDay reports whether arXiv makes an announcement on the evening of the given day
+func (c *Calendar) IsAnnouncementDay(day time.Time) bool {
+	if day.Weekday() == time.Friday || day.Weekday() == time.Saturday {
+		return false
+	}
+	return !c.holidays[day.Format(DateLayout)]
+}
+
+// deadline returns the submission deadline closing the window of an announcement on the given day:
+// 14:00 on the same day, or on the preceding Friday for Sunday announcements
+func deadline(day time.Time) time.Time {
+	if day.Weekday() == time.Sunday {
+		day = day.AddDate(0, 0, -2)
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), deadlineHour, 0, 0, 0, eastern)
+}
+
+// Window is the submission window covered by one announcement
+type Window struct {
+	// AnnouncedOn is the ISO date (US Eastern) of the announcement evening
+	AnnouncedOn string
+	// Start is the (exclusive) beginning of the window in UTC
+	Start time.Time
+	// End is the (inclusive) end of the window in UTC
+	End time.Time
+}
+
+// SubmittedDateQuery returns the arXiv API search clause selecting submissions in the window
+func (w Window) SubmittedDateQuery() string {
+	return submittedDateQuery(w.Start, w.End)
+}
+
+func submittedDateQuery(start, end time.Time) string {
+	return "submittedDate:[" + start.Format(searchLayout) + "+TO+" + end.Format(searchLayout) + "]"
+}
+
+// Period is the submission window covered by all announcements made over a range of days. Since
+// consecutive windows are contiguous, it runs from the start of the first announcement's window
+// to the end of the last one's.
+type Period struct {
+	// FirstAnnouncement is the ISO date (US Eastern) of the first announcement in the period
+	FirstAnnouncement string
+	// LastAnnouncement is the ISO date (US Eastern) of the last announcement in the period
+	LastAnnouncement string
+	// Start is the (exclusive) beginning of the window in UTC
+	Start time.Time
+	// End is the (inclusive) end of the window in UTC
+	End time.Time
+}
+
+// SubmittedDateQuery returns the arXiv API search clause selecting submissions in the period
+func (p Period) SubmittedDateQuery() string {
+	return submittedDateQuery(p.Start, p.End)
+}
+
+// Window returns the submission window covered by the announcement on the given day, or false if
+// no announcement is made on that day
+func (c *Calendar) Window(day time.Time) (Window, bool) {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, eastern)
+	if !c.IsAnnouncementDay(day) {
+		return Window{}, false
+	}
+	previous, ok := c.adjacent(day, -1)
+	if !ok {
+		return Window{}, false
+	}
+	return Window{
+		AnnouncedOn: day.Format(DateLayout),
+		Start:       deadline(previous).UTC(),
+		End:         deadline(day).UTC(),
+	}, true
+}
+
+// ParseMonth parses an ISO month (e.g., 2024-03) as the first day of that month in US Eastern time
+func ParseMonth(s string) (time.Time, error) {
+	m, err := time.ParseInLocation(MonthLayout, strings.TrimSpace(s), eastern)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid month %q, expected YYYY-MM: %w", s, err)
+	}
+	return m, nil
+}
+
+// Period returns the submission window covered by the announcements made from the first to the
+// last of the given days, inclusive, or false if no announcement is made on any of them
+func (c *Calendar) Period(first, last time.Time) (Period, bool) {
+	first = time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, eastern)
+	last = time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, eastern)
+	var period Period
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		window, ok := c.Window(day)
+		if !ok {
+			continue
+		}
+		if period.FirstAnnouncement == "" {
+			period.FirstAnnouncement = window.AnnouncedOn
+			period.Start = window.Start
+		}
+		period.LastAnnouncement = window.AnnouncedOn
+		period.End = window.End
+	}
+	return period, period.FirstAnnouncement != ""
+}
+
+// Week returns the submission window covered by the announcements of the week, Monday to Sunday,
+// that contains the given day. Without holidays it runs from Friday 14:00 of the previous week
+// to Friday 14:00 of that week.
+func (c *Calendar) Week(day time.Time) (Period, bool) {
+	monday := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	return c.Period(monday, monday.AddDate(0, 0, 6))
+}
+
+// Month returns the submission window covered by the announcements of the calendar month that
+// contains the given day
+func (c *Calendar) Month(day time.Time) (Period, bool) {
+	first := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, eastern)
+	return c.Period(first, first.AddDate(0, 1, -1))
+}
+
+// NextAnnouncement returns the first announcement day strictly after the given day
+func (c *Calendar) NextAnnouncement(day time.Time) (time.Time, bool) {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, eastern)
+	return c.adjacent(day, 1)
+}
+
+// Announcement returns the day of the announcement that covers a submission made at the given
+// time: the first announcement day whose deadline is at or after it, so that submissions made
+// during a holiday or a weekend roll over into the next announcement
+func (c *Calendar) Announcement(submitted time.Time) (time.Time, bool) {
+	submitted = submitted.In(eastern)
+	day := time.Date(submitted.Year(), submitted.Month(), submitted.Day(), 0, 0, 0, 0, eastern)
+	for i := 0; i <= maxScanDays; i++ {
+		candidate := day.AddDate(0, 0, i)
+		if c.IsAnnouncementDay(candidate) && !deadline(candidate).Before(submitted) {
+			return candidate, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ListingDay returns the date under which arXiv lists the announcement made on the evening of the
+// given day, which is the following day: the Sunday announcement is the Monday listing, and the
+// Thursday announcement is the Friday listing
+func ListingDay(announcement time.Time) time.Time {
+	return time.Date(announcement.Year(), announcement.Month(), announcement.Day()+1, 0, 0, 0, 0, eastern)
+}
+
+// adjacent finds the nearest announcement day before (step -1) or after (step 1) the given day
+func (c *Calendar) adjacent(day time.Time, step int) (time.Time, bool) {
+	for i := 1; i <= maxScanDays; i++ {
+		candidate := day.AddDate(0, 0, step*i)
+		if c.IsAnnouncementDay(candidate) {
+			return candidate, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,277 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustCalendar(t *testing.T, holidays ...string) *Calendar {
+	t.Helper()
+	c, err := New(holidays)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	return c
+}
+
+func utc(s string) time.Time {
+	ts, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return ts
+}
+
+func TestWindow(t *testing.T) {
+	tests := []struct {
+		name      string
+		holidays  []string
+		date      string
+		wantOK    bool
+		wantStart string
+		wantEnd   string
+	}{
+		// Standard time (EST, UTC-5): 14:00 ET is 19:00 UTC
+		{"Thursday in standard time", nil, "2024-11-07", true, "2024-11-06 19:00", "2024-11-07 19:00"},
+		{"Tuesday in standard time", nil, "2024-11-12", true, "2024-11-11 19:00", "2024-11-12 19:00"},
+		{"Wednesday in standard time", nil, "2024-11-13", true, "2024-11-12 19:00", "2024-11-13 19:00"},
+		// Daylight saving time (EDT, UTC-4): 14:00 ET is 18:00 UTC
+		{"Thursday in daylight saving time", nil, "2024-07-11", true, "2024-07-10 18:00", "2024-07-11 18:00"},
+		// Sunday covers Thursday to Friday, Monday covers Friday to Monday
+		{"Sunday covers Thursday to Friday", nil, "2024-07-14", true, "2024-07-11 18:00", "2024-07-12 18:00"},
+		{"Monday covers the weekend", nil, "2024-07-15", true, "2024-07-12 18:00", "2024-07-15 18:00"},
+		// Windows spanning a daylight saving transition have different UTC offsets at each end
+		{"Sunday on the autumn transition", nil, "2024-11-03", true, "2024-10-31 18:00", "2024-11-01 18:00"},
+		{"Monday after the autumn transition", nil, "2024-11-04", true, "2024-11-01 18:00", "2024-11-04 19:00"},
+		{"Monday after the spring transition", nil, "2025-03-10", true, "2025-03-07 19:00", "2025-03-10 18:00"},
+		{"Sunday on the spring transition", nil, "2025-03-09", true, "2025-03-06 19:00", "2025-03-07 19:00"},
+		// No announcements on Friday and Saturday
+		{"Friday", nil, "2024-11-08", false, "", ""},
+		{"Saturday", nil, "2024-11-09", false, "", ""},
+		// Year and month boundaries
+		{"New Year's Day without holidays", nil, "2025-01-01", true, "2024-12-31 19:00", "2025-01-01 19:00"},
+		{"First day of a month", nil, "2024-10-01", true, "2024-09-30 18:00", "2024-10-01 18:00"},
+		{"Leap day", nil, "2024-02-29", true, "2024-02-28 19:00", "2024-02-29 19:00"},
+		// Holidays suspend announcements and roll their submissions into the next announcement
+		{"Holiday itself", []string{"2024-12-25"}, "2024-12-25", false, "", ""},
+		{"Day after a holiday", []string{"2024-12-25"}, "2024-12-26", true, "2024-12-24 19:00", "2024-12-26 19:00"},
+		{"Day after consecutive holidays", []string{"2024-12-24", "2024-12-25"}, "2024-12-26", true, "2024-12-23 19:00", "2024-12-26 19:00"},
+		{"Sunday after a Thursday holiday", []string{"2024-11-28"}, "2024-12-01", true, "2024-11-27 19:00", "2024-11-29 19:00"},
+		{"Tuesday after a Monday holiday", []string{"2024-09-02"}, "2024-09-03", true, "2024-08-30 18:00", "2024-09-03 18:00"},
+		{"Holiday on a Sunday", []string{"2024-12-29"}, "2024-12-30", true, "2024-12-26 19:00", "2024-12-30 19:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mustCalendar(t, tt.holidays...)
+			day, err := ParseDate(tt.date)
+			if err != nil {
+				t.Fatalf("ParseDate() unexpected error: %v", err)
+			}
+			got, ok := c.Window(day)
+			if ok != tt.wantOK {
+				t.Fatalf("Window(%s) ok = %v, want %v", tt.date, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if got.AnnouncedOn != tt.date {
+				t.Errorf("AnnouncedOn = %s, want %s", got.AnnouncedOn, tt.date)
+			}
+			if !got.Start.Equal(utc(tt.wantStart)) || got.Start.Location() != time.UTC {
+				t.Errorf("Start = %v, want %s UTC", got.Start, tt.wantStart)
+			}
+			if !got.End.Equal(utc(tt.wantEnd)) || got.End.Location() != time.UTC {
+				t.Errorf("End = %v, want %s UTC", got.End, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestConsecutiveWindowsAreContiguous(t *testing.T) {
+	c := mustCalendar(t, "2024-12-24", "2024-12-25", "2024-12-31", "2025-01-01")
+	day, _ := ParseDate("2024-10-01")
+	var previous Window
+	for i := 0; i < 180; i++ {
+		window, ok := c.Window(day)
+		if ok {
+			if !window.Start.Before(window.End) {
+				t.Errorf("window for %s is empty or inverted: %v to %v", window.AnnouncedOn, window.Start, window.End)
+			}
+			if previous.AnnouncedOn != "" && !window.Start.Equal(previous.End) {
+				t.Errorf("window for %s starts at %v but the previous window (%s) ended at %v", window.AnnouncedOn, window.Start, previous.AnnouncedOn, previous.End)
+			}
+			previous = window
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+}
+
+func TestWeekAndMonth(t *testing.T) {
+	tests := []struct {
+		name      string
+		holidays  []string
+		month     bool
+		date      string
+		wantOK    bool
+		wantFirst string
+		wantLast  string
+		wantStart string
+		wantEnd   string
+	}{
+		// A week runs from Friday 14:00 of the previous week to Friday 14:00, whichever day names it
+		{"Week of a Monday", nil, false, "2024-03-04", true, "2024-03-04", "2024-03-10", "2024-03-01 19:00", "2024-03-08 19:00"},
+		{"Week of a Saturday", nil, false, "2024-03-09", true, "2024-03-04", "2024-03-10", "2024-03-01 19:00", "2024-03-08 19:00"},
+		{"Week of a Sunday", nil, false, "2024-03-10", true, "2024-03-04", "2024-03-10", "2024-03-01 19:00", "2024-03-08 19:00"},
+		{"Week across the year boundary", nil, false, "2024-12-31", true, "2024-12-30", "2025-01-05", "2024-12-27 19:00", "2025-01-03 19:00"},
+		{"Week across the year boundary from January", nil, false, "2025-01-03", true, "2024-12-30", "2025-01-05", "2024-12-27 19:00", "2025-01-03 19:00"},
+		{"Week with holidays", []string{"2024-12-24", "2024-12-25"}, false, "2024-12-25", true, "2024-12-23", "2024-12-29", "2024-12-20 19:00", "2024-12-27 19:00"},
+		{"Week starting with holidays", []string{"2024-12-30", "2024-12-31", "2025-01-01"}, false, "2025-01-01", true, "2025-01-02", "2025-01-05", "2024-12-27 19:00", "2025-01-03 19:00"},
+		{"Week of holidays only", []string{"2024-12-23", "2024-12-24", "2024-12-25", "2024-12-26", "2024-12-29"}, false, "2024-12-25", false, "", "", "", ""},
+		// A month covers its first to its last announcement
+		{"March across the spring transition", nil, true, "2024-03-01", true, "2024-03-03", "2024-03-31", "2024-02-29 19:00", "2024-03-29 18:00"},
+		{"December up to the year boundary", nil, true, "2024-12-01", true, "2024-12-01", "2024-12-31", "2024-11-28 19:00", "2024-12-31 19:00"},
+		{"January across the year boundary", nil, true, "2025-01-01", true, "2025-01-01", "2025-01-30", "2024-12-31 19:00", "2025-01-30 19:00"},
+		{"January after New Year holidays", []string{"2024-12-31", "2025-01-01"}, true, "2025-01-01", true, "2025-01-02", "2025-01-30", "2024-12-30 19:00", "2025-01-30 19:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mustCalendar(t, tt.holidays...)
+			day, err := ParseDate(tt.date)
+			if err != nil {
+				t.Fatalf("ParseDate() unexpected error: %v", err)
+			}
+			var got Period
+			var ok bool
+			if tt.month {
+				got, ok = c.Month(day)
+			} else {
+				got, ok = c.Week(day)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("period of %s ok = %v, want %v", tt.date, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if got.FirstAnnouncement != tt.wantFirst || got.LastAnnouncement != tt.wantLast {
+				t.Errorf("announcements = %s to %s, want %s to %s", got.FirstAnnouncement, got.LastAnnouncement, tt.wantFirst, tt.wantLast)
+			}
+			if !got.Start.Equal(utc(tt.wantStart)) {
+				t.Errorf("Start = %v, want %s UTC", got.Start, tt.wantStart)
+			}
+			if !got.End.Equal(utc(tt.wantEnd)) {
+				t.Errorf("End = %v, want %s UTC", got.End, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestNextAnnouncement(t *testing.T) {
+	tests := []struct {
+		name     string
+		holidays []string
+		date     string
+		want     string
+	}{
+		{"Friday to Sunday", nil, "2024-11-08", "2024-11-10"},
+		{"Saturday to Sunday", nil, "2024-11-09", "2024-11-10"},
+		{"Thursday to Sunday", nil, "2024-11-07", "2024-11-10"},
+		{"Sunday to Monday", nil, "2024-11-10", "2024-11-11"},
+		{"Skips holidays", []string{"2024-12-25", "2024-12-26"}, "2024-12-24", "2024-12-29"},
+		{"Across the year boundary", []string{"2024-12-31", "2025-01-01"}, "2024-12-30", "2025-01-02"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mustCalendar(t, tt.holidays...)
+			day, _ := ParseDate(tt.date)
+			got, ok := c.NextAnnouncement(day)
+			if !ok {
+				t.Fatalf("NextAnnouncement(%s) found no announcement", tt.date)
+			}
+			if got.Format(DateLayout) != tt.want {
+				t.Errorf("NextAnnouncement(%s) = %s, want %s", tt.date, got.Format(DateLayout), tt.want)
+			}
+		})
+	}
+}
+
+func TestAnnouncement(t *testing.T) {
+	tests := []struct {
+		name      string
+		holidays  []string
+		submitted string
+		want      string
+		listing   string
+	}{
+		// The deadline is at 14:00 US Eastern, i.e., 19:00 UTC in November after the DST change
+		{"Weekday before the deadline", nil, "2024-11-06 18:59", "2024-11-06", "2024-11-07"},
+		{"Weekday at the deadline", nil, "2024-11-06 19:00", "2024-11-06", "2024-11-07"},
+		{"Weekday after the deadline", nil, "2024-11-06 19:01", "2024-11-07", "2024-11-08"},
+		{"Evening Eastern, next day UTC", nil, "2024-11-07 03:00", "2024-11-07", "2024-11-08"},
+		{"Thursday after the deadline", nil, "2024-11-07 20:00", "2024-11-10", "2024-11-11"},
+		{"Friday before the deadline", nil, "2024-11-08 15:00", "2024-11-10", "2024-11-11"},
+		{"Friday after the deadline", nil, "2024-11-08 19:30", "2024-11-11", "2024-11-12"},
+		{"Saturday", nil, "2024-11-09 12:00", "2024-11-11", "2024-11-12"},
+		{"Sunday", nil, "2024-11-10 12:00", "2024-11-11", "2024-11-12"},
+		{"Before a holiday", []string{"2024-12-25"}, "2024-12-24 20:00", "2024-12-26", "2024-12-27"},
+		{"On a holiday", []string{"2024-12-25"}, "2024-12-25 15:00", "2024-12-26", "2024-12-27"},
+		{"Before a Sunday holiday", []string{"2024-12-29"}, "2024-12-27 15:00", "2024-12-30", "2024-12-31"},
+		// 2024-11-03 ends DST: the Friday deadline is at 18:00 UTC, the Monday one at 19:00 UTC
+		{"Friday before the end of DST", nil, "2024-11-01 18:30", "2024-11-04", "2024-11-05"},
+		{"Monday after the end of DST", nil, "2024-11-04 18:30", "2024-11-04", "2024-11-05"},
+		// 2025-03-09 starts DST: the Friday deadline is at 19:00 UTC, the Monday one at 18:00 UTC
+		{"Friday before the start of DST", nil, "2025-03-07 18:30", "2025-03-09", "2025-03-10"},
+		{"Monday after the start of DST", nil, "2025-03-10 18:30", "2025-03-11", "2025-03-12"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mustCalendar(t, tt.holidays...)
+			got, ok := c.Announcement(utc(tt.submitted))
+			if !ok {
+				t.Fatalf("Announcement(%s) found no announcement", tt.submitted)
+			}
+			if got.Format(DateLayout) != tt.want {
+				t.Errorf("Announcement(%s) = %s, want %s", tt.submitted, got.Format(DateLayout), tt.want)
+			}
+			if listing := ListingDay(got).Format(DateLayout); listing != tt.listing {
+				t.Errorf("ListingDay(%s) = %s, want %s", tt.want, listing, tt.listing)
+			}
+		})
+	}
+}
+
+func TestSubmittedDateQuery(t *testing.T) {
+	day, _ := ParseDate("2024-11-07")
+	window, ok := mustCalendar(t).Window(day)
+	if !ok {
+		t.Fatal("expected an announcement on 2024-11-07")
+	}
+	if got, want := window.SubmittedDateQuery(), "submittedDate:[202411061900+TO+202411071900]"; got != want {
+		t.Errorf("SubmittedDateQuery() = %q, want %q", got, want)
+	}
+}
+
+func TestParseDateAndHolidays(t *testing.T) {
+	for _, input := range []string{"2024-13-01", "07/11/2024", "2024-11-07T00:00:00Z", ""} {
+		if _, err := ParseDate(input); err == nil {
+			t.Errorf("ParseDate(%q) should fail", input)
+		}
+	}
+	for _, input := range []string{"2024-13", "2024-3", "03/2024", "2024-03-04"} {
+		if _, err := ParseMonth(input); err == nil {
+			t.Errorf("ParseMonth(%q) should fail", input)
+		}
+	}
+	if _, err := New([]string{"2024-12-25", "Christmas"}); err == nil || !strings.Contains(err.Error(), "Christmas") {
+		t.Errorf("New() with an invalid holiday error = %v, want it to name the invalid date", err)
+	}
+	// Blank entries, e.g., from a trailing comma in configuration, are ignored
+	if _, err := New([]string{"2024-12-25", " ", ""}); err != nil {
+		t.Errorf("New() with blank entries unexpected error: %v", err)
+	}
+}
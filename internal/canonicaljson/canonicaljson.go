@@ -0,0 +1,160 @@
+// Package canonicaljson encodes JSON deterministically, so that equal values always produce the
+// same bytes and outputs can be compared byte for byte.
+//
+// The canonical form is compact, with:
+//   - object keys sorted by their UTF-8 bytes, also for the fields of structs
+//   - integers, however they were written (e.g., 1e21 or 2.50e1), in plain decimal notation
+//   - other numbers in the shortest decimal notation that round-trips a float64, never with an exponent
+//   - strings escaped like encoding/json does by default, so that re-encoding canonical JSON with
+//     encoding/json, e.g., as a json.RawMessage, leaves it unchanged
+package canonicaljson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Marshal returns the canonical JSON encoding of a value, as encoded by encoding/json
+func Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Canonicalize(data)
+}
+
+// Canonicalize rewrites a JSON document in canonical form
+func Canonicalize(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if _, err := decoder.Token(); err == nil {
+		return nil, fmt.Errorf("invalid JSON: unexpected data after the top-level value")
+	}
+	var b bytes.Buffer
+	if err := encode(&b, v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func encode(b *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		number, err := formatNumber(v.String())
+		if err != nil {
+			return err
+		}
+		b.WriteString(number)
+	case string:
+		writeString(b, v)
+	case []any:
+		b.WriteByte('[')
+		for i, element := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := encode(b, element); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		b.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeString(b, key)
+			b.WriteByte(':')
+			if err := encode(b, v[key]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	default:
+		return fmt.Errorf("unexpected JSON value of type %T", v)
+	}
+	return nil
+}
+
+// formatNumber formats a JSON number literal canonically
+func formatNumber(literal string) (string, error) {
+	var exact big.Rat
+	if _, ok := exact.SetString(literal); !ok {
+		return "", fmt.Errorf("invalid JSON number %q", literal)
+	}
+	if exact.IsInt() {
+		// Also turns -0 into 0
+		return exact.Num().String(), nil
+	}
+	f, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		return "", fmt.Errorf("JSON number %q is out of range: %w", literal, err)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64), nil
+}
+
+const hex = "0123456789abcdef"
+
+// writeString writes a JSON string, escaping like encoding/json: quotes, backslashes and control
+// characters, the HTML-sensitive <, > and &, and the line and paragraph separators U+2028 and
+// U+2029. Invalid UTF-8 has already been replaced while decoding.
+func writeString(b *bytes.Buffer, s string) {
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case c == '\n':
+				b.WriteString(`\n`)
+			case c == '\r':
+				b.WriteString(`\r`)
+			case c == '\t':
+				b.WriteString(`\t`)
+			case c == '\b':
+				b.WriteString(`\b`)
+			case c == '\f':
+				b.WriteString(`\f`)
+			case c < 0x20 || c == '<' || c == '>' || c == '&':
+				b.WriteString(`\u00`)
+				b.WriteByte(hex[c>>4])
+				b.WriteByte(hex[c&0xf])
+			default:
+				b.WriteByte(c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch r {
+		case '\u2028', '\u2029':
+			b.WriteString(`\u202`)
+			b.WriteByte(hex[r&0xf])
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	b.WriteByte('"')
+}
@@ -0,0 +1,149 @@
+package canonicaljson
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		// Whitespace and key order
+		{"compacts whitespace", "{ \"a\" : [ 1 , 2 ] }\n", `{"a":[1,2]}`},
+		{"sorts keys", `{"b":1,"a":2,"c":3}`, `{"a":2,"b":1,"c":3}`},
+		{"sorts nested keys", `{"z":{"y":1,"x":[{"d":1,"c":2}]},"a":null}`, `{"a":null,"z":{"x":[{"c":2,"d":1}],"y":1}}`},
+		{"sorts keys by bytes", `{"b":1,"B":2,"é":3,"a":4,"_":5}`, `{"B":2,"_":5,"a":4,"b":1,"é":3}`},
+		{"keeps array order", `[3,1,2]`, `[3,1,2]`},
+		{"empty containers", `{"a":{},"b":[]}`, `{"a":{},"b":[]}`},
+		// Literals
+		{"literals", `[true,false,null]`, `[true,false,null]`},
+		{"top-level string", `"x"`, `"x"`},
+		// Integers are never rendered with exponents
+		{"integer", `42`, `42`},
+		{"negative integer", `-42`, `-42`},
+		{"integer with exponent", `1e21`, `1000000000000000000000`},
+		{"integer with fraction and exponent", `2.50e1`, `25`},
+		{"integer with trailing zeros", `7.000`, `7`},
+		{"negative zero", `-0`, `0`},
+		{"negative zero float", `-0.0`, `0`},
+		{"large integer", `123456789012345678901234567890`, `123456789012345678901234567890`},
+		{"integer beyond float64 precision", `9007199254740993`, `9007199254740993`},
+		// Other numbers use the shortest round-tripping decimal notation
+		{"fraction", `0.5`, `0.5`},
+		{"fraction with trailing zeros", `1.250`, `1.25`},
+		{"small number with exponent", `1e-7`, `0.0000001`},
+		{"negative fraction with exponent", `-2.5E-3`, `-0.0025`},
+		{"shortest form", `0.1000000000000000055511151231257827`, `0.1`},
+		// Strings are escaped like encoding/json
+		{"escapes html", `"<a href=\"x\">&</a>"`, `"\u003ca href=\"x\"\u003e\u0026\u003c/a\u003e"`},
+		{"unescapes needless escapes", `"A\/"`, `"A/"`},
+		{"escapes control characters", `"a\u0001b\nc\td\re"`, `"a\u0001b\nc\td\re"`},
+		{"escapes separators", "\"a\u2028b\u2029c\"", `"a\u2028b\u2029c"`},
+		{"keeps other unicode", `"é😀"`, `"é😀"`},
+		{"sorts keys before escaping", `{"A":2,"<":1}`, `{"\u003c":1,"A":2}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Canonicalize([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Canonicalize(%s) unexpected error: %v", tt.input, err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Canonicalize(%s) = %s, want %s", tt.input, got, tt.want)
+			}
+			// Canonical JSON is a fixed point
+			again, err := Canonicalize(got)
+			if err != nil || string(again) != string(got) {
+				t.Errorf("Canonicalize(%s) = %s (error %v), want it unchanged", got, again, err)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeRejectsInvalidJSON(t *testing.T) {
+	for _, input := range []string{``, `{`, `{"a":1,}`, `[1 2]`, `{"a":1} {"b":2}`, `01`, `NaN`, `"unterminated`} {
+		if got, err := Canonicalize([]byte(input)); err == nil {
+			t.Errorf("Canonicalize(%q) = %s, want an error", input, got)
+		}
+	}
+}
+
+// TestStringsEscapedLikeEncodingJSON checks that strings are escaped exactly like encoding/json
+// escapes them, so that re-encoding canonical JSON as a json.RawMessage leaves it unchanged
+func TestStringsEscapedLikeEncodingJSON(t *testing.T) {
+	var all strings.Builder
+	for r := rune(0); r < 0x80; r++ {
+		all.WriteRune(r)
+	}
+	for _, s := range []string{all.String(), "\u2028\u2029é世\U0001f600", "\x7f", "plain"} {
+		want, err := json.Marshal(s)
+		if err != nil {
+			t.Fatalf("json.Marshal() unexpected error: %v", err)
+		}
+		got, err := Marshal(s)
+		if err != nil {
+			t.Fatalf("Marshal() unexpected error: %v", err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("Marshal(%q) = %s, want %s as encoded by encoding/json", s, got, want)
+		}
+		reencoded, err := json.Marshal(json.RawMessage(got))
+		if err != nil || string(reencoded) != string(got) {
+			t.Errorf("re-encoding %s as a json.RawMessage gave %s (error %v)", got, reencoded, err)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	type inner struct {
+		Zeta  float64 `json:"zeta"`
+		Alpha int64   `json:"alpha"`
+	}
+	value := struct {
+		Name   string            `json:"name"`
+		Inner  inner             `json:"inner"`
+		Labels map[string]string `json:"labels"`
+		Big    float64           `json:"big"`
+		Tiny   float64           `json:"tiny"`
+	}{
+		Name:   "<paper>",
+		Inner:  inner{Zeta: 0.25, Alpha: math.MaxInt64},
+		Labels: map[string]string{"b": "2", "a": "1"},
+		Big:    1e21,
+		Tiny:   1e-7,
+	}
+	// encoding/json renders these floats with exponents
+	if plain, _ := json.Marshal(value); !strings.Contains(string(plain), "1e+21") || !strings.Contains(string(plain), "1e-7") {
+		t.Fatalf("json.Marshal() = %s, expected exponents to check against", plain)
+	}
+
+	got, err := Marshal(value)
+	if err != nil {
+		t.Fatalf("Marshal() unexpected error: %v", err)
+	}
+	want := `{"big":1000000000000000000000,"inner":{"alpha":9223372036854775807,"zeta":0.25},"labels":{"a":"1","b":"2"},"name":"\u003cpaper\u003e","tiny":0.0000001}`
+	if string(got) != want {
+		t.Errorf("Marshal() = %s, want %s", got, want)
+	}
+
+	// Canonical JSON decodes to the same value
+	var decoded struct {
+		Big  float64 `json:"big"`
+		Tiny float64 `json:"tiny"`
+	}
+	if err := json.Unmarshal(got, &decoded); err != nil || decoded.Big != 1e21 || decoded.Tiny != 1e-7 {
+		t.Errorf("decoded canonical JSON = %+v (error %v), want the original numbers", decoded, err)
+	}
+
+	if _, err := Marshal(math.Inf(1)); err == nil {
+		t.Error("Marshal() of an infinite number should fail")
+	}
+	if _, err := Marshal(make(chan int)); err == nil {
+		t.Error("Marshal() of a channel should fail")
+	}
+}
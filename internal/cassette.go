@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CassetteConfig selects recording or replaying of the HTTP exchanges of the shared HTTP client, for
+// developing and testing without waiting on, or even reaching, arXiv
+type CassetteConfig struct {
+	// RecordDir is the directory every request and response is recorded to
+	RecordDir string `env:"OPUS_MCP_HTTP_RECORD_DIR"`
+	// ReplayDir is the directory requests are answered from, without any network access
+	ReplayDir string `env:"OPUS_MCP_HTTP_REPLAY_DIR"`
+}
+
+// sensitiveHeaders are left out of recordings, as they carry credentials or session state
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Amz-Security-Token", "X-Api-Key"}
+
+// recording is a recorded HTTP exchange, stored gzipped as JSON in a file named after its key
+type recording struct {
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	RequestHeader  http.Header `json:"requestHeader,omitempty"`
+	StatusCode     int         `json:"statusCode"`
+	ResponseHeader http.Header `json:"responseHeader,omitempty"`
+	Body           []byte      `json:"body"`
+}
+
+// CassetteMissError is returned in replay mode for a request that was never recorded
+type CassetteMissError struct {
+	Method string
+	URL    string
+	Path   string
+}
+
+func (e *CassetteMissError) Error() string {
+	return fmt.Sprintf("no recording of %s %s in replay mode (looked for %s); record it with OPUS_MCP_HTTP_RECORD_DIR", e.Method, e.URL, e.Path)
+}
+
+// Cassette is an HTTP round tripper that records every exchange to a directory, or answers
+// requests from the recordings in a directory without any network access
+type Cassette struct {
+	dir string
+	// next is the round tripper requests are recorded from; nil in replay mode
+	next http.RoundTripper
+}
+
+// NewRecordingCassette returns a round tripper sending requests through next and recording every
+// exchange in dir, which is created if needed
+func NewRecordingCassette(dir string, next http.RoundTripper) (*Cassette, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create HTTP record directory: %w", err)
+	}
+	return &Cassette{dir: dir, next: next}, nil
+}
+
+// NewReplayingCassette returns a round tripper answering requests from the recordings in dir, failing
+// with a CassetteMissError for requests that were not recorded
+func NewReplayingCassette(dir string) (*Cassette, error) {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("HTTP replay directory %q is not a readable directory", dir)
+	}
+	return &Cassette{dir: dir}, nil
+}
+
+// wrapWithCassette wraps a transport in a cassette as configured, or returns it unchanged
+func wrapWithCassette(config *CassetteConfig, transport http.RoundTripper) (http.RoundTripper, error) {
+	switch {
+	case config == nil || (config.RecordDir == "" && config.ReplayDir == ""):
+		return transport, nil
+	case config.RecordDir != "" && config.ReplayDir != "":
+		return nil, fmt.Errorf("OPUS_MCP_HTTP_RECORD_DIR and OPUS_MCP_HTTP_REPLAY_DIR cannot both be set")
+	case config.ReplayDir != "":
+		slog.Warn("Replaying HTTP responses from recordings without network access", "dir", config.ReplayDir)
+		return NewReplayingCassette(config.ReplayDir)
+	}
+	slog.Warn("Recording HTTP requests and responses", "dir", config.RecordDir)
+	return NewRecordingCassette(config.RecordDir, transport)
+}
+
+// normalizeRequestURL is the URL a request is recorded under: without credentials or fragment, with a
+// lowercase scheme and host, without the scheme's default port and with the query parameters sorted
+func normalizeRequestURL(u *url.URL) string {
+	n := *u
+	n.User = nil
+	n.Fragment = ""
+	n.RawFragment = ""
+	n.Scheme = strings.ToLower(n.Scheme)
+	host := strings.ToLower(n.Host)
+	if (n.Scheme == "http" && strings.HasSuffix(host, ":80")) || (n.Scheme == "https" && strings.HasSuffix(host, ":443")) {
+		host = host[:strings.LastIndex(host, ":")]
+	}
+	n.Host = host
+	n.RawQuery = n.Query().Encode()
+	return n.String()
+}
+
+// recordingPath is the file an exchange is recorded in, named after the digest of the method, the
+// normalized URL and the request body
+func (c *Cassette) recordingPath(method, normalizedURL string, body []byte) string {
+	digest := sha256.New()
+	fmt.Fprintf(digest, "%s %s\n", method, normalizedURL)
+	digest.Write(body)
+	return filepath.Join(c.dir, hex.EncodeToString(digest.Sum(nil))[:32]+".json.gz")
+}
+
+// withoutSensitiveHeaders returns a copy of a header without the headers carrying credentials
+func withoutSensitiveHeaders(header http.Header) http.Header {
+	clean := header.Clone()
+	for _, name := range sensitiveHeaders {
+		clean.Del(name)
+	}
+	return clean
+}
+
+// RoundTrip records or replays a single HTTP exchange
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	normalized := normalizeRequestURL(req.URL)
+	path := c.recordingPath(req.Method, normalized, body)
+	if c.next == nil {
+		return c.replay(req, normalized, path)
+	}
+
+	resp, err := c.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body for recording: %w", err)
+	}
+	rec := recording{
+		Method:         req.Method,
+		URL:            normalized,
+		RequestHeader:  withoutSensitiveHeaders(req.Header),
+		StatusCode:     resp.StatusCode,
+		ResponseHeader: withoutSensitiveHeaders(resp.Header),
+		Body:           responseBody,
+	}
+	// A recording that cannot be written only costs the recording, not the request
+	if err := writeRecording(path, rec); err != nil {
+		slog.Warn("Failed to record HTTP exchange", "url", normalized, "error", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(responseBody))
+	resp.ContentLength = int64(len(responseBody))
+	return resp, nil
+}
+
+// replay answers a request from its recording
+func (c *Cassette) replay(req *http.Request, normalized, path string) (*http.Response, error) {
+	rec, err := readRecording(path)
+	if os.IsNotExist(err) {
+		return nil, &CassetteMissError{Method: req.Method, URL: normalized, Path: path}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording of %s %s: %w", req.Method, normalized, err)
+	}
+	header := rec.ResponseHeader.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	// The recorded date is not when the replayed response was sent, e.g., for clock skew checks
+	header.Del("Date")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.StatusCode, http.StatusText(rec.StatusCode)),
+		StatusCode:    rec.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(rec.Body)),
+		ContentLength: int64(len(rec.Body)),
+		Request:       req,
+	}, nil
+}
+
+// writeRecording stores a recording gzipped, replacing an earlier recording of the same request
+func writeRecording(path string, rec recording) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(rec); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readRecording loads a gzipped recording
+func readRecording(path string) (recording, error) {
+	var rec recording
+	f, err := os.Open(path)
+	if err != nil {
+		return rec, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return rec, err
+	}
+	defer zr.Close()
+	err = json.NewDecoder(zr).Decode(&rec)
+	return rec, err
+}
@@ -0,0 +1,127 @@
+// Package clock measures how far the local clock is off the clocks of the servers it talks to.
+//
+// Every HTTP response carries the time its server sent it in the Date header. Comparing that time
+// with the local time the response arrived at estimates the skew of the local clock, to within the
+// one second resolution of the header plus the latency of the response. The estimate is taken from
+// responses that are made anyway, e.g., to arXiv or S3 storage, so measuring it costs no request.
+package clock
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Measurement is the skew of the local clock measured from a response
+type Measurement struct {
+	// Skew is the remote time minus the local time: positive when the local clock is behind
+	Skew time.Duration
+	// Source names the server the response came from, e.g., arxiv or s3
+	Source string
+	// At is the local time the response arrived at
+	At time.Time
+}
+
+// Estimator keeps the latest measurement of the skew of the local clock and warns when it exceeds
+// a threshold. It is safe for concurrent use.
+type Estimator struct {
+	mu          sync.Mutex
+	threshold   time.Duration
+	measurement Measurement
+	measured    bool
+	// exceeded is set while the latest measurement exceeds the threshold, to warn once per episode
+	exceeded bool
+}
+
+// NewEstimator creates an estimator warning about skews beyond threshold
+func NewEstimator(threshold time.Duration) *Estimator {
+	return &Estimator{threshold: threshold}
+}
+
+// Shared is the estimator fed by every response the server receives from arXiv and S3 storage
+var Shared = NewEstimator(2 * time.Minute)
+
+// SetThreshold changes the skew beyond which the estimator warns
+func (e *Estimator) SetThreshold(threshold time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.threshold = threshold
+}
+
+// Threshold returns the skew beyond which the estimator warns
+func (e *Estimator) Threshold() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.threshold
+}
+
+// Observe measures the skew from the Date header of a response that arrived at the local time
+// received. Responses without a valid Date header are ignored.
+func (e *Estimator) Observe(source string, header http.Header, received time.Time) {
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return
+	}
+	// The header is truncated to the second, so the response was sent half a second later on average
+	skew := date.Add(500 * time.Millisecond).Sub(received)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.measurement = Measurement{Skew: skew, Source: source, At: received}
+	e.measured = true
+	exceeded := e.threshold > 0 && skew.Abs() > e.threshold
+	switch {
+	case exceeded && !e.exceeded:
+		slog.Warn("The server clock is off the clock of a remote server; date-sensitive results may be wrong",
+			"source", source, "skew", skew.Round(time.Second), "threshold", e.threshold)
+	case !exceeded && e.exceeded:
+		slog.Info("The server clock is back in step with the clock of a remote server", "source", source, "skew", skew.Round(time.Second))
+	}
+	e.exceeded = exceeded
+}
+
+// Latest returns the latest measurement, if any response has been measured
+func (e *Estimator) Latest() (Measurement, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.measurement, e.measured
+}
+
+// Exceeded reports whether the latest measurement exceeds the threshold
+func (e *Estimator) Exceeded() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.exceeded
+}
+
+// Correct returns a local time corrected by the latest measured skew, i.e., as the remote server's
+// clock would tell it, or unchanged if nothing has been measured
+func (e *Estimator) Correct(t time.Time) time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.measured {
+		return t
+	}
+	return t.Add(e.measurement.Skew)
+}
+
+// observingTransport passes requests on and measures the skew from every response
+type observingTransport struct {
+	next      http.RoundTripper
+	estimator *Estimator
+	source    string
+}
+
+func (t *observingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		t.estimator.Observe(t.source, resp.Header, time.Now())
+	}
+	return resp, err
+}
+
+// Transport wraps an HTTP transport to measure the skew from every response it receives
+func Transport(next http.RoundTripper, estimator *Estimator, source string) http.RoundTripper {
+	return &observingTransport{next: next, estimator: estimator, source: source}
+}
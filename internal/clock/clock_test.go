@@ -0,0 +1,75 @@
+package clock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEstimatorMeasuresSkew(t *testing.T) {
+	received := time.Date(2026, 2, 3, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		date         string
+		wantSkew     time.Duration
+		wantExceeded bool
+	}{
+		{"in step", "Tue, 03 Feb 2026 14:00:00 GMT", 500 * time.Millisecond, false},
+		{"local clock behind", "Tue, 03 Feb 2026 14:05:00 GMT", 5*time.Minute + 500*time.Millisecond, true},
+		{"local clock ahead", "Tue, 03 Feb 2026 13:57:00 GMT", -3*time.Minute + 500*time.Millisecond, true},
+		{"within threshold", "Tue, 03 Feb 2026 13:59:00 GMT", -time.Minute + 500*time.Millisecond, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEstimator(2 * time.Minute)
+			e.Observe("arxiv", http.Header{"Date": {tt.date}}, received)
+			got, ok := e.Latest()
+			if !ok || got.Skew != tt.wantSkew || got.Source != "arxiv" || !got.At.Equal(received) {
+				t.Errorf("Latest() = %+v, %v, want a skew of %v from arxiv", got, ok, tt.wantSkew)
+			}
+			if e.Exceeded() != tt.wantExceeded {
+				t.Errorf("Exceeded() = %v, want %v", e.Exceeded(), tt.wantExceeded)
+			}
+			if corrected := e.Correct(received); !corrected.Equal(received.Add(tt.wantSkew)) {
+				t.Errorf("Correct() = %v, want %v", corrected, received.Add(tt.wantSkew))
+			}
+		})
+	}
+}
+
+func TestEstimatorIgnoresMissingDate(t *testing.T) {
+	e := NewEstimator(2 * time.Minute)
+	now := time.Date(2026, 2, 3, 14, 0, 0, 0, time.UTC)
+	e.Observe("s3", http.Header{}, now)
+	e.Observe("s3", http.Header{"Date": {"yesterday"}}, now)
+	if _, ok := e.Latest(); ok {
+		t.Error("Latest() reported a measurement from responses without a valid Date")
+	}
+	if corrected := e.Correct(now); !corrected.Equal(now) {
+		t.Errorf("Correct() = %v without a measurement, want the time unchanged", corrected)
+	}
+}
+
+func TestTransportObservesResponses(t *testing.T) {
+	skewed := time.Now().Add(-10 * time.Minute).UTC().Format(http.TimeFormat)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", skewed)
+	}))
+	defer srv.Close()
+
+	e := NewEstimator(2 * time.Minute)
+	client := &http.Client{Transport: Transport(http.DefaultTransport, e, "s3")}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	got, ok := e.Latest()
+	if !ok || got.Source != "s3" || got.Skew > -9*time.Minute || got.Skew < -11*time.Minute {
+		t.Errorf("Latest() = %+v, %v, want a skew of about -10m from s3", got, ok)
+	}
+	if !e.Exceeded() {
+		t.Error("Exceeded() = false, want a 10 minute skew to exceed the threshold")
+	}
+}
@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"context"
+	"io"
+)
+
+// contextReader stops reading once its context is done
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+// ContextReader returns a reader that fails with the context's error as soon as the context is
+// done, rather than only when a read of r happens to fail, and that reports a read of r failing
+// because of the cancellation as the context's error
+func ContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, reader: r}
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		if ctxErr := r.ctx.Err(); ctxErr != nil {
+			return n, ctxErr
+		}
+	}
+	return n, err
+}
+
+// ReadAll reads r until EOF, like io.ReadAll, unless the context is done first
+func ReadAll(ctx context.Context, r io.Reader) ([]byte, error) {
+	return io.ReadAll(ContextReader(ctx, r))
+}
@@ -1,35 +1,89 @@
 package internal
 
 import (
+	"cmp"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/mail"
 	"net/url"
 	"os"
-	"time"
+	"strings"
+	"sync"
 
-	"github.com/sethvargo/go-envconfig"
+	"opus-mcp/internal/metadata"
+	"opus-mcp/internal/settings"
 )
 
+// ProjectURL is the home of the project, named in the User-Agent of outbound requests
+const ProjectURL = "https://github.com/anirbanbasu/opus-mcp"
+
 type HTTPClientConfig struct {
 	HTTPProxyConfig    *HTTPProxyConfig
 	TLSSecureConfig    *TLSSecureConfig
 	MaxIdleConnections int                `env:"OPUS_MCP_HTTP_MAX_IDLE_CONNECTIONS,default=10"`
 	HTTPTimeoutConfig  *HTTPTimeoutConfig `env:",prefix=OPUS_MCP_"`
+	CassetteConfig     *CassetteConfig
+	// UserAgent replaces the default User-Agent of outbound requests, see RequestUserAgent
+	UserAgent string `env:"OPUS_MCP_HTTP_USER_AGENT"`
+	// ContactEmail is appended to the User-Agent, so that services such as arXiv can reach the operator
+	ContactEmail string `env:"OPUS_MCP_HTTP_CONTACT_EMAIL"`
+}
+
+// RequestUserAgent returns the User-Agent header of outbound requests: OPUS_MCP_HTTP_USER_AGENT, or else
+// the application name and build version with the project URL, followed by the contact email if
+// one is configured
+func (c *HTTPClientConfig) RequestUserAgent() string {
+	agent := strings.TrimSpace(c.UserAgent)
+	if agent == "" {
+		version := metadata.BuildVersion
+		if version == "" || strings.HasPrefix(version, "uninitialised") {
+			version = "dev"
+		}
+		agent = fmt.Sprintf("%s/%s (+%s)", metadata.APP_NAME, version, ProjectURL)
+	}
+	if c.ContactEmail != "" {
+		agent += " (mailto:" + c.ContactEmail + ")"
+	}
+	return agent
+}
+
+// Validate reports the problems of the HTTP client configuration together
+func (c *HTTPClientConfig) Validate() error {
+	var errs []error
+	if c.MaxIdleConnections < 0 {
+		errs = append(errs, fmt.Errorf("OPUS_MCP_HTTP_MAX_IDLE_CONNECTIONS cannot be negative, got %d", c.MaxIdleConnections))
+	}
+	if c.CassetteConfig != nil && c.CassetteConfig.RecordDir != "" && c.CassetteConfig.ReplayDir != "" {
+		errs = append(errs, errors.New("OPUS_MCP_HTTP_RECORD_DIR and OPUS_MCP_HTTP_REPLAY_DIR cannot both be set"))
+	}
+	if strings.ContainsAny(c.UserAgent, "\r\n") {
+		errs = append(errs, errors.New("OPUS_MCP_HTTP_USER_AGENT cannot contain line breaks"))
+	}
+	if c.ContactEmail != "" {
+		if address, err := mail.ParseAddress(c.ContactEmail); err != nil || address.Address != c.ContactEmail {
+			errs = append(errs, fmt.Errorf("OPUS_MCP_HTTP_CONTACT_EMAIL must be a plain email address, got %q", c.ContactEmail))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 type HTTPTimeoutConfig struct {
-	IdleConnectionTimeout time.Duration `env:"HTTP_IDLE_CONNECTION_TIMEOUT,default=30s"`
-	TLSHandshakeTimeout   time.Duration `env:"HTTP_TLS_HANDSHAKE_TIMEOUT,default=10s"`
-	ClientTimeout         time.Duration `env:"HTTP_CLIENT_TIMEOUT,default=30s"`
+	IdleConnectionTimeout settings.Duration `env:"HTTP_IDLE_CONNECTION_TIMEOUT,default=30s"`
+	TLSHandshakeTimeout   settings.Duration `env:"HTTP_TLS_HANDSHAKE_TIMEOUT,default=10s"`
+	ClientTimeout         settings.Duration `env:"HTTP_CLIENT_TIMEOUT,default=30s"`
 }
 
 type HTTPProxyConfig struct {
 	// Use default for aliasing, see: https://github.com/sethvargo/go-envconfig/issues/134#issuecomment-3765442176
-	HttpProxy  string `env:"http_proxy,default=$HTTP_PROXY"`
-	HttpsProxy string `env:"https_proxy,default=$HTTPS_PROXY"`
+	// Proxy URLs may carry credentials, so they are reported as secrets
+	HttpProxy  string `env:"http_proxy,default=$HTTP_PROXY" secret:"true"`
+	HttpsProxy string `env:"https_proxy,default=$HTTPS_PROXY" secret:"true"`
 	NoProxy    string `env:"no_proxy,default=$NO_PROXY"`
 }
 
@@ -37,6 +91,8 @@ type TLSSecureConfig struct {
 	SslCertFile      string `env:"SSL_CERT_FILE,default="`
 	RequestsCaBundle string `env:"REQUESTS_CA_BUNDLE,default="`
 	CurlCaBundle     string `env:"CURL_CA_BUNDLE,default="`
+	// RequireCustomCA refuses to fall back to the system CAs when no custom CA bundle loads
+	RequireCustomCA bool `env:"OPUS_MCP_TLS_REQUIRE_CUSTOM_CA,default=false"`
 	// InsecureSkipVerify indicates whether to skip TLS certificate verification.
 	// ⚠️ WARNING: Disabling verification is insecure and should only be used in development/testing.
 	InsecureSkipVerify bool `env:"OPUS_MCP_INSECURE_SKIP_VERIFY,default=false"`
@@ -46,6 +102,8 @@ type TLSSecureConfig struct {
 // It respects standard proxy environment variables (HTTP_PROXY, HTTPS_PROXY, NO_PROXY) and
 // supports custom CA certificates via SSL_CERT_FILE or REQUESTS_CA_BUNDLE environment variables.
 // If OPUS_MCP_INSECURE_SKIP_VERIFY=true is set, certificate verification will be disabled (⚠️ INSECURE).
+// OPUS_MCP_HTTP_RECORD_DIR or OPUS_MCP_HTTP_REPLAY_DIR record or replay every exchange, see Cassette.
+// Every request identifies the server with the User-Agent of the configuration, see UserAgentTransport.
 func CreateConfiguredHTTPClient() (*http.Client, error) {
 	// Setup TLS config
 	tlsConfig := &tls.Config{
@@ -54,13 +112,22 @@ func CreateConfiguredHTTPClient() (*http.Client, error) {
 
 	ctx := context.Background()
 	var config HTTPClientConfig
-	if err := envconfig.Process(ctx, &config); err != nil {
+	if err := settings.Process(ctx, &config); err != nil {
 		slog.Error("Failed to process HTTP secure configuration from environment", "error", err)
 		return nil, err
 	}
+	if err := config.Validate(); err != nil {
+		slog.Error("Invalid HTTP client configuration", "error", err)
+		return nil, err
+	}
 
-	// Load custom CAs if specified
-	if customCA := LoadCustomCABundle(config.TLSSecureConfig); customCA != nil {
+	// Load custom CAs if specified, failing rather than falling back to the system CAs if none loads
+	customCA, err := LoadCustomCABundle(config.TLSSecureConfig)
+	if err != nil {
+		slog.Error("Failed to load custom CA certificates", "error", err)
+		return nil, err
+	}
+	if customCA != nil {
 		tlsConfig.RootCAs = customCA
 	}
 
@@ -75,8 +142,8 @@ func CreateConfiguredHTTPClient() (*http.Client, error) {
 		Proxy:               http.ProxyFromEnvironment,
 		TLSClientConfig:     tlsConfig,
 		MaxIdleConns:        config.MaxIdleConnections,
-		IdleConnTimeout:     config.HTTPTimeoutConfig.IdleConnectionTimeout,
-		TLSHandshakeTimeout: config.HTTPTimeoutConfig.TLSHandshakeTimeout,
+		IdleConnTimeout:     config.HTTPTimeoutConfig.IdleConnectionTimeout.Duration(),
+		TLSHandshakeTimeout: config.HTTPTimeoutConfig.TLSHandshakeTimeout.Duration(),
 	}
 
 	// Log proxy configuration if set (with credentials removed)
@@ -88,24 +155,96 @@ func CreateConfiguredHTTPClient() (*http.Client, error) {
 		slog.Info("Using HTTPS proxy", "proxy", SanitizeProxyURL(config.HTTPProxyConfig.HttpsProxy))
 	}
 
+	// Exchanges are recorded or replayed for offline development, if so configured
+	roundTripper, err := wrapWithCassette(config.CassetteConfig, transport)
+	if err != nil {
+		return nil, err
+	}
+
 	return &http.Client{
-		Transport: transport,
-		Timeout:   config.HTTPTimeoutConfig.ClientTimeout,
+		// The User-Agent is set before a cassette records the request
+		Transport: &UserAgentTransport{UserAgent: config.RequestUserAgent(), Next: roundTripper},
+		Timeout:   config.HTTPTimeoutConfig.ClientTimeout.Duration(),
 	}, nil
 }
 
+// UserAgentTransport sets the User-Agent header of the requests it sends through Next, unless a
+// request already has one, since arXiv asks clients to identify themselves rather than send Go's
+// default
+type UserAgentTransport struct {
+	UserAgent string
+	Next      http.RoundTripper
+}
+
+func (t *UserAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") != "" {
+		return t.Next.RoundTrip(req)
+	}
+	// A RoundTripper must not modify the request it is given
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.UserAgent)
+	return t.Next.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of Next, so that http.Client.CloseIdleConnections
+// reaches the wrapped transport
+func (t *UserAgentTransport) CloseIdleConnections() {
+	if closer, ok := t.Next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// sharedClient is a configured HTTP client built on first use
+type sharedClient struct {
+	once   sync.Once
+	client *http.Client
+	err    error
+}
+
+var (
+	sharedHTTPClientMu sync.Mutex
+	sharedHTTPClient   = &sharedClient{}
+)
+
+// GetSharedHTTPClient returns the HTTP client configured from the environment, built by
+// CreateConfiguredHTTPClient on the first call and reused by every later one, so that its transport
+// pools connections across requests. A configuration that fails to build is reported by every call,
+// since the environment does not change while the server runs.
+func GetSharedHTTPClient() (*http.Client, error) {
+	sharedHTTPClientMu.Lock()
+	shared := sharedHTTPClient
+	sharedHTTPClientMu.Unlock()
+	shared.once.Do(func() {
+		shared.client, shared.err = CreateConfiguredHTTPClient()
+	})
+	return shared.client, shared.err
+}
+
+// ResetSharedHTTPClient discards the shared HTTP client, closing its idle connections, so that the
+// next call to GetSharedHTTPClient builds a new one from the environment, e.g., in tests that change
+// it
+func ResetSharedHTTPClient() {
+	sharedHTTPClientMu.Lock()
+	previous := sharedHTTPClient
+	sharedHTTPClient = &sharedClient{}
+	sharedHTTPClientMu.Unlock()
+	// Wait for a build in progress, or prevent a later one, before closing its connections
+	previous.once.Do(func() {})
+	if previous.client != nil {
+		previous.client.CloseIdleConnections()
+	}
+}
+
 // LoadCustomCABundle loads custom CA certificates from environment-specified paths.
 // It checks SSL_CERT_FILE, REQUESTS_CA_BUNDLE, and CURL_CA_BUNDLE in that order.
 // Returns a cert pool with system CAs plus any custom CAs found, or nil if none specified.
-func LoadCustomCABundle(tlsConfig *TLSSecureConfig) *x509.CertPool {
+// A bundle that cannot be read or holds no certificate is skipped with a warning, but if bundles
+// are specified and none of them loads, or none is and OPUS_MCP_TLS_REQUIRE_CUSTOM_CA is set, it
+// returns an error naming every path tried and what was wrong with it. Falling back to the system
+// CAs then would only fail every later request, e.g., behind a TLS-intercepting proxy.
+func LoadCustomCABundle(tlsConfig *TLSSecureConfig) (*x509.CertPool, error) {
 	if tlsConfig == nil {
-		return nil
-	}
-	// Start with system's trusted CAs
-	rootCAs, err := x509.SystemCertPool()
-	if err != nil {
-		slog.Warn("Failed to load system cert pool, creating new one", "error", err)
-		rootCAs = x509.NewCertPool()
+		return nil, nil
 	}
 
 	// Check environment variables for custom CA paths
@@ -118,26 +257,69 @@ func LoadCustomCABundle(tlsConfig *TLSSecureConfig) *x509.CertPool {
 		{"CURL_CA_BUNDLE", tlsConfig.CurlCaBundle},
 	}
 
-	loadedAny := false
+	var rootCAs *x509.CertPool
+	var failures []error
 	for _, ca := range caPaths {
-		if ca.path != "" {
-			if caCert, err := os.ReadFile(ca.path); err == nil {
-				if rootCAs.AppendCertsFromPEM(caCert) {
-					slog.Info("Loaded custom CA certificate", "env_var", ca.envVar, "path", ca.path)
-					loadedAny = true
-				} else {
-					slog.Warn("Failed to parse CA certificate", "env_var", ca.envVar, "path", ca.path)
-				}
-			} else {
-				slog.Warn("Failed to load CA certificate file", "env_var", ca.envVar, "path", ca.path, "error", err)
+		if ca.path == "" {
+			continue
+		}
+		certs, err := readCABundle(ca.path)
+		if err != nil {
+			slog.Warn("Failed to load CA certificate bundle", "env_var", ca.envVar, "path", ca.path, "error", err)
+			failures = append(failures, fmt.Errorf("%s=%s: %w", ca.envVar, ca.path, err))
+			continue
+		}
+		if rootCAs == nil {
+			// Start with system's trusted CAs
+			if rootCAs, err = x509.SystemCertPool(); err != nil {
+				slog.Warn("Failed to load system cert pool, creating new one", "error", err)
+				rootCAs = x509.NewCertPool()
 			}
 		}
+		for _, cert := range certs {
+			rootCAs.AddCert(cert)
+		}
+		slog.Info("Loaded custom CA certificate", "env_var", ca.envVar, "path", ca.path, "certificates", len(certs))
 	}
 
-	if loadedAny {
-		return rootCAs
+	switch {
+	case rootCAs != nil:
+		return rootCAs, nil
+	case len(failures) > 0:
+		return nil, fmt.Errorf("none of the configured CA bundles could be loaded: %w", errors.Join(failures...))
+	case tlsConfig.RequireCustomCA:
+		return nil, errors.New("OPUS_MCP_TLS_REQUIRE_CUSTOM_CA is set, but none of SSL_CERT_FILE, REQUESTS_CA_BUNDLE or CURL_CA_BUNDLE is")
+	}
+	return nil, nil // Use default system CAs
+}
+
+// readCABundle reads the certificates of a PEM bundle, failing if it holds none. The certificates
+// that do parse are returned even if others do not, like x509.CertPool.AppendCertsFromPEM does.
+func readCABundle(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	var parseErr error
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" || len(block.Headers) != 0 {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			parseErr = cmp.Or(parseErr, err)
+			continue
+		}
+		certs = append(certs, cert)
+	}
+	switch {
+	case len(certs) > 0:
+		return certs, nil
+	case parseErr != nil:
+		return nil, fmt.Errorf("no usable certificate: %w", parseErr)
 	}
-	return nil // Use default system CAs
+	return nil, errors.New("no PEM-encoded certificate")
 }
 
 // SanitizeProxyURL removes username and password from a proxy URL before logging.
@@ -0,0 +1,251 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/metadata"
+)
+
+// writeCABundle writes a bundle to a temporary file and returns its path
+func writeCABundle(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write CA bundle: %v", err)
+	}
+	return path
+}
+
+// selfSignedCA returns a PEM-encoded self-signed CA certificate
+func selfSignedCA(t *testing.T, commonName string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestLoadCustomCABundle(t *testing.T) {
+	valid := writeCABundle(t, "proxy-ca.pem", selfSignedCA(t, "Corporate Proxy CA"))
+	notPEM := writeCABundle(t, "not-pem.pem", []byte("not a certificate"))
+	corrupt := writeCABundle(t, "corrupt.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")}))
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+
+	tests := []struct {
+		name       string
+		config     *TLSSecureConfig
+		wantPool   bool
+		wantErrors []string
+	}{
+		{"None configured", &TLSSecureConfig{}, false, nil},
+		{"No configuration", nil, false, nil},
+		{"Valid bundle", &TLSSecureConfig{SslCertFile: valid}, true, nil},
+		{"Partially valid", &TLSSecureConfig{SslCertFile: missing, RequestsCaBundle: notPEM, CurlCaBundle: valid}, true, nil},
+		{
+			name:     "All invalid",
+			config:   &TLSSecureConfig{SslCertFile: missing, RequestsCaBundle: notPEM, CurlCaBundle: corrupt},
+			wantPool: false,
+			wantErrors: []string{
+				"SSL_CERT_FILE=" + missing, "no such file",
+				"REQUESTS_CA_BUNDLE=" + notPEM, "no PEM-encoded certificate",
+				"CURL_CA_BUNDLE=" + corrupt, "no usable certificate",
+			},
+		},
+		{"Required and valid", &TLSSecureConfig{RequestsCaBundle: valid, RequireCustomCA: true}, true, nil},
+		{"Required but none configured", &TLSSecureConfig{RequireCustomCA: true}, false, []string{"OPUS_MCP_TLS_REQUIRE_CUSTOM_CA"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := LoadCustomCABundle(tt.config)
+			if (pool != nil) != tt.wantPool {
+				t.Errorf("LoadCustomCABundle() pool = %v, want a pool: %v", pool, tt.wantPool)
+			}
+			if len(tt.wantErrors) == 0 {
+				if err != nil {
+					t.Errorf("LoadCustomCABundle() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("LoadCustomCABundle() error = nil, want errors containing %q", tt.wantErrors)
+			}
+			for _, want := range tt.wantErrors {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("LoadCustomCABundle() error = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+// TestCreateConfiguredHTTPClientFailsWithoutUsableCA checks that a client is not built when the
+// only configured CA bundle is unusable, instead of falling back to the system CAs
+func TestCreateConfiguredHTTPClientFailsWithoutUsableCA(t *testing.T) {
+	t.Setenv("SSL_CERT_FILE", writeCABundle(t, "not-pem.pem", []byte("not a certificate")))
+	t.Setenv("REQUESTS_CA_BUNDLE", "")
+	t.Setenv("CURL_CA_BUNDLE", "")
+	if _, err := CreateConfiguredHTTPClient(); err == nil || !strings.Contains(err.Error(), "SSL_CERT_FILE") {
+		t.Errorf("CreateConfiguredHTTPClient() error = %v, want an error naming SSL_CERT_FILE", err)
+	}
+}
+
+// TestSharedHTTPClientReusesConnections checks that the shared client is built once and pools its
+// connections across requests, until it is reset
+func TestSharedHTTPClientReusesConnections(t *testing.T) {
+	var connections atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+	ResetSharedHTTPClient()
+	t.Cleanup(ResetSharedHTTPClient)
+
+	first, err := GetSharedHTTPClient()
+	if err != nil {
+		t.Fatalf("GetSharedHTTPClient() unexpected error: %v", err)
+	}
+	for range 5 {
+		client, err := GetSharedHTTPClient()
+		if err != nil {
+			t.Fatalf("GetSharedHTTPClient() unexpected error: %v", err)
+		}
+		if client != first {
+			t.Fatal("GetSharedHTTPClient() built a new client, want the first one reused")
+		}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("GET unexpected error: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if got := connections.Load(); got != 1 {
+		t.Errorf("5 requests opened %d connections, want 1 reused by all", got)
+	}
+
+	ResetSharedHTTPClient()
+	client, err := GetSharedHTTPClient()
+	if err != nil {
+		t.Fatalf("GetSharedHTTPClient() unexpected error: %v", err)
+	}
+	if client == first {
+		t.Error("GetSharedHTTPClient() after a reset returned the discarded client")
+	}
+}
+
+// TestConfiguredHTTPClientUserAgent checks the User-Agent that requests of the configured client
+// arrive with
+func TestConfiguredHTTPClientUserAgent(t *testing.T) {
+	var got atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.Store(r.Header.Get("User-Agent"))
+	}))
+	defer server.Close()
+	originalVersion := metadata.BuildVersion
+	t.Cleanup(func() { metadata.BuildVersion = originalVersion })
+	metadata.BuildVersion = "1.2.3"
+
+	tests := []struct {
+		name      string
+		userAgent string
+		email     string
+		header    string
+		want      string
+	}{
+		{name: "Default", want: "opus-mcp/1.2.3 (+https://github.com/anirbanbasu/opus-mcp)"},
+		{name: "Contact email", email: "ops@example.org", want: "opus-mcp/1.2.3 (+https://github.com/anirbanbasu/opus-mcp) (mailto:ops@example.org)"},
+		{name: "Override", userAgent: "library-bot/2.0", email: "ops@example.org", want: "library-bot/2.0 (mailto:ops@example.org)"},
+		{name: "Set by the request", header: "opus-mcp-test", want: "opus-mcp-test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OPUS_MCP_HTTP_USER_AGENT", tt.userAgent)
+			t.Setenv("OPUS_MCP_HTTP_CONTACT_EMAIL", tt.email)
+			client, err := CreateConfiguredHTTPClient()
+			if err != nil {
+				t.Fatalf("CreateConfiguredHTTPClient() unexpected error: %v", err)
+			}
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			if tt.header != "" {
+				req.Header.Set("User-Agent", tt.header)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("GET unexpected error: %v", err)
+			}
+			resp.Body.Close()
+			if got.Load() != tt.want {
+				t.Errorf("User-Agent = %q, want %q", got.Load(), tt.want)
+			}
+		})
+	}
+
+	t.Run("Invalid contact email", func(t *testing.T) {
+		t.Setenv("OPUS_MCP_HTTP_CONTACT_EMAIL", "Ops <ops@example.org>")
+		if _, err := CreateConfiguredHTTPClient(); err == nil || !strings.Contains(err.Error(), "OPUS_MCP_HTTP_CONTACT_EMAIL") {
+			t.Errorf("CreateConfiguredHTTPClient() error = %v, want an error naming OPUS_MCP_HTTP_CONTACT_EMAIL", err)
+		}
+	})
+}
+
+// BenchmarkGetSharedHTTPClient compares getting the shared client with building a configured one,
+// which processes the environment and reads the CA bundles every time
+func BenchmarkGetSharedHTTPClient(b *testing.B) {
+	b.Run("shared", func(b *testing.B) {
+		ResetSharedHTTPClient()
+		b.Cleanup(ResetSharedHTTPClient)
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := GetSharedHTTPClient(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("configured", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := CreateConfiguredHTTPClient(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
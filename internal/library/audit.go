@@ -0,0 +1,97 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"opus-mcp/internal/canonicaljson"
+	"opus-mcp/internal/storage"
+)
+
+// AuditObjectName is the name of the object holding the audit log in the articles bucket
+const AuditObjectName = "library/audit.jsonl"
+
+// AuditRecord records a change to the bucket made on behalf of a client, such as a cleanup
+type AuditRecord struct {
+	Action    string   `json:"action"`
+	Timestamp string   `json:"timestamp"`
+	Tool      string   `json:"tool,omitempty"`
+	SessionID string   `json:"sessionId,omitempty"`
+	Client    string   `json:"client,omitempty"`
+	ClientID  string   `json:"clientId,omitempty"`
+	Objects   []string `json:"objects,omitempty"`
+	// Source is the URL the objects were downloaded from, for downloads
+	Source string `json:"source,omitempty"`
+	Bytes  int64  `json:"bytes,omitempty"`
+	// Failed lists the objects the action was meant to, but could not, change
+	Failed []string `json:"failed,omitempty"`
+}
+
+// AuditLog is an append-only log of changes to the bucket, kept as one JSON record per line.
+// Appends are serialised within the process with a read-modify-write of the whole log.
+type AuditLog struct {
+	mu    sync.Mutex
+	store Store
+}
+
+// NewAuditLog creates an audit log backed by the given store
+func NewAuditLog(store Store) *AuditLog {
+	return &AuditLog{store: store}
+}
+
+// Append adds a record to the end of the log
+func (a *AuditLog) Append(ctx context.Context, record AuditRecord) error {
+	// Canonical JSON, so that the same record is always logged as the same line
+	line, err := canonicaljson.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	data, err := a.store.Load(ctx)
+	if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+		return fmt.Errorf("failed to load audit log: %w", err)
+	}
+	var b bytes.Buffer
+	b.Write(data)
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		b.WriteByte('\n')
+	}
+	b.Write(line)
+	b.WriteByte('\n')
+	if err := a.store.Save(ctx, b.Bytes()); err != nil {
+		return fmt.Errorf("failed to save audit log: %w", err)
+	}
+	return nil
+}
+
+// Records returns every record of the log, oldest first
+func (a *AuditLog) Records(ctx context.Context) ([]AuditRecord, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	data, err := a.store.Load(ctx)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load audit log: %w", err)
+	}
+	var records []AuditRecord
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("failed to parse audit log: %w", err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,47 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"opus-mcp/internal/canonicaljson"
+)
+
+func TestAuditLogAppend(t *testing.T) {
+	ctx := context.Background()
+	store := &MemoryStore{}
+	log := NewAuditLog(store)
+
+	records, err := log.Records(ctx)
+	if err != nil || len(records) != 0 {
+		t.Fatalf("Records() of an empty log = %+v, %v, want none", records, err)
+	}
+	want := []AuditRecord{
+		{Action: "cleanup", Timestamp: "2026-01-07T10:00:00Z", Tool: "library_cleanup", Objects: []string{"exports/old.csv"}, Bytes: 2048},
+		{Action: "cleanup", Timestamp: "2026-01-08T10:00:00Z", Tool: "library_cleanup", Failed: []string{"arxiv/2405.12345v1.pdf"}},
+	}
+	for _, record := range want {
+		if err := log.Append(ctx, record); err != nil {
+			t.Fatalf("Append() unexpected error: %v", err)
+		}
+	}
+
+	records, err = log.Records(ctx)
+	if err != nil {
+		t.Fatalf("Records() unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("Records() = %+v, want %+v", records, want)
+	}
+	data, _ := store.Load(ctx)
+	if lines := bytes.Count(data, []byte("\n")); lines != 2 {
+		t.Errorf("log has %d lines, want one per record:\n%s", lines, data)
+	}
+	for _, line := range bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")) {
+		if canonical, err := canonicaljson.Canonicalize(line); err != nil || !bytes.Equal(canonical, line) {
+			t.Errorf("log line %s is not canonical JSON", line)
+		}
+	}
+}
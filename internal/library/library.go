@@ -0,0 +1,312 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/canonicaljson"
+	"opus-mcp/internal/storage"
+)
+
+// IndexObjectName is the name of the object holding the library index in the articles bucket
+const IndexObjectName = "library/index.json"
+
+// indexVersion is the version of the index format written by this package
+const indexVersion = 1
+
+// StatusMetadataOnly marks an entry recorded from query results for an article that has not been
+// downloaded; downloading the article replaces the entry
+const StatusMetadataOnly = "metadata-only"
+
+// ErrNotFound is returned when an object has no entry in the library index
+var ErrNotFound = errors.New("object not found in library index")
+
+// Provenance records why an article was stored: the tool call that stored it and, when it could
+// be determined, the earlier query in the same session whose results contained the article
+type Provenance struct {
+	Tool      string   `json:"tool" jsonschema:"The tool that stored the article"`
+	QueryTool string   `json:"queryTool,omitempty" jsonschema:"The tool whose results led to the article, if determinable"`
+	Query     string   `json:"query,omitempty" jsonschema:"The search expression whose results contained the article, if determinable"`
+	IDList    []string `json:"idList,omitempty" jsonschema:"The ID list whose results contained the article, if determinable"`
+	SessionID string   `json:"sessionId,omitempty" jsonschema:"The MCP session in which the article was stored"`
+	Client    string   `json:"client,omitempty" jsonschema:"Name and version of the MCP client that stored the article"`
+	ClientID  string   `json:"clientId,omitempty" jsonschema:"Identity of the HTTP client that stored the article: a fingerprint of its bearer token or its address"`
+	Timestamp string   `json:"timestamp" jsonschema:"RFC 3339 time at which the article was stored"`
+}
+
+// ArticleMetadata is the bibliographic metadata of an article as returned by an arXiv query
+type ArticleMetadata struct {
+	Title           string   `json:"title,omitempty" jsonschema:"The title of the article"`
+	Authors         []string `json:"authors,omitempty" jsonschema:"The names of the authors of the article"`
+	PrimaryCategory string   `json:"primaryCategory,omitempty" jsonschema:"The arXiv category the article was submitted to"`
+	Categories      []string `json:"categories,omitempty" jsonschema:"All arXiv categories of the article"`
+	Published       string   `json:"published,omitempty" jsonschema:"RFC 3339 time at which the first version of the article was submitted"`
+	Updated         string   `json:"updated,omitempty" jsonschema:"RFC 3339 time at which the returned version of the article was submitted"`
+}
+
+// Entry describes a stored article in the library index
+type Entry struct {
+	ObjectName string `json:"objectName" jsonschema:"The name/path of the object in the bucket"`
+	// RequestedName is set when the object was renamed because its requested name was taken
+	RequestedName string      `json:"requestedName,omitempty" jsonschema:"The name the object was requested under, when that name was taken and the object was stored under a name with a suffix of its SHA-256 digest instead"`
+	Bucket        string      `json:"bucket" jsonschema:"The bucket the object is stored in"`
+	ArticleID     string      `json:"articleId,omitempty" jsonschema:"The canonical arXiv identifier of the article"`
+	SourceURL     string      `json:"sourceUrl,omitempty" jsonschema:"The URL the object was downloaded from"`
+	SHA256        string      `json:"sha256,omitempty" jsonschema:"Lowercase hex-encoded SHA-256 digest of the object"`
+	Size          int64       `json:"size,omitempty" jsonschema:"Size of the object in bytes"`
+	Provenance    *Provenance `json:"provenance,omitempty" jsonschema:"Why and how the article was stored"`
+	Summary       string      `json:"summary,omitempty" jsonschema:"The object holding a generated Markdown summary of the article, if any"`
+	// Status is only set for entries of articles that have not been downloaded
+	Status   string           `json:"status,omitempty" jsonschema:"metadata-only for an article recorded from query results without downloading it, whose objectName is the object a download would store it as; absent for stored objects"`
+	Metadata *ArticleMetadata `json:"metadata,omitempty" jsonschema:"The bibliographic metadata of the article, when it was recorded from query results"`
+}
+
+// index is the serialised form of the library index
+type index struct {
+	Version int              `json:"version"`
+	Entries map[string]Entry `json:"entries"`
+}
+
+// Store persists the serialised library index
+type Store interface {
+	// Load returns the stored index, or an error wrapping storage.ErrObjectNotFound if there is none yet
+	Load(ctx context.Context) ([]byte, error)
+	// Save replaces the stored index
+	Save(ctx context.Context, data []byte) error
+}
+
+// Library is the index of articles stored in the bucket, keyed by object name.
+// Updates are serialised within the process with a read-modify-write of the whole index.
+type Library struct {
+	mu    sync.Mutex
+	store Store
+}
+
+// New creates a library backed by the given store
+func New(store Store) *Library {
+	return &Library{store: store}
+}
+
+// load reads the index from the store, returning an empty index if none has been saved yet
+func (l *Library) load(ctx context.Context) (*index, error) {
+	data, err := l.store.Load(ctx)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return &index{Version: indexVersion, Entries: make(map[string]Entry)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load library index: %w", err)
+	}
+	var idx index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("failed to parse library index: %w", err)
+	}
+	if idx.Entries == nil {
+		idx.Entries = make(map[string]Entry)
+	}
+	return &idx, nil
+}
+
+// Record adds or replaces the entry for an object
+func (l *Library) Record(ctx context.Context, entry Entry) error {
+	if entry.ObjectName == "" {
+		return fmt.Errorf("object name cannot be empty")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	idx, err := l.load(ctx)
+	if err != nil {
+		return err
+	}
+	if entry.Status == "" {
+		// A downloaded article replaces the metadata-only entry of any of its versions, keeping its metadata
+		for objectName, recorded := range idx.Entries {
+			if recorded.Status == StatusMetadataOnly && sameArticle(recorded.ArticleID, entry.ArticleID) {
+				if entry.Metadata == nil {
+					entry.Metadata = recorded.Metadata
+				}
+				delete(idx.Entries, objectName)
+			}
+		}
+	}
+	idx.Entries[entry.ObjectName] = entry
+	return l.save(ctx, idx)
+}
+
+// RecordMetadata adds or updates metadata-only entries for articles returned by a query, in a
+// single update of the index, and returns the number of entries added or changed. Articles that are
+// already stored, in any version, are left as they are, and an entry that is recorded again keeps
+// the provenance of the query that first recorded it, so that repeating a query changes nothing.
+func (l *Library) RecordMetadata(ctx context.Context, entries []Entry) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	idx, err := l.load(ctx)
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	for _, entry := range entries {
+		if entry.ObjectName == "" {
+			return 0, fmt.Errorf("object name cannot be empty")
+		}
+		entry.Status = StatusMetadataOnly
+		if stored(idx, entry) {
+			continue
+		}
+		if recorded, ok := idx.Entries[entry.ObjectName]; ok {
+			entry.Provenance = recorded.Provenance
+			if reflect.DeepEqual(recorded, entry) {
+				continue
+			}
+		}
+		idx.Entries[entry.ObjectName] = entry
+		changed++
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+	return changed, l.save(ctx, idx)
+}
+
+// Remove deletes the entries of the given objects, in a single update of the index, and returns
+// the number of entries deleted. Objects without an entry are ignored.
+func (l *Library) Remove(ctx context.Context, objectNames []string) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	idx, err := l.load(ctx)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, objectName := range objectNames {
+		if _, ok := idx.Entries[objectName]; ok {
+			delete(idx.Entries, objectName)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, l.save(ctx, idx)
+}
+
+// stored reports whether the index holds a downloaded object for the article of an entry
+func stored(idx *index, entry Entry) bool {
+	for _, recorded := range idx.Entries {
+		if recorded.Status == "" && (recorded.ObjectName == entry.ObjectName || sameArticle(recorded.ArticleID, entry.ArticleID)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameArticle reports whether two arXiv identifiers name versions of the same article
+func sameArticle(a, b string) bool {
+	idA, errA := arxivid.Parse(a)
+	idB, errB := arxivid.Parse(b)
+	return errA == nil && errB == nil && idA.Base() == idB.Base()
+}
+
+// save writes the index to the store
+func (l *Library) save(ctx context.Context, idx *index) error {
+	idx.Version = indexVersion
+	// Canonical JSON, so that an unchanged index is always saved as the same bytes
+	data, err := canonicaljson.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("failed to marshal library index: %w", err)
+	}
+	if err := l.store.Save(ctx, data); err != nil {
+		return fmt.Errorf("failed to save library index: %w", err)
+	}
+	return nil
+}
+
+// Get returns the entry for an object, or ErrNotFound
+func (l *Library) Get(ctx context.Context, objectName string) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	idx, err := l.load(ctx)
+	if err != nil {
+		return Entry{}, err
+	}
+	entry, ok := idx.Entries[objectName]
+	if !ok {
+		return Entry{}, fmt.Errorf("%w: %s", ErrNotFound, objectName)
+	}
+	return entry, nil
+}
+
+// Entries returns all entries sorted by object name
+func (l *Library) Entries(ctx context.Context) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	idx, err := l.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(idx.Entries))
+	for _, entry := range idx.Entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ObjectName < entries[j].ObjectName
+	})
+	return entries, nil
+}
+
+// s3Store keeps a JSON object, such as the index, in an S3 bucket
+type s3Store struct {
+	config     *storage.S3Config
+	bucket     string
+	objectName string
+}
+
+// NewS3Store creates a store that keeps the index as the IndexObjectName object in the given bucket
+func NewS3Store(config *storage.S3Config, bucket string) Store {
+	return NewS3ObjectStore(config, bucket, IndexObjectName)
+}
+
+// NewS3ObjectStore creates a store that keeps its data as the given JSON object in the given bucket
+func NewS3ObjectStore(config *storage.S3Config, bucket, objectName string) Store {
+	return &s3Store{config: config, bucket: bucket, objectName: objectName}
+}
+
+func (s *s3Store) Load(ctx context.Context) ([]byte, error) {
+	return storage.GetObjectBytes(ctx, s.config, s.bucket, s.objectName)
+}
+
+func (s *s3Store) Save(ctx context.Context, data []byte) error {
+	return storage.PutObjectBytes(ctx, s.config, s.bucket, s.objectName, data, "application/json")
+}
+
+// MemoryStore keeps the index in memory; it is used when no persistent storage is configured and in tests
+type MemoryStore struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (m *MemoryStore) Load(ctx context.Context) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		return nil, storage.ErrObjectNotFound
+	}
+	return append([]byte(nil), m.data...), nil
+}
+
+func (m *MemoryStore) Save(ctx context.Context, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = append([]byte(nil), data...)
+	return nil
+}
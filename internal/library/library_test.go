@@ -0,0 +1,153 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"opus-mcp/internal/canonicaljson"
+)
+
+func TestLibraryRecordAndGet(t *testing.T) {
+	ctx := context.Background()
+	lib := New(&MemoryStore{})
+
+	if _, err := lib.Get(ctx, "arxiv/2405.12345.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() on an empty library error = %v, want ErrNotFound", err)
+	}
+
+	entry := Entry{
+		ObjectName: "arxiv/2405.12345.pdf",
+		Bucket:     "opus-mcp-articles",
+		ArticleID:  "2405.12345",
+		Provenance: &Provenance{Tool: "arxiv_download_pdf", Query: "cs.AI", Timestamp: "2026-01-07T10:00:00Z"},
+	}
+	if err := lib.Record(ctx, entry); err != nil {
+		t.Fatalf("Record() unexpected error: %v", err)
+	}
+	if err := lib.Record(ctx, Entry{ObjectName: "arxiv/2401.00001.pdf", Bucket: "opus-mcp-articles"}); err != nil {
+		t.Fatalf("Record() unexpected error: %v", err)
+	}
+
+	got, err := lib.Get(ctx, "arxiv/2405.12345.pdf")
+	if err != nil {
+		t.Fatalf("Get() unexpected error: %v", err)
+	}
+	if got.Provenance == nil || got.Provenance.Query != "cs.AI" {
+		t.Errorf("Get() provenance = %+v, want query cs.AI", got.Provenance)
+	}
+
+	entries, err := lib.Entries(ctx)
+	if err != nil {
+		t.Fatalf("Entries() unexpected error: %v", err)
+	}
+	if len(entries) != 2 || entries[0].ObjectName != "arxiv/2401.00001.pdf" {
+		t.Errorf("Entries() = %+v, want 2 entries sorted by object name", entries)
+	}
+
+	if err := lib.Record(ctx, Entry{}); err == nil {
+		t.Error("Record() without an object name should fail")
+	}
+}
+
+// TestLibraryIndexIsCanonical checks that the same entries are saved as the same bytes, whatever
+// the order in which they were recorded
+func TestLibraryIndexIsCanonical(t *testing.T) {
+	ctx := context.Background()
+	entries := []Entry{
+		{ObjectName: "arxiv/2405.12345.pdf", Bucket: "opus-mcp-articles", ArticleID: "2405.12345", Size: 1 << 40},
+		{ObjectName: "arxiv/2401.00001.pdf", Bucket: "opus-mcp-articles", SHA256: "<digest>"},
+		{ObjectName: "web/notes.pdf", Bucket: "opus-mcp-articles"},
+	}
+	save := func(order []int) []byte {
+		store := &MemoryStore{}
+		lib := New(store)
+		for _, i := range order {
+			if err := lib.Record(ctx, entries[i]); err != nil {
+				t.Fatalf("Record() unexpected error: %v", err)
+			}
+		}
+		data, err := store.Load(ctx)
+		if err != nil {
+			t.Fatalf("Load() unexpected error: %v", err)
+		}
+		return data
+	}
+	first, second := save([]int{0, 1, 2}), save([]int{2, 0, 1})
+	if !bytes.Equal(first, second) {
+		t.Errorf("indexes of the same entries differ:\n%s\n%s", first, second)
+	}
+	canonical, err := canonicaljson.Canonicalize(first)
+	if err != nil || !bytes.Equal(canonical, first) {
+		t.Errorf("saved index is not canonical JSON:\n%s", first)
+	}
+}
+
+func TestLibraryRecordMetadata(t *testing.T) {
+	ctx := context.Background()
+	lib := New(&MemoryStore{})
+	first := []Entry{
+		{ObjectName: "arxiv/2405.12345.pdf", ArticleID: "2405.12345v1", Provenance: &Provenance{Query: "cs.AI", Timestamp: "2026-01-07T10:00:00Z"}},
+		{ObjectName: "arxiv/2405.54321.pdf", ArticleID: "2405.54321v2", Metadata: &ArticleMetadata{Title: "Old title"}},
+	}
+	if changed, err := lib.RecordMetadata(ctx, first); err != nil || changed != 2 {
+		t.Fatalf("RecordMetadata() = %d, %v, want 2 entries recorded", changed, err)
+	}
+
+	// Recording the same articles again only changes what changed, keeping the first provenance
+	again := []Entry{
+		{ObjectName: "arxiv/2405.12345.pdf", ArticleID: "2405.12345v1", Provenance: &Provenance{Query: "cs.LG", Timestamp: "2026-01-08T10:00:00Z"}},
+		{ObjectName: "arxiv/2405.54321.pdf", ArticleID: "2405.54321v2", Metadata: &ArticleMetadata{Title: "New title"}},
+	}
+	if changed, err := lib.RecordMetadata(ctx, again); err != nil || changed != 1 {
+		t.Fatalf("RecordMetadata() again = %d, %v, want only the changed entry", changed, err)
+	}
+	entry, err := lib.Get(ctx, "arxiv/2405.12345.pdf")
+	if err != nil {
+		t.Fatalf("Get() unexpected error: %v", err)
+	}
+	if entry.Status != StatusMetadataOnly || entry.Provenance.Query != "cs.AI" {
+		t.Errorf("Get() = %+v, want a metadata-only entry with the first query", entry)
+	}
+
+	// Recording a download of another version replaces the metadata-only entry
+	if err := lib.Record(ctx, Entry{ObjectName: "arxiv/2405.54321v3.pdf", ArticleID: "2405.54321v3", SHA256: "<digest>"}); err != nil {
+		t.Fatalf("Record() unexpected error: %v", err)
+	}
+	if _, err := lib.Get(ctx, "arxiv/2405.54321.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of the replaced entry error = %v, want ErrNotFound", err)
+	}
+	stored, err := lib.Get(ctx, "arxiv/2405.54321v3.pdf")
+	if err != nil || stored.Metadata == nil || stored.Metadata.Title != "New title" {
+		t.Errorf("Get() = %+v, %v, want the download with the recorded metadata", stored, err)
+	}
+	if changed, err := lib.RecordMetadata(ctx, again[1:]); err != nil || changed != 0 {
+		t.Errorf("RecordMetadata() of a downloaded article = %d, %v, want nothing recorded", changed, err)
+	}
+}
+
+func TestLibraryRemove(t *testing.T) {
+	ctx := context.Background()
+	lib := New(&MemoryStore{})
+	for _, name := range []string{"arxiv/2405.12345v1.pdf", "arxiv/2405.12345v2.pdf", "exports/old.csv"} {
+		if err := lib.Record(ctx, Entry{ObjectName: name, Bucket: "opus-mcp-articles"}); err != nil {
+			t.Fatalf("Record() unexpected error: %v", err)
+		}
+	}
+
+	removed, err := lib.Remove(ctx, []string{"arxiv/2405.12345v1.pdf", "exports/old.csv", "arxiv/never-indexed.txt"})
+	if err != nil {
+		t.Fatalf("Remove() unexpected error: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Remove() = %d, want the 2 indexed objects", removed)
+	}
+	entries, err := lib.Entries(ctx)
+	if err != nil {
+		t.Fatalf("Entries() unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ObjectName != "arxiv/2405.12345v2.pdf" {
+		t.Errorf("Entries() = %+v, want only the newest version", entries)
+	}
+}
@@ -0,0 +1,215 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every metric exported by the server
+const namespace = "opus_mcp"
+
+// Registry holds all metrics exported by the server. A dedicated registry (rather than the
+// Prometheus default) keeps the exported series limited to what is registered here.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// ToolCallsTotal counts tool calls by tool name and outcome ("ok", "error", "busy", "cancelled")
+	ToolCallsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tool_calls_total",
+		Help:      "Total number of MCP tool calls by tool and outcome.",
+	}, []string{"tool", "outcome"})
+
+	// ToolCallDuration observes how long tool calls take by tool name
+	ToolCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tool_call_duration_seconds",
+		Help:      "Duration of MCP tool calls in seconds.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"tool"})
+
+	// ToolResponseBytes observes the size of the serialized responses of tool calls by tool name
+	ToolResponseBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tool_response_bytes",
+		Help:      "Size in bytes of the serialized responses of MCP tool calls.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 8),
+	}, []string{"tool"})
+
+	// AdmissionRejectedTotal counts tool calls rejected up front because the estimated wait was too long
+	AdmissionRejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "admission_rejected_total",
+		Help:      "Total number of tool calls rejected as BUSY by the admission layer.",
+	}, []string{"tool"})
+
+	// ToolCallsCoalescedTotal counts tool calls that shared the result of an identical concurrent call
+	ToolCallsCoalescedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tool_calls_coalesced_total",
+		Help:      "Total number of tool calls served by sharing the result of an identical in-flight call.",
+	}, []string{"tool"})
+
+	// S3RetriesTotal counts retries of S3 operations after transient errors by operation and S3 error code
+	S3RetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "s3_retries_total",
+		Help:      "Total number of S3 operation retries after transient errors, by operation and S3 error code.",
+	}, []string{"operation", "code"})
+
+	// HTTPRetriesTotal counts retries of outbound HTTP requests after transient failures by host and
+	// reason, the status code or "error" for a request that got no response
+	HTTPRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_retries_total",
+		Help:      "Total number of outbound HTTP request retries after transient failures, by host and reason.",
+	}, []string{"host", "reason"})
+
+	// S3OperationDuration observes how long S3 operations take, including retries, by operation and outcome ("ok", "error")
+	S3OperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "s3_operation_duration_seconds",
+		Help:      "Duration of S3 operations in seconds, including retries, by operation and outcome.",
+		Buckets:   []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"operation", "outcome"})
+
+	// S3ActiveEndpoint is 1 for the S3 endpoint operations are performed against and 0 for the others
+	S3ActiveEndpoint = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "s3_active_endpoint",
+		Help:      "Whether an S3 endpoint is the one operations are performed against (1) or not (0).",
+	}, []string{"endpoint"})
+
+	// S3FailoversTotal counts the switches of the active S3 endpoint, from a demoted endpoint to the
+	// next healthy one or back to a recovered one
+	S3FailoversTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "s3_failovers_total",
+		Help:      "Total number of switches of the active S3 endpoint, by the endpoint switched from and to.",
+	}, []string{"from", "to"})
+
+	// DownloadJobsTotal counts finished background download jobs by outcome ("succeeded", "failed")
+	DownloadJobsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "download_jobs_total",
+		Help:      "Total number of finished background download jobs by outcome.",
+	}, []string{"outcome"})
+
+	// DownloadJobDuration observes how long background download jobs run, from start to finish, by outcome
+	DownloadJobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "download_job_duration_seconds",
+		Help:      "Duration of background download jobs in seconds, from start to finish, by outcome.",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"outcome"})
+
+	// DownloadPhaseDuration observes the phases of downloads to S3 by phase ("origin_ttfb",
+	// "origin_transfer", "s3_upload"), telling a slow origin from slow storage
+	DownloadPhaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "download_phase_duration_seconds",
+		Help:      "Duration of the phases of downloads to S3 in seconds: origin time to first byte, origin transfer and S3 upload.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"phase"})
+
+	// DownloadPhaseThroughput observes the transfer rates of downloads to S3 by phase ("origin_transfer", "s3_upload")
+	DownloadPhaseThroughput = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "download_phase_throughput_bytes_per_second",
+		Help:      "Transfer rate of the phases of downloads to S3 in bytes per second: origin transfer and S3 upload.",
+		Buckets:   prometheus.ExponentialBuckets(16*1024, 4, 8),
+	}, []string{"phase"})
+
+	// ArxivRequestsTotal counts the requests made to arXiv by kind ("api", "pdf", "abs"), as counted by the daily quota
+	ArxivRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "arxiv_requests_total",
+		Help:      "Total number of requests made to arXiv by kind (api, pdf, abs).",
+	}, []string{"kind"})
+
+	// UploadsCoalescedTotal counts downloads to S3 that shared the transfer of the same object
+	// already in progress instead of downloading it again
+	UploadsCoalescedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploads_coalesced_total",
+		Help:      "Total number of downloads to S3 served by sharing the in-flight transfer of the same object from the same URL.",
+	})
+
+	// TaxonomyParseDuration observes how long parsing the taxonomy page into a document and reading
+	// the categories off it takes
+	TaxonomyParseDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "taxonomy_parse_duration_seconds",
+		Help:      "Duration of parsing the arXiv category taxonomy page in seconds.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	})
+
+	// TaxonomyParseAllocatedBytes observes the bytes allocated while parsing the taxonomy page, as
+	// sampled from the runtime's memory statistics
+	TaxonomyParseAllocatedBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "taxonomy_parse_allocated_bytes",
+		Help:      "Bytes allocated by the whole process while parsing the arXiv category taxonomy page.",
+		Buckets:   prometheus.ExponentialBuckets(512*1024, 2, 8),
+	})
+
+	// TaxonomyParseNodes is the number of elements in the last taxonomy page parsed
+	TaxonomyParseNodes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "taxonomy_parse_nodes",
+		Help:      "Number of HTML elements in the last parsed arXiv category taxonomy page.",
+	})
+
+	// DownloadJobBytesTotal counts the bytes stored by background download jobs by outcome
+	DownloadJobBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "download_job_bytes_total",
+		Help:      "Total number of bytes stored by background download jobs by outcome.",
+	}, []string{"outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ToolCallsTotal,
+		ToolCallDuration,
+		ToolResponseBytes,
+		AdmissionRejectedTotal,
+		ToolCallsCoalescedTotal,
+		S3RetriesTotal,
+		HTTPRetriesTotal,
+		S3OperationDuration,
+		S3ActiveEndpoint,
+		S3FailoversTotal,
+		DownloadJobsTotal,
+		DownloadJobDuration,
+		DownloadJobBytesTotal,
+		DownloadPhaseDuration,
+		DownloadPhaseThroughput,
+		ArxivRequestsTotal,
+		UploadsCoalescedTotal,
+		TaxonomyParseDuration,
+		TaxonomyParseAllocatedBytes,
+		TaxonomyParseNodes,
+	)
+}
+
+// NewGaugeFunc registers a gauge whose value is computed by f at scrape time.
+func NewGaugeFunc(name, help string, f func() float64) prometheus.GaugeFunc {
+	g := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, f)
+	Registry.MustRegister(g)
+	return g
+}
+
+// Handler returns an HTTP handler that serves the registered metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"opus-mcp/internal/settings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Classes of operations checked for slowness
+const (
+	// SlowArxivQuery is a query of the arXiv API, from sending the request to reading the feed
+	SlowArxivQuery = "arxiv_query"
+	// SlowTaxonomyFetch is a fetch and parse of the arXiv category taxonomy page
+	SlowTaxonomyFetch = "taxonomy_fetch"
+	// SlowS3Upload is an upload of downloaded content to S3, including retries
+	SlowS3Upload = "s3_upload"
+)
+
+// SlowOperationConfig holds the thresholds above which operations are reported as slow, loaded from
+// environment variables. A threshold of zero disables its check; throughputs are sizes per second,
+// e.g., 64KiB.
+type SlowOperationConfig struct {
+	ArxivQueryMaxDuration          settings.Duration `env:"OPUS_MCP_SLOW_ARXIV_QUERY_MAX_DURATION,default=10s"`
+	ArxivQueryMinBytesPerSecond    settings.Size     `env:"OPUS_MCP_SLOW_ARXIV_QUERY_MIN_BYTES_PER_SECOND,default=0"`
+	TaxonomyFetchMaxDuration       settings.Duration `env:"OPUS_MCP_SLOW_TAXONOMY_FETCH_MAX_DURATION,default=10s"`
+	TaxonomyFetchMinBytesPerSecond settings.Size     `env:"OPUS_MCP_SLOW_TAXONOMY_FETCH_MIN_BYTES_PER_SECOND,default=0"`
+	S3UploadMaxDuration            settings.Duration `env:"OPUS_MCP_SLOW_S3_UPLOAD_MAX_DURATION,default=60s"`
+	S3UploadMinBytesPerSecond      settings.Size     `env:"OPUS_MCP_SLOW_S3_UPLOAD_MIN_BYTES_PER_SECOND,default=0"`
+}
+
+// LoadSlowOperationConfig loads the slow operation thresholds from environment variables
+func LoadSlowOperationConfig() (*SlowOperationConfig, error) {
+	var config SlowOperationConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process slow operation configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// slowThreshold is the duration and throughput an operation class is expected to stay within
+type slowThreshold struct {
+	maxDuration       time.Duration
+	minBytesPerSecond int64
+}
+
+var (
+	// SlowOperationsTotal counts operations that breached a duration or throughput threshold by class
+	SlowOperationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "slow_operations_total",
+		Help:      "Total number of operations slower than their configured duration or throughput threshold, by class.",
+	}, []string{"class"})
+
+	slowMu         sync.RWMutex
+	slowThresholds = thresholdsOf(&SlowOperationConfig{
+		ArxivQueryMaxDuration:    settings.Duration(10 * time.Second),
+		TaxonomyFetchMaxDuration: settings.Duration(10 * time.Second),
+		S3UploadMaxDuration:      settings.Duration(60 * time.Second),
+	})
+
+	// slowClock tells the time operations start and end at
+	slowClock = time.Now
+)
+
+func init() {
+	Registry.MustRegister(SlowOperationsTotal)
+}
+
+func thresholdsOf(config *SlowOperationConfig) map[string]slowThreshold {
+	return map[string]slowThreshold{
+		SlowArxivQuery:    {config.ArxivQueryMaxDuration.Duration(), int64(config.ArxivQueryMinBytesPerSecond)},
+		SlowTaxonomyFetch: {config.TaxonomyFetchMaxDuration.Duration(), int64(config.TaxonomyFetchMinBytesPerSecond)},
+		SlowS3Upload:      {config.S3UploadMaxDuration.Duration(), int64(config.S3UploadMinBytesPerSecond)},
+	}
+}
+
+// ConfigureSlowOperations replaces the slow operation thresholds
+func ConfigureSlowOperations(config *SlowOperationConfig) {
+	slowMu.Lock()
+	defer slowMu.Unlock()
+	slowThresholds = thresholdsOf(config)
+}
+
+// OperationTimer times one operation of a class, to check it against the thresholds of the class
+type OperationTimer struct {
+	class string
+	start time.Time
+}
+
+// StartOperation starts timing an operation of the given class
+func StartOperation(class string) *OperationTimer {
+	return &OperationTimer{class: class, start: slowClock()}
+}
+
+// Done checks the finished operation against the thresholds of its class. An operation that breached
+// one is logged as a warning with the given attributes and counted in SlowOperationsTotal. Pass a
+// negative size when the number of bytes transferred is unknown, which skips the throughput check.
+// Done reports whether the operation was slow.
+func (t *OperationTimer) Done(bytes int64, attrs ...any) bool {
+	duration := slowClock().Sub(t.start)
+	slowMu.RLock()
+	threshold := slowThresholds[t.class]
+	slowMu.RUnlock()
+
+	var reasons []string
+	if threshold.maxDuration > 0 && duration > threshold.maxDuration {
+		reasons = append(reasons, "duration")
+	}
+	// Throughput is only meaningful once some time has passed
+	var bytesPerSecond float64
+	if bytes >= 0 && duration > 0 {
+		bytesPerSecond = float64(bytes) / duration.Seconds()
+		if threshold.minBytesPerSecond > 0 && bytesPerSecond < float64(threshold.minBytesPerSecond) {
+			reasons = append(reasons, "throughput")
+		}
+	}
+	if len(reasons) == 0 {
+		return false
+	}
+
+	SlowOperationsTotal.WithLabelValues(t.class).Inc()
+	logAttrs := []any{
+		"class", t.class,
+		"breached", reasons,
+		"duration", duration,
+		"max_duration", threshold.maxDuration,
+	}
+	if bytes >= 0 {
+		logAttrs = append(logAttrs, "bytes", bytes, "bytes_per_second", int64(bytesPerSecond), "min_bytes_per_second", threshold.minBytesPerSecond)
+	}
+	slog.Warn("Slow operation", append(logAttrs, attrs...)...)
+	return true
+}
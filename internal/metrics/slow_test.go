@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"opus-mcp/internal/settings"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// withFakeClock makes the slow operation checks read the time from the returned pointer
+func withFakeClock(t *testing.T) *time.Time {
+	t.Helper()
+	now := time.Date(2026, 1, 7, 10, 0, 0, 0, time.UTC)
+	original := slowClock
+	t.Cleanup(func() { slowClock = original })
+	slowClock = func() time.Time { return now }
+	return &now
+}
+
+func withSlowThresholds(t *testing.T, config *SlowOperationConfig) {
+	t.Helper()
+	slowMu.RLock()
+	original := slowThresholds
+	slowMu.RUnlock()
+	t.Cleanup(func() {
+		slowMu.Lock()
+		slowThresholds = original
+		slowMu.Unlock()
+	})
+	ConfigureSlowOperations(config)
+}
+
+func TestOperationTimer(t *testing.T) {
+	now := withFakeClock(t)
+	withSlowThresholds(t, &SlowOperationConfig{
+		ArxivQueryMaxDuration:     settings.Duration(10 * time.Second),
+		S3UploadMinBytesPerSecond: 1 << 20,
+	})
+
+	tests := []struct {
+		name     string
+		class    string
+		duration time.Duration
+		bytes    int64
+		wantSlow bool
+	}{
+		{"query within its duration", SlowArxivQuery, 9 * time.Second, 1000, false},
+		{"query over its duration", SlowArxivQuery, 11 * time.Second, 1000, true},
+		{"upload above its throughput", SlowS3Upload, 2 * time.Second, 4 << 20, false},
+		{"upload below its throughput", SlowS3Upload, 8 * time.Second, 4 << 20, true},
+		{"upload of unknown size", SlowS3Upload, 8 * time.Second, -1, false},
+		// Thresholds of zero disable the checks
+		{"taxonomy fetch without thresholds", SlowTaxonomyFetch, time.Hour, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := testutil.ToFloat64(SlowOperationsTotal.WithLabelValues(tt.class))
+			timer := StartOperation(tt.class)
+			*now = now.Add(tt.duration)
+			if got := timer.Done(tt.bytes, "test", tt.name); got != tt.wantSlow {
+				t.Errorf("Done() = %v, want %v", got, tt.wantSlow)
+			}
+			counted := testutil.ToFloat64(SlowOperationsTotal.WithLabelValues(tt.class)) - before
+			if want := map[bool]float64{false: 0, true: 1}[tt.wantSlow]; counted != want {
+				t.Errorf("slow operations counted = %v, want %v", counted, want)
+			}
+		})
+	}
+}
+
+func TestLoadSlowOperationConfig(t *testing.T) {
+	t.Setenv("OPUS_MCP_SLOW_ARXIV_QUERY_MAX_DURATION", "0")
+	t.Setenv("OPUS_MCP_SLOW_S3_UPLOAD_MIN_BYTES_PER_SECOND", "64KiB")
+	config, err := LoadSlowOperationConfig()
+	if err != nil {
+		t.Fatalf("LoadSlowOperationConfig() unexpected error: %v", err)
+	}
+	if config.ArxivQueryMaxDuration != 0 || config.TaxonomyFetchMaxDuration.Duration() != 10*time.Second {
+		t.Errorf("duration thresholds = %v and %v, want 0 and the 10s default", config.ArxivQueryMaxDuration, config.TaxonomyFetchMaxDuration)
+	}
+	if config.S3UploadMinBytesPerSecond != 65536 || config.S3UploadMaxDuration.Duration() != time.Minute {
+		t.Errorf("S3 upload thresholds = %d bytes/s and %v", config.S3UploadMinBytesPerSecond, config.S3UploadMaxDuration)
+	}
+}
@@ -0,0 +1,423 @@
+package parser
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"opus-mcp/internal/taxonomy"
+)
+
+// TermKind is how a token of a mixed expression was classified
+type TermKind string
+
+const (
+	// TermCategory is an arXiv category code, searched with cat:
+	TermCategory TermKind = "category"
+	// TermKeyword is a bare word, searched in the keyword field
+	TermKeyword TermKind = "keyword"
+	// TermPhrase is a quoted phrase, searched as an exact phrase in the keyword field
+	TermPhrase TermKind = "phrase"
+	// TermField is a word or phrase with an explicit arXiv field prefix, e.g., au:smith
+	TermField TermKind = "field"
+)
+
+// DefaultKeywordField is the arXiv search field used for keywords and phrases when none is given
+const DefaultKeywordField = "all"
+
+// keywordFields are the arXiv search fields that keywords and phrases can be searched in
+var keywordFields = []string{"all", "abs", "ti"}
+
+// fieldPrefixes are the arXiv search field prefixes that are passed through unchanged.
+// See: https://info.arxiv.org/help/api/user-manual.html#query_details
+var fieldPrefixes = []string{"ti", "au", "abs", "co", "jr", "cat", "rn", "id", "all"}
+
+// categoryCodePattern matches tokens shaped like a category code of an archive the taxonomy does
+// not know, e.g., newarch.AB
+var categoryCodePattern = regexp.MustCompile(`^[a-z][a-z-]*\.[A-Z]{2,}$`)
+
+// currentTaxonomy returns the taxonomy that tokens are recognized as category codes with; replaced
+// in tests
+var currentTaxonomy = taxonomy.Embedded
+
+// Term is a single token of a mixed expression and the query clause it was turned into
+type Term struct {
+	Token  string   `json:"token" jsonschema:"The token as written in the expression"`
+	Kind   TermKind `json:"kind" jsonschema:"How the token was classified: category, keyword, phrase or field"`
+	Clause string   `json:"clause" jsonschema:"The arXiv search query clause the token was turned into"`
+	Note   string   `json:"note,omitempty" jsonschema:"Why an ambiguous token was classified the way it was"`
+	// Related is only set when the expression was parsed with related categories
+	Related []string `json:"related,omitempty" jsonschema:"The adjacent categories searched together with this category, when related categories were added"`
+}
+
+// Interpretation is the arXiv search query built from a mixed expression and how each of its
+// tokens was classified
+type Interpretation struct {
+	Query string `json:"query" jsonschema:"The arXiv search query the expression was turned into"`
+	Terms []Term `json:"terms" jsonschema:"How each token of the expression was classified, in order"`
+	// Taxonomy is only set when the taxonomy decided how a token was read
+	Taxonomy *taxonomy.Provenance `json:"taxonomy,omitempty" jsonschema:"Where the arXiv taxonomy that recognized category codes came from and how current it is, present when it decided how a token was read. Unless live, a category added to arXiv since may be searched as a keyword"`
+	// JoinStrategy is only set when the expression was a plain list of category codes
+	JoinStrategy string `json:"joinStrategy,omitempty" jsonschema:"AND or OR, when the expression was a plain list of category codes joined with categoryJoinStrategy; absent when the expression's own operators and implicit AND decided the joining"`
+	// Notes are set by callers that ignore or adjust an input while building the query
+	Notes []string `json:"notes,omitempty" jsonschema:"Inputs that were ignored or adjusted in building the query, and why"`
+}
+
+// ParseMixedExpression parses an expression that interleaves arXiv category codes with free-text
+// terms, e.g., `cs.CL AND "large language models" evaluation`. Tokens that are arXiv category
+// codes are searched with cat:, quoted phrases and other words are searched in keywordField (all,
+// abs or ti; defaults to all), and tokens with an explicit field prefix such as au: are passed
+// through. Operators and implicit AND work as in ParseReconstructGeneralExpression.
+func ParseMixedExpression(input, keywordField string) (*Interpretation, error) {
+	return parseMixed(input, keywordField, false)
+}
+
+// ParseMixedExpressionRelated parses an expression like ParseMixedExpression, but searches every
+// category code together with the categories the taxonomy's curated adjacency table lists next to
+// it, e.g., cs.CL as (cat:cs.CL OR cat:cs.AI OR cat:cs.LG). The added categories are listed in
+// the Related field of the category's term.
+func ParseMixedExpressionRelated(input, keywordField string) (*Interpretation, error) {
+	return parseMixed(input, keywordField, true)
+}
+
+func parseMixed(input, keywordField string, related bool) (*Interpretation, error) {
+	if keywordField == "" {
+		keywordField = DefaultKeywordField
+	}
+	if !isKeywordField(keywordField) {
+		return nil, fmt.Errorf("invalid keyword field %q, valid values are %s", keywordField, strings.Join(keywordFields, ", "))
+	}
+
+	tokens, err := lexMixed(input)
+	if err != nil {
+		return nil, err
+	}
+	var terms []Term
+	var consulted bool
+	s := currentTaxonomy()
+	p := &parser{tokens: tokens}
+	expr, err := p.parseExpression(func(tok token) string {
+		term, decided := classifyToken(tok, keywordField, s)
+		consulted = consulted || decided
+		if related && term.Kind == TermCategory {
+			addRelated(&term, s)
+		}
+		terms = append(terms, term)
+		return term.Clause
+	})
+	if err != nil {
+		return nil, err
+	}
+	interpretation := &Interpretation{Query: "(" + expr + ")", Terms: terms}
+	if consulted {
+		provenance := s.Provenance()
+		interpretation.Taxonomy = &provenance
+	}
+	return interpretation, nil
+}
+
+// searchFields are the arXiv search fields that every term of a field expression can be searched in
+var searchFields = []string{"ti", "abs", "au", "co", "jr", "all"}
+
+// ParseFieldExpression parses a boolean expression of words and quoted phrases, e.g.,
+// `transformer AND "self attention" -survey`, searching every term in the arXiv search field
+// field (ti, abs, au, co, jr or all). Unlike ParseMixedExpression, tokens are never read as
+// category codes; tokens with an explicit field prefix such as au: are still passed through.
+// Operators and implicit AND work as in ParseReconstructGeneralExpression.
+func ParseFieldExpression(input, field string) (*Interpretation, error) {
+	if !slices.Contains(searchFields, field) {
+		return nil, fmt.Errorf("invalid search field %q, valid values are %s", field, strings.Join(searchFields, ", "))
+	}
+	tokens, err := lexMixed(input)
+	if err != nil {
+		return nil, err
+	}
+	var terms []Term
+	p := &parser{tokens: tokens}
+	expr, err := p.parseExpression(func(tok token) string {
+		term := Term{Token: tok.Value, Kind: TermKeyword}
+		switch prefix, value, hasField := splitFieldPrefix(tok.Value); {
+		case hasField:
+			term.Kind = TermField
+			term.Clause = prefix + ":" + renderValue(value)
+		case tok.Type == tokenPhrase:
+			term.Kind = TermPhrase
+			term.Clause = field + ":" + renderValue(tok.Value)
+		default:
+			term.Clause = field + ":" + renderValue(tok.Value)
+		}
+		terms = append(terms, term)
+		return term.Clause
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Interpretation{Query: "(" + expr + ")", Terms: terms}, nil
+}
+
+// ExcludedExpression reports whether an expression only excludes, i.e., whether every term at its
+// top level is negated, as in `-survey NOT review` or `-(survey OR review)`, and if so returns the
+// expression matching what it excludes: its negated terms joined with OR. arXiv cannot search for
+// an expression that only excludes; it can only subtract one from another search with ANDNOT.
+func ExcludedExpression(input string) (string, bool, error) {
+	tokens, err := lexMixed(input)
+	if err != nil {
+		return "", false, err
+	}
+	var excluded []string
+	for i := 0; tokens[i].Type != tokenEOF; {
+		switch tokens[i].Type {
+		case tokenAnd:
+			// Negations may be joined with an explicit AND
+			i++
+			continue
+		case tokenNot:
+			i++
+		default:
+			return input, false, nil
+		}
+		switch tokens[i].Type {
+		case tokenIdent, tokenPhrase:
+			excluded = append(excluded, tokens[i].Value)
+			i++
+		case tokenLParen:
+			start, depth := i, 0
+			for ; tokens[i].Type != tokenEOF; i++ {
+				if tokens[i].Type == tokenLParen {
+					depth++
+				} else if tokens[i].Type == tokenRParen {
+					if depth--; depth == 0 {
+						i++
+						break
+					}
+				}
+			}
+			values := make([]string, 0, i-start)
+			for _, tok := range tokens[start:i] {
+				values = append(values, tok.Value)
+			}
+			excluded = append(excluded, strings.Join(values, " "))
+		default:
+			return input, false, nil
+		}
+	}
+	if len(excluded) == 0 {
+		return input, false, nil
+	}
+	return strings.Join(excluded, " OR "), true, nil
+}
+
+// Strategies for joining a plain list of category codes
+const (
+	JoinAnd = "AND"
+	JoinOr  = "OR"
+)
+
+// JoinCategoryList turns a plain list of category codes, separated by commas or whitespace, e.g.,
+// "cs.AI, cs.CL", into an expression joining them with strategy (AND or OR; defaults to AND). It
+// reports whether the input was such a list. Any other input, i.e., one with operators,
+// parentheses, phrases, field prefixes or words that are not category codes, is returned unchanged,
+// so that the expression's own operators and implicit AND always decide how it is joined.
+func JoinCategoryList(input, strategy string) (string, bool, error) {
+	if strategy == "" {
+		strategy = JoinAnd
+	}
+	if strategy != JoinAnd && strategy != JoinOr {
+		return "", false, fmt.Errorf("invalid category join strategy %q, valid values are %s and %s", strategy, JoinAnd, JoinOr)
+	}
+	if strings.ContainsAny(input, `()+|"`) {
+		return input, false, nil
+	}
+	codes := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	if len(codes) < 2 {
+		return input, false, nil
+	}
+	s := currentTaxonomy()
+	for _, code := range codes {
+		tok := operatorOrIdent(code)
+		if tok.Type != tokenIdent || strings.HasPrefix(code, "-") {
+			return input, false, nil
+		}
+		if term, _ := classifyToken(tok, DefaultKeywordField, s); term.Kind != TermCategory {
+			return input, false, nil
+		}
+	}
+	return strings.Join(codes, " "+strategy+" "), true, nil
+}
+
+// addRelated ORs the categories adjacent to a category term into its clause
+func addRelated(term *Term, s *taxonomy.Snapshot) {
+	adjacent := s.Adjacent(strings.TrimPrefix(term.Clause, "cat:"))
+	if len(adjacent) == 0 {
+		return
+	}
+	clauses := []string{term.Clause}
+	for _, a := range adjacent {
+		term.Related = append(term.Related, a.Code)
+		clauses = append(clauses, "cat:"+a.Code)
+	}
+	term.Clause = "(" + strings.Join(clauses, "+OR+") + ")"
+}
+
+func isKeywordField(field string) bool {
+	for _, f := range keywordFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// lexMixed splits a mixed expression into tokens. Unlike lex, a '-' only means NOT when it stands
+// alone or starts a word, so that hyphenated category codes (hep-th) and words (state-of-the-art)
+// stay intact, and text in double quotes is a single phrase token. The value of a phrase token is
+// the text as written, including the quotes and any field prefix (ti:"...").
+func lexMixed(input string) ([]token, error) {
+	var tokens []token
+	var word strings.Builder
+	flush := func() {
+		if word.Len() == 0 {
+			return
+		}
+		tokens = append(tokens, operatorOrIdent(word.String()))
+		word.Reset()
+	}
+
+	runes := []rune(input)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated quoted phrase starting at %q", string(runes[i:]))
+			}
+			if strings.TrimSpace(string(runes[i+1:end])) == "" {
+				return nil, fmt.Errorf("empty quoted phrase")
+			}
+			// A field prefix written directly before the quote belongs to the phrase
+			prefix := word.String()
+			word.Reset()
+			if prefix != "" && !strings.HasSuffix(prefix, ":") {
+				tokens = append(tokens, operatorOrIdent(prefix))
+				prefix = ""
+			}
+			tokens = append(tokens, token{tokenPhrase, prefix + string(runes[i:end+1])})
+			i = end
+		case r == '(' || r == ')' || r == '+' || r == '|':
+			flush()
+			tokens = append(tokens, operatorOrIdent(string(r)))
+		case r == '-' && word.Len() == 0:
+			tokens = append(tokens, token{tokenNot, "NOT"})
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			flush()
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return append(tokens, token{tokenEOF, ""}), nil
+}
+
+// operatorOrIdent turns a word into an operator token, if it is one, or an identifier
+func operatorOrIdent(word string) token {
+	switch strings.ToUpper(word) {
+	case "AND", "+":
+		return token{tokenAnd, "AND"}
+	case "OR", "|":
+		return token{tokenOr, "OR"}
+	case "NOT":
+		return token{tokenNot, "NOT"}
+	case "(":
+		return token{tokenLParen, "("}
+	case ")":
+		return token{tokenRParen, ")"}
+	}
+	return token{tokenIdent, word}
+}
+
+// classifyToken decides whether an identifier or phrase is a category, a keyword, a phrase or
+// a field-prefixed term, and renders its query clause. It also reports whether the taxonomy decided
+// how the token was read, i.e., whether a taxonomy from another day could have read it differently.
+func classifyToken(tok token, keywordField string, s *taxonomy.Snapshot) (Term, bool) {
+	term := Term{Token: tok.Value}
+
+	field, value, hasField := splitFieldPrefix(tok.Value)
+	if hasField {
+		term.Kind = TermField
+		term.Clause = field + ":" + renderValue(value)
+		return term, false
+	}
+	if tok.Type == tokenPhrase {
+		term.Kind = TermPhrase
+		term.Clause = keywordField + ":" + renderValue(tok.Value)
+		return term, false
+	}
+
+	provenance := s.Provenance()
+	if c, ok := s.Category(tok.Value); ok {
+		term.Kind = TermCategory
+		term.Clause = "cat:" + c.Code
+		if c.Code != tok.Value {
+			term.Note = fmt.Sprintf("normalized to the category code %s", c.Code)
+		}
+		return term, true
+	}
+	if group, _, found := strings.Cut(tok.Value, "."); found {
+		if _, ok := s.Group(strings.ToLower(group)); ok {
+			term.Kind = TermCategory
+			term.Clause = "cat:" + tok.Value
+			term.Note = fmt.Sprintf("not in the taxonomy snapshot, but searched as a category because %q is an arXiv group", strings.ToLower(group))
+			if !provenance.Live() {
+				term.Note += fmt.Sprintf("; accepted without validation, as the taxonomy data is %s", provenance)
+			}
+			return term, true
+		}
+	}
+
+	term.Kind = TermKeyword
+	term.Clause = keywordField + ":" + url.QueryEscape(tok.Value)
+	if g, ok := s.Group(strings.ToLower(tok.Value)); ok {
+		term.Note = fmt.Sprintf("matches the arXiv group %q (%s), which is not a category, so it is searched as a keyword; use a category code such as %s.XX to filter by category", g.Code, g.Name, g.Code)
+		return term, true
+	}
+	if !provenance.Live() && categoryCodePattern.MatchString(tok.Value) {
+		term.Note = fmt.Sprintf("looks like a category code but is not in the taxonomy, which is %s and may predate it, so it is searched as a keyword; write cat:%s to search it as a category", provenance, tok.Value)
+		return term, true
+	}
+	return term, false
+}
+
+// splitFieldPrefix splits an explicit arXiv field prefix, e.g., au:smith, from its value
+func splitFieldPrefix(value string) (field, rest string, ok bool) {
+	field, rest, found := strings.Cut(value, ":")
+	if !found || rest == "" {
+		return "", "", false
+	}
+	field = strings.ToLower(field)
+	for _, prefix := range fieldPrefixes {
+		if prefix == field {
+			return field, rest, true
+		}
+	}
+	return "", "", false
+}
+
+// renderValue query-escapes a word, or a quoted phrase with its words joined by '+'
+func renderValue(value string) string {
+	if !strings.HasPrefix(value, `"`) {
+		return url.QueryEscape(value)
+	}
+	words := strings.Fields(strings.Trim(value, `"`))
+	for i, w := range words {
+		words[i] = url.QueryEscape(w)
+	}
+	return "%22" + strings.Join(words, "+") + "%22"
+}
@@ -0,0 +1,329 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"opus-mcp/internal/taxonomy"
+)
+
+func TestParseMixedExpression(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		keywordField string
+		want         string
+		wantError    bool
+	}{
+		// --- Categories only, as with ParseReconstructCategoryExpression ---
+		{"Single category", "cs.CL", "", "(cat:cs.CL)", false},
+		{"Category case is canonicalized", "CS.cl OR hep-th", "", "(cat:cs.CL+OR+cat:hep-th)", false},
+		{"Category NOT category", "cs.AI - cs.LG", "", "(cat:cs.AI+NOT+cat:cs.LG)", false},
+
+		// --- Mixed categories and keywords ---
+		{"Category AND keywords", "cs.CL AND llm evaluation", "", "(cat:cs.CL+AND+all:llm+AND+all:evaluation)", false},
+		{"Quoted phrase", `cs.CL "large language models"`, "", "(cat:cs.CL+AND+all:%22large+language+models%22)", false},
+		{"Keyword field abs", `cs.CL llm "in-context learning"`, "abs", "(cat:cs.CL+AND+abs:llm+AND+abs:%22in-context+learning%22)", false},
+		{"Keyword field ti", "cs.IR retrieval", "ti", "(cat:cs.IR+AND+ti:retrieval)", false},
+		{"Grouping", "(cs.CL | cs.AI) -survey", "", "((cat:cs.CL+OR+cat:cs.AI)+NOT+all:survey)", false},
+		{"Hyphenated word stays intact", "state-of-the-art cs.CV", "", "(all:state-of-the-art+AND+cat:cs.CV)", false},
+		{"Explicit field prefix", `au:smith ti:"neural networks" cs.LG`, "", "(au:smith+AND+ti:%22neural+networks%22+AND+cat:cs.LG)", false},
+		{"Keywords are escaped", "cs.CL c&a", "", "(cat:cs.CL+AND+all:c%26a)", false},
+		{"Unknown category of a known group", "cs.ZZ", "", "(cat:cs.ZZ)", false},
+
+		// --- Ambiguous tokens ---
+		{"Group code is a keyword", "math cs.LO", "", "(all:math+AND+cat:cs.LO)", false},
+		{"Group code that is also a category", "quant-ph entanglement", "", "(cat:quant-ph+AND+all:entanglement)", false},
+
+		// --- Errors ---
+		{"Empty string", "", "", "", true},
+		{"Unterminated phrase", `cs.CL "large language`, "", "", true},
+		{"Empty phrase", `cs.CL ""`, "", "", true},
+		{"Invalid keyword field", "cs.CL llm", "au", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMixedExpression(tt.input, tt.keywordField)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("\nInput: %q\nExpected error but got %q", tt.input, got.Query)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("\nInput: %q\nUnexpected error: %v", tt.input, err)
+				return
+			}
+			if got.Query != tt.want {
+				t.Errorf("\nInput: %q\nGot:   %q\nWant:  %q", tt.input, got.Query, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMixedExpressionInterpretation(t *testing.T) {
+	got, err := ParseMixedExpression(`cs.CL AND "large language models" stat au:smith`, "")
+	if err != nil {
+		t.Fatalf("ParseMixedExpression() unexpected error: %v", err)
+	}
+
+	want := []Term{
+		{Token: "cs.CL", Kind: TermCategory, Clause: "cat:cs.CL"},
+		{Token: `"large language models"`, Kind: TermPhrase, Clause: "all:%22large+language+models%22"},
+		{Token: "stat", Kind: TermKeyword, Clause: "all:stat"},
+		{Token: "au:smith", Kind: TermField, Clause: "au:smith"},
+	}
+	if len(got.Terms) != len(want) {
+		t.Fatalf("got %d terms, want %d: %+v", len(got.Terms), len(want), got.Terms)
+	}
+	for i, w := range want {
+		g := got.Terms[i]
+		if g.Token != w.Token || g.Kind != w.Kind || g.Clause != w.Clause {
+			t.Errorf("term %d = %+v, want %+v", i, g, w)
+		}
+	}
+
+	// Only the ambiguous group code is explained
+	for i, term := range got.Terms {
+		if (term.Note != "") != (i == 2) {
+			t.Errorf("term %d note = %q", i, term.Note)
+		}
+	}
+	if !strings.Contains(got.Terms[2].Note, `arXiv group "stat"`) {
+		t.Errorf("group code note = %q, want it to name the group", got.Terms[2].Note)
+	}
+
+	unknown, err := ParseMixedExpression("cs.ZZ", "")
+	if err != nil {
+		t.Fatalf("ParseMixedExpression() unexpected error: %v", err)
+	}
+	if unknown.Terms[0].Kind != TermCategory || !strings.Contains(unknown.Terms[0].Note, "not in the taxonomy snapshot") {
+		t.Errorf("unknown category term = %+v, want a category with a note", unknown.Terms[0])
+	}
+}
+
+func TestParseMixedExpressionTaxonomyProvenance(t *testing.T) {
+	sources := []taxonomy.Provenance{
+		{Source: taxonomy.SourceLive, SnapshotDate: "2026-02-03"},
+		{Source: taxonomy.SourceCached, SnapshotDate: "2026-01-20"},
+		{Source: taxonomy.SourceEmbedded, SnapshotDate: taxonomy.Embedded().SnapshotDate},
+	}
+	for _, provenance := range sources {
+		t.Run(provenance.Source, func(t *testing.T) {
+			original := currentTaxonomy
+			t.Cleanup(func() { currentTaxonomy = original })
+			currentTaxonomy = func() *taxonomy.Snapshot { return taxonomy.Embedded().WithProvenance(provenance) }
+
+			got, err := ParseMixedExpression("econ.NEW OR newarch.AB OR CS.ai", "")
+			if err != nil {
+				t.Fatalf("ParseMixedExpression() unexpected error: %v", err)
+			}
+			if got.Taxonomy == nil || *got.Taxonomy != provenance {
+				t.Errorf("taxonomy = %v, want %+v", got.Taxonomy, provenance)
+			}
+
+			// An unknown category of a known group is searched as a category either way, but only
+			// accepted without validation when the taxonomy may be out of date
+			unvalidated := strings.Contains(got.Terms[0].Note, "accepted without validation, as the taxonomy data is "+provenance.String())
+			if got.Terms[0].Kind != TermCategory || unvalidated == provenance.Live() {
+				t.Errorf("unknown category term = %+v, want a category accepted without validation unless live", got.Terms[0])
+			}
+			// A code of an unknown archive is a keyword, with a warning unless the taxonomy is live
+			warned := strings.Contains(got.Terms[1].Note, "write cat:newarch.AB")
+			if got.Terms[1].Kind != TermKeyword || warned == provenance.Live() {
+				t.Errorf("unknown archive term = %+v, want a keyword warned about unless live", got.Terms[1])
+			}
+			if got.Terms[2].Clause != "cat:cs.AI" || !strings.Contains(got.Terms[2].Note, "normalized to the category code cs.AI") {
+				t.Errorf("miscased category term = %+v, want it normalized to cs.AI", got.Terms[2])
+			}
+		})
+	}
+
+	// Without tokens that the taxonomy decided on, the output does not refer to it
+	got, err := ParseMixedExpression(`"graph neural networks" au:smith evaluation`, "")
+	if err != nil {
+		t.Fatalf("ParseMixedExpression() unexpected error: %v", err)
+	}
+	if got.Taxonomy != nil {
+		t.Errorf("taxonomy = %+v, want none for keywords, phrases and fields", got.Taxonomy)
+	}
+}
+
+func TestJoinCategoryList(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		strategy   string
+		want       string
+		wantJoined bool
+		wantError  bool
+	}{
+		{"Default strategy is AND", "cs.AI cs.CL", "", "cs.AI AND cs.CL", true, false},
+		{"AND strategy", "cs.AI, cs.CL", "AND", "cs.AI AND cs.CL", true, false},
+		{"OR strategy", "cs.AI, cs.CL,cs.LG", "OR", "cs.AI OR cs.CL OR cs.LG", true, false},
+
+		// --- Left to the expression parser ---
+		{"Single category", "cs.AI", "OR", "cs.AI", false, false},
+		{"Explicit operator wins", "cs.AI AND cs.CL", "OR", "cs.AI AND cs.CL", false, false},
+		{"Explicit symbol wins", "cs.AI | cs.CL", "AND", "cs.AI | cs.CL", false, false},
+		{"Grouping wins", "(cs.AI cs.CL)", "OR", "(cs.AI cs.CL)", false, false},
+		{"Exclusion", "cs.AI -cs.LG", "OR", "cs.AI -cs.LG", false, false},
+		{"Keywords", "cs.CL llm", "OR", "cs.CL llm", false, false},
+		{"Group code is a keyword", "math cs.LO", "OR", "math cs.LO", false, false},
+		{"Quoted phrase", `cs.CL "language models"`, "OR", `cs.CL "language models"`, false, false},
+
+		// --- Errors ---
+		{"Invalid strategy", "cs.AI cs.CL", "XOR", "", false, true},
+		{"Strategy is case sensitive", "cs.AI cs.CL", "or", "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, joined, err := JoinCategoryList(tt.input, tt.strategy)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("JoinCategoryList(%q, %q) = %q, want error", tt.input, tt.strategy, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("JoinCategoryList(%q, %q) unexpected error: %v", tt.input, tt.strategy, err)
+			}
+			if got != tt.want || joined != tt.wantJoined {
+				t.Errorf("JoinCategoryList(%q, %q) = %q, %v, want %q, %v", tt.input, tt.strategy, got, joined, tt.want, tt.wantJoined)
+			}
+		})
+	}
+
+	// The joined list parses to the query the strategy asks for
+	expression, _, err := JoinCategoryList("cs.AI, cs.CL", JoinOr)
+	if err != nil {
+		t.Fatalf("JoinCategoryList() unexpected error: %v", err)
+	}
+	got, err := ParseMixedExpression(expression, "")
+	if err != nil || got.Query != "(cat:cs.AI+OR+cat:cs.CL)" {
+		t.Errorf("ParseMixedExpression(%q) = %v, %v, want (cat:cs.AI+OR+cat:cs.CL)", expression, got, err)
+	}
+}
+
+func TestExcludedExpression(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		want         string
+		wantExcluded bool
+	}{
+		{"Single exclusion", "-smith", "smith", true},
+		{"Exclusions joined implicitly", "-survey NOT review", "survey OR review", true},
+		{"Exclusions joined with AND", "-survey AND -review", "survey OR review", true},
+		{"Excluded phrase", `-"large language models"`, `"large language models"`, true},
+		{"Excluded group", "-(survey OR review) -tutorial", "( survey OR review ) OR tutorial", true},
+		{"Hyphenated word", "-state-of-the-art", "state-of-the-art", true},
+
+		// --- Searches something ---
+		{"No exclusion", "hinton", "hinton", false},
+		{"Exclusion after a term", "hinton -bengio", "hinton -bengio", false},
+		{"Negation within a group", "(-survey)", "(-survey)", false},
+		{"Excluded terms joined with OR", "-survey OR -review", "-survey OR -review", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, excluded, err := ExcludedExpression(tt.input)
+			if err != nil {
+				t.Fatalf("ExcludedExpression(%q) unexpected error: %v", tt.input, err)
+			}
+			if got != tt.want || excluded != tt.wantExcluded {
+				t.Errorf("ExcludedExpression(%q) = %q, %v, want %q, %v", tt.input, got, excluded, tt.want, tt.wantExcluded)
+			}
+		})
+	}
+
+	// What is excluded parses like any other expression
+	expression, _, err := ExcludedExpression(`-survey -"lecture notes"`)
+	if err != nil {
+		t.Fatalf("ExcludedExpression() unexpected error: %v", err)
+	}
+	got, err := ParseFieldExpression(expression, "ti")
+	if err != nil || got.Query != "(ti:survey+OR+ti:%22lecture+notes%22)" {
+		t.Errorf("ParseFieldExpression(%q) = %v, %v, want (ti:survey+OR+ti:%%22lecture+notes%%22)", expression, got, err)
+	}
+	if _, _, err := ExcludedExpression(`-"unterminated`); err == nil {
+		t.Errorf("ExcludedExpression() with an unterminated phrase, want error")
+	}
+}
+
+func TestParseMixedExpressionRelated(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		want        string
+		wantRelated [][]string
+	}{
+		{"Adjacent categories are ORed in", "cs.CL", "((cat:cs.CL+OR+cat:cs.AI+OR+cat:cs.LG))", [][]string{{"cs.AI", "cs.LG"}}},
+		{"Only category terms are expanded", "stat.ML AND kernels", "((cat:stat.ML+OR+cat:cs.LG)+AND+all:kernels)", [][]string{{"cs.LG"}, nil}},
+		{"Categories without adjacent ones are kept", "hep-th OR eess.AS", "(cat:hep-th+OR+(cat:eess.AS+OR+cat:cs.SD))", [][]string{nil, {"cs.SD"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMixedExpressionRelated(tt.input, "")
+			if err != nil {
+				t.Fatalf("ParseMixedExpressionRelated(%q) unexpected error: %v", tt.input, err)
+			}
+			if got.Query != tt.want {
+				t.Errorf("\nInput: %q\nGot:   %q\nWant:  %q", tt.input, got.Query, tt.want)
+			}
+			for i, term := range got.Terms {
+				if strings.Join(term.Related, ",") != strings.Join(tt.wantRelated[i], ",") {
+					t.Errorf("term %d related = %v, want %v", i, term.Related, tt.wantRelated[i])
+				}
+			}
+		})
+	}
+
+	// Without expansion, nothing is added
+	plain, err := ParseMixedExpression("cs.CL", "")
+	if err != nil || plain.Query != "(cat:cs.CL)" || plain.Terms[0].Related != nil {
+		t.Errorf("ParseMixedExpression() = %+v, %v, want cs.CL alone", plain, err)
+	}
+}
+
+func TestParseFieldExpression(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		field     string
+		want      string
+		wantError bool
+	}{
+		{"Title words", "transformer AND attention", "ti", "(ti:transformer+AND+ti:attention)", false},
+		{"Implicit AND and phrase", `"self attention" survey`, "abs", "(abs:%22self+attention%22+AND+abs:survey)", false},
+		{"Grouping and negation", "(bert | gpt) -survey", "all", "((all:bert+OR+all:gpt)+NOT+all:survey)", false},
+		{"Category codes are words", "cs.CL", "ti", "(ti:cs.CL)", false},
+		{"Author", "vaswani OR shazeer", "au", "(au:vaswani+OR+au:shazeer)", false},
+		{"Explicit field prefix", "attention au:vaswani", "ti", "(ti:attention+AND+au:vaswani)", false},
+		{"Words are escaped", "c&a", "co", "(co:c%26a)", false},
+		{"Empty expression", "", "ti", "", true},
+		{"Invalid field", "attention", "cat", "", true},
+		{"Field name instead of prefix", "attention", "title", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFieldExpression(tt.input, tt.field)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("\nInput: %q\nExpected error but got %q", tt.input, got.Query)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("\nInput: %q\nUnexpected error: %v", tt.input, err)
+			}
+			if got.Query != tt.want {
+				t.Errorf("\nInput: %q\nGot:   %q\nWant:  %q", tt.input, got.Query, tt.want)
+			}
+		})
+	}
+}
@@ -15,6 +15,8 @@ const (
 	tokenLParen
 	tokenRParen
 	tokenEOF
+	// tokenPhrase is a quoted phrase, only produced by the mixed expression lexer
+	tokenPhrase
 )
 
 type token struct {
@@ -54,7 +56,9 @@ type parser struct {
 	pos    int
 }
 
-func (p *parser) parseExpression(tokenPrefix, tokenSuffix string) (string, error) {
+// parseExpression parses tokens up to the next closing parenthesis, rendering each term (an
+// identifier or phrase) with render
+func (p *parser) parseExpression(render func(tok token) string) (string, error) {
 	var parts []string
 
 	for p.pos < len(p.tokens) {
@@ -72,7 +76,7 @@ func (p *parser) parseExpression(tokenPrefix, tokenSuffix string) (string, error
 			isLastIdent := !isOperator(last) && !strings.HasPrefix(last, "(")
 			isLastClosingParen := strings.HasSuffix(last, ")")
 			isLastTerm := isLastIdent || isLastClosingParen
-			isCurrTerm := tok.Type == tokenIdent || tok.Type == tokenLParen
+			isCurrTerm := tok.Type == tokenIdent || tok.Type == tokenPhrase || tok.Type == tokenLParen
 
 			if isLastTerm && isCurrTerm {
 				parts = append(parts, "AND")
@@ -82,13 +86,13 @@ func (p *parser) parseExpression(tokenPrefix, tokenSuffix string) (string, error
 		p.pos++
 		switch tok.Type {
 		case tokenLParen:
-			expr, err := p.parseExpression(tokenPrefix, tokenSuffix)
+			expr, err := p.parseExpression(render)
 			if err != nil {
 				return "", err
 			}
 			parts = append(parts, "("+expr+")")
-		case tokenIdent:
-			parts = append(parts, tokenPrefix+tok.Value+tokenSuffix)
+		case tokenIdent, tokenPhrase:
+			parts = append(parts, render(tok))
 		case tokenAnd, tokenOr, tokenNot:
 			parts = append(parts, tok.Value)
 		}
@@ -117,7 +121,9 @@ func ParseReconstructCategoryExpression(input string) (string, error) {
 func ParseReconstructGeneralExpression(input, prefix, suffix string) (string, error) {
 	tokens := lex(input)
 	p := &parser{tokens: tokens}
-	expr, err := p.parseExpression(prefix, suffix)
+	expr, err := p.parseExpression(func(tok token) string {
+		return prefix + tok.Value + suffix
+	})
 	if err != nil {
 		return "", err
 	}
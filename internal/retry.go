@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"opus-mcp/internal/metrics"
+	"opus-mcp/internal/settings"
+)
+
+// RetryConfig holds the configuration of retries of transient HTTP failures
+type RetryConfig struct {
+	// MaxRetries is the number of times a request failing transiently is retried; zero disables
+	// retries, so that a failure fails the call
+	MaxRetries int `env:"OPUS_MCP_HTTP_MAX_RETRIES,default=0"`
+}
+
+// Validate checks that the number of retries is not negative
+func (c *RetryConfig) Validate() error {
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("OPUS_MCP_HTTP_MAX_RETRIES cannot be negative, got %d", c.MaxRetries)
+	}
+	return nil
+}
+
+// LoadRetryConfig loads the retry configuration from environment variables
+func LoadRetryConfig() (*RetryConfig, error) {
+	var config RetryConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process HTTP retry configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Doer sends HTTP requests; *http.Client implements it
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// RetryPolicy bounds the retries of DoWithRetry
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt
+	MaxRetries int
+	// BaseDelay is the wait before the first retry, doubled for each further retry
+	BaseDelay time.Duration
+	// MaxDelay, when set, is the longest a retry waits: a response asking for a longer wait with its
+	// Retry-After header is returned as it is instead
+	MaxDelay time.Duration
+	// Wait, when set, is called before every retry once the backoff is over, e.g., to take a turn on
+	// a rate limiter; its error ends the retries and is returned
+	Wait func(ctx context.Context) error
+	// Now is the clock Retry-After dates are compared with; time.Now when not set
+	Now func() time.Time
+}
+
+// DoWithRetry sends a request, retrying it with exponential backoff while it fails transiently: with
+// a network error or timeout, or with a 5xx response. Client errors, i.e., 4xx responses, are never
+// retried. A Retry-After header longer than the backoff is waited for instead. The last response or
+// error is returned once the retries are used up, or when the context would be done before the next
+// retry. The request must be safe to repeat; a request with a body must be able to replay it through
+// GetBody.
+func DoWithRetry(ctx context.Context, client Doer, req *http.Request, policy RetryPolicy) (*http.Response, error) {
+	now := policy.Now
+	if now == nil {
+		now = time.Now
+	}
+	delay := policy.BaseDelay
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(req)
+		reason, retry := transientFailure(ctx, resp, err)
+		if !retry || attempt >= policy.MaxRetries {
+			return resp, err
+		}
+
+		wait := delay
+		if resp != nil {
+			if asked, ok := ParseRetryAfter(resp.Header.Get("Retry-After"), now()); ok && asked > wait {
+				wait = asked
+			}
+		}
+		if policy.MaxDelay > 0 && wait > policy.MaxDelay {
+			slog.Warn("Not retrying a request that asked for a longer wait than allowed", "url", req.URL.Redacted(), "wait", wait, "max_delay", policy.MaxDelay)
+			return resp, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return resp, err
+		}
+		next, cloneErr := cloneForRetry(ctx, req)
+		if cloneErr != nil {
+			return resp, err
+		}
+		if resp != nil {
+			// The connection is reused once the body of the failed response is drained
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		metrics.HTTPRetriesTotal.WithLabelValues(req.URL.Hostname(), reason).Inc()
+		slog.Warn("Transient HTTP failure, retrying",
+			"url", req.URL.Redacted(),
+			"reason", reason,
+			"attempt", attempt+1,
+			"max_retries", policy.MaxRetries,
+			"delay", wait,
+			"error", err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		if policy.Wait != nil {
+			if waitErr := policy.Wait(ctx); waitErr != nil {
+				return nil, waitErr
+			}
+		}
+		req = next
+		delay *= 2
+	}
+}
+
+// transientFailure reports whether the outcome of a request is worth retrying, and why
+func transientFailure(ctx context.Context, resp *http.Response, err error) (reason string, retry bool) {
+	switch {
+	case err != nil:
+		// Requests given up by the caller are not retried
+		return "error", ctx.Err() == nil
+	case resp.StatusCode >= 500:
+		return strconv.Itoa(resp.StatusCode), true
+	}
+	return "", false
+}
+
+// cloneForRetry copies a request to send it again, replaying its body
+func cloneForRetry(ctx context.Context, req *http.Request) (*http.Request, error) {
+	next := req.Clone(ctx)
+	if req.Body == nil || req.Body == http.NoBody {
+		return next, nil
+	}
+	if req.GetBody == nil {
+		return nil, fmt.Errorf("request body of %s cannot be replayed", req.URL.Redacted())
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	next.Body = body
+	return next, nil
+}
+
+// ParseRetryAfter parses a Retry-After header, which is either a number of seconds or an HTTP date
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(0, time.Duration(seconds)*time.Second), seconds >= 0
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(0, at.Sub(now)), true
+	}
+	return 0, false
+}
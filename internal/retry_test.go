@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer answers the first failures requests with status and the later ones with 200 OK,
+// and returns the number of requests it received
+func flakyServer(t *testing.T, failures int32, status int, header http.Header) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			for key, values := range header {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestDoWithRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int32
+		status       int
+		header       http.Header
+		maxRetries   int
+		wantStatus   int
+		wantRequests int32
+	}{
+		{name: "Fails twice then succeeds", failures: 2, status: http.StatusServiceUnavailable, maxRetries: 2, wantStatus: http.StatusOK, wantRequests: 3},
+		{name: "Retries used up", failures: 2, status: http.StatusBadGateway, maxRetries: 1, wantStatus: http.StatusBadGateway, wantRequests: 2},
+		{name: "Disabled by default", failures: 2, status: http.StatusServiceUnavailable, wantStatus: http.StatusServiceUnavailable, wantRequests: 1},
+		{name: "Client errors are not retried", failures: 2, status: http.StatusNotFound, maxRetries: 2, wantStatus: http.StatusNotFound, wantRequests: 1},
+		{name: "Too many requests are not retried", failures: 2, status: http.StatusTooManyRequests, maxRetries: 2, wantStatus: http.StatusTooManyRequests, wantRequests: 1},
+		{
+			name: "Retry-After longer than allowed", failures: 2, status: http.StatusServiceUnavailable, header: http.Header{"Retry-After": {"120"}},
+			maxRetries: 2, wantStatus: http.StatusServiceUnavailable, wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := flakyServer(t, tt.failures, tt.status, tt.header)
+			var waits int
+			policy := RetryPolicy{
+				MaxRetries: tt.maxRetries,
+				BaseDelay:  time.Millisecond,
+				MaxDelay:   time.Minute,
+				Wait:       func(ctx context.Context) error { waits++; return nil },
+			}
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			resp, err := DoWithRetry(context.Background(), server.Client(), req, policy)
+			if err != nil {
+				t.Fatalf("DoWithRetry() unexpected error: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus || requests.Load() != tt.wantRequests {
+				t.Errorf("DoWithRetry() = HTTP %d after %d requests, want HTTP %d after %d", resp.StatusCode, requests.Load(), tt.wantStatus, tt.wantRequests)
+			}
+			// Every retry, and only a retry, passes through Wait
+			if int32(waits) != tt.wantRequests-1 {
+				t.Errorf("Wait was called %d times, want %d", waits, tt.wantRequests-1)
+			}
+		})
+	}
+}
+
+func TestDoWithRetryHonoursRetryAfter(t *testing.T) {
+	server, requests := flakyServer(t, 1, http.StatusServiceUnavailable, http.Header{"Retry-After": {"1"}})
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	start := time.Now()
+	resp, err := DoWithRetry(context.Background(), server.Client(), req, RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond})
+	if err != nil {
+		t.Fatalf("DoWithRetry() unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); resp.StatusCode != http.StatusOK || requests.Load() != 2 || elapsed < time.Second {
+		t.Errorf("DoWithRetry() = HTTP %d after %d requests in %v, want 200 OK after 2 requests and the second asked for", resp.StatusCode, requests.Load(), elapsed)
+	}
+}
+
+func TestDoWithRetryStopsBeforeDeadline(t *testing.T) {
+	server, requests := flakyServer(t, 2, http.StatusServiceUnavailable, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	// A backoff the deadline does not leave time for returns the failure right away
+	resp, err := DoWithRetry(ctx, server.Client(), req, RetryPolicy{MaxRetries: 2, BaseDelay: time.Minute})
+	if err != nil {
+		t.Fatalf("DoWithRetry() unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || requests.Load() != 1 {
+		t.Errorf("DoWithRetry() = HTTP %d after %d requests, want the first 503", resp.StatusCode, requests.Load())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 2, 3, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{" 0 ", 0, true},
+		{"Tue, 03 Feb 2026 14:05:00 GMT", 5 * time.Minute, true},
+		{"Tue, 03 Feb 2026 13:55:00 GMT", 0, true},
+		{"-5", 0, false},
+		{"soon", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ParseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
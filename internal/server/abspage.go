@@ -0,0 +1,303 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"opus-mcp/internal"
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/metrics"
+	"opus-mcp/internal/textutil"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Sources of an abs metadata record
+const (
+	// AbsSourcePage means the record was parsed from the article's abs page
+	AbsSourcePage = "abs-page"
+	// AbsSourceAPI means the abs page could not be parsed and the record came from the arXiv API
+	AbsSourceAPI = "api"
+)
+
+// arxivAbsEndpoint is the base URL of arXiv abs pages; replaced in tests
+var arxivAbsEndpoint = arxivAbsBaseURL
+
+// absPageSelectors are the CSS selectors of the parts of an abs page that are extracted, kept in
+// one place so that a change to arXiv's layout is fixed here and in the HTML fixtures
+var absPageSelectors = struct {
+	Title, Authors, Abstract, Descriptor               string
+	Comments, JournalRef, RelatedDOI                   string
+	Subjects, PrimarySubject, VersionedID              string
+	History, License, InspireLink, SemanticScholarLink string
+}{
+	Title:               "#abs h1.title",
+	Authors:             "#abs div.authors a",
+	Abstract:            "#abs blockquote.abstract",
+	Descriptor:          "span.descriptor",
+	Comments:            "#abs td.comments",
+	JournalRef:          "#abs td.jref",
+	RelatedDOI:          "#abs td.doi a",
+	Subjects:            "#abs td.subjects",
+	PrimarySubject:      "#abs td.subjects span.primary-subject",
+	VersionedID:         "#abs td.arxividv span.arxivid a",
+	History:             "div.submission-history",
+	License:             "div.abs-license a",
+	InspireLink:         "a.cite-inspire",
+	SemanticScholarLink: "a.cite-semantic-scholar",
+}
+
+var (
+	// subjectCode matches the category code closing a subject, e.g., "Machine Learning (cs.LG)"
+	subjectCode = regexp.MustCompile(`\(([a-z-]+(?:\.[A-Za-z-]+)?)\)`)
+	// historyVersion matches a version in the submission history, e.g., "[v1] Mon, 12 Jun 2017
+	// 17:57:34 UTC (1,102 KB)", optionally marked as withdrawn
+	historyVersion = regexp.MustCompile(`\[(v\d+)\]\s*([A-Z][a-z]{2}, \d{1,2} [A-Z][a-z]{2} \d{4} \d{2}:\d{2}:\d{2} UTC)\s*\(([^)]*)\)(\s*\(withdrawn\))?`)
+	// historySubmitter matches the submitter heading the submission history
+	historySubmitter = regexp.MustCompile(`From:\s*([^\[\n]+?)\s*\[`)
+)
+
+// historyDateLayout is the layout of the submission dates in the submission history
+const historyDateLayout = "Mon, 2 Jan 2006 15:04:05 MST"
+
+// errAbsLayout means an abs page does not have the layout absPageSelectors expect
+var errAbsLayout = errors.New("abs page layout not recognized")
+
+// ArxivGetAbsMetadataArgs defines the input parameters for fetching the abs page of an article
+type ArxivGetAbsMetadataArgs struct {
+	ID string `json:"id" jsonschema:"The arXiv identifier of the article, e.g., 2405.12345, 2405.12345v2 or hep-th/9901001. A citation, abs/pdf URL or DataCite DOI is also accepted. Without a version, the latest version is described"`
+}
+
+// AbsVersion is a version in the submission history of an article
+type AbsVersion struct {
+	Version   string `json:"version" jsonschema:"The version, e.g., v2"`
+	Submitted string `json:"submitted,omitempty" jsonschema:"When the version was submitted, as an RFC 3339 time in UTC"`
+	Size      string `json:"size,omitempty" jsonschema:"The size of the version as shown by arXiv, e.g., 1,102 KB"`
+	Withdrawn bool   `json:"withdrawn,omitempty" jsonschema:"Whether the version withdraws the article"`
+}
+
+// AbsMetadata is the metadata of an article as shown on its abs page
+type AbsMetadata struct {
+	Source             string       `json:"source" jsonschema:"Where the record came from: abs-page when the abs page was parsed, or api when its layout could not be parsed and the arXiv API was queried instead, in which case submissionHistory, submitter, licenseUrl and the external links are missing"`
+	ArticleID          string       `json:"articleId" jsonschema:"The versioned arXiv identifier of the version described"`
+	Title              string       `json:"title,omitempty" jsonschema:"The title of the article"`
+	Authors            []string     `json:"authors,omitempty" jsonschema:"The names of the authors, in order"`
+	Abstract           string       `json:"abstract,omitempty" jsonschema:"The abstract of the article"`
+	Comments           string       `json:"comments,omitempty" jsonschema:"The authors' comments, e.g., the number of pages and figures"`
+	JournalRef         string       `json:"journalRef,omitempty" jsonschema:"The journal reference, when the article has been published"`
+	DOI                string       `json:"doi,omitempty" jsonschema:"The DOI of the published article, when the authors gave one"`
+	PrimaryCategory    string       `json:"primaryCategory,omitempty" jsonschema:"The arXiv category the article was submitted to"`
+	Categories         []string     `json:"categories,omitempty" jsonschema:"All categories of the article, the primary category first"`
+	Submitter          string       `json:"submitter,omitempty" jsonschema:"The name of the person who submitted the article"`
+	SubmissionHistory  []AbsVersion `json:"submissionHistory,omitempty" jsonschema:"Every version of the article, oldest first"`
+	Withdrawn          bool         `json:"withdrawn,omitempty" jsonschema:"Whether the latest version withdraws the article"`
+	LicenseURL         string       `json:"licenseUrl,omitempty" jsonschema:"The URL of the license the article is distributed under"`
+	InspireURL         string       `json:"inspireUrl,omitempty" jsonschema:"The article's record on INSPIRE HEP, shown for high energy physics articles"`
+	SemanticScholarURL string       `json:"semanticScholarUrl,omitempty" jsonschema:"The article's record on Semantic Scholar"`
+	Warnings           []string     `json:"warnings,omitempty" jsonschema:"Parts of the page that could not be parsed; the record is returned as far as it could be"`
+}
+
+// getAbsMetadata handles fetching and parsing the abs page of a single article
+func getAbsMetadata(ctx context.Context, input json.RawMessage) (any, error) {
+	var args ArxivGetAbsMetadataArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+	id, err := arxivid.Parse(args.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid arXiv identifier: %w", err)
+	}
+
+	page, err := fetchAbsPage(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	record, err := parseAbsPage(page)
+	if errors.Is(err, errAbsLayout) {
+		slog.Warn("Falling back to the arXiv API for an abs page that could not be parsed", "article_id", id.Canonical(), "error", err)
+		return absMetadataFromAPI(ctx, id, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// fetchAbsPage fetches the abs page of an article within the arXiv rate limit and daily quota
+func fetchAbsPage(ctx context.Context, id arxivid.ID) ([]byte, error) {
+	if cooldownErr := arxivCooldown.check(); cooldownErr != nil {
+		return nil, cooldownErr
+	}
+	if err := takeArxivTurn(ctx, arxivRequestAbsPage); err != nil {
+		return nil, err
+	}
+
+	pageURL := id.AbsURL(arxivAbsEndpoint)
+	slog.Info("Fetching arXiv abs page", "url", pageURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	timer := metrics.StartOperation(metrics.SlowArxivQuery)
+	resp, err := toolDeps.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch abs page: %w", err)
+	}
+	defer resp.Body.Close()
+	clockSkew.Observe("arxiv", resp.Header, time.Now())
+	if cooldownErr := arxivCooldown.observe(resp); cooldownErr != nil {
+		return nil, cooldownErr
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("arXiv has no article %s", id.Canonical())
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch abs page: HTTP %d", resp.StatusCode)
+	}
+	page, err := internal.ReadAll(ctx, resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read abs page: %w", err)
+	}
+	timer.Done(int64(len(page)), "url", pageURL)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// parseAbsPage extracts the metadata of an article from its abs page. A page without the title or
+// versioned identifier of an article does not have the expected layout and fails with
+// errAbsLayout; any other part that is missing or malformed is left out with a warning.
+func parseAbsPage(page []byte) (*AbsMetadata, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+	sel := absPageSelectors
+	record := &AbsMetadata{Source: AbsSourcePage}
+	warn := func(format string, args ...any) {
+		record.Warnings = append(record.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	record.Title = descriptorText(doc.Find(sel.Title))
+	versioned := strings.TrimPrefix(textutil.CollapseSpace(doc.Find(sel.VersionedID).First().Text()), "arXiv:")
+	if record.Title == "" || versioned == "" {
+		return nil, fmt.Errorf("%w: no title or versioned identifier", errAbsLayout)
+	}
+	id, err := arxivid.Parse(versioned)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errAbsLayout, err)
+	}
+	record.ArticleID = id.Canonical()
+
+	doc.Find(sel.Authors).Each(func(_ int, a *goquery.Selection) {
+		if name := textutil.CollapseSpace(a.Text()); name != "" {
+			record.Authors = append(record.Authors, name)
+		}
+	})
+	if len(record.Authors) == 0 {
+		warn("no authors found")
+	}
+	if record.Abstract = descriptorText(doc.Find(sel.Abstract)); record.Abstract == "" {
+		warn("no abstract found")
+	}
+	record.Comments = textutil.CollapseSpace(doc.Find(sel.Comments).First().Text())
+	record.JournalRef = textutil.CollapseSpace(doc.Find(sel.JournalRef).First().Text())
+	record.DOI = textutil.CollapseSpace(doc.Find(sel.RelatedDOI).First().Text())
+
+	if primary := subjectCode.FindStringSubmatch(doc.Find(sel.PrimarySubject).First().Text()); primary != nil {
+		record.PrimaryCategory = primary[1]
+	} else {
+		warn("no primary subject found")
+	}
+	for _, match := range subjectCode.FindAllStringSubmatch(doc.Find(sel.Subjects).First().Text(), -1) {
+		record.Categories = append(record.Categories, match[1])
+	}
+
+	parseSubmissionHistory(doc.Find(sel.History).First().Text(), record, warn)
+
+	record.LicenseURL, _ = doc.Find(sel.License).First().Attr("href")
+	record.InspireURL, _ = doc.Find(sel.InspireLink).First().Attr("href")
+	record.SemanticScholarURL, _ = doc.Find(sel.SemanticScholarLink).First().Attr("href")
+	return record, nil
+}
+
+// parseSubmissionHistory sets the submitter, versions and withdrawal status of an article from the
+// text of the submission history of its abs page
+func parseSubmissionHistory(text string, record *AbsMetadata, warn func(format string, args ...any)) {
+	if submitter := historySubmitter.FindStringSubmatch(text); submitter != nil {
+		record.Submitter = textutil.CollapseSpace(submitter[1])
+	}
+	for _, match := range historyVersion.FindAllStringSubmatch(text, -1) {
+		version := AbsVersion{Version: match[1], Size: match[3], Withdrawn: match[4] != ""}
+		if submitted, err := time.Parse(historyDateLayout, match[2]); err == nil {
+			version.Submitted = submitted.UTC().Format(time.RFC3339)
+		} else {
+			warn("submission date %q of %s could not be parsed", match[2], match[1])
+		}
+		record.SubmissionHistory = append(record.SubmissionHistory, version)
+	}
+	if len(record.SubmissionHistory) == 0 {
+		warn("no submission history found")
+		return
+	}
+	record.Withdrawn = record.SubmissionHistory[len(record.SubmissionHistory)-1].Withdrawn
+}
+
+// absMetadataFromAPI builds the record of an article from the arXiv API, for an abs page whose
+// layout could not be parsed
+func absMetadataFromAPI(ctx context.Context, id arxivid.ID, pageErr error) (*AbsMetadata, error) {
+	result, err := fetchIDList(ctx, []string{id.Canonical()}, 1, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 {
+		resolution := result.Resolutions[0]
+		if resolution.Error != "" {
+			return nil, fmt.Errorf("failed to fetch %s from the arXiv API: %s", id.Canonical(), resolution.Error)
+		}
+		return nil, fmt.Errorf("arXiv has no article %s", id.Canonical())
+	}
+	entry := result.Items[0]
+	record := &AbsMetadata{
+		Source:          AbsSourceAPI,
+		ArticleID:       entry.ArticleID,
+		Title:           textutil.CollapseSpace(entry.Title),
+		Abstract:        strings.TrimSpace(entry.Description),
+		Comments:        arxivExtension(entry, "comment"),
+		JournalRef:      arxivExtension(entry, "journal_ref"),
+		DOI:             arxivExtension(entry, "doi"),
+		PrimaryCategory: entry.PrimaryCategory,
+		Categories:      entry.Categories,
+		Warnings:        []string{pageErr.Error() + "; returned the arXiv API record instead, which has no submission history, submitter, license or external links"},
+	}
+	for _, author := range entry.Authors {
+		record.Authors = append(record.Authors, author.Name)
+	}
+	record.Warnings = append(record.Warnings, entry.Errors...)
+	return record, nil
+}
+
+// arxivExtension returns the value of an arxiv: extension element of a feed entry, e.g.,
+// arxiv:journal_ref, or "" if the entry has none
+func arxivExtension(entry *FeedEntry, name string) string {
+	if values := entry.Extensions["arxiv"][name]; len(values) > 0 {
+		return textutil.CollapseSpace(values[0].Value)
+	}
+	return ""
+}
+
+// descriptorText returns the text of an abs page element without its descriptor, e.g., "Title:"
+func descriptorText(s *goquery.Selection) string {
+	s = s.First().Clone()
+	s.Find(absPageSelectors.Descriptor).Remove()
+	return textutil.CollapseSpace(s.Text())
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeAbsPages points abs page requests at a test server answering every request with the given
+// fixture and status, and returns the paths requested
+func fakeAbsPages(t *testing.T, fixture string, status int) *[]string {
+	t.Helper()
+	page, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(status)
+		_, _ = w.Write(page)
+	}))
+	original := arxivAbsEndpoint
+	arxivAbsEndpoint = srv.URL + "/abs/"
+	t.Cleanup(func() {
+		srv.Close()
+		arxivAbsEndpoint = original
+	})
+	return &paths
+}
+
+func TestParseAbsPage(t *testing.T) {
+	page, err := os.ReadFile("testdata/abs_page.html")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	got, err := parseAbsPage(page)
+	if err != nil {
+		t.Fatalf("parseAbsPage() unexpected error: %v", err)
+	}
+	want := &AbsMetadata{
+		Source:          AbsSourcePage,
+		ArticleID:       "1706.03762v7",
+		Title:           "Attention Is All You Need",
+		Authors:         []string{"Ashish Vaswani", "Noam Shazeer", "Niki Parmar"},
+		Abstract:        "The dominant sequence transduction models are based on complex recurrent or convolutional neural networks in an encoder-decoder configuration.",
+		Comments:        "15 pages, 5 figures",
+		JournalRef:      "Advances in Neural Information Processing Systems 30 (2017)",
+		DOI:             "10.5555/3295222.3295349",
+		PrimaryCategory: "cs.CL",
+		Categories:      []string{"cs.CL", "cs.LG"},
+		Submitter:       "Ashish Vaswani",
+		SubmissionHistory: []AbsVersion{
+			{Version: "v1", Submitted: "2017-06-12T17:57:34Z", Size: "1,102 KB"},
+			{Version: "v2", Submitted: "2017-06-19T16:49:45Z", Size: "1,125 KB"},
+			{Version: "v7", Submitted: "2023-08-02T00:41:18Z", Size: "1,124 KB"},
+		},
+		LicenseURL:         "http://arxiv.org/licenses/nonexclusive-distrib/1.0/",
+		SemanticScholarURL: "https://api.semanticscholar.org/arXiv:1706.03762",
+	}
+	if !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.MarshalIndent(got, "", "  ")
+		t.Errorf("parseAbsPage() = %s", gotJSON)
+	}
+}
+
+func TestParseAbsPagePartial(t *testing.T) {
+	page, err := os.ReadFile("testdata/abs_page_withdrawn.html")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	got, err := parseAbsPage(page)
+	if err != nil {
+		t.Fatalf("parseAbsPage() unexpected error: %v", err)
+	}
+	if got.ArticleID != "hep-th/9901001v2" || got.Title != "An Old-Style Article" || got.Submitter != "E. Author" {
+		t.Errorf("parseAbsPage() = %+v, want hep-th/9901001v2 by E. Author", got)
+	}
+	if !got.Withdrawn || len(got.SubmissionHistory) != 2 || !got.SubmissionHistory[1].Withdrawn || got.SubmissionHistory[1].Submitted != "" {
+		t.Errorf("submission history = %+v, want v2 withdrawn without a parsable date", got.SubmissionHistory)
+	}
+	if got.InspireURL != "https://inspirehep.net/arxiv/hep-th/9901001" || !reflect.DeepEqual(got.Categories, []string{"hep-th"}) {
+		t.Errorf("parseAbsPage() = %+v, want the INSPIRE link and hep-th", got)
+	}
+	// The parts missing from the page are reported, not fatal
+	for _, want := range []string{"no abstract found", "no primary subject found", `submission date "Tue, 2 Feb 1999 25:61:00 UTC" of v2`} {
+		found := false
+		for _, warning := range got.Warnings {
+			found = found || strings.Contains(warning, want)
+		}
+		if !found {
+			t.Errorf("warnings = %q, want one containing %q", got.Warnings, want)
+		}
+	}
+}
+
+func TestGetAbsMetadata(t *testing.T) {
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected API request %s for a parsable abs page", r.URL)
+	})
+	paths := fakeAbsPages(t, "testdata/abs_page.html", http.StatusOK)
+
+	output, err := getAbsMetadata(context.Background(), json.RawMessage(`{"id": "arXiv:1706.03762 [cs.CL]"}`))
+	if err != nil {
+		t.Fatalf("getAbsMetadata() unexpected error: %v", err)
+	}
+	record := output.(*AbsMetadata)
+	if record.Source != AbsSourcePage || record.ArticleID != "1706.03762v7" || len(record.Warnings) != 0 {
+		t.Errorf("getAbsMetadata() = %+v, want the parsed page without warnings", record)
+	}
+	if len(*paths) != 1 || (*paths)[0] != "/abs/1706.03762" {
+		t.Errorf("requested %q, want the abs page of 1706.03762", *paths)
+	}
+}
+
+func TestGetAbsMetadataFallsBackToAPI(t *testing.T) {
+	var apiRequests int
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		apiRequests++
+		_, _ = w.Write([]byte(idListFeed(strings.Split(r.URL.Query().Get("id_list"), ","))))
+	})
+	fakeAbsPages(t, "testdata/abs_page_unrecognized.html", http.StatusOK)
+
+	output, err := getAbsMetadata(context.Background(), json.RawMessage(`{"id": "2405.12345"}`))
+	if err != nil {
+		t.Fatalf("getAbsMetadata() unexpected error: %v", err)
+	}
+	record := output.(*AbsMetadata)
+	if record.Source != AbsSourceAPI || record.ArticleID != "2405.12345v1" || record.Title != "Paper 2405.12345" || apiRequests != 1 {
+		t.Errorf("getAbsMetadata() = %+v after %d API requests, want the API record", record, apiRequests)
+	}
+	if len(record.Warnings) != 1 || !strings.Contains(record.Warnings[0], "abs page layout not recognized") {
+		t.Errorf("warnings = %q, want the reason for the fallback", record.Warnings)
+	}
+}
+
+func TestGetAbsMetadataErrors(t *testing.T) {
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected API request %s", r.URL)
+	})
+	fakeAbsPages(t, "testdata/abs_page_unrecognized.html", http.StatusNotFound)
+
+	tests := []struct {
+		name      string
+		input     string
+		wantError string
+	}{
+		{"Invalid identifier", `{"id": "not-an-id"}`, "invalid arXiv identifier"},
+		{"Unknown article", `{"id": "2405.99999"}`, "arXiv has no article 2405.99999"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := getAbsMetadata(context.Background(), json.RawMessage(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("getAbsMetadata() error = %v, want error containing %q", err, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"opus-mcp/internal/settings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ErrCodeUnauthorized means the call needs the admin token, which the client did not present
+const ErrCodeUnauthorized = "UNAUTHORIZED"
+
+// adminHeader marks MCP requests authenticated with the admin token, for the tool handlers, which
+// only see the request headers. Incoming values are dropped.
+const adminHeader = "X-Opus-Mcp-Admin"
+
+// AdminConfig holds the configuration of the admin endpoint and tool loaded from environment variables
+type AdminConfig struct {
+	// Token is the bearer token required by the admin endpoint and tool. Without it, both are disabled.
+	Token string `env:"OPUS_MCP_ADMIN_TOKEN" secret:"true"`
+}
+
+// LoadAdminConfig loads the admin configuration from environment variables
+func LoadAdminConfig() (*AdminConfig, error) {
+	var config AdminConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process admin configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// adminToken is the bearer token of the admin endpoint and tool, which are disabled when it is empty
+var adminToken string
+
+// ServerConfigOutput defines the output structure for the server configuration tool
+type ServerConfigOutput struct {
+	Sections []settings.Section `json:"sections" jsonschema:"The effective configuration by section, sorted by name, with secrets replaced by fingerprints"`
+}
+
+// isAdminRequest reports whether an HTTP request carries the admin token
+func isAdminRequest(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && adminToken != "" && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(adminToken)) == 1
+}
+
+// adminMiddleware marks the requests carrying the admin token in a request header for the tool handlers
+func adminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(adminHeader)
+		if isAdminRequest(r) {
+			r.Header.Set(adminHeader, "true")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAdminCall reports whether an MCP request may use the admin tool: over HTTP it must carry the
+// admin token, while over stdio the client started the server and already has its configuration
+func isAdminCall(req mcp.Request) bool {
+	extra := req.GetExtra()
+	if extra == nil || extra.Header == nil {
+		return true
+	}
+	return extra.Header.Get(adminHeader) == "true"
+}
+
+// adminConfigHandler serves the effective configuration to clients presenting the admin token
+func adminConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if adminToken == "" {
+		http.Error(w, "admin endpoints are disabled: OPUS_MCP_ADMIN_TOKEN is not set", http.StatusNotFound)
+		return
+	}
+	if !isAdminRequest(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		http.Error(w, "the admin token is required", http.StatusUnauthorized)
+		return
+	}
+	jsonData, err := json.MarshalIndent(ServerConfigOutput{Sections: settings.Snapshot()}, "", "    ")
+	if err != nil {
+		slog.Error("configuration JSON marshalling failed", "error", err)
+		http.Error(w, "JSON marshalling failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := w.Write(jsonData); err != nil {
+		slog.Error("configuration response writing failed", "error", err)
+	}
+}
+
+// serverConfig contains the handler function of the server configuration tool
+func serverConfig(ctx context.Context, input json.RawMessage) (any, error) {
+	if info, _ := callInfoFrom(ctx); !info.Admin {
+		return nil, &ToolError{
+			Code:    ErrCodeUnauthorized,
+			Message: "the server configuration is only available to clients presenting the admin token",
+		}
+	}
+	return ServerConfigOutput{Sections: settings.Snapshot()}, nil
+}
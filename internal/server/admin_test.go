@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"opus-mcp/internal/settings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const testAdminToken = "test-admin-token"
+
+// withAdminToken configures the admin token for the duration of the test
+func withAdminToken(t *testing.T, token string) {
+	t.Helper()
+	original := adminToken
+	t.Cleanup(func() { adminToken = original })
+	adminToken = token
+}
+
+func TestAdminConfigRoute(t *testing.T) {
+	t.Setenv("OPUS_MCP_ADMIN_TOKEN", testAdminToken)
+	t.Setenv("OPUS_MCP_ARXIV_ID_LIST_BATCH_SIZE", "25")
+	config, err := LoadAdminConfig()
+	if err != nil {
+		t.Fatalf("LoadAdminConfig() unexpected error: %v", err)
+	}
+	if _, err := LoadIDListConfig(); err != nil {
+		t.Fatalf("LoadIDListConfig() unexpected error: %v", err)
+	}
+	withAdminToken(t, config.Token)
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{"without token", "", http.StatusUnauthorized},
+		{"with wrong token", "Bearer not-the-admin-token", http.StatusUnauthorized},
+		{"with admin token", "Bearer " + testAdminToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			newHTTPMux(httpRoutes(http.NotFoundHandler())).ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if strings.Contains(w.Body.String(), testAdminToken) {
+				t.Errorf("response reveals the admin token: %s", w.Body.String())
+			}
+			var output ServerConfigOutput
+			if err := json.Unmarshal(w.Body.Bytes(), &output); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			fields := map[string]settings.Field{}
+			for _, section := range output.Sections {
+				for _, field := range section.Fields {
+					fields[section.Name+"."+field.Name] = field
+				}
+			}
+			if got := fields["AdminConfig.Token"]; !got.Secret || got.Fingerprint == nil || got.Fingerprint.Length != len(testAdminToken) || got.Source != settings.SourceEnv {
+				t.Errorf("admin token field = %+v, want a fingerprinted secret from env", got)
+			}
+			if got := fields["IDListConfig.BatchSize"]; got.Value != float64(25) || got.Source != settings.SourceEnv {
+				t.Errorf("batch size field = %+v, want 25 from env", got)
+			}
+		})
+	}
+}
+
+func TestAdminConfigRouteDisabledWithoutToken(t *testing.T) {
+	withAdminToken(t, "")
+	r := httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	adminConfigHandler(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestServerConfigToolRequiresAdminTokenOverHTTP(t *testing.T) {
+	withAdminToken(t, testAdminToken)
+
+	// The middleware marks admin requests for the tool handlers, dropping spoofed marks
+	var requests []*mcp.CallToolRequest
+	handler := adminMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "server_config"}, Extra: &mcp.RequestExtra{Header: r.Header}})
+	}))
+	for _, authorization := range []string{"", "Bearer " + testAdminToken} {
+		r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		r.Header.Set(adminHeader, "true")
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	_, err := serverConfig(withCallInfo(context.Background(), newCallInfo(requests[0])), nil)
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeUnauthorized {
+		t.Errorf("serverConfig() without the admin token error = %v, want %s", err, ErrCodeUnauthorized)
+	}
+	if _, err := serverConfig(withCallInfo(context.Background(), newCallInfo(requests[1])), nil); err != nil {
+		t.Errorf("serverConfig() with the admin token unexpected error: %v", err)
+	}
+	// Over stdio, the client started the server
+	stdio := &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "server_config"}}
+	if _, err := serverConfig(withCallInfo(context.Background(), newCallInfo(stdio)), nil); err != nil {
+		t.Errorf("serverConfig() over stdio unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"opus-mcp/internal/metrics"
+	"opus-mcp/internal/settings"
+
+	"golang.org/x/time/rate"
+)
+
+// AdmissionConfig holds the admission control configuration loaded from environment variables
+type AdmissionConfig struct {
+	// MaxEstimatedWait is the longest estimated queueing time a rate-limited call is accepted with.
+	// Calls that would wait longer are rejected immediately as BUSY. Zero disables admission control.
+	MaxEstimatedWait settings.Duration `env:"OPUS_MCP_ADMISSION_MAX_WAIT,default=60s"`
+}
+
+// admissionController rejects rate-limited tool calls up front when they would queue for too long,
+// so that clients get a retry hint instead of timing out without knowing why
+type admissionController struct {
+	// limiter returns the rate limiter the guarded calls wait on
+	limiter func() *rate.Limiter
+	stats   *toolStatsRegistry
+	maxWait time.Duration
+	// queueDepth is the number of admitted rate-limited calls that have not completed yet
+	queueDepth atomic.Int64
+}
+
+func newAdmissionController(limiter *rate.Limiter, stats *toolStatsRegistry, maxWait time.Duration) *admissionController {
+	return &admissionController{
+		limiter: func() *rate.Limiter { return limiter },
+		stats:   stats,
+		maxWait: maxWait,
+	}
+}
+
+// arxivAdmission guards the tools that wait on the arXiv rate limiter of the tool dependencies
+var arxivAdmission = &admissionController{
+	limiter: func() *rate.Limiter { return toolDeps.ArxivLimiter },
+	stats:   toolStats,
+	maxWait: 60 * time.Second,
+}
+
+func init() {
+	metrics.NewGaugeFunc("admission_queue_depth", "Number of admitted rate-limited tool calls that have not completed yet.", func() float64 {
+		return float64(arxivAdmission.queueDepth.Load())
+	})
+	metrics.NewGaugeFunc("admission_estimated_wait_seconds", "Estimated wait in seconds for a new rate-limited tool call.", func() float64 {
+		return arxivAdmission.estimateWait("", time.Now()).Seconds()
+	})
+}
+
+// LoadAdmissionConfig loads the admission control configuration from environment variables
+func LoadAdmissionConfig() (*AdmissionConfig, error) {
+	var config AdmissionConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process admission configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// limiterDelay returns how long a new reservation on the limiter would have to wait, without reserving
+func (a *admissionController) limiterDelay(now time.Time) time.Duration {
+	limiter := a.limiter()
+	tokens := limiter.TokensAt(now)
+	if tokens >= 1 {
+		return 0
+	}
+	limit := limiter.Limit()
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / float64(limit) * float64(time.Second))
+}
+
+// estimateWait estimates how long a new call to the given tool would wait before starting:
+// the current limiter delay plus the time needed to drain the calls already queued ahead of it.
+// Each queued call costs at least one limiter interval, or the tool's average duration if longer.
+func (a *admissionController) estimateWait(tool string, now time.Time) time.Duration {
+	perCall := time.Duration(0)
+	if limit := a.limiter().Limit(); limit > 0 && limit != rate.Inf {
+		perCall = time.Duration(float64(time.Second) / float64(limit))
+	}
+	if avg := a.stats.averageDuration(tool); avg > perCall {
+		perCall = avg
+	}
+	return a.limiterDelay(now) + time.Duration(a.queueDepth.Load())*perCall
+}
+
+// admit accepts or rejects a call to the given tool. On acceptance, the returned release function
+// must be called once the call completes. On rejection, a BUSY tool error carries the estimate.
+func (a *admissionController) admit(tool string) (func(), *ToolError) {
+	if a.maxWait > 0 {
+		now := time.Now()
+		estimate := a.estimateWait(tool, now)
+		if estimate > a.maxWait {
+			metrics.AdmissionRejectedTotal.WithLabelValues(tool).Inc()
+			busyErr := &ToolError{
+				Code:    ErrCodeBusy,
+				Message: fmt.Sprintf("the server is busy: the estimated wait of %s exceeds the admission limit of %s", estimate.Round(time.Second), a.maxWait),
+				Details: map[string]any{
+					"estimatedWaitSeconds": estimate.Seconds(),
+					"queueDepth":           a.queueDepth.Load(),
+				},
+			}
+			return nil, busyErr.withRetryAt(estimate, now)
+		}
+	}
+	a.queueDepth.Add(1)
+	var released atomic.Bool
+	return func() {
+		if released.CompareAndSwap(false, true) {
+			a.queueDepth.Add(-1)
+		}
+	}, nil
+}
+
+// AdmissionStatus is a snapshot of the admission layer for readiness reporting
+type AdmissionStatus struct {
+	QueueDepth           int64   `json:"queueDepth"`
+	EstimatedWaitSeconds float64 `json:"estimatedWaitSeconds"`
+	MaxWaitSeconds       float64 `json:"maxWaitSeconds"`
+}
+
+func (a *admissionController) status() AdmissionStatus {
+	return AdmissionStatus{
+		QueueDepth:           a.queueDepth.Load(),
+		EstimatedWaitSeconds: a.estimateWait("", time.Now()).Seconds(),
+		MaxWaitSeconds:       a.maxWait.Seconds(),
+	}
+}
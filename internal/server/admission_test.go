@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"golang.org/x/time/rate"
+)
+
+// newTestToolHandler creates a tool handler accepting any object input and returning any object output
+func newTestToolHandler(t *testing.T, handlerFunc func(ctx context.Context, input json.RawMessage) (any, error)) *ArxivToolHandler {
+	t.Helper()
+	schema := &jsonschema.Schema{Type: "object"}
+	handler, err := NewArxivToolHandler(schema, schema, handlerFunc)
+	if err != nil {
+		t.Fatalf("failed to create tool handler: %v", err)
+	}
+	return handler
+}
+
+func newTestCallToolRequest(name string, arguments string) *mcp.CallToolRequest {
+	return &mcp.CallToolRequest{
+		Params: &mcp.CallToolParamsRaw{
+			Name:      name,
+			Arguments: json.RawMessage(arguments),
+		},
+	}
+}
+
+// resultText returns the text of the first content item of a tool result
+func resultText(t *testing.T, result *mcp.CallToolResult) string {
+	t.Helper()
+	if len(result.Content) == 0 {
+		t.Fatal("tool result has no content")
+	}
+	text, ok := result.Content[0].(*mcp.TextContent)
+	if !ok {
+		t.Fatalf("expected text content, got %T", result.Content[0])
+	}
+	return text.Text
+}
+
+func TestAdmissionEstimateWait(t *testing.T) {
+	// A limiter allowing one call every 3 seconds whose only token has just been taken
+	limiter := rate.NewLimiter(rate.Every(3*time.Second), 1)
+	now := time.Now()
+	limiter.AllowN(now, 1)
+
+	stats := newToolStatsRegistry()
+	ac := newAdmissionController(limiter, stats, time.Minute)
+
+	// No queue: only the limiter delay counts
+	if got := ac.estimateWait("tool", now); got < 2900*time.Millisecond || got > 3*time.Second {
+		t.Errorf("estimateWait() with empty queue = %v, want ~3s", got)
+	}
+
+	// Two queued calls at the limiter interval each
+	ac.queueDepth.Store(2)
+	if got := ac.estimateWait("tool", now); got < 8900*time.Millisecond || got > 9*time.Second {
+		t.Errorf("estimateWait() with 2 queued calls = %v, want ~9s", got)
+	}
+
+	// A tool whose average duration exceeds the limiter interval dominates the per-call cost
+	stats.record("slow_tool", 10*time.Second, "ok")
+	if got := ac.estimateWait("slow_tool", now); got < 22900*time.Millisecond || got > 23*time.Second {
+		t.Errorf("estimateWait() for slow tool with 2 queued calls = %v, want ~23s", got)
+	}
+}
+
+func TestAdmissionAcceptsEstimates(t *testing.T) {
+	limiter := rate.NewLimiter(rate.Every(time.Hour), 1)
+	limiter.Allow()
+	handler := newTestToolHandler(t, func(ctx context.Context, input json.RawMessage) (any, error) {
+		return map[string]any{}, nil
+	})
+	handler.admission = newAdmissionController(limiter, newToolStatsRegistry(), 10*time.Second)
+
+	// A tool that does not support estimates makes its rate-limited request regardless
+	result, err := handler.Handle(context.Background(), newTestCallToolRequest("saturated_tool", `{"estimateOnly": true}`))
+	if err != nil || !result.IsError || !strings.Contains(resultText(t, result), ErrCodeBusy) {
+		t.Errorf("Handle() of an estimate by a tool without estimates = %v, %v, want %s", result, err, ErrCodeBusy)
+	}
+
+	// An estimate makes no rate-limited request, so a saturated limiter does not reject it
+	handler.supportsEstimate = true
+	result, err = handler.Handle(context.Background(), newTestCallToolRequest("saturated_tool", `{"estimateOnly": true}`))
+	if err != nil || result.IsError {
+		t.Errorf("Handle() of an estimate = %v, %v, want it answered", result, err)
+	}
+	if depth := handler.admission.queueDepth.Load(); depth != 0 {
+		t.Errorf("queue depth after an estimate = %d, want 0", depth)
+	}
+}
+
+func TestAdmissionRejectsWhenSaturated(t *testing.T) {
+	// A saturated limiter: one call per hour and the token is already taken
+	limiter := rate.NewLimiter(rate.Every(time.Hour), 1)
+	limiter.Allow()
+
+	var calls atomic.Int32
+	handler := newTestToolHandler(t, func(ctx context.Context, input json.RawMessage) (any, error) {
+		calls.Add(1)
+		return map[string]any{}, nil
+	})
+	handler.admission = newAdmissionController(limiter, newToolStatsRegistry(), 10*time.Second)
+
+	start := time.Now()
+	result, err := handler.Handle(context.Background(), newTestCallToolRequest("saturated_tool", `{}`))
+	if err != nil {
+		t.Fatalf("Handle() returned protocol error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("rejection took %v, expected it to be immediate", elapsed)
+	}
+	if !result.IsError {
+		t.Fatal("expected a BUSY error result")
+	}
+	if calls.Load() != 0 {
+		t.Errorf("handler function was called %d times, expected 0", calls.Load())
+	}
+
+	var payload struct {
+		Error ToolError `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(resultText(t, result)), &payload); err != nil {
+		t.Fatalf("failed to unmarshal error payload: %v", err)
+	}
+	if payload.Error.Code != ErrCodeBusy {
+		t.Errorf("error code = %q, want %q", payload.Error.Code, ErrCodeBusy)
+	}
+	if !payload.Error.Retryable {
+		t.Error("BUSY errors should be retryable")
+	}
+	// The limiter delay is just under an hour, so the retry hint should be close to that
+	if payload.Error.RetryAfterSeconds < 3500 || payload.Error.RetryAfterSeconds > 3600 {
+		t.Errorf("retryAfterSeconds = %d, want ~3600", payload.Error.RetryAfterSeconds)
+	}
+	if !strings.Contains(payload.Error.Message, "busy") {
+		t.Errorf("message %q should explain that the server is busy", payload.Error.Message)
+	}
+	retryAt, err := time.Parse(time.RFC3339, fmt.Sprint(payload.Error.Details["retryAt"]))
+	if err != nil || time.Until(retryAt) > time.Hour+time.Second || !strings.Contains(payload.Error.Message, "retry after "+retryAt.Format(time.RFC3339)) {
+		t.Errorf("BUSY error = %+v, want a retry time within the hour named in the message", payload.Error)
+	}
+	if handler.admission.queueDepth.Load() != 0 {
+		t.Errorf("rejected call should not be counted in the queue depth, got %d", handler.admission.queueDepth.Load())
+	}
+}
+
+func TestAdmissionAcceptsAndReleases(t *testing.T) {
+	limiter := rate.NewLimiter(rate.Every(time.Second), 1)
+	ac := newAdmissionController(limiter, newToolStatsRegistry(), 10*time.Second)
+
+	handler := newTestToolHandler(t, func(ctx context.Context, input json.RawMessage) (any, error) {
+		if depth := ac.queueDepth.Load(); depth != 1 {
+			t.Errorf("queue depth during call = %d, want 1", depth)
+		}
+		return map[string]any{"ok": true}, nil
+	})
+	handler.admission = ac
+
+	result, err := handler.Handle(context.Background(), newTestCallToolRequest("idle_tool", `{}`))
+	if err != nil {
+		t.Fatalf("Handle() returned protocol error: %v", err)
+	}
+	if result.IsError {
+		t.Fatalf("unexpected error result: %s", resultText(t, result))
+	}
+	if depth := ac.queueDepth.Load(); depth != 0 {
+		t.Errorf("queue depth after call = %d, want 0", depth)
+	}
+}
+
+func TestAdmissionDisabled(t *testing.T) {
+	limiter := rate.NewLimiter(rate.Every(time.Hour), 1)
+	limiter.Allow()
+	ac := newAdmissionController(limiter, newToolStatsRegistry(), 0)
+
+	release, busyErr := ac.admit("tool")
+	if busyErr != nil {
+		t.Fatalf("admission with zero max wait should never reject, got %v", busyErr)
+	}
+	release()
+	// Releasing twice must not corrupt the queue depth
+	release()
+	if depth := ac.queueDepth.Load(); depth != 0 {
+		t.Errorf("queue depth after double release = %d, want 0", depth)
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"opus-mcp/internal/parser"
+)
+
+// ArxivAdvancedQueryArgs defines the input parameters of queries combining expressions searched in
+// different fields
+type ArxivAdvancedQueryArgs struct {
+	Category      string `json:"category,omitempty" jsonschema:"Boolean expression of arXiv category codes, e.g., 'cs.LG OR stat.ML'"`
+	Author        string `json:"author,omitempty" jsonschema:"Boolean expression of author names searched in the author field, e.g., 'hinton OR bengio'"`
+	Title         string `json:"title,omitempty" jsonschema:"Boolean expression of words and double-quoted phrases searched in titles"`
+	Abstract      string `json:"abstract,omitempty" jsonschema:"Boolean expression of words and double-quoted phrases searched in abstracts"`
+	Join          string `json:"join,omitempty" jsonschema:"How the expressions are combined: AND or OR. Defaults to AND. Expressions that only exclude, e.g., '-survey', are always subtracted with ANDNOT"`
+	StartIndex    uint   `json:"startIndex,omitempty" jsonschema:"The starting index of results to fetch (0-based)"`
+	FetchSize     uint   `json:"fetchSize,omitempty" jsonschema:"The number of results to fetch. Defaults to 10"`
+	SortBy        string `json:"sortBy,omitempty" jsonschema:"How arXiv orders the results: submittedDate, lastUpdatedDate or relevance. Defaults to submittedDate"`
+	SortOrder     string `json:"sortOrder,omitempty" jsonschema:"The direction of sortBy: ascending or descending. Defaults to descending"`
+	Raw           bool   `json:"raw,omitempty" jsonschema:"Return the feed as parsed, with the feed's metadata and every entry's RSS, iTunes and Dublin Core fields and extensions, instead of flattened entries. Defaults to false"`
+	Fields        string `json:"fields,omitempty" jsonschema:"How much of every result to return: full or headline, only the identifier, title, primary category and announcement date. Defaults to full"`
+	StrictParse   bool   `json:"strictParse,omitempty" jsonschema:"Fail on any XML error in the arXiv feed instead of removing invalid characters and escaping bare ampersands before parsing. Defaults to false"`
+	NormalizeText *bool  `json:"normalizeText,omitempty" jsonschema:"Return the titles and abstracts of flattened results as plain text, with the feed's line breaks, HTML entities and LaTeX markup resolved, instead of as arXiv sent them. Defaults to true"`
+}
+
+// advancedQueryExpression is one of the expressions of an advanced query and the arXiv search
+// field its terms are searched in
+type advancedQueryExpression struct {
+	argument   string
+	field      string
+	expression string
+}
+
+// expressions returns the expressions of an advanced query in the order they are combined,
+// leaving out the empty ones
+func (args ArxivAdvancedQueryArgs) expressions() []advancedQueryExpression {
+	var expressions []advancedQueryExpression
+	for _, e := range []advancedQueryExpression{
+		{"category", "cat", args.Category},
+		{"author", "au", args.Author},
+		{"title", "ti", args.Title},
+		{"abstract", "abs", args.Abstract},
+	} {
+		if e.expression = strings.TrimSpace(e.expression); e.expression != "" {
+			expressions = append(expressions, e)
+		}
+	}
+	return expressions
+}
+
+// advancedQueryArguments are the arguments holding the expressions of an advanced query
+var advancedQueryArguments = []string{"category", "author", "title", "abstract"}
+
+// advancedQueryIssues rejects queries without an expression that matches articles, which arXiv
+// cannot search: no expression at all, or only expressions that exclude
+func advancedQueryIssues(args ArxivAdvancedQueryArgs) []ValidationIssue {
+	expressions := args.expressions()
+	if len(expressions) == 0 {
+		return []ValidationIssue{{
+			Fields:  advancedQueryArguments,
+			Message: "category, author, title and abstract are all empty; give at least one expression to search for",
+		}}
+	}
+	var excluding []string
+	for _, e := range expressions {
+		if _, excludes, err := parser.ExcludedExpression(e.expression); err != nil || !excludes {
+			return nil
+		}
+		excluding = append(excluding, e.argument)
+	}
+	verb := "exclude"
+	if len(excluding) == 1 {
+		verb = "excludes"
+	}
+	return []ValidationIssue{{
+		Fields:  excluding,
+		Message: fmt.Sprintf("%s only %s articles, e.g., -survey; give at least one expression that matches the articles to exclude them from", joinFields(excluding), verb),
+	}}
+}
+
+// parseAdvancedExpression parses an expression of an advanced query. Category expressions go
+// through the mixed expression parser, which recognizes category codes, and may hold nothing else.
+func parseAdvancedExpression(e advancedQueryExpression, expression string) (*parser.Interpretation, error) {
+	if e.field != "cat" {
+		return parser.ParseFieldExpression(expression, e.field)
+	}
+	interpretation, err := parser.ParseMixedExpression(expression, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, term := range interpretation.Terms {
+		if term.Kind != parser.TermCategory && (term.Kind != parser.TermField || !strings.HasPrefix(term.Token, "cat:")) {
+			return nil, fmt.Errorf("%q is not an arXiv category code", term.Token)
+		}
+	}
+	return interpretation, nil
+}
+
+// composeAdvancedQuery turns the expressions of an advanced query into a single arXiv search
+// query: the parenthesised expressions joined with join, followed by ANDNOT and every expression
+// that only excludes, e.g., (cat:cs.LG+OR+cat:stat.ML)+AND+(au:hinton)+ANDNOT+(ti:survey)
+func composeAdvancedQuery(args ArxivAdvancedQueryArgs) (*parser.Interpretation, error) {
+	join := cmp.Or(args.Join, parser.JoinAnd)
+	if join != parser.JoinAnd && join != parser.JoinOr {
+		return nil, fmt.Errorf("invalid join %q, valid values are %s and %s", args.Join, parser.JoinAnd, parser.JoinOr)
+	}
+	var included, excluded []string
+	combined := &parser.Interpretation{}
+	for _, e := range args.expressions() {
+		expression, excludes, err := parser.ExcludedExpression(e.expression)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s expression: %w", e.argument, err)
+		}
+		interpretation, err := parseAdvancedExpression(e, expression)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s expression: %w", e.argument, err)
+		}
+		if excludes {
+			excluded = append(excluded, interpretation.Query)
+		} else {
+			included = append(included, interpretation.Query)
+		}
+		combined.Terms = append(combined.Terms, interpretation.Terms...)
+		combined.Taxonomy = cmp.Or(combined.Taxonomy, interpretation.Taxonomy)
+	}
+	if len(included) == 0 {
+		return nil, errors.New("the query has no expression that matches articles")
+	}
+	query := strings.Join(included, "+"+join+"+")
+	if len(included) > 1 && len(excluded) > 0 {
+		query = "(" + query + ")"
+	}
+	for _, exclusion := range excluded {
+		query += "+ANDNOT+" + exclusion
+	}
+	combined.Query = query
+	return combined, nil
+}
+
+// arxivAdvancedQuery handles searching arXiv for articles matching expressions in several fields
+// at once, e.g., the latest articles in some categories by an author. Like arxivSearch, it does NOT
+// retry on errors and waits for the arXiv rate limiter.
+func arxivAdvancedQuery(ctx context.Context, input json.RawMessage) (any, error) {
+	var args ArxivAdvancedQueryArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+	interpretation, err := composeAdvancedQuery(args)
+	if err != nil {
+		return nil, err
+	}
+	page := searchPage{
+		StartIndex:    args.StartIndex,
+		FetchSize:     args.FetchSize,
+		SortBy:        cmp.Or(args.SortBy, sortBySubmittedDate),
+		SortOrder:     args.SortOrder,
+		Raw:           args.Raw,
+		Fields:        args.Fields,
+		StrictParse:   args.StrictParse,
+		NormalizeText: args.NormalizeText,
+	}
+	return searchArxiv(ctx, interpretation, page, "join", cmp.Or(args.Join, parser.JoinAnd))
+}
+
+// describeAdvancedQuery describes an advanced query as its expressions and the articles it returned
+func describeAdvancedQuery(input json.RawMessage, output any) *recentQuery {
+	var args ArxivAdvancedQueryArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil
+	}
+	var parts []string
+	for _, e := range args.expressions() {
+		parts = append(parts, e.argument+": "+e.expression)
+	}
+	return &recentQuery{Query: strings.Join(parts, "; "), ArticleIDs: resultArticleIDs(output)}
+}
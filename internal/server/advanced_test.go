@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestComposeAdvancedQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      ArxivAdvancedQueryArgs
+		want      string
+		wantError string
+	}{
+		{
+			name: "Categories and an author",
+			args: ArxivAdvancedQueryArgs{Category: "cs.LG OR stat.ML", Author: "hinton"},
+			want: "(cat:cs.LG+OR+cat:stat.ML)+AND+(au:hinton)",
+		},
+		{
+			name: "Single expression",
+			args: ArxivAdvancedQueryArgs{Title: "transformer attention"},
+			want: "(ti:transformer+AND+ti:attention)",
+		},
+		{
+			name: "Empty expressions omitted",
+			args: ArxivAdvancedQueryArgs{Category: "  ", Author: "", Title: "diffusion", Abstract: "\"score matching\""},
+			want: "(ti:diffusion)+AND+(abs:%22score+matching%22)",
+		},
+		{
+			name: "Joined with OR",
+			args: ArxivAdvancedQueryArgs{Title: "diffusion", Abstract: "diffusion", Join: "OR"},
+			want: "(ti:diffusion)+OR+(abs:diffusion)",
+		},
+		{
+			name: "Excluding expression subtracted with ANDNOT",
+			args: ArxivAdvancedQueryArgs{Category: "cs.CL", Title: "-survey -review"},
+			want: "(cat:cs.CL)+ANDNOT+(ti:survey+OR+ti:review)",
+		},
+		{
+			name: "Joined expressions parenthesised before ANDNOT",
+			args: ArxivAdvancedQueryArgs{Category: "-cs.CV", Title: "diffusion", Abstract: "diffusion", Join: "OR"},
+			want: "((ti:diffusion)+OR+(abs:diffusion))+ANDNOT+(cat:cs.CV)",
+		},
+		{
+			name: "Partly negated expression is included",
+			args: ArxivAdvancedQueryArgs{Category: "cs.LG", Abstract: "transformer -survey"},
+			want: "(cat:cs.LG)+AND+(abs:transformer+NOT+abs:survey)",
+		},
+		{
+			name:      "Keyword in category expression",
+			args:      ArxivAdvancedQueryArgs{Category: "cs.LG AND attention"},
+			wantError: `failed to parse category expression: "attention" is not an arXiv category code`,
+		},
+		{
+			name:      "Unterminated phrase",
+			args:      ArxivAdvancedQueryArgs{Abstract: "\"self attention"},
+			wantError: "failed to parse abstract expression",
+		},
+		{
+			name:      "Invalid join",
+			args:      ArxivAdvancedQueryArgs{Title: "diffusion", Join: "XOR"},
+			wantError: `invalid join "XOR"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interpretation, err := composeAdvancedQuery(tt.args)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Errorf("composeAdvancedQuery() error = %v, want error containing %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("composeAdvancedQuery() unexpected error: %v", err)
+			}
+			if interpretation.Query != tt.want {
+				t.Errorf("composeAdvancedQuery() = %q, want %q", interpretation.Query, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdvancedQueryTool(t *testing.T) {
+	var queries []string
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		_, _ = w.Write([]byte(idListFeed([]string{"2410.01234"})))
+	})
+	_, handler, err := newAdvancedQueryTool()
+	if err != nil {
+		t.Fatalf("newAdvancedQueryTool() unexpected error: %v", err)
+	}
+
+	result := handler.handle(context.Background(), newTestCallToolRequest("arxiv_advanced_query", `{"category": "cs.LG OR stat.ML", "author": "hinton", "fetchSize": 5}`))
+	if text := resultText(t, result); result.IsError {
+		t.Fatalf("handle() unexpected error: %s", text)
+	}
+	want := "search_query=(cat:cs.LG+OR+cat:stat.ML)+AND+(au:hinton)&start=0&max_results=5&sortBy=submittedDate&sortOrder=descending"
+	if len(queries) != 1 || queries[0] != want {
+		t.Errorf("queried %q, want %q", queries, want)
+	}
+
+	for input, want := range map[string]string{
+		`{}`:                              "category, author, title and abstract are all empty",
+		`{"author": " ", "fetchSize": 5}`: "category, author, title and abstract are all empty",
+		`{"title": "-survey"}`:            "title only excludes articles",
+		`{"category": "-cs.CV", "title": "-survey"}`: "category and title only exclude articles",
+	} {
+		queries = nil
+		result := handler.handle(context.Background(), newTestCallToolRequest("arxiv_advanced_query", input))
+		if text := resultText(t, result); !result.IsError || !strings.Contains(text, ErrCodeInvalidInput) || !strings.Contains(text, want) {
+			t.Errorf("handle(%s) = %s, want %s containing %q", input, text, ErrCodeInvalidInput, want)
+		}
+		if len(queries) != 0 {
+			t.Errorf("handle(%s) queried %q, want no API request", input, queries)
+		}
+	}
+}
+
+func TestDescribeAdvancedQuery(t *testing.T) {
+	query := describeAdvancedQuery(json.RawMessage(`{"category": "cs.LG", "title": " ", "abstract": "attention"}`), nil)
+	if query == nil || query.Query != "category: cs.LG; abstract: attention" {
+		t.Errorf("describeAdvancedQuery() = %+v, want the non-empty expressions", query)
+	}
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"opus-mcp/internal/calendar"
+	"opus-mcp/internal/settings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// CalendarConfig holds the announcement calendar configuration loaded from environment variables
+type CalendarConfig struct {
+	// Holidays are the ISO dates of announcement evenings that arXiv skips, e.g., 2025-12-25
+	Holidays []string `env:"OPUS_MCP_ARXIV_HOLIDAYS"`
+}
+
+// announcementCalendar maps announcement dates to submission windows for the announcedOn, weekOf
+// and monthOf inputs
+var announcementCalendar, _ = calendar.New(nil)
+
+// LoadCalendar loads the announcement calendar from environment variables
+func LoadCalendar() (*calendar.Calendar, error) {
+	var config CalendarConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process calendar configuration from environment", "error", err)
+		return nil, err
+	}
+	return calendar.New(config.Holidays)
+}
+
+// noAnnouncementFeed is the empty result for a day without an announcement, pointing to the next one
+func noAnnouncementFeed(day time.Time) *gofeed.Feed {
+	date := day.Format(calendar.DateLayout)
+	feed := &gofeed.Feed{
+		Title:  "No arXiv announcement on " + date,
+		Items:  []*gofeed.Item{},
+		Custom: map[string]string{"announcedOn": date},
+	}
+	if next, ok := announcementCalendar.NextAnnouncement(day); ok {
+		nextDate := next.Format(calendar.DateLayout)
+		feed.Description = fmt.Sprintf("arXiv does not announce new papers on %s (%s). The next announcement is on %s.", date, day.Weekday(), nextDate)
+		feed.Custom["nextAnnouncement"] = nextDate
+	} else {
+		feed.Description = fmt.Sprintf("arXiv does not announce new papers on %s (%s).", date, day.Weekday())
+	}
+	return feed
+}
+
+// noAnnouncementPeriodFeed is the empty result for a week or month without any announcement
+func noAnnouncementPeriodFeed(input, value string) *gofeed.Feed {
+	return &gofeed.Feed{
+		Title:       fmt.Sprintf("No arXiv announcements for %s %s", input, value),
+		Description: fmt.Sprintf("arXiv made no announcements for %s %s, which only covers holidays.", input, value),
+		Items:       []*gofeed.Item{},
+		Custom:      map[string]string{input: value},
+	}
+}
+
+// dateRestriction is the submission window that the date inputs of a category fetch restrict it to
+type dateRestriction struct {
+	// query is the arXiv API search clause selecting submissions in the window
+	query string
+	// tags name the date input and the window boundaries used, for the custom fields of the result
+	tags map[string]string
+	// empty, when set, is the whole result, since no announcement was made on the requested dates
+	empty *gofeed.Feed
+}
+
+// resolveDateRestriction derives the submission window of the announcedOn, weekOf or monthOf input
+// of a category fetch, of which at most one may be set. It returns nil without any of them.
+func resolveDateRestriction(args ArxivCategoryFetchLatestArgs) (*dateRestriction, error) {
+	if issues := categoryFetchIssues(args); len(issues) > 0 {
+		return nil, invalidInputError(issues)
+	}
+
+	switch {
+	case args.AnnouncedOn != "":
+		day, err := calendar.ParseDate(args.AnnouncedOn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid announcedOn: %w", err)
+		}
+		window, ok := announcementCalendar.Window(day)
+		if !ok {
+			return &dateRestriction{empty: noAnnouncementFeed(day)}, nil
+		}
+		slog.Info("Restricting category fetch to announcement window", "announced_on", window.AnnouncedOn, "start", window.Start, "end", window.End)
+		return &dateRestriction{
+			query: window.SubmittedDateQuery(),
+			tags:  windowTags(window.Start, window.End, "announcedOn", args.AnnouncedOn),
+		}, nil
+	case args.WeekOf != "":
+		day, err := calendar.ParseDate(args.WeekOf)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weekOf: %w", err)
+		}
+		period, ok := announcementCalendar.Week(day)
+		return periodRestriction("weekOf", args.WeekOf, period, ok), nil
+	case args.MonthOf != "":
+		month, err := calendar.ParseMonth(args.MonthOf)
+		if err != nil {
+			return nil, fmt.Errorf("invalid monthOf: %w", err)
+		}
+		period, ok := announcementCalendar.Month(month)
+		return periodRestriction("monthOf", args.MonthOf, period, ok), nil
+	}
+	return nil, nil
+}
+
+// periodRestriction restricts a category fetch to the submission window of the announcements of a
+// week or month
+func periodRestriction(input, value string, period calendar.Period, ok bool) *dateRestriction {
+	if !ok {
+		return &dateRestriction{empty: noAnnouncementPeriodFeed(input, value)}
+	}
+	slog.Info("Restricting category fetch to announcement period", input, value,
+		"first_announcement", period.FirstAnnouncement, "last_announcement", period.LastAnnouncement,
+		"start", period.Start, "end", period.End)
+	tags := windowTags(period.Start, period.End, input, value)
+	tags["firstAnnouncement"] = period.FirstAnnouncement
+	tags["lastAnnouncement"] = period.LastAnnouncement
+	return &dateRestriction{query: period.SubmittedDateQuery(), tags: tags}
+}
+
+// windowTags names a date input and the boundaries of the submission window it was resolved to
+func windowTags(start, end time.Time, input, value string) map[string]string {
+	return map[string]string{
+		input:         value,
+		"windowStart": start.Format(time.RFC3339),
+		"windowEnd":   end.Format(time.RFC3339),
+	}
+}
+
+// apply makes a date-restricted result reproducible: entries are sorted by submission time, newest
+// first, then by identifier, and repeated entries of the same article version are dropped, so that
+// the same window returns the same listing whenever it is fetched, up to withdrawals. The result is
+// tagged with the window used.
+func (r *dateRestriction) apply(result *CategoryFetchResult) {
+	slices.SortStableFunc(result.Items, func(a, b *FeedEntry) int {
+		if c := entrySubmitted(b).Compare(entrySubmitted(a)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ArticleID, b.ArticleID)
+	})
+
+	seen := make(map[string]bool, len(result.Items))
+	items := result.Items[:0]
+	for _, entry := range result.Items {
+		key := entryKey(entry)
+		if key != "" && seen[key] {
+			if len(entry.Errors) > 0 {
+				result.Warnings--
+			}
+			slog.Info("Dropping duplicate entry from date-restricted category fetch", "entry", key)
+			continue
+		}
+		seen[key] = true
+		items = append(items, entry)
+	}
+	result.Items = items
+
+	if result.Feed != nil {
+		if result.Custom == nil {
+			result.Custom = make(map[string]string, len(r.tags))
+		}
+		for name, value := range r.tags {
+			result.Custom[name] = value
+		}
+	}
+}
+
+// entrySubmitted returns when an entry was first submitted, or the zero time if unknown
+func entrySubmitted(entry *FeedEntry) time.Time {
+	if entry.Item != nil && entry.PublishedParsed != nil {
+		return *entry.PublishedParsed
+	}
+	return time.Time{}
+}
+
+// entryKey identifies the article version of an entry, falling back to its link. Different
+// versions of an article are distinct entries, which only collapseRevisions merges.
+func entryKey(entry *FeedEntry) string {
+	if entry.ArticleID != "" {
+		return entry.ArticleID
+	}
+	if entry.Item != nil {
+		return entry.Link
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/textutil"
+)
+
+// ErrCodeArticleNotFound means arXiv has no article with the requested identifier
+const ErrCodeArticleNotFound = "ARTICLE_NOT_FOUND"
+
+// ArxivGetArticleArgs defines the input parameters for fetching the metadata of a single article
+type ArxivGetArticleArgs struct {
+	ID            string `json:"id" jsonschema:"The arXiv identifier of the article, e.g., 2301.00001, 2301.00001v2 or hep-th/9901001, or its abs or pdf URL, e.g., https://arxiv.org/abs/2301.00001. Without a version, the latest version is described"`
+	NormalizeText *bool  `json:"normalizeText,omitempty" jsonschema:"Return the title and abstract as plain text, with the feed's line breaks, HTML entities and LaTeX markup resolved, instead of as arXiv sent them. Defaults to true"`
+}
+
+// ArticleLinks are the pages of an article on arXiv
+type ArticleLinks struct {
+	Abs string `json:"abs" jsonschema:"The URL of the abs page of the version described"`
+	PDF string `json:"pdf" jsonschema:"The URL of the PDF of the version described"`
+}
+
+// ArticleRecord is the metadata of a single article from the arXiv API, with the arxiv: extension
+// elements of its feed entry flattened into named fields
+type ArticleRecord struct {
+	ArticleID       string       `json:"articleId" jsonschema:"The versioned arXiv identifier of the version described"`
+	Title           string       `json:"title" jsonschema:"The title of the article"`
+	Authors         []string     `json:"authors" jsonschema:"The names of the authors, in order"`
+	Abstract        string       `json:"abstract" jsonschema:"The abstract of the article"`
+	PrimaryCategory string       `json:"primaryCategory,omitempty" jsonschema:"The arXiv category the article was submitted to"`
+	Categories      []string     `json:"categories" jsonschema:"All categories of the article, the primary category first"`
+	DOI             string       `json:"doi,omitempty" jsonschema:"The DOI of the published article, when the authors gave one"`
+	JournalRef      string       `json:"journalRef,omitempty" jsonschema:"The journal reference, when the article has been published"`
+	Comment         string       `json:"comment,omitempty" jsonschema:"The authors' comment, e.g., the number of pages and figures"`
+	Published       string       `json:"published,omitempty" jsonschema:"When the first version was submitted, as an RFC 3339 time in UTC"`
+	Updated         string       `json:"updated,omitempty" jsonschema:"When the version described was submitted, as an RFC 3339 time in UTC"`
+	Links           ArticleLinks `json:"links" jsonschema:"The abs page and PDF of the version described"`
+	Warnings        []string     `json:"warnings,omitempty" jsonschema:"Problems found in the arXiv record; the record is returned as far as it could be read"`
+}
+
+// getArticleIssues rejects an identifier that cannot be parsed, which could not query arXiv at all
+func getArticleIssues(args ArxivGetArticleArgs) []ValidationIssue {
+	if _, err := arxivid.Parse(args.ID); err != nil {
+		return []ValidationIssue{{
+			Fields:  []string{"id"},
+			Message: fmt.Sprintf("id %q is not an arXiv identifier or abs/pdf URL (%v); expected, e.g., 2301.00001, 2301.00001v2 or https://arxiv.org/abs/2301.00001", args.ID, err),
+		}}
+	}
+	return nil
+}
+
+// getArticle handles fetching the metadata of a single article from the arXiv API by id_list
+func getArticle(ctx context.Context, input json.RawMessage) (any, error) {
+	var args ArxivGetArticleArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+	id, err := arxivid.Parse(args.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid arXiv identifier: %w", err)
+	}
+	result, err := fetchIDList(ctx, []string{id.Canonical()}, 1, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 {
+		if resolution := result.Resolutions[0]; resolution.Error != "" {
+			return nil, fmt.Errorf("failed to fetch %s from the arXiv API: %s", id.Canonical(), resolution.Error)
+		}
+		return nil, &ToolError{
+			Code:    ErrCodeArticleNotFound,
+			Message: fmt.Sprintf("arXiv has no article %s", id.Canonical()),
+			Details: map[string]any{"id": args.ID, "articleId": id.Canonical()},
+		}
+	}
+	return articleRecord(result.Items[0], id, normalizeText(args.NormalizeText)), nil
+}
+
+// articleRecord flattens the feed entry of an article into its record, with its title and abstract
+// normalized into plain text if asked. The links are built from the identifier arXiv returned, or
+// the requested one if arXiv's could not be parsed.
+func articleRecord(entry *FeedEntry, requested arxivid.ID, normalize bool) *ArticleRecord {
+	record := &ArticleRecord{
+		ArticleID:       entry.ArticleID,
+		Title:           entry.Title,
+		Authors:         []string{},
+		Abstract:        entry.Description,
+		PrimaryCategory: entry.PrimaryCategory,
+		Categories:      []string{},
+		DOI:             arxivExtension(entry, "doi"),
+		JournalRef:      arxivExtension(entry, "journal_ref"),
+		Comment:         arxivExtension(entry, "comment"),
+		Published:       utcTimestamp(entry.PublishedParsed),
+		Updated:         utcTimestamp(entry.UpdatedParsed),
+		Warnings:        entry.Errors,
+	}
+	if normalize {
+		record.Title, record.Abstract = textutil.Normalize(record.Title), textutil.Normalize(record.Abstract)
+	}
+	for _, author := range entry.Authors {
+		if author != nil {
+			record.Authors = append(record.Authors, textutil.CollapseSpace(author.Name))
+		}
+	}
+	// The primary category comes first, followed by the cross-lists in arXiv's order
+	if record.PrimaryCategory != "" {
+		record.Categories = append(record.Categories, record.PrimaryCategory)
+	}
+	for _, category := range entry.Categories {
+		if category = strings.TrimSpace(category); category != "" && !slices.Contains(record.Categories, category) {
+			record.Categories = append(record.Categories, category)
+		}
+	}
+
+	id := requested
+	if returned, err := arxivid.Parse(entry.ArticleID); err == nil {
+		id = returned
+	}
+	record.Links = ArticleLinks{Abs: id.AbsURL(arxivAbsBaseURL), PDF: id.PDFURL(arxivPDFBaseURL)}
+	return record
+}
+
+// utcTimestamp formats a parsed feed time as RFC 3339 in UTC, or returns "" if there is none
+func utcTimestamp(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// articleFeed is an id_list answer of arXiv for a published article
+const articleFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:arxiv="http://arxiv.org/schemas/atom">
+  <entry>
+    <id>http://arxiv.org/abs/2301.00001v2</id>
+    <updated>2023-02-10T09:30:00Z</updated>
+    <published>2023-01-02T18:00:00Z</published>
+    <title>A Study of
+      Everything</title>
+    <summary>  We study everything.
+    </summary>
+    <author><name>A. Researcher</name></author>
+    <author><name>B. Scientist</name></author>
+    <arxiv:doi>10.1000/xyz123</arxiv:doi>
+    <arxiv:comment>12 pages, 3 figures</arxiv:comment>
+    <arxiv:journal_ref>J. Everything 1 (2023) 1-12</arxiv:journal_ref>
+    <link href="http://arxiv.org/abs/2301.00001v2" rel="alternate" type="text/html"/>
+    <link title="pdf" href="http://arxiv.org/pdf/2301.00001v2" rel="related" type="application/pdf"/>
+    <arxiv:primary_category term="cs.LG" scheme="http://arxiv.org/schemas/atom"/>
+    <category term="stat.ML" scheme="http://arxiv.org/schemas/atom"/>
+    <category term="cs.LG" scheme="http://arxiv.org/schemas/atom"/>
+  </entry>
+</feed>`
+
+func TestGetArticle(t *testing.T) {
+	var idLists []string
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		idLists = append(idLists, r.URL.Query().Get("id_list"))
+		_, _ = w.Write([]byte(articleFeed))
+	})
+
+	output, err := getArticle(context.Background(), json.RawMessage(`{"id": "https://arxiv.org/abs/2301.00001"}`))
+	if err != nil {
+		t.Fatalf("getArticle() unexpected error: %v", err)
+	}
+	if !slices.Equal(idLists, []string{"2301.00001"}) {
+		t.Errorf("queried id_list %q, want the identifier from the URL", idLists)
+	}
+	record := output.(*ArticleRecord)
+	want := ArticleRecord{
+		ArticleID:       "2301.00001v2",
+		Title:           "A Study of Everything",
+		Abstract:        "We study everything.",
+		PrimaryCategory: "cs.LG",
+		DOI:             "10.1000/xyz123",
+		JournalRef:      "J. Everything 1 (2023) 1-12",
+		Comment:         "12 pages, 3 figures",
+		Published:       "2023-01-02T18:00:00Z",
+		Updated:         "2023-02-10T09:30:00Z",
+		Links:           ArticleLinks{Abs: "https://arxiv.org/abs/2301.00001v2", PDF: "https://arxiv.org/pdf/2301.00001v2"},
+	}
+	got := *record
+	got.Authors, got.Categories, got.Warnings = nil, nil, nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getArticle() = %+v, want %+v", got, want)
+	}
+	if !slices.Equal(record.Authors, []string{"A. Researcher", "B. Scientist"}) {
+		t.Errorf("authors = %q, want both authors in order", record.Authors)
+	}
+	if !slices.Equal(record.Categories, []string{"cs.LG", "stat.ML"}) {
+		t.Errorf("categories = %q, want the primary category first", record.Categories)
+	}
+}
+
+func TestGetArticleNotFound(t *testing.T) {
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(idListFeed(nil)))
+	})
+	_, err := getArticle(context.Background(), json.RawMessage(`{"id": "2301.99999"}`))
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeArticleNotFound {
+		t.Errorf("getArticle() error = %v, want %s", err, ErrCodeArticleNotFound)
+	}
+}
+
+func TestGetArticleRejectsInvalidID(t *testing.T) {
+	_, handler, err := newGetArticleTool()
+	if err != nil {
+		t.Fatalf("newGetArticleTool() unexpected error: %v", err)
+	}
+	handler.handlerFunc = func(ctx context.Context, input json.RawMessage) (any, error) {
+		t.Error("the handler should not run for an invalid identifier")
+		return nil, nil
+	}
+	result := handler.handle(context.Background(), newTestCallToolRequest("arxiv_get_article", `{"id": "not an id"}`))
+	if !result.IsError {
+		t.Errorf("handle() = %s, want an invalid input error", resultText(t, result))
+	}
+}
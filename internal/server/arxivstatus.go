@@ -0,0 +1,62 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxStatusErrorSnippet bounds how much of the body of an arXiv error response is quoted in errors
+const maxStatusErrorSnippet = 200
+
+// arxivStatusError is an arXiv API response other than 200 OK, e.g., the maintenance page arXiv
+// serves with 503 Service Unavailable
+type arxivStatusError struct {
+	StatusCode int
+	// Snippet is the start of the body, with its whitespace collapsed
+	Snippet string
+}
+
+func (e *arxivStatusError) Error() string {
+	message := fmt.Sprintf("arXiv returned HTTP %d", e.StatusCode)
+	if e.Snippet != "" {
+		message += ": " + e.Snippet
+	}
+	return message
+}
+
+// transient reports whether the same request may succeed later: arXiv was overloaded, down for
+// maintenance or failing on its side
+func (e *arxivStatusError) transient() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// checkArxivStatus returns an error for an arXiv API response other than 200 OK, quoting the start of
+// its body, or nil. Responses asking to back off are reported by the cooldown before, with the wait
+// arXiv asked for; this reads the body of other responses, so it is called before the feed is read.
+func checkArxivStatus(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	statusErr := &arxivStatusError{StatusCode: resp.StatusCode}
+	// Read a little more than quoted, to tell whether the snippet is cut short
+	head, _ := io.ReadAll(io.LimitReader(resp.Body, 4*maxStatusErrorSnippet))
+	statusErr.Snippet = bodySnippet(string(head))
+	return statusErr
+}
+
+// bodySnippet collapses the whitespace of the start of a response body and cuts it to at most
+// maxStatusErrorSnippet bytes, on a character boundary
+func bodySnippet(body string) string {
+	snippet := strings.Join(strings.Fields(strings.ToValidUTF8(body, "")), " ")
+	if len(snippet) <= maxStatusErrorSnippet {
+		return snippet
+	}
+	cut := maxStatusErrorSnippet
+	for cut > 0 && !utf8.RuneStart(snippet[cut]) {
+		cut--
+	}
+	return snippet[:cut] + "…"
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCategoryFetchLatestHTTPStatus checks that arXiv responses other than 200 OK are reported with
+// their status and the start of their body rather than as feeds that fail to parse
+func TestCategoryFetchLatestHTTPStatus(t *testing.T) {
+	clock := &testClock{now: time.Date(2026, 2, 3, 14, 0, 0, 0, time.UTC)}
+	withCooldown(t, clock.Now)
+	var status int
+	var header http.Header
+	body := ""
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		for name, values := range header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	})
+	fetch := func() *ToolError {
+		t.Helper()
+		_, err := categoryFetchLatest(context.Background(), json.RawMessage(`{"category":"cs.AI"}`))
+		if err == nil {
+			t.Fatalf("categoryFetchLatest() answered with HTTP %d succeeded, want an error", status)
+		}
+		var toolErr *ToolError
+		if !errors.As(err, &toolErr) {
+			toolErr = executionToolError(err)
+		}
+		return toolErr
+	}
+
+	t.Run("maintenance page", func(t *testing.T) {
+		status, header = http.StatusServiceUnavailable, nil
+		body = "<html>\n  <body>\n    <h1>arXiv is down for maintenance</h1>\n  </body>\n</html>"
+		toolErr := fetch()
+		if want := "arXiv returned HTTP 503: <html> <body> <h1>arXiv is down for maintenance</h1> </body> </html>"; toolErr.Message != want {
+			t.Errorf("error message = %q, want %q", toolErr.Message, want)
+		}
+		if toolErr.Code != ErrCodeExecutionFailed || !toolErr.Retryable {
+			t.Errorf("error = %+v, want a retryable %s", toolErr, ErrCodeExecutionFailed)
+		}
+	})
+
+	t.Run("client error with a long body", func(t *testing.T) {
+		status, header = http.StatusBadRequest, nil
+		body = strings.Repeat("é", 300)
+		toolErr := fetch()
+		if want := "arXiv returned HTTP 400: " + strings.Repeat("é", maxStatusErrorSnippet/2) + "…"; toolErr.Message != want {
+			t.Errorf("error message = %q, want the body cut at %d bytes", toolErr.Message, maxStatusErrorSnippet)
+		}
+		if toolErr.Retryable {
+			t.Errorf("error = %+v, want a client error not to be retryable", toolErr)
+		}
+	})
+
+	t.Run("unavailable with Retry-After", func(t *testing.T) {
+		status, header, body = http.StatusServiceUnavailable, http.Header{"Retry-After": {"300"}}, "down"
+		toolErr := fetch()
+		if toolErr.Code != ErrCodeRateLimited || toolErr.RetryAfterSeconds != 300 || toolErr.Details["retryAfterHeader"] != "300" {
+			t.Errorf("error = %+v, want %s after the 300 seconds arXiv asked for", toolErr, ErrCodeRateLimited)
+		}
+		if !strings.Contains(toolErr.Message, "HTTP 503 with Retry-After 300") {
+			t.Errorf("error message = %q, want the status and Retry-After", toolErr.Message)
+		}
+		clock.Advance(300 * time.Second)
+	})
+
+	t.Run("too many requests", func(t *testing.T) {
+		status, header, body = http.StatusTooManyRequests, http.Header{"Retry-After": {"Tue, 03 Feb 2026 14:10:00 GMT"}}, ""
+		toolErr := fetch()
+		if toolErr.Code != ErrCodeRateLimited || toolErr.RetryAfterSeconds != 300 {
+			t.Errorf("error = %+v, want %s until the time arXiv asked for", toolErr, ErrCodeRateLimited)
+		}
+	})
+}
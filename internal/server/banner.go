@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+
+	"opus-mcp/internal/metadata"
+	"opus-mcp/internal/settings"
+)
+
+// bannerArt is the startup banner. ASCII art: https://patorjk.com/software/taag/#p=display&f=Pagga&t=OPUS+MCP
+const bannerArt = `
+░█▀█░█▀█░█░█░█▀▀░░░█▄█░█▀▀░█▀█
+░█░█░█▀▀░█░█░▀▀█░░░█░█░█░░░█▀▀
+░▀▀▀░▀░░░▀▀▀░▀▀▀░░░▀░▀░▀▀▀░▀░░
+`
+
+// BannerConfig holds the startup banner configuration loaded from environment variables
+type BannerConfig struct {
+	// Enabled prints the banner; when unset, it is printed only if standard output is a terminal
+	Enabled *bool `env:"OPUS_MCP_BANNER,noinit"`
+}
+
+// LoadBannerConfig loads the startup banner configuration from environment variables
+func LoadBannerConfig() (*BannerConfig, error) {
+	var config BannerConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process banner configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// isTerminal reports whether a file is a terminal. Files that cannot be inspected are assumed not
+// to be, so that supervisors and log collectors only ever get structured output.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// bannerEnabled reports whether the banner is printed: as configured, or else when stdout is a terminal
+func bannerEnabled(config *BannerConfig, stdout *os.File) bool {
+	if config != nil && config.Enabled != nil {
+		return *config.Enabled
+	}
+	return isTerminal(stdout)
+}
+
+// announceStartup logs the build and transport of the starting server and, when enabled, prints
+// the banner to w. The log record is emitted either way, so supervisors can detect startup alike
+// for both transports.
+func announceStartup(w io.Writer, enabled bool, transport, address string) {
+	if enabled {
+		if _, err := fmt.Fprint(w, bannerArt); err != nil {
+			slog.Warn("Failed to print the startup banner", "error", err)
+		}
+	}
+	attrs := []any{
+		"name", metadata.APP_NAME,
+		"build_version", metadata.BuildVersion,
+		"build_time", metadata.BuildTime,
+		"os", runtime.GOOS,
+		"arch", runtime.GOARCH,
+		"transport", transport,
+	}
+	if address != "" {
+		attrs = append(attrs, "address", address)
+	}
+	slog.Info("Starting server", attrs...)
+}
+
+// startupBanner decides whether the banner is printed from the environment
+func startupBanner() bool {
+	config, err := LoadBannerConfig()
+	if err != nil {
+		slog.Warn("Banner configuration not available - printing the banner only on a terminal", "error", err)
+	}
+	return bannerEnabled(config, os.Stdout)
+}
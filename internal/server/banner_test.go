@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestIsTerminalFallsBackToFalse(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatalf("failed to create temporary file: %v", err)
+	}
+	defer file.Close()
+	if isTerminal(file) {
+		t.Error("isTerminal() of a regular file = true, want false")
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+	if isTerminal(writer) {
+		t.Error("isTerminal() of a pipe = true, want false")
+	}
+
+	// A file that cannot be inspected is not a terminal
+	closed, err := os.CreateTemp(t.TempDir(), "closed")
+	if err != nil {
+		t.Fatalf("failed to create temporary file: %v", err)
+	}
+	closed.Close()
+	if isTerminal(closed) {
+		t.Error("isTerminal() of a closed file = true, want false")
+	}
+}
+
+func TestBannerEnabled(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatalf("failed to create temporary file: %v", err)
+	}
+	defer file.Close()
+
+	t.Setenv("OPUS_MCP_BANNER", "")
+	config, err := LoadBannerConfig()
+	if err != nil {
+		t.Fatalf("LoadBannerConfig() unexpected error: %v", err)
+	}
+	if config.Enabled != nil {
+		t.Errorf("Enabled = %v without OPUS_MCP_BANNER, want unset", *config.Enabled)
+	}
+	if bannerEnabled(config, file) {
+		t.Error("bannerEnabled() without configuration and without a terminal = true, want false")
+	}
+
+	t.Setenv("OPUS_MCP_BANNER", "true")
+	config, err = LoadBannerConfig()
+	if err != nil {
+		t.Fatalf("LoadBannerConfig() unexpected error: %v", err)
+	}
+	if !bannerEnabled(config, file) {
+		t.Error("bannerEnabled() with OPUS_MCP_BANNER=true = false, want true")
+	}
+}
+
+func TestAnnounceStartup(t *testing.T) {
+	var out bytes.Buffer
+	announceStartup(&out, false, "stdio", "")
+	if out.Len() != 0 {
+		t.Errorf("announceStartup() with the banner disabled wrote %q", out.String())
+	}
+	announceStartup(&out, true, "http", "http://localhost:8000")
+	if !strings.Contains(out.String(), "░█▀█░█▀█░█░█░█▀▀") {
+		t.Errorf("announceStartup() with the banner enabled wrote %q", out.String())
+	}
+}
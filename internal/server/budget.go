@@ -0,0 +1,67 @@
+package server
+
+import (
+	"math"
+)
+
+// defaultTokensPerByte is a rough ratio of tokens to bytes of JSON for common LLM tokenizers, i.e.,
+// about four bytes per token
+const defaultTokensPerByte = 0.25
+
+// tokensPerByte converts the serialized size of entries into the tokens they are estimated to take
+// up in a client's context
+var tokensPerByte = defaultTokensPerByte
+
+// ContextBudget reports how the entries of a result measure up against the token budget the client
+// stated in maxTokensHint
+type ContextBudget struct {
+	MaxTokensHint int `json:"maxTokensHint" jsonschema:"The token budget the call stated in maxTokensHint"`
+	// EstimatedTokensPerEntry and SuggestedFetchSize are only set when there was an entry to measure
+	EstimatedTokensPerEntry int `json:"estimatedTokensPerEntry,omitempty" jsonschema:"The tokens one entry is estimated to take, extrapolated from the serialized size of the first entry; absent when there were no entries"`
+	SuggestedFetchSize      int `json:"suggestedFetchSize,omitempty" jsonschema:"How many entries are estimated to fit into maxTokensHint, at least 1; use it as fetchSize for the next call. Absent when there were no entries"`
+	OmittedCount            int `json:"omittedCount" jsonschema:"The number of fetched entries left out of the result because they did not fit into maxTokensHint; they are the last entries in the result's order"`
+	// OmittedArticleIDs lists the omitted entries that have an identifier, to fetch them by ID
+	OmittedArticleIDs []string `json:"omittedArticleIds,omitempty" jsonschema:"The identifiers of the omitted entries, in order, e.g., for arxiv_fetch_by_id"`
+}
+
+// fitToBudget estimates the tokens every entry of a result takes from the serialized size of the
+// first one, as returned by view, and, if the entries are estimated to exceed maxTokens, keeps as
+// many of the first entries as fit, but at least one, so that every call makes progress. Entries
+// returned twice, i.e., also in groups, are counted twice. Nothing is dropped without being
+// reported in the budget.
+func fitToBudget(result *CategoryFetchResult, maxTokens int, grouped bool, view func(entry *FeedEntry) any) *ContextBudget {
+	budget := &ContextBudget{MaxTokensHint: maxTokens}
+	if len(result.Items) == 0 {
+		return budget
+	}
+	sample, err := marshalOutput(view(result.Items[0]))
+	if err != nil {
+		return budget
+	}
+	perEntry := max(1, int(math.Ceil(float64(len(sample))*tokensPerByte)))
+	if grouped {
+		perEntry *= 2
+	}
+	budget.EstimatedTokensPerEntry = perEntry
+	budget.SuggestedFetchSize = max(1, maxTokens/perEntry)
+	if len(result.Items) <= budget.SuggestedFetchSize {
+		return budget
+	}
+
+	omitted := result.Items[budget.SuggestedFetchSize:]
+	result.Items = result.Items[:budget.SuggestedFetchSize]
+	budget.OmittedCount = len(omitted)
+	for _, entry := range omitted {
+		if entry.ArticleID != "" {
+			budget.OmittedArticleIDs = append(budget.OmittedArticleIDs, entry.ArticleID)
+		}
+	}
+	// The warnings count the entries still returned
+	result.Warnings = 0
+	for _, entry := range result.Items {
+		if len(entry.Errors) > 0 {
+			result.Warnings++
+		}
+	}
+	return budget
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// budgetFixture returns a result of count entries whose abstracts are abstractBytes long, with every
+// third entry carrying an error
+func budgetFixture(count, abstractBytes int) *CategoryFetchResult {
+	result := &CategoryFetchResult{Feed: &gofeed.Feed{}}
+	for i := range count {
+		entry := &FeedEntry{
+			Item:      &gofeed.Item{Title: fmt.Sprintf("Paper %d", i), Description: strings.Repeat("a", abstractBytes)},
+			ArticleID: fmt.Sprintf("2405.%05dv1", i),
+		}
+		if i%3 == 2 {
+			entry.Errors = []string{"no primary category"}
+			result.Warnings++
+		}
+		result.Items = append(result.Items, entry)
+	}
+	return result
+}
+
+// entryTokens is the estimate fitToBudget makes for an entry of the fixture
+func entryTokens(t *testing.T, result *CategoryFetchResult) int {
+	t.Helper()
+	sample, err := marshalOutput(result.Items[0])
+	if err != nil {
+		t.Fatalf("marshalOutput() unexpected error: %v", err)
+	}
+	return (len(sample) + 3) / 4
+}
+
+func TestFitToBudget(t *testing.T) {
+	original := tokensPerByte
+	t.Cleanup(func() { tokensPerByte = original })
+	tokensPerByte = 0.25
+
+	t.Run("small entries fit", func(t *testing.T) {
+		result := budgetFixture(10, 100)
+		perEntry := entryTokens(t, result)
+		budget := fitToBudget(result, 100*perEntry, false, entryShape{raw: true}.entry)
+		if len(result.Items) != 10 || result.Warnings != 3 {
+			t.Errorf("kept %d entries with %d warnings, want all 10 with 3", len(result.Items), result.Warnings)
+		}
+		want := &ContextBudget{MaxTokensHint: 100 * perEntry, EstimatedTokensPerEntry: perEntry, SuggestedFetchSize: 100}
+		if !reflect.DeepEqual(budget, want) {
+			t.Errorf("fitToBudget() = %+v, want %+v", budget, want)
+		}
+	})
+
+	t.Run("large entries are clamped", func(t *testing.T) {
+		result := budgetFixture(10, 20000)
+		perEntry := entryTokens(t, result)
+		if perEntry < 5000 {
+			t.Fatalf("large fixture entry estimated at %d tokens, want at least 5000", perEntry)
+		}
+		// Room for four entries and most of a fifth
+		budget := fitToBudget(result, 5*perEntry-1, false, entryShape{raw: true}.entry)
+		if len(result.Items) != 4 || result.Warnings != 1 {
+			t.Errorf("kept %d entries with %d warnings, want 4 with 1", len(result.Items), result.Warnings)
+		}
+		want := &ContextBudget{
+			MaxTokensHint:           5*perEntry - 1,
+			EstimatedTokensPerEntry: perEntry,
+			SuggestedFetchSize:      4,
+			OmittedCount:            6,
+			OmittedArticleIDs:       []string{"2405.00004v1", "2405.00005v1", "2405.00006v1", "2405.00007v1", "2405.00008v1", "2405.00009v1"},
+		}
+		if !reflect.DeepEqual(budget, want) {
+			t.Errorf("fitToBudget() = %+v, want %+v", budget, want)
+		}
+	})
+
+	t.Run("grouped entries count twice", func(t *testing.T) {
+		result := budgetFixture(10, 100)
+		perEntry := entryTokens(t, result)
+		budget := fitToBudget(result, 6*perEntry, true, entryShape{raw: true}.entry)
+		if len(result.Items) != 3 || budget.EstimatedTokensPerEntry != 2*perEntry || budget.OmittedCount != 7 {
+			t.Errorf("fitToBudget() = %+v keeping %d entries, want 3 entries of %d tokens", budget, len(result.Items), 2*perEntry)
+		}
+	})
+
+	t.Run("at least one entry is returned", func(t *testing.T) {
+		result := budgetFixture(3, 20000)
+		budget := fitToBudget(result, 10, false, entryShape{raw: true}.entry)
+		if len(result.Items) != 1 || budget.SuggestedFetchSize != 1 || budget.OmittedCount != 2 {
+			t.Errorf("fitToBudget() = %+v keeping %d entries, want 1 entry and 2 omitted", budget, len(result.Items))
+		}
+	})
+
+	t.Run("no entries", func(t *testing.T) {
+		budget := fitToBudget(budgetFixture(0, 0), 1000, false, entryShape{raw: true}.entry)
+		if !reflect.DeepEqual(budget, &ContextBudget{MaxTokensHint: 1000}) {
+			t.Errorf("fitToBudget() = %+v, want only the hint", budget)
+		}
+	})
+
+	t.Run("tokens per byte is configurable", func(t *testing.T) {
+		tokensPerByte = 0.5
+		result := budgetFixture(10, 100)
+		budget := fitToBudget(result, 1000, false, entryShape{raw: true}.entry)
+		if want := 2 * entryTokens(t, result); budget.EstimatedTokensPerEntry < want-1 || budget.EstimatedTokensPerEntry > want {
+			t.Errorf("estimated %d tokens per entry at 0.5 tokens per byte, want about %d", budget.EstimatedTokensPerEntry, want)
+		}
+	})
+}
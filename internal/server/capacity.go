@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"opus-mcp/internal/settings"
+	"opus-mcp/internal/storage"
+)
+
+// ErrCodeStorageFull means a download was refused because storage is nearly full
+const ErrCodeStorageFull = "STORAGE_FULL"
+
+// StorageCapacityConfig holds the storage capacity check configuration loaded from environment variables
+type StorageCapacityConfig struct {
+	// MinFreeBytes is the free space below which downloads are refused; zero disables the check
+	MinFreeBytes settings.Size `env:"OPUS_MCP_STORAGE_MIN_FREE_BYTES,default=0"`
+	// Path is a directory on the filesystem holding the stored objects, e.g., the data directory of
+	// a MinIO server on the same host. Without it, capacity is probed through S3, which cannot report it.
+	Path string `env:"OPUS_MCP_STORAGE_CAPACITY_PATH"`
+	// Interval is how often capacity is probed
+	Interval settings.Duration `env:"OPUS_MCP_STORAGE_CAPACITY_INTERVAL,default=60s"`
+}
+
+// Validate checks that capacity is probed at a positive interval
+func (c *StorageCapacityConfig) Validate() error {
+	if c.Interval <= 0 {
+		return fmt.Errorf("OPUS_MCP_STORAGE_CAPACITY_INTERVAL must be positive, got %s", c.Interval)
+	}
+	return nil
+}
+
+// LoadStorageCapacityConfig loads the storage capacity check configuration from environment variables
+func LoadStorageCapacityConfig() (*StorageCapacityConfig, error) {
+	var config StorageCapacityConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process storage capacity configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// capacityMonitor periodically probes storage capacity so that downloads can be refused before
+// spending arXiv bandwidth on an upload that would fail
+type capacityMonitor struct {
+	prober       storage.CapacityProber
+	minFreeBytes uint64
+
+	mu          sync.Mutex
+	capacity    storage.Capacity
+	probed      bool
+	unsupported bool
+	lastErr     error
+	checkedAt   time.Time
+}
+
+// storageCapacity monitors the capacity of the configured storage; nil when not monitored
+var storageCapacity *capacityMonitor
+
+func newCapacityMonitor(prober storage.CapacityProber, minFreeBytes uint64) *capacityMonitor {
+	return &capacityMonitor{prober: prober, minFreeBytes: minFreeBytes}
+}
+
+// probe reads the current capacity. Backends that cannot report capacity are noted once and then
+// no longer probed.
+func (m *capacityMonitor) probe(ctx context.Context) {
+	capacity, err := m.prober.Capacity(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkedAt = time.Now()
+	switch {
+	case errors.Is(err, storage.ErrCapacityUnsupported):
+		if !m.unsupported {
+			slog.Info("Storage backend does not report capacity - skipping the free space check for downloads")
+		}
+		m.unsupported = true
+	case err != nil:
+		// Keep the last known capacity; a failed probe alone does not block downloads
+		slog.Warn("Failed to probe storage capacity", "error", err)
+		m.lastErr = err
+	default:
+		m.capacity = capacity
+		m.probed = true
+		m.lastErr = nil
+	}
+}
+
+// run probes capacity immediately and then at every interval until the context is done or the
+// backend turns out not to report capacity
+func (m *capacityMonitor) run(ctx context.Context, interval time.Duration) {
+	m.probe(ctx)
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for !m.isUnsupported() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.probe(ctx)
+		}
+	}
+}
+
+func (m *capacityMonitor) isUnsupported() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.unsupported
+}
+
+// checkDownload returns a STORAGE_FULL error if the last probe found less free space than
+// required. It allows downloads when capacity is unknown or the monitor is nil.
+func (m *capacityMonitor) checkDownload() *ToolError {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.probed || m.unsupported || m.capacity.FreeBytes >= m.minFreeBytes {
+		return nil
+	}
+	return &ToolError{
+		Code:    ErrCodeStorageFull,
+		Message: fmt.Sprintf("storage has %d bytes free, below the minimum of %d bytes required for downloads", m.capacity.FreeBytes, m.minFreeBytes),
+		Details: map[string]any{
+			"freeBytes":    m.capacity.FreeBytes,
+			"minFreeBytes": m.minFreeBytes,
+		},
+	}
+}
+
+// status describes the last known capacity for the readiness endpoint
+func (m *capacityMonitor) status() map[string]any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := map[string]any{"minFreeBytes": m.minFreeBytes}
+	switch {
+	case m.unsupported:
+		status["supported"] = false
+	case m.probed:
+		status["supported"] = true
+		status["totalBytes"] = m.capacity.TotalBytes
+		status["freeBytes"] = m.capacity.FreeBytes
+		status["full"] = m.capacity.FreeBytes < m.minFreeBytes
+		status["checkedAt"] = m.checkedAt.UTC().Format(time.RFC3339)
+	}
+	if m.lastErr != nil {
+		status["error"] = m.lastErr.Error()
+	}
+	return status
+}
+
+// startCapacityMonitor creates and starts the storage capacity monitor from its configuration
+func startCapacityMonitor(ctx context.Context, config *StorageCapacityConfig) *capacityMonitor {
+	var prober storage.CapacityProber = storage.S3Prober{}
+	if config.Path != "" {
+		prober = &storage.FilesystemProber{Path: config.Path}
+	}
+	monitor := newCapacityMonitor(prober, uint64(config.MinFreeBytes))
+	go monitor.run(ctx, config.Interval.Duration())
+	return monitor
+}
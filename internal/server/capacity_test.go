@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"opus-mcp/internal/storage"
+)
+
+// quotaProber simulates a small filesystem, like a tmpfs mounted with a size limit, whose free
+// space is its quota minus the size of the files written to its directory
+type quotaProber struct {
+	dir   string
+	quota uint64
+}
+
+func (p *quotaProber) Capacity(ctx context.Context) (storage.Capacity, error) {
+	var used uint64
+	err := filepath.WalkDir(p.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		used += uint64(info.Size())
+		return nil
+	})
+	if err != nil {
+		return storage.Capacity{}, err
+	}
+	return storage.Capacity{TotalBytes: p.quota, FreeBytes: p.quota - min(used, p.quota)}, nil
+}
+
+type unsupportedProber struct{}
+
+func (unsupportedProber) Capacity(ctx context.Context) (storage.Capacity, error) {
+	return storage.Capacity{}, storage.ErrCapacityUnsupported
+}
+
+func TestCapacityMonitorRefusesDownloadsWhenFull(t *testing.T) {
+	withUnlimitedArxiv(t)
+	originalConfig, originalCapacity, originalUploader := globalS3Config, storageCapacity, urlUploader
+	t.Cleanup(func() {
+		globalS3Config, storageCapacity, urlUploader = originalConfig, originalCapacity, originalUploader
+	})
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	urlUploader = func(ctx context.Context, sourceURL string, config *storage.S3Config, bucketName, objectName string, metadata map[string]string, policy storage.CollisionPolicy) (storage.UploadResult, error) {
+		t.Errorf("download of %s started although storage is full", sourceURL)
+		return storage.UploadResult{}, nil
+	}
+
+	// A 64 KiB quota that must keep 16 KiB free
+	dir := t.TempDir()
+	storageCapacity = newCapacityMonitor(&quotaProber{dir: dir, quota: 64 << 10}, 16<<10)
+	storageCapacity.probe(context.Background())
+	if err := storageCapacity.checkDownload(); err != nil {
+		t.Fatalf("checkDownload() on empty storage = %v, want nil", err)
+	}
+
+	// Fill the storage to 52 KiB, leaving 12 KiB
+	if err := os.WriteFile(filepath.Join(dir, "filler.bin"), make([]byte, 52<<10), 0o600); err != nil {
+		t.Fatalf("failed to write filler file: %v", err)
+	}
+	storageCapacity.probe(context.Background())
+
+	handler := newTestToolHandler(t, downloadPDFToS3)
+	result, err := handler.Handle(context.Background(), newTestCallToolRequest("arxiv_download_pdf", `{"articleId":"2405.12345"}`))
+	if err != nil {
+		t.Fatalf("Handle() returned protocol error: %v", err)
+	}
+	if !result.IsError {
+		t.Fatal("expected a STORAGE_FULL error result")
+	}
+	var payload struct {
+		Error ToolError `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(resultText(t, result)), &payload); err != nil {
+		t.Fatalf("failed to unmarshal error payload: %v", err)
+	}
+	if payload.Error.Code != ErrCodeStorageFull {
+		t.Errorf("error code = %q, want %q", payload.Error.Code, ErrCodeStorageFull)
+	}
+	if payload.Error.Details["freeBytes"] != float64(12<<10) {
+		t.Errorf("error details = %v, want 12288 free bytes", payload.Error.Details)
+	}
+
+	// The readiness endpoint reports the capacity
+	recorder := httptest.NewRecorder()
+	readinessHandler(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	var ready struct {
+		Storage map[string]any `json:"storage"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &ready); err != nil {
+		t.Fatalf("failed to unmarshal readiness response: %v", err)
+	}
+	if ready.Storage["full"] != true || ready.Storage["freeBytes"] != float64(12<<10) {
+		t.Errorf("readiness storage = %v, want full with 12288 free bytes", ready.Storage)
+	}
+
+	// Freeing space allows downloads again after the next probe
+	if err := os.Remove(filepath.Join(dir, "filler.bin")); err != nil {
+		t.Fatalf("failed to remove filler file: %v", err)
+	}
+	storageCapacity.probe(context.Background())
+	if err := storageCapacity.checkDownload(); err != nil {
+		t.Errorf("checkDownload() after freeing space = %v, want nil", err)
+	}
+}
+
+func TestCapacityMonitorUnsupportedBackend(t *testing.T) {
+	monitor := newCapacityMonitor(unsupportedProber{}, 1<<30)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// run returns on its own once the backend turns out not to report capacity
+	monitor.run(ctx, 1)
+
+	if err := monitor.checkDownload(); err != nil {
+		t.Errorf("checkDownload() with an unsupported backend = %v, want nil", err)
+	}
+	if status := monitor.status(); status["supported"] != false {
+		t.Errorf("status() = %v, want supported false", status)
+	}
+
+	// A nil monitor, when storage is not configured, never refuses downloads
+	var unmonitored *capacityMonitor
+	if err := unmonitored.checkDownload(); err != nil {
+		t.Errorf("checkDownload() on a nil monitor = %v, want nil", err)
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"opus-mcp/internal"
+	"opus-mcp/internal/metrics"
+	"opus-mcp/internal/settings"
+	"opus-mcp/internal/storage"
+)
+
+// configurations returns empty instances of every configuration struct the server loads, to check
+// them all at once. S3 storage is optional, so its configuration is only checked when set.
+func configurations() []any {
+	return []any{
+		settings.Optional(&storage.S3Config{}),
+		&internal.HTTPClientConfig{},
+		&internal.RetryConfig{},
+		&storage.UploadBufferConfig{},
+		&storage.DownloadPolicy{},
+		&metrics.SlowOperationConfig{},
+		&ObjectNameConfig{},
+		&ClockConfig{},
+		&SigningConfig{},
+		&CalendarConfig{},
+		&GenericDownloadConfig{},
+		&IDListConfig{},
+		&ArxivRateConfig{},
+		&InputConfig{},
+		&IdentifierConfig{},
+		&HTTPCacheConfig{},
+		&InstructionsConfig{},
+		&OutputConfig{},
+		&NegotiationConfig{},
+		&ArxivQuotaConfig{},
+		&SummaryConfig{},
+		&ExportConfig{},
+		&AdmissionConfig{},
+		&AdminConfig{},
+		&SessionConfig{},
+		&ClientIdentityConfig{},
+		&BannerConfig{},
+		&StorageCapacityConfig{},
+		&DownloadJobConfig{},
+	}
+}
+
+// checkConfiguration checks every configuration struct the server loads and returns all the
+// problems found together, or nil
+func checkConfiguration() error {
+	return settings.Check(context.Background(), configurations()...)
+}
+
+// CheckConfig checks the configuration of the server without starting it and writes every problem
+// found to w. It returns the exit status: 0 for a valid configuration, 1 otherwise.
+func CheckConfig(w io.Writer) int {
+	if err := checkConfiguration(); err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+	fmt.Fprintln(w, "configuration is valid")
+	return 0
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	var out bytes.Buffer
+	if status := CheckConfig(&out); status != 0 {
+		t.Fatalf("CheckConfig() = %d with the default configuration, output %s", status, out.String())
+	}
+
+	t.Setenv("OPUS_MCP_RESPONSE_SIZE_WARN_BYTES", "200MBs")
+	t.Setenv("OPUS_MCP_EXPORT_PRESIGN_EXPIRY", "8d")
+	t.Setenv("OPUS_MCP_EXPORT_STREAM_THRESHOLD", "-1")
+	t.Setenv("OPUS_MCP_HTTP_CLIENT_TIMEOUT", "soon")
+	t.Setenv("OPUS_MCP_MAX_BUFFERED_BYTES", "1.5GB")
+	out.Reset()
+	if status := CheckConfig(&out); status != 1 {
+		t.Errorf("CheckConfig() = %d, want 1 for an invalid configuration", status)
+	}
+	for _, want := range []string{
+		"4 configuration problems:",
+		`OutputConfig: OPUS_MCP_RESPONSE_SIZE_WARN_BYTES: invalid size "200MBs"`,
+		"ExportConfig: OPUS_MCP_EXPORT_STREAM_THRESHOLD cannot be negative, got -1",
+		"ExportConfig: OPUS_MCP_EXPORT_PRESIGN_EXPIRY must be between 1s and 7d, got 192h0m0s",
+		`HTTPClientConfig: OPUS_MCP_HTTP_CLIENT_TIMEOUT: invalid duration "soon"`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("CheckConfig() output = %s, want it to contain %q", out.String(), want)
+		}
+	}
+	// S3 storage is not configured, so its required variables are not missing
+	if strings.Contains(out.String(), "S3Config") {
+		t.Errorf("CheckConfig() output = %s, want unconfigured S3 storage left unchecked", out.String())
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"opus-mcp/internal/storage"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// maxObjectChunkLength caps the number of bytes returned by a single chunked read, keeping the
+// base64 encoded response at a size MCP clients can handle
+const maxObjectChunkLength int64 = 4 << 20
+
+// readableObjectPrefixes are the bucket prefixes whose objects may be read back by clients
+var readableObjectPrefixes = []string{"arxiv/", summaryObjectPrefix, exportObjectPrefix}
+
+// readableObjectKeys are the rules object names read back by clients must follow
+var readableObjectKeys = storage.KeyRules{AllowedPrefixes: readableObjectPrefixes}
+
+const (
+	// deliveryInline returns object content base64 encoded in the output
+	deliveryInline = "inline"
+	// deliveryLink returns a presigned URL of the object, and a resource link to it, instead
+	deliveryLink = "link"
+)
+
+// objectRangeReader reads a byte range of a stored object; replaced in tests
+var objectRangeReader = func(ctx context.Context, objectName string, offset, length int64) ([]byte, int64, error) {
+	if globalS3Config == nil {
+		return nil, 0, fmt.Errorf("S3 configuration not loaded")
+	}
+	return storage.ReadObjectRange(ctx, globalS3Config, S3_ARTICLES_BUCKET, objectName, offset, length)
+}
+
+// S3ReadObjectChunkArgs defines the input parameters for reading a chunk of a stored object
+type S3ReadObjectChunkArgs struct {
+	ObjectName string `json:"objectName" jsonschema:"The name/path of the object in the bucket, e.g., arxiv/2405.12345.pdf"`
+	Offset     int64  `json:"offset,omitempty" jsonschema:"The byte offset to start reading at (default: 0)"`
+	Length     int64  `json:"length,omitempty" jsonschema:"The number of bytes to read (default and maximum: 4194304)"`
+	Delivery   string `json:"delivery,omitempty" jsonschema:"How to return the content: inline as base64, or link to the whole object with a presigned URL and a resource link, ignoring offset and length. Defaults to link for clients supporting resource links, inline otherwise"`
+}
+
+// S3ReadObjectChunkOutput defines the output structure for a chunked object read
+type S3ReadObjectChunkOutput struct {
+	ObjectName string `json:"objectName" jsonschema:"The name/path of the object in the bucket"`
+	Offset     int64  `json:"offset" jsonschema:"The byte offset the chunk starts at"`
+	Length     int64  `json:"length" jsonschema:"The number of bytes in the chunk"`
+	TotalSize  int64  `json:"totalSize" jsonschema:"The total size of the object in bytes"`
+	Data       string `json:"data,omitempty" jsonschema:"The chunk content, base64 (standard encoding) encoded; absent with delivery=link"`
+	URL        string `json:"url,omitempty" jsonschema:"The presigned URL to download the whole object from; only with delivery=link"`
+	ExpiresAt  string `json:"expiresAt,omitempty" jsonschema:"When the presigned URL expires, in RFC 3339 format; only with delivery=link"`
+	Done       bool   `json:"done" jsonschema:"Whether this chunk reaches the end of the object"`
+	NextOffset int64  `json:"nextOffset" jsonschema:"The offset to read the next chunk from, equal to totalSize when done"`
+	// contentType is the content type of a linked object
+	contentType string
+}
+
+// resourceLinks links to the object when it is delivered as a link
+func (o S3ReadObjectChunkOutput) resourceLinks() []*mcp.ResourceLink {
+	if o.URL == "" {
+		return nil
+	}
+	return []*mcp.ResourceLink{{URI: o.URL, Name: o.ObjectName, MIMEType: o.contentType, Size: &o.TotalSize}}
+}
+
+// readObjectChunk returns a base64 encoded byte range of a stored object so that clients can
+// reassemble large files incrementally
+func readObjectChunk(ctx context.Context, input json.RawMessage) (any, error) {
+	var args S3ReadObjectChunkArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+	// Articles may be stored under any prefix the object name template names, so those in the library index are readable too
+	if err := storage.ValidateObjectKey(args.ObjectName, readableObjectKeys); err != nil && !indexedObject(ctx, args.ObjectName) {
+		if keyErr := objectKeyToolError("objectName", err); keyErr != nil {
+			return nil, keyErr
+		}
+		return nil, err
+	}
+	if args.Offset < 0 {
+		return nil, fmt.Errorf("offset cannot be negative")
+	}
+	if args.Length < 0 || args.Length > maxObjectChunkLength {
+		return nil, fmt.Errorf("length must be between 1 and %d bytes", maxObjectChunkLength)
+	}
+	if args.Length == 0 {
+		args.Length = maxObjectChunkLength
+	}
+	if args.Delivery == deliveryLink {
+		return linkObject(ctx, args.ObjectName)
+	}
+
+	data, totalSize, err := objectRangeReader(ctx, args.ObjectName, args.Offset, args.Length)
+	if err != nil {
+		if storageErr := storageToolError(err); storageErr != nil {
+			return nil, storageErr
+		}
+		return nil, fmt.Errorf("failed to read object chunk: %w", err)
+	}
+
+	nextOffset := args.Offset + int64(len(data))
+	return S3ReadObjectChunkOutput{
+		ObjectName: args.ObjectName,
+		Offset:     args.Offset,
+		Length:     int64(len(data)),
+		TotalSize:  totalSize,
+		Data:       base64.StdEncoding.EncodeToString(data),
+		Done:       nextOffset >= totalSize,
+		NextOffset: nextOffset,
+	}, nil
+}
+
+// linkObject returns a presigned URL of a whole stored object in place of its content
+func linkObject(ctx context.Context, objectName string) (any, error) {
+	attributes, err := objectAttributesReader(ctx, objectName)
+	if err != nil {
+		if storageErr := storageToolError(err); storageErr != nil {
+			return nil, storageErr
+		}
+		return nil, fmt.Errorf("failed to read object attributes: %w", err)
+	}
+	expiry := exportConfig.PresignExpiry.Duration()
+	expiresAt := time.Now().Add(expiry)
+	url, err := exportPresigner(ctx, objectName, expiry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign object URL: %w", err)
+	}
+	return S3ReadObjectChunkOutput{
+		ObjectName:  objectName,
+		Length:      attributes.Size,
+		TotalSize:   attributes.Size,
+		URL:         url,
+		ExpiresAt:   expiresAt.UTC().Format(time.RFC3339),
+		Done:        true,
+		NextOffset:  attributes.Size,
+		contentType: attributes.ContentType,
+	}, nil
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/storage"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// stubObjectRangeReader serves byte ranges of in-memory objects with the same semantics as storage.ReadObjectRange
+func stubObjectRangeReader(t *testing.T, objects map[string][]byte) {
+	t.Helper()
+	original := objectRangeReader
+	t.Cleanup(func() { objectRangeReader = original })
+	objectRangeReader = func(ctx context.Context, objectName string, offset, length int64) ([]byte, int64, error) {
+		data, ok := objects[objectName]
+		if !ok {
+			return nil, 0, storage.ErrObjectNotFound
+		}
+		size := int64(len(data))
+		if offset >= size && !(size == 0 && offset == 0) {
+			return nil, size, fmt.Errorf("offset %d is beyond the end of the object (size %d)", offset, size)
+		}
+		return data[offset:min(offset+length, size)], size, nil
+	}
+}
+
+func TestReadObjectChunkReassembles(t *testing.T) {
+	// A fixture that does not divide evenly into the chunk length
+	fixture := bytes.Repeat([]byte("%PDF-1.7 \x00\xff binary content "), 1000)
+	stubObjectRangeReader(t, map[string][]byte{"arxiv/2405.12345.pdf": fixture})
+
+	chunkLength := int64(len(fixture)/3 + 1)
+	var reassembled []byte
+	offset := int64(0)
+	for chunk := 1; ; chunk++ {
+		if chunk > 3 {
+			t.Fatal("object was not fully read in three chunks")
+		}
+		input := fmt.Sprintf(`{"objectName":"arxiv/2405.12345.pdf","offset":%d,"length":%d}`, offset, chunkLength)
+		result, err := readObjectChunk(context.Background(), json.RawMessage(input))
+		if err != nil {
+			t.Fatalf("chunk %d: readObjectChunk() unexpected error: %v", chunk, err)
+		}
+		output := result.(S3ReadObjectChunkOutput)
+		if output.TotalSize != int64(len(fixture)) {
+			t.Errorf("chunk %d: totalSize = %d, want %d", chunk, output.TotalSize, len(fixture))
+		}
+		data, err := base64.StdEncoding.DecodeString(output.Data)
+		if err != nil {
+			t.Fatalf("chunk %d: data is not valid base64: %v", chunk, err)
+		}
+		if int64(len(data)) != output.Length {
+			t.Errorf("chunk %d: length = %d but %d bytes were returned", chunk, output.Length, len(data))
+		}
+		reassembled = append(reassembled, data...)
+		offset = output.NextOffset
+		if output.Done {
+			if chunk != 3 {
+				t.Errorf("object was done after %d chunks, want 3", chunk)
+			}
+			break
+		}
+	}
+
+	if !bytes.Equal(reassembled, fixture) {
+		t.Error("reassembled object differs from the fixture")
+	}
+}
+
+func TestReadObjectChunkValidation(t *testing.T) {
+	stubObjectRangeReader(t, map[string][]byte{"arxiv/small.pdf": []byte("0123456789")})
+
+	tests := []struct {
+		name      string
+		input     string
+		wantError string
+	}{
+		{"Outside allowed prefixes", `{"objectName":"library/index.json"}`, "not under an allowed prefix"},
+		{"Path traversal", `{"objectName":"arxiv/../library/index.json"}`, "'..' path segments"},
+		{"Backslash", `{"objectName":"arxiv\\..\\library\\index.json"}`, "backslash"},
+		{"Control character", `{"objectName":"arxiv/small.pdf\u0000.txt"}`, "control character U+0000"},
+		{"Empty object name", `{"objectName":""}`, "cannot be empty"},
+		{"Negative offset", `{"objectName":"arxiv/small.pdf","offset":-1}`, "offset cannot be negative"},
+		{"Length above cap", fmt.Sprintf(`{"objectName":"arxiv/small.pdf","length":%d}`, maxObjectChunkLength+1), "length must be between"},
+		{"Offset beyond object size", `{"objectName":"arxiv/small.pdf","offset":10}`, "beyond the end"},
+		{"Missing object", `{"objectName":"arxiv/missing.pdf"}`, "object not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readObjectChunk(context.Background(), json.RawMessage(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("readObjectChunk() error = %v, want error containing %q", err, tt.wantError)
+			}
+		})
+	}
+
+	_, err := readObjectChunk(context.Background(), json.RawMessage(`{"objectName":"arxiv/a\rb.pdf"}`))
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeInvalidInput || toolErr.Details["character"] != "\r" {
+		t.Errorf("readObjectChunk() error = %#v, want %s naming the carriage return", err, ErrCodeInvalidInput)
+	}
+
+	// Omitting the length reads up to the cap, which covers the whole small object
+	result, err := readObjectChunk(context.Background(), json.RawMessage(`{"objectName":"arxiv/small.pdf","offset":4}`))
+	if err != nil {
+		t.Fatalf("readObjectChunk() unexpected error: %v", err)
+	}
+	if output := result.(S3ReadObjectChunkOutput); !output.Done || output.Length != 6 || output.NextOffset != 10 {
+		t.Errorf("readObjectChunk() = %+v, want the final 6 bytes and done", output)
+	}
+}
+
+func TestAddMCPToolsWithStorage(t *testing.T) {
+	original := globalS3Config
+	t.Cleanup(func() { globalS3Config = original })
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test-server", Version: "v0.0.1"}, nil)
+	if err := addMCPTools(server, toolDeps); err != nil {
+		t.Fatalf("addMCPTools() unexpected error: %v", err)
+	}
+}
+
+// TestReadObjectChunkOfIndexedObject checks that articles stored outside arxiv/ by an object name
+// template are readable as long as the library index has them
+func TestReadObjectChunkOfIndexedObject(t *testing.T) {
+	stubObjectRangeReader(t, map[string][]byte{"cs.CL/2405.12345.pdf": []byte("%PDF"), "web/other.pdf": []byte("%PDF")})
+	original := globalLibrary
+	t.Cleanup(func() { globalLibrary = original })
+	globalLibrary = library.New(&library.MemoryStore{})
+	if err := globalLibrary.Record(context.Background(), library.Entry{ObjectName: "cs.CL/2405.12345.pdf", Bucket: S3_ARTICLES_BUCKET}); err != nil {
+		t.Fatalf("failed to record fixture entry: %v", err)
+	}
+
+	if _, err := readObjectChunk(context.Background(), json.RawMessage(`{"objectName":"cs.CL/2405.12345.pdf"}`)); err != nil {
+		t.Errorf("readObjectChunk() of an indexed object unexpected error: %v", err)
+	}
+	if _, err := readObjectChunk(context.Background(), json.RawMessage(`{"objectName":"web/other.pdf"}`)); err == nil || !strings.Contains(err.Error(), "not under an allowed prefix") {
+		t.Errorf("readObjectChunk() of an object outside the index error = %v, want it refused", err)
+	}
+}
@@ -0,0 +1,380 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/storage"
+)
+
+// cleanupProtectedPrefixes hold the server's own state, i.e., the library index, the audit log,
+// download jobs and quotas, which no cleanup rule removes
+var cleanupProtectedPrefixes = []string{"library/", "jobs/", "state/"}
+
+// Approvals of a cleanup that was executed, or asked to be
+const (
+	// cleanupApprovedByConfirm means the call set confirm
+	cleanupApprovedByConfirm = "confirm"
+	// cleanupApprovalAccepted means the user accepted the plan when asked through elicitation
+	cleanupApprovalAccepted = "accept"
+)
+
+// globalAuditLog records the changes made to the bucket on behalf of clients
+var globalAuditLog *library.AuditLog
+
+// CleanupRules select the objects a cleanup removes; an object is removed if any rule selects it
+type CleanupRules struct {
+	OlderThanDays         map[string]int `json:"olderThanDays,omitempty" jsonschema:"Remove objects last modified more than the given number of days ago, by object name prefix, e.g., {\"exports/\": 30}"`
+	KeepLatestVersionOnly bool           `json:"keepLatestVersionOnly,omitempty" jsonschema:"Remove the PDFs of arXiv articles under arxiv/ of which a later version is stored. Unversioned PDFs are kept"`
+	RemoveOrphanedText    bool           `json:"removeOrphanedText,omitempty" jsonschema:"Remove text files (.txt) whose PDF, the object of the same name ending in .pdf, is gone or removed by the same cleanup"`
+}
+
+// LibraryCleanupArgs defines the input parameters for cleaning up the articles bucket
+type LibraryCleanupArgs struct {
+	Rules           CleanupRules `json:"rules" jsonschema:"The rules selecting the objects to remove"`
+	Confirm         bool         `json:"confirm,omitempty" jsonschema:"Remove the planned objects. Without it, or requestApproval, the call only plans the cleanup. Defaults to false"`
+	RequestApproval bool         `json:"requestApproval,omitempty" jsonschema:"Ask the user to approve the plan through MCP elicitation and remove the planned objects if they accept. Defaults to false"`
+}
+
+// PlannedRemoval is an object a cleanup removes and why
+type PlannedRemoval struct {
+	ObjectName   string   `json:"objectName" jsonschema:"The name/path of the object in the bucket"`
+	Size         int64    `json:"size" jsonschema:"Size of the object in bytes"`
+	LastModified string   `json:"lastModified" jsonschema:"RFC 3339 time at which the object was last modified"`
+	Reasons      []string `json:"reasons" jsonschema:"Why the rules select the object, one reason per rule"`
+}
+
+// CleanupFailure is a planned object that could not be removed
+type CleanupFailure struct {
+	ObjectName string `json:"objectName" jsonschema:"The name/path of the object in the bucket"`
+	Error      string `json:"error" jsonschema:"Why the object could not be removed"`
+}
+
+// LibraryCleanupOutput defines the output structure of a cleanup, planned or executed
+type LibraryCleanupOutput struct {
+	DryRun       bool             `json:"dryRun" jsonschema:"Whether the cleanup was only planned, without removing anything"`
+	Objects      []PlannedRemoval `json:"objects" jsonschema:"The objects the rules select, in name order"`
+	TotalBytes   int64            `json:"totalBytes" jsonschema:"The total size of the planned objects in bytes"`
+	Approval     string           `json:"approval,omitempty" jsonschema:"How the removal was approved, confirm or accept, or why it was not: decline or cancel when the user was asked and did not accept"`
+	Removed      int              `json:"removed" jsonschema:"The number of objects removed"`
+	RemovedBytes int64            `json:"removedBytes" jsonschema:"The total size of the removed objects in bytes"`
+	// Failed is only set when some of the planned objects could not be removed
+	Failed              []CleanupFailure `json:"failed,omitempty" jsonschema:"The planned objects that could not be removed, which are left in the bucket and the library index"`
+	IndexEntriesRemoved int              `json:"indexEntriesRemoved" jsonschema:"The number of library index entries of removed objects that were deleted"`
+	Warnings            []string         `json:"warnings,omitempty" jsonschema:"Problems updating the library index or audit log after objects were removed"`
+	ProtectedPrefixes   []string         `json:"protectedPrefixes" jsonschema:"The prefixes holding the server's own state, which no rule removes objects from"`
+}
+
+// objectLister lists the objects of the articles bucket; replaced in tests
+var objectLister = func(ctx context.Context) ([]storage.ObjectInfo, error) {
+	if globalS3Config == nil {
+		return nil, fmt.Errorf("S3 configuration not loaded")
+	}
+	return storage.ListObjects(ctx, globalS3Config, S3_ARTICLES_BUCKET, "")
+}
+
+// objectRemover removes an object of the articles bucket; replaced in tests
+var objectRemover = func(ctx context.Context, objectName string) error {
+	if globalS3Config == nil {
+		return fmt.Errorf("S3 configuration not loaded")
+	}
+	return storage.RemoveObject(ctx, globalS3Config, S3_ARTICLES_BUCKET, objectName)
+}
+
+// cleanupApprover asks the user of the current call to approve a cleanup, returning the action they
+// took: accept, decline or cancel; replaced in tests
+var cleanupApprover = func(ctx context.Context, message string) (string, error) {
+	info, _ := callInfoFrom(ctx)
+	if info.session == nil {
+		return "", errors.New("the tool call has no MCP session to ask for approval")
+	}
+	if params := info.session.InitializeParams(); params == nil || params.Capabilities == nil || params.Capabilities.Elicitation == nil {
+		return "", errors.New("the MCP client does not support elicitation; set confirm instead")
+	}
+	result, err := info.session.Elicit(ctx, &mcp.ElicitParams{Message: message})
+	if err != nil {
+		return "", err
+	}
+	return result.Action, nil
+}
+
+// libraryCleanupIssues checks that the cleanup has a rule and that its ages are positive
+func libraryCleanupIssues(args LibraryCleanupArgs) []ValidationIssue {
+	var issues []ValidationIssue
+	rules := args.Rules
+	if len(rules.OlderThanDays) == 0 && !rules.KeepLatestVersionOnly && !rules.RemoveOrphanedText {
+		issues = append(issues, ValidationIssue{
+			Fields:  []string{"rules"},
+			Message: "no cleanup rule is set: set olderThanDays, keepLatestVersionOnly or removeOrphanedText",
+		})
+	}
+	for _, prefix := range slices.Sorted(maps.Keys(rules.OlderThanDays)) {
+		// An empty prefix selects the whole bucket, which is too easy to ask for by mistake
+		if trimmed := strings.TrimSpace(prefix); trimmed == "" || trimmed == "/" {
+			issues = append(issues, ValidationIssue{
+				Fields:  []string{"rules.olderThanDays"},
+				Message: fmt.Sprintf("olderThanDays prefix %q would select the whole bucket: name the prefix to clean up, e.g., exports/", prefix),
+			})
+		}
+		if days := rules.OlderThanDays[prefix]; days < 1 {
+			issues = append(issues, ValidationIssue{
+				Fields:  []string{"rules.olderThanDays"},
+				Message: fmt.Sprintf("olderThanDays of prefix %q is %d, but must be at least 1", prefix, days),
+			})
+		}
+	}
+	if args.Confirm && args.RequestApproval {
+		issues = append(issues, ValidationIssue{
+			Fields:  []string{"confirm", "requestApproval"},
+			Message: "confirm and requestApproval are mutually exclusive: confirm removes the objects without asking",
+		})
+	}
+	return issues
+}
+
+// planCleanup selects the objects the rules remove as of now, in name order, with the reasons of
+// every rule that selects them. Objects under the protected prefixes are never selected. The
+// articles of objects are taken from articleIDs, the identifiers recorded in the library index
+// by object name, and only read off the names of objects the index does not have.
+func planCleanup(objects []storage.ObjectInfo, articleIDs map[string]string, rules CleanupRules, now time.Time) []PlannedRemoval {
+	reasons := make(map[string][]string)
+	present := make(map[string]bool, len(objects))
+	var candidates []storage.ObjectInfo
+	for _, object := range objects {
+		present[object.Name] = true
+		if !cleanupProtected(object.Name) {
+			candidates = append(candidates, object)
+		}
+	}
+
+	prefixes := slices.Sorted(maps.Keys(rules.OlderThanDays))
+	for _, object := range candidates {
+		for _, prefix := range prefixes {
+			days := rules.OlderThanDays[prefix]
+			if strings.HasPrefix(object.Name, prefix) && now.Sub(object.LastModified) > time.Duration(days)*24*time.Hour {
+				reasons[object.Name] = append(reasons[object.Name], fmt.Sprintf("last modified more than %d days ago, under %q", days, prefix))
+			}
+		}
+	}
+
+	if rules.KeepLatestVersionOnly {
+		latest := make(map[string]arxivid.ID)
+		latestObject := make(map[string]string)
+		for _, object := range candidates {
+			if id, ok := versionedArticle(object.Name, articleIDs); ok && id.Version > latest[id.Base()].Version {
+				latest[id.Base()] = id
+				latestObject[id.Base()] = object.Name
+			}
+		}
+		for _, object := range candidates {
+			if id, ok := versionedArticle(object.Name, articleIDs); ok && id.Version < latest[id.Base()].Version {
+				reasons[object.Name] = append(reasons[object.Name], fmt.Sprintf("superseded by the later version %s", latestObject[id.Base()]))
+			}
+		}
+	}
+
+	// Text files are judged last, so that the PDFs removed by the other rules count as gone
+	if rules.RemoveOrphanedText {
+		for _, object := range candidates {
+			stem, ok := strings.CutSuffix(object.Name, ".txt")
+			if !ok {
+				continue
+			}
+			pdf := stem + ".pdf"
+			switch {
+			case !present[pdf]:
+				reasons[object.Name] = append(reasons[object.Name], fmt.Sprintf("orphaned text: its PDF %s is gone", pdf))
+			case len(reasons[pdf]) > 0:
+				reasons[object.Name] = append(reasons[object.Name], fmt.Sprintf("orphaned text: its PDF %s is removed by this cleanup", pdf))
+			}
+		}
+	}
+
+	plan := []PlannedRemoval{}
+	for _, object := range candidates {
+		if len(reasons[object.Name]) == 0 {
+			continue
+		}
+		plan = append(plan, PlannedRemoval{
+			ObjectName:   object.Name,
+			Size:         object.Size,
+			LastModified: object.LastModified.UTC().Format(time.RFC3339),
+			Reasons:      reasons[object.Name],
+		})
+	}
+	sort.Slice(plan, func(i, j int) bool {
+		return plan[i].ObjectName < plan[j].ObjectName
+	})
+	return plan
+}
+
+// cleanupProtected reports whether an object holds the server's own state
+func cleanupProtected(objectName string) bool {
+	for _, prefix := range cleanupProtectedPrefixes {
+		if strings.HasPrefix(objectName, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexedArticleIDs returns the article identifiers recorded in the library index by object name.
+// Without the index, cleanup falls back to reading the identifiers off the object names.
+func indexedArticleIDs(ctx context.Context) map[string]string {
+	articleIDs := make(map[string]string)
+	if globalLibrary == nil {
+		return articleIDs
+	}
+	entries, err := globalLibrary.Entries(ctx)
+	if err != nil {
+		slog.Warn("Failed to read the library index for the cleanup - identifying articles by object name", "error", err)
+		return articleIDs
+	}
+	for _, entry := range entries {
+		if entry.ArticleID != "" && entry.Status == "" {
+			articleIDs[entry.ObjectName] = entry.ArticleID
+		}
+	}
+	return articleIDs
+}
+
+// versionedArticle returns the identifier of an arXiv PDF with an explicit version, as recorded in
+// the library index or else as named by the default layout under arxiv/
+func versionedArticle(objectName string, articleIDs map[string]string) (arxivid.ID, bool) {
+	if !strings.HasSuffix(objectName, ".pdf") {
+		return arxivid.ID{}, false
+	}
+	canonical, ok := articleIDs[objectName]
+	if !ok {
+		canonical, ok = articleIDFromObjectName(objectName)
+	}
+	if !ok {
+		return arxivid.ID{}, false
+	}
+	id, err := arxivid.Parse(canonical)
+	if err != nil || id.Version == 0 {
+		return arxivid.ID{}, false
+	}
+	return id, true
+}
+
+// libraryCleanup plans the cleanup of the articles bucket by the given rules and, if confirmed or
+// approved by an admin client, removes the planned objects, their library index entries, and
+// records the cleanup in the audit log
+func libraryCleanup(ctx context.Context, input json.RawMessage) (any, error) {
+	var args LibraryCleanupArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+	if issues := libraryCleanupIssues(args); len(issues) > 0 {
+		return nil, invalidInputError(issues)
+	}
+	// Anyone may plan a cleanup, but removing objects cannot be undone
+	if info, _ := callInfoFrom(ctx); (args.Confirm || args.RequestApproval) && !info.Admin {
+		return nil, &ToolError{
+			Code:    ErrCodeUnauthorized,
+			Message: "executing a cleanup is only available to clients presenting the admin token; call without confirm and requestApproval to plan it",
+		}
+	}
+	objects, err := objectLister(ctx)
+	if err != nil {
+		if toolErr := storageToolError(err); toolErr != nil {
+			return nil, toolErr
+		}
+		return nil, fmt.Errorf("failed to list the bucket: %w", err)
+	}
+
+	output := &LibraryCleanupOutput{
+		DryRun:            true,
+		Objects:           planCleanup(objects, indexedArticleIDs(ctx), args.Rules, correctedNow()),
+		ProtectedPrefixes: cleanupProtectedPrefixes,
+	}
+	for _, planned := range output.Objects {
+		output.TotalBytes += planned.Size
+	}
+	switch {
+	case len(output.Objects) == 0:
+		return output, nil
+	case args.Confirm:
+		output.Approval = cleanupApprovedByConfirm
+	case args.RequestApproval:
+		action, err := cleanupApprover(ctx, fmt.Sprintf("Remove %d objects (%d bytes) from the bucket '%s'? This cannot be undone.", len(output.Objects), output.TotalBytes, S3_ARTICLES_BUCKET))
+		if err != nil {
+			return nil, fmt.Errorf("failed to ask for approval of the cleanup: %w", err)
+		}
+		output.Approval = action
+		if action != cleanupApprovalAccepted {
+			return output, nil
+		}
+	default:
+		return output, nil
+	}
+
+	output.DryRun = false
+	executeCleanup(ctx, output)
+	return output, nil
+}
+
+// executeCleanup removes the planned objects one by one, reporting those that fail without giving
+// up on the rest, then deletes the index entries of the removed objects and records the cleanup in
+// the audit log. Problems after objects were removed are reported as warnings, as the removal
+// itself cannot be undone.
+func executeCleanup(ctx context.Context, output *LibraryCleanupOutput) {
+	var removed []string
+	for _, planned := range output.Objects {
+		if err := ctx.Err(); err != nil {
+			output.Failed = append(output.Failed, CleanupFailure{ObjectName: planned.ObjectName, Error: err.Error()})
+			continue
+		}
+		if err := objectRemover(ctx, planned.ObjectName); err != nil {
+			slog.Warn("Failed to remove object in cleanup", "object", planned.ObjectName, "error", err)
+			output.Failed = append(output.Failed, CleanupFailure{ObjectName: planned.ObjectName, Error: err.Error()})
+			continue
+		}
+		removed = append(removed, planned.ObjectName)
+		output.RemovedBytes += planned.Size
+	}
+	output.Removed = len(removed)
+	slog.Info("Bucket cleaned up", "removed", output.Removed, "bytes", output.RemovedBytes, "failed", len(output.Failed))
+
+	// The index and audit log are updated even if the call was cancelled meanwhile
+	ctx = context.WithoutCancel(ctx)
+	if globalLibrary != nil && len(removed) > 0 {
+		deleted, err := globalLibrary.Remove(ctx, removed)
+		if err != nil {
+			output.Warnings = append(output.Warnings, fmt.Sprintf("failed to remove the entries of removed objects from the library index: %v", err))
+		}
+		output.IndexEntriesRemoved = deleted
+	}
+	if globalAuditLog != nil {
+		info, _ := callInfoFrom(ctx)
+		record := library.AuditRecord{
+			Action:    "cleanup",
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tool:      info.Tool,
+			SessionID: info.SessionID,
+			Client:    info.Client,
+			ClientID:  info.ClientID,
+			Objects:   removed,
+			Bytes:     output.RemovedBytes,
+		}
+		for _, failure := range output.Failed {
+			record.Failed = append(record.Failed, failure.ObjectName)
+		}
+		if err := globalAuditLog.Append(ctx, record); err != nil {
+			output.Warnings = append(output.Warnings, fmt.Sprintf("failed to record the cleanup in the audit log: %v", err))
+		}
+	}
+}
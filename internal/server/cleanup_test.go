@@ -0,0 +1,311 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/storage"
+)
+
+// cleanupNow is the time cleanups are planned at in tests
+var cleanupNow = time.Date(2024, 12, 1, 9, 0, 0, 0, time.UTC)
+
+// cleanupBucket is a bucket of superseded versions, text stubs, exports and the server's own state
+func cleanupBucket() []storage.ObjectInfo {
+	daysAgo := func(days int) time.Time { return cleanupNow.Add(-time.Duration(days) * 24 * time.Hour) }
+	return []storage.ObjectInfo{
+		{Name: "arxiv/2405.12345v1.pdf", Size: 1000, LastModified: daysAgo(200)},
+		{Name: "arxiv/2405.12345v1.txt", Size: 0, LastModified: daysAgo(200)},
+		{Name: "arxiv/2405.12345v2.pdf", Size: 1100, LastModified: daysAgo(100)},
+		{Name: "arxiv/2405.12345v2.txt", Size: 10, LastModified: daysAgo(100)},
+		{Name: "arxiv/1706.03762.pdf", Size: 2000, LastModified: daysAgo(300)},
+		{Name: "arxiv/hep-th_9901001v1.pdf", Size: 300, LastModified: daysAgo(50)},
+		{Name: "arxiv/hep-th_9901001v3.pdf", Size: 320, LastModified: daysAgo(10)},
+		{Name: "arxiv/2401.00001v1.txt", Size: 0, LastModified: daysAgo(5)},
+		{Name: "exports/20241001T090000Z.csv", Size: 40, LastModified: daysAgo(61)},
+		{Name: "exports/20241120T090000Z.csv", Size: 50, LastModified: daysAgo(11)},
+		{Name: "library/index.json", Size: 500, LastModified: daysAgo(400)},
+		{Name: "state/arxiv-quota.json", Size: 20, LastModified: daysAgo(400)},
+	}
+}
+
+func TestPlanCleanup(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules CleanupRules
+		want  map[string][]string
+	}{
+		{
+			"Older than days by prefix",
+			CleanupRules{OlderThanDays: map[string]int{"exports/": 30}},
+			map[string][]string{
+				"exports/20241001T090000Z.csv": {`last modified more than 30 days ago, under "exports/"`},
+			},
+		},
+		{
+			"An empty prefix spares the server's state",
+			CleanupRules{OlderThanDays: map[string]int{"": 250}},
+			map[string][]string{
+				"arxiv/1706.03762.pdf": {`last modified more than 250 days ago, under ""`},
+			},
+		},
+		{
+			"Keep latest version only",
+			CleanupRules{KeepLatestVersionOnly: true},
+			map[string][]string{
+				"arxiv/2405.12345v1.pdf":     {"superseded by the later version arxiv/2405.12345v2.pdf"},
+				"arxiv/hep-th_9901001v1.pdf": {"superseded by the later version arxiv/hep-th_9901001v3.pdf"},
+			},
+		},
+		{
+			"Orphaned text",
+			CleanupRules{RemoveOrphanedText: true},
+			map[string][]string{
+				"arxiv/2401.00001v1.txt": {"orphaned text: its PDF arxiv/2401.00001v1.pdf is gone"},
+			},
+		},
+		{
+			"Text of a PDF removed by the same cleanup",
+			CleanupRules{KeepLatestVersionOnly: true, RemoveOrphanedText: true},
+			map[string][]string{
+				"arxiv/2405.12345v1.pdf":     {"superseded by the later version arxiv/2405.12345v2.pdf"},
+				"arxiv/2405.12345v1.txt":     {"orphaned text: its PDF arxiv/2405.12345v1.pdf is removed by this cleanup"},
+				"arxiv/hep-th_9901001v1.pdf": {"superseded by the later version arxiv/hep-th_9901001v3.pdf"},
+				"arxiv/2401.00001v1.txt":     {"orphaned text: its PDF arxiv/2401.00001v1.pdf is gone"},
+			},
+		},
+		{
+			"Every rule selecting an object gives a reason",
+			CleanupRules{OlderThanDays: map[string]int{"arxiv/": 150, "arxiv/2405": 180}, KeepLatestVersionOnly: true},
+			map[string][]string{
+				"arxiv/2405.12345v1.pdf": {
+					`last modified more than 150 days ago, under "arxiv/"`,
+					`last modified more than 180 days ago, under "arxiv/2405"`,
+					"superseded by the later version arxiv/2405.12345v2.pdf",
+				},
+				"arxiv/2405.12345v1.txt": {
+					`last modified more than 150 days ago, under "arxiv/"`,
+					`last modified more than 180 days ago, under "arxiv/2405"`,
+				},
+				"arxiv/1706.03762.pdf":       {`last modified more than 150 days ago, under "arxiv/"`},
+				"arxiv/hep-th_9901001v1.pdf": {"superseded by the later version arxiv/hep-th_9901001v3.pdf"},
+			},
+		},
+		{
+			"Nothing selected",
+			CleanupRules{OlderThanDays: map[string]int{"web/": 1}},
+			map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planCleanup(cleanupBucket(), nil, tt.rules, cleanupNow)
+			got := make(map[string][]string, len(plan))
+			for i, planned := range plan {
+				got[planned.ObjectName] = planned.Reasons
+				if i > 0 && plan[i-1].ObjectName >= planned.ObjectName {
+					t.Errorf("plan is not in name order: %s before %s", plan[i-1].ObjectName, planned.ObjectName)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planCleanup() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLibraryCleanupIssues(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       LibraryCleanupArgs
+		wantFields [][]string
+	}{
+		{"Valid", LibraryCleanupArgs{Rules: CleanupRules{OlderThanDays: map[string]int{"exports/": 30}}}, nil},
+		{"No rule", LibraryCleanupArgs{Confirm: true}, [][]string{{"rules"}}},
+		{"Age below one day", LibraryCleanupArgs{Rules: CleanupRules{OlderThanDays: map[string]int{"exports/": 0}}}, [][]string{{"rules.olderThanDays"}}},
+		{"Empty prefix", LibraryCleanupArgs{Rules: CleanupRules{OlderThanDays: map[string]int{"": 30}}}, [][]string{{"rules.olderThanDays"}}},
+		{"Root prefix", LibraryCleanupArgs{Rules: CleanupRules{OlderThanDays: map[string]int{"/": 30}}}, [][]string{{"rules.olderThanDays"}}},
+		{
+			"Confirm and approval",
+			LibraryCleanupArgs{Rules: CleanupRules{RemoveOrphanedText: true}, Confirm: true, RequestApproval: true},
+			[][]string{{"confirm", "requestApproval"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]string
+			for _, issue := range libraryCleanupIssues(tt.args) {
+				got = append(got, issue.Fields)
+			}
+			if !reflect.DeepEqual(got, tt.wantFields) {
+				t.Errorf("libraryCleanupIssues() fields = %q, want %q", got, tt.wantFields)
+			}
+		})
+	}
+}
+
+// cleanupFixture serves cleanupBucket, indexes its PDFs and records removals, failing those of
+// the objects in failing; it returns the names of the removed objects
+func cleanupFixture(t *testing.T, failing ...string) *[]string {
+	t.Helper()
+	originalLibrary, originalAudit := globalLibrary, globalAuditLog
+	originalLister, originalRemover, originalApprover := objectLister, objectRemover, cleanupApprover
+	t.Cleanup(func() {
+		globalLibrary, globalAuditLog = originalLibrary, originalAudit
+		objectLister, objectRemover, cleanupApprover = originalLister, originalRemover, originalApprover
+	})
+	globalLibrary = library.New(&library.MemoryStore{})
+	globalAuditLog = library.NewAuditLog(&library.MemoryStore{})
+	for _, object := range cleanupBucket() {
+		if strings.HasSuffix(object.Name, ".pdf") {
+			if err := globalLibrary.Record(context.Background(), library.Entry{ObjectName: object.Name, Bucket: S3_ARTICLES_BUCKET}); err != nil {
+				t.Fatalf("failed to record fixture entry: %v", err)
+			}
+		}
+	}
+
+	var removed []string
+	objectLister = func(ctx context.Context) ([]storage.ObjectInfo, error) {
+		// The objects are as old now as they are at cleanupNow
+		objects := cleanupBucket()
+		for i := range objects {
+			objects[i].LastModified = objects[i].LastModified.Add(time.Since(cleanupNow))
+		}
+		return objects, nil
+	}
+	objectRemover = func(ctx context.Context, objectName string) error {
+		for _, name := range failing {
+			if name == objectName {
+				return errors.New("failed to remove object: access denied")
+			}
+		}
+		removed = append(removed, objectName)
+		return nil
+	}
+	cleanupApprover = func(ctx context.Context, message string) (string, error) {
+		t.Errorf("unexpected approval request %q", message)
+		return "", errors.New("unexpected")
+	}
+	return &removed
+}
+
+func TestLibraryCleanupDryRunByDefault(t *testing.T) {
+	removed := cleanupFixture(t)
+
+	output, err := libraryCleanup(context.Background(), json.RawMessage(`{"rules": {"keepLatestVersionOnly": true, "removeOrphanedText": true}}`))
+	if err != nil {
+		t.Fatalf("libraryCleanup() unexpected error: %v", err)
+	}
+	result := output.(*LibraryCleanupOutput)
+	if !result.DryRun || len(result.Objects) != 4 || result.TotalBytes != 1300 || result.Removed != 0 {
+		t.Errorf("libraryCleanup() = %+v, want a plan of 4 objects and 1300 bytes", result)
+	}
+	if len(*removed) != 0 {
+		t.Errorf("a dry run removed %q", *removed)
+	}
+	if records, _ := globalAuditLog.Records(context.Background()); len(records) != 0 {
+		t.Errorf("a dry run recorded %+v in the audit log", records)
+	}
+}
+
+func TestLibraryCleanupExecutesWithPartialFailure(t *testing.T) {
+	removed := cleanupFixture(t, "arxiv/hep-th_9901001v1.pdf")
+	ctx := withCallInfo(context.Background(), callInfo{Admin: true})
+
+	output, err := libraryCleanup(ctx, json.RawMessage(`{"rules": {"keepLatestVersionOnly": true, "removeOrphanedText": true}, "confirm": true}`))
+	if err != nil {
+		t.Fatalf("libraryCleanup() unexpected error: %v", err)
+	}
+	result := output.(*LibraryCleanupOutput)
+	wantRemoved := []string{"arxiv/2401.00001v1.txt", "arxiv/2405.12345v1.pdf", "arxiv/2405.12345v1.txt"}
+	if !reflect.DeepEqual(*removed, wantRemoved) {
+		t.Errorf("removed %q, want %q", *removed, wantRemoved)
+	}
+	if result.DryRun || result.Approval != cleanupApprovedByConfirm || result.Removed != 3 || result.RemovedBytes != 1000 || result.IndexEntriesRemoved != 1 {
+		t.Errorf("libraryCleanup() = %+v, want 3 objects of 1000 bytes and 1 index entry removed", result)
+	}
+	if len(result.Failed) != 1 || result.Failed[0].ObjectName != "arxiv/hep-th_9901001v1.pdf" || !strings.Contains(result.Failed[0].Error, "access denied") {
+		t.Errorf("failed = %+v, want the object that could not be removed", result.Failed)
+	}
+
+	// The index keeps the entry of the object that could not be removed
+	if _, err := globalLibrary.Get(ctx, "arxiv/2405.12345v1.pdf"); !errors.Is(err, library.ErrNotFound) {
+		t.Errorf("index entry of a removed object: error = %v, want ErrNotFound", err)
+	}
+	if _, err := globalLibrary.Get(ctx, "arxiv/hep-th_9901001v1.pdf"); err != nil {
+		t.Errorf("index entry of a failed object: unexpected error %v", err)
+	}
+
+	records, err := globalAuditLog.Records(ctx)
+	if err != nil {
+		t.Fatalf("Records() unexpected error: %v", err)
+	}
+	if len(records) != 1 || records[0].Action != "cleanup" || !reflect.DeepEqual(records[0].Objects, wantRemoved) ||
+		records[0].Bytes != 1000 || !reflect.DeepEqual(records[0].Failed, []string{"arxiv/hep-th_9901001v1.pdf"}) {
+		t.Errorf("audit log = %+v, want the removed and failed objects of the cleanup", records)
+	}
+}
+
+func TestLibraryCleanupApproval(t *testing.T) {
+	for _, action := range []string{"accept", "decline", "cancel"} {
+		t.Run(action, func(t *testing.T) {
+			removed := cleanupFixture(t)
+			var asked string
+			cleanupApprover = func(ctx context.Context, message string) (string, error) {
+				asked = message
+				return action, nil
+			}
+
+			ctx := withCallInfo(context.Background(), callInfo{Admin: true})
+			output, err := libraryCleanup(ctx, json.RawMessage(`{"rules": {"olderThanDays": {"exports/": 30}}, "requestApproval": true}`))
+			if err != nil {
+				t.Fatalf("libraryCleanup() unexpected error: %v", err)
+			}
+			result := output.(*LibraryCleanupOutput)
+			if !strings.Contains(asked, "Remove 1 objects (40 bytes)") {
+				t.Errorf("asked %q, want the size of the plan", asked)
+			}
+			accepted := action == cleanupApprovalAccepted
+			if result.Approval != action || result.DryRun == accepted || (len(*removed) == 1) != accepted {
+				t.Errorf("libraryCleanup() = %+v after removing %q, want the plan executed only if accepted", result, *removed)
+			}
+		})
+	}
+}
+
+func TestLibraryCleanupExecutionRequiresAdmin(t *testing.T) {
+	for _, arguments := range []string{
+		`{"rules": {"removeOrphanedText": true}, "confirm": true}`,
+		`{"rules": {"removeOrphanedText": true}, "requestApproval": true}`,
+	} {
+		t.Run(arguments, func(t *testing.T) {
+			removed := cleanupFixture(t)
+			ctx := withCallInfo(context.Background(), callInfo{Admin: false})
+
+			_, err := libraryCleanup(ctx, json.RawMessage(arguments))
+			var toolErr *ToolError
+			if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeUnauthorized {
+				t.Fatalf("libraryCleanup() error = %v, want %s", err, ErrCodeUnauthorized)
+			}
+			if len(*removed) != 0 {
+				t.Errorf("a refused cleanup removed %q", *removed)
+			}
+		})
+	}
+
+	// Planning stays open to every client
+	cleanupFixture(t)
+	output, err := libraryCleanup(withCallInfo(context.Background(), callInfo{Admin: false}), json.RawMessage(`{"rules": {"removeOrphanedText": true}}`))
+	if err != nil {
+		t.Fatalf("libraryCleanup() dry run unexpected error: %v", err)
+	}
+	if result := output.(*LibraryCleanupOutput); !result.DryRun || len(result.Objects) == 0 {
+		t.Errorf("libraryCleanup() = %+v, want a plan", result)
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"opus-mcp/internal/clock"
+	"opus-mcp/internal/settings"
+)
+
+// ClockConfig holds the clock sanity check configuration loaded from environment variables
+type ClockConfig struct {
+	// SkewThreshold is how far the server clock may be off the clocks of arXiv and S3 storage, as
+	// measured from the Date headers of their responses, before a warning is logged
+	SkewThreshold settings.Duration `env:"OPUS_MCP_CLOCK_SKEW_THRESHOLD,default=2m"`
+	// Correction applies the measured skew to the date-sensitive computations: the rollover of the
+	// daily arXiv quota, the dates arXiv asks to retry at and the age rules of library cleanup
+	Correction bool `env:"OPUS_MCP_CLOCK_SKEW_CORRECTION,default=false"`
+	// CheckInterval is how often the latest measurement is checked against the threshold, to repeat
+	// the warning while the clock stays off
+	CheckInterval settings.Duration `env:"OPUS_MCP_CLOCK_CHECK_INTERVAL,default=1h"`
+}
+
+// LoadClockConfig loads the clock sanity check configuration from environment variables
+func LoadClockConfig() (*ClockConfig, error) {
+	var config ClockConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process clock configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// clockSkew measures the skew of the server clock from arXiv and S3 responses; replaced in tests
+var clockSkew = clock.Shared
+
+// clockCorrection applies the measured skew in correctedNow
+var clockCorrection = false
+
+// clockCheckInterval is how often the measured skew is checked against the threshold
+var clockCheckInterval = time.Hour
+
+// correctedClock returns a clock telling the time of base, corrected by the measured skew when so
+// configured
+func correctedClock(base func() time.Time) func() time.Time {
+	return func() time.Time {
+		if !clockCorrection {
+			return base()
+		}
+		return clockSkew.Correct(base())
+	}
+}
+
+// correctedNow is the current time of date-sensitive computations; replaced in tests
+var correctedNow = correctedClock(time.Now)
+
+// ClockStatus reports the latest measured skew of the server clock
+type ClockStatus struct {
+	// SkewSeconds is the remote time minus the server time: positive when the server clock is behind
+	SkewSeconds      float64 `json:"skewSeconds"`
+	Source           string  `json:"source"`
+	MeasuredAt       string  `json:"measuredAt"`
+	ThresholdSeconds float64 `json:"thresholdSeconds"`
+	ExceedsThreshold bool    `json:"exceedsThreshold"`
+	Corrected        bool    `json:"corrected"`
+}
+
+// clockStatus returns the latest measured skew of the server clock, or nil before any response
+// with a Date header has been received
+func clockStatus() *ClockStatus {
+	measurement, ok := clockSkew.Latest()
+	if !ok {
+		return nil
+	}
+	return &ClockStatus{
+		SkewSeconds:      measurement.Skew.Round(time.Millisecond).Seconds(),
+		Source:           measurement.Source,
+		MeasuredAt:       measurement.At.UTC().Format(time.RFC3339),
+		ThresholdSeconds: clockSkew.Threshold().Seconds(),
+		ExceedsThreshold: clockSkew.Exceeded(),
+		Corrected:        clockCorrection,
+	}
+}
+
+// checkClock logs the latest measured skew: as a warning while it exceeds the threshold, since the
+// estimator only warns when it starts to
+func checkClock() {
+	status := clockStatus()
+	switch {
+	case status == nil:
+		slog.Debug("The server clock has not been measured yet")
+	case status.ExceedsThreshold:
+		slog.Warn("The server clock is still off the clock of a remote server; date-sensitive results may be wrong",
+			"source", status.Source, "skew_seconds", status.SkewSeconds, "measured_at", status.MeasuredAt, "corrected", status.Corrected)
+	default:
+		slog.Debug("The server clock is in step with remote servers", "source", status.Source, "skew_seconds", status.SkewSeconds)
+	}
+}
+
+// startClockCheck checks the measured skew once now, e.g., from the storage responses of startup,
+// and then at every interval until the context is done
+func startClockCheck(ctx context.Context, interval time.Duration) {
+	checkClock()
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				checkClock()
+			}
+		}
+	}()
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/clock"
+)
+
+// withClockSkew measures a skew of the server clock from a response dated skew after local, and
+// enables the correction
+func withClockSkew(t *testing.T, local time.Time, skew time.Duration) {
+	t.Helper()
+	originalSkew, originalCorrection := clockSkew, clockCorrection
+	t.Cleanup(func() { clockSkew, clockCorrection = originalSkew, originalCorrection })
+	clockSkew = clock.NewEstimator(2 * time.Minute)
+	// The Date header is truncated to the second and read as half a second later
+	clockSkew.Observe("arxiv", http.Header{"Date": {local.Add(skew).Add(-500 * time.Millisecond).UTC().Format(http.TimeFormat)}}, local)
+	clockCorrection = true
+}
+
+func TestCorrectedClock(t *testing.T) {
+	tests := []struct {
+		name    string
+		local   time.Time
+		skew    time.Duration
+		wantDay string
+	}{
+		// arXiv's clock has passed midnight while the server's has not
+		{"server clock behind", time.Date(2024, 11, 7, 23, 58, 0, 500_000_000, time.UTC), 5 * time.Minute, "2024-11-08"},
+		// The server's clock has passed midnight while arXiv's has not
+		{"server clock ahead", time.Date(2024, 11, 8, 0, 2, 0, 500_000_000, time.UTC), -5 * time.Minute, "2024-11-07"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withClockSkew(t, tt.local, tt.skew)
+			local := &testClock{now: tt.local}
+			now := correctedClock(local.Now)
+			if got := now(); !got.Equal(tt.local.Add(tt.skew)) {
+				t.Errorf("corrected clock = %v, want %v", got, tt.local.Add(tt.skew))
+			}
+
+			// The daily quota rolls over on arXiv's day, not the server's
+			quota := newDailyQuota(1, nil, now)
+			if err := quota.take(context.Background(), arxivRequestAPI); err != nil {
+				t.Fatalf("take() unexpected error: %v", err)
+			}
+			if status := quota.status(); status.Day != tt.wantDay {
+				t.Errorf("quota day = %s, want %s", status.Day, tt.wantDay)
+			}
+
+			// A Retry-After date of arXiv's clock is waited for as long as arXiv meant
+			c := &cooldown{now: now}
+			retryAt := tt.local.Add(tt.skew).Add(2 * time.Minute).UTC().Truncate(time.Second)
+			err := c.observe(&http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {retryAt.Format(http.TimeFormat)}}})
+			if err == nil || err.RetryAfterSeconds != 120 {
+				t.Errorf("observe() = %+v, want a retry after the 120 seconds arXiv meant", err)
+			}
+
+			// Without the correction, the server's own clock is used
+			clockCorrection = false
+			if got := now(); !got.Equal(tt.local) {
+				t.Errorf("uncorrected clock = %v, want %v", got, tt.local)
+			}
+		})
+	}
+}
+
+func TestClockStatusInHealth(t *testing.T) {
+	originalSkew, originalCorrection := clockSkew, clockCorrection
+	t.Cleanup(func() { clockSkew, clockCorrection = originalSkew, originalCorrection })
+	clockSkew = clock.NewEstimator(2 * time.Minute)
+	clockCorrection = false
+
+	health := func() map[string]json.RawMessage {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		healthCheckHandler(rec, httptest.NewRequest(http.MethodGet, "/health?verbose=true", nil))
+		var response map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to unmarshal health response: %v", err)
+		}
+		return response
+	}
+	if _, ok := health()["clock"]; ok {
+		t.Error("health reported a clock before any response measured it")
+	}
+
+	// Responses from a server whose clock is ten minutes ahead, e.g., S3 storage
+	arrived := time.Now()
+	clockSkew.Observe("s3", http.Header{"Date": {arrived.Add(10 * time.Minute).UTC().Format(http.TimeFormat)}}, arrived)
+	var status ClockStatus
+	if err := json.Unmarshal(health()["clock"], &status); err != nil {
+		t.Fatalf("failed to unmarshal clock status: %v", err)
+	}
+	if status.Source != "s3" || status.SkewSeconds < 599 || status.SkewSeconds > 601 || !status.ExceedsThreshold || status.ThresholdSeconds != 120 || status.Corrected {
+		t.Errorf("clock status = %+v, want a skew of about 600 seconds from s3 beyond the threshold", status)
+	}
+
+	// A response from a server whose clock is behind replaces the measurement
+	clockSkew.Observe("arxiv", http.Header{"Date": {arrived.Add(-30 * time.Second).UTC().Format(http.TimeFormat)}}, arrived)
+	if status := clockStatus(); status.Source != "arxiv" || status.SkewSeconds > -29 || status.SkewSeconds < -31 || status.ExceedsThreshold {
+		t.Errorf("clock status = %+v, want a skew of about -30 seconds from arxiv within the threshold", status)
+	}
+}
+
+func TestArxivResponsesMeasureClockSkew(t *testing.T) {
+	originalSkew := clockSkew
+	t.Cleanup(func() { clockSkew = originalSkew })
+	clockSkew = clock.NewEstimator(2 * time.Minute)
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+		_, _ = w.Write([]byte(idListFeed([]string{"2405.00001"})))
+	})
+
+	if _, err := fetchIDBatch(context.Background(), []string{"2405.00001"}, false); err != nil {
+		t.Fatalf("fetchIDBatch() unexpected error: %v", err)
+	}
+	measurement, ok := clockSkew.Latest()
+	if !ok || measurement.Source != "arxiv" || measurement.Skew > -59*time.Minute {
+		t.Errorf("measurement = %+v, %v, want arXiv's clock an hour behind", measurement, ok)
+	}
+}
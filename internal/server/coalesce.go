@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"opus-mcp/internal/metrics"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// coalescedCall is a tool call execution that identical concurrent calls can wait on and share
+type coalescedCall struct {
+	done    chan struct{}
+	result  *mcp.CallToolResult
+	outcome string
+	// dups is the number of callers waiting to share the execution
+	dups int
+	// cancelled reports that the execution ended because the call running it was cancelled, which
+	// says nothing about the calls waiting on it
+	cancelled bool
+}
+
+// callGroup coalesces concurrent executions with the same key, in the manner of singleflight:
+// while an execution is in flight, later callers with the same key wait for it and share its result
+type callGroup struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// do executes fn unless an execution with the same key is already in flight, in which case it waits
+// for that execution. It reports whether the result was shared from another caller's execution. A
+// caller whose context is cancelled stops waiting without affecting the execution, and one whose
+// execution was cancelled by the call running it executes fn again itself.
+func (g *callGroup) do(ctx context.Context, key string, fn func() (*mcp.CallToolResult, string)) (*coalescedCall, bool, error) {
+	for {
+		g.mu.Lock()
+		if g.calls == nil {
+			g.calls = make(map[string]*coalescedCall)
+		}
+		call, ok := g.calls[key]
+		if !ok {
+			return g.run(ctx, key, fn), false, nil
+		}
+		call.dups++
+		g.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			g.mu.Lock()
+			call.dups--
+			g.mu.Unlock()
+			return nil, false, ctx.Err()
+		}
+		if call.cancelled {
+			continue
+		}
+		return call, true, nil
+	}
+}
+
+// run registers and executes a call that others can wait on, removing it once it completes; the
+// caller holds mu, which run releases
+func (g *callGroup) run(ctx context.Context, key string, fn func() (*mcp.CallToolResult, string)) *coalescedCall {
+	call := &coalescedCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	// Removed even if the execution panics, so that later calls with the key do not wait forever
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+	call.result, call.outcome = fn()
+	call.cancelled = ctx.Err() != nil
+	return call
+}
+
+// coalesced runs a call, sharing the execution with any identical call already in flight.
+// The call that executes runs with its own context; if it is cancelled, the calls sharing it run again.
+func (h *ArxivToolHandler) coalesced(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, string) {
+	key, err := coalescingKey(req.Params.Name, req.Params.Arguments)
+	if err != nil {
+		// Arguments that cannot be normalised are left for input validation to reject
+		return h.admitAndHandle(ctx, req)
+	}
+
+	call, shared, err := h.inflight.do(ctx, key, func() (*mcp.CallToolResult, string) {
+		return h.admitAndHandle(ctx, req)
+	})
+	if err != nil {
+		if cancelErr := cancelledToolError(ctx); cancelErr != nil {
+			return mcp_tool_error(cancelErr), "cancelled"
+		}
+		return mcp_tool_error(executionToolError(err)), "error"
+	}
+	if shared {
+		metrics.ToolCallsCoalescedTotal.WithLabelValues(req.Params.Name).Inc()
+	}
+	// Each caller gets its own copy of the result
+	result := *call.result
+	return &result, call.outcome
+}
+
+// coalescingKey identifies calls that can share an execution: the tool name and a hash of the
+// arguments, normalised so that key order and whitespace do not matter
+func coalescingKey(toolName string, arguments json.RawMessage) (string, error) {
+	var args any
+	if len(arguments) > 0 {
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return "", err
+		}
+	}
+	// Maps are marshalled with sorted keys, which gives a canonical encoding
+	normalised, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(normalised)
+	return toolName + ":" + hex.EncodeToString(digest[:]), nil
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/metrics"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// waitFor polls until cond holds or fails the test after a timeout
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoalescingIdenticalCalls(t *testing.T) {
+	var upstream atomic.Int32
+	release := make(chan struct{})
+	handler := newTestToolHandler(t, func(ctx context.Context, input json.RawMessage) (any, error) {
+		upstream.Add(1)
+		<-release
+		return map[string]any{"entries": 3}, nil
+	})
+	handler.coalesce = true
+
+	const toolName = "coalesce_identical_tool"
+	coalescedBefore := testutil.ToFloat64(metrics.ToolCallsCoalescedTotal.WithLabelValues(toolName))
+
+	// Key order and whitespace differ but the arguments are identical
+	arguments := []string{
+		`{"category":"cs.AI","fetchSize":10}`,
+		`{"fetchSize":10,"category":"cs.AI"}`,
+		`{ "category": "cs.AI", "fetchSize": 10 }`,
+		`{"category":"cs.AI","fetchSize":10.0}`,
+		`{"fetchSize":10, "category":"cs.AI"}`,
+	}
+	results := make([]*mcp.CallToolResult, len(arguments))
+	var wg sync.WaitGroup
+	for i, args := range arguments {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := handler.Handle(context.Background(), newTestCallToolRequest(toolName, args))
+			if err != nil {
+				t.Errorf("Handle() returned protocol error: %v", err)
+			}
+			results[i] = result
+		}()
+	}
+
+	// Let the first call reach the upstream and the others join it before releasing it
+	waitFor(t, "the first upstream request", func() bool { return upstream.Load() == 1 })
+	waitFor(t, "the remaining calls to join", func() bool {
+		handler.inflight.mu.Lock()
+		defer handler.inflight.mu.Unlock()
+		for _, call := range handler.inflight.calls {
+			return call.dups == len(arguments)-1
+		}
+		return false
+	})
+	close(release)
+	wg.Wait()
+
+	if got := upstream.Load(); got != 1 {
+		t.Errorf("upstream requests = %d, want exactly 1", got)
+	}
+	for i, result := range results {
+		if result == nil || result.IsError {
+			t.Fatalf("call %d did not succeed: %+v", i, result)
+		}
+		if text := resultText(t, result); text != `{"entries":3}` {
+			t.Errorf("call %d result = %s, want the shared result", i, text)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.ToolCallsCoalescedTotal.WithLabelValues(toolName)) - coalescedBefore; got != 4 {
+		t.Errorf("coalesced calls metric increased by %v, want 4", got)
+	}
+}
+
+func TestCoalescingCancelledCaller(t *testing.T) {
+	tests := []struct {
+		name string
+		// cancelled is the caller that cancels, where the first caller runs the execution
+		cancelled    int
+		wantUpstream int32
+	}{
+		{"Waiting caller cancels", 2, 1},
+		{"Executing caller cancels", 0, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upstream atomic.Int32
+			release := make(chan struct{})
+			handler := newTestToolHandler(t, func(ctx context.Context, input json.RawMessage) (any, error) {
+				upstream.Add(1)
+				select {
+				case <-release:
+					return map[string]any{"entries": 3}, nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			})
+			handler.coalesce = true
+			joined := func(dups int) func() bool {
+				return func() bool {
+					handler.inflight.mu.Lock()
+					defer handler.inflight.mu.Unlock()
+					for _, call := range handler.inflight.calls {
+						return call.dups == dups
+					}
+					return false
+				}
+			}
+
+			const callers = 5
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			results := make([]*mcp.CallToolResult, callers)
+			var wg sync.WaitGroup
+			call := func(i int) {
+				callCtx := context.Background()
+				if i == tt.cancelled {
+					callCtx = ctx
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					results[i], _ = handler.Handle(callCtx, newTestCallToolRequest("coalesce_cancel_tool", `{"category":"cs.AI"}`))
+				}()
+			}
+
+			call(0)
+			waitFor(t, "the first upstream request", func() bool { return upstream.Load() == 1 })
+			for i := 1; i < callers; i++ {
+				call(i)
+			}
+			waitFor(t, "the remaining calls to join", joined(callers-1))
+			cancel()
+			if tt.cancelled == 0 {
+				// The calls left waiting run again, with one of them executing for the others
+				waitFor(t, "the repeated upstream request", func() bool { return upstream.Load() == 2 })
+				waitFor(t, "the remaining calls to rejoin", joined(callers-2))
+			} else {
+				waitFor(t, "the cancelled call to leave", joined(callers-2))
+			}
+			close(release)
+			wg.Wait()
+
+			if got := upstream.Load(); got != tt.wantUpstream {
+				t.Errorf("upstream requests = %d, want %d", got, tt.wantUpstream)
+			}
+			for i, result := range results {
+				if i == tt.cancelled {
+					if !result.IsError || !strings.Contains(resultText(t, result), ErrCodeCancelled) {
+						t.Errorf("cancelled call %d result = %s, want a cancellation error", i, resultText(t, result))
+					}
+					continue
+				}
+				if result.IsError {
+					t.Fatalf("call %d did not succeed: %s", i, resultText(t, result))
+				}
+				if text := resultText(t, result); text != `{"entries":3}` {
+					t.Errorf("call %d result = %s, want the shared result", i, text)
+				}
+			}
+		})
+	}
+}
+
+func TestCoalescingDifferentArgumentsNeverShare(t *testing.T) {
+	var upstream atomic.Int32
+	release := make(chan struct{})
+	handler := newTestToolHandler(t, func(ctx context.Context, input json.RawMessage) (any, error) {
+		upstream.Add(1)
+		<-release
+		return json.RawMessage(input), nil
+	})
+	handler.coalesce = true
+
+	arguments := []string{
+		`{"category":"cs.AI","fetchSize":10}`,
+		`{"category":"cs.AI","fetchSize":11}`,
+		`{"category":"cs.LG","fetchSize":10}`,
+	}
+	results := make([]*mcp.CallToolResult, len(arguments))
+	var wg sync.WaitGroup
+	for i, args := range arguments {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = handler.Handle(context.Background(), newTestCallToolRequest("coalesce_distinct_tool", args))
+		}()
+	}
+
+	// All three calls must reach the upstream concurrently
+	waitFor(t, "three upstream requests", func() bool { return upstream.Load() == 3 })
+	close(release)
+	wg.Wait()
+
+	for i, result := range results {
+		var got, want any
+		if err := json.Unmarshal([]byte(resultText(t, result)), &got); err != nil {
+			t.Fatalf("call %d result is not JSON: %v", i, err)
+		}
+		_ = json.Unmarshal([]byte(arguments[i]), &want)
+		if gotJSON, _ := json.Marshal(got); string(gotJSON) != mustMarshal(t, want) {
+			t.Errorf("call %d received %s, want its own result %s", i, gotJSON, arguments[i])
+		}
+	}
+}
+
+func mustMarshal(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	return string(data)
+}
+
+func TestCoalescingKey(t *testing.T) {
+	a, err := coalescingKey("tool", json.RawMessage(`{"b":1,"a":[1,2]}`))
+	if err != nil {
+		t.Fatalf("coalescingKey() unexpected error: %v", err)
+	}
+	b, _ := coalescingKey("tool", json.RawMessage(`{"a":[1,2],"b":1}`))
+	c, _ := coalescingKey("tool", json.RawMessage(`{"a":[2,1],"b":1}`))
+	d, _ := coalescingKey("other_tool", json.RawMessage(`{"a":[1,2],"b":1}`))
+	if a != b {
+		t.Error("keys should not depend on argument order")
+	}
+	if a == c {
+		t.Error("keys should depend on array element order")
+	}
+	if a == d {
+		t.Error("keys should depend on the tool name")
+	}
+	if _, err := coalescingKey("tool", json.RawMessage(`{not json`)); err == nil {
+		t.Error("coalescingKey() should fail on malformed arguments")
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"opus-mcp/internal"
+)
+
+// defaultCooldown is how long arXiv requests are held back after a 429 response without a usable
+// Retry-After header
+const defaultCooldown = time.Minute
+
+// cooldown holds back arXiv requests after arXiv answered one with 429 Too Many Requests, or with
+// 503 Service Unavailable and a Retry-After header, until the time it asked for. Calls made in the
+// meantime fail fast instead of waiting on the rate limiter for a request arXiv would refuse.
+type cooldown struct {
+	mu    sync.Mutex
+	until time.Time
+	now   func() time.Time
+}
+
+// arxivCooldown is the cooldown shared by every arXiv-bound request, on the corrected clock since
+// Retry-After may be a date of arXiv's clock
+var arxivCooldown = &cooldown{now: correctedNow}
+
+// check returns an error if arXiv requests are being held back, without making one
+func (c *cooldown) check() *ToolError {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if !now.Before(c.until) {
+		return nil
+	}
+	return c.rateLimited(now, "arXiv asked for requests to be held back, so the call was not attempted")
+}
+
+// observe starts a cooldown if an arXiv response asks the server to back off, returning the error
+// to fail the call with, or nil if the response does not
+func (c *cooldown) observe(resp *http.Response) *ToolError {
+	header := resp.Header.Get("Retry-After")
+	if resp.StatusCode != http.StatusTooManyRequests && (resp.StatusCode != http.StatusServiceUnavailable || header == "") {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	wait, ok := internal.ParseRetryAfter(header, now)
+	if !ok {
+		wait = defaultCooldown
+	}
+	if until := now.Add(wait); until.After(c.until) {
+		c.until = until
+	}
+	slog.Warn("arXiv asked for requests to be held back", "status", resp.StatusCode, "retry_after", header, "until", c.until)
+	message := fmt.Sprintf("arXiv answered HTTP %d and asked for requests to be held back", resp.StatusCode)
+	if header != "" {
+		message = fmt.Sprintf("arXiv answered HTTP %d with Retry-After %s and asked for requests to be held back", resp.StatusCode, header)
+	}
+	toolErr := c.rateLimited(now, message)
+	if header != "" {
+		toolErr.Details["retryAfterHeader"] = header
+	}
+	return toolErr
+}
+
+// rateLimited returns the error refusing a call until the cooldown ends; the caller holds mu
+func (c *cooldown) rateLimited(now time.Time, message string) *ToolError {
+	toolErr := &ToolError{
+		Code:    ErrCodeRateLimited,
+		Message: message,
+		Details: map[string]any{"source": "arxiv"},
+	}
+	return toolErr.withRetryAt(c.until.Sub(now), now)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// withCooldown replaces the arXiv cooldown with one on the given clock for the duration of the test
+func withCooldown(t *testing.T, now func() time.Time) {
+	t.Helper()
+	original := arxivCooldown
+	t.Cleanup(func() { arxivCooldown = original })
+	arxivCooldown = &cooldown{now: now}
+}
+
+func TestFetchIDBatchHonoursRetryAfter(t *testing.T) {
+	clock := &testClock{now: time.Date(2026, 2, 3, 14, 3, 0, 0, time.UTC)}
+	withCooldown(t, clock.Now)
+	var requests atomic.Int32
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(idListFeed([]string{"2405.00001"})))
+	})
+
+	_, err := fetchIDBatch(context.Background(), []string{"2405.00001"}, false)
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeRateLimited {
+		t.Fatalf("fetchIDBatch() answered with 429 error = %v, want %s", err, ErrCodeRateLimited)
+	}
+	if toolErr.RetryAfterSeconds != 120 || toolErr.Details["retryAt"] != "2026-02-03T14:05:00Z" || !toolErr.Retryable {
+		t.Errorf("rate limited error = %+v, want a retry after 120 seconds at 14:05", toolErr)
+	}
+
+	// During the cooldown, calls fail fast with the remaining wait
+	clock.Advance(30 * time.Second)
+	_, err = fetchIDBatch(context.Background(), []string{"2405.00001"}, false)
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeRateLimited || toolErr.RetryAfterSeconds != 90 {
+		t.Errorf("fetchIDBatch() during the cooldown error = %v, want %s after 90 seconds", err, ErrCodeRateLimited)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("arXiv received %d requests, want none during the cooldown", got)
+	}
+
+	clock.Advance(90 * time.Second)
+	if _, err := fetchIDBatch(context.Background(), []string{"2405.00001"}, false); err != nil {
+		t.Errorf("fetchIDBatch() after the cooldown unexpected error: %v", err)
+	}
+}
+
+func TestCooldownIgnoresUnavailableWithoutRetryAfter(t *testing.T) {
+	clock := &testClock{now: time.Date(2026, 2, 3, 14, 0, 0, 0, time.UTC)}
+	c := &cooldown{now: clock.Now}
+	if err := c.observe(&http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}); err != nil {
+		t.Errorf("observe() of a 503 without Retry-After = %v, want nil", err)
+	}
+	// A 429 without a usable Retry-After still backs off, for the default cooldown
+	err := c.observe(&http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"later"}}})
+	if err == nil || err.RetryAfterSeconds != int64(defaultCooldown.Seconds()) {
+		t.Errorf("observe() of a 429 with an unusable Retry-After = %+v, want the default cooldown", err)
+	}
+}
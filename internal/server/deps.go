@@ -0,0 +1,47 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"opus-mcp/internal"
+
+	"golang.org/x/time/rate"
+)
+
+// httpDoer sends HTTP requests; *http.Client implements it
+type httpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// ToolDeps are the dependencies of the tool handlers on the outside world, injected so that the
+// handlers can be tested without network access
+type ToolDeps struct {
+	// HTTPClient sends the requests to arXiv, Crossref and Semantic Scholar. PDF downloads go
+	// through urlUploader instead, whose client guards against requests to private addresses.
+	HTTPClient httpDoer
+	// ArxivLimiter spaces the requests to arXiv, shared by every tool making them
+	ArxivLimiter *rate.Limiter
+}
+
+// configuredClient sends every request with the shared HTTP client configured from the environment,
+// with its proxy and TLS settings
+type configuredClient struct{}
+
+func (configuredClient) Do(req *http.Request) (*http.Response, error) {
+	httpClient, err := internal.GetSharedHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create configured HTTP client: %w", err)
+	}
+	return httpClient.Do(req)
+}
+
+// defaultToolDeps returns the dependencies of the tool handlers of a running server, with the arXiv
+// rate limit loaded with the configuration
+func defaultToolDeps() *ToolDeps {
+	return &ToolDeps{HTTPClient: configuredClient{}, ArxivLimiter: newArxivLimiter(arxivRateConfig)}
+}
+
+// toolDeps are the dependencies of the tool handlers, set when the tools are registered; replaced
+// in tests
+var toolDeps = defaultToolDeps()
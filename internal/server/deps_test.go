@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+
+	"opus-mcp/internal/taxonomy"
+
+	"golang.org/x/time/rate"
+)
+
+// fixtureClient sends every request to a test server instead of the host it names, which the
+// server sees as the request's Host
+type fixtureClient struct {
+	server *httptest.Server
+}
+
+func (c fixtureClient) Do(req *http.Request) (*http.Response, error) {
+	target, err := url.Parse(c.server.URL)
+	if err != nil {
+		return nil, err
+	}
+	redirected := req.Clone(req.Context())
+	redirected.Host = req.URL.Host
+	redirected.URL.Scheme, redirected.URL.Host = target.Scheme, target.Host
+	return c.server.Client().Do(redirected)
+}
+
+// withHTTPFixtures injects an HTTP client answering every request of the tool handlers with
+// handler, so that they request their production URLs without touching the network. It returns the
+// URLs requested.
+func withHTTPFixtures(t *testing.T, handler http.HandlerFunc) func() []string {
+	t.Helper()
+	var mu sync.Mutex
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, "https://"+r.Host+r.URL.RequestURI())
+		mu.Unlock()
+		handler(w, r)
+	}))
+	originalDeps := toolDeps
+	toolDeps = &ToolDeps{HTTPClient: fixtureClient{server: srv}, ArxivLimiter: rate.NewLimiter(rate.Inf, 1)}
+	t.Cleanup(func() {
+		srv.Close()
+		toolDeps = originalDeps
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return requested
+	}
+}
+
+// withUnlimitedArxiv lifts the arXiv rate limit of the tool dependencies, for tests making arXiv
+// requests through fakes
+func withUnlimitedArxiv(t *testing.T) {
+	t.Helper()
+	originalDeps := toolDeps
+	t.Cleanup(func() { toolDeps = originalDeps })
+	deps := *toolDeps
+	deps.ArxivLimiter = rate.NewLimiter(rate.Inf, 1)
+	toolDeps = &deps
+}
+
+// serveFixture answers with a file of testdata
+func serveFixture(t *testing.T, w http.ResponseWriter, name string) {
+	t.Helper()
+	body, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Errorf("failed to read fixture: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(body)
+}
+
+// TestFetchCategoryTaxonomyOffline checks the live taxonomy fetch against a recorded page, the
+// offline counterpart of TestFetchCategoryTaxonomy
+func TestFetchCategoryTaxonomyOffline(t *testing.T) {
+	requested := withHTTPFixtures(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "arxiv.org" || r.URL.Path != "/category_taxonomy" {
+			http.NotFound(w, r)
+			return
+		}
+		serveFixture(t, w, "category_taxonomy.html")
+	})
+
+	result, err := fetchCategoryTaxonomy(context.Background(), json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatalf("fetchCategoryTaxonomy() unexpected error: %v", err)
+	}
+	if got := requested(); len(got) != 1 || got[0] != categoryTaxonomyURL {
+		t.Errorf("requested %v, want only %s", got, categoryTaxonomyURL)
+	}
+	fetched := result.(Taxonomy)
+	if got, want := len(fetched.Categories), len(taxonomy.Embedded().Categories); got != want {
+		t.Errorf("fetched %d categories, want %d", got, want)
+	}
+	for code, category := range fetched.Categories {
+		if category.Code != code || category.Name == "" {
+			t.Errorf("category %s = %+v, want its code and name", code, category)
+		}
+		if _, ok := fetched.Groups[deriveGroupCode(code)]; !ok {
+			t.Errorf("category %s belongs to an unknown group", code)
+		}
+	}
+	if fetched.Provenance == nil || fetched.Provenance.Source != taxonomy.SourceLive {
+		t.Errorf("provenance = %+v, want the live page", fetched.Provenance)
+	}
+}
+
+// TestCategoryFetchLatestOffline checks a category fetch against a recorded arXiv API feed
+func TestCategoryFetchLatestOffline(t *testing.T) {
+	requested := withHTTPFixtures(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "export.arxiv.org" || r.URL.Path != "/api/query" {
+			http.NotFound(w, r)
+			return
+		}
+		serveFixture(t, w, "feed_with_revisions.atom")
+	})
+
+	result, err := categoryFetchLatest(context.Background(), json.RawMessage(`{"category": "cs.LG"}`))
+	if err != nil {
+		t.Fatalf("categoryFetchLatest() unexpected error: %v", err)
+	}
+	got := requested()
+	if len(got) != 1 {
+		t.Fatalf("requested %v, want a single arXiv API query", got)
+	}
+	query, err := url.Parse(got[0])
+	if err != nil || query.Query().Get("search_query") != "(cat:cs.LG)" {
+		t.Errorf("requested %s, want a query of cs.LG", got[0])
+	}
+	feed := result.(*CategoryFetchSummary)
+	if len(feed.Items) == 0 {
+		t.Fatal("categoryFetchLatest() returned no entries from the recorded feed")
+	}
+	for _, item := range feed.Items {
+		if item.ArticleID == "" || item.Title == "" {
+			t.Errorf("entry %+v, want its identifier and title", item)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/calendar"
+	"opus-mcp/internal/parser"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// FeedEntry is a feed item together with what the per-entry stages derived from it. A stage that
+// fails on an entry records its error here instead of failing the whole tool call.
+type FeedEntry struct {
+	*gofeed.Item
+	ArticleID string `json:"articleId,omitempty" jsonschema:"The canonical arXiv identifier of the entry, when it could be determined"`
+	// PrimaryCategory comes from arxiv:primary_category, the category the article was submitted to
+	PrimaryCategory string `json:"primaryCategory,omitempty" jsonschema:"The arXiv category the article was submitted to; its other categories are cross-lists"`
+	// AnnouncedOn and ListingDay follow from the submission time of the first version
+	AnnouncedOn string   `json:"announcedOn,omitempty" jsonschema:"The date (YYYY-MM-DD, US Eastern) of the evening the first version of the article was announced on, derived from its submission time and the announcement calendar; use it to group entries into daily digests"`
+	ListingDay  string   `json:"listingDay,omitempty" jsonschema:"The date (YYYY-MM-DD) arXiv lists the announcement under, the day after announcedOn"`
+	Errors      []string `json:"errors,omitempty" jsonschema:"Problems found while processing this entry; the entry is returned as far as it could be processed"`
+	// PreviousVersionsInWindow lists the older versions of the article that were collapsed into this entry
+	PreviousVersionsInWindow []string `json:"previousVersionsInWindow,omitempty" jsonschema:"The identifiers of older versions of this article that were also in the result and were collapsed into this entry by collapseRevisions"`
+	// RawXML is only set when the call asked for includeRawEntry
+	RawXML *string `json:"rawXml,omitempty" jsonschema:"The entry's Atom XML exactly as arXiv sent it, with the namespace declarations inherited from the feed added to its start tag; only returned with includeRawEntry, and missing with an error when it could not be extracted"`
+	// CategoryRank is only set when the result was sorted by categoryRelevance
+	CategoryRank int `json:"categoryRank,omitempty" jsonschema:"Why the entry was placed where it is by sortBy=categoryRelevance: 1 if its primary category is in the query expression, 2 if it is only cross-listed into a queried category"`
+	// RelevanceRank is only set when arXiv sorted the result by relevance
+	RelevanceRank int `json:"relevanceRank,omitempty" jsonschema:"The position, counting from 1 across pages, arXiv returned the entry at when sorting by relevance; kept as is when collapseRevisions or maxTokensHint leave other entries out; only returned with sortBy=relevance"`
+}
+
+// CategoryFetchResult is a fetched feed whose entries have been through the per-entry stages
+type CategoryFetchResult struct {
+	*gofeed.Feed
+	Items    []*FeedEntry `json:"items" jsonschema:"The feed entries, each with the errors found while processing it; with fields=headline, only their articleId, title, primaryCategory, announcedOn, relevanceRank and errors"`
+	Warnings int          `json:"warnings" jsonschema:"The number of entries that have errors"`
+	// Sanitized reports that the feed was only parsed after repairing malformed XML
+	Sanitized bool `json:"sanitized,omitempty" jsonschema:"Whether invalid characters were removed from, or bare ampersands escaped in, the arXiv feed before it could be parsed"`
+	// Groups is only set when the call asked for groupBy
+	Groups []EntryGroup `json:"groups,omitempty" jsonschema:"The entries grouped as asked by groupBy, largest groups first and ties in order of their key, with the entries without a key last"`
+	// Interpretation shows how the category expression was turned into the arXiv search query
+	Interpretation *parser.Interpretation `json:"interpretation,omitempty" jsonschema:"How each token of the category expression was classified and the resulting arXiv search query"`
+	// Pagination is only set for feeds of arXiv searches, which report it
+	Pagination *FeedPagination `json:"pagination,omitempty" jsonschema:"Where this page lies in all the entries arXiv matched: totalResults, the page's startIndex and itemsPerPage, and the startIndex of the next page unless this is the last one"`
+	// Library is only set when the call asked for recordToLibrary
+	Library *LibraryRecording `json:"library,omitempty" jsonschema:"What was recorded in the library index, when recordToLibrary was set"`
+	// Budget is only set when the call asked for maxTokensHint
+	Budget *ContextBudget `json:"budget,omitempty" jsonschema:"How the entries measure up against maxTokensHint, with the entries left out to fit it and a suggested fetchSize for the next call"`
+}
+
+// Field selections of the entries of fetches and searches
+const (
+	entryFieldsFull     = "full"
+	entryFieldsHeadline = "headline"
+)
+
+// entryFieldsValues are the valid values of the fields argument, in schema order
+var entryFieldsValues = []any{entryFieldsFull, entryFieldsHeadline}
+
+// headlineEntries returns copies of entries stripped down to what triage scans: the identifier,
+// title, primary category and announcement date. The errors of an entry are kept, so that entries
+// with problems stand out, and so is its relevance rank, which only a relevance sort sets.
+func headlineEntries(entries []*FeedEntry) []*FeedEntry {
+	headlines := make([]*FeedEntry, len(entries))
+	for i, entry := range entries {
+		headlines[i] = &FeedEntry{
+			Item:            &gofeed.Item{Title: entry.Title},
+			ArticleID:       entry.ArticleID,
+			PrimaryCategory: entry.PrimaryCategory,
+			AnnouncedOn:     entry.AnnouncedOn,
+			RelevanceRank:   entry.RelevanceRank,
+			Errors:          entry.Errors,
+		}
+	}
+	return headlines
+}
+
+// entryStage derives data from, or checks, a single feed entry. Errors only affect that entry.
+type entryStage func(entry *FeedEntry) error
+
+// feedEntryStages are the stages every fetched entry goes through, in order
+var feedEntryStages = []entryStage{resolveEntryArticleID, resolveEntryPrimaryCategory, checkEntryDates, resolveEntryAnnouncement}
+
+// processFeed runs every entry of a feed through the given stages, isolating failures so that one
+// malformed entry does not cost the caller the rest of the results. Only failures affecting the
+// whole feed, such as network or feed parse errors, should fail a tool call.
+func processFeed(feed *gofeed.Feed, stages ...entryStage) *CategoryFetchResult {
+	result := &CategoryFetchResult{Feed: feed, Items: make([]*FeedEntry, 0, len(feed.Items))}
+	for i, item := range feed.Items {
+		if item == nil {
+			continue
+		}
+		entry := &FeedEntry{Item: item}
+		for _, stage := range stages {
+			if err := runEntryStage(stage, entry); err != nil {
+				entry.Errors = append(entry.Errors, err.Error())
+			}
+		}
+		if len(entry.Errors) > 0 {
+			result.Warnings++
+			slog.Warn("Feed entry could not be fully processed", "index", i, "link", item.Link, "errors", entry.Errors)
+		}
+		result.Items = append(result.Items, entry)
+	}
+	return result
+}
+
+// runEntryStage runs a stage on an entry, turning a panic into an error on that entry
+func runEntryStage(stage entryStage, entry *FeedEntry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("internal error while processing entry: %v", r)
+		}
+	}()
+	return stage(entry)
+}
+
+// resolveEntryArticleID sets the arXiv identifier of an entry from its link or GUID
+func resolveEntryArticleID(entry *FeedEntry) error {
+	for _, candidate := range []string{entry.Link, entry.GUID} {
+		if candidate == "" {
+			continue
+		}
+		if id, err := arxivid.Parse(candidate); err == nil {
+			entry.ArticleID = id.Canonical()
+			return nil
+		}
+	}
+	return fmt.Errorf("no arXiv identifier found in link %q", entry.Link)
+}
+
+// resolveEntryPrimaryCategory sets the primary category of an entry from its arxiv:primary_category
+// element. Feeds without the element, such as some RSS feeds, list the primary category first.
+func resolveEntryPrimaryCategory(entry *FeedEntry) error {
+	if primary := entry.Extensions["arxiv"]["primary_category"]; len(primary) > 0 {
+		if term := strings.TrimSpace(primary[0].Attrs["term"]); term != "" {
+			entry.PrimaryCategory = term
+			return nil
+		}
+	}
+	if len(entry.Categories) > 0 {
+		entry.PrimaryCategory = strings.TrimSpace(entry.Categories[0])
+	}
+	return nil
+}
+
+// resolveEntryAnnouncement sets the announcement date and listing day of an entry from the
+// submission time of its first version. Missing or unparseable dates are reported by checkEntryDates.
+func resolveEntryAnnouncement(entry *FeedEntry) error {
+	submitted := entrySubmitted(entry)
+	if submitted.IsZero() {
+		return nil
+	}
+	announcement, ok := announcementCalendar.Announcement(submitted)
+	if !ok {
+		return fmt.Errorf("no announcement found after submission at %s", submitted.Format(time.RFC3339))
+	}
+	entry.AnnouncedOn = announcement.Format(calendar.DateLayout)
+	entry.ListingDay = calendar.ListingDay(announcement).Format(calendar.DateLayout)
+	return nil
+}
+
+// checkEntryDates flags dates that are present but could not be parsed
+func checkEntryDates(entry *FeedEntry) error {
+	if entry.Published != "" && entry.PublishedParsed == nil {
+		return fmt.Errorf("unparseable published date %q", entry.Published)
+	}
+	if entry.Updated != "" && entry.UpdatedParsed == nil {
+		return fmt.Errorf("unparseable updated date %q", entry.Updated)
+	}
+	return nil
+}
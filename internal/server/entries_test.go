@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// TestParseCategoryFeedIsolatesCorruptEntry checks that an entry with an unparseable date is
+// flagged while the other entries of the feed are returned normally
+func TestParseCategoryFeedIsolatesCorruptEntry(t *testing.T) {
+	body, err := os.ReadFile("testdata/feed_with_corrupt_entry.atom")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	result, err := parseCategoryFeed(body, false)
+	if err != nil {
+		t.Fatalf("parseCategoryFeed() unexpected error: %v", err)
+	}
+	if len(result.Items) != 10 {
+		t.Fatalf("parseCategoryFeed() returned %d entries, want 10", len(result.Items))
+	}
+	if result.Warnings != 1 {
+		t.Errorf("Warnings = %d, want 1", result.Warnings)
+	}
+
+	var good, flagged int
+	for _, entry := range result.Items {
+		if len(entry.Errors) == 0 {
+			good++
+			if entry.ArticleID == "" || entry.PublishedParsed == nil {
+				t.Errorf("good entry %q is missing its article ID or published date", entry.Link)
+			}
+			continue
+		}
+		flagged++
+		if entry.ArticleID != "2411.00007v1" {
+			t.Errorf("flagged entry article ID = %q, want 2411.00007v1", entry.ArticleID)
+		}
+		if !strings.Contains(entry.Errors[0], "published date") {
+			t.Errorf("flagged entry errors = %v, want an unparseable published date", entry.Errors)
+		}
+		if entry.Title != "Fixture paper 7" {
+			t.Errorf("flagged entry title = %q, want the rest of the entry to be returned", entry.Title)
+		}
+	}
+	if good != 9 || flagged != 1 {
+		t.Errorf("got %d good and %d flagged entries, want 9 and 1", good, flagged)
+	}
+
+	// The flagged entry's errors and the warnings count are part of the serialized result
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("failed to marshal result: %v", err)
+	}
+	var decoded struct {
+		Title    string `json:"title"`
+		Warnings int    `json:"warnings"`
+		Items    []struct {
+			ArticleID string   `json:"articleId"`
+			Errors    []string `json:"errors"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+	if decoded.Warnings != 1 || len(decoded.Items) != 10 || len(decoded.Items[6].Errors) != 1 || decoded.Title == "" {
+		t.Errorf("serialized result = %s, want feed fields, 10 items and the flagged entry's errors", data)
+	}
+}
+
+func TestParseCategoryFeedSystemicFailure(t *testing.T) {
+	if _, err := parseCategoryFeed([]byte("<html><body>Service Unavailable</body></html>"), false); err == nil {
+		t.Error("parseCategoryFeed() with a body that is not a feed should fail")
+	}
+}
+
+// TestParseCategoryFeedToleratesMalformedXML checks that a feed with a control character and bare
+// ampersands is parsed after sanitizing, unless parsing is strict
+func TestParseCategoryFeedToleratesMalformedXML(t *testing.T) {
+	body, err := os.ReadFile("testdata/feed_with_malformed_xml.atom")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	raw := string(body)
+
+	if _, err := parseCategoryFeed(body, true); err == nil {
+		t.Error("strict parseCategoryFeed() of malformed XML should fail")
+	}
+
+	result, err := parseCategoryFeed(body, false)
+	if err != nil {
+		t.Fatalf("parseCategoryFeed() unexpected error: %v", err)
+	}
+	if !result.Sanitized {
+		t.Error("Sanitized = false, want true for a feed that was repaired")
+	}
+	if len(result.Items) != 3 || result.Warnings != 0 {
+		t.Fatalf("parseCategoryFeed() returned %d entries with %d warnings, want 3 without warnings", len(result.Items), result.Warnings)
+	}
+	if got := result.Items[1].Title; got != "Memory  consolidation during sleep" {
+		t.Errorf("title with a control character = %q", got)
+	}
+	if got := result.Items[2].Title; got != "Sleep & memory" {
+		t.Errorf("title with a bare ampersand = %q", got)
+	}
+	if !strings.Contains(result.Items[2].Description, "with a & in CDATA") {
+		t.Errorf("description = %q, want the CDATA section unchanged", result.Items[2].Description)
+	}
+	if string(body) != raw {
+		t.Error("parseCategoryFeed() modified the raw body")
+	}
+
+	// A well-formed feed is not reported as sanitized
+	body, err = os.ReadFile("testdata/feed_with_corrupt_entry.atom")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	if result, err := parseCategoryFeed(body, false); err != nil || result.Sanitized {
+		t.Errorf("parseCategoryFeed() of a well-formed feed = sanitized %v, error %v", result != nil && result.Sanitized, err)
+	}
+}
+
+func TestProcessFeedIsolatesStageFailures(t *testing.T) {
+	feed := &gofeed.Feed{Items: []*gofeed.Item{
+		{Link: "http://arxiv.org/abs/2405.00001v1"},
+		{Link: "http://arxiv.org/abs/2405.00002v1", Title: "panics"},
+		nil,
+		{Link: "https://example.org/not-arxiv"},
+	}}
+	failing := func(entry *FeedEntry) error {
+		if entry.Title == "panics" {
+			panic("unexpected entry")
+		}
+		return nil
+	}
+	alwaysFails := func(entry *FeedEntry) error { return errors.New("stage failed") }
+
+	result := processFeed(feed, resolveEntryArticleID, failing)
+	if len(result.Items) != 3 {
+		t.Fatalf("processFeed() returned %d entries, want 3 (nil items are skipped)", len(result.Items))
+	}
+	if result.Warnings != 2 {
+		t.Errorf("Warnings = %d, want 2", result.Warnings)
+	}
+	if len(result.Items[0].Errors) != 0 || result.Items[0].ArticleID != "2405.00001v1" {
+		t.Errorf("first entry = %+v, want no errors", result.Items[0])
+	}
+	if len(result.Items[1].Errors) != 1 || !strings.Contains(result.Items[1].Errors[0], "unexpected entry") {
+		t.Errorf("panicking entry errors = %v, want the recovered panic", result.Items[1].Errors)
+	}
+	if result.Items[1].ArticleID != "2405.00002v1" {
+		t.Errorf("panicking entry article ID = %q, want the result of the earlier stage", result.Items[1].ArticleID)
+	}
+	if len(result.Items[2].Errors) != 1 || result.Items[2].ArticleID != "" {
+		t.Errorf("non-arXiv entry = %+v, want an identifier error", result.Items[2])
+	}
+
+	// Every failing stage is recorded on the entry
+	result = processFeed(&gofeed.Feed{Items: []*gofeed.Item{{}}}, alwaysFails, alwaysFails)
+	if got := result.Items[0].Errors; len(got) != 2 {
+		t.Errorf("entry errors = %v, want one per failing stage", got)
+	}
+}
+
+func TestResolveEntryAnnouncement(t *testing.T) {
+	// Submitted on Friday 2024-11-08 after the 14:00 US Eastern deadline, so announced on Monday
+	submitted := time.Date(2024, 11, 8, 19, 30, 0, 0, time.UTC)
+	entry := &FeedEntry{Item: &gofeed.Item{PublishedParsed: &submitted}}
+	if err := resolveEntryAnnouncement(entry); err != nil {
+		t.Fatalf("resolveEntryAnnouncement() unexpected error: %v", err)
+	}
+	if entry.AnnouncedOn != "2024-11-11" || entry.ListingDay != "2024-11-12" {
+		t.Errorf("announcedOn, listingDay = %s, %s, want 2024-11-11, 2024-11-12", entry.AnnouncedOn, entry.ListingDay)
+	}
+
+	// An entry without a submission date is left alone; checkEntryDates reports unparseable dates
+	undated := &FeedEntry{Item: &gofeed.Item{Published: "not a date"}}
+	if err := resolveEntryAnnouncement(undated); err != nil || undated.AnnouncedOn != "" {
+		t.Errorf("resolveEntryAnnouncement() without a date = %q, %v, want nothing", undated.AnnouncedOn, err)
+	}
+}
+
+// TestHeadlineFields checks that headline fetches and searches return entries with exactly their
+// identifier, title, primary category and announcement date, and the relevance rank of searches,
+// which are sorted by relevance
+func TestHeadlineFields(t *testing.T) {
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<feed xmlns="http://www.w3.org/2005/Atom"><entry>` +
+			`<id>http://arxiv.org/abs/2410.01234v1</id><title>Sparse Attention</title><summary>A long abstract.</summary>` +
+			`<published>2024-10-02T12:00:00Z</published><author><name>E. Author</name></author>` +
+			`<link href="http://arxiv.org/abs/2410.01234v1" rel="alternate" type="text/html"/><category term="cs.CL"/><category term="cs.LG"/>` +
+			`</entry></feed>`))
+	})
+
+	for _, call := range []struct {
+		name  string
+		fetch func(ctx context.Context, input json.RawMessage) (any, error)
+		input string
+		rank  bool
+	}{
+		{"arxiv_category_fetch_latest", categoryFetchLatest, `{"category": "cs.CL", "fetchSize": 1, "fields": "headline", "groupBy": "primaryCategory"}`, false},
+		{"arxiv_search", arxivSearch, `{"query": "attention", "fields": "headline"}`, true},
+	} {
+		output, err := call.fetch(context.Background(), json.RawMessage(call.input))
+		if err != nil {
+			t.Fatalf("%s unexpected error: %v", call.name, err)
+		}
+		result := output.(*CategoryFetchSummary)
+		if len(result.Items) != 1 {
+			t.Fatalf("%s returned %d entries, want 1", call.name, len(result.Items))
+		}
+		data, err := json.Marshal(result.Items[0])
+		if err != nil {
+			t.Fatalf("failed to marshal entry: %v", err)
+		}
+		var entry map[string]any
+		if err := json.Unmarshal(data, &entry); err != nil {
+			t.Fatalf("failed to unmarshal entry: %v", err)
+		}
+		want := map[string]any{"articleId": "2410.01234v1", "title": "Sparse Attention", "primaryCategory": "cs.CL", "announcedOn": "2024-10-02"}
+		if call.rank {
+			want["relevanceRank"] = float64(1)
+		}
+		if !maps.Equal(entry, want) {
+			t.Errorf("%s headline entry = %v, want %v", call.name, entry, want)
+		}
+	}
+}
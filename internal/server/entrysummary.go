@@ -0,0 +1,234 @@
+package server
+
+import (
+	"cmp"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/parser"
+	"opus-mcp/internal/textutil"
+)
+
+// ArxivEntrySummary is a feed entry flattened into the fields clients use, without the RSS, iTunes
+// and Dublin Core structure of the parsed feed item. Every field is omitted when the entry does
+// not have it, so that headline entries keep only theirs.
+type ArxivEntrySummary struct {
+	ArticleID       string   `json:"articleId,omitempty" jsonschema:"The canonical arXiv identifier of the entry, when it could be determined"`
+	Title           string   `json:"title,omitempty" jsonschema:"The title of the article"`
+	Authors         []string `json:"authors,omitempty" jsonschema:"The names of the authors, in order"`
+	Abstract        string   `json:"abstract,omitempty" jsonschema:"The abstract of the article"`
+	Categories      []string `json:"categories,omitempty" jsonschema:"All categories of the article, as listed by arXiv"`
+	PrimaryCategory string   `json:"primaryCategory,omitempty" jsonschema:"The arXiv category the article was submitted to; its other categories are cross-lists"`
+	Published       string   `json:"published,omitempty" jsonschema:"When the first version was submitted, as an RFC 3339 time in UTC"`
+	Updated         string   `json:"updated,omitempty" jsonschema:"When the version returned was submitted, as an RFC 3339 time in UTC"`
+	AbsURL          string   `json:"absUrl,omitempty" jsonschema:"The URL of the abs page of the version returned"`
+	PDFURL          string   `json:"pdfUrl,omitempty" jsonschema:"The URL of the PDF of the version returned"`
+	DOI             string   `json:"doi,omitempty" jsonschema:"The DOI of the published article, when the authors gave one"`
+	// The fields below are derived by the server, like those of FeedEntry
+	AnnouncedOn              string   `json:"announcedOn,omitempty" jsonschema:"The date (YYYY-MM-DD, US Eastern) of the evening the first version of the article was announced on"`
+	ListingDay               string   `json:"listingDay,omitempty" jsonschema:"The date (YYYY-MM-DD) arXiv lists the announcement under, the day after announcedOn"`
+	PreviousVersionsInWindow []string `json:"previousVersionsInWindow,omitempty" jsonschema:"The identifiers of older versions of this article that were collapsed into this entry by collapseRevisions"`
+	CategoryRank             int      `json:"categoryRank,omitempty" jsonschema:"Why the entry was placed where it is by sortBy=categoryRelevance: 1 if its primary category is in the query expression, 2 if it is only cross-listed into a queried category"`
+	RelevanceRank            int      `json:"relevanceRank,omitempty" jsonschema:"The position, counting from 1 across pages, arXiv returned the entry at when sorting by relevance; only returned with sortBy=relevance"`
+	RawXML                   *string  `json:"rawXml,omitempty" jsonschema:"The entry's Atom XML exactly as arXiv sent it; only returned with includeRawEntry"`
+	Errors                   []string `json:"errors,omitempty" jsonschema:"Problems found while processing this entry; the entry is returned as far as it could be processed"`
+}
+
+// CategoryFetchSummary is a fetched feed with its entries flattened, returned unless the call asks
+// for the raw feed. It keeps everything the server adds to a CategoryFetchResult.
+type CategoryFetchSummary struct {
+	Description string               `json:"description,omitempty" jsonschema:"Why the result is empty, for periods without announcements"`
+	Custom      map[string]string    `json:"custom,omitempty" jsonschema:"The announcement period the entries were restricted to, for announcedOn, weekOf and monthOf"`
+	Items       []*ArxivEntrySummary `json:"items" jsonschema:"The entries, each with the errors found while processing it; with fields=headline, only their articleId, title, primaryCategory, announcedOn, relevanceRank and errors"`
+	Warnings    int                  `json:"warnings" jsonschema:"The number of entries that have errors"`
+	Sanitized   bool                 `json:"sanitized,omitempty" jsonschema:"Whether invalid characters were removed from, or bare ampersands escaped in, the arXiv feed before it could be parsed"`
+	Groups      []EntryGroup         `json:"groups,omitempty" jsonschema:"The entries grouped as asked by groupBy, largest groups first and ties in order of their key, with the entries without a key last"`
+	// Interpretation is only set for category fetches and searches
+	Interpretation *parser.Interpretation `json:"interpretation,omitempty" jsonschema:"How each token of the expression was classified and the resulting arXiv search query"`
+	Library        *LibraryRecording      `json:"library,omitempty" jsonschema:"What was recorded in the library index, when recordToLibrary was set"`
+	Budget         *ContextBudget         `json:"budget,omitempty" jsonschema:"How the entries measure up against maxTokensHint, with the entries left out to fit it and a suggested fetchSize for the next call"`
+	Pagination     *FeedPagination        `json:"pagination,omitempty" jsonschema:"Where this page lies in all the entries arXiv matched: totalResults, the page's startIndex and itemsPerPage, and the startIndex of the next page unless this is the last one"`
+}
+
+// summarizeEntry flattens a processed feed entry, with its title and abstract normalized into plain
+// text. The abs and PDF URLs are those of the version
+// returned, like those of arxiv_get_article; without an identifier, the abs URL is the entry's link.
+func summarizeEntry(entry *FeedEntry) *ArxivEntrySummary {
+	summary := &ArxivEntrySummary{
+		ArticleID:                entry.ArticleID,
+		Title:                    textutil.Normalize(entry.Title),
+		Abstract:                 textutil.Normalize(entry.Description),
+		Categories:               entry.Categories,
+		PrimaryCategory:          entry.PrimaryCategory,
+		Published:                cmp.Or(utcTimestamp(entry.PublishedParsed), entry.Published),
+		Updated:                  cmp.Or(utcTimestamp(entry.UpdatedParsed), entry.Updated),
+		AbsURL:                   entry.Link,
+		DOI:                      arxivExtension(entry, "doi"),
+		AnnouncedOn:              entry.AnnouncedOn,
+		ListingDay:               entry.ListingDay,
+		PreviousVersionsInWindow: entry.PreviousVersionsInWindow,
+		CategoryRank:             entry.CategoryRank,
+		RelevanceRank:            entry.RelevanceRank,
+		RawXML:                   entry.RawXML,
+		Errors:                   entry.Errors,
+	}
+	for _, author := range entry.Authors {
+		if author != nil && author.Name != "" {
+			summary.Authors = append(summary.Authors, textutil.CollapseSpace(author.Name))
+		}
+	}
+	// Headline entries have no link, and keep only their own fields
+	if id, err := arxivid.Parse(entry.ArticleID); err == nil && entry.Link != "" {
+		summary.AbsURL = id.AbsURL(arxivAbsBaseURL)
+		summary.PDFURL = id.PDFURL(arxivPDFBaseURL)
+	}
+	return summary
+}
+
+// summarizeResult flattens the entries of a fetched feed, leaving out the feed's own metadata
+func summarizeResult(result *CategoryFetchResult) *CategoryFetchSummary {
+	summary := &CategoryFetchSummary{
+		Items:          make([]*ArxivEntrySummary, len(result.Items)),
+		Warnings:       result.Warnings,
+		Sanitized:      result.Sanitized,
+		Groups:         result.Groups,
+		Interpretation: result.Interpretation,
+		Library:        result.Library,
+		Budget:         result.Budget,
+		Pagination:     result.Pagination,
+	}
+	if result.Feed != nil {
+		summary.Description = result.Description
+		summary.Custom = result.Custom
+	}
+	for i, entry := range result.Items {
+		summary.Items[i] = summarizeEntry(entry)
+	}
+	return summary
+}
+
+// normalizeText reports whether the normalizeText argument asks for normalized titles and
+// abstracts, as it does by default
+func normalizeText(flag *bool) bool {
+	return flag == nil || *flag
+}
+
+// summaryFieldNames are the JSON names of the fields of flattened entries, in field order
+var summaryFieldNames = jsonFieldNames(reflect.TypeFor[ArxivEntrySummary]())
+
+// jsonFieldNames returns the JSON names of the fields of a struct type, in field order
+func jsonFieldNames(t reflect.Type) []string {
+	names := make([]string, t.NumField())
+	for i := range names {
+		names[i], _, _ = strings.Cut(t.Field(i).Tag.Get("json"), ",")
+	}
+	return names
+}
+
+// entryShape is how the entries of a result are returned: raw or flattened, with their abstracts
+// truncated to maxAbstractLength characters if set and, flattened, with only includeFields if set
+// and with their title and abstract as arXiv sent them if rawText is set
+type entryShape struct {
+	raw               bool
+	maxAbstractLength int
+	includeFields     []string
+	rawText           bool
+}
+
+// entry returns an entry as it is returned, without changing the entry itself
+func (s entryShape) entry(entry *FeedEntry) any {
+	if !s.raw {
+		summary := summarizeEntry(entry)
+		s.shapeSummary(summary, entry)
+		return summary
+	}
+	if s.maxAbstractLength == 0 || entry.Item == nil {
+		return entry
+	}
+	item := *entry.Item
+	item.Description = truncateAbstract(item.Description, s.maxAbstractLength)
+	shaped := *entry
+	shaped.Item = &item
+	return &shaped
+}
+
+// output returns a fetched result as it is returned: as parsed when raw, and flattened otherwise
+func (s entryShape) output(result *CategoryFetchResult) any {
+	if !s.raw {
+		summary := summarizeResult(result)
+		for i, item := range summary.Items {
+			s.shapeSummary(item, result.Items[i])
+		}
+		return summary
+	}
+	if s.maxAbstractLength > 0 {
+		shaped := make([]*FeedEntry, len(result.Items))
+		for i, entry := range result.Items {
+			shaped[i] = s.entry(entry).(*FeedEntry)
+		}
+		result.Items = shaped
+	}
+	return result
+}
+
+// shapeSummary restores the raw title and abstract of a flattened entry if asked, truncates its
+// abstract and clears the fields not included. The errors of an entry are always kept.
+func (s entryShape) shapeSummary(summary *ArxivEntrySummary, entry *FeedEntry) {
+	if s.rawText && entry.Item != nil {
+		summary.Title, summary.Abstract = entry.Title, entry.Description
+	}
+	if s.maxAbstractLength > 0 {
+		summary.Abstract = truncateAbstract(summary.Abstract, s.maxAbstractLength)
+	}
+	if len(s.includeFields) == 0 {
+		return
+	}
+	fields := reflect.ValueOf(summary).Elem()
+	for i, name := range summaryFieldNames {
+		if name != "errors" && !slices.Contains(s.includeFields, name) {
+			fields.Field(i).SetZero()
+		}
+	}
+}
+
+// truncateAbstract cuts an abstract longer than maxLength characters to maxLength characters,
+// the last of which is an ellipsis. Characters are runes, so a UTF-8 sequence is never split.
+func truncateAbstract(abstract string, maxLength int) string {
+	if utf8.RuneCountInString(abstract) <= maxLength {
+		return abstract
+	}
+	runes := 0
+	for i := range abstract {
+		if runes == maxLength-1 {
+			return strings.TrimRightFunc(abstract[:i], unicode.IsSpace) + "…"
+		}
+		runes++
+	}
+	return abstract
+}
+
+// resultArticleIDs returns the base identifiers of the entries of a raw or flattened result
+func resultArticleIDs(output any) []string {
+	var articleIDs []string
+	switch result := output.(type) {
+	case *CategoryFetchResult:
+		for _, entry := range result.Items {
+			articleIDs = append(articleIDs, entry.ArticleID)
+		}
+	case *CategoryFetchSummary:
+		for _, entry := range result.Items {
+			articleIDs = append(articleIDs, entry.ArticleID)
+		}
+	}
+	var bases []string
+	for _, articleID := range articleIDs {
+		if id, err := arxivid.Parse(articleID); err == nil {
+			bases = append(bases, id.Base())
+		}
+	}
+	return bases
+}
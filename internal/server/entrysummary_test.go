@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestSearchReturnsFlattenedEntries(t *testing.T) {
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(articleFeed))
+	})
+
+	output, err := arxivSearch(context.Background(), json.RawMessage(`{"query": "everything"}`))
+	if err != nil {
+		t.Fatalf("arxivSearch() unexpected error: %v", err)
+	}
+	result := output.(*CategoryFetchSummary)
+	if len(result.Items) != 1 {
+		t.Fatalf("arxivSearch() returned %d entries, want 1", len(result.Items))
+	}
+	want := ArxivEntrySummary{
+		ArticleID:       "2301.00001v2",
+		Title:           "A Study of Everything",
+		Authors:         []string{"A. Researcher", "B. Scientist"},
+		Abstract:        "We study everything.",
+		Categories:      result.Items[0].Categories,
+		PrimaryCategory: "cs.LG",
+		Published:       "2023-01-02T18:00:00Z",
+		Updated:         "2023-02-10T09:30:00Z",
+		AbsURL:          "https://arxiv.org/abs/2301.00001v2",
+		PDFURL:          "https://arxiv.org/pdf/2301.00001v2",
+		DOI:             "10.1000/xyz123",
+		AnnouncedOn:     result.Items[0].AnnouncedOn,
+		ListingDay:      result.Items[0].ListingDay,
+		RelevanceRank:   1,
+	}
+	if got := *result.Items[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("flattened entry = %+v, want %+v", got, want)
+	}
+	if len(result.Items[0].Categories) != 2 {
+		t.Errorf("categories = %q, want both categories", result.Items[0].Categories)
+	}
+
+	// An entry without an identifier or the arXiv extensions leaves their fields out
+	entry := summarizeEntry(&FeedEntry{Item: &gofeed.Item{Title: "Paper", Link: "http://arxiv.org/abs/2405.00001v1"}})
+	if entry.AbsURL != "http://arxiv.org/abs/2405.00001v1" || entry.DOI != "" || entry.PDFURL != "" || entry.Authors != nil {
+		t.Errorf("flattened entry without identifier = %+v, want its link and no DOI, PDF URL or authors", entry)
+	}
+}
+
+// TestFeedOutputShapes checks that both the flattened and the raw results validate against the
+// output schema of the tools returning feed entries
+func TestFeedOutputShapes(t *testing.T) {
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(articleFeed))
+	})
+	_, handler, err := newSearchTool()
+	if err != nil {
+		t.Fatalf("newSearchTool() unexpected error: %v", err)
+	}
+
+	for input, want := range map[string]string{
+		`{"query": "everything"}`:              `"pdfUrl":"https://arxiv.org/pdf/2301.00001v2"`,
+		`{"query": "everything", "raw": true}`: `"feedType":"atom"`,
+	} {
+		result := handler.handle(context.Background(), newTestCallToolRequest("arxiv_search", input))
+		text := resultText(t, result)
+		if result.IsError {
+			t.Fatalf("handle(%s) unexpected error: %s", input, text)
+		}
+		if !strings.Contains(text, want) {
+			t.Errorf("handle(%s) = %s, want it to contain %s", input, text, want)
+		}
+	}
+}
+
+func TestTruncateAbstract(t *testing.T) {
+	tests := []struct {
+		name      string
+		abstract  string
+		maxLength int
+		want      string
+	}{
+		{"Short enough", "We study everything.", 20, "We study everything."},
+		{"ASCII", "We study everything.", 10, "We study…"},
+		{"Trailing space before the ellipsis", "We study everything.", 4, "We…"},
+		{"Multi-byte characters", "Théorie des catégories", 9, "Théorie…"},
+		{"Cut after a multi-byte character", "Ünïcödé text", 5, "Ünïc…"},
+		{"Three-byte characters", "量子计算的复杂性", 4, "量子计…"},
+		{"Four-byte characters", "𝔸𝔹ℂ𝔻𝔼", 3, "𝔸𝔹…"},
+		{"Ellipsis only", "Anything", 1, "…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateAbstract(tt.abstract, tt.maxLength)
+			if got != tt.want {
+				t.Errorf("truncateAbstract(%q, %d) = %q, want %q", tt.abstract, tt.maxLength, got, tt.want)
+			}
+			if !utf8.ValidString(got) || utf8.RuneCountInString(got) > tt.maxLength {
+				t.Errorf("truncateAbstract(%q, %d) = %q, want valid UTF-8 of at most %d characters", tt.abstract, tt.maxLength, got, tt.maxLength)
+			}
+		})
+	}
+}
+
+// TestCategoryFetchEntryShape checks that category fetches return only the included fields, with
+// truncated abstracts, and truncate the abstracts of raw entries without changing the feed
+func TestCategoryFetchEntryShape(t *testing.T) {
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(articleFeed))
+	})
+
+	output, err := categoryFetchLatest(context.Background(), json.RawMessage(`{"category": "cs.LG", "fetchSize": 1, "maxAbstractLength": 9, "includeFields": ["title", "abstract", "pdfUrl"]}`))
+	if err != nil {
+		t.Fatalf("categoryFetchLatest() unexpected error: %v", err)
+	}
+	want := ArxivEntrySummary{Title: "A Study of Everything", Abstract: "We study…", PDFURL: "https://arxiv.org/pdf/2301.00001v2"}
+	if got := *output.(*CategoryFetchSummary).Items[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("shaped entry = %+v, want %+v", got, want)
+	}
+
+	output, err = categoryFetchLatest(context.Background(), json.RawMessage(`{"category": "cs.LG", "fetchSize": 1, "maxAbstractLength": 9, "raw": true}`))
+	if err != nil {
+		t.Fatalf("categoryFetchLatest() unexpected error: %v", err)
+	}
+	if entry := output.(*CategoryFetchResult).Items[0]; entry.Description != "We study…" || entry.Title == "" {
+		t.Errorf("raw entry = %+v, want the whole entry with a truncated description", entry)
+	}
+
+	// Only flattened entries have fields to select
+	_, handler, err := newCategoryFetchLatestTool()
+	if err != nil {
+		t.Fatalf("newCategoryFetchLatestTool() unexpected error: %v", err)
+	}
+	result := handler.handle(context.Background(), newTestCallToolRequest("arxiv_category_fetch_latest", `{"category": "cs.LG", "raw": true, "includeFields": ["title"]}`))
+	if text := resultText(t, result); !result.IsError || !strings.Contains(text, ErrCodeInvalidInput) {
+		t.Errorf("handle() with raw and includeFields = %s, want %s", text, ErrCodeInvalidInput)
+	}
+}
+
+// TestNormalizeText checks that flattened titles and abstracts are normalized by default and
+// returned as parsed from the feed, which only trims abstracts, with normalizeText false
+func TestNormalizeText(t *testing.T) {
+	const title = "The Large $N$ Limit of\n  Superconformal Field Theories"
+	const abstract = "  We show that the large $N$ limit of certain conformal field theories in\nvarious dimensions include a sector describing supergravity on AdS$_5\\times S^5$.\n"
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<feed xmlns="http://www.w3.org/2005/Atom"><entry>` +
+			`<id>http://arxiv.org/abs/hep-th/9711200v3</id><title>` + title + `</title><summary>` + abstract + `</summary>` +
+			`<published>1997-11-27T18:00:00Z</published><link href="http://arxiv.org/abs/hep-th/9711200v3" rel="alternate" type="text/html"/>` +
+			`</entry></feed>`))
+	})
+
+	tests := []struct {
+		name         string
+		fetch        func(ctx context.Context, input json.RawMessage) (any, error)
+		input        string
+		wantTitle    string
+		wantAbstract string
+	}{
+		{"search", arxivSearch, `{"query": "maldacena"}`,
+			"The Large N Limit of Superconformal Field Theories",
+			"We show that the large N limit of certain conformal field theories in various dimensions include a sector describing supergravity on AdS_5× S^5."},
+		{"search without normalization", arxivSearch, `{"query": "maldacena", "normalizeText": false}`, title, strings.TrimSpace(abstract)},
+		{"category fetch without normalization", categoryFetchLatest, `{"category": "hep-th", "normalizeText": false}`, title, strings.TrimSpace(abstract)},
+		{"article", getArticle, `{"id": "hep-th/9711200"}`,
+			"The Large N Limit of Superconformal Field Theories",
+			"We show that the large N limit of certain conformal field theories in various dimensions include a sector describing supergravity on AdS_5× S^5."},
+		{"article without normalization", getArticle, `{"id": "hep-th/9711200", "normalizeText": false}`, title, strings.TrimSpace(abstract)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := tt.fetch(context.Background(), json.RawMessage(tt.input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var gotTitle, gotAbstract string
+			switch result := output.(type) {
+			case *CategoryFetchSummary:
+				gotTitle, gotAbstract = result.Items[0].Title, result.Items[0].Abstract
+			case *ArticleRecord:
+				gotTitle, gotAbstract = result.Title, result.Abstract
+			}
+			if gotTitle != tt.wantTitle || gotAbstract != tt.wantAbstract {
+				t.Errorf("title, abstract = %q, %q, want %q, %q", gotTitle, gotAbstract, tt.wantTitle, tt.wantAbstract)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"slices"
+	"time"
+
+	"opus-mcp/internal/storage"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Error codes returned in structured tool errors
+const (
+	// ErrCodeBusy means the server is saturated and the call was not attempted
+	ErrCodeBusy = "BUSY"
+	// ErrCodePolicyViolation means the call was refused by a configured security policy
+	ErrCodePolicyViolation = "POLICY_VIOLATION"
+	// ErrCodeCancelled means the client cancelled the call before it completed
+	ErrCodeCancelled = "CANCELLED"
+	// ErrCodeConflict means the upload's object name is taken and the collision policy refuses to replace it
+	ErrCodeConflict = "CONFLICT"
+	// ErrCodeRateLimited means arXiv asked the server to back off and the call was not attempted
+	ErrCodeRateLimited = "RATE_LIMITED"
+	// ErrCodeInProgress means another call was still downloading the same object from the same URL
+	// when this call stopped waiting for it
+	ErrCodeInProgress = "IN_PROGRESS"
+	// ErrCodeBucketNotFound means the configured bucket does not exist
+	ErrCodeBucketNotFound = "BUCKET_NOT_FOUND"
+	// ErrCodeObjectNotFound means the requested object does not exist in the bucket
+	ErrCodeObjectNotFound = "OBJECT_NOT_FOUND"
+	// ErrCodeAccessDenied means storage refused the server's credentials or their permissions
+	ErrCodeAccessDenied = "ACCESS_DENIED"
+	// ErrCodeChecksumMismatch means storage found an upload to differ from its digest
+	ErrCodeChecksumMismatch = "CHECKSUM_MISMATCH"
+	// ErrCodeArxivRejected means arXiv answered with an error instead of results, e.g., for a query
+	// it cannot parse; the call needs different arguments, not a retry
+	ErrCodeArxivRejected = "ARXIV_REJECTED"
+	// ErrCodeExecutionFailed means the call was valid but failed while running; retryable tells
+	// whether the failure looked transient
+	ErrCodeExecutionFailed = "EXECUTION_FAILED"
+)
+
+// jsonrpcToolErrorCode is the JSON-RPC error code of structured tool errors returned at the protocol
+// level, from the range the specification reserves for implementation-defined server errors
+const jsonrpcToolErrorCode = -32000
+
+// ToolError is a structured tool error that clients can branch on without parsing prose
+type ToolError struct {
+	Code              string         `json:"code"`
+	Message           string         `json:"message"`
+	Retryable         bool           `json:"retryable"`
+	RetryAfterSeconds int64          `json:"retryAfterSeconds,omitempty"`
+	Details           map[string]any `json:"details,omitempty"`
+	// ValidationErrors lists the input schema constraints that INVALID_INPUT arguments break
+	ValidationErrors []SchemaViolation `json:"validationErrors,omitempty"`
+}
+
+func (e *ToolError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// retryAfterSeconds rounds a wait up to whole seconds, never returning less than one second
+func retryAfterSeconds(d time.Duration) int64 {
+	return max(1, int64(math.Ceil(d.Seconds())))
+}
+
+// withRetryAt schedules the retry of a refused call: it sets retryAfterSeconds, records when the
+// call can be retried as retryAt in the details, and ends the message with a sentence naming that
+// time for clients that only read the message
+func (e *ToolError) withRetryAt(wait time.Duration, now time.Time) *ToolError {
+	e.Retryable = true
+	e.RetryAfterSeconds = retryAfterSeconds(wait)
+	retryAt := now.Add(wait)
+	if whole := retryAt.Truncate(time.Second); !whole.Equal(retryAt) {
+		retryAt = whole.Add(time.Second)
+	}
+	stamp := retryAt.UTC().Format(time.RFC3339)
+	if e.Details == nil {
+		e.Details = map[string]any{}
+	}
+	e.Details["retryAt"] = stamp
+	e.Message += "; retry after " + stamp
+	return e
+}
+
+// cancelledToolError reports a call that its client cancelled, or returns nil if the call's
+// context was not cancelled. Whatever error the cancellation caused is not worth reporting.
+func cancelledToolError(ctx context.Context) *ToolError {
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		return nil
+	}
+	return &ToolError{
+		Code:      ErrCodeCancelled,
+		Message:   "the call was cancelled before it completed",
+		Retryable: true,
+	}
+}
+
+// policyToolError converts a download policy violation, including a download over the maximum
+// download size, into a structured tool error, or returns nil if the error is not a policy violation
+func policyToolError(err error) *ToolError {
+	var tooLargeErr *storage.DownloadTooLargeError
+	if errors.As(err, &tooLargeErr) {
+		return &ToolError{
+			Code:    ErrCodePolicyViolation,
+			Message: tooLargeErr.Error(),
+			Details: map[string]any{
+				"policy":   "max-download-size",
+				"maxBytes": tooLargeErr.Limit,
+			},
+		}
+	}
+	var policyErr *storage.PolicyError
+	if !errors.As(err, &policyErr) {
+		return nil
+	}
+	return &ToolError{
+		Code:    ErrCodePolicyViolation,
+		Message: policyErr.Error(),
+		Details: map[string]any{
+			"policy": policyErr.Policy,
+			"host":   policyErr.Host,
+		},
+	}
+}
+
+// conflictToolError converts an object name collision into a structured tool error, or returns nil
+// if the error is not a collision
+func conflictToolError(err error) *ToolError {
+	var conflictErr *storage.ConflictError
+	if !errors.As(err, &conflictErr) {
+		return nil
+	}
+	details := map[string]any{
+		"bucket":     conflictErr.Bucket,
+		"objectName": conflictErr.ObjectName,
+	}
+	if conflictErr.SourceURL != "" {
+		details["sourceUrl"] = conflictErr.SourceURL
+	}
+	return &ToolError{
+		Code:    ErrCodeConflict,
+		Message: conflictErr.Error() + "; set onCollision to overwrite or rename to store the download anyway",
+		Details: details,
+	}
+}
+
+// inProgressToolError converts a download that stopped waiting for the same transfer in progress
+// into a structured tool error, or returns nil if the error is not such a wait
+func inProgressToolError(err error) *ToolError {
+	var inProgressErr *storage.InProgressError
+	if !errors.As(err, &inProgressErr) {
+		return nil
+	}
+	return &ToolError{
+		Code:      ErrCodeInProgress,
+		Message:   inProgressErr.Error() + "; retry to get its result once it completes",
+		Retryable: true,
+		Details: map[string]any{
+			"bucket":     inProgressErr.Bucket,
+			"objectName": inProgressErr.ObjectName,
+			"sourceUrl":  inProgressErr.SourceURL,
+			"since":      inProgressErr.Since.UTC().Format(time.RFC3339),
+		},
+	}
+}
+
+// storageToolError converts a classified storage failure into a structured tool error, or returns
+// nil if the error is not one. Only a checksum mismatch, i.e., content damaged on its way to
+// storage, is worth retrying as is; the others need the storage configuration or the arguments fixed.
+func storageToolError(err error) *ToolError {
+	var code string
+	retryable := false
+	switch {
+	case errors.Is(err, storage.ErrBucketNotFound):
+		code = ErrCodeBucketNotFound
+	case errors.Is(err, storage.ErrObjectNotFound):
+		code = ErrCodeObjectNotFound
+	case errors.Is(err, storage.ErrQuotaExceeded):
+		code = ErrCodeStorageFull
+	case errors.Is(err, storage.ErrAccessDenied):
+		code = ErrCodeAccessDenied
+	case errors.Is(err, storage.ErrChecksumMismatch):
+		code, retryable = ErrCodeChecksumMismatch, true
+	default:
+		return nil
+	}
+	return &ToolError{Code: code, Message: err.Error(), Retryable: retryable}
+}
+
+// executionToolError reports a failure of a valid call that no other structured error describes.
+// Network failures, timeouts and server-side arXiv errors are retryable as they are; anything else
+// is likely to fail again.
+func executionToolError(err error) *ToolError {
+	var netErr net.Error
+	var statusErr *arxivStatusError
+	retryable := errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		(errors.As(err, &statusErr) && statusErr.transient())
+	return &ToolError{Code: ErrCodeExecutionFailed, Message: err.Error(), Retryable: retryable}
+}
+
+// objectKeyToolError converts an object key refused by storage.ValidateObjectKey into a structured
+// invalid input error on the argument it came from, or returns nil if the error is not a refused key
+func objectKeyToolError(field string, err error) *ToolError {
+	var keyErr *storage.KeyError
+	if !errors.As(err, &keyErr) {
+		return nil
+	}
+	toolErr := invalidInputError([]ValidationIssue{{Fields: []string{field}, Message: keyErr.Error()}})
+	toolErr.Details["objectName"] = keyErr.Key
+	if keyErr.Char != "" {
+		toolErr.Details["character"] = keyErr.Char
+	}
+	return toolErr
+}
+
+// collisionPolicy returns the collision policy named by a tool argument, or the fallback if none is
+// named
+func collisionPolicy(name string, fallback storage.CollisionPolicy) (storage.CollisionPolicy, error) {
+	if name == "" {
+		return fallback, nil
+	}
+	policy := storage.CollisionPolicy(name)
+	if !slices.Contains(storage.CollisionPolicies, policy) {
+		return "", fmt.Errorf("unknown onCollision value %q, expected one of %v", name, storage.CollisionPolicies)
+	}
+	return policy, nil
+}
+
+// toolErrorMiddleware turns structured tool errors that reach the protocol level, i.e., errors of
+// requests other than tool calls, into JSON-RPC errors carrying the tool error as their data, so
+// that every client can read when to retry without parsing the message
+func toolErrorMiddleware() mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			result, err := next(ctx, method, req)
+			var toolErr *ToolError
+			if err == nil || !errors.As(err, &toolErr) {
+				return result, err
+			}
+			data, marshalErr := json.Marshal(toolErr)
+			if marshalErr != nil {
+				return result, err
+			}
+			return result, &jsonrpc.Error{Code: jsonrpcToolErrorCode, Message: toolErr.Error(), Data: data}
+		}
+	}
+}
+
+// mcp_tool_error converts a structured tool error into an MCP error result.
+// The JSON-encoded error is returned as text content under an "error" key.
+func mcp_tool_error(toolErr *ToolError) *mcp.CallToolResult {
+	slog.Warn("tool call failed", "code", toolErr.Code, "message", toolErr.Message)
+	payload, err := marshalOutput(map[string]any{"error": toolErr})
+	if err != nil {
+		// Fall back to prose; the fields above are always marshallable so this is unexpected
+		payload = []byte(fmt.Sprintf("%s: %s", toolErr.Code, toolErr.Message))
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: string(payload)}},
+		IsError: true,
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/storage"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestWithRetryAt(t *testing.T) {
+	now := time.Date(2026, 2, 3, 14, 4, 59, 250_000_000, time.UTC)
+	toolErr := (&ToolError{Code: ErrCodeBusy, Message: "the server is busy"}).withRetryAt(500*time.Millisecond, now)
+	// The retry time is rounded up to whole seconds, so that it is never too early
+	if toolErr.RetryAfterSeconds != 1 || toolErr.Details["retryAt"] != "2026-02-03T14:05:00Z" || !toolErr.Retryable {
+		t.Errorf("withRetryAt() = %+v, want a retry after 1 second at 14:05:00", toolErr)
+	}
+	if toolErr.Message != "the server is busy; retry after 2026-02-03T14:05:00Z" {
+		t.Errorf("message = %q, want it to name the retry time", toolErr.Message)
+	}
+}
+
+func TestToolErrorMiddleware(t *testing.T) {
+	quota := newDailyQuota(1, nil, func() time.Time { return time.Date(2026, 2, 3, 23, 0, 0, 0, time.UTC) })
+	if err := quota.take(context.Background(), arxivRequestAPI); err != nil {
+		t.Fatalf("take() unexpected error: %v", err)
+	}
+	refused := quota.check()
+
+	tests := []struct {
+		name    string
+		err     error
+		wantRPC bool
+	}{
+		{"structured error", fmt.Errorf("resource read failed: %w", refused), true},
+		{"plain error", errors.New("method not supported"), false},
+		{"no error", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := toolErrorMiddleware()(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+				return nil, tt.err
+			})
+			_, err := handler(context.Background(), "resources/read", nil)
+			var rpcErr *jsonrpc.Error
+			if !tt.wantRPC {
+				if err != tt.err {
+					t.Errorf("middleware error = %v, want it unchanged", err)
+				}
+				return
+			}
+			if !errors.As(err, &rpcErr) || rpcErr.Code != jsonrpcToolErrorCode {
+				t.Fatalf("middleware error = %v, want a JSON-RPC error", err)
+			}
+			var data ToolError
+			if err := json.Unmarshal(rpcErr.Data, &data); err != nil {
+				t.Fatalf("failed to decode error data: %v", err)
+			}
+			if data.Code != ErrCodeQuotaExceeded || data.RetryAfterSeconds != 3600 || !strings.Contains(data.Message, "retry after 2026-02-04T00:00:00Z") {
+				t.Errorf("error data = %+v, want the quota error with its retry schedule", data)
+			}
+		})
+	}
+}
+
+func TestStorageToolError(t *testing.T) {
+	tests := []struct {
+		err           error
+		wantCode      string
+		wantRetryable bool
+	}{
+		{fmt.Errorf("%w: opus-mcp-articles", storage.ErrBucketNotFound), ErrCodeBucketNotFound, false},
+		{fmt.Errorf("%w: opus-mcp-articles/arxiv/2405.12345.pdf", storage.ErrObjectNotFound), ErrCodeObjectNotFound, false},
+		{fmt.Errorf("failed to upload: %w", storage.ErrQuotaExceeded), ErrCodeStorageFull, false},
+		{fmt.Errorf("failed to upload: %w", storage.ErrAccessDenied), ErrCodeAccessDenied, false},
+		{fmt.Errorf("failed to upload: %w", storage.ErrChecksumMismatch), ErrCodeChecksumMismatch, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wantCode, func(t *testing.T) {
+			toolErr := storageToolError(tt.err)
+			if toolErr == nil || toolErr.Code != tt.wantCode || toolErr.Retryable != tt.wantRetryable || toolErr.Message != tt.err.Error() {
+				t.Errorf("storageToolError(%v) = %+v, want %s with retryable %v", tt.err, toolErr, tt.wantCode, tt.wantRetryable)
+			}
+		})
+	}
+	if toolErr := storageToolError(errors.New("failed to create MinIO client")); toolErr != nil {
+		t.Errorf("storageToolError() = %+v for an unclassified error, want nil", toolErr)
+	}
+}
+
+func TestExecutionToolError(t *testing.T) {
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{fmt.Errorf("failed to fetch from arXiv: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), true},
+		{fmt.Errorf("failed to read response body: %w", io.ErrUnexpectedEOF), true},
+		{fmt.Errorf("rate limiter error: %w", context.DeadlineExceeded), true},
+		{errors.New("failed to parse feed: XML syntax error"), false},
+	}
+	for _, tt := range tests {
+		toolErr := executionToolError(tt.err)
+		if toolErr.Code != ErrCodeExecutionFailed || toolErr.Retryable != tt.retryable || toolErr.Message != tt.err.Error() {
+			t.Errorf("executionToolError(%v) = %+v, want a %s error with retryable %v", tt.err, toolErr, ErrCodeExecutionFailed, tt.retryable)
+		}
+	}
+}
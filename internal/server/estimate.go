@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Reasons a planned item would be skipped
+const (
+	// SkipInvalid means the identifier could not be parsed and would not be queried
+	SkipInvalid = "invalid"
+	// SkipDuplicate means the identifier names an article requested earlier in the same call
+	SkipDuplicate = "duplicate"
+	// SkipAlreadyStored means the article would be fetched, but not recorded in the library index
+	// since it is already stored
+	SkipAlreadyStored = "already_stored"
+)
+
+// CostEstimate is what a tool call would cost, computed by its planning phase alone when the call
+// asks for estimateOnly: without mutations and without rate-limited requests
+type CostEstimate struct {
+	ArxivRequests    int           `json:"arxivRequests" jsonschema:"The number of requests the call would make to the arXiv API"`
+	EstimatedSeconds float64       `json:"estimatedSeconds" jsonschema:"The estimated wall-clock time of the call in seconds, given the current state of the arXiv rate limiter and the calls queued on it"`
+	StorageWrites    int           `json:"storageWrites" jsonschema:"The number of objects the call would write to storage, including the library index"`
+	EstimatedBytes   int64         `json:"estimatedBytes" jsonschema:"The number of bytes the call would write to storage, not counting the library index"`
+	Items            int           `json:"items" jsonschema:"The number of items the call would process"`
+	Skipped          []SkippedItem `json:"skipped,omitempty" jsonschema:"The items the call would skip, in the order requested"`
+	// QuotaRemaining is only set when a daily arXiv quota is configured
+	QuotaRemaining *int `json:"quotaRemaining,omitempty" jsonschema:"The arXiv requests left in today's quota, when one is configured"`
+}
+
+// SkippedItem is an item a tool call would skip
+type SkippedItem struct {
+	ID     string `json:"id" jsonschema:"The item as requested"`
+	Reason string `json:"reason" jsonschema:"One of invalid, duplicate or already_stored"`
+	Detail string `json:"detail,omitempty" jsonschema:"More on why the item would be skipped"`
+}
+
+// isEstimateOnly reports whether the arguments of a call ask for an estimate instead of the call
+func isEstimateOnly(input json.RawMessage) bool {
+	var args struct {
+		EstimateOnly bool `json:"estimateOnly"`
+	}
+	return json.Unmarshal(input, &args) == nil && args.EstimateOnly
+}
+
+// estimateArxivDuration estimates how long a call to the given tool making the given number of
+// arXiv requests would take: the wait before its first request, as estimated by admission control,
+// and one limiter interval for every further request
+func estimateArxivDuration(tool string, requests int, now time.Time) time.Duration {
+	if requests == 0 {
+		return 0
+	}
+	estimate := arxivAdmission.estimateWait(tool, now)
+	return estimate + time.Duration(requests-1)*arxivInterval()
+}
+
+// arxivCostEstimate estimates the cost of a call making the given number of arXiv requests
+func arxivCostEstimate(tool string, requests int) *CostEstimate {
+	estimate := &CostEstimate{
+		ArxivRequests:    requests,
+		EstimatedSeconds: estimateArxivDuration(tool, requests, time.Now()).Seconds(),
+	}
+	estimate.QuotaRemaining = arxivQuota.status().Remaining
+	return estimate
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+)
+
+// toolExample is a curated example call of a tool. The arguments and the output, trimmed to a few
+// items and without its schemaVersion, are JSON objects kept as text so that they read like calls.
+type toolExample struct {
+	description string
+	arguments   string
+	output      string
+}
+
+// ToolExample is an example call of a tool together with its output
+type ToolExample struct {
+	Description string         `json:"description" jsonschema:"What the example call does"`
+	Arguments   map[string]any `json:"arguments" jsonschema:"The arguments of the call"`
+	Output      map[string]any `json:"output" jsonschema:"The structured output of the call, with lists trimmed to a few items"`
+}
+
+// ToolExamples are the example calls of a single tool
+type ToolExamples struct {
+	Name     string        `json:"name" jsonschema:"The name of the tool"`
+	Examples []ToolExample `json:"examples" jsonschema:"Example calls of the tool and their outputs"`
+}
+
+// GetToolExamplesArgs defines the input parameters for the tool examples tool
+type GetToolExamplesArgs struct {
+	Tool string `json:"tool,omitempty" jsonschema:"Only return the examples of this tool. Defaults to every registered tool"`
+}
+
+// GetToolExamplesOutput defines the output structure for the tool examples tool
+type GetToolExamplesOutput struct {
+	Tools []ToolExamples `json:"tools" jsonschema:"The example calls of every requested tool, sorted by tool name"`
+}
+
+// decode parses the example, stamping the output with the tool's current schema version
+func (e toolExample) decode(schemaVersion int) (ToolExample, error) {
+	example := ToolExample{Description: e.description}
+	if err := json.Unmarshal([]byte(e.arguments), &example.Arguments); err != nil {
+		return ToolExample{}, fmt.Errorf("invalid arguments in example %q: %w", e.description, err)
+	}
+	if err := json.Unmarshal([]byte(e.output), &example.Output); err != nil {
+		return ToolExample{}, fmt.Errorf("invalid output in example %q: %w", e.description, err)
+	}
+	if example.Arguments == nil || example.Output == nil {
+		return ToolExample{}, fmt.Errorf("example %q must have object arguments and output", e.description)
+	}
+	example.Output[schemaVersionProperty] = schemaVersion
+	return example, nil
+}
+
+// toolExamples returns the examples of the registered tools, or of the named tool only, sorted by name
+func (c *toolCatalog) toolExamples(name string) ([]ToolExamples, error) {
+	if name != "" {
+		if _, ok := c.handlers[name]; !ok {
+			return nil, fmt.Errorf("no tool named %q is registered", name)
+		}
+	}
+	tools := make([]ToolExamples, 0, len(c.handlers))
+	for tool, handler := range c.handlers {
+		if name != "" && tool != name {
+			continue
+		}
+		entry := ToolExamples{Name: tool, Examples: make([]ToolExample, 0, len(c.examples[tool]))}
+		for _, fixture := range c.examples[tool] {
+			example, err := fixture.decode(handler.schemaVersion)
+			if err != nil {
+				return nil, fmt.Errorf("tool %q: %w", tool, err)
+			}
+			entry.Examples = append(entry.Examples, example)
+		}
+		tools = append(tools, entry)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools, nil
+}
+
+// getToolExamples handles the tool examples tool, describing the tools registered in the catalog
+func (c *toolCatalog) getToolExamples(ctx context.Context, input json.RawMessage) (any, error) {
+	var args GetToolExamplesArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+	tools, err := c.toolExamples(args.Tool)
+	if err != nil {
+		return nil, err
+	}
+	return GetToolExamplesOutput{Tools: tools}, nil
+}
+
+// toolExamplesJSON renders the examples of the registered tools, as returned by the get_tool_examples tool
+func toolExamplesJSON() ([]byte, error) {
+	tools := []ToolExamples{}
+	if catalog := toolRegistrationStatus().catalog; catalog != nil {
+		var err error
+		if tools, err = catalog.toolExamples(""); err != nil {
+			return nil, fmt.Errorf("tool examples could not be decoded: %w", err)
+		}
+	}
+	jsonData, err := json.MarshalIndent(GetToolExamplesOutput{Tools: tools}, "", "    ")
+	if err != nil {
+		return nil, fmt.Errorf("JSON marshalling failed: %w", err)
+	}
+	return jsonData, nil
+}
+
+// examplesHandler serves the examples of the registered tools, as returned by the get_tool_examples tool
+func examplesHandler(w http.ResponseWriter, r *http.Request) {
+	jsonData, err := toolExamplesJSON()
+	if err != nil {
+		slog.Error("tool examples could not be rendered", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(jsonData); err != nil {
+		slog.Error("tool examples response writing failed", "error", err)
+	}
+}
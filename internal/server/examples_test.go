@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"opus-mcp/internal/attestation"
+	"opus-mcp/internal/storage"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// registerAllTools registers every tool, including the optional ones, and returns their catalog
+func registerAllTools(t *testing.T) *toolCatalog {
+	t.Helper()
+	originalConfig, originalEnabled, originalSigner, originalAdminToken := globalS3Config, genericDownloadEnabled, globalSigner, adminToken
+	originalTools := toolRegistrationStatus()
+	t.Cleanup(func() {
+		globalS3Config, genericDownloadEnabled, globalSigner, adminToken = originalConfig, originalEnabled, originalSigner, originalAdminToken
+		registeredToolsMu.Lock()
+		registeredTools = originalTools
+		registeredToolsMu.Unlock()
+	})
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	genericDownloadEnabled = true
+	adminToken = "test-admin-token"
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	globalSigner = attestation.NewSigner(privateKey)
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test-server", Version: "v0.0.1"}, nil)
+	if err := addMCPTools(server, toolDeps); err != nil {
+		t.Fatalf("addMCPTools() unexpected error: %v", err)
+	}
+	return toolRegistrationStatus().catalog
+}
+
+// TestToolExamplesMatchSchemas keeps the curated examples from drifting out of date: every example
+// must be valid against the real input and output schemas of its tool
+func TestToolExamplesMatchSchemas(t *testing.T) {
+	catalog := registerAllTools(t)
+	tools, err := catalog.toolExamples("")
+	if err != nil {
+		t.Fatalf("toolExamples() unexpected error: %v", err)
+	}
+	if len(tools) != len(toolSchemaVersions) {
+		t.Errorf("examples cover %d tools, want all %d", len(tools), len(toolSchemaVersions))
+	}
+
+	for _, tool := range tools {
+		handler := catalog.handlers[tool.Name]
+		// Tools without arguments only need a single example
+		wantExamples := 2
+		if len(handler.inputSchema.Schema().Properties) == 0 {
+			wantExamples = 1
+		}
+		if len(tool.Examples) < wantExamples {
+			t.Errorf("tool %s has %d examples, want at least %d", tool.Name, len(tool.Examples), wantExamples)
+		}
+		for _, example := range tool.Examples {
+			if err := handler.inputSchema.Validate(example.Arguments); err != nil {
+				t.Errorf("tool %s example %q: arguments do not match the input schema: %v", tool.Name, example.Description, err)
+			}
+			// Validate the output as a client decodes it
+			data, err := json.Marshal(example.Output)
+			if err != nil {
+				t.Fatalf("failed to marshal output: %v", err)
+			}
+			if err := unmarshalAndValidate(data, handler.outputSchema); err != nil {
+				t.Errorf("tool %s example %q: output does not match the output schema: %v", tool.Name, example.Description, err)
+			}
+		}
+	}
+}
+
+func TestGetToolExamples(t *testing.T) {
+	catalog := registerAllTools(t)
+
+	output, err := catalog.getToolExamples(context.Background(), json.RawMessage(`{"tool": "arxiv_fetch_by_id"}`))
+	if err != nil {
+		t.Fatalf("getToolExamples() unexpected error: %v", err)
+	}
+	tools := output.(GetToolExamplesOutput).Tools
+	if len(tools) != 1 || tools[0].Name != "arxiv_fetch_by_id" || len(tools[0].Examples) == 0 {
+		t.Fatalf("getToolExamples() for one tool = %+v", tools)
+	}
+	if got := tools[0].Examples[0].Output[schemaVersionProperty]; got != toolSchemaVersions["arxiv_fetch_by_id"] {
+		t.Errorf("example output schemaVersion = %v, want the current version %d", got, toolSchemaVersions["arxiv_fetch_by_id"])
+	}
+
+	if _, err := catalog.getToolExamples(context.Background(), json.RawMessage(`{"tool": "no_such_tool"}`)); err == nil {
+		t.Error("getToolExamples() for an unknown tool should fail")
+	}
+}
+
+func TestExamplesRoute(t *testing.T) {
+	registerAllTools(t)
+	mux := newHTTPMux(httpRoutes(http.NotFoundHandler()))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/examples.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /examples.json status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	var output GetToolExamplesOutput
+	if err := json.Unmarshal(rec.Body.Bytes(), &output); err != nil {
+		t.Fatalf("examples document is not valid JSON: %v", err)
+	}
+	if len(output.Tools) != len(toolSchemaVersions) {
+		t.Errorf("examples document lists %d tools, want %d", len(output.Tools), len(toolSchemaVersions))
+	}
+}
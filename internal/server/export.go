@@ -0,0 +1,510 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/canonicaljson"
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/settings"
+	"opus-mcp/internal/storage"
+)
+
+// exportObjectPrefix is the bucket prefix under which library exports are stored
+const exportObjectPrefix = "exports/"
+
+// ExportConfig holds the configuration of library exports
+type ExportConfig struct {
+	// StreamThreshold is the number of entries above which an export is streamed into the bucket
+	// as it is written, instead of being built in memory first
+	StreamThreshold int `env:"OPUS_MCP_EXPORT_STREAM_THRESHOLD,default=1000"`
+	// PresignExpiry is how long presigned URLs of exports remain valid
+	PresignExpiry settings.Duration `env:"OPUS_MCP_EXPORT_PRESIGN_EXPIRY,default=1h"`
+}
+
+// Validate reports the problems of the export configuration together
+func (c *ExportConfig) Validate() error {
+	var errs []error
+	if c.StreamThreshold < 0 {
+		errs = append(errs, fmt.Errorf("OPUS_MCP_EXPORT_STREAM_THRESHOLD cannot be negative, got %d", c.StreamThreshold))
+	}
+	// S3 does not accept presigned URLs valid for longer than seven days
+	if c.PresignExpiry <= 0 || c.PresignExpiry.Duration() > 7*24*time.Hour {
+		errs = append(errs, fmt.Errorf("OPUS_MCP_EXPORT_PRESIGN_EXPIRY must be between 1s and 7d, got %s", c.PresignExpiry))
+	}
+	return errors.Join(errs...)
+}
+
+// LoadExportConfig loads the export configuration from environment variables
+func LoadExportConfig() (*ExportConfig, error) {
+	var config ExportConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process export configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// exportConfig is the export configuration loaded at server startup
+var exportConfig = ExportConfig{StreamThreshold: 1000, PresignExpiry: settings.Duration(time.Hour)}
+
+// LibraryExportArgs defines the input parameters for exporting the library index
+type LibraryExportArgs struct {
+	Format      string `json:"format" jsonschema:"The export format: jsonl (one JSON entry per line), bibtex or csv"`
+	Prefix      string `json:"prefix,omitempty" jsonschema:"Only export objects whose names start with this prefix, e.g., arxiv/"`
+	StoredSince string `json:"storedSince,omitempty" jsonschema:"Only export articles stored on or after this UTC date (YYYY-MM-DD)"`
+	StoredUntil string `json:"storedUntil,omitempty" jsonschema:"Only export articles stored on or before this UTC date (YYYY-MM-DD)"`
+	Presign     bool   `json:"presign,omitempty" jsonschema:"Return a presigned URL from which the export can be downloaded without credentials (default: false)"`
+	// EstimateOnly still reads the index and the metadata of the selected objects, but writes nothing
+	EstimateOnly bool `json:"estimateOnly,omitempty" jsonschema:"Only select and encode the entries and return what the export would cost in estimate, including its exact size, without storing it (default: false)"`
+}
+
+// LibraryExportOutput defines the output structure for the library export
+type LibraryExportOutput struct {
+	ObjectName   string `json:"objectName" jsonschema:"The object holding the export in the bucket"`
+	Format       string `json:"format" jsonschema:"The export format"`
+	Entries      int    `json:"entries" jsonschema:"The number of library entries exported"`
+	Size         int64  `json:"size" jsonschema:"Size of the export in bytes"`
+	Streamed     bool   `json:"streamed,omitempty" jsonschema:"Whether the export was streamed into the bucket as it was written"`
+	PresignedURL string `json:"presignedUrl,omitempty" jsonschema:"A URL from which the export can be downloaded without credentials, when requested"`
+	ExpiresAt    string `json:"expiresAt,omitempty" jsonschema:"RFC 3339 time at which the presigned URL expires"`
+	// Estimate is only set when the call asked for estimateOnly, in which case nothing was stored
+	Estimate *CostEstimate `json:"estimate,omitempty" jsonschema:"What the export would cost, when estimateOnly was set; objectName is then the name it would be stored as"`
+}
+
+// exportFormat writes library entries in one of the export formats
+type exportFormat struct {
+	extension   string
+	contentType string
+	newEncoder  func(w io.Writer) entryEncoder
+}
+
+// entryEncoder writes library entries one at a time
+type entryEncoder interface {
+	encode(entry library.Entry) error
+	// flush writes anything still buffered once every entry has been encoded
+	flush() error
+}
+
+// exportFormats are the supported export formats, by name
+var exportFormats = map[string]exportFormat{
+	"jsonl":  {extension: "jsonl", contentType: "application/x-ndjson; charset=utf-8", newEncoder: newJSONLEncoder},
+	"bibtex": {extension: "bib", contentType: "application/x-bibtex; charset=utf-8", newEncoder: newBibTeXEncoder},
+	"csv":    {extension: "csv", contentType: "text/csv; charset=utf-8", newEncoder: newCSVEncoder},
+}
+
+// exportUploader stores an export built in memory in the articles bucket; replaced in tests
+var exportUploader = func(ctx context.Context, objectName string, data []byte, contentType string) error {
+	if globalS3Config == nil {
+		return fmt.Errorf("S3 configuration not loaded")
+	}
+	return storage.PutObjectBytes(ctx, globalS3Config, S3_ARTICLES_BUCKET, objectName, data, contentType)
+}
+
+// exportStreamer streams an export into the articles bucket as it is written and returns its size;
+// replaced in tests
+var exportStreamer = func(ctx context.Context, objectName string, content io.Reader, contentType string) (int64, error) {
+	if globalS3Config == nil {
+		return 0, fmt.Errorf("S3 configuration not loaded")
+	}
+	return storage.PutObjectStream(ctx, globalS3Config, S3_ARTICLES_BUCKET, objectName, content, contentType)
+}
+
+// exportPresigner returns a presigned download URL of an export; replaced in tests
+var exportPresigner = func(ctx context.Context, objectName string, expiry time.Duration) (string, error) {
+	if globalS3Config == nil {
+		return "", fmt.Errorf("S3 configuration not loaded")
+	}
+	return storage.PresignGetObject(ctx, globalS3Config, S3_ARTICLES_BUCKET, objectName, expiry)
+}
+
+// objectAttributesReader reads the metadata and tags of a stored object; replaced in tests
+var objectAttributesReader = func(ctx context.Context, objectName string) (storage.ObjectAttributes, error) {
+	if globalS3Config == nil {
+		return storage.ObjectAttributes{}, fmt.Errorf("S3 configuration not loaded")
+	}
+	return storage.StatObject(ctx, globalS3Config, S3_ARTICLES_BUCKET, objectName)
+}
+
+// libraryExportIssues checks the export format and the stored date range
+func libraryExportIssues(args LibraryExportArgs) []ValidationIssue {
+	var issues []ValidationIssue
+	if _, ok := exportFormats[args.Format]; !ok {
+		issues = append(issues, ValidationIssue{
+			Fields:  []string{"format"},
+			Message: fmt.Sprintf("format %q is not supported, expected jsonl, bibtex or csv", args.Format),
+		})
+	}
+	since, sinceErr := parseExportDate("storedSince", args.StoredSince)
+	until, untilErr := parseExportDate("storedUntil", args.StoredUntil)
+	for _, issue := range []*ValidationIssue{sinceErr, untilErr} {
+		if issue != nil {
+			issues = append(issues, *issue)
+		}
+	}
+	if sinceErr == nil && untilErr == nil && !since.IsZero() && !until.IsZero() && until.Before(since) {
+		issues = append(issues, ValidationIssue{
+			Fields:  []string{"storedSince", "storedUntil"},
+			Message: fmt.Sprintf("storedUntil %s is before storedSince %s", args.StoredUntil, args.StoredSince),
+		})
+	}
+	return issues
+}
+
+// parseExportDate parses an optional UTC date of the export filter
+func parseExportDate(field, value string) (time.Time, *ValidationIssue) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, &ValidationIssue{Fields: []string{field}, Message: fmt.Sprintf("%s %q is not a valid date, expected YYYY-MM-DD", field, value)}
+	}
+	return date, nil
+}
+
+// libraryExport writes the library index entries matching the filters to an object in the bucket
+func libraryExport(ctx context.Context, input json.RawMessage) (any, error) {
+	var args LibraryExportArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+	if issues := libraryExportIssues(args); len(issues) > 0 {
+		return nil, invalidInputError(issues)
+	}
+	if globalLibrary == nil {
+		return nil, fmt.Errorf("library index not available. Please ensure S3 storage is configured")
+	}
+	entries, err := globalLibrary.Entries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read library index: %w", err)
+	}
+	entries, err = selectExportEntries(ctx, entries, args)
+	if err != nil {
+		return nil, err
+	}
+
+	format := exportFormats[args.Format]
+	output := LibraryExportOutput{
+		ObjectName: exportObjectPrefix + time.Now().UTC().Format("20060102T150405Z") + "." + format.extension,
+		Format:     args.Format,
+		Entries:    len(entries),
+		Streamed:   len(entries) > exportConfig.StreamThreshold,
+	}
+	if args.EstimateOnly {
+		var size countingWriter
+		if err := writeExport(&size, format, entries); err != nil {
+			return nil, fmt.Errorf("failed to encode library export: %w", err)
+		}
+		output.Size = int64(size)
+		output.Estimate = &CostEstimate{StorageWrites: 1, EstimatedBytes: output.Size, Items: output.Entries}
+		return output, nil
+	}
+	if output.Streamed {
+		output.Size, err = streamExport(ctx, output.ObjectName, format, entries)
+	} else {
+		var b bytes.Buffer
+		if err = writeExport(&b, format, entries); err == nil {
+			output.Size = int64(b.Len())
+			err = exportUploader(ctx, output.ObjectName, b.Bytes(), format.contentType)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to store library export: %w", err)
+	}
+	slog.Info("Library exported", "object", output.ObjectName, "format", args.Format, "entries", output.Entries, "size", output.Size, "streamed", output.Streamed)
+
+	if args.Presign {
+		expiresAt := time.Now().Add(exportConfig.PresignExpiry.Duration())
+		url, err := exportPresigner(ctx, output.ObjectName, exportConfig.PresignExpiry.Duration())
+		if err != nil {
+			return nil, fmt.Errorf("library exported to %s, but presigning its URL failed: %w", output.ObjectName, err)
+		}
+		output.PresignedURL = url
+		output.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+	}
+	return output, nil
+}
+
+// selectExportEntries completes the entries from the metadata of their objects and keeps those
+// matching the prefix and stored date filters
+func selectExportEntries(ctx context.Context, entries []library.Entry, args LibraryExportArgs) ([]library.Entry, error) {
+	since, _ := parseExportDate("storedSince", args.StoredSince)
+	until, _ := parseExportDate("storedUntil", args.StoredUntil)
+	var selected []library.Entry
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.ObjectName, args.Prefix) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		entry = completeExportEntry(ctx, entry)
+		if !since.IsZero() || !until.IsZero() {
+			stored, ok := entryStoredDate(entry)
+			if !ok || (!since.IsZero() && stored.Before(since)) || (!until.IsZero() && stored.After(until)) {
+				continue
+			}
+		}
+		selected = append(selected, entry)
+	}
+	return selected, nil
+}
+
+// entryStoredDate returns the UTC date on which an entry was stored, if it is known
+func entryStoredDate(entry library.Entry) (time.Time, bool) {
+	if entry.Provenance == nil {
+		return time.Time{}, false
+	}
+	stored, err := time.Parse(time.RFC3339, entry.Provenance.Timestamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return stored.UTC().Truncate(24 * time.Hour), true
+}
+
+// completeExportEntry fills in what an entry lacks, e.g., entries recorded before their field was
+// indexed, from the user metadata and tags of its object. An object that cannot be read, or a
+// metadata-only entry without one, leaves the entry as it is.
+func completeExportEntry(ctx context.Context, entry library.Entry) library.Entry {
+	// Articles that were not downloaded have no object to read
+	if entry.Status == library.StatusMetadataOnly {
+		return entry
+	}
+	if entry.ArticleID != "" && entry.SourceURL != "" && entry.SHA256 != "" && entry.Size > 0 && entry.Provenance != nil {
+		return entry
+	}
+	attributes, err := objectAttributesReader(ctx, entry.ObjectName)
+	if err != nil {
+		slog.Warn("Failed to read object metadata for the library export", "object", entry.ObjectName, "error", err)
+		return entry
+	}
+	// Tags override metadata, since they can be changed after the object was stored
+	values := make(map[string]string, len(attributes.Metadata)+len(attributes.Tags))
+	for key, value := range attributes.Metadata {
+		values[key] = value
+	}
+	for key, value := range attributes.Tags {
+		values[strings.ToLower(key)] = value
+	}
+
+	if entry.ArticleID == "" {
+		if id, ok := articleIDFromObjectName(entry.ObjectName); ok {
+			entry.ArticleID = id
+		} else if id, err := arxivid.Parse(values["article-id"]); err == nil {
+			entry.ArticleID = id.Canonical()
+		}
+	}
+	if entry.SourceURL == "" {
+		entry.SourceURL = values["source-url"]
+	}
+	if entry.SHA256 == "" {
+		entry.SHA256 = values["sha256"]
+	}
+	if entry.Size <= 0 {
+		entry.Size = attributes.Size
+	}
+	if entry.Provenance == nil {
+		entry.Provenance = provenanceFromMetadata(values)
+	}
+	return entry
+}
+
+// articleIDFromObjectName returns the arXiv identifier of an object stored under arxiv/
+func articleIDFromObjectName(objectName string) (string, bool) {
+	key, ok := strings.CutPrefix(objectName, "arxiv/")
+	if !ok {
+		return "", false
+	}
+	key = strings.TrimSuffix(key, ".pdf")
+	// Storage keys of old-style identifiers replace the slash with an underscore
+	id, err := arxivid.Parse(strings.Replace(key, "_", "/", 1))
+	if err != nil {
+		return "", false
+	}
+	return id.Canonical(), true
+}
+
+// countingWriter counts the bytes written to it and discards them
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+// writeExport writes entries in an export format
+func writeExport(w io.Writer, format exportFormat, entries []library.Entry) error {
+	encoder := format.newEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.encode(entry); err != nil {
+			return fmt.Errorf("failed to write entry %s: %w", entry.ObjectName, err)
+		}
+	}
+	return encoder.flush()
+}
+
+// streamExport writes entries in an export format straight into the upload of the export object
+func streamExport(ctx context.Context, objectName string, format exportFormat, entries []library.Entry) (int64, error) {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeExport(writer, format, entries))
+	}()
+	size, err := exportStreamer(ctx, objectName, reader, format.contentType)
+	// Unblocks the writer if the upload stopped reading early
+	reader.CloseWithError(fmt.Errorf("export upload ended"))
+	return size, err
+}
+
+// jsonlEncoder writes every entry as canonical JSON on a line of its own
+type jsonlEncoder struct {
+	w io.Writer
+}
+
+func newJSONLEncoder(w io.Writer) entryEncoder {
+	return &jsonlEncoder{w: w}
+}
+
+func (e *jsonlEncoder) encode(entry library.Entry) error {
+	data, err := canonicaljson.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(append(data, '\n'))
+	return err
+}
+
+func (e *jsonlEncoder) flush() error {
+	return nil
+}
+
+// csvColumns are the columns of CSV exports
+var csvColumns = []string{"objectName", "bucket", "articleId", "sourceUrl", "sha256", "size", "storedAt", "tool", "queryTool", "query", "summary"}
+
+// csvEncoder writes a header row followed by a row per entry
+type csvEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVEncoder(w io.Writer) entryEncoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+func (e *csvEncoder) encode(entry library.Entry) error {
+	if !e.header {
+		if err := e.w.Write(csvColumns); err != nil {
+			return err
+		}
+		e.header = true
+	}
+	var provenance library.Provenance
+	if entry.Provenance != nil {
+		provenance = *entry.Provenance
+	}
+	size := ""
+	if entry.Size > 0 {
+		size = strconv.FormatInt(entry.Size, 10)
+	}
+	return e.w.Write([]string{
+		entry.ObjectName, entry.Bucket, entry.ArticleID, entry.SourceURL, entry.SHA256, size,
+		provenance.Timestamp, provenance.Tool, provenance.QueryTool, provenance.Query, entry.Summary,
+	})
+}
+
+func (e *csvEncoder) flush() error {
+	if !e.header {
+		if err := e.w.Write(csvColumns); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// bibtexEncoder writes a @misc record per entry: arXiv articles cite their identifier as an eprint,
+// and other downloads their source URL
+type bibtexEncoder struct {
+	w     io.Writer
+	first bool
+}
+
+func newBibTeXEncoder(w io.Writer) entryEncoder {
+	return &bibtexEncoder{w: w, first: true}
+}
+
+// bibtexMonths are the BibTeX month macros, for the month of new-style arXiv identifiers
+var bibtexMonths = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+func (e *bibtexEncoder) encode(entry library.Entry) error {
+	var b strings.Builder
+	if !e.first {
+		b.WriteByte('\n')
+	}
+	e.first = false
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, ",\n  %s = {%s}", name, bibtexEscape(value))
+		}
+	}
+
+	note := "Stored as " + entry.ObjectName + " in bucket " + entry.Bucket
+	if stored, ok := entryStoredDate(entry); ok {
+		note += " on " + stored.Format(time.DateOnly)
+	}
+	if id, err := arxivid.Parse(entry.ArticleID); entry.ArticleID != "" && err == nil {
+		fmt.Fprintf(&b, "@misc{arxiv-%s", bibtexKey(id.StorageKey()))
+		field("eprint", id.Canonical())
+		field("archivePrefix", "arXiv")
+		field("url", id.AbsURL(arxivAbsBaseURL))
+		// Identifiers of both schemes start with the two-digit year and month of submission
+		year, month := 2000+atoi(id.Number[:2]), atoi(id.Number[2:4])
+		if id.Scheme == arxivid.SchemeOld && year >= 2091 {
+			year -= 100
+		}
+		field("year", strconv.Itoa(year))
+		fmt.Fprintf(&b, ",\n  month = %s", bibtexMonths[month-1])
+	} else {
+		fmt.Fprintf(&b, "@misc{object-%s", bibtexKey(entry.ObjectName))
+		field("howpublished", entry.SourceURL)
+		field("url", entry.SourceURL)
+	}
+	field("note", note)
+	b.WriteString("\n}\n")
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *bibtexEncoder) flush() error {
+	return nil
+}
+
+// atoi converts digits that have already been validated
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// bibtexKey keeps the characters of a citation key that BibTeX accepts unquoted
+func bibtexKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == ':':
+			return r
+		}
+		return '-'
+	}, s)
+}
+
+// bibtexEscape escapes the braces that would otherwise end a braced BibTeX field value early
+var bibtexEscape = strings.NewReplacer(`\`, `\textbackslash{}`, `{`, `\{`, `}`, `\}`).Replace
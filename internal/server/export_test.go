@@ -0,0 +1,235 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/settings"
+	"opus-mcp/internal/storage"
+)
+
+// exportFixture sets up a library of three entries: a fully indexed arXiv article, an old-style
+// arXiv article indexed before its metadata was, and a web download
+func exportFixture(t *testing.T) {
+	t.Helper()
+	originalConfig, originalLibrary, originalExportConfig := globalS3Config, globalLibrary, exportConfig
+	originalUploader, originalStreamer, originalPresigner, originalAttributes := exportUploader, exportStreamer, exportPresigner, objectAttributesReader
+	t.Cleanup(func() {
+		globalS3Config, globalLibrary, exportConfig = originalConfig, originalLibrary, originalExportConfig
+		exportUploader, exportStreamer, exportPresigner, objectAttributesReader = originalUploader, originalStreamer, originalPresigner, originalAttributes
+	})
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	globalLibrary = library.New(&library.MemoryStore{})
+	exportConfig = ExportConfig{StreamThreshold: 1000, PresignExpiry: settings.Duration(time.Hour)}
+
+	ctx := context.Background()
+	for _, entry := range []library.Entry{
+		{
+			ObjectName: "arxiv/2411.04321v1.pdf",
+			Bucket:     "opus-mcp-articles",
+			ArticleID:  "2411.04321v1",
+			SourceURL:  "https://arxiv.org/pdf/2411.04321v1",
+			SHA256:     "3f5a1e8b9c0d2e4f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f",
+			Size:       1048576,
+			Provenance: &library.Provenance{
+				Tool:      "arxiv_download_pdf",
+				QueryTool: "arxiv_category_fetch_latest",
+				Query:     `cs.AI AND "graph, neural"`,
+				Timestamp: "2024-11-07T10:00:04Z",
+			},
+			Summary: "summaries/2411.04321v1.md",
+		},
+		{ObjectName: "arxiv/hep-th_9901001v1.pdf", Bucket: "opus-mcp-articles"},
+		{
+			ObjectName: "web/example.org/{draft}_report.pdf",
+			Bucket:     "opus-mcp-articles",
+			SourceURL:  "https://example.org/{draft}_report.pdf",
+			SHA256:     "bdfaa68d8984f0dc02beaca527b76f207d99b666d31d1da728ee0728182df697",
+			Size:       2048,
+			Provenance: &library.Provenance{Tool: "url_download_to_storage", Timestamp: "2024-11-30T23:59:59Z"},
+		},
+	} {
+		if err := globalLibrary.Record(ctx, entry); err != nil {
+			t.Fatalf("failed to record fixture entry: %v", err)
+		}
+	}
+
+	objectAttributesReader = func(ctx context.Context, objectName string) (storage.ObjectAttributes, error) {
+		if objectName != "arxiv/hep-th_9901001v1.pdf" {
+			return storage.ObjectAttributes{}, storage.ErrObjectNotFound
+		}
+		return storage.ObjectAttributes{
+			Size: 204800,
+			Metadata: map[string]string{
+				"source-url":           "https://arxiv.org/pdf/hep-th/9901001v1",
+				"provenance-tool":      "arxiv_download_pdf",
+				"provenance-timestamp": "2024-10-02T08:30:00Z",
+				"sha256":               "stale",
+			},
+			Tags: map[string]string{"sha256": "9b74c9897bac770ffc029102a200c5de2c1a4d0b2e5b2b1d4f3a0d7f9c8e6a51"},
+		}, nil
+	}
+}
+
+// exportCall exports the library and returns the output and the content of the export
+func exportCall(t *testing.T, arguments string) (LibraryExportOutput, []byte) {
+	t.Helper()
+	var content []byte
+	exportUploader = func(ctx context.Context, objectName string, data []byte, contentType string) error {
+		content = data
+		return nil
+	}
+	exportStreamer = func(ctx context.Context, objectName string, r io.Reader, contentType string) (int64, error) {
+		data, err := io.ReadAll(r)
+		content = data
+		return int64(len(data)), err
+	}
+	result, err := libraryExport(context.Background(), []byte(arguments))
+	if err != nil {
+		t.Fatalf("libraryExport(%s) unexpected error: %v", arguments, err)
+	}
+	return result.(LibraryExportOutput), content
+}
+
+func TestLibraryExportFormats(t *testing.T) {
+	exportFixture(t)
+
+	for _, format := range []string{"jsonl", "bibtex", "csv"} {
+		t.Run(format, func(t *testing.T) {
+			output, content := exportCall(t, `{"format":"`+format+`"}`)
+			extension := exportFormats[format].extension
+			if !strings.HasPrefix(output.ObjectName, exportObjectPrefix) || !strings.HasSuffix(output.ObjectName, "."+extension) {
+				t.Errorf("objectName = %q, want exports/<timestamp>.%s", output.ObjectName, extension)
+			}
+			if output.Entries != 3 || output.Size != int64(len(content)) || output.Streamed {
+				t.Errorf("output = %+v, want 3 entries of %d bytes built in memory", output, len(content))
+			}
+
+			golden := "testdata/library_export.golden." + extension
+			if *updateGolden {
+				if err := os.WriteFile(golden, content, 0o644); err != nil {
+					t.Fatalf("failed to write golden export: %v", err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read golden export: %v", err)
+			}
+			if !bytes.Equal(content, want) {
+				t.Errorf("export differs from %s:\n%s", golden, content)
+			}
+		})
+	}
+}
+
+func TestLibraryExportEstimateMatchesOutcome(t *testing.T) {
+	exportFixture(t)
+	exportUploader = func(ctx context.Context, objectName string, data []byte, contentType string) error {
+		t.Error("an estimate stored the export")
+		return nil
+	}
+	result, err := libraryExport(context.Background(), []byte(`{"format":"bibtex","prefix":"arxiv/","estimateOnly":true}`))
+	if err != nil {
+		t.Fatalf("libraryExport() estimate unexpected error: %v", err)
+	}
+	estimated := result.(LibraryExportOutput)
+
+	output, content := exportCall(t, `{"format":"bibtex","prefix":"arxiv/"}`)
+	estimate := estimated.Estimate
+	if estimate == nil || output.Estimate != nil {
+		t.Fatalf("estimate = %+v, export estimate = %+v, want only the estimate to carry one", estimate, output.Estimate)
+	}
+	if estimate.Items != output.Entries || estimate.EstimatedBytes != int64(len(content)) || estimated.Size != output.Size {
+		t.Errorf("estimate = %+v with size %d, want %d entries of %d bytes", estimate, estimated.Size, output.Entries, len(content))
+	}
+	if estimate.StorageWrites != 1 || estimate.ArxivRequests != 0 {
+		t.Errorf("estimate = %+v, want a single storage write and no arXiv request", estimate)
+	}
+}
+
+func TestLibraryExportStreamsAboveThreshold(t *testing.T) {
+	exportFixture(t)
+	_, inMemory := exportCall(t, `{"format":"csv"}`)
+
+	exportConfig.StreamThreshold = 2
+	output, streamed := exportCall(t, `{"format":"csv"}`)
+	if !output.Streamed || output.Size != int64(len(streamed)) {
+		t.Errorf("output = %+v, want a streamed export of %d bytes", output, len(streamed))
+	}
+	if !bytes.Equal(streamed, inMemory) {
+		t.Errorf("streamed export differs from the one built in memory:\n%s", streamed)
+	}
+
+	// A failed upload stops the writer instead of leaving it blocked
+	exportStreamer = func(ctx context.Context, objectName string, r io.Reader, contentType string) (int64, error) {
+		return 0, errors.New("connection reset")
+	}
+	if _, err := libraryExport(context.Background(), []byte(`{"format":"csv"}`)); err == nil {
+		t.Error("libraryExport() with a failing upload should fail")
+	}
+}
+
+func TestLibraryExportFilters(t *testing.T) {
+	exportFixture(t)
+
+	tests := []struct {
+		arguments string
+		want      []string
+	}{
+		{`{"format":"jsonl","prefix":"arxiv/"}`, []string{"arxiv/2411.04321v1.pdf", "arxiv/hep-th_9901001v1.pdf"}},
+		// The old-style article's stored date comes from the metadata of its object
+		{`{"format":"jsonl","storedUntil":"2024-10-31"}`, []string{"arxiv/hep-th_9901001v1.pdf"}},
+		// Dates are inclusive
+		{`{"format":"jsonl","storedSince":"2024-11-07","storedUntil":"2024-11-30"}`, []string{"arxiv/2411.04321v1.pdf", "web/example.org/{draft}_report.pdf"}},
+		{`{"format":"jsonl","prefix":"summaries/"}`, nil},
+	}
+	for _, tt := range tests {
+		output, content := exportCall(t, tt.arguments)
+		var got []string
+		for line := range strings.Lines(string(content)) {
+			_, rest, _ := strings.Cut(line, `"objectName":"`)
+			objectName, _, _ := strings.Cut(rest, `"`)
+			got = append(got, objectName)
+		}
+		if output.Entries != len(tt.want) || strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("libraryExport(%s) exported %d entries %v, want %v", tt.arguments, output.Entries, got, tt.want)
+		}
+	}
+}
+
+func TestLibraryExportPresignsOnRequest(t *testing.T) {
+	exportFixture(t)
+	var presigned string
+	exportPresigner = func(ctx context.Context, objectName string, expiry time.Duration) (string, error) {
+		presigned = objectName
+		return "https://s3.example.com/" + objectName + "?X-Amz-Expires=3600", nil
+	}
+
+	output, _ := exportCall(t, `{"format":"bibtex","presign":true}`)
+	if presigned != output.ObjectName || output.PresignedURL == "" || output.ExpiresAt == "" {
+		t.Errorf("output = %+v, want a presigned URL of %s with its expiry", output, output.ObjectName)
+	}
+	output, _ = exportCall(t, `{"format":"bibtex"}`)
+	if output.PresignedURL != "" || output.ExpiresAt != "" {
+		t.Errorf("output = %+v, want no presigned URL unless requested", output)
+	}
+}
+
+func TestLibraryExportIssues(t *testing.T) {
+	issues := libraryExportIssues(LibraryExportArgs{Format: "ris", StoredSince: "2024-12-01", StoredUntil: "2024-11-31"})
+	if len(issues) != 2 || issues[0].Fields[0] != "format" || issues[1].Fields[0] != "storedUntil" {
+		t.Errorf("issues = %+v, want an unsupported format and an invalid storedUntil", issues)
+	}
+	issues = libraryExportIssues(LibraryExportArgs{Format: "csv", StoredSince: "2024-12-01", StoredUntil: "2024-11-30"})
+	if len(issues) != 1 || len(issues[0].Fields) != 2 {
+		t.Errorf("issues = %+v, want storedUntil before storedSince reported", issues)
+	}
+}
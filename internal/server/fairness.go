@@ -0,0 +1,287 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"opus-mcp/internal/metrics"
+
+	"golang.org/x/time/rate"
+)
+
+// fairScheduler hands out turns on a rate limiter round-robin between clients, instead of in the
+// order the requests arrived: a client with many requests queued gets one turn at a time, so that
+// a single request from another client waits for at most the one request in progress.
+// Only the waiter holding the turn waits on the limiter; the others wait in their client's queue.
+type fairScheduler struct {
+	mu sync.Mutex
+	// queues are the waiters of every client with requests queued, in arrival order
+	queues map[string][]*fairWaiter
+	// ring is the order in which the clients with requests queued get their next turn
+	ring []string
+	// holder is the waiter holding the turn, if any
+	holder *fairWaiter
+}
+
+// fairWaiter is a request waiting for its turn on the limiter
+type fairWaiter struct {
+	client string
+	// turn is closed when the request is given the turn
+	turn chan struct{}
+}
+
+func newFairScheduler() *fairScheduler {
+	return &fairScheduler{queues: make(map[string][]*fairWaiter)}
+}
+
+// arxivScheduler shares the arXiv rate limiter fairly between the clients of the server
+var arxivScheduler = newFairScheduler()
+
+func init() {
+	metrics.NewGaugeFunc("arxiv_waiting_clients", "Number of distinct clients with arXiv requests waiting for the rate limiter.", func() float64 {
+		return float64(arxivScheduler.waitingClients())
+	})
+}
+
+// waitForArxiv blocks until the current call may send a request to arXiv, taking its turn among
+// the clients waiting for the arXiv rate limiter of the tool dependencies, or refuses it if its
+// deadline would pass first. Every request to arXiv waits for it, which keeps the server within the
+// arXiv API terms of use of one request every 3 seconds unless configured otherwise.
+func waitForArxiv(ctx context.Context) error {
+	start := time.Now()
+	used, err := arxivSlotFrom(ctx).use(ctx)
+	if !used {
+		err = arxivScheduler.wait(ctx, toolDeps.ArxivLimiter)
+	}
+	if waited := time.Since(start); waited > arxivSlowWait {
+		slog.Info("Waited for the arXiv rate limiter", "wait", waited.Round(time.Millisecond), "error", err)
+	}
+	return err
+}
+
+// arxivSlot is a request slot on the arXiv rate limiter reserved ahead of time, when a download job
+// is queued, so that the job keeps its place among the arXiv requests while it waits for a worker
+type arxivSlot struct {
+	mu          sync.Mutex
+	reservation *rate.Reservation
+	// done is set once the slot is used or given back
+	done bool
+}
+
+// reserveArxivSlot reserves the next request slot on the arXiv rate limiter of the tool
+// dependencies; nil if the limiter cannot grant one
+func reserveArxivSlot() *arxivSlot {
+	reservation := toolDeps.ArxivLimiter.Reserve()
+	if !reservation.OK() {
+		return nil
+	}
+	return &arxivSlot{reservation: reservation}
+}
+
+// use waits until the reserved slot comes up. It reports false, without waiting, if there is no
+// slot or it was already used or given back, so that the request waits for a new one instead.
+func (s *arxivSlot) use(ctx context.Context) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.done = true
+	s.mu.Unlock()
+
+	delay := s.reservation.Delay()
+	if delay == 0 {
+		return true, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true, nil
+	case <-ctx.Done():
+		s.reservation.Cancel()
+		return true, ctx.Err()
+	}
+}
+
+// cancel gives the slot back to the limiter, for the requests behind it, unless it was used
+func (s *arxivSlot) cancel() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return
+	}
+	s.done = true
+	s.reservation.Cancel()
+}
+
+type arxivSlotKey struct{}
+
+// withArxivSlot returns a context whose first arXiv request uses the reserved slot
+func withArxivSlot(ctx context.Context, slot *arxivSlot) context.Context {
+	return context.WithValue(ctx, arxivSlotKey{}, slot)
+}
+
+// arxivSlotFrom returns the slot reserved for the current call, if any
+func arxivSlotFrom(ctx context.Context) *arxivSlot {
+	slot, _ := ctx.Value(arxivSlotKey{}).(*arxivSlot)
+	return slot
+}
+
+// waitForHost blocks until the current call may send a request to the host of a URL: requests to
+// arXiv wait for the arXiv rate limiter, while other hosts, such as S3, are not limited
+func waitForHost(ctx context.Context, rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil || !isArxivHost(target.Hostname()) {
+		return nil
+	}
+	return waitForArxiv(ctx)
+}
+
+// schedulingClient identifies the client of a call for fair scheduling: its bearer token or address
+// for HTTP clients, otherwise its session. Calls without either share one queue.
+func schedulingClient(ctx context.Context) string {
+	info, _ := callInfoFrom(ctx)
+	if info.ClientID != "" {
+		return info.ClientID
+	}
+	return info.SessionID
+}
+
+// wait blocks until the calling client's turn comes up and the limiter allows a request, or until
+// the context is done; see reserveAndWait for calls whose deadline is too close. A request
+// cancelled while queued gives up its place without using a turn.
+func (s *fairScheduler) wait(ctx context.Context, limiter *rate.Limiter) error {
+	waiter := s.enqueue(schedulingClient(ctx))
+	select {
+	case <-waiter.turn:
+	case <-ctx.Done():
+		if s.abandon(waiter) {
+			return ctx.Err()
+		}
+		// The turn was given at the same time as the cancellation, and is passed on
+		s.release()
+		return ctx.Err()
+	}
+	defer s.release()
+	return reserveAndWait(ctx, limiter, time.Now())
+}
+
+// reserveAndWait waits for a reservation on the limiter, unless the call's deadline comes before
+// the reservation: then the reservation is cancelled right away and the call refused as
+// RATE_LIMITED, naming the wait it needed and the time it had, instead of spending the rest of its
+// deadline waiting for nothing
+func reserveAndWait(ctx context.Context, limiter *rate.Limiter, now time.Time) error {
+	reservation := limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return fmt.Errorf("the rate limiter cannot grant a request")
+	}
+	delay := reservation.DelayFrom(now)
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		reservation.CancelAt(now)
+		available := max(0, deadline.Sub(now))
+		toolErr := &ToolError{
+			Code: ErrCodeRateLimited,
+			Message: fmt.Sprintf("the arXiv rate limiter needs a wait of %s before the next request, but the call only has %s left before its deadline",
+				delay.Round(time.Millisecond), available.Round(time.Millisecond)),
+			Details: map[string]any{
+				"source":              "limiter",
+				"requiredWaitSeconds": delay.Seconds(),
+				"availableSeconds":    available.Seconds(),
+			},
+		}
+		return toolErr.withRetryAt(delay, now)
+	}
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the slot back for the calls behind this one
+		reservation.Cancel()
+		return ctx.Err()
+	}
+}
+
+// enqueue queues a waiter for the client, giving it the turn right away if no one holds it
+func (s *fairScheduler) enqueue(client string) *fairWaiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	waiter := &fairWaiter{client: client, turn: make(chan struct{})}
+	s.queues[client] = append(s.queues[client], waiter)
+	// A client being served rejoins the ring when its turn ends, behind the clients waiting already
+	if !slices.Contains(s.ring, client) && (s.holder == nil || s.holder.client != client) {
+		s.ring = append(s.ring, client)
+	}
+	s.dispatchLocked()
+	return waiter
+}
+
+// abandon removes a waiter that has not been given the turn from its queue, and reports whether
+// it was still queued
+func (s *fairScheduler) abandon(waiter *fairWaiter) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holder == waiter {
+		return false
+	}
+	queue := slices.DeleteFunc(s.queues[waiter.client], func(w *fairWaiter) bool { return w == waiter })
+	if len(queue) > 0 {
+		s.queues[waiter.client] = queue
+		return true
+	}
+	delete(s.queues, waiter.client)
+	s.ring = slices.DeleteFunc(s.ring, func(client string) bool { return client == waiter.client })
+	return true
+}
+
+// release ends the turn of the holder and passes it on to the next client in the ring
+func (s *fairScheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client := s.holder.client
+	s.holder = nil
+	if len(s.queues[client]) > 0 && !slices.Contains(s.ring, client) {
+		s.ring = append(s.ring, client)
+	}
+	s.dispatchLocked()
+}
+
+// dispatchLocked gives the turn to the first waiter of the next client in the ring, unless it is held
+func (s *fairScheduler) dispatchLocked() {
+	if s.holder != nil || len(s.ring) == 0 {
+		return
+	}
+	client := s.ring[0]
+	s.ring = s.ring[1:]
+	queue := s.queues[client]
+	s.holder = queue[0]
+	if len(queue) > 1 {
+		s.queues[client] = queue[1:]
+	} else {
+		delete(s.queues, client)
+	}
+	close(s.holder.turn)
+}
+
+// waitingClients returns the number of clients with requests queued
+func (s *fairScheduler) waitingClients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queues)
+}
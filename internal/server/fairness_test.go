@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// clientContext returns a context of a call by the HTTP client with the given identity
+func clientContext(ctx context.Context, clientID string) context.Context {
+	return withCallInfo(ctx, callInfo{ClientID: clientID})
+}
+
+// queuedWaiters returns the number of waiters queued for the client, not counting the holder
+func (s *fairScheduler) queuedWaiters(client string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queues[client])
+}
+
+// waitUntil polls a condition until it holds, failing the test after a few seconds
+func waitUntil(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not reached within 5s")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFairSchedulerBoundsWaitOfSingleQueryClient(t *testing.T) {
+	const interval = 100 * time.Millisecond
+	const batchSize = 10
+	limiter := rate.NewLimiter(rate.Every(interval), 1)
+	scheduler := newFairScheduler()
+
+	var mu sync.Mutex
+	var completed []string
+	var wg sync.WaitGroup
+	run := func(client string) {
+		defer wg.Done()
+		if err := scheduler.wait(clientContext(context.Background(), client), limiter); err != nil {
+			t.Errorf("wait() for %s unexpected error: %v", client, err)
+		}
+		mu.Lock()
+		completed = append(completed, client)
+		mu.Unlock()
+	}
+
+	// One client queues a whole batch of requests at once
+	wg.Add(batchSize)
+	for range batchSize {
+		go run("token:batch")
+	}
+	waitUntil(t, func() bool {
+		mu.Lock()
+		enqueued := len(completed) + scheduler.queuedWaiters("token:batch")
+		mu.Unlock()
+		scheduler.mu.Lock()
+		if scheduler.holder != nil {
+			enqueued++
+		}
+		scheduler.mu.Unlock()
+		return enqueued == batchSize
+	})
+
+	// Another client's single request waits for at most the batch request holding the turn
+	mu.Lock()
+	before := len(completed)
+	mu.Unlock()
+	start := time.Now()
+	wg.Add(1)
+	run("token:single")
+	waited := time.Since(start)
+
+	mu.Lock()
+	position := len(completed) - 1
+	mu.Unlock()
+	if position > before+1 {
+		t.Errorf("single request completed after %d batch requests, %d of them after it was queued, want at most 1", position, position-before)
+	}
+	if waited > 3*interval {
+		t.Errorf("single request waited %v, want at most two limiter intervals of %v", waited, interval)
+	}
+	wg.Wait()
+	if got := scheduler.waitingClients(); got != 0 {
+		t.Errorf("waitingClients() = %d after every request completed, want 0", got)
+	}
+}
+
+func TestFairSchedulerRoundRobinsBetweenClients(t *testing.T) {
+	scheduler := newFairScheduler()
+
+	// The first request holds the turn while the others queue up
+	holder := scheduler.enqueue("token:a")
+	var waiters []*fairWaiter
+	for _, client := range []string{"token:a", "token:a", "token:a", "token:b", "token:c", "token:b"} {
+		waiters = append(waiters, scheduler.enqueue(client))
+	}
+	select {
+	case <-holder.turn:
+	default:
+		t.Fatal("the first request was not given the turn")
+	}
+
+	// Every turn ends before the next one is given
+	given := map[*fairWaiter]bool{}
+	var clients []string
+	for range waiters {
+		scheduler.release()
+		var next []*fairWaiter
+		for _, waiter := range waiters {
+			select {
+			case <-waiter.turn:
+				if !given[waiter] {
+					next = append(next, waiter)
+				}
+			default:
+			}
+		}
+		if len(next) != 1 {
+			t.Fatalf("%d requests were given the turn at once, want 1", len(next))
+		}
+		given[next[0]] = true
+		clients = append(clients, next[0].client)
+	}
+
+	want := []string{"token:b", "token:c", "token:a", "token:b", "token:a", "token:a"}
+	if !slices.Equal(clients, want) {
+		t.Errorf("turns went to %v, want %v", clients, want)
+	}
+}
+
+func TestFairSchedulerCancelledWaiters(t *testing.T) {
+	// The limiter's only token is used up, so the holder waits on it until it is cancelled
+	limiter := rate.NewLimiter(rate.Every(time.Hour), 1)
+	limiter.Allow()
+	scheduler := newFairScheduler()
+
+	holderCtx, cancelHolder := context.WithCancel(clientContext(context.Background(), "token:a"))
+	holderDone := make(chan error, 1)
+	go func() { holderDone <- scheduler.wait(holderCtx, limiter) }()
+	waitUntil(t, func() bool {
+		scheduler.mu.Lock()
+		defer scheduler.mu.Unlock()
+		return scheduler.holder != nil
+	})
+
+	// A queued request that is cancelled gives up its place right away
+	queuedCtx, cancelQueued := context.WithCancel(clientContext(context.Background(), "token:b"))
+	queuedDone := make(chan error, 1)
+	go func() { queuedDone <- scheduler.wait(queuedCtx, limiter) }()
+	waitUntil(t, func() bool { return scheduler.queuedWaiters("token:b") == 1 })
+	nextDone := make(chan error, 1)
+	go func() { nextDone <- scheduler.wait(clientContext(context.Background(), "token:c"), limiter) }()
+	waitUntil(t, func() bool { return scheduler.queuedWaiters("token:c") == 1 })
+
+	cancelQueued()
+	select {
+	case err := <-queuedDone:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("cancelled queued wait() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled queued request did not return")
+	}
+	if got := scheduler.waitingClients(); got != 1 {
+		t.Errorf("waitingClients() = %d after the cancellation, want 1", got)
+	}
+
+	// The holder being cancelled passes the turn on to the next client
+	limiter.SetLimit(rate.Inf)
+	cancelHolder()
+	if err := <-holderDone; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled holder wait() error = %v, want context.Canceled", err)
+	}
+	select {
+	case err := <-nextDone:
+		if err != nil {
+			t.Errorf("next wait() unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the turn was not passed on after the holder was cancelled")
+	}
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	if scheduler.holder != nil || len(scheduler.queues) != 0 || len(scheduler.ring) != 0 {
+		t.Errorf("scheduler holds %v, queues %v and ring %v after every request ended, want none", scheduler.holder, scheduler.queues, scheduler.ring)
+	}
+}
+
+// TestReserveAndWaitHonoursDeadline checks that a call whose deadline comes before its reservation
+// on the limiter is refused right away, leaving the slot to other calls, while a call with enough
+// time waits for its reservation
+func TestReserveAndWaitHonoursDeadline(t *testing.T) {
+	const interval = 200 * time.Millisecond
+	limiter := rate.NewLimiter(rate.Every(interval), 1)
+	// Use up the burst, so that the next reservation is delayed by a whole interval
+	limiter.Allow()
+
+	ctx, cancel := context.WithTimeout(context.Background(), interval/4)
+	defer cancel()
+	start := time.Now()
+	err := reserveAndWait(ctx, limiter, start)
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeRateLimited || !toolErr.Retryable {
+		t.Fatalf("reserveAndWait() error = %v, want a retryable %s error", err, ErrCodeRateLimited)
+	}
+	if elapsed := time.Since(start); elapsed >= interval/4 {
+		t.Errorf("reserveAndWait() took %s, want it to fail without waiting for the deadline", elapsed)
+	}
+	required, _ := toolErr.Details["requiredWaitSeconds"].(float64)
+	available, _ := toolErr.Details["availableSeconds"].(float64)
+	if required <= available || available <= 0 || required > interval.Seconds() {
+		t.Errorf("details = %v, want a required wait of up to %s longer than the available time", toolErr.Details, interval)
+	}
+	if toolErr.RetryAfterSeconds != 1 {
+		t.Errorf("retryAfterSeconds = %d, want 1", toolErr.RetryAfterSeconds)
+	}
+
+	// The cancelled reservation gave its slot back, so a call with enough time only waits one interval
+	ctx, cancel = context.WithTimeout(context.Background(), 5*interval)
+	defer cancel()
+	start = time.Now()
+	if err := reserveAndWait(ctx, limiter, start); err != nil {
+		t.Fatalf("reserveAndWait() unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*interval {
+		t.Errorf("reserveAndWait() waited %s, want at most one interval of %s", elapsed, interval)
+	}
+
+	// Without a deadline, calls wait as long as the limiter needs
+	if err := reserveAndWait(context.Background(), limiter, time.Now()); err != nil {
+		t.Fatalf("reserveAndWait() without a deadline unexpected error: %v", err)
+	}
+}
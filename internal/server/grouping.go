@@ -0,0 +1,91 @@
+package server
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+const (
+	// groupByQueriedCategory groups entries under each queried category they are listed in
+	groupByQueriedCategory = "queriedCategory"
+	// groupByPrimaryCategory groups entries under the category they were submitted to
+	groupByPrimaryCategory = "primaryCategory"
+	// groupByAnnouncedDate groups entries under the date their first version was announced on
+	groupByAnnouncedDate = "announcedDate"
+)
+
+// groupByValues are the valid values of the groupBy argument of category fetches
+var groupByValues = []any{groupByQueriedCategory, groupByPrimaryCategory, groupByAnnouncedDate}
+
+// EntryGroup is a group of fetched entries sharing a category or announcement date
+type EntryGroup struct {
+	Key        string   `json:"key" jsonschema:"The category or announcement date (YYYY-MM-DD) shared by the entries of the group; empty for the entries that have none"`
+	Count      int      `json:"count" jsonschema:"The number of entries in the group"`
+	ArticleIDs []string `json:"articleIds" jsonschema:"The identifiers of the entries in the group, in the order of the items"`
+}
+
+// groupEntries groups entries by the given mode, largest groups first, ties broken by key. The
+// group of entries without a key, if any, comes last. With groupByQueriedCategory, an entry is in
+// the group of every queried category or archive it is listed in, and entries listed in none of
+// them, e.g., those only matching keywords, have no key.
+func groupEntries(items []*FeedEntry, mode string, queried []string) []EntryGroup {
+	var groups []EntryGroup
+	index := map[string]int{}
+	add := func(key string, entry *FeedEntry) {
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, EntryGroup{Key: key, ArticleIDs: []string{}})
+		}
+		groups[i].Count++
+		groups[i].ArticleIDs = append(groups[i].ArticleIDs, entryKey(entry))
+	}
+	for _, entry := range items {
+		for _, key := range entryGroupKeys(entry, mode, queried) {
+			add(key, entry)
+		}
+	}
+	slices.SortFunc(groups, func(a, b EntryGroup) int {
+		if (a.Key == "") != (b.Key == "") {
+			if a.Key == "" {
+				return 1
+			}
+			return -1
+		}
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return groups
+}
+
+// entryGroupKeys returns the keys of the groups an entry belongs to, or a single empty key if it
+// belongs to none
+func entryGroupKeys(entry *FeedEntry, mode string, queried []string) []string {
+	switch mode {
+	case groupByPrimaryCategory:
+		return []string{entry.PrimaryCategory}
+	case groupByAnnouncedDate:
+		return []string{entry.AnnouncedOn}
+	}
+	var keys []string
+	for _, code := range queried {
+		if slices.Contains(keys, code) {
+			continue
+		}
+		listed := inQueriedCategory(entry.PrimaryCategory, []string{code}) ||
+			slices.ContainsFunc(entry.Categories, func(category string) bool {
+				return inQueriedCategory(strings.TrimSpace(category), []string{code})
+			})
+		if listed {
+			keys = append(keys, code)
+		}
+	}
+	if len(keys) == 0 {
+		return []string{""}
+	}
+	return keys
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestGroupEntries(t *testing.T) {
+	entry := func(id, announcedOn string, categories ...string) *FeedEntry {
+		return &FeedEntry{Item: &gofeed.Item{Categories: categories}, ArticleID: id, PrimaryCategory: categories[0], AnnouncedOn: announcedOn}
+	}
+	// A synthetic page of a "cs.LG OR cs.CL OR math" query, with cross-lists between the queried
+	// categories and an entry that only matched by keyword
+	items := []*FeedEntry{
+		entry("2405.00001v1", "2024-05-06", "cs.LG"),
+		entry("2405.00002v1", "2024-05-06", "cs.CL", "cs.LG"),
+		entry("2405.00003v1", "2024-05-07", "stat.ML", "cs.LG"),
+		entry("2405.00004v1", "2024-05-07", "math.OC", "cs.LG"),
+		entry("2405.00005v1", "2024-05-07", "cs.CL"),
+		entry("2405.00006v1", "", "cs.CV"),
+		entry("2405.00007v1", "2024-05-08", "math.ST", "stat.TH"),
+	}
+	queried := []string{"cs.LG", "cs.CL", "math", "cs.LG"}
+
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{
+			mode: groupByQueriedCategory,
+			want: "cs.LG=4[2405.00001v1 2405.00002v1 2405.00003v1 2405.00004v1] " +
+				"cs.CL=2[2405.00002v1 2405.00005v1] " +
+				"math=2[2405.00004v1 2405.00007v1] " +
+				"=1[2405.00006v1]",
+		},
+		{
+			// Equal counts are ordered by key
+			mode: groupByPrimaryCategory,
+			want: "cs.CL=2[2405.00002v1 2405.00005v1] " +
+				"cs.CV=1[2405.00006v1] " +
+				"cs.LG=1[2405.00001v1] " +
+				"math.OC=1[2405.00004v1] " +
+				"math.ST=1[2405.00007v1] " +
+				"stat.ML=1[2405.00003v1]",
+		},
+		{
+			// Entries without a key come last, whatever the size of their group
+			mode: groupByAnnouncedDate,
+			want: "2024-05-07=3[2405.00003v1 2405.00004v1 2405.00005v1] " +
+				"2024-05-06=2[2405.00001v1 2405.00002v1] " +
+				"2024-05-08=1[2405.00007v1] " +
+				"=1[2405.00006v1]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			groups := groupEntries(items, tt.mode, queried)
+			var got []string
+			for _, group := range groups {
+				if group.Count != len(group.ArticleIDs) {
+					t.Errorf("group %q count = %d, want %d", group.Key, group.Count, len(group.ArticleIDs))
+				}
+				got = append(got, fmt.Sprintf("%s=%d%v", group.Key, group.Count, group.ArticleIDs))
+			}
+			if joined := strings.Join(got, " "); joined != tt.want {
+				t.Errorf("groupEntries(%s) = %s, want %s", tt.mode, joined, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupEntriesWithoutEntries(t *testing.T) {
+	if groups := groupEntries(nil, groupByQueriedCategory, []string{"cs.AI"}); len(groups) != 0 {
+		t.Errorf("groupEntries() of no entries = %+v, want no groups", groups)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"opus-mcp/internal/settings"
+)
+
+// HTTPCacheConfig holds the caching configuration of the HTTP endpoints loaded from environment variables
+type HTTPCacheConfig struct {
+	// HealthMaxAge is how long clients may cache the /health response
+	HealthMaxAge settings.Duration `env:"OPUS_MCP_HEALTH_CACHE_MAX_AGE,default=5s"`
+}
+
+// LoadHTTPCacheConfig loads the caching configuration of the HTTP endpoints from environment variables
+func LoadHTTPCacheConfig() (*HTTPCacheConfig, error) {
+	var config HTTPCacheConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process HTTP cache configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// healthCacheMaxAge is how long clients may cache the /health response
+var healthCacheMaxAge = 5 * time.Second
+
+// bodyETag returns a strong entity tag for a rendered response body
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header value matches an entity tag. The comparison
+// is weak, as RFC 9110 prescribes for If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCacheable writes a rendered response body with an ETag and a Cache-Control max-age, or
+// 304 Not Modified without a body when the request's If-None-Match matches the ETag
+func writeCacheable(w http.ResponseWriter, r *http.Request, body []byte, contentType string, maxAge time.Duration) {
+	etag := bodyETag(body)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(maxAge.Seconds())))
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	if _, err := w.Write(body); err != nil {
+		slog.Error("cacheable response writing failed", "path", r.URL.Path, "error", err)
+	}
+}
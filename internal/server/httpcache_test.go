@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckETag(t *testing.T) {
+	original := serverProcessStartTime
+	t.Cleanup(func() { serverProcessStartTime = original })
+	serverProcessStartTime = time.Now().Add(-time.Hour)
+
+	get := func(target, ifNoneMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		healthCheckHandler(rec, req)
+		return rec
+	}
+
+	first := get("/health", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET /health = %d with ETag %q, want 200 with an ETag", first.Code, etag)
+	}
+	if got := first.Header().Get("Cache-Control"); got != "max-age=5" {
+		t.Errorf("Cache-Control = %q, want max-age=5", got)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(first.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to unmarshal health response: %v", err)
+	}
+	if _, ok := body["uptime"]; ok {
+		t.Error("non-verbose health response includes the uptime")
+	}
+
+	// The uptime moves on, but the response does not change
+	serverProcessStartTime = serverProcessStartTime.Add(-time.Minute)
+	tests := []struct {
+		name        string
+		target      string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{"Matching ETag", "/health", etag, http.StatusNotModified},
+		{"Weak matching ETag in a list", "/health", `"other", W/` + etag, http.StatusNotModified},
+		{"Wildcard", "/health", "*", http.StatusNotModified},
+		{"Stale ETag", "/health", `"stale"`, http.StatusOK},
+		{"Verbose with matching ETag", "/health?verbose=true", etag, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(tt.target, tt.ifNoneMatch)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("GET %s with If-None-Match %s = %d, want %d", tt.target, tt.ifNoneMatch, rec.Code, tt.wantStatus)
+			}
+			if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("304 response has a %d byte body", rec.Body.Len())
+			}
+		})
+	}
+
+	verbose := get("/health?verbose=true", "")
+	if err := json.Unmarshal(verbose.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to unmarshal verbose health response: %v", err)
+	}
+	if _, ok := body["uptime"]; !ok {
+		t.Error("verbose health response lacks the uptime")
+	}
+	if verbose.Header().Get("ETag") != "" || verbose.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("verbose response headers = %v, want no ETag and no-store", verbose.Header())
+	}
+
+	// A change in the registered tools changes the ETag
+	originalTools := toolRegistrationStatus()
+	t.Cleanup(func() { registeredTools = originalTools })
+	registeredTools = toolRegistration{Registered: []string{"a_new_tool"}}
+	if rec := get("/health", etag); rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("GET /health after a change = %d with ETag %s, want 200 with a new ETag", rec.Code, rec.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,421 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"opus-mcp/internal"
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/settings"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrCodeIdentifierNotFound means no resolution path mapped the identifiers given to an arXiv article
+const ErrCodeIdentifierNotFound = "IDENTIFIER_NOT_FOUND"
+
+// IdentifierConfig holds the configuration of the external services resolving identifiers to arXiv
+// articles, loaded from environment variables. Each service is only queried when configured.
+type IdentifierConfig struct {
+	// CrossrefMailto is the contact address sent with Crossref queries, as Crossref asks of API
+	// clients; setting it enables the Crossref lookup
+	CrossrefMailto string `env:"OPUS_MCP_CROSSREF_MAILTO"`
+	// CrossrefInterval is the minimum time between two Crossref queries
+	CrossrefInterval settings.Duration `env:"OPUS_MCP_CROSSREF_INTERVAL,default=1s"`
+	// SemanticScholarEnabled enables the Semantic Scholar lookup
+	SemanticScholarEnabled bool `env:"OPUS_MCP_SEMANTIC_SCHOLAR_ENABLED,default=false"`
+	// SemanticScholarAPIKey is sent with Semantic Scholar queries when set, for the higher rate limit
+	// of a key
+	SemanticScholarAPIKey string `env:"OPUS_MCP_SEMANTIC_SCHOLAR_API_KEY" secret:"true"`
+	// SemanticScholarInterval is the minimum time between two Semantic Scholar queries; the shared
+	// rate limit of unauthenticated clients is easily exhausted
+	SemanticScholarInterval settings.Duration `env:"OPUS_MCP_SEMANTIC_SCHOLAR_INTERVAL,default=1s"`
+}
+
+// Validate checks that the intervals between queries are positive
+func (c *IdentifierConfig) Validate() error {
+	var errs []error
+	if c.CrossrefInterval.Duration() <= 0 {
+		errs = append(errs, fmt.Errorf("OPUS_MCP_CROSSREF_INTERVAL must be positive, got %s", c.CrossrefInterval))
+	}
+	if c.SemanticScholarInterval.Duration() <= 0 {
+		errs = append(errs, fmt.Errorf("OPUS_MCP_SEMANTIC_SCHOLAR_INTERVAL must be positive, got %s", c.SemanticScholarInterval))
+	}
+	return errors.Join(errs...)
+}
+
+// LoadIdentifierConfig loads the identifier resolution configuration from environment variables
+func LoadIdentifierConfig() (*IdentifierConfig, error) {
+	var config IdentifierConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process identifier resolution configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// identifierConfig configures the external lookups of identifiers_resolve; neither is enabled by default
+var identifierConfig IdentifierConfig
+
+// Endpoints of the external services resolving identifiers; replaced in tests
+var (
+	crossrefEndpoint        = "https://api.crossref.org"
+	semanticScholarEndpoint = "https://api.semanticscholar.org/graph/v1"
+)
+
+// Rate limiters of the external services, each shared by all calls; reconfigured at startup
+var (
+	crossrefLimiter        = rate.NewLimiter(rate.Every(time.Second), 1)
+	semanticScholarLimiter = rate.NewLimiter(rate.Every(time.Second), 1)
+)
+
+// The steps of identifier resolution, in the order they are tried
+const (
+	resolveStepArxivDOI        = "arxiv_doi"
+	resolveStepCrossref        = "crossref"
+	resolveStepSemanticScholar = "semantic_scholar"
+)
+
+// The outcomes of a resolution step
+const (
+	resolveOutcomeResolved = "resolved"
+	resolveOutcomeNoMatch  = "no_match"
+	resolveOutcomeSkipped  = "skipped"
+	resolveOutcomeFailed   = "failed"
+)
+
+// The confidence of a resolution: exact when the arXiv identifier is part of the input, high when a
+// service links the identifier to arXiv, and medium when a citation was matched by a search
+const (
+	confidenceExact  = "exact"
+	confidenceHigh   = "high"
+	confidenceMedium = "medium"
+)
+
+// IdentifiersResolveArgs defines the input parameters for resolving an identifier to an arXiv article
+type IdentifiersResolveArgs struct {
+	DOI               string `json:"doi,omitempty" jsonschema:"A DOI, bare or as a doi: or https://doi.org/ reference, e.g., 10.48550/arXiv.2405.12345 or the DOI of the published version of a preprint"`
+	SemanticScholarID string `json:"semanticScholarId,omitempty" jsonschema:"A Semantic Scholar paper identifier, i.e., the 40-character hexadecimal paper ID or CorpusId:<n>"`
+	Citation          string `json:"citation,omitempty" jsonschema:"A free-form citation, e.g., a reference list entry with authors, title, venue and year"`
+}
+
+// ResolutionStep reports one step of the resolution path
+type ResolutionStep struct {
+	Step    string `json:"step" jsonschema:"The step: arxiv_doi, crossref or semantic_scholar"`
+	Outcome string `json:"outcome" jsonschema:"resolved, no_match, skipped when the step is not configured or does not apply, or failed when the service could not be queried"`
+	Detail  string `json:"detail,omitempty" jsonschema:"What the step looked up, or why it was skipped or failed"`
+}
+
+// IdentifierResolution is the arXiv article an identifier was resolved to and how
+type IdentifierResolution struct {
+	ArticleID  string           `json:"articleId" jsonschema:"The canonical arXiv identifier of the article"`
+	Confidence string           `json:"confidence" jsonschema:"exact when the arXiv identifier is part of the input, high when a service links the identifier to arXiv, medium when a citation was matched by a search"`
+	ResolvedBy string           `json:"resolvedBy" jsonschema:"The step that resolved the identifier"`
+	Path       []ResolutionStep `json:"path" jsonschema:"The steps tried, in order"`
+}
+
+// identifiersResolveIssues requires at least one identifier to resolve
+func identifiersResolveIssues(args IdentifiersResolveArgs) []ValidationIssue {
+	if strings.TrimSpace(args.DOI) == "" && strings.TrimSpace(args.SemanticScholarID) == "" && strings.TrimSpace(args.Citation) == "" {
+		return []ValidationIssue{{
+			Fields:  []string{"doi", "semanticScholarId", "citation"},
+			Message: "one of doi, semanticScholarId or citation is required",
+		}}
+	}
+	return nil
+}
+
+var (
+	// citationArxivRegex finds an arXiv identifier mentioned in a citation, after arXiv:, an abs or
+	// pdf URL or the arXiv DOI prefix
+	citationArxivRegex = regexp.MustCompile(`(?i)(?:arxiv:\s*|arxiv\.org/(?:abs|pdf)/|10\.48550/arxiv\.)(\d{4}\.\d{4,5}(?:v\d+)?|[a-z]+(?:-[a-z]+)?(?:\.[a-z]{2})?/\d{7}(?:v\d+)?)`)
+	// citationDOIRegex finds a DOI mentioned in a citation
+	citationDOIRegex = regexp.MustCompile(`10\.\d{4,9}/[^\s"<>]+`)
+)
+
+// citationDOI returns the DOI a citation mentions, without the punctuation that ends its sentence
+func citationDOI(citation string) string {
+	return strings.TrimRight(citationDOIRegex.FindString(citation), ".,;)]")
+}
+
+// bareDOI strips the doi: or resolver URL prefix of a DOI reference
+func bareDOI(doi string) string {
+	doi = strings.TrimSpace(doi)
+	lower := strings.ToLower(doi)
+	for _, prefix := range []string{"https://doi.org/", "http://doi.org/", "https://dx.doi.org/", "http://dx.doi.org/", "doi.org/", "doi:"} {
+		if strings.HasPrefix(lower, prefix) {
+			return strings.TrimSpace(doi[len(prefix):])
+		}
+	}
+	return doi
+}
+
+// identifiersResolve handles resolving a DOI, Semantic Scholar ID or citation to an arXiv article by
+// trying, in order, the arXiv DOI pattern, the relations of the Crossref record and the external
+// identifiers of the Semantic Scholar record
+func identifiersResolve(ctx context.Context, input json.RawMessage) (any, error) {
+	var args IdentifiersResolveArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+	doi := bareDOI(args.DOI)
+	citation := strings.TrimSpace(args.Citation)
+	s2ID := strings.TrimSpace(args.SemanticScholarID)
+	if doi == "" {
+		doi = citationDOI(citation)
+	}
+
+	var path []ResolutionStep
+	resolved := func(step string, id arxivid.ID, confidence, detail string) *IdentifierResolution {
+		path = append(path, ResolutionStep{Step: step, Outcome: resolveOutcomeResolved, Detail: detail})
+		return &IdentifierResolution{ArticleID: id.Canonical(), Confidence: confidence, ResolvedBy: step, Path: path}
+	}
+
+	// The arXiv DOI pattern resolves without any request, from the DOI or an identifier in the citation
+	if id, err := arxivid.Parse(doi); doi != "" && err == nil {
+		return resolved(resolveStepArxivDOI, id, confidenceExact, "DOI "+doi), nil
+	}
+	if m := citationArxivRegex.FindStringSubmatch(citation); m != nil {
+		if id, err := arxivid.Parse(m[1]); err == nil {
+			return resolved(resolveStepArxivDOI, id, confidenceExact, "citation mentions "+m[0]), nil
+		}
+	}
+	path = append(path, ResolutionStep{Step: resolveStepArxivDOI, Outcome: resolveOutcomeNoMatch, Detail: "no arXiv DOI or identifier in the input"})
+
+	failed := false
+	steps := []struct {
+		name string
+		run  func(context.Context, string, string, string) (arxivid.ID, string, string, error)
+	}{
+		{resolveStepCrossref, resolveViaCrossref},
+		{resolveStepSemanticScholar, resolveViaSemanticScholar},
+	}
+	for _, step := range steps {
+		id, confidence, detail, err := step.run(ctx, doi, s2ID, citation)
+		switch {
+		case errors.Is(err, errResolveSkipped):
+			path = append(path, ResolutionStep{Step: step.name, Outcome: resolveOutcomeSkipped, Detail: detail})
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			slog.Warn("Identifier resolution step failed", "step", step.name, "error", err)
+			failed = true
+			path = append(path, ResolutionStep{Step: step.name, Outcome: resolveOutcomeFailed, Detail: err.Error()})
+		case confidence == "":
+			path = append(path, ResolutionStep{Step: step.name, Outcome: resolveOutcomeNoMatch, Detail: detail})
+		default:
+			return resolved(step.name, id, confidence, detail), nil
+		}
+	}
+
+	return nil, &ToolError{
+		Code:    ErrCodeIdentifierNotFound,
+		Message: "no arXiv article found for the identifiers given",
+		// A failed lookup may succeed later; a miss of every service will not
+		Retryable: failed,
+		Details: map[string]any{
+			"doi":               args.DOI,
+			"semanticScholarId": args.SemanticScholarID,
+			"citation":          args.Citation,
+			"path":              path,
+		},
+	}
+}
+
+// errResolveSkipped means a resolution step is not configured or does not apply to the input
+var errResolveSkipped = errors.New("resolution step skipped")
+
+// crossrefWork is the part of a Crossref work record naming its arXiv relations
+type crossrefWork struct {
+	DOI      string `json:"DOI"`
+	Relation map[string][]struct {
+		IDType string `json:"id-type"`
+		ID     string `json:"id"`
+	} `json:"relation"`
+}
+
+// arxivRelation returns the arXiv article a Crossref work is related to, e.g., as its preprint, or
+// the work itself when it is registered under the arXiv DOI prefix
+func (w *crossrefWork) arxivRelation() (arxivid.ID, string, bool) {
+	if id, err := arxivid.Parse(w.DOI); err == nil {
+		return id, "DOI", true
+	}
+	// Preprints are linked by has-preprint; other relations, e.g., is-version-of, are checked after
+	for _, name := range []string{"has-preprint", "is-preprint-of", "is-version-of", "is-identical-to"} {
+		for _, related := range w.Relation[name] {
+			if related.IDType != "arxiv" && related.IDType != "doi" {
+				continue
+			}
+			if id, err := arxivid.Parse(related.ID); err == nil {
+				return id, name, true
+			}
+		}
+	}
+	return arxivid.ID{}, "", false
+}
+
+// resolveViaCrossref looks up the Crossref record of the DOI, or searches Crossref for the citation,
+// and returns the arXiv article the record is related to
+func resolveViaCrossref(ctx context.Context, doi, _, citation string) (arxivid.ID, string, string, error) {
+	if identifierConfig.CrossrefMailto == "" {
+		return arxivid.ID{}, "", "OPUS_MCP_CROSSREF_MAILTO is not set", errResolveSkipped
+	}
+	query := url.Values{"mailto": {identifierConfig.CrossrefMailto}}
+	var requestURL, detail, confidence string
+	switch {
+	case doi != "":
+		requestURL = crossrefEndpoint + "/works/" + url.PathEscape(doi) + "?" + query.Encode()
+		detail, confidence = "Crossref record of DOI "+doi, confidenceHigh
+	case citation != "":
+		query.Set("query.bibliographic", citation)
+		query.Set("rows", "1")
+		requestURL = crossrefEndpoint + "/works?" + query.Encode()
+		detail, confidence = "Crossref search for the citation", confidenceMedium
+	default:
+		return arxivid.ID{}, "", "Crossref looks up DOIs and citations only", errResolveSkipped
+	}
+
+	var envelope struct {
+		Message json.RawMessage `json:"message"`
+	}
+	found, err := getResolverJSON(ctx, crossrefLimiter, requestURL, nil, &envelope)
+	if err != nil || !found {
+		return arxivid.ID{}, "", detail + ": not found", err
+	}
+	var work crossrefWork
+	if doi != "" {
+		err = json.Unmarshal(envelope.Message, &work)
+	} else {
+		var results struct {
+			Items []crossrefWork `json:"items"`
+		}
+		err = json.Unmarshal(envelope.Message, &results)
+		if len(results.Items) > 0 {
+			work = results.Items[0]
+		}
+	}
+	if err != nil {
+		return arxivid.ID{}, "", detail, fmt.Errorf("failed to parse Crossref response: %w", err)
+	}
+	id, relation, ok := work.arxivRelation()
+	if !ok {
+		return arxivid.ID{}, "", detail + ": no arXiv relation", nil
+	}
+	if work.DOI != "" && !strings.EqualFold(work.DOI, doi) {
+		detail += " (" + work.DOI + ")"
+	}
+	return id, confidence, detail + ": " + relation, nil
+}
+
+// semanticScholarPaper is the part of a Semantic Scholar paper record naming its external identifiers
+type semanticScholarPaper struct {
+	PaperID     string         `json:"paperId"`
+	ExternalIDs map[string]any `json:"externalIds"`
+}
+
+// arxivID returns the arXiv identifier among the external identifiers of a paper
+func (p *semanticScholarPaper) arxivID() (arxivid.ID, bool) {
+	value, ok := p.ExternalIDs["ArXiv"].(string)
+	if !ok {
+		return arxivid.ID{}, false
+	}
+	id, err := arxivid.Parse(value)
+	return id, err == nil
+}
+
+// resolveViaSemanticScholar looks up the Semantic Scholar record of the paper ID or DOI, or matches
+// the citation by title, and returns the arXiv identifier among its external identifiers
+func resolveViaSemanticScholar(ctx context.Context, doi, s2ID, citation string) (arxivid.ID, string, string, error) {
+	if !identifierConfig.SemanticScholarEnabled {
+		return arxivid.ID{}, "", "OPUS_MCP_SEMANTIC_SCHOLAR_ENABLED is not set", errResolveSkipped
+	}
+	query := url.Values{"fields": {"externalIds"}}
+	var requestURL, detail, confidence string
+	switch {
+	case s2ID != "":
+		requestURL = semanticScholarEndpoint + "/paper/" + url.PathEscape(s2ID) + "?" + query.Encode()
+		detail, confidence = "Semantic Scholar paper "+s2ID, confidenceHigh
+	case doi != "":
+		requestURL = semanticScholarEndpoint + "/paper/" + url.PathEscape("DOI:"+doi) + "?" + query.Encode()
+		detail, confidence = "Semantic Scholar record of DOI "+doi, confidenceHigh
+	case citation != "":
+		query.Set("query", citation)
+		requestURL = semanticScholarEndpoint + "/paper/search/match?" + query.Encode()
+		detail, confidence = "Semantic Scholar match for the citation", confidenceMedium
+	default:
+		return arxivid.ID{}, "", "Semantic Scholar looks up paper IDs, DOIs and citations only", errResolveSkipped
+	}
+
+	var header http.Header
+	if identifierConfig.SemanticScholarAPIKey != "" {
+		header = http.Header{"X-Api-Key": {identifierConfig.SemanticScholarAPIKey}}
+	}
+	var paper semanticScholarPaper
+	var found bool
+	var err error
+	if s2ID == "" && doi == "" {
+		var matches struct {
+			Data []semanticScholarPaper `json:"data"`
+		}
+		found, err = getResolverJSON(ctx, semanticScholarLimiter, requestURL, header, &matches)
+		if len(matches.Data) > 0 {
+			paper = matches.Data[0]
+		}
+	} else {
+		found, err = getResolverJSON(ctx, semanticScholarLimiter, requestURL, header, &paper)
+	}
+	if err != nil || !found {
+		return arxivid.ID{}, "", detail + ": not found", err
+	}
+	id, ok := paper.arxivID()
+	if !ok {
+		return arxivid.ID{}, "", detail + ": no arXiv identifier", nil
+	}
+	return id, confidence, detail + ": externalIds.ArXiv", nil
+}
+
+// getResolverJSON queries an identifier resolution service within its rate limit and decodes its
+// JSON response into v. It reports false without an error when the service does not know the
+// identifier.
+func getResolverJSON(ctx context.Context, limiter *rate.Limiter, requestURL string, header http.Header, v any) (bool, error) {
+	if err := limiter.Wait(ctx); err != nil {
+		return false, fmt.Errorf("rate limiter error: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	slog.Debug("Resolving identifier", "host", req.URL.Host, "path", req.URL.Path)
+	resp, err := toolDeps.HTTPClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to query %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s returned HTTP %d", req.URL.Host, resp.StatusCode)
+	}
+	body, err := internal.ReadAll(ctx, resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return false, fmt.Errorf("failed to parse response of %s: %w", req.URL.Host, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// fakeResolvers serves recorded Crossref and Semantic Scholar responses: each request path is
+// answered with the fixture in testdata it maps to, or 404 Not Found. It returns the requests made.
+func fakeResolvers(t *testing.T, config IdentifierConfig, fixtures map[string]string) func() []*http.Request {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+		fixture, ok := fixtures[r.URL.Path]
+		if !ok {
+			http.Error(w, `{"error":"Not found"}`, http.StatusNotFound)
+			return
+		}
+		if strings.HasPrefix(fixture, "HTTP ") {
+			http.Error(w, fixture, http.StatusServiceUnavailable)
+			return
+		}
+		body, err := os.ReadFile("testdata/" + fixture)
+		if err != nil {
+			t.Errorf("failed to read fixture: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}))
+	originalConfig, originalCrossref, originalS2 := identifierConfig, crossrefEndpoint, semanticScholarEndpoint
+	originalCrossrefLimiter, originalS2Limiter := crossrefLimiter, semanticScholarLimiter
+	identifierConfig = config
+	crossrefEndpoint, semanticScholarEndpoint = srv.URL+"/crossref", srv.URL+"/s2"
+	crossrefLimiter, semanticScholarLimiter = rate.NewLimiter(rate.Inf, 1), rate.NewLimiter(rate.Inf, 1)
+	t.Cleanup(func() {
+		srv.Close()
+		identifierConfig, crossrefEndpoint, semanticScholarEndpoint = originalConfig, originalCrossref, originalS2
+		crossrefLimiter, semanticScholarLimiter = originalCrossrefLimiter, originalS2Limiter
+	})
+	return func() []*http.Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+// bothResolvers enables the Crossref and Semantic Scholar lookups
+var bothResolvers = IdentifierConfig{CrossrefMailto: "library@example.org", SemanticScholarEnabled: true, SemanticScholarAPIKey: "s2-key"}
+
+// outcomes lists the step:outcome pairs of a resolution path
+func outcomes(path []ResolutionStep) string {
+	var pairs []string
+	for _, step := range path {
+		pairs = append(pairs, step.Step+":"+step.Outcome)
+	}
+	return strings.Join(pairs, " ")
+}
+
+func TestIdentifiersResolvePaths(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         IdentifierConfig
+		fixtures       map[string]string
+		args           string
+		wantID         string
+		wantConfidence string
+		wantPath       string
+		wantRequests   []string
+	}{
+		{
+			name:           "arXiv DOI",
+			config:         bothResolvers,
+			args:           `{"doi": "https://doi.org/10.48550/arXiv.1706.03762"}`,
+			wantID:         "1706.03762",
+			wantConfidence: confidenceExact,
+			wantPath:       "arxiv_doi:resolved",
+		},
+		{
+			name:           "arXiv identifier in a citation",
+			config:         bothResolvers,
+			args:           `{"citation": "A. Vaswani et al. Attention is all you need. arXiv: 1706.03762v5, 2017."}`,
+			wantID:         "1706.03762v5",
+			wantConfidence: confidenceExact,
+			wantPath:       "arxiv_doi:resolved",
+		},
+		{
+			name:           "Crossref preprint relation",
+			config:         bothResolvers,
+			fixtures:       map[string]string{"/crossref/works/10.1038/s41586-021-03819-2": "crossref_work_has_preprint.json"},
+			args:           `{"doi": "doi:10.1038/s41586-021-03819-2"}`,
+			wantID:         "2107.09564",
+			wantConfidence: confidenceHigh,
+			wantPath:       "arxiv_doi:no_match crossref:resolved",
+			wantRequests:   []string{"/crossref/works/10.1038/s41586-021-03819-2"},
+		},
+		{
+			name:           "Crossref citation search",
+			config:         bothResolvers,
+			fixtures:       map[string]string{"/crossref/works": "crossref_search_citation.json"},
+			args:           `{"citation": "He, Zhang, Ren and Sun. Deep residual learning for image recognition. CVPR 2016."}`,
+			wantID:         "1512.03385",
+			wantConfidence: confidenceMedium,
+			wantPath:       "arxiv_doi:no_match crossref:resolved",
+			wantRequests:   []string{"/crossref/works"},
+		},
+		{
+			name:           "Semantic Scholar paper ID",
+			config:         bothResolvers,
+			fixtures:       map[string]string{"/s2/paper/204e3073870fae3d05bcbc2f6a8e263d9b72e776": "semantic_scholar_paper.json"},
+			args:           `{"semanticScholarId": "204e3073870fae3d05bcbc2f6a8e263d9b72e776"}`,
+			wantID:         "1706.03762",
+			wantConfidence: confidenceHigh,
+			wantPath:       "arxiv_doi:no_match crossref:skipped semantic_scholar:resolved",
+			wantRequests:   []string{"/s2/paper/204e3073870fae3d05bcbc2f6a8e263d9b72e776"},
+		},
+		{
+			name:   "Semantic Scholar DOI after a Crossref record without relation",
+			config: bothResolvers,
+			fixtures: map[string]string{
+				"/crossref/works/10.1145/3292500.3330701": "crossref_work_without_relation.json",
+				"/s2/paper/DOI:10.1145/3292500.3330701":   "semantic_scholar_paper.json",
+			},
+			args:           `{"doi": "10.1145/3292500.3330701"}`,
+			wantID:         "1706.03762",
+			wantConfidence: confidenceHigh,
+			wantPath:       "arxiv_doi:no_match crossref:no_match semantic_scholar:resolved",
+			wantRequests:   []string{"/crossref/works/10.1145/3292500.3330701", "/s2/paper/DOI:10.1145/3292500.3330701"},
+		},
+		{
+			name:           "Semantic Scholar citation match without Crossref",
+			config:         IdentifierConfig{SemanticScholarEnabled: true, SemanticScholarAPIKey: "s2-key"},
+			fixtures:       map[string]string{"/s2/paper/search/match": "semantic_scholar_match.json"},
+			args:           `{"citation": "Vaswani et al. Attention is all you need. NeurIPS 2017."}`,
+			wantID:         "1706.03762",
+			wantConfidence: confidenceMedium,
+			wantPath:       "arxiv_doi:no_match crossref:skipped semantic_scholar:resolved",
+			wantRequests:   []string{"/s2/paper/search/match"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := fakeResolvers(t, tt.config, tt.fixtures)
+			result, err := identifiersResolve(context.Background(), json.RawMessage(tt.args))
+			if err != nil {
+				t.Fatalf("identifiersResolve() unexpected error: %v", err)
+			}
+			resolution := result.(*IdentifierResolution)
+			if resolution.ArticleID != tt.wantID || resolution.Confidence != tt.wantConfidence {
+				t.Errorf("resolution = %s with %s confidence, want %s with %s confidence", resolution.ArticleID, resolution.Confidence, tt.wantID, tt.wantConfidence)
+			}
+			if got := outcomes(resolution.Path); got != tt.wantPath {
+				t.Errorf("path = %s, want %s", got, tt.wantPath)
+			}
+			made := requests()
+			if len(made) != len(tt.wantRequests) {
+				t.Fatalf("made %d requests, want %v", len(made), tt.wantRequests)
+			}
+			for i, r := range made {
+				if r.URL.Path != tt.wantRequests[i] {
+					t.Errorf("request %d = %s, want %s", i, r.URL.Path, tt.wantRequests[i])
+				}
+				if strings.HasPrefix(r.URL.Path, "/crossref/") && r.URL.Query().Get("mailto") != "library@example.org" {
+					t.Errorf("Crossref request %s without the configured mailto", r.URL)
+				}
+				if strings.HasPrefix(r.URL.Path, "/s2/") && r.Header.Get("X-Api-Key") != "s2-key" {
+					t.Errorf("Semantic Scholar request %s without the configured API key", r.URL)
+				}
+			}
+		})
+	}
+}
+
+func TestIdentifiersResolveNotFound(t *testing.T) {
+	resolve := func(args string) *ToolError {
+		t.Helper()
+		_, err := identifiersResolve(context.Background(), json.RawMessage(args))
+		var toolErr *ToolError
+		if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeIdentifierNotFound {
+			t.Fatalf("identifiersResolve() error = %v, want %s", err, ErrCodeIdentifierNotFound)
+		}
+		return toolErr
+	}
+
+	t.Run("every service misses", func(t *testing.T) {
+		requests := fakeResolvers(t, bothResolvers, nil)
+		toolErr := resolve(`{"doi": "10.1000/unknown"}`)
+		if got := outcomes(toolErr.Details["path"].([]ResolutionStep)); got != "arxiv_doi:no_match crossref:no_match semantic_scholar:no_match" {
+			t.Errorf("path = %s, want every step to miss", got)
+		}
+		if toolErr.Retryable {
+			t.Error("a miss of every service is retryable, want not")
+		}
+		if len(requests()) != 2 {
+			t.Errorf("made %d requests, want one to each service", len(requests()))
+		}
+	})
+
+	t.Run("services not configured", func(t *testing.T) {
+		requests := fakeResolvers(t, IdentifierConfig{}, nil)
+		toolErr := resolve(`{"semanticScholarId": "204e3073870fae3d05bcbc2f6a8e263d9b72e776"}`)
+		if got := outcomes(toolErr.Details["path"].([]ResolutionStep)); got != "arxiv_doi:no_match crossref:skipped semantic_scholar:skipped" {
+			t.Errorf("path = %s, want the services skipped", got)
+		}
+		if len(requests()) != 0 {
+			t.Errorf("made %d requests to services that are not configured", len(requests()))
+		}
+	})
+
+	t.Run("a service fails", func(t *testing.T) {
+		fakeResolvers(t, bothResolvers, map[string]string{"/s2/paper/search/match": "HTTP 503"})
+		toolErr := resolve(`{"citation": "An unpublished manuscript"}`)
+		if got := outcomes(toolErr.Details["path"].([]ResolutionStep)); got != "arxiv_doi:no_match crossref:no_match semantic_scholar:failed" {
+			t.Errorf("path = %s, want Semantic Scholar to fail", got)
+		}
+		if !toolErr.Retryable {
+			t.Error("a failed lookup is not retryable, want it retryable")
+		}
+	})
+}
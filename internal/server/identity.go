@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"opus-mcp/internal/settings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	// clientIdentityHeader carries the client identity from the HTTP middleware to the MCP
+	// middleware and tool handlers, which only see the request headers. Incoming values are dropped.
+	clientIdentityHeader = "X-Opus-Mcp-Client-Id"
+	// clientFingerprintLength is the number of hex characters of a token fingerprint
+	clientFingerprintLength = 16
+)
+
+// ClientIdentityConfig holds the client identification configuration loaded from environment variables
+type ClientIdentityConfig struct {
+	// ClientTokens are the bearer tokens of known clients. Only these, and the admin token, identify
+	// their client; any other bearer token is not trusted and its request is labelled by address.
+	ClientTokens []string `env:"OPUS_MCP_CLIENT_TOKENS" secret:"true"`
+	// FingerprintKey is the HMAC key for bearer token fingerprints. Without it, a random key is
+	// generated at startup and fingerprints change when the server restarts.
+	FingerprintKey string `env:"OPUS_MCP_CLIENT_FINGERPRINT_KEY" secret:"true"`
+	// TrustedProxies are the addresses or CIDR ranges of reverse proxies whose X-Forwarded-For
+	// header is trusted to name the client
+	TrustedProxies []string `env:"OPUS_MCP_TRUSTED_PROXIES"`
+}
+
+// LoadClientIdentityConfig loads the client identification configuration from environment variables
+func LoadClientIdentityConfig() (*ClientIdentityConfig, error) {
+	var config ClientIdentityConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process client identity configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// clientIdentifier derives a stable label for the client of an HTTP request: a fingerprint of its
+// bearer token if the token is known, never the token itself, or otherwise its address
+type clientIdentifier struct {
+	key     []byte
+	trusted []*net.IPNet
+	// tokens are the bearer tokens of known clients
+	tokens []string
+}
+
+// newClientIdentifier creates a client identifier from its configuration
+func newClientIdentifier(config *ClientIdentityConfig) (*clientIdentifier, error) {
+	id := &clientIdentifier{key: []byte(config.FingerprintKey)}
+	if len(id.key) == 0 {
+		id.key = make([]byte, 32)
+		if _, err := rand.Read(id.key); err != nil {
+			return nil, fmt.Errorf("failed to generate client fingerprint key: %w", err)
+		}
+		slog.Info("No client fingerprint key configured - token fingerprints will change when the server restarts")
+	}
+	for _, token := range config.ClientTokens {
+		if token = strings.TrimSpace(token); token != "" {
+			id.tokens = append(id.tokens, token)
+		}
+	}
+	for _, proxy := range config.TrustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		id.trusted = append(id.trusted, network)
+	}
+	return id, nil
+}
+
+// identify returns the label of the client of a request: "token:<fingerprint>" for requests with a
+// known bearer token and "ip:<address>" otherwise. An unknown token is ignored rather than
+// fingerprinted, so that clients cannot claim another client's identity, or a fresh one to get
+// fresh turns and quota, by making up tokens.
+func (c *clientIdentifier) identify(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && c.isKnownToken(strings.TrimSpace(token)) {
+		return "token:" + c.fingerprint(strings.TrimSpace(token))
+	}
+	return "ip:" + c.clientIP(r)
+}
+
+// isKnownToken reports whether a bearer token is one of the configured client tokens or the admin
+// token, comparing in constant time
+func (c *clientIdentifier) isKnownToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	known := false
+	for _, candidate := range append([]string{adminToken}, c.tokens...) {
+		if candidate != "" && subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			known = true
+		}
+	}
+	return known
+}
+
+// fingerprint returns a short HMAC of a token, which identifies the token without revealing it
+func (c *clientIdentifier) fingerprint(token string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))[:clientFingerprintLength]
+}
+
+// clientIP returns the address of the client. When the request comes from a trusted proxy, the
+// X-Forwarded-For header is walked from the right to the first address that is not a trusted proxy.
+func (c *clientIdentifier) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !c.isTrusted(host) {
+		return host
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		host = hop
+		if !c.isTrusted(hop) {
+			break
+		}
+	}
+	return host
+}
+
+func (c *clientIdentifier) isTrusted(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range c.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// middleware labels every request with the identity of its client, in the request context for
+// HTTP handlers and in a request header for the MCP middleware and tool handlers
+func (c *clientIdentifier) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(clientIdentityHeader)
+		label := c.identify(r)
+		r.Header.Set(clientIdentityHeader, label)
+		next.ServeHTTP(w, r.WithContext(withClientIdentity(r.Context(), label)))
+	})
+}
+
+type clientIdentityKey struct{}
+
+// withClientIdentity returns a context carrying the identity of the HTTP client
+func withClientIdentity(ctx context.Context, label string) context.Context {
+	return context.WithValue(ctx, clientIdentityKey{}, label)
+}
+
+// clientIdentityFrom returns the identity of the HTTP client stored in a context, if any
+func clientIdentityFrom(ctx context.Context) string {
+	label, _ := ctx.Value(clientIdentityKey{}).(string)
+	return label
+}
+
+// clientIdentityOf returns the identity of the client of an MCP request received over HTTP, or
+// an empty string, e.g., over stdio
+func clientIdentityOf(req mcp.Request) string {
+	if extra := req.GetExtra(); extra != nil && extra.Header != nil {
+		return extra.Header.Get(clientIdentityHeader)
+	}
+	return ""
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestClientIdentifierTokenFingerprint(t *testing.T) {
+	tokens := []string{"secret-token-a", "secret-token-b"}
+	identifier, err := newClientIdentifier(&ClientIdentityConfig{FingerprintKey: "test-key", ClientTokens: tokens})
+	if err != nil {
+		t.Fatalf("newClientIdentifier() unexpected error: %v", err)
+	}
+	request := func(token, remoteAddr string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("Authorization", "Bearer "+token)
+		return r
+	}
+
+	first := identifier.identify(request("secret-token-a", "192.0.2.1:1234"))
+	again := identifier.identify(request("secret-token-a", "198.51.100.7:4321"))
+	other := identifier.identify(request("secret-token-b", "192.0.2.1:1234"))
+
+	if !strings.HasPrefix(first, "token:") || len(first) != len("token:")+clientFingerprintLength {
+		t.Errorf("identify() = %q, want a token fingerprint", first)
+	}
+	if strings.Contains(first, "secret-token-a") {
+		t.Errorf("identify() = %q reveals the token", first)
+	}
+	if first != again {
+		t.Errorf("same token identified as %q and %q, want the same fingerprint", first, again)
+	}
+	if first == other {
+		t.Errorf("different tokens both identified as %q", first)
+	}
+
+	// Fingerprints depend on the key
+	rekeyed, err := newClientIdentifier(&ClientIdentityConfig{FingerprintKey: "other-key", ClientTokens: tokens})
+	if err != nil {
+		t.Fatalf("newClientIdentifier() unexpected error: %v", err)
+	}
+	if got := rekeyed.identify(request("secret-token-a", "192.0.2.1:1234")); got == first {
+		t.Errorf("fingerprint %q did not change with the key", got)
+	}
+}
+
+// TestClientIdentifierIgnoresUnknownTokens checks that only configured tokens identify a client, so
+// that made-up tokens cannot impersonate a client or claim a fresh identity
+func TestClientIdentifierIgnoresUnknownTokens(t *testing.T) {
+	originalAdminToken := adminToken
+	t.Cleanup(func() { adminToken = originalAdminToken })
+	adminToken = "admin-token"
+	identifier, err := newClientIdentifier(&ClientIdentityConfig{FingerprintKey: "test-key", ClientTokens: []string{"known-token"}})
+	if err != nil {
+		t.Fatalf("newClientIdentifier() unexpected error: %v", err)
+	}
+	tests := []struct {
+		name          string
+		authorization string
+		wantToken     bool
+	}{
+		{"Known token", "Bearer known-token", true},
+		{"Admin token", "Bearer admin-token", true},
+		{"Unknown token", "Bearer made-up-token", false},
+		{"Prefix of a known token", "Bearer known", false},
+		{"Empty token", "Bearer ", false},
+		{"No token", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+			r.RemoteAddr = "203.0.113.5:5555"
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			got := identifier.identify(r)
+			if tt.wantToken && !strings.HasPrefix(got, "token:") {
+				t.Errorf("identify() = %q, want a token fingerprint", got)
+			}
+			if !tt.wantToken && got != "ip:203.0.113.5" {
+				t.Errorf("identify() = %q, want the address ip:203.0.113.5", got)
+			}
+		})
+	}
+}
+
+func TestClientIdentifierAddress(t *testing.T) {
+	identifier, err := newClientIdentifier(&ClientIdentityConfig{FingerprintKey: "test-key", TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1"}})
+	if err != nil {
+		t.Fatalf("newClientIdentifier() unexpected error: %v", err)
+	}
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		wantIdentity string
+	}{
+		{"Direct client", "203.0.113.5:5555", "", "ip:203.0.113.5"},
+		{"Untrusted peer cannot forward", "203.0.113.5:5555", "198.51.100.1", "ip:203.0.113.5"},
+		{"Trusted proxy", "192.0.2.1:5555", "198.51.100.1", "ip:198.51.100.1"},
+		{"Chain of trusted proxies", "10.1.1.1:5555", "198.51.100.1, 10.2.2.2", "ip:198.51.100.1"},
+		{"Spoofed hop left of the client", "10.1.1.1:5555", "1.2.3.4, 198.51.100.1", "ip:198.51.100.1"},
+		{"Malformed hop", "10.1.1.1:5555", "unknown", "ip:10.1.1.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			if got := identifier.identify(r); got != tt.wantIdentity {
+				t.Errorf("identify() = %q, want %q", got, tt.wantIdentity)
+			}
+		})
+	}
+
+	if _, err := newClientIdentifier(&ClientIdentityConfig{TrustedProxies: []string{"not-an-address"}}); err == nil {
+		t.Error("newClientIdentifier() with an invalid trusted proxy should fail")
+	}
+}
+
+func TestClientIdentifierMiddleware(t *testing.T) {
+	identifier, err := newClientIdentifier(&ClientIdentityConfig{FingerprintKey: "test-key"})
+	if err != nil {
+		t.Fatalf("newClientIdentifier() unexpected error: %v", err)
+	}
+	var fromContext, fromHeader, fromMCPRequest string
+	handler := identifier.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fromContext = clientIdentityFrom(r.Context())
+		fromHeader = r.Header.Get(clientIdentityHeader)
+		fromMCPRequest = clientIdentityOf(&mcp.CallToolRequest{Extra: &mcp.RequestExtra{Header: r.Header}})
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	r.RemoteAddr = "203.0.113.5:5555"
+	r.Header.Set(clientIdentityHeader, "token:spoofed")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	for name, got := range map[string]string{"context": fromContext, "header": fromHeader, "MCP request": fromMCPRequest} {
+		if got != "ip:203.0.113.5" {
+			t.Errorf("identity in the %s = %q, want ip:203.0.113.5", name, got)
+		}
+	}
+
+	if got := clientIdentityOf(&mcp.CallToolRequest{}); got != "" {
+		t.Errorf("clientIdentityOf() without HTTP headers = %q, want empty", got)
+	}
+	if got := clientIdentityFrom(context.Background()); got != "" {
+		t.Errorf("clientIdentityFrom() without identity = %q, want empty", got)
+	}
+}
@@ -0,0 +1,358 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"opus-mcp/internal"
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/metrics"
+	"opus-mcp/internal/settings"
+)
+
+// maxFetchByIDCount caps the number of identifiers a single fetch by ID may ask for
+const maxFetchByIDCount = 200
+
+// Resolution statuses of a requested identifier
+const (
+	// IDStatusFound means arXiv returned an entry for the identifier
+	IDStatusFound = "found"
+	// IDStatusNotFound means the identifier was queried but arXiv returned no entry for it
+	IDStatusNotFound = "not_found"
+	// IDStatusInvalid means the identifier could not be parsed and was not queried
+	IDStatusInvalid = "invalid"
+	// IDStatusFailed means the batch containing the identifier could not be fetched
+	IDStatusFailed = "failed"
+	// IDStatusNotFetched means the fetch was cancelled before the identifier's batch was queried
+	IDStatusNotFetched = "not_fetched"
+)
+
+// IDListConfig holds the arXiv id_list batching configuration loaded from environment variables
+type IDListConfig struct {
+	// BatchSize is the number of identifiers sent in a single id_list request; arXiv truncates
+	// or rejects very long id_list values
+	BatchSize int `env:"OPUS_MCP_ARXIV_ID_LIST_BATCH_SIZE,default=20"`
+}
+
+// Validate checks that batches hold at least one identifier
+func (c *IDListConfig) Validate() error {
+	if c.BatchSize < 1 {
+		return fmt.Errorf("OPUS_MCP_ARXIV_ID_LIST_BATCH_SIZE must be at least 1, got %d", c.BatchSize)
+	}
+	return nil
+}
+
+// LoadIDListConfig loads the arXiv id_list batching configuration from environment variables
+func LoadIDListConfig() (*IDListConfig, error) {
+	var config IDListConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process id_list configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+var (
+	// idListBatchSize is the number of identifiers sent in a single id_list request
+	idListBatchSize = 20
+	// arxivQueryEndpoint is the arXiv API endpoint queried by identifier, by category and by field; replaced in tests
+	arxivQueryEndpoint = arxivApiEndpoint
+)
+
+// ArxivFetchByIDArgs defines the input parameters for fetching articles by identifier
+type ArxivFetchByIDArgs struct {
+	IDs             []string `json:"ids" jsonschema:"The arXiv identifiers to fetch, e.g., 2405.12345, 2405.12345v2 or hep-th/9901001. Citations, abs/pdf URLs and DataCite DOIs are also accepted"`
+	IncludeRawEntry bool     `json:"includeRawEntry,omitempty" jsonschema:"Return the XML of every entry exactly as arXiv sent it in rawXml, for archiving the upstream record. Defaults to false"`
+	RecordToLibrary bool     `json:"recordToLibrary,omitempty" jsonschema:"Also record the metadata of every returned article in the library index as a metadata-only entry, without downloading its PDF, for later triage; a later download of the article replaces the entry. Repeating a fetch records nothing new. Defaults to false"`
+	EstimateOnly    bool     `json:"estimateOnly,omitempty" jsonschema:"Only plan the fetch and return what it would cost in estimate: the id_list requests, their expected duration under the current rate limit and the identifiers that would be skipped, without querying arXiv or recording anything. Defaults to false"`
+}
+
+// IDResolution is the outcome of fetching a single requested identifier
+type IDResolution struct {
+	ID        string `json:"id" jsonschema:"The identifier as requested"`
+	ArticleID string `json:"articleId,omitempty" jsonschema:"The canonical arXiv identifier of the returned entry"`
+	Status    string `json:"status" jsonschema:"One of found, not_found, invalid, failed or not_fetched"`
+	Error     string `json:"error,omitempty" jsonschema:"Why the identifier is invalid or its batch failed"`
+}
+
+// FetchByIDResult holds the entries returned for a list of identifiers, in the order requested
+type FetchByIDResult struct {
+	Items       []*FeedEntry   `json:"items" jsonschema:"The returned entries, in the order their identifiers were requested"`
+	Resolutions []IDResolution `json:"resolutions" jsonschema:"The outcome for every requested identifier, in the order requested"`
+	Batches     int            `json:"batches" jsonschema:"The number of id_list requests made to arXiv"`
+	Truncated   bool           `json:"truncated,omitempty" jsonschema:"Whether the fetch was cancelled before all batches were queried; items and resolutions cover the batches fetched so far"`
+	Warnings    int            `json:"warnings" jsonschema:"The number of entries that have errors"`
+	// Library is only set when the call asked for recordToLibrary
+	Library *LibraryRecording `json:"library,omitempty" jsonschema:"What was recorded in the library index, when recordToLibrary was set"`
+	// Estimate is only set when the call asked for estimateOnly, which leaves items empty
+	Estimate *CostEstimate `json:"estimate,omitempty" jsonschema:"What the fetch would cost, when estimateOnly was set"`
+}
+
+// fetchByID handles fetching arXiv articles by a list of identifiers
+func fetchByID(ctx context.Context, input json.RawMessage) (any, error) {
+	var args ArxivFetchByIDArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+	if len(args.IDs) == 0 {
+		return nil, fmt.Errorf("at least one identifier is required")
+	}
+	if len(args.IDs) > maxFetchByIDCount {
+		return nil, fmt.Errorf("%d identifiers requested, at most %d are allowed", len(args.IDs), maxFetchByIDCount)
+	}
+	if args.RecordToLibrary && globalLibrary == nil {
+		return nil, errLibraryUnavailable
+	}
+	if args.EstimateOnly {
+		return estimateFetchByID(ctx, args, idListBatchSize)
+	}
+	result, err := fetchIDList(ctx, args.IDs, idListBatchSize, args.IncludeRawEntry)
+	if err != nil {
+		return nil, err
+	}
+	if args.RecordToLibrary {
+		result.Library = recordFetchedMetadata(ctx, result.Items, "", args.IDs)
+	}
+	return result, nil
+}
+
+// fetchIDList fetches the given identifiers from arXiv in id_list batches of at most batchSize,
+// sequentially through the rate limiter, and merges the entries in the order requested. A failed
+// batch only affects its own identifiers. If the context is cancelled between or during batches,
+// the result so far is returned with Truncated set. With includeRaw, every entry carries its XML.
+func fetchIDList(ctx context.Context, ids []string, batchSize int, includeRaw bool) (*FetchByIDResult, error) {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	result := &FetchByIDResult{Items: []*FeedEntry{}}
+	plan := planIDList(ids)
+	result.Resolutions = plan.resolutions
+	queried, requestedBy := plan.queried, plan.requestedBy
+
+	entries := make([]*FeedEntry, len(ids))
+	var failed int
+	var lastErr error
+	for start := 0; start < len(queried); start += batchSize {
+		batch := queried[start:min(start+batchSize, len(queried))]
+		found, err := fetchIDBatch(ctx, batch, includeRaw)
+		if err != nil && ctx.Err() != nil {
+			slog.Warn("Fetch by ID cancelled, returning partial result", "fetched_batches", result.Batches, "remaining_ids", len(queried)-start)
+			result.Truncated = true
+			break
+		}
+		result.Batches++
+		if err != nil {
+			failed++
+			lastErr = err
+			slog.Warn("Failed to fetch id_list batch", "ids", batch, "error", err)
+		}
+		for _, canonical := range batch {
+			entry := found[canonical]
+			for _, i := range requestedBy[canonical] {
+				switch {
+				case err != nil:
+					result.Resolutions[i].Status = IDStatusFailed
+					result.Resolutions[i].Error = err.Error()
+				case entry == nil:
+					result.Resolutions[i].Status = IDStatusNotFound
+				default:
+					result.Resolutions[i].Status = IDStatusFound
+					result.Resolutions[i].ArticleID = entry.ArticleID
+					entries[i] = entry
+				}
+			}
+		}
+	}
+	if failed > 0 && failed == result.Batches {
+		// A refusal, e.g., once the daily quota is used up, is reported as such
+		var toolErr *ToolError
+		if errors.As(lastErr, &toolErr) {
+			return nil, toolErr
+		}
+		return nil, fmt.Errorf("failed to fetch any of the %d id_list batches from arXiv", failed)
+	}
+
+	for _, entry := range entries {
+		if entry == nil {
+			continue
+		}
+		result.Items = append(result.Items, entry)
+		if len(entry.Errors) > 0 {
+			result.Warnings++
+		}
+	}
+	return result, nil
+}
+
+// idListPlan is what a fetch of a list of identifiers would query
+type idListPlan struct {
+	// resolutions are not_fetched for the identifiers to query and invalid for the others
+	resolutions []IDResolution
+	// queried are the distinct canonical identifiers to query, in the order first requested
+	queried []string
+	// requestedBy maps every queried identifier to the indexes of the identifiers naming it
+	requestedBy map[string][]int
+}
+
+// planIDList parses the identifiers, querying each distinct one once
+func planIDList(ids []string) idListPlan {
+	plan := idListPlan{
+		resolutions: make([]IDResolution, len(ids)),
+		requestedBy: make(map[string][]int),
+	}
+	for i, raw := range ids {
+		plan.resolutions[i] = IDResolution{ID: raw, Status: IDStatusNotFetched}
+		id, err := arxivid.Parse(raw)
+		if err != nil {
+			plan.resolutions[i].Status = IDStatusInvalid
+			plan.resolutions[i].Error = err.Error()
+			continue
+		}
+		canonical := id.Canonical()
+		if _, seen := plan.requestedBy[canonical]; !seen {
+			plan.queried = append(plan.queried, canonical)
+		}
+		plan.requestedBy[canonical] = append(plan.requestedBy[canonical], i)
+	}
+	return plan
+}
+
+// batches returns the number of id_list requests of at most batchSize identifiers the plan takes
+func (p idListPlan) batches(batchSize int) int {
+	batchSize = max(batchSize, 1)
+	return (len(p.queried) + batchSize - 1) / batchSize
+}
+
+// estimateFetchByID plans a fetch by ID without querying arXiv: the identifiers that would be
+// skipped and, with recordToLibrary, the articles the library index already stores, which would be
+// fetched but not recorded
+func estimateFetchByID(ctx context.Context, args ArxivFetchByIDArgs, batchSize int) (*FetchByIDResult, error) {
+	plan := planIDList(args.IDs)
+	estimate := arxivCostEstimate("arxiv_fetch_by_id", plan.batches(batchSize))
+	estimate.Items = len(plan.queried)
+	var stored map[string]bool
+	if args.RecordToLibrary {
+		entries, err := globalLibrary.Entries(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read library index: %w", err)
+		}
+		stored = storedArticles(entries)
+	}
+
+	seen := make(map[string]bool, len(plan.queried))
+	recorded := 0
+	for i, resolution := range plan.resolutions {
+		if resolution.Status == IDStatusInvalid {
+			estimate.Skipped = append(estimate.Skipped, SkippedItem{ID: resolution.ID, Reason: SkipInvalid, Detail: resolution.Error})
+			continue
+		}
+		id, _ := arxivid.Parse(args.IDs[i])
+		switch {
+		case seen[id.Canonical()]:
+			estimate.Skipped = append(estimate.Skipped, SkippedItem{ID: resolution.ID, Reason: SkipDuplicate, Detail: "requested as " + args.IDs[plan.requestedBy[id.Canonical()][0]]})
+		case stored[id.Base()]:
+			estimate.Skipped = append(estimate.Skipped, SkippedItem{ID: resolution.ID, Reason: SkipAlreadyStored})
+		case args.RecordToLibrary:
+			recorded++
+		}
+		seen[id.Canonical()] = true
+	}
+	if recorded > 0 {
+		// The metadata-only entries are recorded in a single update of the index
+		estimate.StorageWrites = 1
+	}
+	return &FetchByIDResult{Items: []*FeedEntry{}, Resolutions: plan.resolutions, Estimate: estimate}, nil
+}
+
+// storedArticles returns the unversioned identifiers of the articles the library index stores
+// a downloaded object of
+func storedArticles(entries []library.Entry) map[string]bool {
+	stored := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Status != "" {
+			continue
+		}
+		if id, err := arxivid.Parse(entry.ArticleID); err == nil {
+			stored[id.Base()] = true
+		}
+	}
+	return stored
+}
+
+// fetchIDBatch queries arXiv for a single batch of canonical identifiers and returns the entries
+// keyed by the requested identifier. Entries for unversioned identifiers match any version.
+func fetchIDBatch(ctx context.Context, batch []string, includeRaw bool) (map[string]*FeedEntry, error) {
+	if cooldownErr := arxivCooldown.check(); cooldownErr != nil {
+		return nil, cooldownErr
+	}
+	if err := takeArxivTurn(ctx, arxivRequestAPI); err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("id_list", strings.Join(batch, ","))
+	query.Set("max_results", strconv.Itoa(len(batch)))
+	requestURL := arxivQueryEndpoint + "?" + query.Encode()
+	slog.Info("Fetching Atom feed from arXiv by ID", "url", requestURL, "count", len(batch))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	timer := metrics.StartOperation(metrics.SlowArxivQuery)
+	resp, err := toolDeps.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch from arXiv: %w", err)
+	}
+	defer resp.Body.Close()
+	clockSkew.Observe("arxiv", resp.Header, time.Now())
+	if cooldownErr := arxivCooldown.observe(resp); cooldownErr != nil {
+		return nil, cooldownErr
+	}
+	if err := checkArxivStatus(resp); err != nil {
+		return nil, err
+	}
+	body, err := internal.ReadAll(ctx, resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	timer.Done(int64(len(body)), "url", requestURL)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	feed, err := parseCategoryFeed(body, false)
+	if err != nil {
+		return nil, err
+	}
+	if includeRaw {
+		attachRawEntries(body, feed)
+	}
+
+	wanted := make(map[string]bool, len(batch))
+	for _, id := range batch {
+		wanted[id] = true
+	}
+	found := make(map[string]*FeedEntry, len(batch))
+	for _, entry := range feed.Items {
+		id, err := arxivid.Parse(entry.ArticleID)
+		if err != nil {
+			// arXiv reports malformed identifiers as an entry without an article link
+			continue
+		}
+		for _, key := range []string{id.Canonical(), id.Base()} {
+			if wanted[key] && found[key] == nil {
+				found[key] = entry
+			}
+		}
+	}
+	return found, nil
+}
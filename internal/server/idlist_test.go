@@ -0,0 +1,254 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/library"
+
+	"golang.org/x/time/rate"
+)
+
+// idListFeed builds an arXiv API response for an id_list query, with the entries in reverse order
+// and without the identifiers in missing
+func idListFeed(ids []string, missing ...string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?><feed xmlns="http://www.w3.org/2005/Atom"><title>arXiv Query</title>`)
+	for i := len(ids) - 1; i >= 0; i-- {
+		if slices.Contains(missing, ids[i]) {
+			continue
+		}
+		fmt.Fprintf(&b, `<entry><id>http://arxiv.org/abs/%[1]sv1</id><title>Paper %[1]s</title><published>2024-05-01T00:00:00Z</published><link href="http://arxiv.org/abs/%[1]sv1" rel="alternate" type="text/html"/></entry>`, ids[i])
+	}
+	b.WriteString(`</feed>`)
+	return b.String()
+}
+
+// fakeIDListAPI points id_list queries at a test server running handler, without rate limiting
+func fakeIDListAPI(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	originalEndpoint, originalDeps := arxivQueryEndpoint, toolDeps
+	arxivQueryEndpoint = srv.URL
+	toolDeps = &ToolDeps{HTTPClient: originalDeps.HTTPClient, ArxivLimiter: rate.NewLimiter(rate.Inf, 1)}
+	t.Cleanup(func() {
+		srv.Close()
+		arxivQueryEndpoint, toolDeps = originalEndpoint, originalDeps
+	})
+}
+
+func TestFetchIDListChunksAndPreservesOrder(t *testing.T) {
+	var mu sync.Mutex
+	var requests [][]string
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		ids := strings.Split(r.URL.Query().Get("id_list"), ",")
+		mu.Lock()
+		requests = append(requests, ids)
+		mu.Unlock()
+		_, _ = w.Write([]byte(idListFeed(ids, "2405.00004")))
+	})
+
+	ids := []string{"2405.00005", "2405.00001", "not-an-id", "2405.00004", "arXiv:2405.00003", "2405.00002", "2405.00001"}
+	result, err := fetchIDList(context.Background(), ids, 2, false)
+	if err != nil {
+		t.Fatalf("fetchIDList() unexpected error: %v", err)
+	}
+
+	// Duplicates and invalid identifiers are not queried; the rest are sent in batches of 2
+	wantRequests := [][]string{{"2405.00005", "2405.00001"}, {"2405.00004", "2405.00003"}, {"2405.00002"}}
+	if !slices.EqualFunc(requests, wantRequests, slices.Equal) {
+		t.Errorf("id_list requests = %v, want %v", requests, wantRequests)
+	}
+	if result.Batches != 3 || result.Truncated {
+		t.Errorf("Batches = %d, Truncated = %v, want 3 and false", result.Batches, result.Truncated)
+	}
+
+	wantStatuses := []string{IDStatusFound, IDStatusFound, IDStatusInvalid, IDStatusNotFound, IDStatusFound, IDStatusFound, IDStatusFound}
+	for i, resolution := range result.Resolutions {
+		if resolution.ID != ids[i] || resolution.Status != wantStatuses[i] {
+			t.Errorf("resolution %d = %+v, want ID %q with status %s", i, resolution, ids[i], wantStatuses[i])
+		}
+	}
+	if result.Resolutions[2].Error == "" {
+		t.Error("invalid identifier resolution should explain the error")
+	}
+
+	var got []string
+	for _, entry := range result.Items {
+		got = append(got, entry.ArticleID)
+	}
+	want := []string{"2405.00005v1", "2405.00001v1", "2405.00003v1", "2405.00002v1", "2405.00001v1"}
+	if !slices.Equal(got, want) {
+		t.Errorf("items = %v, want them in the order requested: %v", got, want)
+	}
+}
+
+func TestFetchIDListCancelledReturnsPartialResult(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Cancel while the second batch is being fetched
+	var calls int
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 2 {
+			cancel()
+			<-r.Context().Done()
+			return
+		}
+		_, _ = w.Write([]byte(idListFeed(strings.Split(r.URL.Query().Get("id_list"), ","))))
+	})
+
+	result, err := fetchIDList(ctx, []string{"2405.00001", "2405.00002", "2405.00003"}, 2, false)
+	if err != nil {
+		t.Fatalf("fetchIDList() unexpected error: %v", err)
+	}
+	if !result.Truncated || result.Batches != 1 {
+		t.Errorf("Truncated = %v, Batches = %d, want true and 1", result.Truncated, result.Batches)
+	}
+	if len(result.Items) != 2 {
+		t.Errorf("got %d items, want the 2 from the first batch", len(result.Items))
+	}
+	if got := result.Resolutions[2].Status; got != IDStatusNotFetched {
+		t.Errorf("status of the unfetched identifier = %s, want %s", got, IDStatusNotFetched)
+	}
+}
+
+func TestFetchIDListBatchFailure(t *testing.T) {
+	var calls int
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(idListFeed([]string{r.URL.Query().Get("id_list")})))
+	})
+
+	result, err := fetchIDList(context.Background(), []string{"2405.00001", "2405.00002"}, 1, false)
+	if err != nil {
+		t.Fatalf("fetchIDList() unexpected error: %v", err)
+	}
+	if result.Resolutions[0].Status != IDStatusFailed || !strings.Contains(result.Resolutions[0].Error, "503") {
+		t.Errorf("first resolution = %+v, want a failed batch", result.Resolutions[0])
+	}
+	if result.Resolutions[1].Status != IDStatusFound || len(result.Items) != 1 {
+		t.Errorf("second resolution = %+v with %d items, want it found", result.Resolutions[1], len(result.Items))
+	}
+
+	// Failing every batch fails the call
+	calls = 0
+	if _, err := fetchIDList(context.Background(), []string{"2405.00001"}, 1, false); err == nil {
+		t.Error("fetchIDList() with every batch failing should fail")
+	}
+}
+
+func TestFetchIDBatchStopsReadingOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A slow API that sends the start of the feed and then stalls
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><feed xmlns="http://www.w3.org/2005/Atom">`))
+		w.(http.Flusher).Flush()
+		cancel()
+		<-r.Context().Done()
+	})
+
+	start := time.Now()
+	_, err := fetchIDBatch(ctx, []string{"2405.00001"}, false)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("fetchIDBatch() error = %v, want the cancellation", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("fetchIDBatch() returned after %v, want promptly after the cancellation", elapsed)
+	}
+}
+
+func TestFetchIDListIncludesRawEntries(t *testing.T) {
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(idListFeed(strings.Split(r.URL.Query().Get("id_list"), ","))))
+	})
+
+	result, err := fetchIDList(context.Background(), []string{"2405.00001", "2405.00002"}, 1, true)
+	if err != nil {
+		t.Fatalf("fetchIDList() unexpected error: %v", err)
+	}
+	for _, entry := range result.Items {
+		want := `<entry xmlns="http://www.w3.org/2005/Atom"><id>` + entry.GUID + `</id>`
+		if entry.RawXML == nil || !strings.HasPrefix(*entry.RawXML, want) {
+			t.Errorf("entry %s raw XML = %v, want it to start with %s", entry.ArticleID, entry.RawXML, want)
+		}
+	}
+	if result.Warnings != 0 {
+		t.Errorf("Warnings = %d, want 0", result.Warnings)
+	}
+}
+
+func TestFetchByIDEstimateMatchesOutcome(t *testing.T) {
+	var requests int
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(idListFeed(strings.Split(r.URL.Query().Get("id_list"), ","))))
+	})
+	originalLibrary, originalBatchSize := globalLibrary, idListBatchSize
+	t.Cleanup(func() { globalLibrary, idListBatchSize = originalLibrary, originalBatchSize })
+	store := &library.MemoryStore{}
+	globalLibrary = library.New(store)
+	idListBatchSize = 2
+	ctx := context.Background()
+	if err := globalLibrary.Record(ctx, library.Entry{ObjectName: "arxiv/2405.00002v1.pdf", ArticleID: "2405.00002v1"}); err != nil {
+		t.Fatalf("failed to record fixture entry: %v", err)
+	}
+	args := `"ids": ["2405.00001", "2405.00002", "not-an-id", "arXiv:2405.00001", "2405.00003", "2405.00004", "2405.00005"], "recordToLibrary": true`
+
+	result, err := fetchByID(ctx, json.RawMessage(`{`+args+`, "estimateOnly": true}`))
+	if err != nil {
+		t.Fatalf("fetchByID() estimate unexpected error: %v", err)
+	}
+	estimate := result.(*FetchByIDResult).Estimate
+	if requests != 0 {
+		t.Fatalf("the estimate made %d requests to arXiv, want none", requests)
+	}
+	before, _ := store.Load(ctx)
+
+	result, err = fetchByID(ctx, json.RawMessage(`{`+args+`}`))
+	if err != nil {
+		t.Fatalf("fetchByID() unexpected error: %v", err)
+	}
+	fetched := result.(*FetchByIDResult)
+	if estimate.ArxivRequests != requests || estimate.ArxivRequests != fetched.Batches {
+		t.Errorf("estimated %d arXiv requests, the fetch made %d", estimate.ArxivRequests, requests)
+	}
+	// Duplicates are returned again, but fetched once
+	distinct := map[string]bool{}
+	for _, item := range fetched.Items {
+		distinct[item.ArticleID] = true
+	}
+	if estimate.Items != len(distinct) {
+		t.Errorf("estimated %d items, the fetch returned %d distinct articles", estimate.Items, len(distinct))
+	}
+	if fetched.Library == nil || fetched.Library.Recorded != estimate.Items-1 || estimate.StorageWrites != 1 {
+		t.Errorf("recorded %+v, want the %d articles estimated not to be stored in a single write", fetched.Library, estimate.Items-1)
+	}
+	var skipped []string
+	for _, item := range estimate.Skipped {
+		skipped = append(skipped, item.ID+":"+item.Reason)
+	}
+	if want := []string{"2405.00002:already_stored", "not-an-id:invalid", "arXiv:2405.00001:duplicate"}; !slices.Equal(skipped, want) {
+		t.Errorf("skipped = %v, want %v", skipped, want)
+	}
+	if after, _ := store.Load(ctx); bytes.Equal(before, after) {
+		t.Error("the fetch recorded nothing, want the estimate alone to leave the index unchanged")
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"opus-mcp/internal/metadata"
+	"opus-mcp/internal/settings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// InstructionsConfig holds the configuration of the instructions sent to clients at initialization
+type InstructionsConfig struct {
+	// MaxLength caps the length of the instructions in characters, since clients add them to the
+	// context of every conversation
+	MaxLength int `env:"OPUS_MCP_INSTRUCTIONS_MAX_LENGTH,default=2048"`
+}
+
+// Validate checks that the length cap is positive
+func (c *InstructionsConfig) Validate() error {
+	if c.MaxLength <= 0 {
+		return fmt.Errorf("OPUS_MCP_INSTRUCTIONS_MAX_LENGTH must be positive, got %d", c.MaxLength)
+	}
+	return nil
+}
+
+// LoadInstructionsConfig loads the instructions configuration from environment variables
+func LoadInstructionsConfig() (*InstructionsConfig, error) {
+	var config InstructionsConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process instructions configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// instructionsMaxLength caps the length of the rendered instructions
+var instructionsMaxLength = 2048
+
+// instructionsTemplate describes the intended use of the tools. It lives in code rather than in the
+// documentation so that it is rendered against the tools actually registered and the live
+// configuration: every section naming a tool is conditional on that tool being registered.
+var instructionsTemplate = template.Must(template.New("instructions").Parse(`{{.Title}} searches arXiv and stores articles in S3-compatible storage. Tools available: {{.ToolList}}.
+{{if .Has "arxiv_category_fetch_latest"}}
+arxiv_category_fetch_latest takes a category expression: arXiv category codes (e.g., cs.AI) combined with AND, OR, NOT, + and -, and parentheses. Other words and "quoted phrases" are searched as keywords in keywordField, and field-prefixed tokens such as au:smith are passed through; the output's interpretation shows how each token was read. announcedOn, weekOf or monthOf (at most one) restrict the search to arXiv announcements; weekOf and monthOf return reproducible listings.{{if .Has "arxiv_get_category_taxonomy"}} Look up category codes with arxiv_get_category_taxonomy.{{end}}
+{{end}}{{if .RateLimited}}
+arXiv allows one API request every {{.ArxivInterval}}, shared by all clients of this server. Calls to {{.RateLimited}} are queued, and rejected as busy when the estimated wait exceeds {{.MaxWait}}, so prefer fewer, larger requests{{if .Has "arxiv_fetch_by_id"}} and fetch known identifiers in one arxiv_fetch_by_id call{{end}}.
+{{end}}{{if .Has "arxiv_download_pdf"}}
+arxiv_download_pdf stores PDFs under arxiv/ in the bucket '{{.Bucket}}', which is shared storage seen by every client of this server; check whether an article is already stored before downloading it again.{{if .Has "download_job_status"}} Set async for large downloads and follow them with download_job_status.{{end}}{{if .Has "s3_read_object_chunk"}} Read stored objects with s3_read_object_chunk.{{end}}
+{{end}}{{if .Has "url_download_to_storage"}}
+url_download_to_storage stores other URLs allowed by the download policy under web/ in the same bucket.
+{{end}}{{if .Has "get_tool_examples"}}
+Call get_tool_examples for example arguments and outputs of every tool.
+{{end}}`))
+
+// instructionsData is the live configuration that the instructions template is rendered with
+type instructionsData struct {
+	Title         string
+	tools         []string
+	Bucket        string
+	ArxivInterval time.Duration
+	MaxWait       time.Duration
+}
+
+// Has reports whether a tool is registered
+func (d instructionsData) Has(tool string) bool {
+	return slices.Contains(d.tools, tool)
+}
+
+// ToolList lists the registered tools
+func (d instructionsData) ToolList() string {
+	return strings.Join(d.tools, ", ")
+}
+
+// RateLimited lists the registered tools that wait on the arXiv API rate limit
+func (d instructionsData) RateLimited() string {
+	var limited []string
+	for _, tool := range []string{"arxiv_category_fetch_latest", "arxiv_search", "arxiv_advanced_query", "arxiv_fetch_by_id", "arxiv_get_abs_metadata", "arxiv_get_article"} {
+		if d.Has(tool) {
+			limited = append(limited, tool)
+		}
+	}
+	if len(limited) == 0 {
+		return ""
+	}
+	return joinFields(limited)
+}
+
+// extraBlankLines matches the runs of blank lines left by template sections that were skipped
+var extraBlankLines = regexp.MustCompile(`\n{3,}`)
+
+// renderInstructions renders the instructions for the registered tools, capped at maxLength
+// characters. A cap that falls within a paragraph drops that paragraph and the ones after it.
+func renderInstructions(registered []string, maxLength int) (string, error) {
+	data := instructionsData{
+		Title:         metadata.APP_TITLE,
+		tools:         registered,
+		Bucket:        metadata.S3_ARTICLES_BUCKET,
+		ArxivInterval: arxivInterval(),
+		MaxWait:       arxivAdmission.maxWait,
+	}
+	var b strings.Builder
+	if err := instructionsTemplate.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render instructions: %w", err)
+	}
+	instructions := strings.TrimSpace(extraBlankLines.ReplaceAllString(b.String(), "\n\n"))
+
+	runes := []rune(instructions)
+	if len(runes) <= maxLength {
+		return instructions, nil
+	}
+	truncated := string(runes[:maxLength])
+	if i := strings.LastIndex(truncated, "\n\n"); i > 0 {
+		truncated = truncated[:i]
+	}
+	slog.Warn("Instructions exceed their length cap and were truncated", "length", len(runes), "max_length", maxLength)
+	return strings.TrimSpace(truncated), nil
+}
+
+// instructionsMiddleware sends the given instructions in the result of every initialize request.
+// The instructions of an mcp.Server are fixed when it is created, before its tools are registered,
+// so they are filled in here once the registered tools are known.
+func instructionsMiddleware(instructions string) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			result, err := next(ctx, method, req)
+			if initialized, ok := result.(*mcp.InitializeResult); ok && err == nil {
+				initialized.Instructions = instructions
+			}
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// initializeInstructions registers the tools enabled by the current configuration on a new server,
+// as runServer does, and returns the instructions a client receives when it initializes a session
+func initializeInstructions(t *testing.T, maxLength int) (string, []string) {
+	t.Helper()
+	originalTools := toolRegistrationStatus()
+	t.Cleanup(func() {
+		registeredToolsMu.Lock()
+		registeredTools = originalTools
+		registeredToolsMu.Unlock()
+	})
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test-server", Version: "v0.0.1"}, nil)
+	if err := addMCPTools(server, toolDeps); err != nil {
+		t.Fatalf("addMCPTools() unexpected error: %v", err)
+	}
+	registered := toolRegistrationStatus().Registered
+	instructions, err := renderInstructions(registered, maxLength)
+	if err != nil {
+		t.Fatalf("renderInstructions() unexpected error: %v", err)
+	}
+	server.AddReceivingMiddleware(instructionsMiddleware(instructions))
+
+	ctx := context.Background()
+	clientTransport, serverTransport := mcp.NewInMemoryTransports()
+	serverSession, err := server.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect server: %v", err)
+	}
+	t.Cleanup(func() { serverSession.Close() })
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.2.3"}, nil)
+	clientSession, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect client: %v", err)
+	}
+	t.Cleanup(func() { clientSession.Close() })
+	return clientSession.InitializeResult().Instructions, registered
+}
+
+// allToolNames lists every tool the server can register, whatever its configuration
+func allToolNames() []string {
+	names := []string{"get_tool_examples", "server_schema_info"}
+	for _, factory := range toolFactories() {
+		names = append(names, factory.name)
+	}
+	return names
+}
+
+// TestInstructionsMentionOnlyRegisteredTools checks that the instructions a client receives at
+// initialization name every registered tool and no tool that is not registered
+func TestInstructionsMentionOnlyRegisteredTools(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		register func(t *testing.T)
+	}{
+		{"without storage", func(t *testing.T) {
+			original := globalS3Config
+			t.Cleanup(func() { globalS3Config = original })
+			globalS3Config = nil
+		}},
+		{"with every tool", func(t *testing.T) { registerAllTools(t) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.register(t)
+			instructions, registered := initializeInstructions(t, 1<<16)
+			if instructions == "" {
+				t.Fatal("client received no instructions")
+			}
+			for _, tool := range allToolNames() {
+				mentioned := regexp.MustCompile(`\b` + tool + `\b`).MatchString(instructions)
+				isRegistered := false
+				for _, name := range registered {
+					isRegistered = isRegistered || name == tool
+				}
+				if mentioned != isRegistered {
+					t.Errorf("instructions mention %s: %v, but it is registered: %v\n%s", tool, mentioned, isRegistered, instructions)
+				}
+			}
+			if strings.Contains(instructions, "\n\n\n") {
+				t.Errorf("instructions contain runs of blank lines:\n%s", instructions)
+			}
+		})
+	}
+}
+
+func TestInstructionsDescribeLiveConfiguration(t *testing.T) {
+	registerAllTools(t)
+	instructions, err := renderInstructions(toolRegistrationStatus().Registered, 1<<16)
+	if err != nil {
+		t.Fatalf("renderInstructions() unexpected error: %v", err)
+	}
+	for _, want := range []string{"every 3s", "'opus-mcp-articles'", "shared storage", "quoted phrases"} {
+		if !strings.Contains(instructions, want) {
+			t.Errorf("instructions should mention %q:\n%s", want, instructions)
+		}
+	}
+}
+
+func TestInstructionsLengthCap(t *testing.T) {
+	registerAllTools(t)
+	registered := toolRegistrationStatus().Registered
+	full, err := renderInstructions(registered, 1<<16)
+	if err != nil {
+		t.Fatalf("renderInstructions() unexpected error: %v", err)
+	}
+	for _, maxLength := range []int{len(full) - 1, len(full) / 2, 40} {
+		capped, err := renderInstructions(registered, maxLength)
+		if err != nil {
+			t.Fatalf("renderInstructions() unexpected error: %v", err)
+		}
+		if len([]rune(capped)) > maxLength {
+			t.Errorf("instructions capped at %d characters are %d characters long", maxLength, len([]rune(capped)))
+		}
+		if !strings.HasPrefix(full, capped) {
+			t.Errorf("instructions capped at %d characters are not a prefix of the full instructions", maxLength)
+		}
+	}
+}
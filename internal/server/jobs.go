@@ -0,0 +1,507 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"opus-mcp/internal/canonicaljson"
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/metrics"
+	"opus-mcp/internal/settings"
+	"opus-mcp/internal/storage"
+)
+
+// downloadJobsObjectName is the object in the articles bucket holding the terminal download jobs,
+// so that their outcomes survive a restart
+const downloadJobsObjectName = "jobs/download-jobs.json"
+
+// Statuses of a background download job
+const (
+	// JobStatusQueued means the job is waiting for a free worker
+	JobStatusQueued = "queued"
+	// JobStatusRunning means the transfer is in progress
+	JobStatusRunning = "running"
+	// JobStatusSucceeded means the PDF was stored; the job carries the download result
+	JobStatusSucceeded = "succeeded"
+	// JobStatusFailed means the transfer failed or was interrupted; the job carries the error
+	JobStatusFailed = "failed"
+)
+
+// jobInterruptedMessage is the error of jobs that shutdown gave up waiting for
+const jobInterruptedMessage = "the server shut down before the job completed"
+
+// ErrCodeJobNotFound means the job is unknown, e.g., because its outcome has expired
+const ErrCodeJobNotFound = "JOB_NOT_FOUND"
+
+// DownloadJobConfig holds the background download configuration loaded from environment variables
+type DownloadJobConfig struct {
+	// Workers is the number of transfers that run at the same time
+	Workers int `env:"OPUS_MCP_DOWNLOAD_JOB_WORKERS,default=2"`
+	// QueueSize is the number of jobs that can wait for a worker; further jobs are refused as BUSY
+	QueueSize int `env:"OPUS_MCP_DOWNLOAD_JOB_QUEUE_SIZE,default=16"`
+	// TTL is how long the outcome of a finished job can be queried
+	TTL settings.Duration `env:"OPUS_MCP_DOWNLOAD_JOB_TTL,default=1h"`
+	// DrainTimeout is how long shutdown waits for queued and running jobs before recording them as failed
+	DrainTimeout settings.Duration `env:"OPUS_MCP_DOWNLOAD_JOB_DRAIN_TIMEOUT,default=30s"`
+}
+
+// Validate reports the problems of the background download configuration together
+func (c *DownloadJobConfig) Validate() error {
+	var errs []error
+	if c.Workers < 1 {
+		errs = append(errs, fmt.Errorf("OPUS_MCP_DOWNLOAD_JOB_WORKERS must be at least 1, got %d", c.Workers))
+	}
+	if c.QueueSize < 1 {
+		errs = append(errs, fmt.Errorf("OPUS_MCP_DOWNLOAD_JOB_QUEUE_SIZE must be at least 1, got %d", c.QueueSize))
+	}
+	if c.TTL <= 0 {
+		errs = append(errs, fmt.Errorf("OPUS_MCP_DOWNLOAD_JOB_TTL must be positive, got %s", c.TTL))
+	}
+	return errors.Join(errs...)
+}
+
+// LoadDownloadJobConfig loads the background download configuration from environment variables
+func LoadDownloadJobConfig() (*DownloadJobConfig, error) {
+	var config DownloadJobConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process download job configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// downloadJobs runs asynchronous PDF downloads; nil when S3 storage is not configured
+var downloadJobs *jobQueue
+
+func init() {
+	metrics.NewGaugeFunc("download_jobs_queued", "Number of background download jobs waiting for a worker.", func() float64 {
+		if downloadJobs == nil {
+			return 0
+		}
+		return float64(downloadJobs.status().Queued)
+	})
+	metrics.NewGaugeFunc("download_jobs_running", "Number of background download jobs in progress.", func() float64 {
+		if downloadJobs == nil {
+			return 0
+		}
+		return float64(downloadJobs.status().Running)
+	})
+}
+
+// DownloadJob is the state of a background download, as reported by the job status tool
+type DownloadJob struct {
+	JobID      string                  `json:"jobId" jsonschema:"The identifier of the job"`
+	Status     string                  `json:"status" jsonschema:"One of queued, running, succeeded or failed"`
+	Input      string                  `json:"input" jsonschema:"The article URL or identifier exactly as it was provided"`
+	ArticleID  string                  `json:"articleId" jsonschema:"The canonical arXiv identifier the input was resolved to"`
+	ObjectName string                  `json:"objectName" jsonschema:"The expected name/path of the object in the S3 bucket"`
+	CreatedAt  string                  `json:"createdAt" jsonschema:"RFC 3339 time at which the job was queued"`
+	StartedAt  string                  `json:"startedAt,omitempty" jsonschema:"RFC 3339 time at which the transfer started"`
+	FinishedAt string                  `json:"finishedAt,omitempty" jsonschema:"RFC 3339 time at which the job succeeded or failed"`
+	ExpiresAt  string                  `json:"expiresAt,omitempty" jsonschema:"RFC 3339 time after which the finished job can no longer be queried"`
+	Result     *ArxivDownloadPDFOutput `json:"result,omitempty" jsonschema:"The download result, once the job has succeeded"`
+	Error      string                  `json:"error,omitempty" jsonschema:"Why the job failed"`
+}
+
+// terminal reports whether the job has finished
+func (j *DownloadJob) terminal() bool {
+	return j.Status == JobStatusSucceeded || j.Status == JobStatusFailed
+}
+
+// downloadJob is a queued download together with the transfer it runs
+type downloadJob struct {
+	DownloadJob
+	transfer func(ctx context.Context) (ArxivDownloadPDFOutput, error)
+	// slot is the arXiv rate limiter slot reserved for the job when it was queued
+	slot    *arxivSlot
+	started time.Time
+	expires time.Time
+}
+
+// jobQueue runs downloads on a bounded pool of background workers and keeps their outcomes for a
+// while. Finished jobs are saved to the store, if any, so that a restart does not lose them.
+type jobQueue struct {
+	mu      sync.Mutex
+	jobs    map[string]*downloadJob
+	pending chan *downloadJob
+	closed  bool
+	ttl     time.Duration
+	now     func() time.Time
+	// failures are the times at which jobs failed during the last failureWindow
+	failures []time.Time
+
+	store library.Store
+	// persistMu orders saves, so that an older snapshot never overwrites a newer one
+	persistMu sync.Mutex
+
+	// ctx is cancelled when shutdown gives up waiting, which aborts the running transfers
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+	// workerCount is the number of workers started
+	workerCount int
+}
+
+// newJobQueue creates a job queue without starting its workers
+func newJobQueue(config *DownloadJobConfig, store library.Store) *jobQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &jobQueue{
+		jobs:    make(map[string]*downloadJob),
+		pending: make(chan *downloadJob, config.QueueSize),
+		ttl:     config.TTL.Duration(),
+		now:     time.Now,
+		store:   store,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// startJobQueue creates a job queue, restores the finished jobs saved in the store and starts the workers
+func startJobQueue(ctx context.Context, config *DownloadJobConfig, store library.Store) *jobQueue {
+	q := newJobQueue(config, store)
+	if err := q.restore(ctx); err != nil {
+		slog.Warn("Failed to restore download jobs - outcomes of earlier jobs are lost", "error", err)
+	}
+	q.startWorkers(config.Workers)
+	return q
+}
+
+// startWorkers starts the given number of workers running queued jobs
+func (q *jobQueue) startWorkers(workers int) {
+	q.workerCount += workers
+	for range workers {
+		q.workers.Add(1)
+		go func() {
+			defer q.workers.Done()
+			for job := range q.pending {
+				q.run(job)
+			}
+		}()
+	}
+}
+
+// newJobID returns a random job identifier
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// submit queues a transfer and returns the new job, reserving its arXiv rate limiter slot right
+// away. If every queue slot is taken, or the server is shutting down, the job is refused with a
+// BUSY tool error.
+func (q *jobQueue) submit(job DownloadJob, transfer func(ctx context.Context) (ArxivDownloadPDFOutput, error)) (DownloadJob, error) {
+	id, err := newJobID()
+	if err != nil {
+		return DownloadJob{}, err
+	}
+	job.JobID = id
+	job.Status = JobStatusQueued
+	job.CreatedAt = q.now().UTC().Format(time.RFC3339)
+	queued := &downloadJob{DownloadJob: job, transfer: transfer}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.purgeExpired()
+	if q.closed {
+		return DownloadJob{}, &ToolError{Code: ErrCodeBusy, Message: "the server is shutting down and accepts no new download jobs", Retryable: true}
+	}
+	queued.slot = reserveArxivSlot()
+	select {
+	case q.pending <- queued:
+	default:
+		queued.slot.cancel()
+		return DownloadJob{}, &ToolError{
+			Code:      ErrCodeBusy,
+			Message:   fmt.Sprintf("all %d download job queue slots are taken", cap(q.pending)),
+			Retryable: true,
+			Details:   map[string]any{"queueSize": cap(q.pending)},
+		}
+	}
+	q.jobs[id] = queued
+	return queued.DownloadJob, nil
+}
+
+// get returns the current state of a job, if it is known and has not expired
+func (q *jobQueue) get(id string) (DownloadJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.purgeExpired()
+	job, ok := q.jobs[id]
+	if !ok {
+		return DownloadJob{}, false
+	}
+	return job.DownloadJob, true
+}
+
+// purgeExpired forgets the finished jobs whose outcome has expired; the caller must hold mu
+func (q *jobQueue) purgeExpired() {
+	now := q.now()
+	for id, job := range q.jobs {
+		if job.terminal() && !now.Before(job.expires) {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// run executes a queued job on a worker. The transfer uses the slot reserved for the job; if it
+// fails before sending its request to arXiv, or sends none, the slot is given back.
+func (q *jobQueue) run(job *downloadJob) {
+	defer job.slot.cancel()
+	// Jobs still queued once shutdown has given up are recorded by shutdown, not started
+	if q.ctx.Err() != nil {
+		return
+	}
+	q.mu.Lock()
+	job.Status = JobStatusRunning
+	job.started = q.now()
+	job.StartedAt = job.started.UTC().Format(time.RFC3339)
+	q.mu.Unlock()
+
+	output, err := job.transfer(withArxivSlot(q.ctx, job.slot))
+	switch {
+	case err != nil && q.ctx.Err() != nil:
+		q.finish(job, nil, jobInterruptedMessage)
+	case err != nil:
+		q.finish(job, nil, err.Error())
+	default:
+		q.finish(job, &output, "")
+	}
+	slog.Info("Download job finished", "job_id", job.JobID, "article_id", job.ArticleID, "status", job.Status)
+	q.persist(context.Background())
+}
+
+// finish records the outcome of a job unless it already has one
+func (q *jobQueue) finish(job *downloadJob, result *ArxivDownloadPDFOutput, errMessage string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job.terminal() {
+		return
+	}
+	now := q.now()
+	job.Status = JobStatusSucceeded
+	if result == nil {
+		job.Status = JobStatusFailed
+	}
+	job.Result = result
+	job.Error = errMessage
+	job.FinishedAt = now.UTC().Format(time.RFC3339)
+	job.expires = now.Add(q.ttl)
+	job.ExpiresAt = job.expires.UTC().Format(time.RFC3339)
+
+	metrics.DownloadJobsTotal.WithLabelValues(job.Status).Inc()
+	if !job.started.IsZero() {
+		metrics.DownloadJobDuration.WithLabelValues(job.Status).Observe(now.Sub(job.started).Seconds())
+	}
+	if result != nil {
+		metrics.DownloadJobBytesTotal.WithLabelValues(job.Status).Add(float64(result.Size))
+	} else {
+		q.failures = append(q.failures, now)
+	}
+}
+
+// failureWindow is the period over which failed jobs are counted for readiness reporting
+const failureWindow = time.Hour
+
+// estimateCompletion estimates how long a job queued behind the given number of queued and
+// running jobs takes to finish, from the transfer estimates of recent downloads: the jobs ahead
+// take their turns on the workers, and every job takes as long as a download of typical size,
+// since the size of a PDF is only known once arXiv serves it. Every job ahead also takes a turn on
+// the arXiv rate limiter before its request. It returns false if no download has been measured yet.
+func (q *jobQueue) estimateCompletion(ahead int) (time.Duration, bool) {
+	estimate, ok := storage.Transfers.Estimate()
+	if !ok || q.workerCount < 1 {
+		return 0, false
+	}
+	ahead = max(ahead, 0)
+	rounds := ahead/q.workerCount + 1
+	return time.Duration(rounds)*estimate.Duration(0) + time.Duration(ahead)*arxivInterval(), true
+}
+
+// DownloadJobsStatus is a snapshot of the background download queue for readiness reporting
+type DownloadJobsStatus struct {
+	Queued         int `json:"queued"`
+	Running        int `json:"running"`
+	FailedLastHour int `json:"failedLastHour"`
+}
+
+// status returns the number of queued and running jobs and of jobs failed during the last hour
+func (q *jobQueue) status() DownloadJobsStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var status DownloadJobsStatus
+	for _, job := range q.jobs {
+		switch job.Status {
+		case JobStatusQueued:
+			status.Queued++
+		case JobStatusRunning:
+			status.Running++
+		}
+	}
+	cutoff := q.now().Add(-failureWindow)
+	recent := q.failures[:0]
+	for _, failed := range q.failures {
+		if failed.After(cutoff) {
+			recent = append(recent, failed)
+		}
+	}
+	q.failures = recent
+	status.FailedLastHour = len(recent)
+	return status
+}
+
+// persist saves the finished jobs that have not expired to the store, if any
+func (q *jobQueue) persist(ctx context.Context) {
+	if q.store == nil {
+		return
+	}
+	q.persistMu.Lock()
+	defer q.persistMu.Unlock()
+
+	q.mu.Lock()
+	q.purgeExpired()
+	finished := make([]DownloadJob, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		if job.terminal() {
+			finished = append(finished, job.DownloadJob)
+		}
+	}
+	q.mu.Unlock()
+
+	// Sorted and canonical JSON, so that the same jobs are always saved as the same bytes
+	slices.SortFunc(finished, func(a, b DownloadJob) int { return strings.Compare(a.JobID, b.JobID) })
+	data, err := canonicaljson.Marshal(finished)
+	if err == nil {
+		err = q.store.Save(ctx, data)
+	}
+	if err != nil {
+		// The jobs can still be queried until the server restarts
+		slog.Warn("Failed to save download jobs", "error", err)
+	}
+}
+
+// restore loads the finished jobs saved in the store that have not expired
+func (q *jobQueue) restore(ctx context.Context) error {
+	if q.store == nil {
+		return nil
+	}
+	data, err := q.store.Load(ctx)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load download jobs: %w", err)
+	}
+	var saved []DownloadJob
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("failed to parse download jobs: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, job := range saved {
+		expires, err := time.Parse(time.RFC3339, job.ExpiresAt)
+		if err != nil || !job.terminal() {
+			continue
+		}
+		q.jobs[job.JobID] = &downloadJob{DownloadJob: job, expires: expires}
+	}
+	q.purgeExpired()
+	return nil
+}
+
+// shutdown stops accepting jobs and waits for the queued and running ones to finish. If the context
+// ends first, running transfers are aborted and every unfinished job is recorded as failed.
+// Finished jobs are then saved, so that their outcomes can be queried after a restart.
+func (q *jobQueue) shutdown(ctx context.Context) {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.pending)
+	}
+	q.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		slog.Info("Download jobs drained")
+	case <-ctx.Done():
+		q.cancel()
+		interrupted := q.unfinished()
+		for _, job := range interrupted {
+			job.slot.cancel()
+			q.finish(job, nil, jobInterruptedMessage)
+		}
+		slog.Warn("Download jobs interrupted by shutdown", "jobs", len(interrupted))
+	}
+	q.cancel()
+
+	// The shutdown context may have ended, but the outcomes are still worth saving
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	q.persist(saveCtx)
+}
+
+// unfinished returns the jobs that are queued or running
+func (q *jobQueue) unfinished() []*downloadJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var jobs []*downloadJob
+	for _, job := range q.jobs {
+		if !job.terminal() {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// stopDownloadJobs shuts the download job queue down, if it was started
+func stopDownloadJobs(drainTimeout time.Duration) {
+	if downloadJobs == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	slog.Info("Waiting for download jobs to finish", "timeout", drainTimeout)
+	downloadJobs.shutdown(ctx)
+}
+
+// DownloadJobStatusArgs defines the input parameters for querying a download job
+type DownloadJobStatusArgs struct {
+	JobID string `json:"jobId" jsonschema:"The jobId returned by arxiv_download_pdf with async set"`
+}
+
+// downloadJobStatus handles querying the state of a background download job
+func downloadJobStatus(ctx context.Context, input json.RawMessage) (any, error) {
+	var args DownloadJobStatusArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+	if downloadJobs == nil {
+		return nil, fmt.Errorf("background downloads are not available because S3 storage is not configured")
+	}
+	job, ok := downloadJobs.get(args.JobID)
+	if !ok {
+		return nil, &ToolError{
+			Code:    ErrCodeJobNotFound,
+			Message: fmt.Sprintf("download job %q is unknown or its outcome has expired", args.JobID),
+			Details: map[string]any{"jobId": args.JobID},
+		}
+	}
+	return job, nil
+}
@@ -0,0 +1,412 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/metrics"
+	"opus-mcp/internal/settings"
+	"opus-mcp/internal/storage"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/time/rate"
+)
+
+// testClock is a manually advanced clock for job expiry
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// waitForJobStatus polls a job until it reaches the given status
+func waitForJobStatus(t *testing.T, q *jobQueue, id, status string) DownloadJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, ok := q.get(id)
+		if !ok {
+			t.Fatalf("job %s not found while waiting for status %s", id, status)
+		}
+		if job.Status == status {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s has status %s, want %s", id, job.Status, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDownloadJobLifecycle(t *testing.T) {
+	withUnlimitedArxiv(t)
+	originalConfig, originalUploader, originalJobs, originalLibrary := globalS3Config, urlUploader, downloadJobs, globalLibrary
+	t.Cleanup(func() {
+		globalS3Config, urlUploader, downloadJobs, globalLibrary = originalConfig, originalUploader, originalJobs, originalLibrary
+	})
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	globalLibrary = nil
+	release := make(chan struct{})
+	urlUploader = func(ctx context.Context, sourceURL string, config *storage.S3Config, bucketName, objectName string, metadata map[string]string, policy storage.CollisionPolicy) (storage.UploadResult, error) {
+		<-release
+		return storage.UploadResult{UploadInfo: minio.UploadInfo{Bucket: bucketName, Key: objectName, Size: 42}, SHA256: "abc123"}, nil
+	}
+	clock := &testClock{now: time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)}
+	store := &library.MemoryStore{}
+	downloadJobs = newJobQueue(&DownloadJobConfig{Workers: 1, QueueSize: 4, TTL: settings.Duration(time.Hour)}, store)
+	downloadJobs.now = clock.Now
+	downloadJobs.startWorkers(1)
+	t.Cleanup(func() { downloadJobs.shutdown(context.Background()) })
+
+	// The download returns a job immediately, without waiting for the transfer
+	handler := newTestToolHandler(t, downloadPDFToS3)
+	result, err := handler.Handle(context.Background(), newTestCallToolRequest("arxiv_download_pdf", `{"articleId":"2405.12345v2","async":true}`))
+	if err != nil || result.IsError {
+		t.Fatalf("Handle() = %v, %v, want a queued job", result, err)
+	}
+	var queued ArxivDownloadPDFOutput
+	if err := json.Unmarshal([]byte(resultText(t, result)), &queued); err != nil {
+		t.Fatalf("failed to unmarshal output: %v", err)
+	}
+	if queued.JobID == "" || queued.ObjectName != "arxiv/2405.12345v2.pdf" || queued.SHA256 != "" {
+		t.Fatalf("queued output = %+v, want a job ID and no upload result yet", queued)
+	}
+
+	status := func() (DownloadJob, error) {
+		output, err := downloadJobStatus(context.Background(), json.RawMessage(`{"jobId":"`+queued.JobID+`"}`))
+		if err != nil {
+			return DownloadJob{}, err
+		}
+		return output.(DownloadJob), nil
+	}
+
+	waitForJobStatus(t, downloadJobs, queued.JobID, JobStatusRunning)
+	close(release)
+	waitForJobStatus(t, downloadJobs, queued.JobID, JobStatusSucceeded)
+
+	job, err := status()
+	if err != nil {
+		t.Fatalf("downloadJobStatus() unexpected error: %v", err)
+	}
+	if job.Result == nil || job.Result.SHA256 != "abc123" || !job.Result.Success {
+		t.Errorf("succeeded job result = %+v, want the upload result", job.Result)
+	}
+	if job.ArticleID != "2405.12345v2" || job.StartedAt == "" || job.FinishedAt == "" || job.ExpiresAt != "2025-06-02T13:00:00Z" {
+		t.Errorf("succeeded job = %+v", job)
+	}
+
+	// The finished job is saved, so that it survives a restart
+	waitForSavedJobs(t, store, 1)
+
+	// Once its TTL has passed, the job can no longer be queried
+	clock.Advance(time.Hour)
+	_, err = status()
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeJobNotFound {
+		t.Errorf("downloadJobStatus() of an expired job error = %v, want %s", err, ErrCodeJobNotFound)
+	}
+}
+
+// waitForSavedJobs waits until the store holds the given number of saved jobs
+func waitForSavedJobs(t *testing.T, store library.Store, want int) []DownloadJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var saved []DownloadJob
+		if data, err := store.Load(context.Background()); err == nil {
+			if err := json.Unmarshal(data, &saved); err != nil {
+				t.Fatalf("failed to unmarshal saved jobs: %v", err)
+			}
+		}
+		if len(saved) == want {
+			return saved
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("store holds %d jobs, want %d", len(saved), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDownloadJobQueueFull(t *testing.T) {
+	// Without workers, queued jobs stay queued
+	q := newJobQueue(&DownloadJobConfig{QueueSize: 1, TTL: settings.Duration(time.Hour)}, nil)
+	transfer := func(ctx context.Context) (ArxivDownloadPDFOutput, error) { return ArxivDownloadPDFOutput{}, nil }
+
+	job, err := q.submit(DownloadJob{ArticleID: "2405.00001"}, transfer)
+	if err != nil || job.Status != JobStatusQueued {
+		t.Fatalf("submit() = %+v, %v, want a queued job", job, err)
+	}
+	_, err = q.submit(DownloadJob{ArticleID: "2405.00002"}, transfer)
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeBusy || !toolErr.Retryable {
+		t.Errorf("submit() to a full queue error = %v, want a retryable %s", err, ErrCodeBusy)
+	}
+}
+
+func TestDownloadJobReservesArxivSlot(t *testing.T) {
+	originalDeps := toolDeps
+	t.Cleanup(func() { toolDeps = originalDeps })
+	// One request an hour, so that every slot after the first is far ahead
+	newLimiter := func() *rate.Limiter {
+		deps := *originalDeps
+		deps.ArxivLimiter = rate.NewLimiter(rate.Every(time.Hour), 1)
+		toolDeps = &deps
+		return deps.ArxivLimiter
+	}
+	// tokensNear reports whether the limiter holds about the given number of tokens
+	tokensNear := func(limiter *rate.Limiter, want float64) bool {
+		return math.Abs(limiter.Tokens()-want) < 0.01
+	}
+
+	// The job takes its slot when queued, and its transfer uses it instead of waiting for another,
+	// which would take an hour and so be refused by the deadline
+	limiter := newLimiter()
+	q := newJobQueue(&DownloadJobConfig{QueueSize: 1, TTL: settings.Duration(time.Hour)}, nil)
+	job, err := q.submit(DownloadJob{ArticleID: "2405.00001"}, func(ctx context.Context) (ArxivDownloadPDFOutput, error) {
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		return ArxivDownloadPDFOutput{Success: true}, waitForArxiv(ctx)
+	})
+	if err != nil {
+		t.Fatalf("submit() error = %v", err)
+	}
+	if !tokensNear(limiter, 0) {
+		t.Errorf("limiter tokens after submit() = %.2f, want the slot reserved", limiter.Tokens())
+	}
+	// A refused job gives its slot back
+	if _, err := q.submit(DownloadJob{ArticleID: "2405.00002"}, nil); err == nil {
+		t.Fatal("submit() to a full queue succeeded")
+	}
+	if !tokensNear(limiter, 0) {
+		t.Errorf("limiter tokens after a refused submit() = %.2f, want its slot given back", limiter.Tokens())
+	}
+	q.startWorkers(1)
+	t.Cleanup(func() { q.shutdown(context.Background()) })
+	if got := waitForJobStatus(t, q, job.JobID, JobStatusSucceeded); got.Error != "" {
+		t.Errorf("job error = %q, want none", got.Error)
+	}
+
+	// A job failing before its request to arXiv gives its slot back
+	limiter = newLimiter()
+	failing := func(ctx context.Context) (ArxivDownloadPDFOutput, error) {
+		return ArxivDownloadPDFOutput{}, errors.New("the object exists")
+	}
+	q = newJobQueue(&DownloadJobConfig{QueueSize: 2, TTL: settings.Duration(time.Hour)}, nil)
+	first, _ := q.submit(DownloadJob{ArticleID: "2405.00003"}, failing)
+	second, _ := q.submit(DownloadJob{ArticleID: "2405.00004"}, failing)
+	if !tokensNear(limiter, -1) {
+		t.Errorf("limiter tokens after two submit() = %.2f, want two slots reserved", limiter.Tokens())
+	}
+	q.startWorkers(1)
+	t.Cleanup(func() { q.shutdown(context.Background()) })
+	waitForJobStatus(t, q, first.JobID, JobStatusFailed)
+	waitForJobStatus(t, q, second.JobID, JobStatusFailed)
+	// The first slot has come up already, so only the second can be given back
+	if !tokensNear(limiter, 0) {
+		t.Errorf("limiter tokens after the jobs failed = %.2f, want the unused slot given back", limiter.Tokens())
+	}
+}
+
+func TestDownloadJobCompletionEstimate(t *testing.T) {
+	withUnlimitedArxiv(t)
+	original := storage.Transfers
+	t.Cleanup(func() { storage.Transfers = original })
+	storage.Transfers = &storage.TransferEstimator{}
+	q := newJobQueue(&DownloadJobConfig{QueueSize: 4, TTL: settings.Duration(time.Hour)}, nil)
+	q.workerCount = 2
+
+	if _, ok := q.estimateCompletion(0); ok {
+		t.Fatal("estimateCompletion() without measured downloads reported an estimate")
+	}
+	// Each download takes 1 s to the first byte, 2 s from the origin and 1 s to S3
+	storage.Transfers.Observe(storage.TransferTimings{OriginTTFB: time.Second, OriginTransfer: 2 * time.Second, OriginBytes: 4_000_000, Upload: time.Second, UploadBytes: 4_000_000})
+	tests := []struct {
+		ahead int
+		want  time.Duration
+	}{
+		{0, 4 * time.Second},
+		{1, 4 * time.Second},
+		{2, 8 * time.Second},
+		{5, 12 * time.Second},
+	}
+	for _, tt := range tests {
+		if got, ok := q.estimateCompletion(tt.ahead); !ok || got != tt.want {
+			t.Errorf("estimateCompletion(%d) = %s, %v, want %s", tt.ahead, got, ok, tt.want)
+		}
+	}
+
+	// Every job ahead also waits a rate limit interval for its request to arXiv
+	toolDeps.ArxivLimiter = rate.NewLimiter(rate.Every(3*time.Second), 1)
+	if got, ok := q.estimateCompletion(2); !ok || got != 14*time.Second {
+		t.Errorf("estimateCompletion(2) with a 3 s rate limit = %s, %v, want 14s", got, ok)
+	}
+}
+
+func TestDownloadJobRestoreAfterRestart(t *testing.T) {
+	clock := &testClock{now: time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)}
+	store := &library.MemoryStore{}
+	first := newJobQueue(&DownloadJobConfig{QueueSize: 4, TTL: settings.Duration(time.Hour)}, store)
+	first.now = clock.Now
+	first.startWorkers(1)
+
+	failed, err := first.submit(DownloadJob{ArticleID: "2405.00001"}, func(ctx context.Context) (ArxivDownloadPDFOutput, error) {
+		return ArxivDownloadPDFOutput{}, errors.New("upstream returned HTTP 404")
+	})
+	if err != nil {
+		t.Fatalf("submit() unexpected error: %v", err)
+	}
+	first.shutdown(context.Background())
+
+	// A restarted server still knows the outcome of the job
+	clock.Advance(30 * time.Minute)
+	second := newJobQueue(&DownloadJobConfig{QueueSize: 4, TTL: settings.Duration(time.Hour)}, store)
+	second.now = clock.Now
+	if err := second.restore(context.Background()); err != nil {
+		t.Fatalf("restore() unexpected error: %v", err)
+	}
+	job, ok := second.get(failed.JobID)
+	if !ok || job.Status != JobStatusFailed || !strings.Contains(job.Error, "404") {
+		t.Errorf("restored job = %+v, %v, want the failed job with its error", job, ok)
+	}
+
+	// Expired jobs are not restored
+	clock.Advance(time.Hour)
+	third := newJobQueue(&DownloadJobConfig{QueueSize: 4, TTL: settings.Duration(time.Hour)}, store)
+	third.now = clock.Now
+	if err := third.restore(context.Background()); err != nil {
+		t.Fatalf("restore() unexpected error: %v", err)
+	}
+	if _, ok := third.get(failed.JobID); ok {
+		t.Error("expired job was restored")
+	}
+}
+
+func TestDownloadJobShutdown(t *testing.T) {
+	t.Run("Drains jobs that finish in time", func(t *testing.T) {
+		q := newJobQueue(&DownloadJobConfig{QueueSize: 4, TTL: settings.Duration(time.Hour)}, nil)
+		q.startWorkers(1)
+		release := make(chan struct{})
+		job, err := q.submit(DownloadJob{ArticleID: "2405.00001"}, func(ctx context.Context) (ArxivDownloadPDFOutput, error) {
+			<-release
+			return ArxivDownloadPDFOutput{Success: true}, nil
+		})
+		if err != nil {
+			t.Fatalf("submit() unexpected error: %v", err)
+		}
+		waitForJobStatus(t, q, job.JobID, JobStatusRunning)
+		time.AfterFunc(20*time.Millisecond, func() { close(release) })
+		q.shutdown(context.Background())
+		if got, _ := q.get(job.JobID); got.Status != JobStatusSucceeded {
+			t.Errorf("drained job status = %s, want %s", got.Status, JobStatusSucceeded)
+		}
+		if _, err := q.submit(DownloadJob{}, nil); err == nil {
+			t.Error("submit() after shutdown should be refused")
+		}
+	})
+
+	t.Run("Records jobs that do not finish in time", func(t *testing.T) {
+		store := &library.MemoryStore{}
+		q := newJobQueue(&DownloadJobConfig{QueueSize: 4, TTL: settings.Duration(time.Hour)}, store)
+		q.startWorkers(1)
+		transfer := func(ctx context.Context) (ArxivDownloadPDFOutput, error) {
+			<-ctx.Done()
+			return ArxivDownloadPDFOutput{}, ctx.Err()
+		}
+		running, err := q.submit(DownloadJob{ArticleID: "2405.00001"}, transfer)
+		if err != nil {
+			t.Fatalf("submit() unexpected error: %v", err)
+		}
+		queued, err := q.submit(DownloadJob{ArticleID: "2405.00002"}, transfer)
+		if err != nil {
+			t.Fatalf("submit() unexpected error: %v", err)
+		}
+		waitForJobStatus(t, q, running.JobID, JobStatusRunning)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		q.shutdown(ctx)
+
+		for _, id := range []string{running.JobID, queued.JobID} {
+			if job, _ := q.get(id); job.Status != JobStatusFailed || !strings.Contains(job.Error, "shut down") {
+				t.Errorf("interrupted job = %+v, want it failed by the shutdown", job)
+			}
+		}
+		waitForSavedJobs(t, store, 2)
+	})
+}
+
+func TestDownloadJobMetrics(t *testing.T) {
+	originalJobs := downloadJobs
+	t.Cleanup(func() { downloadJobs = originalJobs })
+	downloadJobs = newJobQueue(&DownloadJobConfig{QueueSize: 4, TTL: settings.Duration(time.Hour)}, nil)
+	downloadJobs.startWorkers(1)
+
+	succeeded, err := downloadJobs.submit(DownloadJob{ArticleID: "2405.00001"}, func(ctx context.Context) (ArxivDownloadPDFOutput, error) {
+		return ArxivDownloadPDFOutput{Success: true, Size: 2048}, nil
+	})
+	if err != nil {
+		t.Fatalf("submit() unexpected error: %v", err)
+	}
+	failed, err := downloadJobs.submit(DownloadJob{ArticleID: "2405.00002"}, func(ctx context.Context) (ArxivDownloadPDFOutput, error) {
+		return ArxivDownloadPDFOutput{}, errors.New("upstream returned HTTP 404")
+	})
+	if err != nil {
+		t.Fatalf("submit() unexpected error: %v", err)
+	}
+	waitForJobStatus(t, downloadJobs, succeeded.JobID, JobStatusSucceeded)
+	waitForJobStatus(t, downloadJobs, failed.JobID, JobStatusFailed)
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	scraped := recorder.Body.String()
+	for _, series := range []string{
+		`opus_mcp_download_jobs_total{outcome="succeeded"}`,
+		`opus_mcp_download_jobs_total{outcome="failed"}`,
+		`opus_mcp_download_job_duration_seconds_count{outcome="succeeded"}`,
+		`opus_mcp_download_job_bytes_total{outcome="succeeded"}`,
+		"opus_mcp_download_jobs_queued 0",
+		"opus_mcp_download_jobs_running 0",
+	} {
+		if !strings.Contains(scraped, series) {
+			t.Errorf("scraped metrics lack %s", series)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.DownloadJobBytesTotal.WithLabelValues(JobStatusSucceeded)); got < 2048 {
+		t.Errorf("bytes stored by succeeded jobs = %v, want at least 2048", got)
+	}
+
+	// The headline numbers are part of the readiness report
+	recorder = httptest.NewRecorder()
+	readinessHandler(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	var ready struct {
+		DownloadJobs DownloadJobsStatus `json:"downloadJobs"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &ready); err != nil {
+		t.Fatalf("failed to unmarshal readiness: %v", err)
+	}
+	if ready.DownloadJobs != (DownloadJobsStatus{FailedLastHour: 1}) {
+		t.Errorf("readiness downloadJobs = %+v, want one failure in the last hour", ready.DownloadJobs)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/textutil"
+)
+
+// LibraryRecording reports what a fetch called with recordToLibrary recorded in the library index
+type LibraryRecording struct {
+	Recorded int `json:"recorded" jsonschema:"The number of metadata-only entries added to or updated in the library index; entries already recorded unchanged and articles already downloaded are not counted"`
+	// Error is only set when the index could not be updated; the fetched entries are returned regardless
+	Error string `json:"error,omitempty" jsonschema:"Why the entries could not be recorded in the library index"`
+}
+
+// errLibraryUnavailable refuses recordToLibrary when there is no library index to record in
+var errLibraryUnavailable = errors.New("recordToLibrary needs the library index, which is not available. Please ensure S3 storage is configured")
+
+// recordFetchedMetadata records the fetched entries as metadata-only entries of the library index,
+// under the object name an unversioned download of each article would store it as, with the query
+// that returned them as their provenance. Failing to update the index does not fail the fetch.
+func recordFetchedMetadata(ctx context.Context, items []*FeedEntry, query string, idList []string) *LibraryRecording {
+	provenance := downloadProvenance(ctx, "", time.Now())
+	provenance.QueryTool = provenance.Tool
+	provenance.Query = query
+	provenance.IDList = idList
+
+	var entries []library.Entry
+	for _, item := range items {
+		id, err := arxivid.Parse(item.ArticleID)
+		if err != nil {
+			continue
+		}
+		objectName, err := pdfObjectName(id.WithVersion(0), item.PrimaryCategory)
+		if err != nil {
+			slog.Warn("Failed to name the object of a fetched article", "article_id", item.ArticleID, "error", err)
+			continue
+		}
+		entries = append(entries, library.Entry{
+			ObjectName: objectName,
+			Bucket:     S3_ARTICLES_BUCKET,
+			ArticleID:  id.Canonical(),
+			Provenance: provenance,
+			Metadata:   articleMetadata(item),
+		})
+	}
+	recorded, err := globalLibrary.RecordMetadata(ctx, entries)
+	if err != nil {
+		slog.Warn("Failed to record fetched articles in the library index", "articles", len(entries), "error", err)
+		return &LibraryRecording{Error: err.Error()}
+	}
+	slog.Info("Recorded fetched articles in the library index", "articles", len(entries), "recorded", recorded)
+	return &LibraryRecording{Recorded: recorded}
+}
+
+// articleMetadata takes the bibliographic metadata of a fetched entry
+func articleMetadata(item *FeedEntry) *library.ArticleMetadata {
+	metadata := &library.ArticleMetadata{
+		Title:           textutil.CollapseSpace(item.Title),
+		PrimaryCategory: item.PrimaryCategory,
+		Categories:      item.Categories,
+		Published:       item.Published,
+		Updated:         item.Updated,
+	}
+	for _, author := range item.Authors {
+		if author != nil && author.Name != "" {
+			metadata.Authors = append(metadata.Authors, author.Name)
+		}
+	}
+	return metadata
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/storage"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestFetchRecordsMetadataOnlyEntries(t *testing.T) {
+	originalConfig, originalLibrary, originalUploader := globalS3Config, globalLibrary, urlUploader
+	t.Cleanup(func() {
+		globalS3Config, globalLibrary, urlUploader = originalConfig, originalLibrary, originalUploader
+	})
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	globalLibrary = library.New(&library.MemoryStore{})
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(idListFeed(strings.Split(r.URL.Query().Get("id_list"), ","))))
+	})
+
+	ctx := context.Background()
+	input := json.RawMessage(`{"ids": ["2405.12345", "2405.54321"], "recordToLibrary": true}`)
+	for i, wantRecorded := range []int{2, 0} {
+		output, err := fetchByID(ctx, input)
+		if err != nil {
+			t.Fatalf("fetchByID() unexpected error: %v", err)
+		}
+		if recording := output.(*FetchByIDResult).Library; recording == nil || recording.Recorded != wantRecorded || recording.Error != "" {
+			t.Errorf("fetch %d recorded %+v, want %d entries", i+1, recording, wantRecorded)
+		}
+	}
+	entries, err := globalLibrary.Entries(ctx)
+	if err != nil {
+		t.Fatalf("Entries() unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Entries() = %+v, want one entry per article", entries)
+	}
+	entry := entries[0]
+	if entry.ObjectName != "arxiv/2405.12345.pdf" || entry.Status != library.StatusMetadataOnly || entry.ArticleID != "2405.12345v1" {
+		t.Errorf("entry = %+v, want a metadata-only entry of 2405.12345v1", entry)
+	}
+	if entry.Metadata == nil || entry.Metadata.Title != "Paper 2405.12345" || entry.Provenance == nil || entry.Provenance.IDList == nil {
+		t.Errorf("entry metadata = %+v, provenance = %+v, want the title and the fetched ID list", entry.Metadata, entry.Provenance)
+	}
+
+	// Downloading one of the articles replaces its metadata-only entry with the stored object
+	urlUploader = func(ctx context.Context, sourceURL string, config *storage.S3Config, bucketName, objectName string, metadata map[string]string, policy storage.CollisionPolicy) (storage.UploadResult, error) {
+		return storage.UploadResult{UploadInfo: minio.UploadInfo{Bucket: bucketName, Key: objectName, Size: 42}}, nil
+	}
+	if _, err := downloadPDFToS3(ctx, json.RawMessage(`{"articleId": "2405.12345v1"}`)); err != nil {
+		t.Fatalf("downloadPDFToS3() unexpected error: %v", err)
+	}
+	entries, err = globalLibrary.Entries(ctx)
+	if err != nil {
+		t.Fatalf("Entries() unexpected error: %v", err)
+	}
+	if len(entries) != 2 || entries[0].ObjectName != "arxiv/2405.12345v1.pdf" || entries[0].Status != "" || entries[1].Status != library.StatusMetadataOnly {
+		t.Fatalf("Entries() = %+v, want the downloaded article and the other metadata-only entry", entries)
+	}
+	if entries[0].Metadata == nil || entries[0].Metadata.Title != "Paper 2405.12345" {
+		t.Errorf("downloaded entry metadata = %+v, want the metadata recorded by the fetch", entries[0].Metadata)
+	}
+
+	// Fetching the downloaded article again does not bring back its metadata-only entry
+	output, err := fetchByID(ctx, json.RawMessage(`{"ids": ["2405.12345"], "recordToLibrary": true}`))
+	if err != nil {
+		t.Fatalf("fetchByID() unexpected error: %v", err)
+	}
+	if recorded := output.(*FetchByIDResult).Library.Recorded; recorded != 0 {
+		t.Errorf("fetch of a downloaded article recorded %d entries, want 0", recorded)
+	}
+}
+
+func TestFetchRecordToLibraryNeedsLibrary(t *testing.T) {
+	originalLibrary := globalLibrary
+	t.Cleanup(func() { globalLibrary = originalLibrary })
+	globalLibrary = nil
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected API request %s without a library", r.URL)
+	})
+
+	if _, err := fetchByID(context.Background(), json.RawMessage(`{"ids": ["2405.12345"], "recordToLibrary": true}`)); err != errLibraryUnavailable {
+		t.Errorf("fetchByID() error = %v, want errLibraryUnavailable", err)
+	}
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"opus-mcp/internal/settings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	// structuredContentProtocolVersion is the first MCP protocol version with structured tool
+	// results and resource links in tool results; versions are dates, so they compare as strings
+	structuredContentProtocolVersion = "2025-06-18"
+	// structuredContentMetaKey is the _meta key of a tool call that asks for structured content, or
+	// not, regardless of the client's protocol version
+	structuredContentMetaKey = "opus-mcp/structuredContent"
+)
+
+// NegotiationConfig holds the configuration of the output defaults adjusted to each client, loaded
+// from environment variables
+type NegotiationConfig struct {
+	// ConstrainedClients are the names clients with a small context identify as in clientInfo,
+	// matched case-insensitively as prefixes, e.g., a client named mobile-assistant matches mobile
+	ConstrainedClients []string `env:"OPUS_MCP_CONSTRAINED_CLIENTS"`
+	// ConstrainedMaxTokens is the maxTokensHint tools default to for constrained clients
+	ConstrainedMaxTokens uint `env:"OPUS_MCP_CONSTRAINED_MAX_TOKENS,default=8000"`
+}
+
+// Validate checks that constrained clients get a token budget
+func (c *NegotiationConfig) Validate() error {
+	if len(c.ConstrainedClients) > 0 && c.ConstrainedMaxTokens == 0 {
+		return fmt.Errorf("OPUS_MCP_CONSTRAINED_MAX_TOKENS must be positive when OPUS_MCP_CONSTRAINED_CLIENTS is set")
+	}
+	return nil
+}
+
+// LoadNegotiationConfig loads the configuration of the per-client output defaults from environment variables
+func LoadNegotiationConfig() (*NegotiationConfig, error) {
+	var config NegotiationConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process negotiation configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// negotiationConfig is the negotiation configuration loaded at server startup
+var negotiationConfig = NegotiationConfig{ConstrainedMaxTokens: 8000}
+
+// outputProfile is how the outputs of tool calls are adjusted to what a client declared during
+// initialization. The zero value leaves outputs as they are, e.g., for calls without a session.
+type outputProfile struct {
+	// omitStructuredContent leaves out the structured content, which clients of protocol versions
+	// predating it ignore, so that the output is not sent twice
+	omitStructuredContent bool
+	// resourceLinks makes tools returning object content link to it by default rather than inline it
+	resourceLinks bool
+	// maxTokensHint is the maxTokensHint tools default to, 0 for no default
+	maxTokensHint uint
+}
+
+// adjusted reports whether the profile changes anything about tool outputs
+func (p outputProfile) adjusted() bool {
+	return p != outputProfile{}
+}
+
+// negotiateOutputProfile derives the output profile of a session from its initialization parameters
+func negotiateOutputProfile(params *mcp.InitializeParams) outputProfile {
+	var profile outputProfile
+	if params == nil {
+		return profile
+	}
+	if params.ProtocolVersion != "" {
+		modern := params.ProtocolVersion >= structuredContentProtocolVersion
+		profile.omitStructuredContent = !modern
+		profile.resourceLinks = modern
+	}
+	if params.ClientInfo != nil && constrainedClient(params.ClientInfo.Name) {
+		profile.maxTokensHint = negotiationConfig.ConstrainedMaxTokens
+	}
+	return profile
+}
+
+// constrainedClient reports whether a client name matches one of the configured constrained clients
+func constrainedClient(name string) bool {
+	name = strings.ToLower(name)
+	for _, prefix := range negotiationConfig.ConstrainedClients {
+		if prefix = strings.ToLower(strings.TrimSpace(prefix)); prefix != "" && strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionOutputProfile returns the output profile of the session of a tool call
+func sessionOutputProfile(req *mcp.CallToolRequest) outputProfile {
+	if req.Session == nil {
+		return outputProfile{}
+	}
+	return negotiateOutputProfile(req.Session.InitializeParams())
+}
+
+// logOutputProfile logs, once a session is initialized, how tool outputs are adjusted to its client
+func logOutputProfile(ctx context.Context, req *mcp.InitializedRequest) {
+	params := req.Session.InitializeParams()
+	profile := negotiateOutputProfile(params)
+	if !profile.adjusted() {
+		return
+	}
+	client := ""
+	if params.ClientInfo != nil {
+		client = params.ClientInfo.Name
+	}
+	slog.InfoContext(ctx, "Adjusted tool output defaults to the client",
+		"session_id", req.Session.ID(),
+		"client", client,
+		"protocol_version", params.ProtocolVersion,
+		"structured_content", !profile.omitStructuredContent,
+		"resource_links", profile.resourceLinks,
+		"max_tokens_hint", profile.maxTokensHint)
+}
+
+// defaultArguments are the arguments a tool call defaults to under an output profile, keyed by the
+// name of the input property they set
+func (p outputProfile) defaultArguments() map[string]any {
+	defaults := map[string]any{}
+	if p.maxTokensHint > 0 {
+		defaults["maxTokensHint"] = p.maxTokensHint
+	}
+	if p.resourceLinks {
+		defaults["delivery"] = deliveryLink
+	}
+	return defaults
+}
+
+// withDefaultArguments adds the defaults of an output profile to the arguments of a tool call whose
+// input schema has the properties they set, unless the call sets them explicitly
+func (h *ArxivToolHandler) withDefaultArguments(arguments json.RawMessage, profile outputProfile) json.RawMessage {
+	defaults := profile.defaultArguments()
+	if len(defaults) == 0 {
+		return arguments
+	}
+	var args map[string]json.RawMessage
+	if len(arguments) > 0 {
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			// Leave malformed arguments for schema validation to report
+			return arguments
+		}
+	}
+	if args == nil {
+		args = map[string]json.RawMessage{}
+	}
+	properties := h.inputSchema.Schema().Properties
+	changed := false
+	for name, value := range defaults {
+		if _, ok := properties[name]; !ok {
+			continue
+		}
+		if _, explicit := args[name]; explicit {
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		args[name] = data
+		changed = true
+	}
+	if !changed {
+		return arguments
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return arguments
+	}
+	return data
+}
+
+// resourceLinker is implemented by tool outputs that link to resources rather than inline them
+type resourceLinker interface {
+	resourceLinks() []*mcp.ResourceLink
+}
+
+// wantsStructuredContent reports whether a tool call gets structured content: as its _meta asks if
+// it does, otherwise unless the output profile omits it
+func wantsStructuredContent(req *mcp.CallToolRequest, profile outputProfile) bool {
+	if req.Params != nil {
+		if want, ok := req.Params.Meta[structuredContentMetaKey].(bool); ok {
+			return want
+		}
+	}
+	return !profile.omitStructuredContent
+}
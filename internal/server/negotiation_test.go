@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/storage"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// negotiationEchoArgs are the arguments of a tool echoing the arguments it is called with
+type negotiationEchoArgs struct {
+	MaxTokensHint uint   `json:"maxTokensHint,omitempty"`
+	Delivery      string `json:"delivery,omitempty"`
+}
+
+// rawClient initializes a session with a server as a client of the given protocol version and name,
+// which the SDK client cannot pretend to be, and returns a function calling tools in that session
+func rawClient(t *testing.T, server *mcp.Server, protocolVersion, clientName string) func(name, arguments string, meta map[string]any) *mcp.CallToolResult {
+	t.Helper()
+	ctx := context.Background()
+	clientTransport, serverTransport := mcp.NewInMemoryTransports()
+	serverSession, err := server.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect server: %v", err)
+	}
+	t.Cleanup(func() { serverSession.Close() })
+	conn, err := clientTransport.Connect(ctx)
+	if err != nil {
+		t.Fatalf("failed to connect client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	nextID := 0
+	send := func(method string, params any, notification bool) json.RawMessage {
+		t.Helper()
+		data, err := json.Marshal(params)
+		if err != nil {
+			t.Fatalf("failed to marshal %s params: %v", method, err)
+		}
+		request := &jsonrpc.Request{Method: method, Params: data}
+		if !notification {
+			nextID++
+			request.ID, _ = jsonrpc.MakeID(float64(nextID))
+		}
+		if err := conn.Write(ctx, request); err != nil {
+			t.Fatalf("failed to send %s: %v", method, err)
+		}
+		if notification {
+			return nil
+		}
+		// Notifications the server sends meanwhile, such as tools/list_changed, are skipped
+		var message jsonrpc.Message
+		for {
+			message, err = conn.Read(ctx)
+			if err != nil {
+				t.Fatalf("failed to read the response to %s: %v", method, err)
+			}
+			if request, ok := message.(*jsonrpc.Request); !ok || request.ID.IsValid() {
+				break
+			}
+		}
+		response, ok := message.(*jsonrpc.Response)
+		if !ok || response.Error != nil {
+			t.Fatalf("%s got %+v, want a successful response", method, message)
+		}
+		return response.Result
+	}
+	send("initialize", map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": clientName, "version": "1.0.0"},
+	}, false)
+	send("notifications/initialized", map[string]any{}, true)
+
+	return func(name, arguments string, meta map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		params := map[string]any{"name": name, "arguments": json.RawMessage(arguments)}
+		if meta != nil {
+			params["_meta"] = meta
+		}
+		var result mcp.CallToolResult
+		if err := json.Unmarshal(send("tools/call", params, false), &result); err != nil {
+			t.Fatalf("failed to unmarshal the result of %s: %v", name, err)
+		}
+		if result.IsError {
+			t.Fatalf("%s failed: %s", name, resultText(t, &result))
+		}
+		return &result
+	}
+}
+
+// negotiationServer serves a tool echoing its arguments and the object chunk read tool
+func negotiationServer(t *testing.T) *mcp.Server {
+	t.Helper()
+	server := mcp.NewServer(&mcp.Implementation{Name: "test-server", Version: "v0.0.1"}, nil)
+
+	schema, err := jsonschema.ForType(reflect.TypeFor[negotiationEchoArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		t.Fatalf("failed to reflect schema: %v", err)
+	}
+	echo, err := NewArxivToolHandler(schema, schema, func(ctx context.Context, input json.RawMessage) (any, error) {
+		var args negotiationEchoArgs
+		err := json.Unmarshal(input, &args)
+		return args, err
+	})
+	if err != nil {
+		t.Fatalf("failed to create echo handler: %v", err)
+	}
+	server.AddTool(&mcp.Tool{Name: "echo", InputSchema: schema, OutputSchema: schema}, echo.Handle)
+
+	tool, handler, err := newReadObjectChunkTool()
+	if err != nil {
+		t.Fatalf("failed to build tool: %v", err)
+	}
+	server.AddTool(tool, handler.Handle)
+	return server
+}
+
+func TestOutputNegotiation(t *testing.T) {
+	originalConfig, originalReader, originalAttributes, originalPresigner := negotiationConfig, objectRangeReader, objectAttributesReader, exportPresigner
+	t.Cleanup(func() {
+		negotiationConfig, objectRangeReader, objectAttributesReader, exportPresigner = originalConfig, originalReader, originalAttributes, originalPresigner
+	})
+	negotiationConfig = NegotiationConfig{ConstrainedClients: []string{"mobile"}, ConstrainedMaxTokens: 4000}
+	content := []byte("%PDF-1.7 test")
+	objectRangeReader = func(ctx context.Context, objectName string, offset, length int64) ([]byte, int64, error) {
+		return content, int64(len(content)), nil
+	}
+	objectAttributesReader = func(ctx context.Context, objectName string) (storage.ObjectAttributes, error) {
+		return storage.ObjectAttributes{Size: int64(len(content)), ContentType: "application/pdf"}, nil
+	}
+	exportPresigner = func(ctx context.Context, objectName string, expiry time.Duration) (string, error) {
+		return "https://s3.example.com/" + objectName + "?X-Amz-Signature=abc", nil
+	}
+	server := negotiationServer(t)
+
+	t.Run("context-constrained client of an older protocol", func(t *testing.T) {
+		call := rawClient(t, server, "2025-03-26", "Mobile-Assistant")
+
+		result := call("echo", `{}`, nil)
+		if result.StructuredContent != nil {
+			t.Errorf("structured content = %v, want it omitted for a protocol version predating it", result.StructuredContent)
+		}
+		var echoed negotiationEchoArgs
+		if err := json.Unmarshal([]byte(resultText(t, result)), &echoed); err != nil {
+			t.Fatalf("failed to unmarshal output: %v", err)
+		}
+		if want := (negotiationEchoArgs{MaxTokensHint: 4000}); echoed != want {
+			t.Errorf("arguments = %+v, want the token budget of constrained clients %+v", echoed, want)
+		}
+
+		// Explicit arguments and _meta override the negotiated defaults
+		result = call("echo", `{"maxTokensHint": 0, "delivery": "link"}`, map[string]any{structuredContentMetaKey: true})
+		if result.StructuredContent == nil {
+			t.Error("structured content omitted, want it when _meta asks for it")
+		}
+		echoed = negotiationEchoArgs{}
+		if err := json.Unmarshal([]byte(resultText(t, result)), &echoed); err != nil {
+			t.Fatalf("failed to unmarshal output: %v", err)
+		}
+		if want := (negotiationEchoArgs{Delivery: deliveryLink}); echoed != want {
+			t.Errorf("arguments = %+v, want the explicit ones %+v", echoed, want)
+		}
+
+		result = call("s3_read_object_chunk", `{"objectName": "arxiv/2405.12345.pdf"}`, nil)
+		if len(result.Content) != 1 {
+			t.Errorf("got %d content blocks, want only the text of inline content", len(result.Content))
+		}
+		var chunk S3ReadObjectChunkOutput
+		if err := json.Unmarshal([]byte(resultText(t, result)), &chunk); err != nil {
+			t.Fatalf("failed to unmarshal output: %v", err)
+		}
+		if chunk.Data == "" || chunk.URL != "" {
+			t.Errorf("chunk = %+v, want base64 data without a URL", chunk)
+		}
+	})
+
+	t.Run("client supporting structured content and resource links", func(t *testing.T) {
+		call := rawClient(t, server, "2025-06-18", "desktop-assistant")
+
+		result := call("echo", `{}`, nil)
+		if result.StructuredContent == nil {
+			t.Error("structured content omitted, want it for a protocol version supporting it")
+		}
+		var echoed negotiationEchoArgs
+		if err := json.Unmarshal([]byte(resultText(t, result)), &echoed); err != nil {
+			t.Fatalf("failed to unmarshal output: %v", err)
+		}
+		if want := (negotiationEchoArgs{Delivery: deliveryLink}); echoed != want {
+			t.Errorf("arguments = %+v, want resource links preferred without a token budget %+v", echoed, want)
+		}
+
+		result = call("s3_read_object_chunk", `{"objectName": "arxiv/2405.12345.pdf"}`, nil)
+		var chunk S3ReadObjectChunkOutput
+		if err := json.Unmarshal([]byte(resultText(t, result)), &chunk); err != nil {
+			t.Fatalf("failed to unmarshal output: %v", err)
+		}
+		if chunk.Data != "" || chunk.URL == "" || !chunk.Done || chunk.TotalSize != int64(len(content)) {
+			t.Errorf("chunk = %+v, want a presigned URL of the whole object instead of data", chunk)
+		}
+		if len(result.Content) != 2 {
+			t.Fatalf("got %d content blocks, want the text and a resource link", len(result.Content))
+		}
+		link, ok := result.Content[1].(*mcp.ResourceLink)
+		if !ok || link.URI != chunk.URL || link.MIMEType != "application/pdf" || link.Name != "arxiv/2405.12345.pdf" {
+			t.Errorf("content = %+v, want a resource link to %s", result.Content[1], chunk.URL)
+		}
+
+		// An explicit delivery overrides the preference for resource links
+		chunk = S3ReadObjectChunkOutput{}
+		result = call("s3_read_object_chunk", `{"objectName": "arxiv/2405.12345.pdf", "delivery": "inline"}`, nil)
+		if err := json.Unmarshal([]byte(resultText(t, result)), &chunk); err != nil {
+			t.Fatalf("failed to unmarshal output: %v", err)
+		}
+		if chunk.Data == "" || len(result.Content) != 1 {
+			t.Errorf("chunk = %+v with %d content blocks, want inline data only", chunk, len(result.Content))
+		}
+	})
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"text/template"
+
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/settings"
+	"opus-mcp/internal/storage"
+)
+
+// defaultObjectNameTemplate stores PDFs as arxiv/<identifier>.pdf, e.g., arxiv/hep-th_9901001v1.pdf
+const defaultObjectNameTemplate = `arxiv/{{.ID}}{{with .Version}}v{{.}}{{end}}.{{.Type}}`
+
+// objectTypePDF is the type of the PDFs of articles
+const objectTypePDF = "pdf"
+
+// ObjectNameConfig holds the layout of the objects arXiv articles are stored as
+type ObjectNameConfig struct {
+	// Template is a Go text/template rendering the object name of an article from ObjectNameFields
+	Template string `env:"OPUS_MCP_OBJECT_NAME_TEMPLATE"`
+}
+
+// Validate checks that the template, when set, renders valid object names
+func (c *ObjectNameConfig) Validate() error {
+	if c.Template == "" {
+		return nil
+	}
+	if _, err := newObjectNameTemplate(c.Template); err != nil {
+		return fmt.Errorf("OPUS_MCP_OBJECT_NAME_TEMPLATE is invalid: %w", err)
+	}
+	return nil
+}
+
+// ObjectNameFields are the fields object name templates render, e.g., {{.PrimaryCategory}}/{{.ID}}.pdf
+type ObjectNameFields struct {
+	// ID is the storage key of the identifier without version, e.g., 2301.00001 or hep-th_9901001
+	ID string
+	// Version is the version requested, or 0 for the latest
+	Version int
+	// Year and Month are when the identifier was assigned, e.g., 2023 and 01
+	Year  string
+	Month string
+	// PrimaryCategory is the category the article was submitted to, e.g., cs.CL
+	PrimaryCategory string
+	// Type is the type of the object, pdf
+	Type string
+}
+
+// objectNameFuncs are the only functions object name templates may call besides the builtins
+var objectNameFuncs = template.FuncMap{
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": strings.ReplaceAll,
+}
+
+// reservedObjectPrefixes hold the server's own objects, which articles must never be stored under
+var reservedObjectPrefixes = append([]string{summaryObjectPrefix, exportObjectPrefix}, cleanupProtectedPrefixes...)
+
+// objectNameTemplate renders the object names of articles
+type objectNameTemplate struct {
+	tmpl *template.Template
+	// usesPrimaryCategory is set when names depend on the primary category, which new-style
+	// identifiers do not tell
+	usesPrimaryCategory bool
+}
+
+// objectNames is the object name template loaded at server startup
+var objectNames = mustObjectNameTemplate(defaultObjectNameTemplate)
+
+// LoadObjectNameConfig loads the object name template from environment variables
+func LoadObjectNameConfig() (*ObjectNameConfig, error) {
+	var config ObjectNameConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process object name configuration from environment", "error", err)
+		return nil, err
+	}
+	if config.Template == "" {
+		config.Template = defaultObjectNameTemplate
+	}
+	return &config, nil
+}
+
+// newObjectNameTemplate parses an object name template and checks it by rendering the names of
+// sample articles, which must be valid object keys outside the server's own prefixes and must
+// tell different articles apart
+func newObjectNameTemplate(text string) (*objectNameTemplate, error) {
+	tmpl, err := template.New("objectName").Funcs(objectNameFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OPUS_MCP_OBJECT_NAME_TEMPLATE: %w", err)
+	}
+	names := &objectNameTemplate{tmpl: tmpl}
+	samples := []ObjectNameFields{
+		objectNameFields(arxivid.MustParse("2301.00001v2"), "cs.CL", objectTypePDF),
+		objectNameFields(arxivid.MustParse("hep-th/9901001"), "hep-th", objectTypePDF),
+	}
+	rendered := make([]string, len(samples))
+	for i, sample := range samples {
+		if rendered[i], err = names.render(sample); err != nil {
+			return nil, fmt.Errorf("invalid OPUS_MCP_OBJECT_NAME_TEMPLATE: %w", err)
+		}
+	}
+	if rendered[0] == rendered[1] {
+		return nil, fmt.Errorf("invalid OPUS_MCP_OBJECT_NAME_TEMPLATE: different articles are stored under the same name %q", rendered[0])
+	}
+	// Names depend on the primary category if changing only it changes the name
+	other := samples[0]
+	other.PrimaryCategory = "math.AG"
+	otherName, err := names.render(other)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OPUS_MCP_OBJECT_NAME_TEMPLATE: %w", err)
+	}
+	names.usesPrimaryCategory = otherName != rendered[0]
+	return names, nil
+}
+
+// mustObjectNameTemplate parses an object name template known to be valid
+func mustObjectNameTemplate(text string) *objectNameTemplate {
+	names, err := newObjectNameTemplate(text)
+	if err != nil {
+		panic(err)
+	}
+	return names
+}
+
+// render renders the object name of an article, which must be a valid object key outside the
+// server's own prefixes
+func (t *objectNameTemplate) render(fields ObjectNameFields) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, fields); err != nil {
+		return "", err
+	}
+	name := b.String()
+	if err := storage.ValidateObjectKey(name, storage.KeyRules{}); err != nil {
+		return "", err
+	}
+	for _, prefix := range reservedObjectPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return "", fmt.Errorf("object name %q is under %q, which holds the server's own objects", name, prefix)
+		}
+	}
+	return name, nil
+}
+
+// objectNameFields are the template fields of an article. Old-style identifiers name their year
+// and month with two digits, from 1991 on.
+func objectNameFields(id arxivid.ID, primaryCategory, objectType string) ObjectNameFields {
+	yymm := id.Number[:4]
+	century := "20"
+	if id.Scheme == arxivid.SchemeOld && yymm[:2] >= "91" {
+		century = "19"
+	}
+	return ObjectNameFields{
+		ID:              id.WithVersion(0).StorageKey(),
+		Version:         id.Version,
+		Year:            century + yymm[:2],
+		Month:           yymm[2:],
+		PrimaryCategory: primaryCategory,
+		Type:            objectType,
+	}
+}
+
+// pdfObjectName is the object name the PDF of an article is stored as
+func pdfObjectName(id arxivid.ID, primaryCategory string) (string, error) {
+	return objectNames.render(objectNameFields(id, primaryCategory, objectTypePDF))
+}
+
+// articlePrimaryCategory returns the primary category of an article for templates that use it:
+// the archive of an old-style identifier, or the category recorded in the library index, or
+// else the one the arXiv API returns
+func articlePrimaryCategory(ctx context.Context, id arxivid.ID) (string, error) {
+	if id.Scheme == arxivid.SchemeOld {
+		if id.SubjectClass != "" {
+			return id.Archive + "." + id.SubjectClass, nil
+		}
+		return id.Archive, nil
+	}
+	if globalLibrary != nil {
+		entries, err := globalLibrary.Entries(ctx)
+		if err != nil {
+			slog.Warn("Failed to look up the primary category in the library index", "article_id", id.Canonical(), "error", err)
+		}
+		for _, entry := range entries {
+			if recorded, err := arxivid.Parse(entry.ArticleID); err == nil && recorded.Base() == id.Base() &&
+				entry.Metadata != nil && entry.Metadata.PrimaryCategory != "" {
+				return entry.Metadata.PrimaryCategory, nil
+			}
+		}
+	}
+	result, err := fetchIDList(ctx, []string{id.Base()}, 1, false)
+	if err != nil {
+		return "", err
+	}
+	if len(result.Items) == 0 || result.Items[0].PrimaryCategory == "" {
+		return "", fmt.Errorf("the primary category of %s, which OPUS_MCP_OBJECT_NAME_TEMPLATE names objects by, is not known to arXiv", id.Base())
+	}
+	return result.Items[0].PrimaryCategory, nil
+}
+
+// indexedObject reports whether the library index holds an entry for an object, whose name is
+// then one the server stored an article under, whatever template was in use at the time
+func indexedObject(ctx context.Context, objectName string) bool {
+	if globalLibrary == nil || storage.ValidateObjectKey(objectName, storage.KeyRules{}) != nil {
+		return false
+	}
+	_, err := globalLibrary.Get(ctx, objectName)
+	if err != nil && !errors.Is(err, library.ErrNotFound) {
+		slog.Warn("Failed to look up object in the library index", "object", objectName, "error", err)
+	}
+	return err == nil
+}
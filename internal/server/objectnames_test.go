@@ -0,0 +1,98 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/storage"
+)
+
+func TestObjectNameTemplates(t *testing.T) {
+	tests := []struct {
+		name                string
+		template            string
+		id                  string
+		primaryCategory     string
+		want                string
+		usesPrimaryCategory bool
+	}{
+		{"Default versioned", defaultObjectNameTemplate, "2301.00001v2", "", "arxiv/2301.00001v2.pdf", false},
+		{"Default unversioned old-style", defaultObjectNameTemplate, "hep-th/9901001", "", "arxiv/hep-th_9901001.pdf", false},
+		{"By year", "arxiv/{{.Year}}/{{.ID}}.pdf", "2301.00001v2", "", "arxiv/2023/2301.00001.pdf", false},
+		{"Old-style year", "arxiv/{{.Year}}/{{.Month}}/{{.ID}}.{{.Type}}", "math.GT/0309136v1", "", "arxiv/2003/09/math.GT_0309136.pdf", false},
+		{"Last century", "arxiv/{{.Year}}/{{.ID}}.pdf", "hep-th/9901001", "", "arxiv/1999/hep-th_9901001.pdf", false},
+		{"By primary category", "{{.PrimaryCategory}}/{{.ID}}-v{{.Version}}.pdf", "2301.00001v2", "cs.CL", "cs.CL/2301.00001-v2.pdf", true},
+		{"With functions", `papers/{{replace .PrimaryCategory "." "/" | upper}}/{{.ID}}.pdf`, "2301.00001", "cs.CL", "papers/CS/CL/2301.00001.pdf", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names, err := newObjectNameTemplate(tt.template)
+			if err != nil {
+				t.Fatalf("newObjectNameTemplate() unexpected error: %v", err)
+			}
+			if names.usesPrimaryCategory != tt.usesPrimaryCategory {
+				t.Errorf("usesPrimaryCategory = %v, want %v", names.usesPrimaryCategory, tt.usesPrimaryCategory)
+			}
+			got, err := names.render(objectNameFields(arxivid.MustParse(tt.id), tt.primaryCategory, objectTypePDF))
+			if err != nil {
+				t.Fatalf("render() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidObjectNameTemplates(t *testing.T) {
+	tests := []struct {
+		name      string
+		template  string
+		wantError string
+	}{
+		{"Syntax error", "arxiv/{{.ID}.pdf", "invalid OPUS_MCP_OBJECT_NAME_TEMPLATE"},
+		{"Unknown field", "arxiv/{{.Title}}.pdf", "Title"},
+		{"Unknown function", "arxiv/{{env .ID}}.pdf", `function "env" not defined`},
+		{"Invalid key", "/arxiv/{{.ID}}.pdf", "relative path"},
+		{"Empty segment", "arxiv//{{.ID}}.pdf", "empty"},
+		{"Server's own prefix", "library/{{.ID}}.pdf", "server's own objects"},
+		{"Same name for every article", "arxiv/paper.pdf", "same name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newObjectNameTemplate(tt.template)
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("newObjectNameTemplate(%q) error = %v, want error containing %q", tt.template, err, tt.wantError)
+			}
+		})
+	}
+}
+
+// TestPlanCleanupWithIndexedArticles checks that cleanup identifies the articles of objects stored
+// under another template by the library index, not by their names
+func TestPlanCleanupWithIndexedArticles(t *testing.T) {
+	objects := []storage.ObjectInfo{
+		{Name: "cs.CL/2405.12345-v1.pdf", LastModified: cleanupNow},
+		{Name: "cs.CL/2405.12345-v2.pdf", LastModified: cleanupNow},
+		{Name: "arxiv/2405.12345v3.pdf", LastModified: cleanupNow.Add(-time.Hour)},
+	}
+	articleIDs := map[string]string{
+		"cs.CL/2405.12345-v1.pdf": "2405.12345v1",
+		"cs.CL/2405.12345-v2.pdf": "2405.12345v2",
+	}
+	plan := planCleanup(objects, articleIDs, CleanupRules{KeepLatestVersionOnly: true}, cleanupNow)
+	got := make(map[string][]string, len(plan))
+	for _, planned := range plan {
+		got[planned.ObjectName] = planned.Reasons
+	}
+	want := map[string][]string{
+		"cs.CL/2405.12345-v1.pdf": {"superseded by the later version arxiv/2405.12345v3.pdf"},
+		"cs.CL/2405.12345-v2.pdf": {"superseded by the later version arxiv/2405.12345v3.pdf"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("planCleanup() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"opus-mcp/internal/canonicaljson"
+	"opus-mcp/internal/settings"
+)
+
+// OutputConfig holds the tool output encoding configuration loaded from environment variables
+type OutputConfig struct {
+	// CanonicalJSON encodes tool outputs as canonical JSON, with sorted keys and numbers never in
+	// exponent notation, so that the outputs of two runs can be compared byte for byte
+	CanonicalJSON bool `env:"OPUS_MCP_CANONICAL_JSON,default=false"`
+	// ResponseSizeWarnBytes is the size of a serialized tool response above which the call is logged
+	// as a warning, to find the tools whose responses are worth trimming; 0 disables the warning
+	ResponseSizeWarnBytes settings.Size `env:"OPUS_MCP_RESPONSE_SIZE_WARN_BYTES,default=1MiB"`
+	// TokensPerByte converts the serialized size of entries into an estimate of the tokens they take
+	// up in a client's context, for the maxTokensHint argument of the category fetch tool
+	TokensPerByte float64 `env:"OPUS_MCP_TOKENS_PER_BYTE,default=0.25"`
+}
+
+// Validate checks that the token estimate is positive
+func (c *OutputConfig) Validate() error {
+	if c.TokensPerByte <= 0 {
+		return fmt.Errorf("OPUS_MCP_TOKENS_PER_BYTE must be positive, got %v", c.TokensPerByte)
+	}
+	return nil
+}
+
+// LoadOutputConfig loads the tool output encoding configuration from environment variables
+func LoadOutputConfig() (*OutputConfig, error) {
+	var config OutputConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process output configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// canonicalJSONOutput makes tool outputs, both text and structured content, canonical JSON
+var canonicalJSONOutput = false
+
+// marshalOutput encodes a tool output, as canonical JSON when so configured
+func marshalOutput(output any) ([]byte, error) {
+	if canonicalJSONOutput {
+		return canonicaljson.Marshal(output)
+	}
+	return json.Marshal(output)
+}
+
+// canonicalOutput is a tool output together with its canonical JSON encoding, which is what the
+// MCP SDK sends when it encodes the output as structured content
+type canonicalOutput struct {
+	output any
+	data   []byte
+}
+
+// MarshalJSON returns the canonical encoding, which encoding/json leaves unchanged
+func (c canonicalOutput) MarshalJSON() ([]byte, error) {
+	return c.data, nil
+}
+
+// structuredOutput returns the structured content of a tool result for an output and its encoding
+func structuredOutput(output any, data []byte) any {
+	if canonicalJSONOutput {
+		return canonicalOutput{output: output, data: data}
+	}
+	return output
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// TestCanonicalJSONOutput checks that in canonical mode the text and structured content of a tool
+// result are the same canonical JSON, and that the structured content still unwraps to the output
+func TestCanonicalJSONOutput(t *testing.T) {
+	original := canonicalJSONOutput
+	t.Cleanup(func() { canonicalJSONOutput = original })
+
+	type output struct {
+		Zeta  string            `json:"zeta"`
+		Alpha float64           `json:"alpha"`
+		Map   map[string]string `json:"map"`
+	}
+	handler := newTestToolHandler(t, func(ctx context.Context, input json.RawMessage) (any, error) {
+		return output{Zeta: "<z>", Alpha: 1e21, Map: map[string]string{"b": "2", "a": "1"}}, nil
+	})
+	handler.schemaVersion = 3
+
+	for _, tc := range []struct {
+		canonical bool
+		want      string
+	}{
+		{false, `{"schemaVersion":3,"zeta":"\u003cz\u003e","alpha":1e+21,"map":{"a":"1","b":"2"}}`},
+		{true, `{"alpha":1000000000000000000000,"map":{"a":"1","b":"2"},"schemaVersion":3,"zeta":"\u003cz\u003e"}`},
+	} {
+		canonicalJSONOutput = tc.canonical
+		result, err := handler.Handle(context.Background(), newTestCallToolRequest("test_tool", `{}`))
+		if err != nil || result.IsError {
+			t.Fatalf("Handle() = %v, %v, want a successful result", result, err)
+		}
+		if got := resultText(t, result); got != tc.want {
+			t.Errorf("canonical %v: text content = %s, want %s", tc.canonical, got, tc.want)
+		}
+		structured, err := json.Marshal(result.StructuredContent)
+		if err != nil {
+			t.Fatalf("failed to marshal structured content: %v", err)
+		}
+		if string(structured) != tc.want {
+			t.Errorf("canonical %v: structured content = %s, want %s", tc.canonical, structured, tc.want)
+		}
+		if _, ok := unwrapOutput(result.StructuredContent).(output); !ok {
+			t.Errorf("canonical %v: unwrapped structured content is %T, want the handler's output", tc.canonical, unwrapOutput(result.StructuredContent))
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// FeedPagination is where a page of arXiv API results lies in the whole result set, as reported by
+// the OpenSearch elements of the feed
+type FeedPagination struct {
+	TotalResults int `json:"totalResults" jsonschema:"The number of entries arXiv matched for the query, over all pages"`
+	StartIndex   int `json:"startIndex" jsonschema:"The 0-based index of the first entry of this page in the whole result set"`
+	ItemsPerPage int `json:"itemsPerPage" jsonschema:"The number of entries arXiv was asked for per page"`
+	// NextStartIndex follows from the entries arXiv returned, which can be fewer than itemsPerPage
+	NextStartIndex int `json:"nextStartIndex,omitempty" jsonschema:"The startIndex of the next page, counting every entry arXiv returned on this page, including entries left out of the result by collapseRevisions or maxTokensHint; absent on the last page"`
+}
+
+// feedPagination reads the OpenSearch totalResults, startIndex and itemsPerPage of an arXiv feed,
+// or returns nil if the feed does not have all of them, e.g., when it did not come from a search
+func feedPagination(feed *gofeed.Feed) *FeedPagination {
+	values := make(map[string]int, 3)
+	for _, name := range []string{"totalResults", "startIndex", "itemsPerPage"} {
+		extensions := feed.Extensions["opensearch"][name]
+		if len(extensions) == 0 {
+			return nil
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(extensions[0].Value))
+		if err != nil || value < 0 {
+			return nil
+		}
+		values[name] = value
+	}
+	pagination := &FeedPagination{
+		TotalResults: values["totalResults"],
+		StartIndex:   values["startIndex"],
+		ItemsPerPage: values["itemsPerPage"],
+	}
+	// arXiv returns an empty page past the end of the results, so an empty page is the last
+	if next := pagination.StartIndex + len(feed.Items); len(feed.Items) > 0 && next < pagination.TotalResults {
+		pagination.NextStartIndex = next
+	}
+	return pagination
+}
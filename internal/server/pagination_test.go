@@ -0,0 +1,52 @@
+package server
+
+import (
+	"os"
+	"testing"
+)
+
+// paginatedFeed is an arXiv feed of the second page of a search with 25 results, two of which
+// were returned on the page
+const paginatedFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:opensearch="http://a9.com/-/spec/opensearch/1.1/">
+  <title>ArXiv Query</title>
+  <opensearch:totalResults>25</opensearch:totalResults>
+  <opensearch:startIndex>10</opensearch:startIndex>
+  <opensearch:itemsPerPage>10</opensearch:itemsPerPage>
+  <entry><id>http://arxiv.org/abs/2410.01234v1</id><title>One</title></entry>
+  <entry><id>http://arxiv.org/abs/2410.01235v1</id><title>Two</title></entry>
+</feed>`
+
+func TestFeedPagination(t *testing.T) {
+	result, err := parseCategoryFeed([]byte(paginatedFeed), true)
+	if err != nil {
+		t.Fatalf("parseCategoryFeed() unexpected error: %v", err)
+	}
+	want := FeedPagination{TotalResults: 25, StartIndex: 10, ItemsPerPage: 10, NextStartIndex: 12}
+	if result.Pagination == nil || *result.Pagination != want {
+		t.Errorf("pagination = %+v, want %+v", result.Pagination, want)
+	}
+
+	// The last page has no next page
+	body, err := os.ReadFile("testdata/feed_with_revisions.atom")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	result, err = parseCategoryFeed(body, true)
+	if err != nil {
+		t.Fatalf("parseCategoryFeed() unexpected error: %v", err)
+	}
+	want = FeedPagination{TotalResults: 3, StartIndex: 0, ItemsPerPage: 10}
+	if result.Pagination == nil || *result.Pagination != want {
+		t.Errorf("pagination = %+v, want %+v", result.Pagination, want)
+	}
+
+	// Feeds without OpenSearch elements have no pagination
+	result, err = parseCategoryFeed([]byte(idListFeed([]string{"2410.01234"})), true)
+	if err != nil {
+		t.Fatalf("parseCategoryFeed() unexpected error: %v", err)
+	}
+	if result.Pagination != nil {
+		t.Errorf("pagination = %+v, want none for a feed without OpenSearch elements", result.Pagination)
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/storage"
+)
+
+// globalLibrary is the index of stored articles; nil when S3 storage is not configured
+var globalLibrary *library.Library
+
+// urlUploader downloads a URL and stores it in S3; replaced in tests
+var urlUploader = storage.DownloadURLToS3
+
+// downloadProvenance builds the provenance record of a download from the current tool call and,
+// when the session's recent queries returned the article, the query that led to it. The article ID
+// is the unversioned arXiv identifier, or empty for downloads that are not arXiv articles.
+func downloadProvenance(ctx context.Context, articleID string, now time.Time) *library.Provenance {
+	provenance := &library.Provenance{Timestamp: now.UTC().Format(time.RFC3339)}
+	info, ok := callInfoFrom(ctx)
+	if !ok {
+		return provenance
+	}
+	provenance.Tool = info.Tool
+	provenance.SessionID = info.SessionID
+	provenance.Client = info.Client
+	provenance.ClientID = info.ClientID
+	if info.tracked && articleID != "" {
+		if query, found := recentQueries.findArticle(info.SessionID, articleID); found {
+			provenance.QueryTool = query.Tool
+			provenance.Query = query.Query
+			provenance.IDList = query.IDList
+		}
+	}
+	return provenance
+}
+
+// provenanceMetadata converts a provenance record to S3 user metadata, omitting empty values. The
+// uploader encodes and truncates the values to fit S3 limits; the library index keeps them in full.
+func provenanceMetadata(provenance *library.Provenance) map[string]string {
+	metadata := map[string]string{}
+	add := func(key, value string) {
+		if value != "" {
+			metadata["provenance-"+key] = value
+		}
+	}
+	add("tool", provenance.Tool)
+	add("query-tool", provenance.QueryTool)
+	add("query", provenance.Query)
+	add("id-list", strings.Join(provenance.IDList, ","))
+	add("session", provenance.SessionID)
+	add("client", provenance.Client)
+	add("client-id", provenance.ClientID)
+	add("timestamp", provenance.Timestamp)
+	return metadata
+}
+
+// provenanceFromMetadata reads back a provenance record from the S3 user metadata written by
+// provenanceMetadata, which may have been truncated. It returns nil if the object has none.
+func provenanceFromMetadata(metadata map[string]string) *library.Provenance {
+	provenance := &library.Provenance{
+		Tool:      metadata["provenance-tool"],
+		QueryTool: metadata["provenance-query-tool"],
+		Query:     metadata["provenance-query"],
+		SessionID: metadata["provenance-session"],
+		Client:    metadata["provenance-client"],
+		ClientID:  metadata["provenance-client-id"],
+		Timestamp: metadata["provenance-timestamp"],
+	}
+	if idList := metadata["provenance-id-list"]; idList != "" {
+		provenance.IDList = strings.Split(idList, ",")
+	}
+	if provenance.Timestamp == "" {
+		// Objects stored before provenance was recorded still have their download date
+		if downloaded, err := time.Parse(time.RFC3339, metadata["download-date"]); err == nil {
+			provenance.Timestamp = downloaded.UTC().Format(time.RFC3339)
+		}
+	}
+	if provenance.Tool == "" && provenance.Timestamp == "" {
+		return nil
+	}
+	return provenance
+}
+
+// LibraryProvenanceArgs defines the input parameters for looking up the provenance of a stored article
+type LibraryProvenanceArgs struct {
+	ObjectName string `json:"objectName" jsonschema:"The name/path of the object in the bucket, e.g., arxiv/2405.12345.pdf"`
+}
+
+// LibraryProvenanceOutput defines the output structure for the provenance lookup
+type LibraryProvenanceOutput struct {
+	Found bool           `json:"found" jsonschema:"Whether the object has an entry in the library index"`
+	Entry *library.Entry `json:"entry,omitempty" jsonschema:"The library index entry of the object, including its provenance"`
+	// Summary is the content of the object named by the entry's summary
+	Summary string `json:"summary,omitempty" jsonschema:"The generated Markdown summary of the article, when one is stored"`
+}
+
+// libraryProvenance returns the library index entry, including provenance, of a stored object
+func libraryProvenance(ctx context.Context, input json.RawMessage) (any, error) {
+	var args LibraryProvenanceArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+	if globalLibrary == nil {
+		return nil, fmt.Errorf("library index not available. Please ensure S3 storage is configured")
+	}
+	if err := storage.ValidateObjectKey(args.ObjectName, storage.KeyRules{}); err != nil {
+		if keyErr := objectKeyToolError("objectName", err); keyErr != nil {
+			return nil, keyErr
+		}
+		return nil, err
+	}
+	entry, err := globalLibrary.Get(ctx, args.ObjectName)
+	if errors.Is(err, library.ErrNotFound) {
+		return LibraryProvenanceOutput{Found: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	output := LibraryProvenanceOutput{Found: true, Entry: &entry}
+	if entry.Summary != "" {
+		// The entry is still worth returning without its summary
+		if data, _, err := objectRangeReader(ctx, entry.Summary, 0, maxObjectChunkLength); err != nil {
+			slog.Warn("Failed to read article summary", "object", entry.Summary, "error", err)
+		} else {
+			output.Summary = string(data)
+		}
+	}
+	return output, nil
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/storage"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/minio/minio-go/v7"
+	"github.com/mmcdole/gofeed"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestRecentQueryTrackerBounds(t *testing.T) {
+	tracker := newRecentQueryTracker(2, 2)
+	now := time.Now()
+	tracker.record("a", recentQuery{Query: "q1", ArticleIDs: []string{"2401.00001"}, Time: now})
+	tracker.record("a", recentQuery{Query: "q2", ArticleIDs: []string{"2401.00002"}, Time: now.Add(time.Second)})
+	tracker.record("a", recentQuery{Query: "q3", ArticleIDs: []string{"2401.00002"}, Time: now.Add(2 * time.Second)})
+
+	// The oldest query of the session has been evicted
+	if _, found := tracker.findArticle("a", "2401.00001"); found {
+		t.Error("oldest query should have been evicted from the session ring")
+	}
+	// The most recent matching query wins
+	if query, found := tracker.findArticle("a", "2401.00002"); !found || query.Query != "q3" {
+		t.Errorf("findArticle() = %+v, %v, want q3", query, found)
+	}
+
+	// Adding a third session evicts the least recently used one
+	tracker.record("b", recentQuery{Query: "b1", Time: now.Add(3 * time.Second)})
+	tracker.record("c", recentQuery{Query: "c1", Time: now.Add(4 * time.Second)})
+	if _, ok := tracker.sessions["a"]; ok {
+		t.Error("least recently used session should have been evicted")
+	}
+	if len(tracker.sessions) != 2 {
+		t.Errorf("tracker holds %d sessions, want 2", len(tracker.sessions))
+	}
+}
+
+func TestDownloadRecordsProvenanceFromSessionQuery(t *testing.T) {
+	withUnlimitedArxiv(t)
+	originalConfig, originalLibrary, originalUploader, originalTracker := globalS3Config, globalLibrary, urlUploader, recentQueries
+	t.Cleanup(func() {
+		globalS3Config, globalLibrary, urlUploader, recentQueries = originalConfig, originalLibrary, originalUploader, originalTracker
+	})
+
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	globalLibrary = library.New(&library.MemoryStore{})
+	recentQueries = newRecentQueryTracker(recentQueriesPerSession, recentQuerySessions)
+	// In-memory sessions have no ID, like stdio sessions
+	recentQueries.trackAnonymous = true
+
+	var uploadedMetadata map[string]string
+	urlUploader = func(ctx context.Context, sourceURL string, config *storage.S3Config, bucketName, objectName string, metadata map[string]string, policy storage.CollisionPolicy) (storage.UploadResult, error) {
+		uploadedMetadata = metadata
+		return storage.UploadResult{UploadInfo: minio.UploadInfo{Bucket: bucketName, Key: objectName, Size: 42}}, nil
+	}
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test-server", Version: "v0.0.1"}, nil)
+
+	// A stand-in for the category fetch tool that returns a fixed feed without calling arXiv
+	fetchHandler := newTestToolHandler(t, func(ctx context.Context, input json.RawMessage) (any, error) {
+		return processFeed(&gofeed.Feed{Items: []*gofeed.Item{
+			{Link: "http://arxiv.org/abs/2405.12345v1"},
+			{Link: "http://arxiv.org/abs/2405.54321v2"},
+		}}, feedEntryStages...), nil
+	})
+	fetchHandler.describeQuery = describeCategoryFetch
+	server.AddTool(&mcp.Tool{Name: "arxiv_category_fetch_latest", InputSchema: &jsonschema.Schema{Type: "object"}}, fetchHandler.Handle)
+
+	downloadHandler := newTestToolHandler(t, downloadPDFToS3)
+	server.AddTool(&mcp.Tool{Name: "arxiv_download_pdf", InputSchema: &jsonschema.Schema{Type: "object"}}, downloadHandler.Handle)
+
+	ctx := context.Background()
+	clientTransport, serverTransport := mcp.NewInMemoryTransports()
+	serverSession, err := server.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect server: %v", err)
+	}
+	defer serverSession.Close()
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.2.3"}, nil)
+	clientSession, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect client: %v", err)
+	}
+	defer clientSession.Close()
+
+	callTool := func(name string, arguments map[string]any) {
+		t.Helper()
+		result, err := clientSession.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: arguments})
+		if err != nil {
+			t.Fatalf("CallTool(%s) failed: %v", name, err)
+		}
+		if result.IsError {
+			t.Fatalf("CallTool(%s) returned an error result: %+v", name, result.Content)
+		}
+	}
+
+	callTool("arxiv_category_fetch_latest", map[string]any{"category": "cs.AI or cs.LG"})
+	callTool("arxiv_download_pdf", map[string]any{"articleId": "arXiv:2405.54321v2"})
+
+	entry, err := globalLibrary.Get(ctx, "arxiv/2405.54321v2.pdf")
+	if err != nil {
+		t.Fatalf("library entry missing after download: %v", err)
+	}
+	provenance := entry.Provenance
+	if provenance == nil {
+		t.Fatal("library entry has no provenance")
+	}
+	if provenance.Tool != "arxiv_download_pdf" {
+		t.Errorf("provenance tool = %q, want arxiv_download_pdf", provenance.Tool)
+	}
+	if provenance.QueryTool != "arxiv_category_fetch_latest" || provenance.Query != "cs.AI or cs.LG" {
+		t.Errorf("provenance query = %q via %q, want the earlier category fetch", provenance.Query, provenance.QueryTool)
+	}
+	if provenance.Client != "test-client/1.2.3" {
+		t.Errorf("provenance client = %q, want test-client/1.2.3", provenance.Client)
+	}
+	if _, err := time.Parse(time.RFC3339, provenance.Timestamp); err != nil {
+		t.Errorf("provenance timestamp %q is not RFC 3339: %v", provenance.Timestamp, err)
+	}
+	if uploadedMetadata["provenance-query"] != "cs.AI or cs.LG" || uploadedMetadata["provenance-tool"] != "arxiv_download_pdf" {
+		t.Errorf("object metadata = %v, want provenance query and tool", uploadedMetadata)
+	}
+
+	// An article that no query in the session returned has no determinable query
+	callTool("arxiv_download_pdf", map[string]any{"articleId": "2401.99999"})
+	entry, err = globalLibrary.Get(ctx, "arxiv/2401.99999.pdf")
+	if err != nil {
+		t.Fatalf("library entry missing after download: %v", err)
+	}
+	if entry.Provenance.Query != "" || entry.Provenance.Tool != "arxiv_download_pdf" {
+		t.Errorf("provenance = %+v, want tool only without a query", entry.Provenance)
+	}
+
+	// The provenance tool returns the recorded entry
+	output, err := libraryProvenance(ctx, json.RawMessage(`{"objectName":"arxiv/2405.54321v2.pdf"}`))
+	if err != nil {
+		t.Fatalf("libraryProvenance() unexpected error: %v", err)
+	}
+	if got := output.(LibraryProvenanceOutput); !got.Found || got.Entry.Provenance.Query != "cs.AI or cs.LG" {
+		t.Errorf("libraryProvenance() = %+v, want the recorded entry", got)
+	}
+	output, err = libraryProvenance(ctx, json.RawMessage(`{"objectName":"arxiv/unknown.pdf"}`))
+	if err != nil {
+		t.Fatalf("libraryProvenance() unexpected error: %v", err)
+	}
+	if output.(LibraryProvenanceOutput).Found {
+		t.Error("libraryProvenance() reported an unknown object as found")
+	}
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"opus-mcp/internal/canonicaljson"
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/metrics"
+	"opus-mcp/internal/settings"
+	"opus-mcp/internal/storage"
+)
+
+// ErrCodeQuotaExceeded means the daily ceiling on arXiv requests has been reached
+const ErrCodeQuotaExceeded = "QUOTA_EXCEEDED"
+
+// arxivQuotaObjectName is the object in the articles bucket holding the count of today's arXiv
+// requests, so that a restart does not reset it
+const arxivQuotaObjectName = "state/arxiv-quota.json"
+
+// Kinds of arXiv requests counted by the daily quota
+const (
+	arxivRequestAPI     = "api"
+	arxivRequestPDF     = "pdf"
+	arxivRequestAbsPage = "abs"
+)
+
+// ArxivQuotaConfig holds the daily ceiling on requests to arXiv
+type ArxivQuotaConfig struct {
+	// DailyLimit caps the arXiv API queries, abs page fetches and PDF downloads made per UTC day; 0
+	// means unlimited
+	DailyLimit int `env:"OPUS_MCP_ARXIV_DAILY_LIMIT,default=0"`
+}
+
+// Validate checks that the daily limit is not negative
+func (c *ArxivQuotaConfig) Validate() error {
+	if c.DailyLimit < 0 {
+		return fmt.Errorf("OPUS_MCP_ARXIV_DAILY_LIMIT cannot be negative, got %d", c.DailyLimit)
+	}
+	return nil
+}
+
+// LoadArxivQuotaConfig loads the arXiv quota configuration from environment variables
+func LoadArxivQuotaConfig() (*ArxivQuotaConfig, error) {
+	var config ArxivQuotaConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process arXiv quota configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// dailyQuota counts the requests made to arXiv in the current UTC day and, with a limit, refuses
+// further requests until the day rolls over. arXiv asks bulk users to stay modest beyond the
+// spacing that the arXiv rate limiter enforces between requests.
+type dailyQuota struct {
+	mu    sync.Mutex
+	limit int
+	day   string
+	used  int
+	now   func() time.Time
+	// store, when set, keeps the count across restarts
+	store library.Store
+	// persistMu orders saves, so that an older count never overwrites a newer one
+	persistMu sync.Mutex
+}
+
+// quotaState is the persisted count of a day's arXiv requests
+type quotaState struct {
+	Day  string `json:"day"`
+	Used int    `json:"used"`
+}
+
+// ArxivQuotaStatus reports the arXiv requests made today against the daily limit
+type ArxivQuotaStatus struct {
+	Day       string `json:"day"`
+	Used      int    `json:"used"`
+	Limit     int    `json:"limit"`
+	Remaining *int   `json:"remaining,omitempty"`
+	ResetsAt  string `json:"resetsAt"`
+}
+
+// newDailyQuota creates a quota of limit arXiv requests per UTC day, unlimited if limit is 0
+func newDailyQuota(limit int, store library.Store, now func() time.Time) *dailyQuota {
+	return &dailyQuota{limit: limit, store: store, now: now, day: now().UTC().Format(time.DateOnly)}
+}
+
+// arxivQuota is the daily quota shared by every arXiv-bound request
+var arxivQuota = newDailyQuota(0, nil, correctedNow)
+
+func init() {
+	metrics.NewGaugeFunc("arxiv_requests_today", "Requests made to arXiv in the current UTC day.", func() float64 {
+		return float64(arxivQuota.status().Used)
+	})
+	metrics.NewGaugeFunc("arxiv_requests_remaining_today", "Requests to arXiv left in the current UTC day, or -1 without a daily limit.", func() float64 {
+		if remaining := arxivQuota.status().Remaining; remaining != nil {
+			return float64(*remaining)
+		}
+		return -1
+	})
+}
+
+// rollover starts a new count when the UTC day has changed; the caller holds mu
+func (q *dailyQuota) rollover(now time.Time) {
+	if day := now.UTC().Format(time.DateOnly); day != q.day {
+		q.day = day
+		q.used = 0
+	}
+}
+
+// resetsAt returns when the count of the given time's day rolls over
+func resetsAt(now time.Time) time.Time {
+	year, month, day := now.UTC().Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC)
+}
+
+// exceeded returns the error refusing a request once the limit is reached; the caller holds mu
+func (q *dailyQuota) exceeded(now time.Time) *ToolError {
+	if q.limit == 0 || q.used < q.limit {
+		return nil
+	}
+	reset := resetsAt(now)
+	toolErr := &ToolError{
+		Code:    ErrCodeQuotaExceeded,
+		Message: fmt.Sprintf("the daily limit of %d arXiv requests has been reached", q.limit),
+		Details: map[string]any{
+			"limit":    q.limit,
+			"used":     q.used,
+			"resetsAt": reset.Format(time.RFC3339),
+		},
+	}
+	return toolErr.withRetryAt(reset.Sub(now), now)
+}
+
+// check returns an error if no arXiv request can be made today, without counting one
+func (q *dailyQuota) check() *ToolError {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := q.now()
+	q.rollover(now)
+	return q.exceeded(now)
+}
+
+// take counts an arXiv request of the given kind about to be made, or returns an error refusing it
+// once the limit is reached
+func (q *dailyQuota) take(ctx context.Context, kind string) error {
+	q.mu.Lock()
+	now := q.now()
+	q.rollover(now)
+	if quotaErr := q.exceeded(now); quotaErr != nil {
+		q.mu.Unlock()
+		return quotaErr
+	}
+	q.used++
+	q.mu.Unlock()
+
+	metrics.ArxivRequestsTotal.WithLabelValues(kind).Inc()
+	q.persist(ctx)
+	return nil
+}
+
+// takeArxivTurn waits for the turn of a request of the given kind on the arXiv rate limiter, and
+// counts it against the daily quota only once the turn has come, so that requests refused by the
+// limiter or cancelled while waiting are not counted. A used up quota is refused without waiting.
+func takeArxivTurn(ctx context.Context, kind string) error {
+	if quotaErr := arxivQuota.check(); quotaErr != nil {
+		return quotaErr
+	}
+	if err := waitForArxiv(ctx); err != nil {
+		return fmt.Errorf("rate limiter error: %w", err)
+	}
+	return arxivQuota.take(ctx, kind)
+}
+
+// persist saves the current count to the store, if any. The count is read once the previous save
+// is done, so that saves land in order.
+func (q *dailyQuota) persist(ctx context.Context) {
+	if q.store == nil {
+		return
+	}
+	q.persistMu.Lock()
+	defer q.persistMu.Unlock()
+
+	q.mu.Lock()
+	state := quotaState{Day: q.day, Used: q.used}
+	q.mu.Unlock()
+
+	data, err := canonicaljson.Marshal(state)
+	if err == nil {
+		err = q.store.Save(ctx, data)
+	}
+	if err != nil {
+		// The count is still enforced until the server restarts
+		slog.Warn("Failed to save the arXiv request count", "error", err)
+	}
+}
+
+// restore loads the count saved in the store, if it is of the current day
+func (q *dailyQuota) restore(ctx context.Context) error {
+	if q.store == nil {
+		return nil
+	}
+	data, err := q.store.Load(ctx)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load the arXiv request count: %w", err)
+	}
+	var state quotaState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse the arXiv request count: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover(q.now())
+	if state.Day == q.day {
+		q.used = max(q.used, state.Used)
+	}
+	return nil
+}
+
+// status reports the count of the current day
+func (q *dailyQuota) status() ArxivQuotaStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := q.now()
+	q.rollover(now)
+	status := ArxivQuotaStatus{
+		Day:      q.day,
+		Used:     q.used,
+		Limit:    q.limit,
+		ResetsAt: resetsAt(now).Format(time.RFC3339),
+	}
+	if q.limit > 0 {
+		remaining := max(0, q.limit-q.used)
+		status.Remaining = &remaining
+	}
+	return status
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/library"
+
+	"golang.org/x/time/rate"
+)
+
+func TestDailyQuotaRollsOverAtUTCMidnight(t *testing.T) {
+	ctx := context.Background()
+	clock := &testClock{now: time.Date(2024, 11, 7, 22, 30, 0, 0, time.UTC)}
+	quota := newDailyQuota(2, nil, clock.Now)
+
+	for range 2 {
+		if err := quota.take(ctx, arxivRequestAPI); err != nil {
+			t.Fatalf("take() within the limit unexpected error: %v", err)
+		}
+	}
+	err := quota.take(ctx, arxivRequestPDF)
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeQuotaExceeded {
+		t.Fatalf("take() beyond the limit error = %v, want %s", err, ErrCodeQuotaExceeded)
+	}
+	if toolErr.Details["resetsAt"] != "2024-11-08T00:00:00Z" || toolErr.RetryAfterSeconds != 90*60 || !toolErr.Retryable {
+		t.Errorf("quota error = %+v, want a retryable error resetting at the next UTC midnight", toolErr)
+	}
+	if toolErr.Details["retryAt"] != "2024-11-08T00:00:00Z" || !strings.HasSuffix(toolErr.Message, "retry after 2024-11-08T00:00:00Z") {
+		t.Errorf("quota error = %+v, want the reset as the retry time", toolErr)
+	}
+	if quota.check() == nil {
+		t.Error("check() with the quota used up = nil, want an error")
+	}
+	status := quota.status()
+	if status.Used != 2 || status.Remaining == nil || *status.Remaining != 0 || status.Day != "2024-11-07" {
+		t.Errorf("status() = %+v, want 2 used and none remaining on 2024-11-07", status)
+	}
+
+	// The count starts over with the UTC day
+	clock.Advance(91 * time.Minute)
+	if err := quota.take(ctx, arxivRequestAPI); err != nil {
+		t.Fatalf("take() after midnight UTC unexpected error: %v", err)
+	}
+	if status := quota.status(); status.Day != "2024-11-08" || status.Used != 1 || status.ResetsAt != "2024-11-09T00:00:00Z" {
+		t.Errorf("status() after rollover = %+v, want 1 used on 2024-11-08", status)
+	}
+}
+
+func TestDailyQuotaUnlimited(t *testing.T) {
+	quota := newDailyQuota(0, nil, time.Now)
+	for range 5 {
+		if err := quota.take(context.Background(), arxivRequestAPI); err != nil {
+			t.Fatalf("take() without a limit unexpected error: %v", err)
+		}
+	}
+	if status := quota.status(); status.Used != 5 || status.Remaining != nil {
+		t.Errorf("status() without a limit = %+v, want 5 used and no remaining count", status)
+	}
+}
+
+// TestDailyQuotaSurvivesRestart simulates restarts by creating new quotas over the same store
+func TestDailyQuotaSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	store := &library.MemoryStore{}
+	clock := &testClock{now: time.Date(2024, 11, 7, 10, 0, 0, 0, time.UTC)}
+	first := newDailyQuota(3, store, clock.Now)
+	for range 3 {
+		if err := first.take(ctx, arxivRequestPDF); err != nil {
+			t.Fatalf("take() unexpected error: %v", err)
+		}
+	}
+
+	second := newDailyQuota(3, store, clock.Now)
+	if err := second.restore(ctx); err != nil {
+		t.Fatalf("restore() unexpected error: %v", err)
+	}
+	if err := second.take(ctx, arxivRequestAPI); err == nil {
+		t.Error("take() after a restart on the same day should fail with the quota used up")
+	}
+
+	// A count saved on a previous day is not carried over
+	clock.Advance(24 * time.Hour)
+	third := newDailyQuota(3, store, clock.Now)
+	if err := third.restore(ctx); err != nil {
+		t.Fatalf("restore() unexpected error: %v", err)
+	}
+	if status := third.status(); status.Used != 0 {
+		t.Errorf("status() after a restart on the next day = %+v, want nothing used", status)
+	}
+	if err := third.take(ctx, arxivRequestAPI); err != nil {
+		t.Errorf("take() on the next day unexpected error: %v", err)
+	}
+}
+
+func TestDailyQuotaSavesLatestCount(t *testing.T) {
+	ctx := context.Background()
+	store := &library.MemoryStore{}
+	quota := newDailyQuota(0, store, time.Now)
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := quota.take(ctx, arxivRequestAPI); err != nil {
+				t.Errorf("take() unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	restored := newDailyQuota(0, store, time.Now)
+	if err := restored.restore(ctx); err != nil {
+		t.Fatalf("restore() unexpected error: %v", err)
+	}
+	if status := restored.status(); status.Used != 20 {
+		t.Errorf("status() after restore = %+v, want the last of 20 counts saved", status)
+	}
+}
+
+func TestTakeArxivTurnCountsOnlyGrantedRequests(t *testing.T) {
+	originalQuota, originalDeps := arxivQuota, toolDeps
+	t.Cleanup(func() { arxivQuota, toolDeps = originalQuota, originalDeps })
+	arxivQuota = newDailyQuota(0, nil, time.Now)
+	deps := *originalDeps
+	// The only request of the hour has been made
+	deps.ArxivLimiter = rate.NewLimiter(rate.Every(time.Hour), 1)
+	deps.ArxivLimiter.Allow()
+	toolDeps = &deps
+
+	refusedCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := takeArxivTurn(refusedCtx, arxivRequestAPI)
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeRateLimited {
+		t.Errorf("takeArxivTurn() error = %v, want %s", err, ErrCodeRateLimited)
+	}
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := takeArxivTurn(cancelledCtx, arxivRequestAPI); !errors.Is(err, context.Canceled) {
+		t.Errorf("takeArxivTurn() with a cancelled context error = %v, want %v", err, context.Canceled)
+	}
+	if used := arxivQuota.status().Used; used != 0 {
+		t.Errorf("requests counted = %d, want none for requests that were not made", used)
+	}
+
+	toolDeps.ArxivLimiter = rate.NewLimiter(rate.Inf, 1)
+	if err := takeArxivTurn(context.Background(), arxivRequestAPI); err != nil {
+		t.Fatalf("takeArxivTurn() unexpected error: %v", err)
+	}
+	if used := arxivQuota.status().Used; used != 1 {
+		t.Errorf("requests counted = %d, want the granted request", used)
+	}
+}
+
+// TestFetchByIDReportsQuotaExceeded checks that arXiv-bound tools are refused without a request
+// once the quota is used up
+func TestFetchByIDReportsQuotaExceeded(t *testing.T) {
+	original := arxivQuota
+	t.Cleanup(func() { arxivQuota = original })
+	arxivQuota = newDailyQuota(1, nil, time.Now)
+	if err := arxivQuota.take(context.Background(), arxivRequestAPI); err != nil {
+		t.Fatalf("take() unexpected error: %v", err)
+	}
+
+	_, err := fetchIDList(context.Background(), []string{"2405.12345", "2405.12346"}, 1, false)
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeQuotaExceeded {
+		t.Errorf("fetchIDList() error = %v, want %s", err, ErrCodeQuotaExceeded)
+	}
+}
+
+// TestServerStatusReportsQuota checks that clients can see how much of the daily quota is left
+// before making arXiv-bound calls
+func TestServerStatusReportsQuota(t *testing.T) {
+	original := arxivQuota
+	t.Cleanup(func() { arxivQuota = original })
+	arxivQuota = newDailyQuota(5, nil, time.Now)
+	for range 2 {
+		if err := arxivQuota.take(context.Background(), arxivRequestAPI); err != nil {
+			t.Fatalf("take() unexpected error: %v", err)
+		}
+	}
+
+	result, err := serverStatus(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("serverStatus() unexpected error: %v", err)
+	}
+	quota := result.(ServerStatusOutput).ArxivQuota
+	if quota.Used != 2 || quota.Limit != 5 || quota.Remaining == nil || *quota.Remaining != 3 {
+		t.Errorf("server status quota = %+v, want 2 used and 3 remaining of 5", quota)
+	}
+}
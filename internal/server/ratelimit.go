@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"opus-mcp/internal/settings"
+
+	"golang.org/x/time/rate"
+)
+
+// arxivMinInterval is the spacing of requests the arXiv API terms of use ask for, see:
+// https://info.arxiv.org/help/api/tou.html
+const arxivMinInterval = 3 * time.Second
+
+// arxivSlowWait is the wait for the arXiv rate limiter above which it is logged
+const arxivSlowWait = 500 * time.Millisecond
+
+// isArxivHost reports whether a host name is arxiv.org or one of its subdomains, e.g.,
+// export.arxiv.org, all of which share the arXiv rate limit
+func isArxivHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	return host == "arxiv.org" || strings.HasSuffix(host, ".arxiv.org")
+}
+
+// ArxivRateConfig holds the arXiv rate limit loaded from environment variables
+type ArxivRateConfig struct {
+	// Interval is the spacing of requests to arXiv
+	Interval settings.Duration `env:"OPUS_MCP_ARXIV_RATE_INTERVAL,default=3s"`
+	// Burst is the number of requests that may be made at once after a quiet period
+	Burst int `env:"OPUS_MCP_ARXIV_RATE_BURST,default=1"`
+	// Unsafe allows a limit exceeding the arXiv terms of use, for a mock server in tests or an
+	// institutional mirror
+	Unsafe bool `env:"OPUS_MCP_ARXIV_RATE_UNSAFE,default=false"`
+}
+
+// Validate reports the problems of the rate limit together, refusing a limit exceeding the arXiv
+// terms of use unless it is explicitly marked unsafe
+func (c *ArxivRateConfig) Validate() error {
+	var errs []error
+	if c.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("OPUS_MCP_ARXIV_RATE_INTERVAL must be positive, got %s", c.Interval))
+	} else if c.Interval.Duration() < arxivMinInterval && !c.Unsafe {
+		errs = append(errs, fmt.Errorf("OPUS_MCP_ARXIV_RATE_INTERVAL of %s is below the %s the arXiv terms of use ask for; set OPUS_MCP_ARXIV_RATE_UNSAFE=true to allow it", c.Interval, arxivMinInterval))
+	}
+	if c.Burst < 1 {
+		errs = append(errs, fmt.Errorf("OPUS_MCP_ARXIV_RATE_BURST must be at least 1, got %d", c.Burst))
+	} else if c.Burst > 1 && !c.Unsafe {
+		// A burst sends requests without the spacing the terms of use ask for
+		errs = append(errs, fmt.Errorf("OPUS_MCP_ARXIV_RATE_BURST of %d exceeds the single request the arXiv terms of use allow at once; set OPUS_MCP_ARXIV_RATE_UNSAFE=true to allow it", c.Burst))
+	}
+	return errors.Join(errs...)
+}
+
+// LoadArxivRateConfig loads the arXiv rate limit from environment variables
+func LoadArxivRateConfig() (*ArxivRateConfig, error) {
+	var config ArxivRateConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process arXiv rate limit configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// arxivRateConfig is the arXiv rate limit loaded at server startup
+var arxivRateConfig = ArxivRateConfig{Interval: settings.Duration(arxivMinInterval), Burst: 1}
+
+// newArxivLimiter creates the limiter spacing requests to arXiv as configured
+func newArxivLimiter(config ArxivRateConfig) *rate.Limiter {
+	return rate.NewLimiter(rate.Every(config.Interval.Duration()), config.Burst)
+}
+
+// arxivInterval returns the spacing of requests to arXiv the limiter of the tool dependencies
+// enforces, zero if it is not limited
+func arxivInterval() time.Duration {
+	limit := toolDeps.ArxivLimiter.Limit()
+	if limit <= 0 || limit == rate.Inf {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / float64(limit))
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/storage"
+
+	"github.com/minio/minio-go/v7"
+	"golang.org/x/time/rate"
+)
+
+func TestArxivRateConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantErrors   []string
+		wantInterval time.Duration
+		wantBurst    int
+	}{
+		{name: "Default", wantInterval: 3 * time.Second, wantBurst: 1},
+		{name: "Slower", env: map[string]string{"OPUS_MCP_ARXIV_RATE_INTERVAL": "5s"}, wantInterval: 5 * time.Second, wantBurst: 1},
+		{
+			name:       "Faster than the terms of use",
+			env:        map[string]string{"OPUS_MCP_ARXIV_RATE_INTERVAL": "1s", "OPUS_MCP_ARXIV_RATE_BURST": "4"},
+			wantErrors: []string{"OPUS_MCP_ARXIV_RATE_INTERVAL", "OPUS_MCP_ARXIV_RATE_BURST", "OPUS_MCP_ARXIV_RATE_UNSAFE"},
+		},
+		{
+			name:         "Faster when unsafe",
+			env:          map[string]string{"OPUS_MCP_ARXIV_RATE_INTERVAL": "100ms", "OPUS_MCP_ARXIV_RATE_BURST": "4", "OPUS_MCP_ARXIV_RATE_UNSAFE": "true"},
+			wantInterval: 100 * time.Millisecond,
+			wantBurst:    4,
+		},
+		{
+			name:       "Invalid even when unsafe",
+			env:        map[string]string{"OPUS_MCP_ARXIV_RATE_INTERVAL": "0s", "OPUS_MCP_ARXIV_RATE_BURST": "0", "OPUS_MCP_ARXIV_RATE_UNSAFE": "true"},
+			wantErrors: []string{"must be positive", "must be at least 1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"OPUS_MCP_ARXIV_RATE_INTERVAL", "OPUS_MCP_ARXIV_RATE_BURST", "OPUS_MCP_ARXIV_RATE_UNSAFE"} {
+				value, ok := tt.env[name]
+				t.Setenv(name, value)
+				if !ok {
+					os.Unsetenv(name)
+				}
+			}
+			config, err := LoadArxivRateConfig()
+			if len(tt.wantErrors) > 0 {
+				for _, want := range tt.wantErrors {
+					if err == nil || !strings.Contains(err.Error(), want) {
+						t.Errorf("LoadArxivRateConfig() error = %v, want it to contain %q", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadArxivRateConfig() unexpected error: %v", err)
+			}
+
+			// The tool dependencies of the server space arXiv requests as configured
+			original, originalDeps := arxivRateConfig, toolDeps
+			t.Cleanup(func() { arxivRateConfig, toolDeps = original, originalDeps })
+			arxivRateConfig = *config
+			toolDeps = defaultToolDeps()
+			if got := arxivInterval(); got != tt.wantInterval {
+				t.Errorf("arxivInterval() = %v, want %v", got, tt.wantInterval)
+			}
+			if got := toolDeps.ArxivLimiter.Burst(); got != tt.wantBurst {
+				t.Errorf("limiter burst = %d, want %d", got, tt.wantBurst)
+			}
+		})
+	}
+}
+
+// TestArxivToolsShareRateLimiter checks that concurrent calls of different tools space their
+// requests to arXiv by the interval of the shared rate limiter: the category fetch, the live
+// taxonomy fetch and the PDF download
+func TestArxivToolsShareRateLimiter(t *testing.T) {
+	const interval = 100 * time.Millisecond
+	var mu sync.Mutex
+	var arrivals []time.Time
+	withHTTPFixtures(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		arrivals = append(arrivals, time.Now())
+		mu.Unlock()
+		switch {
+		case r.Host == "export.arxiv.org":
+			serveFixture(t, w, "feed_with_revisions.atom")
+		case r.URL.Path == "/category_taxonomy":
+			serveFixture(t, w, "category_taxonomy.html")
+		default:
+			_, _ = w.Write([]byte("%PDF-1.4"))
+		}
+	})
+	toolDeps.ArxivLimiter = rate.NewLimiter(rate.Every(interval), 1)
+
+	originalConfig, originalLibrary, originalUploader := globalS3Config, globalLibrary, urlUploader
+	t.Cleanup(func() {
+		globalS3Config, globalLibrary, urlUploader = originalConfig, originalLibrary, originalUploader
+	})
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	globalLibrary = library.New(&library.MemoryStore{})
+	// The fake uploader downloads the PDF from the fake arXiv server, and stores nothing
+	urlUploader = func(ctx context.Context, sourceURL string, config *storage.S3Config, bucketName, objectName string, metadata map[string]string, policy storage.CollisionPolicy) (storage.UploadResult, error) {
+		if err := storage.BeforeRequest(ctx); err != nil {
+			return storage.UploadResult{}, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+		if err != nil {
+			return storage.UploadResult{}, err
+		}
+		resp, err := toolDeps.HTTPClient.Do(req)
+		if err != nil {
+			return storage.UploadResult{}, err
+		}
+		resp.Body.Close()
+		return storage.UploadResult{UploadInfo: minio.UploadInfo{Bucket: bucketName, Key: objectName, Size: 8}}, nil
+	}
+
+	calls := map[string]func(ctx context.Context) (any, error){
+		"category fetch": func(ctx context.Context) (any, error) {
+			return categoryFetchLatest(ctx, json.RawMessage(`{"category": "cs.LG"}`))
+		},
+		"taxonomy fetch": func(ctx context.Context) (any, error) {
+			return fetchCategoryTaxonomy(ctx, json.RawMessage(`{}`))
+		},
+		"PDF download": func(ctx context.Context) (any, error) {
+			return downloadPDFToS3(ctx, json.RawMessage(`{"articleId": "2405.12345v1"}`))
+		},
+	}
+	var wg sync.WaitGroup
+	for name, call := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := call(context.Background()); err != nil {
+				t.Errorf("%s unexpected error: %v", name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	slices.SortFunc(arrivals, func(a, b time.Time) int { return a.Compare(b) })
+	if len(arrivals) < len(calls) {
+		t.Fatalf("arXiv received %d requests, want at least %d", len(arrivals), len(calls))
+	}
+	for i := 1; i < len(arrivals); i++ {
+		// Allow for the jitter between sending a request and the server receiving it
+		if gap := arrivals[i].Sub(arrivals[i-1]); gap < interval*8/10 {
+			t.Errorf("requests %d and %d arrived %v apart, want about %v", i, i+1, gap, interval)
+		}
+	}
+}
+
+// TestWaitForHostLimitsOnlyArxiv checks that only requests to arXiv take a turn on its rate limiter
+func TestWaitForHostLimitsOnlyArxiv(t *testing.T) {
+	withUnlimitedArxiv(t)
+	// A single request per hour: a second arXiv request in the test would fail its deadline
+	toolDeps.ArxivLimiter = rate.NewLimiter(rate.Every(time.Hour), 1)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for _, rawURL := range []string{"https://arxiv.org/pdf/2405.12345", "https://minio.example.org:9000/opus-mcp-articles/x.pdf", "https://api.crossref.org/works/10.1/x"} {
+		if err := waitForHost(ctx, rawURL); err != nil {
+			t.Errorf("waitForHost(%q) unexpected error: %v", rawURL, err)
+		}
+	}
+	if err := waitForHost(ctx, "https://export.arxiv.org/api/query"); err == nil {
+		t.Error("waitForHost() of a second arXiv request succeeded, want it to wait for the limiter")
+	}
+
+	for host, want := range map[string]bool{"arxiv.org": true, "export.arxiv.org": true, "ARXIV.ORG.": true, "notarxiv.org": false, "arxiv.org.example.com": false} {
+		if got := isArxivHost(host); got != want {
+			t.Errorf("isArxivHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// atomNamespace is the XML namespace of Atom elements
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+// maxRawEntryBytes caps the XML returned for a single entry by includeRawEntry; arXiv entries are
+// a few kilobytes
+const maxRawEntryBytes = 64 << 10
+
+// rawEntry is the XML of a single Atom entry, or why it could not be extracted
+type rawEntry struct {
+	// id is the text of the entry's atom:id element, which gofeed reports as the item's GUID
+	id  string
+	xml string
+	err error
+}
+
+// splitAtomEntries returns the XML of each entry of an Atom feed, in document order. Entries are
+// the Atom entry elements directly under the feed element, told apart by namespace rather than
+// prefix, so that extension elements named entry and CDATA sections containing markup do not
+// split the feed. Each fragment is the entry exactly as received, except that the namespace
+// declarations it inherits from the feed element are added to its start tag, so that it parses on
+// its own. If the feed cannot be read to the end, the entries before the error are returned with it.
+func splitAtomEntries(body []byte) ([]rawEntry, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	// Tolerate the bare ampersands and unknown entities that sanitizeFeedXML repairs for gofeed
+	decoder.Strict = false
+
+	var entries []rawEntry
+	var inherited, entryAttrs []xml.Attr
+	var id strings.Builder
+	var depth int
+	start := int64(-1)
+	inID := false
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 {
+				inherited = namespaceDeclarations(t.Attr)
+			}
+			if depth == 2 && t.Name.Space == atomNamespace && t.Name.Local == "entry" {
+				start, entryAttrs = offset, t.Attr
+				id.Reset()
+			}
+			inID = depth == 3 && start >= 0 && t.Name.Space == atomNamespace && t.Name.Local == "id"
+		case xml.CharData:
+			if inID {
+				id.Write(t)
+			}
+		case xml.EndElement:
+			inID = false
+			if depth == 2 && start >= 0 {
+				entry := newRawEntry(body[start:decoder.InputOffset()], inherited, entryAttrs)
+				entry.id = strings.TrimSpace(id.String())
+				entries = append(entries, entry)
+				start = -1
+			}
+			depth--
+		}
+	}
+}
+
+// namespaceDeclarations returns the xmlns attributes among the attributes of an element
+func namespaceDeclarations(attrs []xml.Attr) []xml.Attr {
+	var declarations []xml.Attr
+	for _, attr := range attrs {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			declarations = append(declarations, attr)
+		}
+	}
+	return declarations
+}
+
+// newRawEntry adds the inherited namespace declarations that an entry does not make itself to the
+// start tag of its XML, and checks the size of the result
+func newRawEntry(fragment []byte, inherited, own []xml.Attr) rawEntry {
+	var declarations strings.Builder
+	for _, attr := range inherited {
+		if slices.ContainsFunc(own, func(a xml.Attr) bool { return a.Name == attr.Name }) {
+			continue
+		}
+		name := attr.Name.Local
+		if attr.Name.Space == "xmlns" {
+			name = "xmlns:" + name
+		}
+		declarations.WriteString(" " + name + `="`)
+		_ = xml.EscapeText(&declarations, []byte(attr.Value))
+		declarations.WriteString(`"`)
+	}
+	// The element name ends at the first whitespace, slash or closing bracket of the start tag
+	nameEnd := bytes.IndexAny(fragment, " \t\r\n/>")
+	if nameEnd < 0 {
+		return rawEntry{err: fmt.Errorf("malformed start tag in raw entry")}
+	}
+	size := len(fragment) + declarations.Len()
+	if size > maxRawEntryBytes {
+		return rawEntry{err: fmt.Errorf("raw entry of %d bytes exceeds the limit of %d bytes", size, maxRawEntryBytes)}
+	}
+	return rawEntry{xml: string(fragment[:nameEnd]) + declarations.String() + string(fragment[nameEnd:])}
+}
+
+// attachRawEntries sets the raw XML of every entry of a parsed Atom feed from the feed's body,
+// matching them by their Atom identifier. An entry whose XML cannot be extracted is left without
+// it and flagged, without failing the others.
+func attachRawEntries(body []byte, result *CategoryFetchResult) {
+	raw, splitErr := splitAtomEntries(body)
+	byID := make(map[string]rawEntry, len(raw))
+	for _, entry := range raw {
+		if _, seen := byID[entry.id]; !seen && entry.id != "" {
+			byID[entry.id] = entry
+		}
+	}
+	for _, entry := range result.Items {
+		found, ok := byID[strings.TrimSpace(entry.GUID)]
+		if ok && found.err == nil {
+			entry.RawXML = &found.xml
+			continue
+		}
+		err := found.err
+		switch {
+		case ok:
+		case splitErr != nil:
+			err = fmt.Errorf("the feed could not be split into entries: %w", splitErr)
+		default:
+			err = fmt.Errorf("no Atom entry with id %q in the feed", entry.GUID)
+		}
+		if len(entry.Errors) == 0 {
+			result.Warnings++
+		}
+		entry.Errors = append(entry.Errors, "raw XML unavailable: "+err.Error())
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// inheritedDeclarations are the namespace declarations added to the start tag of the fixture's entries
+const inheritedDeclarations = ` xmlns="http://www.w3.org/2005/Atom" xmlns:opensearch="http://a9.com/-/spec/opensearch/1.1/" xmlns:arxiv="http://arxiv.org/schemas/atom"`
+
+func TestAttachRawEntries(t *testing.T) {
+	body, err := os.ReadFile("testdata/feed_with_raw_entries.atom")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	result, err := parseCategoryFeed(body, false)
+	if err != nil {
+		t.Fatalf("parseCategoryFeed() unexpected error: %v", err)
+	}
+	attachRawEntries(body, result)
+	if len(result.Items) != 2 || result.Warnings != 0 {
+		t.Fatalf("attachRawEntries() left %d entries with %d warnings, want 2 without warnings", len(result.Items), result.Warnings)
+	}
+
+	for i, wantFragment := range []string{"<![CDATA[An abstract quoting markup: </entry>", "<ext:entry>"} {
+		raw := result.Items[i].RawXML
+		if raw == nil {
+			t.Fatalf("entry %d has no raw XML", i)
+		}
+		if !strings.Contains(*raw, wantFragment) || !strings.HasSuffix(*raw, "</entry>") {
+			t.Errorf("entry %d raw XML = %s, want the whole entry including %q", i, *raw, wantFragment)
+		}
+		// Apart from the inherited namespace declarations, the entry is as received
+		if original := strings.Replace(*raw, inheritedDeclarations, "", 1); !bytes.Contains(body, []byte(original)) {
+			t.Errorf("entry %d raw XML is not the received entry: %s", i, *raw)
+		}
+
+		// The fragment parses on its own, with its prefixes bound
+		var parsed struct {
+			XMLName  xml.Name
+			ID       string `xml:"http://www.w3.org/2005/Atom id"`
+			Category struct {
+				Term string `xml:"term,attr"`
+			} `xml:"http://arxiv.org/schemas/atom primary_category"`
+		}
+		if err := xml.Unmarshal([]byte(*raw), &parsed); err != nil {
+			t.Fatalf("entry %d raw XML does not parse on its own: %v", i, err)
+		}
+		if parsed.XMLName.Space != atomNamespace || parsed.ID != result.Items[i].GUID || parsed.Category.Term != result.Items[i].PrimaryCategory {
+			t.Errorf("entry %d raw XML parsed as %+v, want the Atom entry %s in %s", i, parsed, result.Items[i].GUID, result.Items[i].PrimaryCategory)
+		}
+	}
+}
+
+func TestSplitAtomEntriesByNamespace(t *testing.T) {
+	body := []byte(`<a:feed xmlns:a="http://www.w3.org/2005/Atom" xmlns:x="urn:example:other">
+		<x:entry><a:id>urn:not-atom</a:id></x:entry>
+		<a:entry><a:id>urn:prefixed</a:id></a:entry>
+		<entry xmlns="http://www.w3.org/2005/Atom" xmlns:a="http://www.w3.org/2005/Atom"><id>urn:redeclared</id></entry>
+		<a:entry/>
+	</a:feed>`)
+	entries, err := splitAtomEntries(body)
+	if err != nil {
+		t.Fatalf("splitAtomEntries() unexpected error: %v", err)
+	}
+	want := []rawEntry{
+		{id: "urn:prefixed", xml: `<a:entry xmlns:a="http://www.w3.org/2005/Atom" xmlns:x="urn:example:other"><a:id>urn:prefixed</a:id></a:entry>`},
+		{id: "urn:redeclared", xml: `<entry xmlns:x="urn:example:other" xmlns="http://www.w3.org/2005/Atom" xmlns:a="http://www.w3.org/2005/Atom"><id>urn:redeclared</id></entry>`},
+		{xml: `<a:entry xmlns:a="http://www.w3.org/2005/Atom" xmlns:x="urn:example:other"/>`},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("splitAtomEntries() = %+v, want %d entries", entries, len(want))
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+}
+
+func TestAttachRawEntriesFlagsFailures(t *testing.T) {
+	entry := func(id, summary string) string {
+		return "<entry><id>" + id + "</id><summary>" + summary + "</summary></entry>"
+	}
+	body := `<feed xmlns="http://www.w3.org/2005/Atom">` +
+		entry("urn:small", "short") +
+		entry("urn:large", strings.Repeat("x", maxRawEntryBytes)) +
+		entry("urn:truncated", "cut off")
+	// The feed ends in the middle of its last entry
+	body = body[:len(body)-len("off</summary></entry>")]
+
+	result := processFeed(&gofeed.Feed{Items: []*gofeed.Item{
+		{GUID: "urn:small"}, {GUID: "urn:large"}, {GUID: "urn:truncated"},
+	}})
+	attachRawEntries([]byte(body), result)
+	if raw := result.Items[0].RawXML; raw == nil || *raw != `<entry xmlns="http://www.w3.org/2005/Atom"><id>urn:small</id><summary>short</summary></entry>` {
+		t.Errorf("small entry raw XML = %v, want the entry", raw)
+	}
+	for i, want := range []string{"exceeds the limit", "could not be split"} {
+		failed := result.Items[i+1]
+		if failed.RawXML != nil || len(failed.Errors) != 1 || !strings.Contains(failed.Errors[0], want) {
+			t.Errorf("entry %s = raw %v, errors %v, want no raw XML and an error containing %q", failed.GUID, failed.RawXML, failed.Errors, want)
+		}
+	}
+	if result.Warnings != 2 {
+		t.Errorf("Warnings = %d, want 2", result.Warnings)
+	}
+}
@@ -0,0 +1,2033 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"sync"
+
+	"opus-mcp/internal/metadata"
+	"opus-mcp/internal/parser"
+	"opus-mcp/internal/storage"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// toolFactory builds a tool and its handler. Every factory is run in isolation, so that a tool
+// whose schemas cannot be built, e.g., after a dependency upgrade introduces a cyclic type, is
+// reported as degraded without keeping the other tools from being registered.
+type toolFactory struct {
+	name  string
+	build func() (*mcp.Tool, *ArxivToolHandler, error)
+	// disabled, when set, is why the current configuration leaves the tool out
+	disabled string
+	// examples are curated example calls served by get_tool_examples and /examples.json
+	examples []toolExample
+}
+
+// DegradedTool is a tool that failed to register
+type DegradedTool struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// DisabledTool is a tool that the current configuration leaves out
+type DisabledTool struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// toolRegistration is the outcome of registering the tools on a server
+type toolRegistration struct {
+	Registered []string       `json:"registered"`
+	Degraded   []DegradedTool `json:"degraded,omitempty"`
+	Disabled   []DisabledTool `json:"disabled,omitempty"`
+	// catalog holds the registered tools, for the endpoints describing them
+	catalog *toolCatalog
+}
+
+var (
+	// registeredTools is the outcome of the last tool registration, reported by /health
+	registeredTools   toolRegistration
+	registeredToolsMu sync.Mutex
+)
+
+// toolFactories returns the factories of all tools in registration order, with the tools that the
+// current configuration leaves out marked as disabled
+func toolFactories() []toolFactory {
+	var s3Disabled, genericDisabled, signerDisabled, adminDisabled string
+	if globalS3Config == nil {
+		s3Disabled = "S3 storage is not configured"
+	}
+	if genericDisabled = s3Disabled; genericDisabled == "" && !genericDownloadEnabled {
+		genericDisabled = "OPUS_MCP_ENABLE_GENERIC_DOWNLOAD is not set"
+	}
+	if signerDisabled = s3Disabled; signerDisabled == "" && globalSigner == nil {
+		signerDisabled = "no attestation signing key is configured"
+	}
+	if adminToken == "" {
+		adminDisabled = "OPUS_MCP_ADMIN_TOKEN is not set"
+	}
+	return []toolFactory{
+		{name: "arxiv_category_fetch_latest", build: newCategoryFetchLatestTool, examples: categoryFetchLatestExamples},
+		{name: "arxiv_search", build: newSearchTool, examples: searchExamples},
+		{name: "arxiv_advanced_query", build: newAdvancedQueryTool, examples: advancedQueryExamples},
+		{name: "arxiv_get_category_taxonomy", build: newCategoryTaxonomyTool, examples: categoryTaxonomyExamples},
+		{name: "arxiv_related_categories", build: newRelatedCategoriesTool, examples: relatedCategoriesExamples},
+		{name: "arxiv_fetch_by_id", build: newFetchByIDTool, examples: fetchByIDExamples},
+		{name: "arxiv_get_abs_metadata", build: newAbsMetadataTool, examples: absMetadataExamples},
+		{name: "arxiv_get_article", build: newGetArticleTool, examples: getArticleExamples},
+		{name: "identifiers_resolve", build: newIdentifiersResolveTool, examples: identifiersResolveExamples},
+		{name: "arxiv_download_pdf", build: newDownloadPDFTool, disabled: s3Disabled, examples: downloadPDFExamples},
+		{name: "download_job_status", build: newDownloadJobStatusTool, disabled: s3Disabled, examples: downloadJobStatusExamples},
+		{name: "library_provenance", build: newLibraryProvenanceTool, disabled: s3Disabled, examples: libraryProvenanceExamples},
+		{name: "library_export", build: newLibraryExportTool, disabled: s3Disabled, examples: libraryExportExamples},
+		{name: "library_cleanup", build: newLibraryCleanupTool, disabled: s3Disabled, examples: libraryCleanupExamples},
+		{name: "s3_read_object_chunk", build: newReadObjectChunkTool, disabled: s3Disabled, examples: readObjectChunkExamples},
+		{name: "url_download_to_storage", build: newURLDownloadTool, disabled: genericDisabled, examples: urlDownloadExamples},
+		{name: "verify_attestation", build: newVerifyAttestationTool, disabled: signerDisabled, examples: verifyAttestationExamples},
+		{name: "server_status", build: newServerStatusTool, examples: serverStatusExamples},
+		{name: "server_config", build: newServerConfigTool, disabled: adminDisabled, examples: serverConfigExamples},
+		{name: "server_selftest", build: newServerSelftestTool, disabled: adminDisabled, examples: serverSelftestExamples},
+	}
+}
+
+// addMCPTools registers the tools enabled by the current configuration on the server. Tools that
+// fail to register are logged and reported as degraded; it is only an error if none register. The
+// handlers reach the outside world through deps.
+func addMCPTools(server *mcp.Server, deps *ToolDeps) error {
+	toolDeps = deps
+	registration, err := registerTools(server, toolFactories())
+	registeredToolsMu.Lock()
+	registeredTools = registration
+	registeredToolsMu.Unlock()
+	return err
+}
+
+// registerTools runs the factories and registers the tools they build, followed by the tools
+// describing them
+func registerTools(server *mcp.Server, factories []toolFactory) (toolRegistration, error) {
+	var catalog toolCatalog
+	registration := toolRegistration{catalog: &catalog}
+	register := func(factory toolFactory) {
+		if err := registerTool(server, &catalog, factory); err != nil {
+			slog.Error("Failed to register tool - continuing without it", "tool", factory.name, "error", err)
+			registration.Degraded = append(registration.Degraded, DegradedTool{Name: factory.name, Error: err.Error()})
+			return
+		}
+		registration.Registered = append(registration.Registered, factory.name)
+	}
+
+	for _, factory := range factories {
+		if factory.disabled != "" {
+			slog.Info("Skipping tool", "tool", factory.name, "reason", factory.disabled)
+			registration.Disabled = append(registration.Disabled, DisabledTool{Name: factory.name, Reason: factory.disabled})
+			continue
+		}
+		register(factory)
+	}
+	if len(registration.Registered) == 0 {
+		return registration, fmt.Errorf("none of the tools could be registered (%d degraded)", len(registration.Degraded))
+	}
+
+	// Registered last so that they describe themselves along with every other tool
+	register(toolFactory{name: "get_tool_examples", build: func() (*mcp.Tool, *ArxivToolHandler, error) {
+		return newToolExamplesTool(&catalog)
+	}, examples: toolExamplesExamples})
+	register(toolFactory{name: "server_schema_info", build: func() (*mcp.Tool, *ArxivToolHandler, error) {
+		return newSchemaInfoTool(&catalog)
+	}, examples: schemaInfoExamples})
+	return registration, nil
+}
+
+// registerTool builds a tool and adds it to the server, turning a panic in the factory into an error
+func registerTool(server *mcp.Server, catalog *toolCatalog, factory toolFactory) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while building tool: %v", r)
+		}
+	}()
+	tool, handler, err := factory.build()
+	if err != nil {
+		return err
+	}
+	return catalog.add(server, tool, handler, factory.examples)
+}
+
+// toolRegistrationStatus returns the outcome of the last tool registration
+func toolRegistrationStatus() toolRegistration {
+	registeredToolsMu.Lock()
+	defer registeredToolsMu.Unlock()
+	return registeredTools
+}
+
+// ListTools loads the configuration, registers the tools on a server that is never started and
+// writes the status of every tool to w. It returns the process exit code: 0 if no tool is
+// degraded and 1 otherwise.
+func ListTools(w io.Writer) int {
+	loadConfiguration()
+	server := mcp.NewServer(&mcp.Implementation{Name: metadata.APP_NAME, Version: metadata.BuildVersion}, nil)
+	err := addMCPTools(server, defaultToolDeps())
+	registration := toolRegistrationStatus()
+
+	for _, name := range registration.Registered {
+		fmt.Fprintf(w, "%-30s registered\n", name)
+	}
+	for _, tool := range registration.Degraded {
+		fmt.Fprintf(w, "%-30s degraded: %s\n", tool.Name, tool.Error)
+	}
+	for _, tool := range registration.Disabled {
+		fmt.Fprintf(w, "%-30s disabled: %s\n", tool.Name, tool.Reason)
+	}
+	if err != nil || len(registration.Degraded) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// categoryFetchLatestExamples are example calls of the category fetch tool
+var categoryFetchLatestExamples = []toolExample{
+	{
+		description: "Fetch the 2 latest articles in Artificial Intelligence",
+		arguments:   `{"category": "cs.AI", "fetchSize": 2}`,
+		output: `{
+			"items": [
+				{
+					"title": "Planning with Large Language Models for Embodied Agents",
+					"abstract": "We study how large language models can produce executable plans...",
+					"absUrl": "https://arxiv.org/abs/2411.04321v1",
+					"pdfUrl": "https://arxiv.org/pdf/2411.04321v1",
+					"published": "2024-11-06T18:59:58Z",
+					"authors": ["A. Researcher", "B. Scientist"],
+					"categories": ["cs.AI", "cs.RO"],
+					"articleId": "2411.04321v1"
+				},
+				{
+					"title": "On the Limits of Automated Theorem Proving",
+					"abstract": "We characterise the problems on which current provers fail...",
+					"absUrl": "https://arxiv.org/abs/2411.04298v1",
+					"pdfUrl": "https://arxiv.org/pdf/2411.04298v1",
+					"published": "2024-11-06T18:41:12Z",
+					"authors": ["C. Logician"],
+					"categories": ["cs.AI", "cs.LO"],
+					"articleId": "2411.04298v1"
+				}
+			],
+			"warnings": 0,
+			"pagination": {"totalResults": 14282, "startIndex": 0, "itemsPerPage": 2, "nextStartIndex": 2},
+			"interpretation": {
+				"query": "(cat:cs.AI)",
+				"terms": [{"token": "cs.AI", "kind": "category", "clause": "cat:cs.AI"}]
+			}
+		}`,
+	},
+	{
+		description: "Search computational linguistics for a phrase and a keyword in articles announced on a given day",
+		arguments:   `{"category": "cs.CL AND \"large language models\" evaluation", "fetchSize": 1, "announcedOn": "2024-11-07"}`,
+		output: `{
+			"items": [
+				{
+					"title": "A Survey of Evaluation Methods for Large Language Models",
+					"abstract": "We review benchmarks and protocols for evaluating large language models...",
+					"absUrl": "https://arxiv.org/abs/2411.03210v2",
+					"pdfUrl": "https://arxiv.org/pdf/2411.03210v2",
+					"published": "2024-11-05T15:02:44Z",
+					"authors": ["D. Linguist"],
+					"categories": ["cs.CL"],
+					"articleId": "2411.03210v2"
+				}
+			],
+			"warnings": 0,
+			"custom": {"announcedOn": "2024-11-07", "windowStart": "2024-11-06T19:00:00Z", "windowEnd": "2024-11-07T19:00:00Z"},
+			"interpretation": {
+				"query": "(cat:cs.CL+AND+all:%22large+language+models%22+AND+all:evaluation)",
+				"terms": [
+					{"token": "cs.CL", "kind": "category", "clause": "cat:cs.CL"},
+					{"token": "\"large language models\"", "kind": "phrase", "clause": "all:%22large+language+models%22"},
+					{"token": "evaluation", "kind": "keyword", "clause": "all:evaluation"}
+				]
+			}
+		}`,
+	},
+	{
+		description: "Fetch only the titles, authors and PDF links of the 2 latest articles in Robotics",
+		arguments:   `{"category": "cs.RO", "fetchSize": 2, "includeFields": ["title", "authors", "pdfUrl"]}`,
+		output: `{
+			"items": [
+				{
+					"title": "Learning Dexterous Grasps from Human Video",
+					"authors": ["F. Roboticist", "G. Engineer"],
+					"pdfUrl": "https://arxiv.org/pdf/2411.04410v1"
+				},
+				{
+					"title": "Safe Navigation in Crowds with Diffusion Policies",
+					"authors": ["H. Planner"],
+					"pdfUrl": "https://arxiv.org/pdf/2411.04377v1"
+				}
+			],
+			"warnings": 0,
+			"pagination": {"totalResults": 5120, "startIndex": 0, "itemsPerPage": 2, "nextStartIndex": 2},
+			"interpretation": {
+				"query": "(cat:cs.RO)",
+				"terms": [{"token": "cs.RO", "kind": "category", "clause": "cat:cs.RO"}]
+			}
+		}`,
+	},
+	{
+		description: "Reproducibly fetch the machine learning articles announced in the week of 2024-03-04, as the feed was parsed",
+		arguments:   `{"category": "cs.LG", "fetchSize": 1, "weekOf": "2024-03-04", "raw": true}`,
+		output: `{
+			"title": "arXiv Query: search_query=cat:cs.LG",
+			"feedType": "atom",
+			"feedVersion": "1.0",
+			"items": [
+				{
+					"title": "Scaling Laws for Sparse Mixture-of-Experts Training",
+					"description": "We fit scaling laws to the training loss of sparse mixture-of-experts models...",
+					"link": "http://arxiv.org/abs/2403.05433v1",
+					"published": "2024-03-08T17:55:01Z",
+					"authors": [{"name": "E. Learner"}],
+					"categories": ["cs.LG"],
+					"articleId": "2403.05433v1"
+				}
+			],
+			"warnings": 0,
+			"custom": {
+				"weekOf": "2024-03-04",
+				"firstAnnouncement": "2024-03-04",
+				"lastAnnouncement": "2024-03-10",
+				"windowStart": "2024-03-01T19:00:00Z",
+				"windowEnd": "2024-03-08T19:00:00Z"
+			},
+			"interpretation": {
+				"query": "(cat:cs.LG)",
+				"terms": [{"token": "cs.LG", "kind": "category", "clause": "cat:cs.LG"}]
+			}
+		}`,
+	},
+}
+
+// feedOutputSchema is the output schema of the tools returning feed entries: flattened entries by
+// default, or the feed as parsed with raw. Both shapes are reflected from their structures.
+func feedOutputSchema() (*jsonschema.Schema, error) {
+	summarySchema, err := jsonschema.ForType(reflect.TypeFor[CategoryFetchSummary](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reflect output schema from CategoryFetchSummary: %w", err)
+	}
+	// Handle circular references of the gofeed.Feed based result by providing simplified schemas for problematic types
+	rawSchema, err := jsonschema.ForType(reflect.TypeFor[CategoryFetchResult](), &jsonschema.ForOptions{
+		TypeSchemas: feedTypeSchemas(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reflect output schema from CategoryFetchResult: %w", err)
+	}
+	summarySchema.Description = "The flattened entries, returned by default"
+	rawSchema.Description = "The feed as parsed, returned with raw"
+	return &jsonschema.Schema{
+		Type:  "object",
+		AnyOf: []*jsonschema.Schema{summarySchema, rawSchema},
+	}, nil
+}
+
+// newCategoryFetchLatestTool builds the tool fetching the latest articles of a category expression
+func newCategoryFetchLatestTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	categoryFetchLatestInputSchema := &jsonschema.Schema{
+		Type:                 "object",
+		AdditionalProperties: closedObject(),
+		Properties: map[string]*jsonschema.Schema{
+			"category": {
+				Description: "Expression of arXiv categories with boolean operators. Category codes are searched with cat:, other words and double-quoted phrases are searched as keywords in keywordField, and tokens with an arXiv field prefix (e.g., au:smith) are passed through. The output's interpretation shows how each token was classified.",
+				Examples:    []any{"cs.AI", "cs.LG not cs.CV not cs.RO", "cs.AI + cs.LG - cs.CV", "cs.AI or (cs.LG not cs.CV)", `cs.CL AND "large language models" evaluation`},
+				Type:        "string",
+				Items: &jsonschema.Schema{
+					Type: "string",
+				},
+			},
+			"categoryJoinStrategy": {
+				Description: "How to join a category expression that is a plain list of category codes separated by commas or spaces, e.g., 'cs.AI, cs.CL': AND finds articles in all of them, OR in any of them. Expressions with operators, parentheses, phrases or keywords are joined as written, with implicit AND between terms. The output's interpretation reports the strategy when it was applied.",
+				Type:        "string",
+				Enum:        []any{parser.JoinAnd, parser.JoinOr},
+				Default:     json.RawMessage(`"` + parser.JoinAnd + `"`),
+			},
+			"keywordField": {
+				Description: "The arXiv search field that keywords and quoted phrases in the category expression are matched against: all fields, the abstract or the title",
+				Type:        "string",
+				Enum:        []any{"all", "abs", "ti"},
+				Default:     json.RawMessage([]byte(`"all"`)),
+			},
+			"startIndex": {
+				Description: "The starting index for fetching results (0-based)",
+				Type:        "integer",
+				Minimum:     jsonschema.Ptr(float64(0)),
+				Default:     json.RawMessage([]byte(`0`)),
+			},
+			"fetchSize": {
+				Description: "Number of results to fetch (min: 1, max: 100)",
+				Type:        "integer",
+				Minimum:     jsonschema.Ptr(float64(1)),
+				Maximum:     jsonschema.Ptr(float64(100)),
+				Default:     json.RawMessage([]byte(`10`)),
+			},
+			"expandRelated": {
+				Description: "Also search the categories well known to cover research adjacent to every category code in the expression, e.g., cs.CL as cs.CL OR cs.AI OR cs.LG, as listed by arxiv_related_categories. The interpretation lists the categories added to every term in related. Defaults to false.",
+				Type:        "boolean",
+				Default:     json.RawMessage(`false`),
+			},
+			"fields": {
+				Description: "How much of every entry to return. full returns the whole entry; headline returns only its articleId, title, primaryCategory and announcedOn, a small fraction of the size, for scanning many pages cheaply before fetching the shortlisted articles with arxiv_fetch_by_id. Groups and library records are still made from the full entries.",
+				Type:        "string",
+				Enum:        entryFieldsValues,
+				Default:     json.RawMessage(`"` + entryFieldsFull + `"`),
+			},
+			"maxAbstractLength": {
+				Description: "Truncate every abstract longer than this many characters to this many, the last of which is an ellipsis (…). Characters are Unicode code points, so multi-byte characters are never split. Not truncated by default.",
+				Type:        "integer",
+				Minimum:     jsonschema.Ptr(float64(1)),
+			},
+			"normalizeText": {
+				Description: "Return the titles and abstracts of flattened entries as plain text: the line breaks and indentation arXiv wraps them with collapsed, HTML entities unescaped, LaTeX escapes, accents and formatting resolved, and the dollar signs of inline math stripped with common symbols such as \\alpha written as Unicode. false returns them exactly as arXiv sent them. Raw feeds are never normalized. Defaults to true.",
+				Type:        "boolean",
+				Default:     json.RawMessage([]byte(`true`)),
+			},
+			"includeFields": {
+				Description: "Only return these fields of every flattened entry, e.g., [\"title\", \"authors\", \"pdfUrl\"], to keep large results manageable; the errors of an entry are always returned. Empty or absent returns all fields. Cannot be combined with raw.",
+				Type:        "array",
+				Items:       &jsonschema.Schema{Type: "string", Enum: summaryFieldEnum()},
+				UniqueItems: true,
+			},
+			"maxTokensHint": {
+				Description: "The number of tokens of your context the entries may take up. The tokens of an entry are estimated from the size of the first one; entries that do not fit are left out, last first, and reported in the result's budget with omittedCount and their identifiers, together with a suggestedFetchSize for the next call. At least one entry is always returned. Not limited by default.",
+				Type:        "integer",
+				Minimum:     jsonschema.Ptr(float64(1)),
+			},
+			"announcedOn": {
+				Description: "Only fetch papers announced on this date (YYYY-MM-DD, US Eastern time). arXiv announces at 20:00 US Eastern from Sunday to Thursday; other days return an empty result naming the next announcement date. Cannot be combined with weekOf or monthOf.",
+				Type:        "string",
+				Format:      "date",
+				Examples:    []any{"2024-11-07"},
+			},
+			"weekOf": {
+				Description: "Only fetch papers announced in the week, Monday to Sunday, that contains this date (YYYY-MM-DD, US Eastern time). The result is sorted by submission time and deduplicated, and its custom fields name the submission window used, so the same week always returns the same listing apart from withdrawals. Cannot be combined with announcedOn or monthOf.",
+				Type:        "string",
+				Format:      "date",
+				Examples:    []any{"2024-03-04"},
+			},
+			"monthOf": {
+				Description: "Only fetch papers announced in this month (YYYY-MM, US Eastern time), sorted, deduplicated and tagged with the submission window used like weekOf. Cannot be combined with announcedOn or weekOf.",
+				Type:        "string",
+				Pattern:     `^\d{4}-(0[1-9]|1[0-2])$`,
+				Examples:    []any{"2024-03"},
+			},
+			"collapseRevisions": {
+				Description: "Keep only the newest version of every article in the result, so that a paper re-announced as a replacement shows up once. The kept entry lists the identifiers of the collapsed versions in previousVersionsInWindow.",
+				Type:        "boolean",
+				Default:     json.RawMessage([]byte(`false`)),
+			},
+			"strictParse": {
+				Description: "Fail on any XML error in the arXiv feed instead of removing invalid characters and escaping bare ampersands before parsing. The output's sanitized field reports whether the feed needed repairs.",
+				Type:        "boolean",
+				Default:     json.RawMessage([]byte(`false`)),
+			},
+			"raw": {
+				Description: "Return the feed as parsed, with the feed's metadata and every entry's RSS, iTunes and Dublin Core fields and extensions, instead of flattened entries with their articleId, title, authors, abstract, categories, dates, abs and PDF URLs and DOI. Defaults to false.",
+				Type:        "boolean",
+				Default:     json.RawMessage([]byte(`false`)),
+			},
+			"sortBy": {
+				Description: "How to order the fetched entries. submittedDate, lastUpdatedDate and relevance have arXiv sort the entries by the submission of their first or latest version or by how well they match the expression, in sortOrder. categoryRelevance puts entries whose primary category appears in the category expression before entries that are only cross-listed into it, newest first within each, and reports every entry's categoryRank; only the fetched page is reordered. announcedOn, weekOf and monthOf listings are sorted by submission time, so they only take submittedDate or categoryRelevance.",
+				Type:        "string",
+				Enum:        sortByValues,
+				Default:     json.RawMessage([]byte(`"submittedDate"`)),
+			},
+			"sortOrder": {
+				Description: "The direction arXiv sorts the entries by sortBy in. categoryRelevance and the announcedOn, weekOf and monthOf listings are newest first, so they only take descending.",
+				Type:        "string",
+				Enum:        []any{sortOrderDescending, sortOrderAscending},
+				Default:     json.RawMessage(`"` + sortOrderDescending + `"`),
+			},
+			"groupBy": {
+				Description: "Also return the fetched entries in groups, each with its count and the identifiers of its entries. queriedCategory groups under every category or archive of the expression an entry is listed in, so a cross-listed entry can be in several groups; primaryCategory groups under the category an entry was submitted to; announcedDate groups under the announcedOn date of its first version. Only the fetched page is grouped.",
+				Type:        "string",
+				Enum:        groupByValues,
+			},
+			"includeRawEntry": {
+				Description: "Return the XML of every entry exactly as arXiv sent it in rawXml, for archiving the upstream record; at most 64 KiB per entry. An entry whose XML cannot be extracted is returned without it and with an error.",
+				Type:        "boolean",
+				Default:     json.RawMessage([]byte(`false`)),
+			},
+			"recordToLibrary": {
+				Description: "Also record the metadata of every returned article in the library index as a metadata-only entry, without downloading its PDF, for later triage; a later download of the article replaces the entry. Repeating a query records nothing new. Requires S3 storage.",
+				Type:        "boolean",
+				Default:     json.RawMessage([]byte(`false`)),
+			},
+		},
+		Required: []string{"category"},
+		AllOf:    append(categoryFetchSortRules(), rawFieldsRule()),
+	}
+
+	categoryFetchLatestOutputSchema, err := feedOutputSchema()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	categoryFetchLatestHandler, err := NewArxivToolHandler(categoryFetchLatestInputSchema, categoryFetchLatestOutputSchema, categoryFetchLatest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create category fetch latest handler: %w", err)
+	}
+	categoryFetchLatestHandler.admission = arxivAdmission
+	categoryFetchLatestHandler.describeQuery = describeCategoryFetch
+	categoryFetchLatestHandler.coalesce = true
+	categoryFetchLatestHandler.validateArgs = argsValidator(categoryFetchIssues)
+	slog.Info("category fetch handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "arxiv_category_fetch_latest",
+		Description:  "Fetch latest publications from arXiv by category. See https://arxiv.org/category_taxonomy for valid categories.",
+		InputSchema:  categoryFetchLatestInputSchema,
+		OutputSchema: categoryFetchLatestOutputSchema,
+	}, categoryFetchLatestHandler, nil
+}
+
+// searchExamples are example calls of the search tool
+var searchExamples = []toolExample{
+	{
+		description: "Search titles for two words",
+		arguments:   `{"query": "transformer AND attention", "field": "title", "fetchSize": 1}`,
+		output: `{
+			"items": [
+				{
+					"title": "Sparse Attention Transformers for Long Documents",
+					"abstract": "We propose a transformer whose attention scales linearly with document length...",
+					"absUrl": "https://arxiv.org/abs/2410.01234v1",
+					"pdfUrl": "https://arxiv.org/pdf/2410.01234v1",
+					"published": "2024-10-02T12:00:00Z",
+					"authors": ["E. Author"],
+					"categories": ["cs.CL", "cs.LG"],
+					"articleId": "2410.01234v1",
+					"relevanceRank": 1
+				}
+			],
+			"warnings": 0,
+			"pagination": {"totalResults": 412, "startIndex": 0, "itemsPerPage": 1, "nextStartIndex": 1},
+			"interpretation": {
+				"query": "(ti:transformer+AND+ti:attention)",
+				"terms": [
+					{"token": "transformer", "kind": "keyword", "clause": "ti:transformer"},
+					{"token": "attention", "kind": "keyword", "clause": "ti:attention"}
+				]
+			}
+		}`,
+	},
+	{
+		description: "Find the oldest abstracts with an exact phrase, excluding surveys, as the feed was parsed",
+		arguments:   `{"query": "\"in-context learning\" -survey", "field": "abstract", "sortBy": "submittedDate", "sortOrder": "ascending", "fetchSize": 1, "raw": true}`,
+		output: `{
+			"title": "arXiv Query: search_query=abs:\"in-context learning\" ANDNOT abs:survey&id_list=&start=0&max_results=1",
+			"feedType": "atom",
+			"feedVersion": "1.0",
+			"items": [
+				{
+					"title": "Language Models are Few-Shot Learners",
+					"description": "We show that scaling up language models greatly improves in-context learning...",
+					"link": "http://arxiv.org/abs/2005.14165v4",
+					"published": "2020-05-28T17:29:03Z",
+					"authors": [{"name": "Tom B. Brown"}],
+					"categories": ["cs.CL"],
+					"articleId": "2005.14165v4"
+				}
+			],
+			"warnings": 0,
+			"interpretation": {
+				"query": "(abs:%22in-context+learning%22+NOT+abs:survey)",
+				"terms": [
+					{"token": "\"in-context learning\"", "kind": "phrase", "clause": "abs:%22in-context+learning%22"},
+					{"token": "survey", "kind": "keyword", "clause": "abs:survey"}
+				]
+			}
+		}`,
+	},
+	{
+		description: "Scan the headlines of an author's latest articles, to fetch the interesting ones by ID later",
+		arguments:   `{"query": "hinton", "field": "author", "sortBy": "submittedDate", "fetchSize": 2, "fields": "headline"}`,
+		output: `{
+			"items": [
+				{"title": "Forward-Forward Training of Deep Networks", "articleId": "2410.05120v1", "primaryCategory": "cs.LG", "announcedOn": "2024-10-07"},
+				{"title": "Capsules Revisited", "articleId": "2409.11873v2", "primaryCategory": "cs.CV", "announcedOn": "2024-09-18"}
+			],
+			"warnings": 0,
+			"pagination": {"totalResults": 86, "startIndex": 0, "itemsPerPage": 2, "nextStartIndex": 2},
+			"interpretation": {
+				"query": "(au:hinton)",
+				"terms": [{"token": "hinton", "kind": "keyword", "clause": "au:hinton"}]
+			}
+		}`,
+	},
+}
+
+// newSearchTool builds the tool searching arXiv by field
+func newSearchTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	searchInputSchema, err := jsonschema.ForType(reflect.TypeFor[ArxivSearchArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from ArxivSearchArgs: %w", err)
+	}
+	searchInputSchema.Properties["query"].MinLength = jsonschema.Ptr(1)
+	searchInputSchema.Properties["query"].Examples = []any{"transformer AND attention", `"large language models" -survey`, "(bert | gpt) evaluation"}
+	searchInputSchema.Properties["field"].Enum = searchFieldValues
+	searchInputSchema.Properties["field"].Default = json.RawMessage(`"all"`)
+	searchInputSchema.Properties["fetchSize"].Minimum = jsonschema.Ptr(float64(1))
+	searchInputSchema.Properties["fetchSize"].Maximum = jsonschema.Ptr(float64(100))
+	searchInputSchema.Properties["fetchSize"].Default = json.RawMessage(`10`)
+	searchInputSchema.Properties["sortBy"].Enum = []any{sortByRelevance, sortByLastUpdatedDate, sortBySubmittedDate}
+	searchInputSchema.Properties["sortBy"].Default = json.RawMessage(`"` + sortByRelevance + `"`)
+	searchInputSchema.Properties["sortOrder"].Enum = []any{sortOrderAscending, sortOrderDescending}
+	searchInputSchema.Properties["sortOrder"].Default = json.RawMessage(`"` + sortOrderDescending + `"`)
+	searchInputSchema.Properties["fields"].Enum = entryFieldsValues
+	searchInputSchema.Properties["fields"].Default = json.RawMessage(`"` + entryFieldsFull + `"`)
+	searchInputSchema.Properties["normalizeText"].Types = nil
+	searchInputSchema.Properties["normalizeText"].Type = "boolean"
+	searchInputSchema.Properties["normalizeText"].Default = json.RawMessage(`true`)
+	searchOutputSchema, err := feedOutputSchema()
+	if err != nil {
+		return nil, nil, err
+	}
+	searchHandler, err := NewArxivToolHandler(searchInputSchema, searchOutputSchema, arxivSearch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create search handler: %w", err)
+	}
+	searchHandler.admission = arxivAdmission
+	searchHandler.describeQuery = describeSearch
+	searchHandler.coalesce = true
+	slog.Info("search handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "arxiv_search",
+		Description:  "Search arXiv for a boolean expression of words and double-quoted phrases in one field: title, abstract, author, comment, journal_ref or all. AND, OR, NOT (or +, |, -) and parentheses combine terms, with implicit AND between them. The output's interpretation shows the arXiv search query every term was turned into. Use arxiv_category_fetch_latest to filter by category.",
+		InputSchema:  searchInputSchema,
+		OutputSchema: searchOutputSchema,
+	}, searchHandler, nil
+}
+
+// advancedQueryExamples are example calls of the advanced query tool
+var advancedQueryExamples = []toolExample{
+	{
+		description: "Find the latest articles in either of two categories by an author",
+		arguments:   `{"category": "cs.LG OR stat.ML", "author": "hinton", "fetchSize": 1}`,
+		output: `{
+			"items": [
+				{
+					"title": "Forward-Forward Training of Deep Networks",
+					"abstract": "We revisit training deep networks with two forward passes instead of backpropagation...",
+					"absUrl": "https://arxiv.org/abs/2410.05120v1",
+					"pdfUrl": "https://arxiv.org/pdf/2410.05120v1",
+					"published": "2024-10-07T17:12:45Z",
+					"authors": ["G. Hinton"],
+					"categories": ["cs.LG", "stat.ML"],
+					"primaryCategory": "cs.LG",
+					"articleId": "2410.05120v1",
+					"announcedOn": "2024-10-07",
+					"listingDay": "2024-10-08"
+				}
+			],
+			"warnings": 0,
+			"pagination": {"totalResults": 31, "startIndex": 0, "itemsPerPage": 1, "nextStartIndex": 1},
+			"interpretation": {
+				"query": "(cat:cs.LG+OR+cat:stat.ML)+AND+(au:hinton)",
+				"terms": [
+					{"token": "cs.LG", "kind": "category", "clause": "cat:cs.LG"},
+					{"token": "stat.ML", "kind": "category", "clause": "cat:stat.ML"},
+					{"token": "hinton", "kind": "keyword", "clause": "au:hinton"}
+				]
+			}
+		}`,
+	},
+	{
+		description: "Scan the headlines of articles with a phrase in either the title or the abstract, leaving out computer vision",
+		arguments:   `{"title": "\"diffusion models\"", "abstract": "\"diffusion models\"", "join": "OR", "category": "-cs.CV", "fields": "headline", "fetchSize": 2}`,
+		output: `{
+			"items": [
+				{"title": "Diffusion Models for Protein Backbone Design", "articleId": "2410.04321v1", "primaryCategory": "q-bio.BM", "announcedOn": "2024-10-07"},
+				{"title": "Score Matching Meets Diffusion Models in Finance", "articleId": "2410.04102v1", "primaryCategory": "q-fin.CP", "announcedOn": "2024-10-07"}
+			],
+			"warnings": 0,
+			"pagination": {"totalResults": 2214, "startIndex": 0, "itemsPerPage": 2, "nextStartIndex": 2},
+			"interpretation": {
+				"query": "((ti:%22diffusion+models%22)+OR+(abs:%22diffusion+models%22))+ANDNOT+(cat:cs.CV)",
+				"terms": [
+					{"token": "cs.CV", "kind": "category", "clause": "cat:cs.CV"},
+					{"token": "\"diffusion models\"", "kind": "phrase", "clause": "ti:%22diffusion+models%22"},
+					{"token": "\"diffusion models\"", "kind": "phrase", "clause": "abs:%22diffusion+models%22"}
+				]
+			}
+		}`,
+	},
+}
+
+// newAdvancedQueryTool builds the tool searching arXiv for expressions in several fields at once
+func newAdvancedQueryTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	advancedInputSchema, err := jsonschema.ForType(reflect.TypeFor[ArxivAdvancedQueryArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from ArxivAdvancedQueryArgs: %w", err)
+	}
+	advancedInputSchema.Properties["category"].Examples = []any{"cs.LG OR stat.ML", "cs.CL -cs.AI"}
+	advancedInputSchema.Properties["author"].Examples = []any{"hinton", "lecun OR bengio"}
+	advancedInputSchema.Properties["join"].Enum = []any{parser.JoinAnd, parser.JoinOr}
+	advancedInputSchema.Properties["join"].Default = json.RawMessage(`"` + parser.JoinAnd + `"`)
+	advancedInputSchema.Properties["fetchSize"].Minimum = jsonschema.Ptr(float64(1))
+	advancedInputSchema.Properties["fetchSize"].Maximum = jsonschema.Ptr(float64(100))
+	advancedInputSchema.Properties["fetchSize"].Default = json.RawMessage(`10`)
+	advancedInputSchema.Properties["sortBy"].Enum = []any{sortBySubmittedDate, sortByLastUpdatedDate, sortByRelevance}
+	advancedInputSchema.Properties["sortBy"].Default = json.RawMessage(`"` + sortBySubmittedDate + `"`)
+	advancedInputSchema.Properties["sortOrder"].Enum = []any{sortOrderAscending, sortOrderDescending}
+	advancedInputSchema.Properties["sortOrder"].Default = json.RawMessage(`"` + sortOrderDescending + `"`)
+	advancedInputSchema.Properties["fields"].Enum = entryFieldsValues
+	advancedInputSchema.Properties["fields"].Default = json.RawMessage(`"` + entryFieldsFull + `"`)
+	advancedInputSchema.Properties["normalizeText"].Types = nil
+	advancedInputSchema.Properties["normalizeText"].Type = "boolean"
+	advancedInputSchema.Properties["normalizeText"].Default = json.RawMessage(`true`)
+	advancedOutputSchema, err := feedOutputSchema()
+	if err != nil {
+		return nil, nil, err
+	}
+	advancedHandler, err := NewArxivToolHandler(advancedInputSchema, advancedOutputSchema, arxivAdvancedQuery)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create advanced query handler: %w", err)
+	}
+	advancedHandler.admission = arxivAdmission
+	advancedHandler.describeQuery = describeAdvancedQuery
+	advancedHandler.coalesce = true
+	advancedHandler.validateArgs = argsValidator(advancedQueryIssues)
+	slog.Info("advanced query handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "arxiv_advanced_query",
+		Description:  "Search arXiv for separate expressions of categories, authors, title words and abstract words at once, e.g., the latest cs.LG or stat.ML articles by an author. Every expression takes AND, OR, NOT (or +, |, -) and parentheses like arxiv_search and is searched in its own field; empty expressions are left out, and the others are combined with join (AND by default). An expression that only excludes, e.g., '-survey', is subtracted from the rest with ANDNOT. Results are newest first by default. The output's interpretation shows the arXiv search query.",
+		InputSchema:  advancedInputSchema,
+		OutputSchema: advancedOutputSchema,
+	}, advancedHandler, nil
+}
+
+// categoryFetchSortRules are the combinations of sortBy and sortOrder with other arguments of
+// category fetches that the input schema rejects: entries ranked by category relevance and the
+// listings of announcement periods are sorted newest first by submission
+func categoryFetchSortRules() []*jsonschema.Schema {
+	newestFirst := &jsonschema.Schema{
+		Properties: map[string]*jsonschema.Schema{
+			"sortOrder": {Enum: []any{sortOrderDescending}},
+		},
+	}
+	return []*jsonschema.Schema{
+		{
+			If: &jsonschema.Schema{
+				Properties: map[string]*jsonschema.Schema{"sortBy": {Const: jsonschema.Ptr[any](sortByCategoryRelevance)}},
+				Required:   []string{"sortBy"},
+			},
+			Then: newestFirst,
+		},
+		{
+			If: &jsonschema.Schema{
+				AnyOf: []*jsonschema.Schema{
+					{Required: []string{"announcedOn"}},
+					{Required: []string{"weekOf"}},
+					{Required: []string{"monthOf"}},
+				},
+			},
+			Then: &jsonschema.Schema{
+				Properties: map[string]*jsonschema.Schema{
+					"sortBy":    {Enum: []any{sortBySubmittedDate, sortByCategoryRelevance}},
+					"sortOrder": {Enum: []any{sortOrderDescending}},
+				},
+			},
+		},
+	}
+}
+
+// rawFieldsRule refuses includeFields together with raw, whose entries are not flattened
+func rawFieldsRule() *jsonschema.Schema {
+	return &jsonschema.Schema{
+		If: &jsonschema.Schema{
+			Properties: map[string]*jsonschema.Schema{"raw": {Const: jsonschema.Ptr[any](true)}},
+			Required:   []string{"raw"},
+		},
+		Then: &jsonschema.Schema{
+			Properties: map[string]*jsonschema.Schema{"includeFields": {MaxItems: jsonschema.Ptr(0)}},
+		},
+	}
+}
+
+// summaryFieldEnum lists the fields of flattened entries that includeFields may name
+func summaryFieldEnum() []any {
+	var names []any
+	for _, name := range summaryFieldNames {
+		if name != "errors" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// categoryTaxonomyExamples are example calls of the category taxonomy tool
+var categoryTaxonomyExamples = []toolExample{
+	{
+		description: "Fetch the whole taxonomy; the output is trimmed to one group and two categories",
+		arguments:   `{}`,
+		output: `{
+			"groups": {
+				"cs": {"code": "cs", "name": "Computer Science", "classification": "Computer Science"}
+			},
+			"categories": {
+				"cs.AI": {"code": "cs.AI", "name": "Artificial Intelligence", "description": "Covers all areas of AI except Vision, Robotics, Machine Learning, Multiagent Systems, and Computation and Language..."},
+				"cs.CL": {"code": "cs.CL", "name": "Computation and Language", "description": "Covers natural language processing..."}
+			},
+			"provenance": {"source": "live", "snapshotDate": "2026-01-07"}
+		}`,
+	},
+	{
+		description: "Take the taxonomy from the snapshot embedded in the server, without asking arXiv; the output is trimmed to one group and two categories",
+		arguments:   `{"source": "embedded"}`,
+		output: `{
+			"groups": {
+				"cs": {"code": "cs", "name": "Computer Science", "classification": "Computer Science"}
+			},
+			"categories": {
+				"cs.AI": {"code": "cs.AI", "name": "Artificial Intelligence", "description": ""},
+				"cs.CL": {"code": "cs.CL", "name": "Computation and Language", "description": ""}
+			},
+			"provenance": {"source": "embedded", "snapshotDate": "2025-06-01"}
+		}`,
+	},
+}
+
+// newCategoryTaxonomyTool builds the tool fetching the arXiv category taxonomy
+func newCategoryTaxonomyTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	taxonomyInputSchema := &jsonschema.Schema{
+		Type:                 "object",
+		AdditionalProperties: closedObject(),
+		Properties: map[string]*jsonschema.Schema{
+			"source": {
+				Description: "Where to take the taxonomy from: live fetches it from arXiv, embedded returns the snapshot compiled into the server without any network request, for reproducible results (its categories have no descriptions)",
+				Type:        "string",
+				Enum:        []any{taxonomySourceLive, taxonomySourceEmbedded},
+				Default:     json.RawMessage(`"` + taxonomySourceLive + `"`),
+			},
+		},
+	}
+	// Generate output schema from Taxonomy structure using reflection
+	taxonomyOutputSchema, err := jsonschema.ForType(reflect.TypeFor[Taxonomy](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from Taxonomy: %w", err)
+	}
+	taxonomyHandler, err := NewArxivToolHandler(taxonomyInputSchema, taxonomyOutputSchema, fetchCategoryTaxonomy)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create category taxonomy handler: %w", err)
+	}
+	taxonomyHandler.coalesce = true
+	slog.Info("category taxonomy handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "arxiv_get_category_taxonomy",
+		Description:  "Fetch the complete arXiv category taxonomy. Returns a nested structure with broad areas (e.g., 'cs') mapping to specific categories (e.g., 'cs.AI') with their descriptions. Data is fetched fresh from https://arxiv.org/category_taxonomy unless source is embedded, which returns the snapshot compiled into the server; provenance tells which",
+		InputSchema:  taxonomyInputSchema,
+		OutputSchema: taxonomyOutputSchema,
+	}, taxonomyHandler, nil
+}
+
+// relatedCategoriesExamples are example calls of the related categories tool
+var relatedCategoriesExamples = []toolExample{
+	{
+		description: "Find the categories related to cs.CL; the siblings are trimmed to two",
+		arguments:   `{"category": "cs.CL"}`,
+		output: `{
+			"category": {"code": "cs.CL", "name": "Computation and Language", "group": "cs"},
+			"adjacent": [
+				{"code": "cs.AI", "name": "Artificial Intelligence", "group": "cs", "reason": "Natural language processing is a core area of artificial intelligence research, and language models are studied in both."},
+				{"code": "cs.LG", "name": "Machine Learning", "group": "cs", "reason": "Language models are trained and analysed with machine learning methods."}
+			],
+			"siblings": [
+				{"code": "cs.AI", "name": "Artificial Intelligence", "group": "cs"},
+				{"code": "cs.IR", "name": "Information Retrieval", "group": "cs"}
+			],
+			"taxonomy": {"source": "embedded", "snapshotDate": "2025-06-01"}
+		}`,
+	},
+	{
+		description: "Find the archives next to an archive that is a category of its own; the siblings are trimmed to two",
+		arguments:   `{"category": "hep-th"}`,
+		output: `{
+			"category": {"code": "hep-th", "name": "High Energy Physics - Theory", "group": "hep-th", "description": "Formal aspects of quantum field theory, string theory and related areas."},
+			"adjacent": [],
+			"siblings": [
+				{"code": "gr-qc", "name": "General Relativity and Quantum Cosmology", "group": "gr-qc", "description": "Research in gravitational physics, general relativity and quantum cosmology."},
+				{"code": "hep-ph", "name": "High Energy Physics - Phenomenology", "group": "hep-ph", "description": "Theoretical particle physics and its interrelation with experiment."}
+			],
+			"taxonomy": {"source": "embedded", "snapshotDate": "2025-06-01"}
+		}`,
+	},
+}
+
+// newRelatedCategoriesTool builds the tool listing the categories related to a category
+func newRelatedCategoriesTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	relatedInputSchema, err := jsonschema.ForType(reflect.TypeFor[ArxivRelatedCategoriesArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from ArxivRelatedCategoriesArgs: %w", err)
+	}
+	relatedOutputSchema, err := jsonschema.ForType(reflect.TypeFor[RelatedCategoriesResult](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from RelatedCategoriesResult: %w", err)
+	}
+	relatedHandler, err := NewArxivToolHandler(relatedInputSchema, relatedOutputSchema, relatedCategories)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create related categories handler: %w", err)
+	}
+	slog.Info("related categories handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "arxiv_related_categories",
+		Description:  "List the arXiv categories related to a category, without any request to arXiv: the categories of other archives or fields well known to cover adjacent research, e.g., cs.AI and cs.LG for cs.CL or cs.LG for stat.ML, from a curated table, and the other categories of its archive, with their names. Set expandRelated on arxiv_category_fetch_latest to search the adjacent categories along with the category.",
+		InputSchema:  relatedInputSchema,
+		OutputSchema: relatedOutputSchema,
+	}, relatedHandler, nil
+}
+
+// fetchByIDExamples are example calls of the fetch by ID tool
+var fetchByIDExamples = []toolExample{
+	{
+		description: "Fetch two articles, one of them by a specific version",
+		arguments:   `{"ids": ["2405.12345", "1706.03762v7"]}`,
+		output: `{
+			"items": [
+				{
+					"title": "An Example Article",
+					"link": "http://arxiv.org/abs/2405.12345v2",
+					"published": "2024-05-20T17:30:00Z",
+					"authors": [{"name": "E. Author"}],
+					"categories": ["cs.LG"],
+					"articleId": "2405.12345v2"
+				},
+				{
+					"title": "Attention Is All You Need",
+					"link": "http://arxiv.org/abs/1706.03762v7",
+					"published": "2017-06-12T17:57:34Z",
+					"authors": [{"name": "Ashish Vaswani"}, {"name": "Noam Shazeer"}],
+					"categories": ["cs.CL", "cs.LG"],
+					"articleId": "1706.03762v7"
+				}
+			],
+			"resolutions": [
+				{"id": "2405.12345", "articleId": "2405.12345v2", "status": "found"},
+				{"id": "1706.03762v7", "articleId": "1706.03762v7", "status": "found"}
+			],
+			"batches": 1,
+			"warnings": 0
+		}`,
+	},
+	{
+		description: "Fetch by citation and old-style identifier, with one identifier that is invalid",
+		arguments:   `{"ids": ["arXiv:hep-th/9901001", "not-an-id"]}`,
+		output: `{
+			"items": [
+				{
+					"title": "An Old-Style Article",
+					"link": "http://arxiv.org/abs/hep-th/9901001v1",
+					"published": "1999-01-01T00:00:00Z",
+					"categories": ["hep-th"],
+					"articleId": "hep-th/9901001v1"
+				}
+			],
+			"resolutions": [
+				{"id": "arXiv:hep-th/9901001", "articleId": "hep-th/9901001v1", "status": "found"},
+				{"id": "not-an-id", "status": "invalid", "error": "invalid arXiv identifier \"not-an-id\": expected YYMM.NNNNN or archive/YYMMNNN, optionally followed by vN"}
+			],
+			"batches": 1,
+			"warnings": 0
+		}`,
+	},
+	{
+		description: "Estimate the cost of a fetch recording its articles in the library, before making it",
+		arguments:   `{"ids": ["2405.12345", "1706.03762", "2405.12345v2"], "recordToLibrary": true, "estimateOnly": true}`,
+		output: `{
+			"items": [],
+			"resolutions": [
+				{"id": "2405.12345", "status": "not_fetched"},
+				{"id": "1706.03762", "status": "not_fetched"},
+				{"id": "2405.12345v2", "status": "not_fetched"}
+			],
+			"batches": 0,
+			"warnings": 0,
+			"estimate": {
+				"arxivRequests": 1,
+				"estimatedSeconds": 0,
+				"storageWrites": 1,
+				"estimatedBytes": 0,
+				"items": 3,
+				"skipped": [{"id": "1706.03762", "reason": "already_stored"}]
+			}
+		}`,
+	},
+}
+
+// newFetchByIDTool builds the tool fetching articles by identifier
+func newFetchByIDTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	fetchByIDInputSchema, err := jsonschema.ForType(reflect.TypeFor[ArxivFetchByIDArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from ArxivFetchByIDArgs: %w", err)
+	}
+	fetchByIDInputSchema.Properties["ids"].MinItems = jsonschema.Ptr(1)
+	fetchByIDInputSchema.Properties["ids"].MaxItems = jsonschema.Ptr(maxFetchByIDCount)
+	fetchByIDOutputSchema, err := jsonschema.ForType(reflect.TypeFor[FetchByIDResult](), &jsonschema.ForOptions{
+		TypeSchemas: feedTypeSchemas(),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from FetchByIDResult: %w", err)
+	}
+	fetchByIDHandler, err := NewArxivToolHandler(fetchByIDInputSchema, fetchByIDOutputSchema, fetchByID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create fetch by ID handler: %w", err)
+	}
+	fetchByIDHandler.admission = arxivAdmission
+	fetchByIDHandler.supportsEstimate = true
+	fetchByIDHandler.coalesce = true
+	fetchByIDHandler.validateArgs = argsValidator(fetchByIDIssues)
+	slog.Info("fetch by ID handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "arxiv_fetch_by_id",
+		Description:  "Fetch arXiv articles by identifier. Long lists are split into id_list requests of OPUS_MCP_ARXIV_ID_LIST_BATCH_SIZE identifiers, made one after another within the arXiv rate limit. Entries are returned in the order requested, with a resolution status for every identifier. With estimateOnly, returns what the fetch would cost, in arXiv requests and time, without making it.",
+		InputSchema:  fetchByIDInputSchema,
+		OutputSchema: fetchByIDOutputSchema,
+	}, fetchByIDHandler, nil
+}
+
+// absMetadataExamples are example calls of the abs page metadata tool
+var absMetadataExamples = []toolExample{
+	{
+		description: "Fetch the abs page of the latest version of an article",
+		arguments:   `{"id": "1706.03762"}`,
+		output: `{
+			"source": "abs-page",
+			"articleId": "1706.03762v7",
+			"title": "Attention Is All You Need",
+			"authors": ["Ashish Vaswani", "Noam Shazeer"],
+			"abstract": "The dominant sequence transduction models are based on complex recurrent or convolutional neural networks...",
+			"comments": "15 pages, 5 figures",
+			"primaryCategory": "cs.CL",
+			"categories": ["cs.CL", "cs.LG"],
+			"submitter": "Ashish Vaswani",
+			"submissionHistory": [
+				{"version": "v1", "submitted": "2017-06-12T17:57:34Z", "size": "1,102 KB"},
+				{"version": "v7", "submitted": "2023-08-02T00:41:18Z", "size": "1,124 KB"}
+			],
+			"licenseUrl": "http://arxiv.org/licenses/nonexclusive-distrib/1.0/",
+			"semanticScholarUrl": "https://api.semanticscholar.org/arXiv:1706.03762"
+		}`,
+	},
+	{
+		description: "Check whether an old-style article was withdrawn, falling back to the API when the page cannot be parsed",
+		arguments:   `{"id": "arXiv:hep-th/9901001"}`,
+		output: `{
+			"source": "api",
+			"articleId": "hep-th/9901001v1",
+			"title": "An Old-Style Article",
+			"authors": ["E. Author"],
+			"primaryCategory": "hep-th",
+			"categories": ["hep-th"],
+			"warnings": ["abs page layout not recognized: no title or versioned identifier; returned the arXiv API record instead, which has no submission history, submitter, license or external links"]
+		}`,
+	},
+}
+
+// newAbsMetadataTool builds the tool fetching the metadata of an article from its abs page
+func newAbsMetadataTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	absInputSchema, err := jsonschema.ForType(reflect.TypeFor[ArxivGetAbsMetadataArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from ArxivGetAbsMetadataArgs: %w", err)
+	}
+	absOutputSchema, err := jsonschema.ForType(reflect.TypeFor[AbsMetadata](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from AbsMetadata: %w", err)
+	}
+	absHandler, err := NewArxivToolHandler(absInputSchema, absOutputSchema, getAbsMetadata)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create abs metadata handler: %w", err)
+	}
+	absHandler.admission = arxivAdmission
+	absHandler.coalesce = true
+	slog.Info("abs metadata handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "arxiv_get_abs_metadata",
+		Description:  "Fetch the metadata of a single arXiv article from its abs page, within the arXiv rate limit. The page reflects new versions and withdrawals sooner than the API and adds the submission history, submitter, license and INSPIRE and Semantic Scholar links. If the page layout cannot be parsed, the API record is returned instead with source set to api.",
+		InputSchema:  absInputSchema,
+		OutputSchema: absOutputSchema,
+	}, absHandler, nil
+}
+
+// getArticleExamples are example calls of the single article tool
+var getArticleExamples = []toolExample{
+	{
+		description: "Get the metadata of an article from its abs page URL",
+		arguments:   `{"id": "https://arxiv.org/abs/1706.03762"}`,
+		output: `{
+			"articleId": "1706.03762v7",
+			"title": "Attention Is All You Need",
+			"authors": ["Ashish Vaswani", "Noam Shazeer"],
+			"abstract": "The dominant sequence transduction models are based on complex recurrent or convolutional neural networks...",
+			"primaryCategory": "cs.CL",
+			"categories": ["cs.CL", "cs.LG"],
+			"comment": "15 pages, 5 figures",
+			"published": "2017-06-12T17:57:34Z",
+			"updated": "2023-08-02T00:41:18Z",
+			"links": {"abs": "https://arxiv.org/abs/1706.03762v7", "pdf": "https://arxiv.org/pdf/1706.03762v7"}
+		}`,
+	},
+	{
+		description: "Get a published version of an article, with its DOI and journal reference",
+		arguments:   `{"id": "2005.14165v4"}`,
+		output: `{
+			"articleId": "2005.14165v4",
+			"title": "Language Models are Few-Shot Learners",
+			"authors": ["Tom B. Brown", "Benjamin Mann"],
+			"abstract": "Recent work has demonstrated substantial gains on many NLP tasks and benchmarks...",
+			"primaryCategory": "cs.CL",
+			"categories": ["cs.CL"],
+			"doi": "10.48550/arXiv.2005.14165",
+			"journalRef": "Advances in Neural Information Processing Systems 33 (2020)",
+			"comment": "40+32 pages",
+			"published": "2020-05-28T17:29:03Z",
+			"updated": "2020-07-22T19:47:17Z",
+			"links": {"abs": "https://arxiv.org/abs/2005.14165v4", "pdf": "https://arxiv.org/pdf/2005.14165v4"}
+		}`,
+	},
+}
+
+// newGetArticleTool builds the tool fetching the metadata of a single article from the arXiv API
+func newGetArticleTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	articleInputSchema, err := jsonschema.ForType(reflect.TypeFor[ArxivGetArticleArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from ArxivGetArticleArgs: %w", err)
+	}
+	articleInputSchema.Properties["id"].MinLength = jsonschema.Ptr(1)
+	articleInputSchema.Properties["normalizeText"].Types = nil
+	articleInputSchema.Properties["normalizeText"].Type = "boolean"
+	articleInputSchema.Properties["normalizeText"].Default = json.RawMessage(`true`)
+	articleOutputSchema, err := jsonschema.ForType(reflect.TypeFor[ArticleRecord](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from ArticleRecord: %w", err)
+	}
+	articleHandler, err := NewArxivToolHandler(articleInputSchema, articleOutputSchema, getArticle)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create article handler: %w", err)
+	}
+	articleHandler.admission = arxivAdmission
+	articleHandler.coalesce = true
+	articleHandler.validateArgs = argsValidator(getArticleIssues)
+	slog.Info("article handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "arxiv_get_article",
+		Description:  "Get the metadata of a single arXiv article by identifier or abs/pdf URL from the arXiv API, within the arXiv rate limit: title, authors, abstract, primary and other categories, DOI, journal reference, comment, publication and update times, and the abs and PDF links. An article arXiv does not have is reported as ARTICLE_NOT_FOUND. Use arxiv_fetch_by_id for several articles at once.",
+		InputSchema:  articleInputSchema,
+		OutputSchema: articleOutputSchema,
+	}, articleHandler, nil
+}
+
+// identifiersResolveExamples are example calls of the identifier resolution tool
+var identifiersResolveExamples = []toolExample{
+	{
+		description: "Resolve an arXiv DOI without querying any service",
+		arguments:   `{"doi": "https://doi.org/10.48550/arXiv.1706.03762"}`,
+		output: `{
+			"articleId": "1706.03762",
+			"confidence": "exact",
+			"resolvedBy": "arxiv_doi",
+			"path": [{"step": "arxiv_doi", "outcome": "resolved", "detail": "DOI 10.48550/arXiv.1706.03762"}]
+		}`,
+	},
+	{
+		description: "Resolve the DOI of a published article to its preprint through Crossref",
+		arguments:   `{"doi": "10.1038/s41586-021-03819-2"}`,
+		output: `{
+			"articleId": "2107.09564",
+			"confidence": "high",
+			"resolvedBy": "crossref",
+			"path": [
+				{"step": "arxiv_doi", "outcome": "no_match", "detail": "no arXiv DOI or identifier in the input"},
+				{"step": "crossref", "outcome": "resolved", "detail": "Crossref record of DOI 10.1038/s41586-021-03819-2: has-preprint"}
+			]
+		}`,
+	},
+	{
+		description: "Match a citation through Semantic Scholar when Crossref is not configured",
+		arguments:   `{"citation": "Vaswani et al. Attention is all you need. NeurIPS 2017."}`,
+		output: `{
+			"articleId": "1706.03762",
+			"confidence": "medium",
+			"resolvedBy": "semantic_scholar",
+			"path": [
+				{"step": "arxiv_doi", "outcome": "no_match", "detail": "no arXiv DOI or identifier in the input"},
+				{"step": "crossref", "outcome": "skipped", "detail": "OPUS_MCP_CROSSREF_MAILTO is not set"},
+				{"step": "semantic_scholar", "outcome": "resolved", "detail": "Semantic Scholar match for the citation: externalIds.ArXiv"}
+			]
+		}`,
+	},
+}
+
+// newIdentifiersResolveTool builds the tool resolving DOIs, Semantic Scholar IDs and citations to
+// arXiv articles
+func newIdentifiersResolveTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	resolveInputSchema, err := jsonschema.ForType(reflect.TypeFor[IdentifiersResolveArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from IdentifiersResolveArgs: %w", err)
+	}
+	resolveOutputSchema, err := jsonschema.ForType(reflect.TypeFor[IdentifierResolution](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from IdentifierResolution: %w", err)
+	}
+	resolveOutputSchema.Properties["confidence"].Enum = []any{confidenceExact, confidenceHigh, confidenceMedium}
+	resolveHandler, err := NewArxivToolHandler(resolveInputSchema, resolveOutputSchema, identifiersResolve)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create identifier resolution handler: %w", err)
+	}
+	resolveHandler.coalesce = true
+	resolveHandler.validateArgs = argsValidator(identifiersResolveIssues)
+	slog.Info("identifier resolution handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "identifiers_resolve",
+		Description:  "Resolve a DOI, Semantic Scholar paper ID or free-form citation to an arXiv identifier, trying in order the arXiv DOI pattern (10.48550/arXiv.<id>) or an arXiv identifier in the citation, the arXiv relations of the Crossref record (when OPUS_MCP_CROSSREF_MAILTO is set) and the external identifiers of the Semantic Scholar record (when OPUS_MCP_SEMANTIC_SCHOLAR_ENABLED is set), each within its own rate limit. Reports the steps tried, the one that resolved and its confidence; an identifier no step resolves is reported as IDENTIFIER_NOT_FOUND with the steps tried.",
+		InputSchema:  resolveInputSchema,
+		OutputSchema: resolveOutputSchema,
+	}, resolveHandler, nil
+}
+
+// downloadPDFExamples are example calls of the PDF download tool
+var downloadPDFExamples = []toolExample{
+	{
+		description: "Download an article by identifier and store it in the bucket",
+		arguments:   `{"articleId": "2405.12345v2"}`,
+		output: `{
+			"success": true,
+			"message": "Successfully downloaded arXiv PDF and uploaded to S3 bucket 'opus-mcp-articles' as 'arxiv/2405.12345v2.pdf'",
+			"input": "2405.12345v2",
+			"articleId": "2405.12345v2",
+			"objectName": "arxiv/2405.12345v2.pdf",
+			"bucket": "opus-mcp-articles",
+			"size": 1048576,
+			"etag": "9b2cf535f27731c974343645a3985328",
+			"sha256": "3f5a1e8b9c0d2e4f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f",
+			"originalFilename": "2405.12345v2.pdf",
+			"servedArticleId": "2405.12345v2"
+		}`,
+	},
+	{
+		description: "Queue the download of an article by URL in the background",
+		arguments:   `{"articleUrl": "https://arxiv.org/abs/1706.03762", "async": true}`,
+		output: `{
+			"success": true,
+			"message": "Queued the download as job 'a1b2c3d4e5f60718'; check on it with the download_job_status tool",
+			"input": "https://arxiv.org/abs/1706.03762",
+			"articleId": "1706.03762",
+			"objectName": "arxiv/1706.03762.pdf",
+			"jobId": "a1b2c3d4e5f60718"
+		}`,
+	},
+	{
+		description: "Download an article and store a summary of it generated by the calling client",
+		arguments:   `{"articleId": "1706.03762v7", "generateSummary": true}`,
+		output: `{
+			"success": true,
+			"message": "Successfully downloaded arXiv PDF and uploaded to S3 bucket 'opus-mcp-articles' as 'arxiv/1706.03762v7.pdf'",
+			"input": "1706.03762v7",
+			"articleId": "1706.03762v7",
+			"objectName": "arxiv/1706.03762v7.pdf",
+			"bucket": "opus-mcp-articles",
+			"size": 2215244,
+			"etag": "f1c2b3a4d5e6f70819a0b1c2d3e4f506",
+			"sha256": "bdfaa68d8984f0dc02beaca527b76f207d99b666d31d1da728ee0728182df697",
+			"originalFilename": "1706.03762v7.pdf",
+			"servedArticleId": "1706.03762v7",
+			"summaryObjectName": "summaries/1706.03762v7.md"
+		}`,
+	},
+}
+
+// newDownloadPDFTool builds the tool downloading arXiv PDFs to S3
+func newDownloadPDFTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	downloadPDFInputSchema, err := jsonschema.ForType(reflect.TypeFor[ArxivDownloadPDFArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from ArxivDownloadPDFArgs: %w", err)
+	}
+	setCollisionPolicies(downloadPDFInputSchema, storage.CollisionOverwrite)
+	downloadPDFOutputSchema, err := jsonschema.ForType(reflect.TypeFor[ArxivDownloadPDFOutput](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from ArxivDownloadPDFOutput: %w", err)
+	}
+	downloadPDFHandler, err := NewArxivToolHandler(downloadPDFInputSchema, downloadPDFOutputSchema, downloadPDFToS3)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create arXiv PDF download handler: %w", err)
+	}
+	downloadPDFHandler.validateArgs = argsValidator(downloadPDFIssues)
+	slog.Info("arXiv PDF download handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "arxiv_download_pdf",
+		Description:  "Download an arXiv PDF by URL, identifier, citation (e.g., arXiv:2405.12345v2 [cs.CL]) or DataCite DOI and upload it to a S3 bucket, e.g., over MinIO. Requires S3 credentials. The PDF will be stored in the 'arxiv/' prefix within the '" + metadata.S3_ARTICLES_BUCKET + "' bucket. Set async to return a jobId immediately and follow the transfer with download_job_status. Set generateSummary to have this client summarize the article through MCP sampling, stored under the 'summaries/' prefix.",
+		InputSchema:  downloadPDFInputSchema,
+		OutputSchema: downloadPDFOutputSchema,
+	}, downloadPDFHandler, nil
+}
+
+// downloadJobStatusExamples are example calls of the download job status tool
+var downloadJobStatusExamples = []toolExample{
+	{
+		description: "Check on a queued download that is still running",
+		arguments:   `{"jobId": "a1b2c3d4e5f60718"}`,
+		output: `{
+			"jobId": "a1b2c3d4e5f60718",
+			"status": "running",
+			"input": "https://arxiv.org/abs/1706.03762",
+			"articleId": "1706.03762",
+			"objectName": "arxiv/1706.03762.pdf",
+			"createdAt": "2024-11-07T10:00:00Z",
+			"startedAt": "2024-11-07T10:00:01Z"
+		}`,
+	},
+	{
+		description: "Check on a queued download that has succeeded",
+		arguments:   `{"jobId": "a1b2c3d4e5f60718"}`,
+		output: `{
+			"jobId": "a1b2c3d4e5f60718",
+			"status": "succeeded",
+			"input": "https://arxiv.org/abs/1706.03762",
+			"articleId": "1706.03762",
+			"objectName": "arxiv/1706.03762.pdf",
+			"createdAt": "2024-11-07T10:00:00Z",
+			"startedAt": "2024-11-07T10:00:01Z",
+			"finishedAt": "2024-11-07T10:00:04Z",
+			"expiresAt": "2024-11-07T11:00:04Z",
+			"result": {
+				"success": true,
+				"message": "Successfully downloaded arXiv PDF and uploaded to S3 bucket 'opus-mcp-articles' as 'arxiv/1706.03762.pdf'",
+				"input": "https://arxiv.org/abs/1706.03762",
+				"articleId": "1706.03762",
+				"objectName": "arxiv/1706.03762.pdf",
+				"bucket": "opus-mcp-articles",
+				"size": 2215244,
+				"etag": "f1c2b3a4d5e6f70819a0b1c2d3e4f506",
+				"sha256": "bdfaa68d8984f0dc02beaca527b76f207d99b666d31d1da728ee0728182df697"
+			}
+		}`,
+	},
+}
+
+// newDownloadJobStatusTool builds the tool reporting on background PDF downloads
+func newDownloadJobStatusTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	jobStatusInputSchema, err := jsonschema.ForType(reflect.TypeFor[DownloadJobStatusArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from DownloadJobStatusArgs: %w", err)
+	}
+	jobStatusOutputSchema, err := jsonschema.ForType(reflect.TypeFor[DownloadJob](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from DownloadJob: %w", err)
+	}
+	jobStatusHandler, err := NewArxivToolHandler(jobStatusInputSchema, jobStatusOutputSchema, downloadJobStatus)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create download job status handler: %w", err)
+	}
+	slog.Info("download job status handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "download_job_status",
+		Description:  "Check on a PDF download queued with the async option of arxiv_download_pdf: queued, running, succeeded with the download result, or failed with the error. Finished jobs can be queried for OPUS_MCP_DOWNLOAD_JOB_TTL, after which they are reported as JOB_NOT_FOUND.",
+		InputSchema:  jobStatusInputSchema,
+		OutputSchema: jobStatusOutputSchema,
+	}, jobStatusHandler, nil
+}
+
+// libraryProvenanceExamples are example calls of the library provenance tool
+var libraryProvenanceExamples = []toolExample{
+	{
+		description: "Look up why an article downloaded after a category fetch is in the library",
+		arguments:   `{"objectName": "arxiv/2411.04321v1.pdf"}`,
+		output: `{
+			"found": true,
+			"entry": {
+				"objectName": "arxiv/2411.04321v1.pdf",
+				"bucket": "opus-mcp-articles",
+				"articleId": "2411.04321v1",
+				"sourceUrl": "https://arxiv.org/pdf/2411.04321v1",
+				"sha256": "3f5a1e8b9c0d2e4f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f",
+				"size": 1048576,
+				"provenance": {
+					"tool": "arxiv_download_pdf",
+					"queryTool": "arxiv_category_fetch_latest",
+					"query": "cs.AI",
+					"sessionId": "8X2KQ4ZJ3M5N7P9R",
+					"client": "example-client 1.0.0",
+					"clientId": "token:5e884898da280471",
+					"timestamp": "2024-11-07T10:00:04Z"
+				}
+			}
+		}`,
+	},
+	{
+		description: "Look up an object that is not in the library index",
+		arguments:   `{"objectName": "arxiv/0000.00000.pdf"}`,
+		output:      `{"found": false}`,
+	},
+}
+
+// newLibraryProvenanceTool builds the tool looking up why a stored article is in the library
+func newLibraryProvenanceTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	provenanceInputSchema, err := jsonschema.ForType(reflect.TypeFor[LibraryProvenanceArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from LibraryProvenanceArgs: %w", err)
+	}
+	provenanceOutputSchema, err := jsonschema.ForType(reflect.TypeFor[LibraryProvenanceOutput](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from LibraryProvenanceOutput: %w", err)
+	}
+	provenanceHandler, err := NewArxivToolHandler(provenanceInputSchema, provenanceOutputSchema, libraryProvenance)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create library provenance handler: %w", err)
+	}
+	slog.Info("library provenance handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "library_provenance",
+		Description:  "Look up why a stored article is in the '" + metadata.S3_ARTICLES_BUCKET + "' bucket: the tool that stored it, the search expression or ID list in the same session whose results contained it (when determinable), the session and client identity, and when it was stored.",
+		InputSchema:  provenanceInputSchema,
+		OutputSchema: provenanceOutputSchema,
+	}, provenanceHandler, nil
+}
+
+// libraryExportExamples are example calls of the library export tool
+var libraryExportExamples = []toolExample{
+	{
+		description: "Export the arXiv articles stored in November 2024 as BibTeX",
+		arguments:   `{"format": "bibtex", "prefix": "arxiv/", "storedSince": "2024-11-01", "storedUntil": "2024-11-30"}`,
+		output: `{
+			"objectName": "exports/20241201T090000Z.bib",
+			"format": "bibtex",
+			"entries": 42,
+			"size": 11904
+		}`,
+	},
+	{
+		description: "Export the whole library as JSON Lines, with a URL to download it from",
+		arguments:   `{"format": "jsonl", "presign": true}`,
+		output: `{
+			"objectName": "exports/20241201T090000Z.jsonl",
+			"format": "jsonl",
+			"entries": 1250,
+			"size": 702318,
+			"streamed": true,
+			"presignedUrl": "https://s3.example.com/opus-mcp-articles/exports/20241201T090000Z.jsonl?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Expires=3600&X-Amz-Signature=...",
+			"expiresAt": "2024-12-01T10:00:00Z"
+		}`,
+	},
+	{
+		description: "Estimate the size of a CSV export of the library without storing it",
+		arguments:   `{"format": "csv", "estimateOnly": true}`,
+		output: `{
+			"objectName": "exports/20241201T090000Z.csv",
+			"format": "csv",
+			"entries": 1250,
+			"size": 268411,
+			"streamed": true,
+			"estimate": {
+				"arxivRequests": 0,
+				"estimatedSeconds": 0,
+				"storageWrites": 1,
+				"estimatedBytes": 268411,
+				"items": 1250
+			}
+		}`,
+	},
+}
+
+// newLibraryExportTool builds the tool exporting the library index to an object in the bucket
+func newLibraryExportTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	exportInputSchema, err := jsonschema.ForType(reflect.TypeFor[LibraryExportArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from LibraryExportArgs: %w", err)
+	}
+	exportOutputSchema, err := jsonschema.ForType(reflect.TypeFor[LibraryExportOutput](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from LibraryExportOutput: %w", err)
+	}
+	exportHandler, err := NewArxivToolHandler(exportInputSchema, exportOutputSchema, libraryExport)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create library export handler: %w", err)
+	}
+	exportHandler.validateArgs = argsValidator(libraryExportIssues)
+	slog.Info("library export handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "library_export",
+		Description:  "Export the metadata of the articles stored in the '" + metadata.S3_ARTICLES_BUCKET + "' bucket, as recorded in the library index, to an object under " + exportObjectPrefix + " in the same bucket: as JSON Lines, BibTeX or CSV. Filter by object name prefix and by the UTC dates on which articles were stored. Returns the object name, the number of entries and the size, and a presigned download URL on request; read the export back with s3_read_object_chunk. With estimateOnly, returns the size the export would have without storing it.",
+		InputSchema:  exportInputSchema,
+		OutputSchema: exportOutputSchema,
+	}, exportHandler, nil
+}
+
+// libraryCleanupExamples are example calls of the library cleanup tool
+var libraryCleanupExamples = []toolExample{
+	{
+		description: "Plan removing exports older than 30 days and superseded article versions with their text",
+		arguments:   `{"rules": {"olderThanDays": {"exports/": 30}, "keepLatestVersionOnly": true, "removeOrphanedText": true}}`,
+		output: `{
+			"dryRun": true,
+			"objects": [
+				{"objectName": "arxiv/2405.12345v1.pdf", "size": 1048576, "lastModified": "2024-05-21T09:00:00Z", "reasons": ["superseded by the later version arxiv/2405.12345v2.pdf"]},
+				{"objectName": "arxiv/2405.12345v1.txt", "size": 0, "lastModified": "2024-05-21T09:00:02Z", "reasons": ["orphaned text: its PDF arxiv/2405.12345v1.pdf is removed by this cleanup"]},
+				{"objectName": "exports/20241001T090000Z.csv", "size": 4096, "lastModified": "2024-10-01T09:00:00Z", "reasons": ["last modified more than 30 days ago, under \"exports/\""]}
+			],
+			"totalBytes": 1052672,
+			"removed": 0,
+			"removedBytes": 0,
+			"indexEntriesRemoved": 0,
+			"protectedPrefixes": ["library/", "jobs/", "state/"]
+		}`,
+	},
+	{
+		description: "Execute the same cleanup, one of whose objects could not be removed",
+		arguments:   `{"rules": {"olderThanDays": {"exports/": 30}, "keepLatestVersionOnly": true, "removeOrphanedText": true}, "confirm": true}`,
+		output: `{
+			"dryRun": false,
+			"objects": [
+				{"objectName": "arxiv/2405.12345v1.pdf", "size": 1048576, "lastModified": "2024-05-21T09:00:00Z", "reasons": ["superseded by the later version arxiv/2405.12345v2.pdf"]},
+				{"objectName": "arxiv/2405.12345v1.txt", "size": 0, "lastModified": "2024-05-21T09:00:02Z", "reasons": ["orphaned text: its PDF arxiv/2405.12345v1.pdf is removed by this cleanup"]},
+				{"objectName": "exports/20241001T090000Z.csv", "size": 4096, "lastModified": "2024-10-01T09:00:00Z", "reasons": ["last modified more than 30 days ago, under \"exports/\""]}
+			],
+			"totalBytes": 1052672,
+			"approval": "confirm",
+			"removed": 2,
+			"removedBytes": 1048576,
+			"failed": [{"objectName": "exports/20241001T090000Z.csv", "error": "failed to remove object: access denied"}],
+			"indexEntriesRemoved": 1,
+			"protectedPrefixes": ["library/", "jobs/", "state/"]
+		}`,
+	},
+}
+
+// newLibraryCleanupTool builds the tool removing objects from the articles bucket by rules
+func newLibraryCleanupTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	cleanupInputSchema, err := jsonschema.ForType(reflect.TypeFor[LibraryCleanupArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from LibraryCleanupArgs: %w", err)
+	}
+	if olderThanDays := cleanupInputSchema.Properties["rules"].Properties["olderThanDays"]; olderThanDays.AdditionalProperties != nil {
+		olderThanDays.AdditionalProperties.Minimum = jsonschema.Ptr(float64(1))
+	}
+	cleanupOutputSchema, err := jsonschema.ForType(reflect.TypeFor[LibraryCleanupOutput](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from LibraryCleanupOutput: %w", err)
+	}
+	cleanupHandler, err := NewArxivToolHandler(cleanupInputSchema, cleanupOutputSchema, libraryCleanup)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create library cleanup handler: %w", err)
+	}
+	cleanupHandler.validateArgs = argsValidator(libraryCleanupIssues)
+	slog.Info("library cleanup handler created successfully")
+
+	return &mcp.Tool{
+		Name:        "library_cleanup",
+		Description: "Remove objects from the '" + metadata.S3_ARTICLES_BUCKET + "' bucket by declarative rules: objects older than a number of days by prefix, superseded versions of arXiv PDFs, and text files whose PDF is gone. Only plans the cleanup by default, listing every selected object with its size and the reasons; call again with confirm, or with requestApproval to ask the user through elicitation, to remove them. Removed objects are deleted from the library index and recorded in the audit log; objects that fail to be removed are reported and kept. The server's own state under library/, jobs/ and state/ is never removed. Over HTTP, only clients presenting the admin token may remove objects; anyone may plan.",
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Clean up the library",
+			ReadOnlyHint:    false,
+			DestructiveHint: jsonschema.Ptr(true),
+			IdempotentHint:  true,
+			OpenWorldHint:   jsonschema.Ptr(false),
+		},
+		InputSchema:  cleanupInputSchema,
+		OutputSchema: cleanupOutputSchema,
+	}, cleanupHandler, nil
+}
+
+// readObjectChunkExamples are example calls of the object chunk read tool
+var readObjectChunkExamples = []toolExample{
+	{
+		description: "Read the first 8 bytes of a stored PDF",
+		arguments:   `{"objectName": "arxiv/2405.12345v2.pdf", "offset": 0, "length": 8}`,
+		output: `{
+			"objectName": "arxiv/2405.12345v2.pdf",
+			"offset": 0,
+			"length": 8,
+			"totalSize": 1048576,
+			"data": "JVBERi0xLjUK",
+			"done": false,
+			"nextOffset": 8
+		}`,
+	},
+	{
+		description: "Read the last chunk of a stored PDF",
+		arguments:   `{"objectName": "arxiv/2405.12345v2.pdf", "offset": 1048570}`,
+		output: `{
+			"objectName": "arxiv/2405.12345v2.pdf",
+			"offset": 1048570,
+			"length": 6,
+			"totalSize": 1048576,
+			"data": "JSVFT0YK",
+			"done": true,
+			"nextOffset": 1048576
+		}`,
+	},
+}
+
+// newReadObjectChunkTool builds the tool reading stored objects in chunks
+func newReadObjectChunkTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	readChunkInputSchema, err := jsonschema.ForType(reflect.TypeFor[S3ReadObjectChunkArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from S3ReadObjectChunkArgs: %w", err)
+	}
+	readChunkInputSchema.Properties["offset"].Minimum = jsonschema.Ptr(float64(0))
+	readChunkInputSchema.Properties["length"].Minimum = jsonschema.Ptr(float64(1))
+	readChunkInputSchema.Properties["length"].Maximum = jsonschema.Ptr(float64(maxObjectChunkLength))
+	readChunkInputSchema.Properties["delivery"].Enum = []any{deliveryInline, deliveryLink}
+	readChunkOutputSchema, err := jsonschema.ForType(reflect.TypeFor[S3ReadObjectChunkOutput](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from S3ReadObjectChunkOutput: %w", err)
+	}
+	readChunkHandler, err := NewArxivToolHandler(readChunkInputSchema, readChunkOutputSchema, readObjectChunk)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create object chunk read handler: %w", err)
+	}
+	slog.Info("object chunk read handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "s3_read_object_chunk",
+		Description:  "Read a byte range of a stored PDF, summary or library export (under the 'arxiv/', 'summaries/' or 'exports/' prefix in the '" + metadata.S3_ARTICLES_BUCKET + "' bucket) as base64, at most 4 MiB per call. Start at offset 0 and keep reading from nextOffset until done is true to reassemble the file. With delivery=link, which clients supporting resource links get by default, returns a presigned URL of the whole file instead.",
+		InputSchema:  readChunkInputSchema,
+		OutputSchema: readChunkOutputSchema,
+	}, readChunkHandler, nil
+}
+
+// urlDownloadExamples are example calls of the URL download tool
+var urlDownloadExamples = []toolExample{
+	{
+		description: "Store the supplementary material of an article from an allowlisted host",
+		arguments:   `{"url": "https://arxiv.org/src/2405.12345v2/anc/data.csv", "objectName": "2405.12345/data.csv"}`,
+		output: `{
+			"success": true,
+			"message": "Successfully downloaded URL and uploaded to S3 bucket 'opus-mcp-articles' as 'web/2405.12345/data.csv'",
+			"sourceUrl": "https://arxiv.org/src/2405.12345v2/anc/data.csv",
+			"objectName": "web/2405.12345/data.csv",
+			"bucket": "opus-mcp-articles",
+			"size": 20480,
+			"etag": "0a1b2c3d4e5f60718293a4b5c6d7e8f9",
+			"sha256": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+		}`,
+	},
+	{
+		description: "Store a release asset from a subdomain of an allowlisted host",
+		arguments:   `{"url": "https://objects.githubusercontent.com/example/model-weights.tar.gz", "objectName": "releases/model-weights.tar.gz"}`,
+		output: `{
+			"success": true,
+			"message": "Successfully downloaded URL and uploaded to S3 bucket 'opus-mcp-articles' as 'web/releases/model-weights.tar.gz'",
+			"sourceUrl": "https://objects.githubusercontent.com/example/model-weights.tar.gz",
+			"objectName": "web/releases/model-weights.tar.gz",
+			"bucket": "opus-mcp-articles",
+			"size": 73400320,
+			"etag": "4d2f0c8e1b7a9365f0e2d4c6b8a1f3e5-9",
+			"sha256": "e3b7c1a9f5d2086b4c7e1f9a3d5b8c0e2f4a6d8b1c3e5f7a9b0d2c4e6f8a1b3c"
+		}`,
+	},
+	{
+		description: "Keep both files when another site's download already took the name",
+		arguments:   `{"url": "https://github.com/example/project/releases/download/v2.0/paper.pdf", "objectName": "paper.pdf", "onCollision": "rename"}`,
+		output: `{
+			"success": true,
+			"message": "Successfully downloaded URL and uploaded to S3 bucket 'opus-mcp-articles' as 'web/paper-5d41402abc4b.pdf' because 'web/paper.pdf' was taken",
+			"sourceUrl": "https://github.com/example/project/releases/download/v2.0/paper.pdf",
+			"objectName": "web/paper-5d41402abc4b.pdf",
+			"requestedObjectName": "web/paper.pdf",
+			"bucket": "opus-mcp-articles",
+			"size": 482133,
+			"etag": "7c2e9f1a3b5d4c6e8f0a2b4c6d8e0f1a",
+			"sha256": "5d41402abc4b2a76b9719d911017c592a3e1f6c8d0b2e4f6a8c0e2d4f6a8b0c2"
+		}`,
+	},
+}
+
+// setCollisionPolicies restricts the onCollision property of an upload tool's input schema to the
+// collision policies, documenting the tool's default
+func setCollisionPolicies(schema *jsonschema.Schema, fallback storage.CollisionPolicy) {
+	property := schema.Properties["onCollision"]
+	for _, policy := range storage.CollisionPolicies {
+		property.Enum = append(property.Enum, string(policy))
+	}
+	property.Default = json.RawMessage(`"` + string(fallback) + `"`)
+}
+
+// newURLDownloadTool builds the tool downloading allowlisted URLs to S3
+func newURLDownloadTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	urlDownloadInputSchema, err := jsonschema.ForType(reflect.TypeFor[URLDownloadArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from URLDownloadArgs: %w", err)
+	}
+	urlDownloadInputSchema.Properties["url"].Format = "uri"
+	setCollisionPolicies(urlDownloadInputSchema, storage.CollisionError)
+	urlDownloadOutputSchema, err := jsonschema.ForType(reflect.TypeFor[URLDownloadOutput](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from URLDownloadOutput: %w", err)
+	}
+	urlDownloadHandler, err := NewArxivToolHandler(urlDownloadInputSchema, urlDownloadOutputSchema, downloadURLToS3)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create URL download handler: %w", err)
+	}
+	slog.Info("URL download handler created successfully")
+
+	return &mcp.Tool{
+		Name:        "url_download_to_storage",
+		Description: "Download a file from an allowlisted URL (e.g., supplementary material on a publisher site or a GitHub release) and upload it to the '" + metadata.S3_ARTICLES_BUCKET + "' bucket under the 'web/' prefix with the given object name. Hosts outside OPUS_MCP_DOWNLOAD_ALLOWED_HOSTS and private network addresses are refused with a POLICY_VIOLATION error.",
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Download URL to storage",
+			ReadOnlyHint:    false,
+			DestructiveHint: jsonschema.Ptr(true),
+			IdempotentHint:  true,
+			OpenWorldHint:   jsonschema.Ptr(true),
+		},
+		InputSchema:  urlDownloadInputSchema,
+		OutputSchema: urlDownloadOutputSchema,
+	}, urlDownloadHandler, nil
+}
+
+// verifyAttestationExamples are example calls of the attestation verification tool
+var verifyAttestationExamples = []toolExample{
+	{
+		description: "Verify the attestation of a PDF that is still stored unchanged",
+		arguments: `{
+			"attestation": {
+				"claim": {
+					"bucket": "opus-mcp-articles",
+					"objectName": "arxiv/2405.12345v2.pdf",
+					"sha256": "3f5a1e8b9c0d2e4f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f",
+					"size": 1048576,
+					"sourceUrl": "https://arxiv.org/pdf/2405.12345v2",
+					"timestamp": "2024-11-07T10:00:04Z"
+				},
+				"algorithm": "ed25519",
+				"keyId": "7d865e959b2466918c9863afca942d0f",
+				"signature": "0PLm4mbf4xQIen7FgMyMDEdc/kpaB/7s+gJVV9ftihRoY78iEnrNC6y33xQ37oDNjajvXuqOTVXq4dc7AE7SOg=="
+			}
+		}`,
+		output: `{
+			"valid": true,
+			"signatureValid": true,
+			"objectMatches": true,
+			"keyId": "7d865e959b2466918c9863afca942d0f"
+		}`,
+	},
+	{
+		description: "Verify an attestation whose object has since been replaced",
+		arguments: `{
+			"attestation": {
+				"claim": {
+					"bucket": "opus-mcp-articles",
+					"objectName": "arxiv/2405.12345v2.pdf",
+					"sha256": "3f5a1e8b9c0d2e4f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f",
+					"size": 1048576,
+					"sourceUrl": "https://arxiv.org/pdf/2405.12345v2",
+					"timestamp": "2024-11-07T10:00:04Z"
+				},
+				"algorithm": "ed25519",
+				"keyId": "7d865e959b2466918c9863afca942d0f",
+				"signature": "0PLm4mbf4xQIen7FgMyMDEdc/kpaB/7s+gJVV9ftihRoY78iEnrNC6y33xQ37oDNjajvXuqOTVXq4dc7AE7SOg=="
+			}
+		}`,
+		output: `{
+			"valid": false,
+			"signatureValid": true,
+			"objectMatches": false,
+			"keyId": "7d865e959b2466918c9863afca942d0f",
+			"problems": ["stored object digest 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08 does not match the claimed digest 3f5a1e8b9c0d2e4f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f"]
+		}`,
+	},
+}
+
+// newVerifyAttestationTool builds the tool verifying attestations of stored objects
+func newVerifyAttestationTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	verifyInputSchema, err := jsonschema.ForType(reflect.TypeFor[VerifyAttestationArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from VerifyAttestationArgs: %w", err)
+	}
+	verifyOutputSchema, err := jsonschema.ForType(reflect.TypeFor[VerifyAttestationOutput](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from VerifyAttestationOutput: %w", err)
+	}
+	verifyHandler, err := NewArxivToolHandler(verifyInputSchema, verifyOutputSchema, verifyAttestation)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create attestation verification handler: %w", err)
+	}
+	slog.Info("attestation verification handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "verify_attestation",
+		Description:  "Verify an attestation returned by the arxiv_download_pdf tool: checks the Ed25519 signature against this server's public key and that the object currently stored in the bucket still has the claimed SHA-256 digest and size.",
+		InputSchema:  verifyInputSchema,
+		OutputSchema: verifyOutputSchema,
+	}, verifyHandler, nil
+}
+
+// schemaInfoExamples are example calls of the schema info tool
+var schemaInfoExamples = []toolExample{
+	{
+		description: "List the schema versions of the tools, trimmed to two tools",
+		arguments:   `{}`,
+		output: `{
+			"tools": [
+				{"name": "arxiv_category_fetch_latest", "schemaVersion": 2, "schemaHash": "4c1f0e3b2a5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f7"},
+				{"name": "arxiv_fetch_by_id", "schemaVersion": 1, "schemaHash": "0e9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d0c9b8a7f6e5d4c3b2a1f0e9d"}
+			]
+		}`,
+	},
+}
+
+// newSchemaInfoTool builds the tool describing the schema versions of the tools in a catalog
+func newSchemaInfoTool(catalog *toolCatalog) (*mcp.Tool, *ArxivToolHandler, error) {
+	schemaInfoInputSchema := &jsonschema.Schema{
+		Type:                 "object",
+		Properties:           map[string]*jsonschema.Schema{},
+		AdditionalProperties: closedObject(),
+	}
+	schemaInfoOutputSchema, err := jsonschema.ForType(reflect.TypeFor[ServerSchemaInfoOutput](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from ServerSchemaInfoOutput: %w", err)
+	}
+	schemaInfoHandler, err := NewArxivToolHandler(schemaInfoInputSchema, schemaInfoOutputSchema, catalog.serverSchemaInfo)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create schema info handler: %w", err)
+	}
+	slog.Info("schema info handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "server_schema_info",
+		Description:  "List the schema version and schema hash of every tool on this server. Every tool output carries its schemaVersion; clients can record these at session start to pin versions and detect schema changes between releases.",
+		InputSchema:  schemaInfoInputSchema,
+		OutputSchema: schemaInfoOutputSchema,
+	}, schemaInfoHandler, nil
+}
+
+// serverStatusExamples are example calls of the server status tool
+var serverStatusExamples = []toolExample{
+	{
+		description: "Check how busy the server is and how much of the daily arXiv limit is left",
+		arguments:   `{}`,
+		output: `{
+			"status": "ready",
+			"admission": {"queueDepth": 2, "estimatedWaitSeconds": 6, "maxWaitSeconds": 30},
+			"arxivQuota": {"day": "2026-01-07", "used": 412, "limit": 1000, "remaining": 588, "resetsAt": "2026-01-08T00:00:00Z"},
+			"clock": {"skewSeconds": 0.4, "source": "export.arxiv.org", "measuredAt": "2026-01-07T10:00:00Z", "thresholdSeconds": 120, "exceedsThreshold": false, "corrected": false},
+			"storage": {"minFreeBytes": 1073741824, "supported": true, "totalBytes": 107374182400, "freeBytes": 53687091200, "full": false, "checkedAt": "2026-01-07T09:59:30Z"},
+			"downloadJobs": {"queued": 1, "running": 1, "failedLastHour": 0}
+		}`,
+	},
+}
+
+// newServerStatusTool builds the tool reporting the readiness of the server
+func newServerStatusTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	serverStatusInputSchema := &jsonschema.Schema{
+		Type:                 "object",
+		Properties:           map[string]*jsonschema.Schema{},
+		AdditionalProperties: closedObject(),
+	}
+	serverStatusOutputSchema, err := jsonschema.ForType(reflect.TypeFor[ServerStatusOutput](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from ServerStatusOutput: %w", err)
+	}
+	serverStatusHandler, err := NewArxivToolHandler(serverStatusInputSchema, serverStatusOutputSchema, serverStatus)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create server status handler: %w", err)
+	}
+	slog.Info("server status handler created successfully")
+
+	return &mcp.Tool{
+		Name:        "server_status",
+		Description: "Show the readiness report of the server, the same document as the /ready endpoint: the queue depth and estimated wait of rate-limited tool calls, the arXiv requests used and remaining today against the daily limit, the skew of the server clock, the last known storage capacity, the state of background downloads and estimates of download throughput. Use it to decide whether to make expensive calls now or later.",
+		Annotations: &mcp.ToolAnnotations{
+			Title:          "Server status",
+			ReadOnlyHint:   true,
+			IdempotentHint: true,
+			OpenWorldHint:  jsonschema.Ptr(false),
+		},
+		InputSchema:  serverStatusInputSchema,
+		OutputSchema: serverStatusOutputSchema,
+	}, serverStatusHandler, nil
+}
+
+// serverConfigExamples are example calls of the server configuration tool
+var serverConfigExamples = []toolExample{
+	{
+		description: "Show the effective configuration, trimmed to two sections",
+		arguments:   `{}`,
+		output: `{
+			"sections": [
+				{
+					"name": "S3Config",
+					"fields": [
+						{"name": "Endpoint", "env": "OPUS_MCP_S3_ENDPOINT", "value": "minio.staging.internal:9000", "source": "file"},
+						{"name": "AccessKey", "env": "OPUS_MCP_S3_ACCESS_KEY", "secret": true, "fingerprint": {"length": 20, "sha256Prefix": "3f9a61c2"}, "source": "env"},
+						{"name": "SecretKey", "env": "OPUS_MCP_S3_SECRET_KEY", "secret": true, "fingerprint": {"length": 40, "sha256Prefix": "b07d2e54"}, "source": "env"},
+						{"name": "UseSSL", "env": "OPUS_MCP_S3_USE_SSL", "value": true, "source": "default"},
+						{"name": "InsecureSkipVerify", "env": "OPUS_MCP_S3_INSECURE_SKIP_VERIFY", "value": false, "source": "default"}
+					]
+				},
+				{
+					"name": "flags",
+					"fields": [
+						{"name": "port", "flag": "-port", "value": "8080", "source": "flag"},
+						{"name": "transport", "flag": "-transport", "value": "http", "source": "flag"}
+					]
+				}
+			]
+		}`,
+	},
+}
+
+// newServerConfigTool builds the tool reporting the effective configuration of the server
+func newServerConfigTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	serverConfigInputSchema := &jsonschema.Schema{
+		Type:                 "object",
+		Properties:           map[string]*jsonschema.Schema{},
+		AdditionalProperties: closedObject(),
+	}
+	serverConfigOutputSchema, err := jsonschema.ForType(reflect.TypeFor[ServerConfigOutput](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from ServerConfigOutput: %w", err)
+	}
+	serverConfigHandler, err := NewArxivToolHandler(serverConfigInputSchema, serverConfigOutputSchema, serverConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create server config handler: %w", err)
+	}
+	slog.Info("server config handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "server_config",
+		Description:  "Show the fully resolved configuration of the server, with the source of every value (default, env, file or flag) and secrets replaced by their length and a SHA-256 prefix. Over HTTP, only clients presenting the admin token may call it.",
+		InputSchema:  serverConfigInputSchema,
+		OutputSchema: serverConfigOutputSchema,
+	}, serverConfigHandler, nil
+}
+
+// serverSelftestExamples are example calls of the self-test tool
+var serverSelftestExamples = []toolExample{
+	{
+		description: "Check every subsystem of a new deployment",
+		arguments:   `{}`,
+		output: `{
+			"passed": true,
+			"checks": [
+				{"name": "parser", "status": "pass", "durationMs": 0, "detail": "cs.AI AND \"large language models\" was parsed into (cat:cs.AI+AND+all:%22large+language+models%22)"},
+				{"name": "arxiv", "status": "pass", "durationMs": 812, "detail": "fetched 1706.03762v7: Attention Is All You Need"},
+				{"name": "taxonomy", "status": "pass", "durationMs": 640, "detail": "fetched taxonomy with 38 groups and 155 categories"},
+				{"name": "storage", "status": "pass", "durationMs": 37, "detail": "uploaded, stat and deleted selftest/probe-1718000000000000000.txt in bucket opus-mcp-articles"}
+			]
+		}`,
+	},
+	{
+		description: "Smoke-test an offline deployment without storage",
+		arguments:   `{"skipNetwork": true}`,
+		output: `{
+			"passed": true,
+			"checks": [
+				{"name": "parser", "status": "pass", "durationMs": 0, "detail": "cs.AI AND \"large language models\" was parsed into (cat:cs.AI+AND+all:%22large+language+models%22)"},
+				{"name": "arxiv", "status": "skip", "durationMs": 0, "detail": "skipNetwork is set"},
+				{"name": "taxonomy", "status": "pass", "durationMs": 0, "detail": "embedded taxonomy snapshot with 155 categories"},
+				{"name": "storage", "status": "skip", "durationMs": 0, "detail": "S3 storage is not configured"}
+			]
+		}`,
+	},
+}
+
+// newServerSelftestTool builds the tool exercising every subsystem of the server end to end
+func newServerSelftestTool() (*mcp.Tool, *ArxivToolHandler, error) {
+	selftestInputSchema, err := jsonschema.ForType(reflect.TypeFor[ServerSelftestArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from ServerSelftestArgs: %w", err)
+	}
+	selftestOutputSchema, err := jsonschema.ForType(reflect.TypeFor[ServerSelftestOutput](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from ServerSelftestOutput: %w", err)
+	}
+	selftestOutputSchema.Properties["checks"].Items.Properties["status"].Enum = []any{selftestPass, selftestFail, selftestSkip}
+	selftestHandler, err := NewArxivToolHandler(selftestInputSchema, selftestOutputSchema, serverSelftest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create self-test handler: %w", err)
+	}
+	slog.Info("self-test handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "server_selftest",
+		Description:  "Check that every subsystem of the server works end to end: parse a known category expression, fetch one article from arXiv within the rate limit and daily quota, fetch and parse the category taxonomy, and, if S3 storage is configured, upload, stat and delete a probe object under the 'selftest/' prefix. Returns a pass, fail or skip report per check with its duration; every check is bounded by its own timeout. Set skipNetwork to skip arXiv for an offline smoke test. Over HTTP, only clients presenting the admin token may call it.",
+		InputSchema:  selftestInputSchema,
+		OutputSchema: selftestOutputSchema,
+	}, selftestHandler, nil
+}
+
+// toolExamplesExamples are example calls of the tool examples tool
+var toolExamplesExamples = []toolExample{
+	{
+		description: "Get the examples of a single tool, trimmed to one example",
+		arguments:   `{"tool": "arxiv_fetch_by_id"}`,
+		output: `{
+			"tools": [
+				{
+					"name": "arxiv_fetch_by_id",
+					"examples": [
+						{
+							"description": "Fetch an article by identifier",
+							"arguments": {"ids": ["1706.03762"]},
+							"output": {"schemaVersion": 1, "items": [], "resolutions": [{"id": "1706.03762", "status": "not_found"}], "batches": 1, "warnings": 0}
+						}
+					]
+				}
+			]
+		}`,
+	},
+	{
+		description: "Get the examples of every tool, trimmed to one tool without arguments",
+		arguments:   `{}`,
+		output: `{
+			"tools": [
+				{
+					"name": "server_schema_info",
+					"examples": [
+						{
+							"description": "List the schema versions of the tools",
+							"arguments": {},
+							"output": {"schemaVersion": 1, "tools": [{"name": "server_schema_info", "schemaVersion": 1, "schemaHash": "0e9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d0c9b8a7f6e5d4c3b2a1f0e9d"}]}
+						}
+					]
+				}
+			]
+		}`,
+	},
+}
+
+// newToolExamplesTool builds the tool returning example calls of the tools in a catalog
+func newToolExamplesTool(catalog *toolCatalog) (*mcp.Tool, *ArxivToolHandler, error) {
+	examplesInputSchema, err := jsonschema.ForType(reflect.TypeFor[GetToolExamplesArgs](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect input schema from GetToolExamplesArgs: %w", err)
+	}
+	examplesOutputSchema, err := jsonschema.ForType(reflect.TypeFor[GetToolExamplesOutput](), &jsonschema.ForOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reflect output schema from GetToolExamplesOutput: %w", err)
+	}
+	toolExamplesHandler, err := NewArxivToolHandler(examplesInputSchema, examplesOutputSchema, catalog.getToolExamples)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create tool examples handler: %w", err)
+	}
+	slog.Info("tool examples handler created successfully")
+
+	return &mcp.Tool{
+		Name:         "get_tool_examples",
+		Description:  "Get realistic example calls of the tools on this server, with their arguments and trimmed outputs, to learn how to call a tool beyond its schemas. The same examples are served over HTTP at /examples.json.",
+		InputSchema:  examplesInputSchema,
+		OutputSchema: examplesOutputSchema,
+	}, toolExamplesHandler, nil
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"opus-mcp/internal/storage"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// testToolFactory builds a trivial tool with the given name
+func testToolFactory(t *testing.T, name string) toolFactory {
+	return toolFactory{name: name, build: func() (*mcp.Tool, *ArxivToolHandler, error) {
+		handler := newTestToolHandler(t, nil)
+		return &mcp.Tool{
+			Name:         name,
+			InputSchema:  &jsonschema.Schema{Type: "object"},
+			OutputSchema: &jsonschema.Schema{Type: "object"},
+		}, handler, nil
+	}}
+}
+
+func TestRegisterToolsIsolatesFailingFactory(t *testing.T) {
+	factories := []toolFactory{
+		testToolFactory(t, "arxiv_category_fetch_latest"),
+		{name: "arxiv_get_category_taxonomy", build: func() (*mcp.Tool, *ArxivToolHandler, error) {
+			return nil, nil, errors.New("failed to reflect output schema: cycle in type Extension")
+		}},
+		{name: "arxiv_fetch_by_id", build: func() (*mcp.Tool, *ArxivToolHandler, error) {
+			panic("unexpected type")
+		}},
+		{name: "arxiv_download_pdf", disabled: "S3 storage is not configured"},
+		testToolFactory(t, "library_provenance"),
+	}
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test-server", Version: "v0.0.1"}, nil)
+	registration, err := registerTools(server, factories)
+	if err != nil {
+		t.Fatalf("registerTools() unexpected error: %v", err)
+	}
+
+	wantRegistered := []string{"arxiv_category_fetch_latest", "library_provenance", "get_tool_examples", "server_schema_info"}
+	if strings.Join(registration.Registered, ",") != strings.Join(wantRegistered, ",") {
+		t.Errorf("registered tools = %v, want %v", registration.Registered, wantRegistered)
+	}
+	if len(registration.Degraded) != 2 {
+		t.Fatalf("degraded tools = %+v, want the failing and the panicking tool", registration.Degraded)
+	}
+	if registration.Degraded[0].Name != "arxiv_get_category_taxonomy" || !strings.Contains(registration.Degraded[0].Error, "cycle") {
+		t.Errorf("first degraded tool = %+v, want the schema failure", registration.Degraded[0])
+	}
+	if registration.Degraded[1].Name != "arxiv_fetch_by_id" || !strings.Contains(registration.Degraded[1].Error, "panic") {
+		t.Errorf("second degraded tool = %+v, want the recovered panic", registration.Degraded[1])
+	}
+	if len(registration.Disabled) != 1 || registration.Disabled[0].Name != "arxiv_download_pdf" {
+		t.Errorf("disabled tools = %+v, want arxiv_download_pdf", registration.Disabled)
+	}
+}
+
+func TestRegisterToolsFailsWithoutTools(t *testing.T) {
+	failing := func() (*mcp.Tool, *ArxivToolHandler, error) { return nil, nil, errors.New("schema failure") }
+	factories := []toolFactory{
+		{name: "arxiv_category_fetch_latest", build: failing},
+		{name: "arxiv_get_category_taxonomy", build: failing},
+	}
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test-server", Version: "v0.0.1"}, nil)
+	registration, err := registerTools(server, factories)
+	if err == nil {
+		t.Fatal("registerTools() with every factory failing should fail")
+	}
+	if len(registration.Registered) != 0 || len(registration.Degraded) != 2 {
+		t.Errorf("registration = %+v, want no registered and 2 degraded tools", registration)
+	}
+}
+
+func TestHealthReportsDegradedTools(t *testing.T) {
+	original := toolRegistrationStatus()
+	t.Cleanup(func() { registeredTools = original })
+
+	for _, tt := range []struct {
+		name         string
+		registration toolRegistration
+		wantStatus   string
+	}{
+		{"All registered", toolRegistration{Registered: []string{"arxiv_category_fetch_latest"}}, "ok"},
+		{"Degraded", toolRegistration{
+			Registered: []string{"arxiv_get_category_taxonomy"},
+			Degraded:   []DegradedTool{{Name: "arxiv_category_fetch_latest", Error: "schema failure"}},
+		}, "degraded"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			registeredTools = tt.registration
+			rec := httptest.NewRecorder()
+			healthCheckHandler(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			var body struct {
+				Status string           `json:"status"`
+				Tools  toolRegistration `json:"tools"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to unmarshal health response: %v", err)
+			}
+			if body.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", body.Status, tt.wantStatus)
+			}
+			if len(body.Tools.Degraded) != len(tt.registration.Degraded) || len(body.Tools.Registered) != len(tt.registration.Registered) {
+				t.Errorf("tools = %+v, want %+v", body.Tools, tt.registration)
+			}
+		})
+	}
+}
+
+func TestHealthReportsS3Endpoints(t *testing.T) {
+	original := globalS3Config
+	t.Cleanup(func() { globalS3Config = original })
+	globalS3Config = &storage.S3Config{Endpoint: "minio-a:9000,minio-b:9000"}
+
+	rec := httptest.NewRecorder()
+	healthCheckHandler(rec, httptest.NewRequest(http.MethodGet, "/health?verbose=true", nil))
+	var body struct {
+		S3Endpoint  string                  `json:"s3Endpoint"`
+		S3Endpoints []storage.EndpointState `json:"s3Endpoints"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to unmarshal health response: %v", err)
+	}
+	if body.S3Endpoint != "minio-a:9000" {
+		t.Errorf("s3Endpoint = %q, want the first endpoint", body.S3Endpoint)
+	}
+	if len(body.S3Endpoints) != 2 || !body.S3Endpoints[0].Active || body.S3Endpoints[1].Active {
+		t.Errorf("s3Endpoints = %+v, want both endpoints with the first active", body.S3Endpoints)
+	}
+}
+
+func TestListToolsReportsDisabledTools(t *testing.T) {
+	t.Setenv("OPUS_MCP_S3_ENDPOINT", "")
+	// ListTools loads the configuration into the package variables
+	original := toolRegistrationStatus()
+	s3Config, lib, signer, cal := globalS3Config, globalLibrary, globalSigner, announcementCalendar
+	generic, batchSize, maxWait := genericDownloadEnabled, idListBatchSize, arxivAdmission.maxWait
+	t.Cleanup(func() {
+		registeredTools = original
+		globalS3Config, globalLibrary, globalSigner, announcementCalendar = s3Config, lib, signer, cal
+		genericDownloadEnabled, idListBatchSize, arxivAdmission.maxWait = generic, batchSize, maxWait
+	})
+
+	var out bytes.Buffer
+	if code := ListTools(&out); code != 0 {
+		t.Errorf("ListTools() = %d, want 0\n%s", code, out.String())
+	}
+	for _, want := range []string{"arxiv_category_fetch_latest", "registered", "arxiv_download_pdf", "disabled: S3 storage is not configured"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("ListTools() output should contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"opus-mcp/internal/taxonomy"
+)
+
+// ArxivRelatedCategoriesArgs defines the input parameters for the related categories tool
+type ArxivRelatedCategoriesArgs struct {
+	Category string `json:"category" jsonschema:"The arXiv category code to find related categories of, e.g., cs.CL or hep-th"`
+}
+
+// RelatedCategory is a category of the taxonomy, with why it is related when it is adjacent
+type RelatedCategory struct {
+	Code  string `json:"code" jsonschema:"The category code"`
+	Name  string `json:"name" jsonschema:"The name of the category"`
+	Group string `json:"group" jsonschema:"The code of the arXiv archive the category belongs to"`
+	// Description is only known for categories that are an archive of their own
+	Description string `json:"description,omitempty" jsonschema:"What the category covers, for categories that are an archive of their own such as hep-th; the taxonomy has no descriptions of the categories within an archive"`
+	Reason      string `json:"reason,omitempty" jsonschema:"Why the category is adjacent, for adjacent categories"`
+}
+
+// RelatedCategoriesResult defines the output structure for the related categories tool
+type RelatedCategoriesResult struct {
+	Category RelatedCategory     `json:"category" jsonschema:"The category that was asked for, with its code normalized"`
+	Adjacent []RelatedCategory   `json:"adjacent" jsonschema:"Categories of other archives or fields that are well known to cover adjacent research, from a curated table; these are the categories expandRelated adds to a category fetch"`
+	Siblings []RelatedCategory   `json:"siblings" jsonschema:"The other categories of the category's archive, sorted by code; for a category that is an archive of its own, the other such archives of its area"`
+	Taxonomy taxonomy.Provenance `json:"taxonomy" jsonschema:"Where the taxonomy the categories were taken from came from and how current it is"`
+}
+
+// relatedCategory describes a category of the snapshot
+func relatedCategory(s *taxonomy.Snapshot, c taxonomy.Category) RelatedCategory {
+	related := RelatedCategory{Code: c.Code, Name: c.Name, Group: c.Group}
+	if g, ok := s.Group(c.Group); ok && c.Code == c.Group {
+		related.Description = g.Description
+	}
+	return related
+}
+
+// relatedCategories returns the categories adjacent to and in the same archive as a category,
+// without any request to arXiv
+func relatedCategories(ctx context.Context, input json.RawMessage) (any, error) {
+	var args ArxivRelatedCategoriesArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+	s := taxonomy.Embedded()
+	c, ok := s.Category(args.Category)
+	if !ok {
+		return nil, invalidInputError([]ValidationIssue{{
+			Fields:  []string{"category"},
+			Message: fmt.Sprintf("%q is not a category of the arXiv taxonomy, which is %s; see arxiv_get_category_taxonomy for the categories", args.Category, s.Provenance()),
+		}})
+	}
+
+	result := &RelatedCategoriesResult{
+		Category: relatedCategory(s, c),
+		Adjacent: []RelatedCategory{},
+		Siblings: []RelatedCategory{},
+		Taxonomy: s.Provenance(),
+	}
+	for _, a := range s.Adjacent(c.Code) {
+		related := relatedCategory(s, a.Category)
+		related.Reason = a.Reason
+		result.Adjacent = append(result.Adjacent, related)
+	}
+	for _, sibling := range s.Siblings(c.Code) {
+		result.Siblings = append(result.Siblings, relatedCategory(s, sibling))
+	}
+	return result, nil
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRelatedCategories(t *testing.T) {
+	output, err := relatedCategories(context.Background(), json.RawMessage(`{"category": "CS.cl"}`))
+	if err != nil {
+		t.Fatalf("relatedCategories() unexpected error: %v", err)
+	}
+	result := output.(*RelatedCategoriesResult)
+	if result.Category.Code != "cs.CL" || result.Category.Name != "Computation and Language" || result.Category.Description != "" {
+		t.Errorf("category = %+v, want cs.CL normalized, without a description", result.Category)
+	}
+	if len(result.Adjacent) != 2 || result.Adjacent[0].Code != "cs.AI" || result.Adjacent[1].Code != "cs.LG" || result.Adjacent[0].Reason == "" {
+		t.Errorf("adjacent = %+v, want cs.AI and cs.LG with reasons", result.Adjacent)
+	}
+	if len(result.Siblings) != 39 || result.Siblings[0].Name == "" {
+		t.Errorf("got %d siblings, want the 39 other named cs categories", len(result.Siblings))
+	}
+
+	output, err = relatedCategories(context.Background(), json.RawMessage(`{"category": "hep-th"}`))
+	if err != nil {
+		t.Fatalf("relatedCategories() unexpected error: %v", err)
+	}
+	result = output.(*RelatedCategoriesResult)
+	if result.Category.Description == "" || len(result.Adjacent) != 0 || len(result.Siblings) != 8 || result.Siblings[0].Description == "" {
+		t.Errorf("relatedCategories(hep-th) = %+v, want 8 described archives and nothing adjacent", result)
+	}
+
+	_, err = relatedCategories(context.Background(), json.RawMessage(`{"category": "cs.ZZ"}`))
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeInvalidInput {
+		t.Errorf("relatedCategories(cs.ZZ) error = %v, want INVALID_INPUT", err)
+	}
+}
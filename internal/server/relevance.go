@@ -0,0 +1,105 @@
+package server
+
+import (
+	"slices"
+	"strings"
+
+	"opus-mcp/internal/parser"
+)
+
+const (
+	// sortBySubmittedDate keeps arXiv's order, newest submissions first
+	sortBySubmittedDate = "submittedDate"
+	// sortByLastUpdatedDate has arXiv order entries by the submission of their latest version
+	sortByLastUpdatedDate = "lastUpdatedDate"
+	// sortByRelevance has arXiv order entries by how well they match the query
+	sortByRelevance = "relevance"
+	// sortByCategoryRelevance puts entries submitted to a queried category before cross-lists
+	sortByCategoryRelevance = "categoryRelevance"
+)
+
+// sortByValues are the valid values of the sortBy argument of category fetches
+var sortByValues = []any{sortBySubmittedDate, sortByLastUpdatedDate, sortByRelevance, sortByCategoryRelevance}
+
+// Directions arXiv can sort entries in
+const (
+	sortOrderDescending = "descending"
+	sortOrderAscending  = "ascending"
+)
+
+// arxivSortBy returns the order arXiv is asked to sort entries by for a sortBy argument; entries
+// ranked by category relevance are fetched newest first and reordered after
+func arxivSortBy(sortBy string) string {
+	if sortBy == "" || sortBy == sortByCategoryRelevance {
+		return sortBySubmittedDate
+	}
+	return sortBy
+}
+
+const (
+	// rankPrimaryCategory is the category rank of entries whose primary category was queried
+	rankPrimaryCategory = 1
+	// rankCrossList is the category rank of all other entries, which only matched through cross-lists
+	// or keywords
+	rankCrossList = 2
+)
+
+// queryCategories returns the category codes named by an interpreted expression, including those
+// passed through with an explicit cat: prefix
+func queryCategories(interpretation *parser.Interpretation) []string {
+	if interpretation == nil {
+		return nil
+	}
+	var categories []string
+	for _, term := range interpretation.Terms {
+		switch {
+		case term.Kind == parser.TermCategory:
+			categories = append(categories, term.Token)
+			categories = append(categories, term.Related...)
+		case term.Kind == parser.TermField && strings.HasPrefix(term.Token, "cat:"):
+			categories = append(categories, strings.Trim(strings.TrimPrefix(term.Token, "cat:"), `"`))
+		}
+	}
+	return categories
+}
+
+// inQueriedCategory reports whether a category is one of the queried categories, or belongs to a
+// queried archive such as math or hep-th
+func inQueriedCategory(category string, queried []string) bool {
+	if category == "" {
+		return false
+	}
+	for _, code := range queried {
+		if strings.EqualFold(category, code) || (!strings.Contains(code, ".") && strings.HasPrefix(strings.ToLower(category), strings.ToLower(code)+".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// rankByCategoryRelevance orders entries whose primary category is among the queried categories
+// before the rest, newest submissions first within each rank, and records every entry's rank.
+// Entries without a submission date go last within their rank, in their original order.
+func rankByCategoryRelevance(items []*FeedEntry, queried []string) {
+	for _, entry := range items {
+		entry.CategoryRank = rankCrossList
+		if inQueriedCategory(entry.PrimaryCategory, queried) {
+			entry.CategoryRank = rankPrimaryCategory
+		}
+	}
+	slices.SortStableFunc(items, func(a, b *FeedEntry) int {
+		if a.CategoryRank != b.CategoryRank {
+			return a.CategoryRank - b.CategoryRank
+		}
+		return entrySubmitted(b).Compare(entrySubmitted(a))
+	})
+}
+
+// rankByRelevance records arXiv's relevance order as the rank of every entry of a page starting at
+// startIndex, so that ranks go on counting across pages. Later stages may drop or collapse entries
+// but never renumber them, so a surviving entry keeps the rank of the position arXiv returned it at.
+func rankByRelevance(items []*FeedEntry, startIndex int) {
+	for i, entry := range items {
+		entry.RelevanceRank = startIndex + i + 1
+	}
+}
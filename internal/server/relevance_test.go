@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/parser"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+func TestRankByCategoryRelevance(t *testing.T) {
+	entry := func(id, primary, published string) *FeedEntry {
+		item := &gofeed.Item{}
+		if published != "" {
+			ts, _ := time.Parse(time.RFC3339, published)
+			item.PublishedParsed = &ts
+		}
+		return &FeedEntry{Item: item, ArticleID: id, PrimaryCategory: primary}
+	}
+
+	tests := []struct {
+		name      string
+		items     []*FeedEntry
+		queried   []string
+		wantOrder string
+		wantRanks []int
+	}{
+		{
+			name: "primary categories before cross-lists",
+			items: []*FeedEntry{
+				entry("2405.00003v1", "cs.CV", "2024-05-03T12:00:00Z"),
+				entry("2405.00002v1", "cs.LG", "2024-05-02T12:00:00Z"),
+				entry("2405.00001v1", "stat.ML", "2024-05-01T12:00:00Z"),
+			},
+			queried:   []string{"cs.LG", "stat.ML"},
+			wantOrder: "2405.00002v1 2405.00001v1 2405.00003v1",
+			wantRanks: []int{rankPrimaryCategory, rankPrimaryCategory, rankCrossList},
+		},
+		{
+			name: "ties broken by submission date, newest first",
+			items: []*FeedEntry{
+				entry("2405.00001v1", "cs.AI", "2024-05-01T12:00:00Z"),
+				entry("2405.00003v1", "cs.AI", "2024-05-03T12:00:00Z"),
+				entry("2405.00004v1", "cs.RO", "2024-05-04T12:00:00Z"),
+				entry("2405.00002v1", "cs.RO", "2024-05-02T12:00:00Z"),
+			},
+			queried:   []string{"cs.AI"},
+			wantOrder: "2405.00003v1 2405.00001v1 2405.00004v1 2405.00002v1",
+			wantRanks: []int{rankPrimaryCategory, rankPrimaryCategory, rankCrossList, rankCrossList},
+		},
+		{
+			name: "undated entries last within their rank",
+			items: []*FeedEntry{
+				entry("2405.00009v1", "cs.AI", ""),
+				entry("2405.00001v1", "cs.AI", "2024-05-01T12:00:00Z"),
+				entry("2405.00008v1", "cs.CL", ""),
+				entry("2405.00007v1", "cs.AI", ""),
+			},
+			queried:   []string{"cs.AI"},
+			wantOrder: "2405.00001v1 2405.00009v1 2405.00007v1 2405.00008v1",
+			wantRanks: []int{rankPrimaryCategory, rankPrimaryCategory, rankPrimaryCategory, rankCrossList},
+		},
+		{
+			name: "queried archive covers its categories",
+			items: []*FeedEntry{
+				entry("2405.00002v1", "cs.DM", "2024-05-02T12:00:00Z"),
+				entry("2405.00001v1", "math.CO", "2024-05-01T12:00:00Z"),
+				entry("2405.00003v1", "mathph", "2024-05-03T12:00:00Z"),
+			},
+			queried:   []string{"math"},
+			wantOrder: "2405.00001v1 2405.00003v1 2405.00002v1",
+			wantRanks: []int{rankPrimaryCategory, rankCrossList, rankCrossList},
+		},
+		{
+			name: "unknown primary category is a cross-list",
+			items: []*FeedEntry{
+				entry("2405.00002v1", "", "2024-05-02T12:00:00Z"),
+				entry("2405.00001v1", "cs.AI", "2024-05-01T12:00:00Z"),
+			},
+			queried:   []string{"cs.AI"},
+			wantOrder: "2405.00001v1 2405.00002v1",
+			wantRanks: []int{rankPrimaryCategory, rankCrossList},
+		},
+		{
+			name: "keyword-only query keeps chronological order",
+			items: []*FeedEntry{
+				entry("2405.00001v1", "cs.AI", "2024-05-01T12:00:00Z"),
+				entry("2405.00002v1", "cs.CL", "2024-05-02T12:00:00Z"),
+			},
+			queried:   nil,
+			wantOrder: "2405.00002v1 2405.00001v1",
+			wantRanks: []int{rankCrossList, rankCrossList},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rankByCategoryRelevance(tt.items, tt.queried)
+			var ids []string
+			var ranks []int
+			for _, item := range tt.items {
+				ids = append(ids, item.ArticleID)
+				ranks = append(ranks, item.CategoryRank)
+			}
+			if got := strings.Join(ids, " "); got != tt.wantOrder {
+				t.Errorf("order = %s, want %s", got, tt.wantOrder)
+			}
+			for i := range ranks {
+				if ranks[i] != tt.wantRanks[i] {
+					t.Errorf("ranks = %v, want %v", ranks, tt.wantRanks)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestQueryCategories(t *testing.T) {
+	interpretation, err := parser.ParseMixedExpression(`(cs.LG or stat.ML) and "diffusion models" not cs.CV au:smith cat:math.OC`, "")
+	if err != nil {
+		t.Fatalf("ParseMixedExpression() unexpected error: %v", err)
+	}
+	if got, want := strings.Join(queryCategories(interpretation), " "), "cs.LG stat.ML cs.CV math.OC"; got != want {
+		t.Errorf("queryCategories() = %s, want %s", got, want)
+	}
+	if got := queryCategories(nil); got != nil {
+		t.Errorf("queryCategories(nil) = %v, want none", got)
+	}
+}
+
+func TestResolveEntryPrimaryCategory(t *testing.T) {
+	tests := []struct {
+		name string
+		item *gofeed.Item
+		want string
+	}{
+		{"arxiv:primary_category", &gofeed.Item{Categories: []string{"cs.AI", "cs.LG"}, Extensions: ext.Extensions{"arxiv": {"primary_category": {{Attrs: map[string]string{"term": "cs.LG"}}}}}}, "cs.LG"},
+		{"first category without the element", &gofeed.Item{Categories: []string{"cs.AI", "cs.LG"}}, "cs.AI"},
+		{"no categories", &gofeed.Item{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := &FeedEntry{Item: tt.item}
+			if err := resolveEntryPrimaryCategory(entry); err != nil {
+				t.Fatalf("resolveEntryPrimaryCategory() unexpected error: %v", err)
+			}
+			if entry.PrimaryCategory != tt.want {
+				t.Errorf("PrimaryCategory = %q, want %q", entry.PrimaryCategory, tt.want)
+			}
+		})
+	}
+}
+
+// relevanceFeed is a page of arXiv results in relevance order, where an older version of the
+// first article comes before its newest version
+const relevanceFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>arXiv Query</title>
+<entry><id>http://arxiv.org/abs/2405.00001v1</id><title>First</title><published>2024-05-01T00:00:00Z</published><updated>2024-05-01T00:00:00Z</updated></entry>
+<entry><id>http://arxiv.org/abs/2405.00002v1</id><title>Second</title><published>2024-05-02T00:00:00Z</published><updated>2024-05-02T00:00:00Z</updated></entry>
+<entry><id>http://arxiv.org/abs/2405.00001v2</id><title>First, revised</title><published>2024-05-01T00:00:00Z</published><updated>2024-05-06T00:00:00Z</updated></entry>
+<entry><id>http://arxiv.org/abs/2405.00003v1</id><title>Third</title><published>2024-05-03T00:00:00Z</published><updated>2024-05-03T00:00:00Z</updated></entry>
+</feed>`
+
+// TestRelevanceRanks checks that every entry keeps the rank of the position arXiv returned it at
+// through collapseRevisions and headlines, and that only relevance sorts rank entries
+func TestRelevanceRanks(t *testing.T) {
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(relevanceFeed))
+	})
+
+	ranks := func(output any) map[string]int {
+		got := make(map[string]int)
+		for _, entry := range output.(*CategoryFetchSummary).Items {
+			got[entry.ArticleID] = entry.RelevanceRank
+		}
+		return got
+	}
+	tests := []struct {
+		name  string
+		fetch func() (any, error)
+		want  map[string]int
+	}{
+		{
+			name: "collapsed category fetch",
+			fetch: func() (any, error) {
+				return categoryFetchLatest(context.Background(), json.RawMessage(`{"category": "cs.LG", "sortBy": "relevance", "startIndex": 10, "collapseRevisions": true}`))
+			},
+			want: map[string]int{"2405.00001v2": 13, "2405.00002v1": 12, "2405.00003v1": 14},
+		},
+		{
+			name: "search headlines",
+			fetch: func() (any, error) {
+				return arxivSearch(context.Background(), json.RawMessage(`{"query": "everything", "fields": "headline"}`))
+			},
+			want: map[string]int{"2405.00001v1": 1, "2405.00002v1": 2, "2405.00001v2": 3, "2405.00003v1": 4},
+		},
+		{
+			name: "category fetch by submission date",
+			fetch: func() (any, error) {
+				return categoryFetchLatest(context.Background(), json.RawMessage(`{"category": "cs.LG"}`))
+			},
+			want: map[string]int{"2405.00001v1": 0, "2405.00002v1": 0, "2405.00001v2": 0, "2405.00003v1": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := tt.fetch()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := ranks(output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("relevance ranks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
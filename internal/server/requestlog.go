@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// requestLogFields are the details of an MCP request that are logged with it. Every field is
+// optional: requests of some transports and notifications have no session, and a request is
+// logged with whatever could be extracted from it.
+type requestLogFields struct {
+	SessionID string
+	// Client is the identity of the HTTP client: a bearer token fingerprint or an address
+	Client string
+	// ClientInfo is the name and version the MCP client gave in the initialize handshake
+	ClientInfo string
+	// ParamsSize is the size of the serialized params of the request, or -1 if unknown
+	ParamsSize int
+}
+
+// extractRequestLogFields extracts the details of a request to log, without ever panicking: a
+// panic while reading the request, e.g., from a session that is not fully set up, is logged and
+// leaves the fields extracted so far
+func extractRequestLogFields(method string, req mcp.Request) (fields requestLogFields) {
+	fields.ParamsSize = -1
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Warn("Recovered from a panic extracting MCP request details for logging", "method", method, "panic", fmt.Sprint(r))
+		}
+	}()
+	if req == nil {
+		return fields
+	}
+	// In stateless HTTP mode every request has a new session, so the client identity is what
+	// correlates the requests of a client
+	fields.Client = clientIdentityOf(req)
+	session := serverSessionOf(req)
+	if session != nil {
+		fields.SessionID = session.ID()
+	}
+
+	params := req.GetParams()
+	// The client introduces itself in the initialize request, before the session knows it
+	if initialize, ok := params.(*mcp.InitializeParams); ok && initialize != nil {
+		fields.ClientInfo = describeClientInfo(initialize.ClientInfo)
+	} else if session != nil {
+		if initialized := session.InitializeParams(); initialized != nil {
+			fields.ClientInfo = describeClientInfo(initialized.ClientInfo)
+		}
+	}
+	if params != nil {
+		if data, err := json.Marshal(params); err == nil {
+			fields.ParamsSize = len(data)
+		}
+	}
+	return fields
+}
+
+// serverSessionOf returns the server session of a request, or nil if it has none; a request may
+// hold a nil session pointer, which is not a nil mcp.Session
+func serverSessionOf(req mcp.Request) *mcp.ServerSession {
+	session, ok := req.GetSession().(*mcp.ServerSession)
+	if !ok {
+		return nil
+	}
+	return session
+}
+
+// describeClientInfo returns the name and version of an MCP client, if it gave them
+func describeClientInfo(info *mcp.Implementation) string {
+	if info == nil || info.Name == "" {
+		return ""
+	}
+	if info.Version == "" {
+		return info.Name
+	}
+	return info.Name + "/" + info.Version
+}
+
+// logArgs returns the fields as slog arguments, leaving out those that are unknown
+func (f requestLogFields) logArgs(method string) []any {
+	args := []any{"method", method, "session", f.SessionID, "client", f.Client}
+	if f.ClientInfo != "" {
+		args = append(args, "client_info", f.ClientInfo)
+	}
+	if f.ParamsSize >= 0 {
+		args = append(args, "params_size", f.ParamsSize)
+	}
+	return args
+}
+
+// createMCPLoggingMiddleware creates an MCP middleware that logs method calls. Logging never fails
+// a call: a panic in the middleware's own code is logged and the call goes ahead. A panic of the
+// wrapped handler is logged and passed on unchanged.
+func createMCPLoggingMiddleware() mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(
+			ctx context.Context,
+			method string,
+			req mcp.Request,
+		) (result mcp.Result, err error) {
+			start := time.Now()
+			fields := extractRequestLogFields(method, req)
+			safeLog(func() {
+				slog.Info("(Request)", fields.logArgs(method)...)
+			})
+
+			defer func() {
+				if r := recover(); r != nil {
+					safeLog(func() {
+						slog.Error("(Response) Handler panicked", append(fields.logArgs(method), "duration", time.Since(start), "panic", fmt.Sprint(r), "stack", string(debug.Stack()))...)
+					})
+					panic(r)
+				}
+				safeLog(func() {
+					args := append(fields.logArgs(method), "duration", time.Since(start))
+					if err != nil {
+						slog.Info("(Response) Status: ERROR", append(args, "error", err.Error())...)
+						return
+					}
+					slog.Info("(Response) Status: OK", args...)
+				})
+			}()
+			return next(ctx, method, req)
+		}
+	}
+}
+
+// safeLog runs a logging function, recovering from and logging any panic in it, e.g., of a value
+// whose String method panics
+func safeLog(log func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Warn("Recovered from a panic in the MCP logging middleware", "panic", fmt.Sprint(r))
+		}
+	}()
+	log()
+}
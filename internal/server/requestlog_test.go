@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// sessionlessRequest is a minimal request without a session, as sent by some transports and for
+// some notifications. Methods it does not override panic, as the embedded request is nil.
+type sessionlessRequest struct {
+	mcp.Request
+	params mcp.Params
+}
+
+func (r *sessionlessRequest) GetSession() mcp.Session     { return nil }
+func (r *sessionlessRequest) GetParams() mcp.Params       { return r.params }
+func (r *sessionlessRequest) GetExtra() *mcp.RequestExtra { return nil }
+
+// brokenRequest panics on every method
+type brokenRequest struct {
+	mcp.Request
+}
+
+// captureLogs sends the default logger's output to a buffer for the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var logs bytes.Buffer
+	originalLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(originalLogger) })
+	return &logs
+}
+
+func TestExtractRequestLogFields(t *testing.T) {
+	tests := []struct {
+		name string
+		req  mcp.Request
+		want requestLogFields
+	}{
+		{"Nil request", nil, requestLogFields{ParamsSize: -1}},
+		{"Without a session", &sessionlessRequest{params: &mcp.PingParams{}}, requestLogFields{ParamsSize: 2}},
+		{"Nil server session", &mcp.ServerRequest[*mcp.PingParams]{Params: &mcp.PingParams{}}, requestLogFields{ParamsSize: 2}},
+		{
+			"Client info from the initialize request",
+			&mcp.ServerRequest[*mcp.InitializeParams]{Params: &mcp.InitializeParams{ClientInfo: &mcp.Implementation{Name: "inspector", Version: "0.9"}}},
+			requestLogFields{ClientInfo: "inspector/0.9", ParamsSize: len(`{"capabilities":null,"clientInfo":{"name":"inspector","version":"0.9"},"protocolVersion":""}`)},
+		},
+		{"Panicking request", &brokenRequest{}, requestLogFields{ParamsSize: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			captureLogs(t)
+			if got := extractRequestLogFields("ping", tt.req); got != tt.want {
+				t.Errorf("extractRequestLogFields() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMCPLoggingMiddlewareWithoutSession(t *testing.T) {
+	logs := captureLogs(t)
+	handlerErr := errors.New("method not found")
+	for _, req := range []mcp.Request{&sessionlessRequest{}, &brokenRequest{}, nil} {
+		calls := 0
+		handler := createMCPLoggingMiddleware()(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			calls++
+			return nil, handlerErr
+		})
+		if _, err := handler(context.Background(), "ping", req); !errors.Is(err, handlerErr) || calls != 1 {
+			t.Errorf("middleware with %T returned %v after %d calls, want the handler's error after 1", req, err, calls)
+		}
+	}
+	if !strings.Contains(logs.String(), "Status: ERROR") {
+		t.Errorf("logs = %s, want the responses logged", logs)
+	}
+}
+
+func TestMCPLoggingMiddlewarePassesOnHandlerPanics(t *testing.T) {
+	logs := captureLogs(t)
+	handler := createMCPLoggingMiddleware()(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		panic("handler failed")
+	})
+
+	defer func() {
+		if r := recover(); r != "handler failed" {
+			t.Errorf("recovered %v, want the handler's panic", r)
+		}
+		if !strings.Contains(logs.String(), "Handler panicked") || !strings.Contains(logs.String(), "handler failed") {
+			t.Errorf("logs = %s, want the panic logged", logs)
+		}
+	}()
+	_, _ = handler(context.Background(), "tools/call", &sessionlessRequest{})
+	t.Fatal("the handler's panic was swallowed")
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"opus-mcp/internal"
+)
+
+// arxivMaxRetries is the number of times an arXiv request failing transiently is retried, set from
+// OPUS_MCP_HTTP_MAX_RETRIES; none by default
+var arxivMaxRetries = 0
+
+// arxivRetryMaxDelay is the longest a retry of an arXiv request waits. A response asking for a longer
+// wait fails the call, and the cooldown holds back further requests for as long as arXiv asked.
+const arxivRetryMaxDelay = 30 * time.Second
+
+// arxivRetryPolicy returns how arXiv requests are retried: with a backoff starting at the rate limit
+// interval, and with every retry held back by the cooldown, counted against the daily quota as a
+// request of the given kind, if any, and waiting its turn on the arXiv rate limiter like any request
+func arxivRetryPolicy(kind string) internal.RetryPolicy {
+	return internal.RetryPolicy{
+		MaxRetries: arxivMaxRetries,
+		BaseDelay:  arxivInterval(),
+		MaxDelay:   arxivRetryMaxDelay,
+		Now:        correctedNow,
+		Wait: func(ctx context.Context) error {
+			if cooldownErr := arxivCooldown.check(); cooldownErr != nil {
+				return cooldownErr
+			}
+			if kind == "" {
+				return waitForArxiv(ctx)
+			}
+			return takeArxivTurn(ctx, kind)
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestArxivRequestsRetryTransientFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		call    func(ctx context.Context) (any, error)
+		// wantUsed is the number of requests counted against the daily quota; the taxonomy page is not
+		wantUsed int
+	}{
+		{
+			name:    "Category fetch",
+			fixture: "feed_with_revisions.atom",
+			call: func(ctx context.Context) (any, error) {
+				return categoryFetchLatest(ctx, json.RawMessage(`{"category": "cs.LG"}`))
+			},
+			wantUsed: 3,
+		},
+		{
+			name:    "Taxonomy fetch",
+			fixture: "category_taxonomy.html",
+			call:    func(ctx context.Context) (any, error) { return fetchCategoryTaxonomy(ctx, json.RawMessage(`{}`)) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			withHTTPFixtures(t, func(w http.ResponseWriter, r *http.Request) {
+				// The first two requests fail, the third succeeds
+				if requests.Add(1) <= 2 {
+					http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				serveFixture(t, w, tt.fixture)
+			})
+			originalRetries, originalQuota := arxivMaxRetries, arxivQuota
+			t.Cleanup(func() { arxivMaxRetries, arxivQuota = originalRetries, originalQuota })
+			// Retries wait their turn on the rate limiter, whose interval is also the first backoff
+			toolDeps.ArxivLimiter = rate.NewLimiter(rate.Every(20*time.Millisecond), 1)
+
+			arxivMaxRetries = 0
+			if _, err := tt.call(context.Background()); err == nil {
+				t.Fatal("call without retries succeeded, want the first 503 to fail it")
+			}
+
+			requests.Store(0)
+			arxivMaxRetries = 2
+			arxivQuota = newDailyQuota(0, nil, time.Now)
+			start := time.Now()
+			if _, err := tt.call(context.Background()); err != nil {
+				t.Fatalf("call with 2 retries unexpected error: %v", err)
+			}
+			if got := requests.Load(); got != 3 {
+				t.Errorf("made %d requests, want 3", got)
+			}
+			// Backoffs of 20ms and 40ms
+			if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+				t.Errorf("retries took %v, want at least the backoff of 60ms", elapsed)
+			}
+			if used := arxivQuota.status().Used; used != tt.wantUsed {
+				t.Errorf("quota counts %d requests, want %d", used, tt.wantUsed)
+			}
+		})
+	}
+}
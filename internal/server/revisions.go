@@ -0,0 +1,113 @@
+package server
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"opus-mcp/internal/arxivid"
+)
+
+// collapseRevisions keeps only the newest version of every article in a result, so that a paper
+// re-announced as a replacement shows up once. The kept entry takes the position of the first
+// version in the result and lists the identifiers of the versions it replaced. Entries without an
+// arXiv identifier are kept as they are.
+func collapseRevisions(result *CategoryFetchResult) {
+	newest := make(map[string]*FeedEntry, len(result.Items))
+	previous := make(map[string][]string)
+	for _, entry := range result.Items {
+		base, ok := entryBaseID(entry)
+		if !ok {
+			continue
+		}
+		kept, seen := newest[base]
+		if !seen {
+			newest[base] = entry
+			continue
+		}
+		older := entry
+		if newerRevision(entry, kept) {
+			newest[base], older = entry, kept
+		}
+		previous[base] = append(previous[base], older.ArticleID)
+		if len(older.Errors) > 0 {
+			result.Warnings--
+		}
+	}
+	if len(previous) == 0 {
+		return
+	}
+
+	items := make([]*FeedEntry, 0, len(newest))
+	placed := make(map[string]bool, len(newest))
+	for _, entry := range result.Items {
+		base, ok := entryBaseID(entry)
+		if !ok {
+			items = append(items, entry)
+			continue
+		}
+		if placed[base] {
+			continue
+		}
+		placed[base] = true
+		kept := newest[base]
+		if versions := previous[base]; len(versions) > 0 {
+			kept.PreviousVersionsInWindow = versions
+			slog.Info("Collapsed revisions of an article", "article_id", kept.ArticleID, "previous_versions", versions)
+		}
+		items = append(items, kept)
+	}
+	result.Items = items
+}
+
+// entryBaseID returns the unversioned arXiv identifier of an entry, if it has one
+func entryBaseID(entry *FeedEntry) (string, bool) {
+	id, err := arxivid.Parse(entry.ArticleID)
+	if err != nil {
+		return "", false
+	}
+	return id.Base(), true
+}
+
+// newerRevision reports whether an entry is a newer revision of the same article than another:
+// by explicit version number, then by the time of its last update, then by whether it is a
+// replacement, as told by an update after its first publication or by its announce type
+func newerRevision(entry, other *FeedEntry) bool {
+	if a, b := entryVersion(entry), entryVersion(other); a != b {
+		return a > b
+	}
+	if a, b := entryUpdated(entry), entryUpdated(other); !a.Equal(b) {
+		return a.After(b)
+	}
+	return isReplacement(entry) && !isReplacement(other)
+}
+
+// entryVersion returns the explicit version of an entry's identifier, or 0 when unversioned
+func entryVersion(entry *FeedEntry) int {
+	id, err := arxivid.Parse(entry.ArticleID)
+	if err != nil {
+		return 0
+	}
+	return id.Version
+}
+
+// entryUpdated returns when an entry was last updated, or the zero time if unknown
+func entryUpdated(entry *FeedEntry) time.Time {
+	if entry.Item != nil && entry.UpdatedParsed != nil {
+		return *entry.UpdatedParsed
+	}
+	return time.Time{}
+}
+
+// isReplacement reports whether an entry announces a revision of an earlier submission: its
+// arxiv:announce_type is a replacement, as in arXiv's RSS feeds, or it was updated after it was
+// first published, as in API feeds
+func isReplacement(entry *FeedEntry) bool {
+	if entry.Item == nil {
+		return false
+	}
+	if types := entry.Extensions["arxiv"]["announce_type"]; len(types) > 0 {
+		return strings.HasPrefix(strings.TrimSpace(types[0].Value), "replace")
+	}
+	return entry.UpdatedParsed != nil && entry.PublishedParsed != nil && entry.UpdatedParsed.After(*entry.PublishedParsed)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+// TestCollapseRevisions checks that v1 and v2 of the same paper collapse into the newer version,
+// at the position of the first, while an unrelated paper is left alone
+func TestCollapseRevisions(t *testing.T) {
+	body, err := os.ReadFile("testdata/feed_with_revisions.atom")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	result, err := parseCategoryFeed(body, true)
+	if err != nil {
+		t.Fatalf("parseCategoryFeed() unexpected error: %v", err)
+	}
+	if len(result.Items) != 3 {
+		t.Fatalf("parseCategoryFeed() returned %d entries, want 3", len(result.Items))
+	}
+	if !isReplacement(result.Items[2]) || isReplacement(result.Items[0]) {
+		t.Error("the announce type of the fixture entries should tell the replacement from the new submission")
+	}
+
+	collapseRevisions(result)
+	var ids []string
+	for _, entry := range result.Items {
+		ids = append(ids, entry.ArticleID)
+	}
+	if got, want := strings.Join(ids, " "), "2403.01001v2 2403.01002v1"; got != want {
+		t.Fatalf("entries after collapsing = %s, want %s", got, want)
+	}
+	if got := result.Items[0].PreviousVersionsInWindow; len(got) != 1 || got[0] != "2403.01001v1" {
+		t.Errorf("previousVersionsInWindow = %v, want [2403.01001v1]", got)
+	}
+	if result.Items[0].Description != "Abstract of the second version." {
+		t.Errorf("kept entry description = %q, want that of the second version", result.Items[0].Description)
+	}
+	if got := result.Items[1].PreviousVersionsInWindow; got != nil {
+		t.Errorf("unrelated paper previousVersionsInWindow = %v, want none", got)
+	}
+
+	// Collapsing again changes nothing
+	collapseRevisions(result)
+	if len(result.Items) != 2 || len(result.Items[0].PreviousVersionsInWindow) != 1 {
+		t.Errorf("collapsing twice left %d entries, want 2", len(result.Items))
+	}
+}
+
+func TestNewerRevision(t *testing.T) {
+	at := func(s string) *time.Time {
+		ts, _ := time.Parse(time.RFC3339, s)
+		return &ts
+	}
+	entry := func(id, published, updated, announceType string) *FeedEntry {
+		item := &gofeed.Item{PublishedParsed: at(published), UpdatedParsed: at(updated)}
+		if announceType != "" {
+			item.Extensions = ext.Extensions{"arxiv": {"announce_type": {{Value: announceType}}}}
+		}
+		return &FeedEntry{Item: item, ArticleID: id}
+	}
+
+	tests := []struct {
+		name  string
+		entry *FeedEntry
+		other *FeedEntry
+		want  bool
+	}{
+		{"higher version", entry("2403.01001v3", "2024-03-04T16:00:00Z", "2024-03-04T16:00:00Z", ""), entry("2403.01001v2", "2024-03-04T16:00:00Z", "2024-03-06T16:00:00Z", ""), true},
+		{"lower version", entry("2403.01001v1", "2024-03-04T16:00:00Z", "2024-03-07T16:00:00Z", ""), entry("2403.01001v2", "2024-03-04T16:00:00Z", "2024-03-06T16:00:00Z", ""), false},
+		{"unversioned, updated later", entry("2403.01001", "2024-03-04T16:00:00Z", "2024-03-06T16:00:00Z", ""), entry("2403.01001", "2024-03-04T16:00:00Z", "2024-03-04T16:00:00Z", ""), true},
+		{"unversioned replacement announcement", entry("2403.01001", "2024-03-04T16:00:00Z", "2024-03-04T16:00:00Z", "replace"), entry("2403.01001", "2024-03-04T16:00:00Z", "2024-03-04T16:00:00Z", "new"), true},
+		{"unversioned new announcement", entry("2403.01001", "2024-03-04T16:00:00Z", "2024-03-04T16:00:00Z", "new"), entry("2403.01001", "2024-03-04T16:00:00Z", "2024-03-04T16:00:00Z", "replace-cross"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newerRevision(tt.entry, tt.other); got != tt.want {
+				t.Errorf("newerRevision() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollapseRevisionsKeepsWarningsConsistent(t *testing.T) {
+	result := &CategoryFetchResult{
+		Feed: &gofeed.Feed{},
+		Items: []*FeedEntry{
+			{Item: &gofeed.Item{Link: "http://arxiv.org/abs/2403.01001v1"}, ArticleID: "2403.01001v1", Errors: []string{"unparseable published date"}},
+			{Item: &gofeed.Item{Link: "not an arXiv link"}, Errors: []string{"no arXiv identifier found"}},
+			{Item: &gofeed.Item{Link: "http://arxiv.org/abs/2403.01001v2"}, ArticleID: "2403.01001v2"},
+		},
+		Warnings: 2,
+	}
+	collapseRevisions(result)
+	if len(result.Items) != 2 || result.Items[0].ArticleID != "2403.01001v2" || result.Items[1].ArticleID != "" {
+		t.Fatalf("entries after collapsing = %+v, want v2 followed by the unidentified entry", result.Items)
+	}
+	if result.Warnings != 1 {
+		t.Errorf("warnings = %d, want 1 after dropping the flagged older version", result.Warnings)
+	}
+}
@@ -0,0 +1,336 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"opus-mcp/internal/metadata"
+	"opus-mcp/internal/metrics"
+)
+
+// routeResponse documents one possible response of an HTTP route
+type routeResponse struct {
+	Description string
+	ContentType string
+}
+
+// httpRoute is an HTTP endpoint together with its description. The HTTP mux and the OpenAPI
+// document are both built from the same list of routes, so every registered route is described.
+type httpRoute struct {
+	Pattern     string
+	Handler     http.Handler
+	Method      string
+	Summary     string
+	Description string
+	Responses   map[int]routeResponse
+	// Opaque routes are mounted but not described beyond their summary, e.g., the MCP endpoint
+	// which has its own discovery mechanism
+	Opaque bool
+	// Admin routes require the admin bearer token
+	Admin bool
+}
+
+// rootEndpoint is an endpoint listed by the root route
+type rootEndpoint struct {
+	Path    string `json:"path"`
+	Summary string `json:"summary"`
+}
+
+// rootDocument is the JSON response of the root route, pointing to the other endpoints
+type rootDocument struct {
+	Name      string         `json:"name"`
+	Title     string         `json:"title"`
+	Version   string         `json:"version"`
+	Endpoints []rootEndpoint `json:"endpoints"`
+}
+
+// httpRoutes returns the routes served in HTTP mode, with the MCP endpoint mounted at /mcp
+func httpRoutes(mcpHandler http.Handler) []httpRoute {
+	routes := []httpRoute{
+		{
+			Pattern:     "/mcp",
+			Handler:     mcpHandler,
+			Summary:     "MCP streamable HTTP endpoint",
+			Description: "The Model Context Protocol endpoint. Its tools, resources and prompts are discovered through MCP itself and are not described here.",
+			Opaque:      true,
+		},
+		{
+			Pattern: "/health",
+			Handler: http.HandlerFunc(healthCheckHandler),
+			Method:  http.MethodGet,
+			Summary: "Liveness and build information",
+			Description: "Reports that the server process is alive, along with its build version, build time, platform and registered tools. The status is degraded when some tools failed to register. " +
+				"The response carries an ETag and a short Cache-Control max-age; requests with a matching If-None-Match get 304 Not Modified. " +
+				"Add ?verbose=true to include volatile fields such as the uptime, in which case the response is never cached.",
+			Responses: map[int]routeResponse{
+				http.StatusOK:          {Description: "The server is alive", ContentType: "application/json"},
+				http.StatusNotModified: {Description: "The server is alive and the response matches the If-None-Match ETag"},
+			},
+		},
+		{
+			Pattern: "/healthz",
+			Handler: http.RedirectHandler("/health", http.StatusMovedPermanently),
+			Method:  http.MethodGet,
+			Summary: "Alias of /health",
+			Responses: map[int]routeResponse{
+				http.StatusMovedPermanently: {Description: "Redirect to /health"},
+			},
+		},
+		{
+			Pattern:     "/ready",
+			Handler:     http.HandlerFunc(readinessHandler),
+			Method:      http.MethodGet,
+			Summary:     "Readiness",
+			Description: "Reports whether the server is ready to accept work, along with the queue depth and estimated wait of rate-limited tool calls, the arXiv requests made today against the daily limit and, when S3 is configured, the last known storage capacity, the number of queued, running and recently failed background downloads and, once downloads have been measured, estimates of their origin and S3 throughput, and the median, 95th percentile and largest size of recent responses by tool.",
+			Responses: map[int]routeResponse{
+				http.StatusOK: {Description: "The server is ready", ContentType: "application/json"},
+			},
+		},
+		{
+			Pattern: "/metrics",
+			Handler: metrics.Handler(),
+			Method:  http.MethodGet,
+			Summary: "Prometheus metrics",
+			Responses: map[int]routeResponse{
+				http.StatusOK: {Description: "Metrics in the Prometheus text exposition format", ContentType: "text/plain"},
+			},
+		},
+		{
+			Pattern:     "/examples.json",
+			Handler:     http.HandlerFunc(examplesHandler),
+			Method:      http.MethodGet,
+			Summary:     "Example tool calls",
+			Description: "Returns curated example arguments and trimmed outputs of every registered MCP tool, the same document as the get_tool_examples tool, for building prompts and agents.",
+			Responses: map[int]routeResponse{
+				http.StatusOK: {Description: "Example calls by tool", ContentType: "application/json"},
+			},
+		},
+		{
+			Pattern: "/static/taxonomy.json",
+			Handler: http.HandlerFunc(staticTaxonomyHandler),
+			Method:  http.MethodGet,
+			Summary: "Embedded arXiv category taxonomy",
+			Description: "Returns the snapshot of the arXiv category taxonomy compiled into the server, without any request to arXiv, for clients without network access. " +
+				"The X-Snapshot-Date header gives the date the snapshot was taken. The response carries an ETag and a Cache-Control max-age of a day; requests with a matching If-None-Match get 304 Not Modified.",
+			Responses: map[int]routeResponse{
+				http.StatusOK:          {Description: "The taxonomy snapshot", ContentType: "application/json"},
+				http.StatusNotModified: {Description: "The snapshot matches the If-None-Match ETag"},
+			},
+		},
+		{
+			Pattern: "/static/examples.json",
+			Handler: http.HandlerFunc(staticExamplesHandler),
+			Method:  http.MethodGet,
+			Summary: "Cacheable example tool calls",
+			Description: "Returns the same document as /examples.json, with an ETag and a Cache-Control max-age of a day so that offline clients can keep a copy; " +
+				"requests with a matching If-None-Match get 304 Not Modified.",
+			Responses: map[int]routeResponse{
+				http.StatusOK:          {Description: "Example calls by tool", ContentType: "application/json"},
+				http.StatusNotModified: {Description: "The document matches the If-None-Match ETag"},
+			},
+		},
+		{
+			Pattern: "/admin/config",
+			Handler: http.HandlerFunc(adminConfigHandler),
+			Method:  http.MethodGet,
+			Summary: "Effective configuration",
+			Description: "Returns the fully resolved configuration of the server, the same document as the server_config tool: every field with its environment variable or flag, its value and its source (default, env, file or flag). " +
+				"Secrets are replaced by their length and a SHA-256 prefix. Requires the bearer token set in OPUS_MCP_ADMIN_TOKEN.",
+			Admin: true,
+			Responses: map[int]routeResponse{
+				http.StatusOK:           {Description: "The effective configuration", ContentType: "application/json"},
+				http.StatusUnauthorized: {Description: "The admin token is missing or wrong"},
+				http.StatusNotFound:     {Description: "The admin endpoints are disabled because no admin token is configured"},
+			},
+		},
+		{
+			Pattern: "/",
+			Method:  http.MethodGet,
+			Summary: "Usage hint",
+			Description: "Returns a small JSON document with the server name and version and the paths of the other endpoints. " +
+				"Any path not matched by another route is served by this route.",
+			Responses: map[int]routeResponse{
+				http.StatusOK: {Description: "Usage hint", ContentType: "application/json"},
+			},
+		},
+	}
+	// The OpenAPI document describes all routes, including itself
+	openAPIRoute := httpRoute{
+		Pattern: "/openapi.json",
+		Method:  http.MethodGet,
+		Summary: "OpenAPI description of the HTTP endpoints",
+		Responses: map[int]routeResponse{
+			http.StatusOK: {Description: "OpenAPI 3 document", ContentType: "application/json"},
+		},
+	}
+	routes = append(routes, openAPIRoute)
+	routes[len(routes)-1].Handler = openAPIHandler(routes)
+	for i := range routes {
+		if routes[i].Pattern == "/" {
+			routes[i].Handler = rootHandler(routes)
+		}
+	}
+	return routes
+}
+
+// newHTTPMux registers the given routes on a new mux
+func newHTTPMux(routes []httpRoute) *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, route := range routes {
+		mux.Handle(route.Pattern, route.Handler)
+	}
+	return mux
+}
+
+// rootHandler serves a JSON document pointing to the given routes
+func rootHandler(routes []httpRoute) http.Handler {
+	doc := rootDocument{
+		Name:      metadata.APP_NAME,
+		Title:     metadata.APP_TITLE,
+		Version:   metadata.BuildVersion,
+		Endpoints: []rootEndpoint{},
+	}
+	for _, route := range routes {
+		if route.Pattern != "/" {
+			doc.Endpoints = append(doc.Endpoints, rootEndpoint{Path: route.Pattern, Summary: route.Summary})
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Connection", "close")
+		if err := json.NewEncoder(w).Encode(doc); err != nil {
+			slog.Warn("failed to write response", "error", err)
+		}
+	})
+}
+
+// openAPIDocument is the subset of the OpenAPI 3 document structure used to describe the HTTP endpoints
+type openAPIDocument struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       openAPIInfo                            `json:"info"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components openAPIComponents                      `json:"components"`
+}
+
+type openAPIComponents struct {
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme"`
+	Description string `json:"description,omitempty"`
+}
+
+// adminSecurityScheme is the name of the security scheme of the admin routes
+const adminSecurityScheme = "adminToken"
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type openAPIOperation struct {
+	Summary     string                     `json:"summary"`
+	Description string                     `json:"description,omitempty"`
+	OperationID string                     `json:"operationId"`
+	Security    []map[string][]string      `json:"security"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct{}
+
+// operationID derives an OpenAPI operation ID from a method and path, e.g., GET /ready -> getReady
+func operationID(method, pattern string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(pattern, func(r rune) bool { return r == '/' || r == '.' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	if pattern == "/" {
+		b.WriteString("Root")
+	}
+	return b.String()
+}
+
+// buildOpenAPIDocument describes the given routes as an OpenAPI 3 document
+func buildOpenAPIDocument(routes []httpRoute) openAPIDocument {
+	doc := openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:   metadata.APP_TITLE,
+			Version: metadata.BuildVersion,
+			Description: "HTTP endpoints of " + metadata.APP_NAME + ". Only the admin endpoints require authentication. " +
+				"The MCP endpoint is listed as an opaque endpoint; use MCP discovery to list its tools.",
+		},
+		Paths: make(map[string]map[string]openAPIOperation, len(routes)),
+		Components: openAPIComponents{SecuritySchemes: map[string]openAPISecurityScheme{
+			adminSecurityScheme: {Type: "http", Scheme: "bearer", Description: "The admin token set in OPUS_MCP_ADMIN_TOKEN"},
+		}},
+	}
+	for _, route := range routes {
+		operation := openAPIOperation{
+			Summary:     route.Summary,
+			Description: route.Description,
+			// An empty security requirement list marks the operation as not requiring authentication
+			Security:  []map[string][]string{},
+			Responses: make(map[string]openAPIResponse),
+		}
+		if route.Admin {
+			operation.Security = []map[string][]string{{adminSecurityScheme: {}}}
+		}
+		methods := []string{route.Method}
+		if route.Opaque {
+			// MCP uses POST for messages, GET for server-sent events and DELETE to end sessions
+			methods = []string{http.MethodPost, http.MethodGet, http.MethodDelete}
+			operation.Responses["default"] = openAPIResponse{Description: "See the MCP streamable HTTP transport specification"}
+		}
+		statuses := make([]int, 0, len(route.Responses))
+		for status := range route.Responses {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+		for _, status := range statuses {
+			response := route.Responses[status]
+			documented := openAPIResponse{Description: response.Description}
+			if response.ContentType != "" {
+				documented.Content = map[string]openAPIMediaType{response.ContentType: {}}
+			}
+			operation.Responses[strconv.Itoa(status)] = documented
+		}
+		item := make(map[string]openAPIOperation, len(methods))
+		for _, method := range methods {
+			op := operation
+			op.OperationID = operationID(method, route.Pattern)
+			item[strings.ToLower(method)] = op
+		}
+		doc.Paths[route.Pattern] = item
+	}
+	return doc
+}
+
+// openAPIHandler serves the OpenAPI document describing the given routes
+func openAPIHandler(routes []httpRoute) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jsonData, err := json.MarshalIndent(buildOpenAPIDocument(routes), "", "    ")
+		if err != nil {
+			slog.Error("OpenAPI document JSON marshalling failed", "error", err)
+			http.Error(w, "JSON marshalling failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(jsonData); err != nil {
+			slog.Error("OpenAPI document response writing failed", "error", err)
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"opus-mcp/internal/metadata"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// openAPIStructureSchema captures the structural requirements of the OpenAPI 3.0 schema
+// (https://spec.openapis.org/oas/3.0/schema/2021-09-28) for the parts of the document we emit
+const openAPIStructureSchema = `{
+	"type": "object",
+	"required": ["openapi", "info", "paths"],
+	"properties": {
+		"openapi": {"type": "string", "pattern": "^3\\.0\\.\\d+$"},
+		"info": {
+			"type": "object",
+			"required": ["title", "version"],
+			"properties": {
+				"title": {"type": "string", "minLength": 1},
+				"version": {"type": "string"},
+				"description": {"type": "string"}
+			}
+		},
+		"paths": {
+			"type": "object",
+			"propertyNames": {"pattern": "^/"},
+			"additionalProperties": {
+				"type": "object",
+				"minProperties": 1,
+				"propertyNames": {"enum": ["get", "put", "post", "delete", "options", "head", "patch", "trace"]},
+				"additionalProperties": {
+					"type": "object",
+					"required": ["responses"],
+					"properties": {
+						"summary": {"type": "string", "minLength": 1},
+						"description": {"type": "string"},
+						"operationId": {"type": "string", "minLength": 1},
+						"security": {"type": "array", "items": {"type": "object"}},
+						"responses": {
+							"type": "object",
+							"minProperties": 1,
+							"propertyNames": {"pattern": "^([1-5]\\d\\d|default)$"},
+							"additionalProperties": {
+								"type": "object",
+								"required": ["description"],
+								"properties": {
+									"description": {"type": "string", "minLength": 1},
+									"content": {"type": "object", "additionalProperties": {"type": "object"}}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}`
+
+func TestOpenAPIDocument(t *testing.T) {
+	routes := httpRoutes(http.NotFoundHandler())
+	mux := newHTTPMux(routes)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json status = %d, want 200", recorder.Code)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+
+	var document map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+		t.Fatalf("OpenAPI document is not valid JSON: %v", err)
+	}
+
+	var schema jsonschema.Schema
+	if err := json.Unmarshal([]byte(openAPIStructureSchema), &schema); err != nil {
+		t.Fatalf("failed to parse OpenAPI structure schema: %v", err)
+	}
+	resolved, err := schema.Resolve(nil)
+	if err != nil {
+		t.Fatalf("failed to resolve OpenAPI structure schema: %v", err)
+	}
+	if err := resolved.Validate(document); err != nil {
+		t.Errorf("OpenAPI document does not validate: %v", err)
+	}
+
+	// The documented paths are exactly the registered routes
+	paths, _ := document["paths"].(map[string]any)
+	var documented, registered []string
+	for path := range paths {
+		documented = append(documented, path)
+	}
+	for _, route := range routes {
+		registered = append(registered, route.Pattern)
+	}
+	sort.Strings(documented)
+	sort.Strings(registered)
+	if len(documented) != len(registered) {
+		t.Fatalf("documented paths %v do not match registered routes %v", documented, registered)
+	}
+	for i := range documented {
+		if documented[i] != registered[i] {
+			t.Errorf("documented paths %v do not match registered routes %v", documented, registered)
+			break
+		}
+	}
+
+	// The MCP mount point is present but opaque
+	mcpItem, ok := paths["/mcp"].(map[string]any)
+	if !ok || mcpItem["post"] == nil {
+		t.Errorf("/mcp should be documented as an opaque POST endpoint, got %v", paths["/mcp"])
+	}
+}
+
+func TestHTTPRoutesAreDescribed(t *testing.T) {
+	routes := httpRoutes(http.NotFoundHandler())
+	mux := newHTTPMux(routes)
+
+	seen := make(map[string]bool)
+	for _, route := range routes {
+		if seen[route.Pattern] {
+			t.Errorf("route %s is registered twice", route.Pattern)
+		}
+		seen[route.Pattern] = true
+
+		if route.Handler == nil {
+			t.Errorf("route %s has no handler", route.Pattern)
+		}
+		if route.Summary == "" {
+			t.Errorf("route %s has no summary", route.Pattern)
+		}
+		if !route.Opaque && (route.Method == "" || len(route.Responses) == 0) {
+			t.Errorf("route %s must document its method and responses", route.Pattern)
+		}
+
+		// Every described route is reachable through the mux under its own pattern
+		_, pattern := mux.Handler(httptest.NewRequest(http.MethodGet, route.Pattern, nil))
+		if pattern != route.Pattern {
+			t.Errorf("request to %s was routed to pattern %q", route.Pattern, pattern)
+		}
+	}
+}
+
+func TestRootDocument(t *testing.T) {
+	routes := httpRoutes(http.NotFoundHandler())
+	mux := newHTTPMux(routes)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET / status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	var doc rootDocument
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("root document is not valid JSON: %v", err)
+	}
+	if doc.Name != metadata.APP_NAME || doc.Version != metadata.BuildVersion {
+		t.Errorf("root document names %q version %q", doc.Name, doc.Version)
+	}
+	paths := map[string]bool{}
+	for _, endpoint := range doc.Endpoints {
+		paths[endpoint.Path] = true
+	}
+	for _, route := range routes {
+		if route.Pattern != "/" && !paths[route.Pattern] {
+			t.Errorf("root document does not list %s", route.Pattern)
+		}
+	}
+	if paths["/"] {
+		t.Error("root document lists itself")
+	}
+}
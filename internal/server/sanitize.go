@@ -0,0 +1,116 @@
+package server
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// FeedSanitization counts the repairs made to a feed body before parsing it
+type FeedSanitization struct {
+	// InvalidCharacters is the number of characters removed because XML 1.0 does not allow them,
+	// e.g., control characters in abstracts, or because they were not valid UTF-8
+	InvalidCharacters int
+	// Ampersands is the number of bare ampersands escaped as &amp;
+	Ampersands int
+}
+
+// Altered reports whether sanitizing changed the body
+func (s FeedSanitization) Altered() bool {
+	return s.InvalidCharacters > 0 || s.Ampersands > 0
+}
+
+// sanitizeFeedXML returns a copy of a feed body that an XML parser accepts despite the minor
+// violations arXiv occasionally emits: characters outside the XML 1.0 character range are removed,
+// and ampersands that do not start an entity or character reference are escaped. CDATA sections and
+// comments are copied unchanged. The body itself is never modified.
+func sanitizeFeedXML(body []byte) ([]byte, FeedSanitization) {
+	var report FeedSanitization
+	out := make([]byte, 0, len(body))
+	for i := 0; i < len(body); {
+		// Ampersands are allowed as they are in CDATA sections and comments
+		if end, ok := verbatimSectionEnd(body, i); ok {
+			out = append(out, body[i:end]...)
+			i = end
+			continue
+		}
+
+		r, size := utf8.DecodeRune(body[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1, !isXMLChar(r):
+			report.InvalidCharacters++
+		case r == '&' && !startsXMLReference(body[i:]):
+			report.Ampersands++
+			out = append(out, "&amp;"...)
+		default:
+			out = append(out, body[i:i+size]...)
+		}
+		i += size
+	}
+	return out, report
+}
+
+// verbatimSections are the XML sections, by opening and closing delimiter, whose text is not parsed
+// for references
+var verbatimSections = [][2][]byte{
+	{[]byte("<![CDATA["), []byte("]]>")},
+	{[]byte("<!--"), []byte("-->")},
+}
+
+// verbatimSectionEnd returns the end of the CDATA section or comment starting at body[i], if any.
+// An unterminated section extends to the end of the body.
+func verbatimSectionEnd(body []byte, i int) (int, bool) {
+	for _, section := range verbatimSections {
+		opening, closing := section[0], section[1]
+		if !bytes.HasPrefix(body[i:], opening) {
+			continue
+		}
+		end := bytes.Index(body[i+len(opening):], closing)
+		if end < 0 {
+			return len(body), true
+		}
+		return i + len(opening) + end + len(closing), true
+	}
+	return 0, false
+}
+
+// isXMLChar reports whether a character is allowed in an XML 1.0 document
+func isXMLChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		(r >= 0x20 && r <= 0xD7FF) ||
+		(r >= 0xE000 && r <= 0xFFFD) ||
+		(r >= 0x10000 && r <= 0x10FFFF)
+}
+
+// startsXMLReference reports whether b, which starts with an ampersand, starts with an entity
+// reference such as &amp; or a character reference such as &#233; or &#xE9;
+func startsXMLReference(b []byte) bool {
+	end := bytes.IndexByte(b, ';')
+	// Entity names in feeds are short; a distant semicolon belongs to other text
+	if end < 2 || end > 32 {
+		return false
+	}
+	name := b[1:end]
+	if name[0] == '#' {
+		digits := name[1:]
+		hex := len(digits) > 0 && (digits[0] == 'x' || digits[0] == 'X')
+		if hex {
+			digits = digits[1:]
+		}
+		if len(digits) == 0 {
+			return false
+		}
+		for _, c := range digits {
+			if !('0' <= c && c <= '9' || hex && ('a' <= c && c <= 'f' || 'A' <= c && c <= 'F')) {
+				return false
+			}
+		}
+		return true
+	}
+	for j, c := range name {
+		letter := 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c == ':'
+		if !letter && (j == 0 || !('0' <= c && c <= '9' || c == '-' || c == '.')) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package server
+
+import "testing"
+
+func TestSanitizeFeedXML(t *testing.T) {
+	tests := []struct {
+		name           string
+		input          string
+		want           string
+		wantCharacters int
+		wantAmpersands int
+	}{
+		{"well-formed", `<title>A &amp; B &lt;C&gt; &#233; &#xE9;</title>`, `<title>A &amp; B &lt;C&gt; &#233; &#xE9;</title>`, 0, 0},
+		{"control characters", "<summary>a\x0bb\x00c\td\n</summary>", "<summary>abc\td\n</summary>", 2, 0},
+		{"invalid UTF-8", "<summary>a\xffb</summary>", "<summary>ab</summary>", 1, 0},
+		{"non-characters", "<summary>a\uFFFEb</summary>", "<summary>ab</summary>", 1, 0},
+		{"bare ampersands", `<title>R&D & more &; &#; &#xZZ;</title>`, `<title>R&amp;D &amp; more &amp;; &amp;#; &amp;#xZZ;</title>`, 0, 5},
+		{"ampersand in attribute", `<link href="http://arxiv.org/a?x=1&y=2"/>`, `<link href="http://arxiv.org/a?x=1&amp;y=2"/>`, 0, 1},
+		{"CDATA and comments", "<s><![CDATA[a & b]]> & <!-- c & d --></s>", "<s><![CDATA[a & b]]> &amp; <!-- c & d --></s>", 0, 1},
+		{"adjacent CDATA sections", "<![CDATA[&]]><![CDATA[&]]>", "<![CDATA[&]]><![CDATA[&]]>", 0, 0},
+		{"unterminated CDATA", "<s><![CDATA[a & b", "<s><![CDATA[a & b", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, report := sanitizeFeedXML([]byte(tt.input))
+			if string(got) != tt.want {
+				t.Errorf("sanitizeFeedXML() = %q, want %q", got, tt.want)
+			}
+			if report.InvalidCharacters != tt.wantCharacters || report.Ampersands != tt.wantAmpersands {
+				t.Errorf("report = %+v, want %d invalid characters and %d ampersands", report, tt.wantCharacters, tt.wantAmpersands)
+			}
+			if report.Altered() != (tt.input != tt.want) {
+				t.Errorf("Altered() = %v", report.Altered())
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// toolSchemaVersions are the versions of the input and output schemas of every tool. Increment a
+// tool's version with every change to its schemas that can break clients, and regenerate the
+// golden schema hashes with: go test ./internal/server -run TestToolSchemaVersions -update
+var toolSchemaVersions = map[string]int{
+	"arxiv_category_fetch_latest": 23,
+	"arxiv_get_category_taxonomy": 3,
+	"arxiv_related_categories":    1,
+	"arxiv_search":                7,
+	"arxiv_advanced_query":        2,
+	"arxiv_fetch_by_id":           8,
+	"arxiv_get_abs_metadata":      1,
+	"arxiv_get_article":           2,
+	"identifiers_resolve":         1,
+	"arxiv_download_pdf":          8,
+	"download_job_status":         7,
+	"library_provenance":          5,
+	"library_export":              2,
+	"library_cleanup":             1,
+	"s3_read_object_chunk":        2,
+	"url_download_to_storage":     4,
+	"verify_attestation":          1,
+	"server_status":               1,
+	"server_config":               2,
+	"server_selftest":             1,
+	"server_schema_info":          2,
+	"get_tool_examples":           1,
+}
+
+// schemaVersionProperty is the output field holding the schema version of the tool's output
+const schemaVersionProperty = "schemaVersion"
+
+// ToolSchemaInfo is the schema version and hash of a single tool
+type ToolSchemaInfo struct {
+	Name          string `json:"name" jsonschema:"The name of the tool"`
+	SchemaVersion int    `json:"schemaVersion" jsonschema:"The version of the tool's input and output schemas, incremented with every change that can break clients"`
+	SchemaHash    string `json:"schemaHash" jsonschema:"Lowercase hex-encoded SHA-256 digest of the structure of the tool's resolved input and output schemas, ignoring descriptions, titles and examples"`
+}
+
+// ServerSchemaInfoOutput defines the output structure for the schema info tool
+type ServerSchemaInfoOutput struct {
+	Tools []ToolSchemaInfo `json:"tools" jsonschema:"The schema version and hash of every tool registered on this server, sorted by name"`
+}
+
+// versionedOutput is a tool output together with its schema version, which is added to the
+// output's JSON object as the schemaVersion field
+type versionedOutput struct {
+	output  any
+	version int
+}
+
+// MarshalJSON encodes the output with the schemaVersion field first
+func (v versionedOutput) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(v.output)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 || data[0] != '{' {
+		return nil, fmt.Errorf("tool output must be a JSON object to carry a schema version")
+	}
+	prefix := fmt.Sprintf(`{"%s":%d`, schemaVersionProperty, v.version)
+	if string(data) == "{}" {
+		return []byte(prefix + "}"), nil
+	}
+	return append([]byte(prefix+","), data[1:]...), nil
+}
+
+// unwrapOutput returns the tool output without its schema version or canonical encoding
+func unwrapOutput(output any) any {
+	if c, ok := output.(canonicalOutput); ok {
+		output = c.output
+	}
+	if v, ok := output.(versionedOutput); ok {
+		return v.output
+	}
+	return output
+}
+
+// addSchemaVersionProperty declares the schemaVersion field in a tool's output schema, and in each
+// of its alternative shapes, which do not allow undeclared fields either
+func addSchemaVersionProperty(schema *jsonschema.Schema) {
+	for _, shape := range schema.AnyOf {
+		addSchemaVersionProperty(shape)
+	}
+	if _, ok := schema.Properties[schemaVersionProperty]; ok {
+		return
+	}
+	if schema.Properties == nil {
+		schema.Properties = make(map[string]*jsonschema.Schema)
+	}
+	schema.Properties[schemaVersionProperty] = &jsonschema.Schema{
+		Type:        "integer",
+		Description: "The version of this tool's output schema; see the server_schema_info tool",
+		Minimum:     jsonschema.Ptr(float64(1)),
+	}
+	schema.Required = append(schema.Required, schemaVersionProperty)
+}
+
+// toolCatalog records the tools registered on a server along with their handlers and examples
+type toolCatalog struct {
+	handlers map[string]*ArxivToolHandler
+	examples map[string][]toolExample
+}
+
+// add registers a tool on the server. Its output schema gains the schemaVersion field, which the
+// handler then adds to every output.
+func (c *toolCatalog) add(server *mcp.Server, tool *mcp.Tool, handler *ArxivToolHandler, examples []toolExample) error {
+	version, ok := toolSchemaVersions[tool.Name]
+	if !ok {
+		return fmt.Errorf("no schema version defined for tool %q", tool.Name)
+	}
+	outputSchema, ok := tool.OutputSchema.(*jsonschema.Schema)
+	if !ok {
+		return fmt.Errorf("tool %q has no output schema", tool.Name)
+	}
+	addSchemaVersionProperty(outputSchema)
+	resolved, err := outputSchema.Resolve(nil)
+	if err != nil {
+		return fmt.Errorf("failed to resolve output schema of tool %q: %w", tool.Name, err)
+	}
+	handler.outputSchema = resolved
+	handler.schemaVersion = version
+	if c.handlers == nil {
+		c.handlers = make(map[string]*ArxivToolHandler)
+		c.examples = make(map[string][]toolExample)
+	}
+	c.handlers[tool.Name] = handler
+	c.examples[tool.Name] = examples
+	server.AddTool(tool, handler.Handle)
+	return nil
+}
+
+// schemaInfo returns the schema version and hash of every registered tool, sorted by name
+func (c *toolCatalog) schemaInfo() ([]ToolSchemaInfo, error) {
+	tools := make([]ToolSchemaInfo, 0, len(c.handlers))
+	for name, handler := range c.handlers {
+		hash, err := schemaHash(handler.inputSchema.Schema(), handler.outputSchema.Schema())
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash schemas of tool %q: %w", name, err)
+		}
+		tools = append(tools, ToolSchemaInfo{Name: name, SchemaVersion: handler.schemaVersion, SchemaHash: hash})
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools, nil
+}
+
+// serverSchemaInfo handles the schema info tool, describing the tools registered in the catalog
+func (c *toolCatalog) serverSchemaInfo(ctx context.Context, input json.RawMessage) (any, error) {
+	tools, err := c.schemaInfo()
+	if err != nil {
+		return nil, err
+	}
+	return ServerSchemaInfoOutput{Tools: tools}, nil
+}
+
+// schemaHash hashes the structure of an input and an output schema. Descriptions, titles and
+// examples are left out so that documentation changes do not look like schema changes.
+func schemaHash(input, output *jsonschema.Schema) (string, error) {
+	var structure [2]any
+	for i, schema := range []*jsonschema.Schema{input, output} {
+		data, err := json.Marshal(schema)
+		if err != nil {
+			return "", err
+		}
+		var decoded any
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			return "", err
+		}
+		structure[i] = stripSchemaAnnotations(decoded)
+	}
+	// Maps are marshalled with sorted keys, so the encoding is deterministic
+	data, err := json.Marshal(structure)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// stripSchemaAnnotations removes annotation keywords from a decoded JSON schema, leaving property
+// names and literal values (enum, const, default, required) untouched
+func stripSchemaAnnotations(schema any) any {
+	switch s := schema.(type) {
+	case []any:
+		stripped := make([]any, len(s))
+		for i, item := range s {
+			stripped[i] = stripSchemaAnnotations(item)
+		}
+		return stripped
+	case map[string]any:
+		stripped := make(map[string]any, len(s))
+		for key, value := range s {
+			switch key {
+			case "description", "title", "examples", "$comment":
+				continue
+			case "properties", "patternProperties", "$defs", "definitions", "dependentSchemas":
+				if named, ok := value.(map[string]any); ok {
+					schemas := make(map[string]any, len(named))
+					for name, sub := range named {
+						schemas[name] = stripSchemaAnnotations(sub)
+					}
+					stripped[key] = schemas
+					continue
+				}
+				stripped[key] = value
+			case "enum", "const", "default", "required":
+				stripped[key] = value
+			default:
+				stripped[key] = stripSchemaAnnotations(value)
+			}
+		}
+		return stripped
+	default:
+		return schema
+	}
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+
+	"opus-mcp/internal/attestation"
+	"opus-mcp/internal/storage"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+// toolSchemasGoldenFile holds the schema version and hash of every tool as of the last version bump
+const toolSchemasGoldenFile = "testdata/tool_schemas.golden.json"
+
+// callSchemaInfo registers every tool, including the optional ones, and calls server_schema_info
+func callSchemaInfo(t *testing.T) (ServerSchemaInfoOutput, int) {
+	t.Helper()
+	originalConfig, originalEnabled, originalSigner, originalAdminToken := globalS3Config, genericDownloadEnabled, globalSigner, adminToken
+	t.Cleanup(func() {
+		globalS3Config, genericDownloadEnabled, globalSigner, adminToken = originalConfig, originalEnabled, originalSigner, originalAdminToken
+	})
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	genericDownloadEnabled = true
+	adminToken = "test-admin-token"
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	globalSigner = attestation.NewSigner(privateKey)
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test-server", Version: "v0.0.1"}, nil)
+	if err := addMCPTools(server, toolDeps); err != nil {
+		t.Fatalf("addMCPTools() unexpected error: %v", err)
+	}
+	ctx := context.Background()
+	clientTransport, serverTransport := mcp.NewInMemoryTransports()
+	serverSession, err := server.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect server: %v", err)
+	}
+	defer serverSession.Close()
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "v0.0.1"}, nil)
+	clientSession, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect client: %v", err)
+	}
+	defer clientSession.Close()
+
+	result, err := clientSession.CallTool(ctx, &mcp.CallToolParams{Name: "server_schema_info", Arguments: map[string]any{}})
+	if err != nil {
+		t.Fatalf("CallTool() failed: %v", err)
+	}
+	if result.IsError {
+		t.Fatalf("server_schema_info failed: %s", resultText(t, result))
+	}
+	var output struct {
+		ServerSchemaInfoOutput
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal([]byte(resultText(t, result)), &output); err != nil {
+		t.Fatalf("failed to unmarshal output: %v", err)
+	}
+	return output.ServerSchemaInfoOutput, output.SchemaVersion
+}
+
+// TestToolSchemaVersions fails when a tool's schemas change without its schema version changing.
+// After bumping the version in toolSchemaVersions, regenerate the golden hashes with:
+// go test ./internal/server -run TestToolSchemaVersions -update
+func TestToolSchemaVersions(t *testing.T) {
+	info, ownVersion := callSchemaInfo(t)
+	if ownVersion != toolSchemaVersions["server_schema_info"] {
+		t.Errorf("server_schema_info output schemaVersion = %d, want %d", ownVersion, toolSchemaVersions["server_schema_info"])
+	}
+	if len(info.Tools) != len(toolSchemaVersions) {
+		t.Errorf("server_schema_info listed %d tools, want all %d with a schema version", len(info.Tools), len(toolSchemaVersions))
+	}
+
+	current := make(map[string]ToolSchemaInfo, len(info.Tools))
+	for _, tool := range info.Tools {
+		current[tool.Name] = tool
+	}
+
+	if *updateGolden {
+		data, err := json.MarshalIndent(current, "", "  ")
+		if err != nil {
+			t.Fatalf("failed to marshal golden hashes: %v", err)
+		}
+		if err := os.WriteFile(toolSchemasGoldenFile, append(data, '\n'), 0o644); err != nil {
+			t.Fatalf("failed to write golden hashes: %v", err)
+		}
+		return
+	}
+
+	data, err := os.ReadFile(toolSchemasGoldenFile)
+	if err != nil {
+		t.Fatalf("failed to read golden hashes: %v", err)
+	}
+	var golden map[string]ToolSchemaInfo
+	if err := json.Unmarshal(data, &golden); err != nil {
+		t.Fatalf("failed to unmarshal golden hashes: %v", err)
+	}
+
+	for name, tool := range current {
+		want, ok := golden[name]
+		switch {
+		case !ok:
+			t.Errorf("tool %s has no golden schema hash; regenerate the golden hashes with -update", name)
+		case tool.SchemaHash != want.SchemaHash && tool.SchemaVersion == want.SchemaVersion:
+			t.Errorf("schemas of tool %s changed without a schema version bump; increment its version in toolSchemaVersions and regenerate the golden hashes with -update", name)
+		case tool.SchemaHash != want.SchemaHash || tool.SchemaVersion != want.SchemaVersion:
+			t.Errorf("golden schema hash of tool %s is out of date (version %d, golden version %d); regenerate the golden hashes with -update", name, tool.SchemaVersion, want.SchemaVersion)
+		}
+	}
+	for name := range golden {
+		if _, ok := current[name]; !ok {
+			t.Errorf("tool %s has a golden schema hash but is not registered; regenerate the golden hashes with -update", name)
+		}
+	}
+}
+
+func TestSchemaHashIgnoresAnnotations(t *testing.T) {
+	base := func() *jsonschema.Schema {
+		return &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"description": {Type: "string", Description: "A property that happens to be called description"},
+			},
+		}
+	}
+	hash := func(schema *jsonschema.Schema) string {
+		t.Helper()
+		h, err := schemaHash(schema, &jsonschema.Schema{Type: "object"})
+		if err != nil {
+			t.Fatalf("schemaHash() unexpected error: %v", err)
+		}
+		return h
+	}
+	want := hash(base())
+
+	documented := base()
+	documented.Description = "Reworded"
+	documented.Properties["description"].Description = "Reworded too"
+	documented.Properties["description"].Examples = []any{"example"}
+	if got := hash(documented); got != want {
+		t.Error("changing descriptions and examples changed the schema hash")
+	}
+
+	renamed := base()
+	renamed.Properties["summary"] = renamed.Properties["description"]
+	delete(renamed.Properties, "description")
+	if got := hash(renamed); got == want {
+		t.Error("renaming a property did not change the schema hash")
+	}
+
+	retyped := base()
+	retyped.Properties["description"].Type = "integer"
+	if got := hash(retyped); got == want {
+		t.Error("changing a property type did not change the schema hash")
+	}
+}
+
+func TestVersionedOutputMarshal(t *testing.T) {
+	tests := []struct {
+		name   string
+		output any
+		want   string
+	}{
+		{"Struct", ServerSchemaInfoOutput{Tools: []ToolSchemaInfo{}}, `{"schemaVersion":2,"tools":[]}`},
+		{"Empty object", struct{}{}, `{"schemaVersion":2}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(versionedOutput{output: tt.output, version: 2})
+			if err != nil {
+				t.Fatalf("Marshal() unexpected error: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Marshal() = %s, want %s", data, tt.want)
+			}
+		})
+	}
+
+	if _, err := json.Marshal(versionedOutput{output: []string{"not", "an", "object"}, version: 1}); err == nil {
+		t.Error("Marshal() of a non-object output should fail")
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"opus-mcp/internal"
+	"opus-mcp/internal/metrics"
+	"opus-mcp/internal/parser"
+)
+
+// defaultSearchFetchSize is the number of results a search fetches when the call does not say
+const defaultSearchFetchSize = 10
+
+// searchFieldPrefixes maps the search fields of arxiv_search to their arXiv field prefixes.
+// See: https://info.arxiv.org/help/api/user-manual.html#query_details
+var searchFieldPrefixes = map[string]string{
+	"title":       "ti",
+	"abstract":    "abs",
+	"author":      "au",
+	"comment":     "co",
+	"journal_ref": "jr",
+	"all":         "all",
+}
+
+// searchFieldValues are the valid values of the field argument of searches, in schema order
+var searchFieldValues = []any{"title", "abstract", "author", "comment", "journal_ref", "all"}
+
+// ArxivSearchArgs defines the input parameters for searching arXiv by field
+type ArxivSearchArgs struct {
+	Query         string `json:"query" jsonschema:"Boolean expression of words and double-quoted phrases, e.g., 'transformer AND attention'"`
+	Field         string `json:"field,omitempty" jsonschema:"The field every term of the query is searched in: title, abstract, author, comment, journal_ref or all. Defaults to all"`
+	StartIndex    uint   `json:"startIndex,omitempty" jsonschema:"The starting index of results to fetch (0-based)"`
+	FetchSize     uint   `json:"fetchSize,omitempty" jsonschema:"The number of results to fetch. Defaults to 10"`
+	SortBy        string `json:"sortBy,omitempty" jsonschema:"How arXiv orders the results: relevance, lastUpdatedDate or submittedDate. Defaults to relevance"`
+	SortOrder     string `json:"sortOrder,omitempty" jsonschema:"The direction of sortBy: ascending or descending. Defaults to descending"`
+	Raw           bool   `json:"raw,omitempty" jsonschema:"Return the feed as parsed, with the feed's metadata and every entry's RSS, iTunes and Dublin Core fields and extensions, instead of flattened entries. Defaults to false"`
+	Fields        string `json:"fields,omitempty" jsonschema:"How much of every result to return: full or headline, only the identifier, title, primary category and announcement date. Defaults to full"`
+	StrictParse   bool   `json:"strictParse,omitempty" jsonschema:"Fail on any XML error in the arXiv feed instead of removing invalid characters and escaping bare ampersands before parsing. Defaults to false"`
+	NormalizeText *bool  `json:"normalizeText,omitempty" jsonschema:"Return the titles and abstracts of flattened results as plain text, with the feed's line breaks, HTML entities and LaTeX markup resolved, instead of as arXiv sent them. Defaults to true"`
+}
+
+// arxivSearch handles searching arXiv for a boolean expression in a single search field. Unlike
+// categoryFetchLatest, it does NOT retry on errors; it waits for the arXiv rate limiter.
+// See: https://info.arxiv.org/help/api/tou.html
+func arxivSearch(ctx context.Context, input json.RawMessage) (any, error) {
+	var args ArxivSearchArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+	field := cmp.Or(args.Field, "all")
+	prefix, ok := searchFieldPrefixes[field]
+	if !ok {
+		return nil, fmt.Errorf("invalid search field %q, valid values are title, abstract, author, comment, journal_ref and all", args.Field)
+	}
+	interpretation, err := parser.ParseFieldExpression(args.Query, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse search expression: %w", err)
+	}
+
+	page := searchPage{
+		StartIndex:    args.StartIndex,
+		FetchSize:     args.FetchSize,
+		SortBy:        cmp.Or(args.SortBy, sortByRelevance),
+		SortOrder:     args.SortOrder,
+		Raw:           args.Raw,
+		Fields:        args.Fields,
+		StrictParse:   args.StrictParse,
+		NormalizeText: args.NormalizeText,
+	}
+	return searchArxiv(ctx, interpretation, page, "field", field)
+}
+
+// searchPage is the page of results a search query asks arXiv for, and how they are returned
+type searchPage struct {
+	StartIndex    uint
+	FetchSize     uint
+	SortBy        string
+	SortOrder     string
+	Raw           bool
+	Fields        string
+	StrictParse   bool
+	NormalizeText *bool
+}
+
+// searchArxiv runs an interpreted search query within the arXiv rate limit and returns a page of
+// its results, logging the request with attrs
+func searchArxiv(ctx context.Context, interpretation *parser.Interpretation, page searchPage, attrs ...any) (any, error) {
+	// Fail fast while arXiv has asked for requests to be held back
+	if cooldownErr := arxivCooldown.check(); cooldownErr != nil {
+		return nil, cooldownErr
+	}
+	if err := takeArxivTurn(ctx, arxivRequestAPI); err != nil {
+		return nil, err
+	}
+
+	// The query is already escaped clause by clause, with '+' separating the clauses
+	requestURL := arxivQueryEndpoint + "?search_query=" + interpretation.Query +
+		"&start=" + fmt.Sprint(page.StartIndex) +
+		"&max_results=" + fmt.Sprint(cmp.Or(page.FetchSize, defaultSearchFetchSize)) +
+		"&sortBy=" + page.SortBy +
+		"&sortOrder=" + cmp.Or(page.SortOrder, sortOrderDescending)
+	slog.Info("Searching arXiv", append([]any{"url", requestURL}, attrs...)...)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	timer := metrics.StartOperation(metrics.SlowArxivQuery)
+	resp, err := toolDeps.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch from arXiv: %w", err)
+	}
+	defer resp.Body.Close()
+	clockSkew.Observe("arxiv", resp.Header, time.Now())
+	if cooldownErr := arxivCooldown.observe(resp); cooldownErr != nil {
+		return nil, cooldownErr
+	}
+	if err := checkArxivStatus(resp); err != nil {
+		return nil, err
+	}
+	body, err := internal.ReadAll(ctx, resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	timer.Done(int64(len(body)), "url", requestURL)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	output, err := parseCategoryFeed(body, page.StrictParse)
+	if err != nil {
+		return nil, err
+	}
+	if page.SortBy == sortByRelevance {
+		rankByRelevance(output.Items, int(page.StartIndex))
+	}
+	if page.Fields == entryFieldsHeadline {
+		output.Items = headlineEntries(output.Items)
+	}
+	output.Interpretation = interpretation
+	return entryShape{raw: page.Raw, rawText: !normalizeText(page.NormalizeText)}.output(output), nil
+}
+
+// describeSearch describes a search as its expression and the articles it returned
+func describeSearch(input json.RawMessage, output any) *recentQuery {
+	var args ArxivSearchArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil
+	}
+	return &recentQuery{Query: args.Query, ArticleIDs: resultArticleIDs(output)}
+}
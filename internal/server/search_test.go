@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestArxivSearch(t *testing.T) {
+	var queries []string
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		_, _ = w.Write([]byte(idListFeed([]string{"2410.01234"})))
+	})
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			"Title search with defaults",
+			`{"query": "transformer AND attention", "field": "title"}`,
+			"search_query=(ti:transformer+AND+ti:attention)&start=0&max_results=10&sortBy=relevance&sortOrder=descending",
+		},
+		{
+			"Abstract phrase sorted by submission",
+			`{"query": "\"in-context learning\" -survey", "field": "abstract", "startIndex": 20, "fetchSize": 5, "sortBy": "submittedDate", "sortOrder": "ascending"}`,
+			"search_query=(abs:%22in-context+learning%22+NOT+abs:survey)&start=20&max_results=5&sortBy=submittedDate&sortOrder=ascending",
+		},
+		{
+			"All fields by default",
+			`{"query": "vaswani"}`,
+			"search_query=(all:vaswani)&start=0&max_results=10&sortBy=relevance&sortOrder=descending",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries = nil
+			output, err := arxivSearch(context.Background(), json.RawMessage(tt.input))
+			if err != nil {
+				t.Fatalf("arxivSearch() unexpected error: %v", err)
+			}
+			if len(queries) != 1 || queries[0] != tt.want {
+				t.Errorf("queried %q, want %q", queries, tt.want)
+			}
+			result := output.(*CategoryFetchSummary)
+			if len(result.Items) != 1 || result.Items[0].ArticleID != "2410.01234v1" || result.Interpretation == nil {
+				t.Errorf("arxivSearch() = %+v, want the fetched entry and its interpretation", result)
+			}
+		})
+	}
+}
+
+func TestArxivSearchErrors(t *testing.T) {
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected API request %s", r.URL)
+	})
+
+	tests := []struct {
+		name      string
+		input     string
+		wantError string
+	}{
+		{"Invalid field", `{"query": "attention", "field": "ti"}`, `invalid search field "ti"`},
+		{"Empty expression", `{"query": "  ", "field": "title"}`, "empty expression"},
+		{"Unterminated phrase", `{"query": "\"self attention", "field": "abstract"}`, "unterminated quoted phrase"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := arxivSearch(context.Background(), json.RawMessage(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("arxivSearch() error = %v, want error containing %q", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestSearchToolRejectsInvalidField(t *testing.T) {
+	_, handler, err := newSearchTool()
+	if err != nil {
+		t.Fatalf("newSearchTool() unexpected error: %v", err)
+	}
+	result := handler.handle(context.Background(), newTestCallToolRequest("arxiv_search", `{"query": "attention", "field": "keywords"}`))
+	if !result.IsError {
+		t.Errorf("handle() = %+v, want an invalid input error for an unknown field", result)
+	}
+}
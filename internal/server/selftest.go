@@ -0,0 +1,245 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"opus-mcp/internal/parser"
+	"opus-mcp/internal/storage"
+	"opus-mcp/internal/taxonomy"
+)
+
+// Statuses of self-test checks
+const (
+	selftestPass = "pass"
+	selftestFail = "fail"
+	selftestSkip = "skip"
+)
+
+const (
+	// selftestExpression is parsed by the self-test and must turn into selftestQuery
+	selftestExpression = `cs.AI AND "large language models"`
+	selftestQuery      = `(cat:cs.AI+AND+all:%22large+language+models%22)`
+	// selftestArticleID is a well-known article the self-test fetches from arXiv
+	selftestArticleID = "1706.03762"
+	// selftestPrefix is the bucket prefix of the probe object written by the self-test
+	selftestPrefix = "selftest/"
+	// probeCleanupTimeout bounds the deletion of the probe object, which outlives the check
+	probeCleanupTimeout = 30 * time.Second
+)
+
+// selftestCheckTimeout bounds every self-test check, so that a hung dependency fails its own check
+// without stalling the others; replaced in tests
+var selftestCheckTimeout = 30 * time.Second
+
+// Stores the self-test probe object; replaced in tests
+var (
+	probeUploader = func(ctx context.Context, objectName string, data []byte) error {
+		return storage.PutObjectBytes(ctx, globalS3Config, S3_ARTICLES_BUCKET, objectName, data, "text/plain; charset=utf-8")
+	}
+	probeStatter = func(ctx context.Context, objectName string) (storage.ObjectAttributes, error) {
+		return storage.StatObject(ctx, globalS3Config, S3_ARTICLES_BUCKET, objectName)
+	}
+	probeRemover = func(ctx context.Context, objectName string) error {
+		return storage.RemoveObject(ctx, globalS3Config, S3_ARTICLES_BUCKET, objectName)
+	}
+)
+
+// ServerSelftestArgs defines the input parameters of the self-test tool
+type ServerSelftestArgs struct {
+	SkipNetwork bool `json:"skipNetwork,omitempty" jsonschema:"Skip the checks that reach arXiv, e.g., for an offline smoke test; the taxonomy check then only confirms the embedded taxonomy snapshot. Defaults to false"`
+}
+
+// SelftestCheck is the outcome of a single self-test check
+type SelftestCheck struct {
+	Name       string `json:"name" jsonschema:"The subsystem the check exercised: parser, arxiv, taxonomy or storage"`
+	Status     string `json:"status" jsonschema:"One of pass, fail or skip"`
+	DurationMs int64  `json:"durationMs" jsonschema:"How long the check took in milliseconds"`
+	Detail     string `json:"detail,omitempty" jsonschema:"What the check found, or why it was skipped"`
+	Error      string `json:"error,omitempty" jsonschema:"Why the check failed"`
+}
+
+// ServerSelftestOutput is the report of the self-test tool
+type ServerSelftestOutput struct {
+	Passed bool            `json:"passed" jsonschema:"Whether no check failed; skipped checks do not count as failures"`
+	Checks []SelftestCheck `json:"checks" jsonschema:"The outcome of every check, in a fixed order"`
+}
+
+// skippedCheck is returned by a check that does not apply to this server or this call
+type skippedCheck struct {
+	reason string
+}
+
+func (s *skippedCheck) Error() string {
+	return s.reason
+}
+
+// selftestCheck exercises a subsystem end to end and describes what it found
+type selftestCheck struct {
+	name string
+	run  func(ctx context.Context, args ServerSelftestArgs) (string, error)
+}
+
+// selftestChecks are the checks run by the self-test, in the order they are reported
+var selftestChecks = []selftestCheck{
+	{name: "parser", run: checkParser},
+	{name: "arxiv", run: checkArxiv},
+	{name: "taxonomy", run: checkTaxonomy},
+	{name: "storage", run: checkStorage},
+}
+
+// serverSelftest contains the handler function of the self-test tool. The checks run concurrently,
+// each bounded by selftestCheckTimeout.
+func serverSelftest(ctx context.Context, input json.RawMessage) (any, error) {
+	if info, _ := callInfoFrom(ctx); !info.Admin {
+		return nil, &ToolError{
+			Code:    ErrCodeUnauthorized,
+			Message: "the self-test is only available to clients presenting the admin token",
+		}
+	}
+	var args ServerSelftestArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+
+	output := ServerSelftestOutput{Passed: true, Checks: make([]SelftestCheck, len(selftestChecks))}
+	done := make(chan struct{}, len(selftestChecks))
+	for i, check := range selftestChecks {
+		go func() {
+			output.Checks[i] = runSelftestCheck(ctx, check, args)
+			done <- struct{}{}
+		}()
+	}
+	for range selftestChecks {
+		<-done
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for _, check := range output.Checks {
+		if check.Status == selftestFail {
+			output.Passed = false
+			slog.Warn("Self-test check failed", "check", check.Name, "error", check.Error)
+		}
+	}
+	return output, nil
+}
+
+// runSelftestCheck runs a check within selftestCheckTimeout. A check that does not return in time
+// is reported as failed and left to give up on its cancelled context.
+func runSelftestCheck(ctx context.Context, check selftestCheck, args ServerSelftestArgs) SelftestCheck {
+	ctx, cancel := context.WithTimeout(ctx, selftestCheckTimeout)
+	defer cancel()
+
+	type outcome struct {
+		detail string
+		err    error
+	}
+	start := time.Now()
+	finished := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				finished <- outcome{err: fmt.Errorf("internal error: %v", r)}
+			}
+		}()
+		detail, err := check.run(ctx, args)
+		finished <- outcome{detail, err}
+	}()
+
+	var result outcome
+	select {
+	case result = <-finished:
+	case <-ctx.Done():
+		result.err = fmt.Errorf("did not finish within %s: %w", selftestCheckTimeout, ctx.Err())
+	}
+	report := SelftestCheck{Name: check.name, Status: selftestPass, DurationMs: time.Since(start).Milliseconds(), Detail: result.detail}
+	var skipped *skippedCheck
+	switch {
+	case errors.As(result.err, &skipped):
+		report.Status, report.Detail = selftestSkip, skipped.reason
+	case result.err != nil:
+		report.Status, report.Error = selftestFail, result.err.Error()
+	}
+	return report
+}
+
+// checkParser parses a known expression and compares the query it turns into
+func checkParser(ctx context.Context, args ServerSelftestArgs) (string, error) {
+	interpretation, err := parser.ParseMixedExpression(selftestExpression, "")
+	if err != nil {
+		return "", err
+	}
+	if interpretation.Query != selftestQuery {
+		return "", fmt.Errorf("%s was parsed into %s, want %s", selftestExpression, interpretation.Query, selftestQuery)
+	}
+	return fmt.Sprintf("%s was parsed into %s", selftestExpression, interpretation.Query), nil
+}
+
+// checkArxiv fetches a single well-known article from the arXiv API, counting against the quota
+// and waiting for the rate limiter like any other query
+func checkArxiv(ctx context.Context, args ServerSelftestArgs) (string, error) {
+	if args.SkipNetwork {
+		return "", &skippedCheck{"skipNetwork is set"}
+	}
+	found, err := fetchIDBatch(ctx, []string{selftestArticleID}, false)
+	if err != nil {
+		return "", err
+	}
+	entry, ok := found[selftestArticleID]
+	if !ok {
+		return "", fmt.Errorf("arXiv did not return article %s", selftestArticleID)
+	}
+	return fmt.Sprintf("fetched %s: %s", entry.ArticleID, entry.Title), nil
+}
+
+// checkTaxonomy fetches and parses the arXiv category taxonomy, or only confirms that the embedded
+// taxonomy snapshot is usable when the network is skipped
+func checkTaxonomy(ctx context.Context, args ServerSelftestArgs) (string, error) {
+	if args.SkipNetwork {
+		snapshot := taxonomy.Embedded()
+		if _, ok := snapshot.Category("cs.AI"); !ok {
+			return "", fmt.Errorf("the embedded taxonomy snapshot does not know cs.AI")
+		}
+		return fmt.Sprintf("embedded taxonomy snapshot with %d categories", len(snapshot.Categories)), nil
+	}
+	result, err := fetchCategoryTaxonomy(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	fetched := result.(Taxonomy)
+	return fmt.Sprintf("fetched taxonomy with %d groups and %d categories", len(fetched.Groups), len(fetched.Categories)), nil
+}
+
+// checkStorage writes a small probe object under the selftest/ prefix, reads back its size and
+// deletes it again
+func checkStorage(ctx context.Context, args ServerSelftestArgs) (string, error) {
+	if globalS3Config == nil {
+		return "", &skippedCheck{"S3 storage is not configured"}
+	}
+	objectName := fmt.Sprintf("%sprobe-%d.txt", selftestPrefix, time.Now().UnixNano())
+	probe := []byte("opus-mcp self-test probe\n")
+	if err := probeUploader(ctx, objectName, probe); err != nil {
+		return "", fmt.Errorf("upload: %w", err)
+	}
+	// The probe is deleted even if the check has run out of time
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), probeCleanupTimeout)
+		defer cancel()
+		if err := probeRemover(cleanupCtx, objectName); err != nil {
+			slog.Error("Failed to remove self-test probe object", "object", objectName, "error", err)
+		}
+	}()
+	attributes, err := probeStatter(ctx, objectName)
+	if err != nil {
+		return "", fmt.Errorf("stat: %w", err)
+	}
+	if attributes.Size != int64(len(probe)) {
+		return "", fmt.Errorf("probe object is %d bytes, want %d", attributes.Size, len(probe))
+	}
+	return fmt.Sprintf("uploaded, stat and deleted %s in bucket %s", objectName, S3_ARTICLES_BUCKET), nil
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/storage"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// taxonomyPage is a minimal arXiv category taxonomy page with a single category
+const taxonomyPage = `<html><body>
+<h2 class="accordion-head">Computer Science</h2>
+<div class="accordion-body">
+  <div class="columns"><div class="column"><h4>cs.AI <span>(Artificial Intelligence)</span></h4></div>
+  <div class="column"><p>Covers all areas of AI.</p></div></div>
+</div>
+</body></html>`
+
+// fakeSelftestDependencies points the self-test at fake arXiv, taxonomy and storage endpoints and
+// returns the probe objects that were left in the fake store
+func fakeSelftestDependencies(t *testing.T) func() []string {
+	t.Helper()
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, idListFeed([]string{selftestArticleID}))
+	})
+	taxonomyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, taxonomyPage)
+	}))
+	t.Cleanup(taxonomyServer.Close)
+
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	originalURL, originalConfig := categoryTaxonomyURL, globalS3Config
+	originalUploader, originalStatter, originalRemover := probeUploader, probeStatter, probeRemover
+	t.Cleanup(func() {
+		categoryTaxonomyURL, globalS3Config = originalURL, originalConfig
+		probeUploader, probeStatter, probeRemover = originalUploader, originalStatter, originalRemover
+	})
+	categoryTaxonomyURL = taxonomyServer.URL
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	probeUploader = func(ctx context.Context, objectName string, data []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		objects[objectName] = data
+		return nil
+	}
+	probeStatter = func(ctx context.Context, objectName string) (storage.ObjectAttributes, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		data, ok := objects[objectName]
+		if !ok {
+			return storage.ObjectAttributes{}, storage.ErrObjectNotFound
+		}
+		return storage.ObjectAttributes{Size: int64(len(data))}, nil
+	}
+	probeRemover = func(ctx context.Context, objectName string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(objects, objectName)
+		return nil
+	}
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		var left []string
+		for name := range objects {
+			left = append(left, name)
+		}
+		return left
+	}
+}
+
+// stdioSelftestContext is the context of a self-test call over stdio, where the client is the admin
+func stdioSelftestContext() context.Context {
+	req := &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "server_selftest"}}
+	return withCallInfo(context.Background(), newCallInfo(req))
+}
+
+// selftestStatuses maps the checks of a self-test report to their statuses
+func selftestStatuses(output ServerSelftestOutput) map[string]string {
+	statuses := map[string]string{}
+	for _, check := range output.Checks {
+		statuses[check.Name] = check.Status
+	}
+	return statuses
+}
+
+func TestServerSelftestPasses(t *testing.T) {
+	leftovers := fakeSelftestDependencies(t)
+	output, err := serverSelftest(stdioSelftestContext(), json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatalf("serverSelftest() unexpected error: %v", err)
+	}
+	report := output.(ServerSelftestOutput)
+	if !report.Passed {
+		t.Errorf("serverSelftest() = %+v, want every check to pass", report.Checks)
+	}
+	for _, name := range []string{"parser", "arxiv", "taxonomy", "storage"} {
+		if got := selftestStatuses(report)[name]; got != selftestPass {
+			t.Errorf("check %s = %s, want %s", name, got, selftestPass)
+		}
+	}
+	if left := leftovers(); len(left) != 0 {
+		t.Errorf("probe objects %v were left behind", left)
+	}
+}
+
+func TestServerSelftestSkipNetwork(t *testing.T) {
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("arXiv was queried despite skipNetwork")
+	})
+	original := globalS3Config
+	t.Cleanup(func() { globalS3Config = original })
+	globalS3Config = nil
+
+	output, err := serverSelftest(stdioSelftestContext(), json.RawMessage(`{"skipNetwork": true}`))
+	if err != nil {
+		t.Fatalf("serverSelftest() unexpected error: %v", err)
+	}
+	report := output.(ServerSelftestOutput)
+	want := map[string]string{"parser": selftestPass, "arxiv": selftestSkip, "taxonomy": selftestPass, "storage": selftestSkip}
+	for name, status := range want {
+		if got := selftestStatuses(report)[name]; got != status {
+			t.Errorf("check %s = %s, want %s", name, got, status)
+		}
+	}
+	if !report.Passed {
+		t.Error("skipped checks should not fail the self-test")
+	}
+}
+
+func TestServerSelftestBoundsEveryCheck(t *testing.T) {
+	leftovers := fakeSelftestDependencies(t)
+	original := selftestCheckTimeout
+	t.Cleanup(func() { selftestCheckTimeout = original })
+	selftestCheckTimeout = 500 * time.Millisecond
+
+	// Storage hangs until its check runs out of time, and arXiv is unavailable
+	gaveUp := make(chan struct{})
+	probeUploader = func(ctx context.Context, objectName string, data []byte) error {
+		defer close(gaveUp)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+
+	start := time.Now()
+	output, err := serverSelftest(stdioSelftestContext(), json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatalf("serverSelftest() unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("serverSelftest() took %v, want the hung check to be cut off", elapsed)
+	}
+	report := output.(ServerSelftestOutput)
+	if report.Passed {
+		t.Error("serverSelftest() passed with failing checks")
+	}
+	want := map[string]string{"parser": selftestPass, "arxiv": selftestFail, "taxonomy": selftestPass, "storage": selftestFail}
+	for _, check := range report.Checks {
+		if check.Status != want[check.Name] {
+			t.Errorf("check %s = %s (%s), want %s", check.Name, check.Status, check.Error, want[check.Name])
+		}
+		if check.Status == selftestFail && check.Error == "" {
+			t.Errorf("failed check %s has no error", check.Name)
+		}
+	}
+	// The abandoned check gives up on its cancelled context
+	<-gaveUp
+	if left := leftovers(); len(left) != 0 {
+		t.Errorf("probe objects %v were left behind", left)
+	}
+}
+
+func TestServerSelftestRequiresAdminTokenOverHTTP(t *testing.T) {
+	withAdminToken(t, testAdminToken)
+	r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	req := &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "server_selftest"}, Extra: &mcp.RequestExtra{Header: r.Header}}
+	_, err := serverSelftest(withCallInfo(context.Background(), newCallInfo(req)), json.RawMessage(`{"skipNetwork": true}`))
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeUnauthorized {
+		t.Errorf("serverSelftest() without the admin token error = %v, want %s", err, ErrCodeUnauthorized)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,14 +15,17 @@ import (
 	"syscall"
 	"time"
 
+	"opus-mcp/internal"
+	"opus-mcp/internal/library"
 	"opus-mcp/internal/metadata"
+	"opus-mcp/internal/metrics"
+	"opus-mcp/internal/settings"
 	"opus-mcp/internal/storage"
 
 	"github.com/google/jsonschema-go/jsonschema"
-	"github.com/mmcdole/gofeed"
 	ext "github.com/mmcdole/gofeed/extensions"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
-	"github.com/sethvargo/go-envconfig"
+	"golang.org/x/time/rate"
 )
 
 var serverProcessStartTime time.Time
@@ -37,7 +41,7 @@ func uptime() time.Duration {
 func LoadS3Config() (*storage.S3Config, error) {
 	ctx := context.Background()
 	var config storage.S3Config
-	if err := envconfig.Process(ctx, &config); err != nil {
+	if err := settings.Process(ctx, &config); err != nil {
 		slog.Error("Failed to process S3 configuration from environment", "error", err)
 		return nil, err
 	}
@@ -47,7 +51,7 @@ func LoadS3Config() (*storage.S3Config, error) {
 	}
 
 	slog.Info("S3 configuration loaded from environment variables",
-		"endpoint", config.Endpoint,
+		"endpoints", config.Endpoints(),
 		"use_ssl", config.UseSSL,
 		"insecure_skip_verify", config.InsecureSkipVerify)
 
@@ -73,47 +77,66 @@ func createCORSMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// createMCPLoggingMiddleware creates an MCP middleware that logs method calls.
-func createMCPLoggingMiddleware() mcp.Middleware {
-	return func(next mcp.MethodHandler) mcp.MethodHandler {
-		return func(
-			ctx context.Context,
-			method string,
-			req mcp.Request,
-		) (mcp.Result, error) {
-			start := time.Now()
-			sessionID := req.GetSession().ID()
-
-			// Log request details.
-			slog.Info("(Request) Session: \"" + sessionID + "\" | Method: " + method)
-
-			// Call the actual handler.
-			result, err := next(ctx, method, req)
-
-			// Log response details.
-			duration := time.Since(start)
-
-			if err != nil {
-				slog.Info("(Response) Session: \"" + sessionID + "\" | Method: " + method + " | Status: ERROR | Duration: " + duration.String() + " | Error: " + err.Error())
-			} else {
-				slog.Info("(Response) Session: \"" + sessionID + "\" | Method: " + method + " | Status: OK | Duration: " + duration.String())
-			}
+// statusRecorder records the status code written by an HTTP handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
 
-			return result, err
-		}
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streaming responses through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
 	}
 }
 
+// createAccessLogMiddleware logs every HTTP request with the identity of its client
+func createAccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		slog.Info("HTTP request", "method", r.Method, "path", r.URL.Path, "client", clientIdentityFrom(r.Context()), "status", recorder.status, "duration", time.Since(start))
+	})
+}
+
+// healthCheckHandler reports liveness, build information and the registered tools. The response
+// only changes when the server does, so it carries an ETag and can be revalidated cheaply. Volatile
+// fields, such as the uptime, are only included with ?verbose=true, which is never cached.
 func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	verbose := r.URL.Query().Get("verbose") == "true"
 	responseMap := map[string]any{
 		"status":       "ok",
 		"name":         metadata.APP_TITLE + " (" + metadata.APP_NAME + ")",
 		"buildVersion": metadata.BuildVersion,
 		"buildTime":    metadata.BuildTime,
-		"uptime":       uptime().String(),
 		"os":           runtime.GOOS,
 		"arch":         runtime.GOARCH,
 	}
+	if globalS3Config != nil {
+		responseMap["s3Endpoint"] = storage.ActiveEndpoint(globalS3Config)
+	}
+	if verbose {
+		responseMap["uptime"] = uptime().String()
+		// The skew is only reported once a response has measured it
+		if clock := clockStatus(); clock != nil {
+			responseMap["clock"] = clock
+		}
+		if globalS3Config != nil {
+			responseMap["s3Endpoints"] = storage.EndpointStates(globalS3Config)
+		}
+	}
+	// Tools that failed to register leave the server running, but degraded
+	tools := toolRegistrationStatus()
+	responseMap["tools"] = tools
+	if len(tools.Degraded) > 0 {
+		responseMap["status"] = "degraded"
+	}
 	jsonData, err := json.MarshalIndent(responseMap, "", "    ")
 	if err != nil {
 		slog.Error("health check JSON marshalling failed", "error", err)
@@ -121,6 +144,12 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.Header().Set("Connection", "close")
+	if !verbose {
+		writeCacheable(w, r, jsonData, "application/json", healthCacheMaxAge)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
 	byteN, err := io.Writer.Write(w, jsonData)
 	if err != nil {
 		slog.Error("health check response writing failed", "error", err)
@@ -130,133 +159,292 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	slog.Debug("health check responded", "bytes_written", byteN)
 }
 
-func addMCPTools(server *mcp.Server) error {
-	categoryFetchLatestInputSchema := &jsonschema.Schema{
-		Type: "object",
-		Properties: map[string]*jsonschema.Schema{
-			"category": {
-				Description: "Expression of arXiv categories with boolean operators.",
-				Examples:    []any{"cs.AI", "cs.LG not cs.CV not cs.RO", "cs.AI + cs.LG - cs.CV", "cs.AI or (cs.LG not cs.CV)"},
-				Type:        "string",
-				Items: &jsonschema.Schema{
-					Type: "string",
-				},
-			},
-			"startIndex": {
-				Description: "The starting index for fetching results (0-based)",
-				Type:        "integer",
-				Minimum:     jsonschema.Ptr(float64(0)),
-				Default:     json.RawMessage([]byte(`0`)),
-			},
-			"fetchSize": {
-				Description: "Number of results to fetch (min: 1, max: 100)",
-				Type:        "integer",
-				Minimum:     jsonschema.Ptr(float64(1)),
-				Maximum:     jsonschema.Ptr(float64(100)),
-				Default:     json.RawMessage([]byte(`10`)),
+// readinessHandler reports whether the server is ready to accept work, along with the current
+// queue depth and estimated wait of rate-limited tool calls, the state of background downloads, the
+// estimated throughput of recent ones and the sizes of recent tool responses
+func readinessHandler(w http.ResponseWriter, r *http.Request) {
+	jsonData, err := json.MarshalIndent(serverStatusReport(), "", "    ")
+	if err != nil {
+		slog.Error("readiness check JSON marshalling failed", "error", err)
+		http.Error(w, "JSON marshalling failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Connection", "close")
+	if _, err := w.Write(jsonData); err != nil {
+		slog.Error("readiness check response writing failed", "error", err)
+	}
+}
+
+// feedTypeSchemas are simplified schemas for the gofeed types whose reflected schemas would be
+// circular, for output schemas that embed feed entries. They are only needed for as long as tool
+// outputs embed third-party feed types; a tool whose output schema can no longer be reflected is
+// reported as degraded rather than taking the other tools down with it.
+func feedTypeSchemas() map[reflect.Type]*jsonschema.Schema {
+	return map[reflect.Type]*jsonschema.Schema{
+		// Break the cycle in ITunesCategory
+		reflect.TypeFor[ext.ITunesCategory](): {
+			Type:        "object",
+			Description: "iTunes category (circular reference simplified)",
+			Properties: map[string]*jsonschema.Schema{
+				"text":        {Type: "string"},
+				"subcategory": {Type: "object", Description: "Nested subcategory"},
 			},
 		},
-		Required: []string{"category"},
-	}
-
-	// Generate output schema from gofeed.Feed structure using reflection
-	// Handle circular references by providing simplified schemas for problematic types
-	categoryFetchLatestOutputSchema, err := jsonschema.ForType(reflect.TypeFor[gofeed.Feed](), &jsonschema.ForOptions{
-		TypeSchemas: map[reflect.Type]*jsonschema.Schema{
-			// Break the cycle in ITunesCategory
-			reflect.TypeFor[ext.ITunesCategory](): {
-				Type:        "object",
-				Description: "iTunes category (circular reference simplified)",
-				Properties: map[string]*jsonschema.Schema{
-					"text":        {Type: "string"},
-					"subcategory": {Type: "object", Description: "Nested subcategory"},
-				},
-			},
-			// Break the cycle in Extension
-			reflect.TypeFor[ext.Extension](): {
-				Type:        "object",
-				Description: "Generic extension (circular reference simplified)",
-				// Allow any type for extensions (nested objects, arrays, strings, etc.)
-			},
+		// Break the cycle in Extension
+		reflect.TypeFor[ext.Extension](): {
+			Type:        "object",
+			Description: "Generic extension (circular reference simplified)",
+			// Allow any type for extensions (nested objects, arrays, strings, etc.)
 		},
-	})
-	if err != nil {
-		return fmt.Errorf("failed to reflect output schema from gofeed.Feed: %w", err)
+	}
+}
+
+// loadConfiguration loads the configuration of the tools and their dependencies from environment
+// variables into the package variables they are read from
+func loadConfiguration() {
+	// Load the clock sanity check first, so that the responses of startup are already checked
+	if clockConfig, err := LoadClockConfig(); err != nil {
+		slog.Warn("Clock configuration not available - using the default skew threshold without correction", "error", err)
+	} else {
+		clockSkew.SetThreshold(clockConfig.SkewThreshold.Duration())
+		clockCorrection = clockConfig.Correction
+		clockCheckInterval = clockConfig.CheckInterval.Duration()
 	}
 
-	categoryFetchLatestHandler, err := NewArxivToolHandler(categoryFetchLatestInputSchema, categoryFetchLatestOutputSchema, categoryFetchLatest)
+	// Load S3 configuration from environment variables at startup
+	var err error
+	globalS3Config, err = LoadS3Config()
 	if err != nil {
-		return fmt.Errorf("failed to create category fetch latest handler: %w", err)
+		slog.Warn("S3 configuration not available - S3-dependent tools will be disabled", "error", err)
+		slog.Warn("To enable S3 features, set: OPUS_MCP_S3_ENDPOINT, OPUS_MCP_S3_ACCESS_KEY, OPUS_MCP_S3_SECRET_KEY")
+		globalS3Config = nil
+	} else {
+		globalLibrary = library.New(library.NewS3Store(globalS3Config, S3_ARTICLES_BUCKET))
+		globalAuditLog = library.NewAuditLog(library.NewS3ObjectStore(globalS3Config, S3_ARTICLES_BUCKET, library.AuditObjectName))
 	}
-	slog.Info("category fetch handler created successfully")
 
-	server.AddTool(&mcp.Tool{
-		Name:         "arxiv_category_fetch_latest",
-		Description:  "Fetch latest publications from arXiv by category. See https://arxiv.org/category_taxonomy for valid categories.",
-		InputSchema:  categoryFetchLatestInputSchema,
-		OutputSchema: categoryFetchLatestOutputSchema,
-	}, categoryFetchLatestHandler.Handle)
+	// Load the layout of stored articles. An invalid template refuses to start, since falling back
+	// to the default would store articles where nobody looks for them
+	if config, err := LoadObjectNameConfig(); err != nil {
+		slog.Error("Object name configuration not available", "error", err)
+		os.Exit(1)
+	} else if names, err := newObjectNameTemplate(config.Template); err != nil {
+		slog.Error("Invalid object name template", "template", config.Template, "error", err)
+		os.Exit(1)
+	} else {
+		objectNames = names
+	}
 
-	// Category taxonomy tool
-	taxonomyInputSchema := &jsonschema.Schema{
-		Type:       "object",
-		Properties: map[string]*jsonschema.Schema{},
+	// Load the memory budget for downloads held for retryable uploads
+	if bufferConfig, err := storage.LoadUploadBufferConfig(); err != nil {
+		slog.Warn("Upload buffer configuration not available - using the default budget without spooling", "error", err)
+	} else {
+		storage.ConfigureUploadBuffers(bufferConfig)
 	}
-	// Generate output schema from Taxonomy structure using reflection
-	taxonomyOutputSchema, err := jsonschema.ForType(reflect.TypeFor[Taxonomy](), &jsonschema.ForOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to reflect output schema from Taxonomy: %w", err)
+
+	// Load the thresholds above which arXiv queries, taxonomy fetches and S3 uploads are logged as slow
+	if slowConfig, err := metrics.LoadSlowOperationConfig(); err != nil {
+		slog.Warn("Slow operation configuration not available - using the default thresholds", "error", err)
+	} else {
+		metrics.ConfigureSlowOperations(slowConfig)
 	}
-	taxonomyHandler, err := NewArxivToolHandler(taxonomyInputSchema, taxonomyOutputSchema, fetchCategoryTaxonomy)
+
+	// Load the optional attestation signing key
+	globalSigner, err = LoadSigner()
 	if err != nil {
-		return fmt.Errorf("failed to create category taxonomy handler: %w", err)
+		slog.Warn("Attestation signing key could not be loaded - stored objects will not be attested", "error", err)
+		globalSigner = nil
 	}
-	slog.Info("category taxonomy handler created successfully")
 
-	server.AddTool(&mcp.Tool{
-		Name:         "arxiv_get_category_taxonomy",
-		Description:  "Fetch the complete arXiv category taxonomy. Returns a nested structure with broad areas (e.g., 'cs') mapping to specific categories (e.g., 'cs.AI') with their descriptions. Data is fetched fresh from https://arxiv.org/category_taxonomy",
-		InputSchema:  taxonomyInputSchema,
-		OutputSchema: taxonomyOutputSchema,
-	}, taxonomyHandler.Handle)
+	// Load the arXiv announcement calendar used by the announcedOn input
+	if cal, err := LoadCalendar(); err != nil {
+		slog.Warn("Announcement calendar configuration not available - assuming no holidays", "error", err)
+	} else {
+		announcementCalendar = cal
+	}
 
-	// ArXiv PDF download to S3 tool
-	if globalS3Config != nil {
-		downloadPDFInputSchema, err := jsonschema.ForType(reflect.TypeFor[ArxivDownloadPDFArgs](), &jsonschema.ForOptions{})
-		if err != nil {
-			return fmt.Errorf("failed to reflect input schema from ArxivDownloadPDFArgs: %w", err)
+	// Load the opt-in switch for the generic URL download tool
+	if genericDownloadConfig, err := LoadGenericDownloadConfig(); err != nil {
+		slog.Warn("Generic download configuration not available - the URL download tool will be disabled", "error", err)
+	} else {
+		genericDownloadEnabled = genericDownloadConfig.Enabled
+	}
+
+	// Load the arXiv rate limit, which the tool dependencies are created with
+	if rateConfig, err := LoadArxivRateConfig(); err != nil {
+		slog.Warn("arXiv rate limit configuration not available - using one request every 3 seconds", "error", err)
+	} else {
+		arxivRateConfig = *rateConfig
+		if rateConfig.Unsafe {
+			slog.Warn("🚨 arXiv rate limit may exceed the arXiv API terms of use", "interval", rateConfig.Interval, "burst", rateConfig.Burst)
 		}
-		downloadPDFOutputSchema, err := jsonschema.ForType(reflect.TypeFor[ArxivDownloadPDFOutput](), &jsonschema.ForOptions{})
-		if err != nil {
-			return fmt.Errorf("failed to reflect output schema from ArxivDownloadPDFOutput: %w", err)
+	}
+
+	// Load the retries of transient arXiv failures
+	if retryConfig, err := internal.LoadRetryConfig(); err != nil {
+		slog.Warn("HTTP retry configuration not available - arXiv requests are not retried", "error", err)
+	} else {
+		arxivMaxRetries = retryConfig.MaxRetries
+	}
+
+	// Load whether tool calls with undeclared arguments are rejected or have them dropped
+	if inputConfig, err := LoadInputConfig(); err != nil {
+		slog.Warn("Input validation configuration not available - rejecting undeclared arguments", "error", err)
+	} else {
+		strictInput = inputConfig.Strict
+	}
+
+	// Load the batch size for fetching articles by identifier
+	if idListConfig, err := LoadIDListConfig(); err != nil {
+		slog.Warn("id_list configuration not available - using defaults", "error", err)
+	} else {
+		idListBatchSize = idListConfig.BatchSize
+	}
+
+	// Load the external services resolving identifiers to arXiv articles, each with its own rate limit
+	if config, err := LoadIdentifierConfig(); err != nil {
+		slog.Warn("Identifier resolution configuration not available - only arXiv DOIs will be resolved", "error", err)
+	} else {
+		identifierConfig = *config
+		crossrefLimiter.SetLimit(rate.Every(config.CrossrefInterval.Duration()))
+		semanticScholarLimiter.SetLimit(rate.Every(config.SemanticScholarInterval.Duration()))
+	}
+
+	// Load how long clients may cache HTTP endpoint responses
+	if cacheConfig, err := LoadHTTPCacheConfig(); err != nil {
+		slog.Warn("HTTP cache configuration not available - using defaults", "error", err)
+	} else {
+		healthCacheMaxAge = cacheConfig.HealthMaxAge.Duration()
+	}
+
+	// Load the length cap of the instructions sent to clients
+	if instructionsConfig, err := LoadInstructionsConfig(); err != nil {
+		slog.Warn("Instructions configuration not available - using the default length cap", "error", err)
+	} else {
+		instructionsMaxLength = instructionsConfig.MaxLength
+	}
+
+	if outputConfig, err := LoadOutputConfig(); err != nil {
+		slog.Warn("Output configuration not available - using standard JSON encoding", "error", err)
+	} else {
+		canonicalJSONOutput = outputConfig.CanonicalJSON
+		responseSizeWarnBytes = int(outputConfig.ResponseSizeWarnBytes)
+		tokensPerByte = outputConfig.TokensPerByte
+	}
+
+	// Load the clients whose tool outputs default to a token budget
+	if config, err := LoadNegotiationConfig(); err != nil {
+		slog.Warn("Negotiation configuration not available - no client gets a default token budget", "error", err)
+	} else {
+		negotiationConfig = *config
+	}
+
+	// Load the daily ceiling on arXiv requests, whose count survives restarts when S3 storage is configured
+	if quotaConfig, err := LoadArxivQuotaConfig(); err != nil {
+		slog.Warn("arXiv quota configuration not available - arXiv requests will not be capped", "error", err)
+	} else {
+		var store library.Store
+		if globalS3Config != nil && quotaConfig.DailyLimit > 0 {
+			store = library.NewS3ObjectStore(globalS3Config, S3_ARTICLES_BUCKET, arxivQuotaObjectName)
 		}
-		downloadPDFHandler, err := NewArxivToolHandler(downloadPDFInputSchema, downloadPDFOutputSchema, downloadPDFToS3)
-		if err != nil {
-			return fmt.Errorf("failed to create arXiv PDF download handler: %w", err)
+		arxivQuota = newDailyQuota(quotaConfig.DailyLimit, store, correctedNow)
+		if err := arxivQuota.restore(context.Background()); err != nil {
+			slog.Warn("Failed to restore the arXiv request count - counting from zero", "error", err)
 		}
-		slog.Info("arXiv PDF download handler created successfully")
-
-		server.AddTool(&mcp.Tool{
-			Name:         "arxiv_download_pdf",
-			Description:  "Download an arXiv PDF from a URL and upload it to a S3 bucket, e.g., over MinIO. Requires S3 credentials. The PDF will be stored in the 'arxiv/' prefix within the '" + metadata.S3_ARTICLES_BUCKET + "' bucket.",
-			InputSchema:  downloadPDFInputSchema,
-			OutputSchema: downloadPDFOutputSchema,
-		}, downloadPDFHandler.Handle)
+	}
+
+	// Load the configuration of the summaries generated for downloaded articles
+	if config, err := LoadSummaryConfig(); err != nil {
+		slog.Warn("Summary configuration not available - using defaults", "error", err)
+	} else {
+		summaryConfig = *config
+	}
+
+	// Load the configuration of library exports
+	if config, err := LoadExportConfig(); err != nil {
+		slog.Warn("Export configuration not available - using defaults", "error", err)
+	} else {
+		exportConfig = *config
+	}
+
+	// Load admission control configuration for rate-limited tools
+	if admissionConfig, err := LoadAdmissionConfig(); err != nil {
+		slog.Warn("Admission configuration not available - using defaults", "error", err)
 	} else {
-		slog.Info("Skipping arXiv PDF download tool addition - S3 configuration not available")
+		arxivAdmission.maxWait = admissionConfig.MaxEstimatedWait.Duration()
 	}
 
-	return nil
+	// Load the token enabling the admin endpoint and tool
+	if adminConfig, err := LoadAdminConfig(); err != nil {
+		slog.Warn("Admin configuration not available - the admin endpoint and tool will be disabled", "error", err)
+	} else {
+		adminToken = adminConfig.Token
+	}
 }
 
-func runServer(transport_flag string, server_host string, server_port int, enableRequestResponseLogging bool) {
-	// Load S3 configuration from environment variables at startup
-	var err error
-	globalS3Config, err = LoadS3Config()
+// newHTTPHandler builds the handler chain serving the MCP server and the HTTP endpoints, shared by
+// the TCP and unix socket listeners
+func newHTTPHandler(server *mcp.Server, enableRequestResponseLogging bool) http.Handler {
+	// Sessions are stateless unless configured otherwise, so that any request can be served on its own
+	stateful := false
+	if sessionConfig, err := LoadSessionConfig(); err != nil {
+		slog.Warn("Session configuration not available - using stateless HTTP sessions", "error", err)
+	} else {
+		stateful = sessionConfig.Stateful
+	}
+	mcpHandler := mcp.NewStreamableHTTPHandler(func(r *http.Request) *mcp.Server {
+		return server
+	}, &mcp.StreamableHTTPOptions{JSONResponse: true, Stateless: !stateful})
+	var handler http.Handler = newHTTPMux(httpRoutes(mcpHandler))
+	if enableRequestResponseLogging {
+		handler = createAccessLogMiddleware(handler)
+	}
+	// Identify clients first, so that the access log, the MCP middleware and the tool handlers see them
+	var identityConfig ClientIdentityConfig
+	if config, err := LoadClientIdentityConfig(); err != nil {
+		slog.Warn("Client identity configuration not available - trusting no proxies", "error", err)
+	} else {
+		identityConfig = *config
+	}
+	identifier, err := newClientIdentifier(&identityConfig)
 	if err != nil {
-		slog.Warn("S3 configuration not available - S3-dependent tools will be disabled", "error", err)
-		slog.Warn("To enable S3 features, set: OPUS_MCP_S3_ENDPOINT, OPUS_MCP_S3_ACCESS_KEY, OPUS_MCP_S3_SECRET_KEY")
-		globalS3Config = nil
+		slog.Error("Invalid client identity configuration", "error", err)
+		os.Exit(1)
+	}
+	return createCORSMiddleware(identifier.middleware(adminMiddleware(handler)))
+}
+
+func runServer(transport_flag string, server_host string, server_port int, socket_path string, socket_mode os.FileMode, enableRequestResponseLogging bool) {
+	// Report every configuration problem at once, rather than one warning per setting as it loads
+	if err := checkConfiguration(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		slog.Warn("Starting with configuration problems - the settings affected fall back to their defaults or disable their features")
+	}
+	loadConfiguration()
+
+	// Monitor storage capacity so that downloads are refused up front when storage is nearly full
+	if globalS3Config != nil {
+		if capacityConfig, err := LoadStorageCapacityConfig(); err != nil {
+			slog.Warn("Storage capacity configuration not available - downloads will not check free space", "error", err)
+		} else {
+			storageCapacity = startCapacityMonitor(context.Background(), capacityConfig)
+		}
+		// Probe demoted endpoints of replicated storage, to fail back once they recover
+		storage.StartEndpointProbes(context.Background(), globalS3Config)
+	}
+
+	// Check the server clock against the responses of startup, and then periodically
+	startClockCheck(context.Background(), clockCheckInterval)
+
+	// Run asynchronous downloads in the background, draining them on shutdown
+	if globalS3Config != nil {
+		if jobConfig, err := LoadDownloadJobConfig(); err != nil {
+			slog.Warn("Download job configuration not available - background downloads will be disabled", "error", err)
+		} else {
+			downloadJobs = startJobQueue(context.Background(), jobConfig, library.NewS3ObjectStore(globalS3Config, S3_ARTICLES_BUCKET, downloadJobsObjectName))
+			defer stopDownloadJobs(jobConfig.DrainTimeout.Duration())
+		}
 	}
 
 	ctx := context.Background()
@@ -271,6 +459,8 @@ func runServer(transport_flag string, server_host string, server_port int, enabl
 		&mcp.ServerOptions{
 			// Disable logging capability to prevent setLevel errors during initialization
 			Capabilities: &mcp.ServerCapabilities{},
+			// Tool outputs are adjusted to each client from what it declares during initialization
+			InitializedHandler: logOutputProfile,
 		},
 	)
 	if enableRequestResponseLogging {
@@ -279,42 +469,52 @@ func runServer(transport_flag string, server_host string, server_port int, enabl
 		server.AddReceivingMiddleware(createMCPLoggingMiddleware())
 	}
 
+	// Report structured errors of requests other than tool calls as JSON-RPC error data
+	server.AddReceivingMiddleware(toolErrorMiddleware())
+
 	// Add MCP tools
-	if err := addMCPTools(server); err != nil {
+	if err := addMCPTools(server, defaultToolDeps()); err != nil {
+		// A server without tools looks healthy but is useless, so refuse to start
 		slog.Error("failed to add MCP tools", "error", err)
-		// Should we panic here?
-	}
-	slog.Info("MCP tools added successfully")
-
-	if transport_flag == "http" {
-		// Start HTTP server -- should the server have a stateless or stateful option for logging per MCP client ID, at least?
-		mcpHandler := mcp.NewStreamableHTTPHandler(func(r *http.Request) *mcp.Server {
-			return server
-		}, &mcp.StreamableHTTPOptions{JSONResponse: true, Stateless: true})
-		mux := http.NewServeMux()
-		mux.Handle("/mcp", mcpHandler)
-		mux.HandleFunc("/health", healthCheckHandler)
-		mux.Handle("/healthz", http.RedirectHandler("/health", http.StatusMovedPermanently))
-		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Connection", "close")
-			if _, err := io.WriteString(w, "Use /mcp to access the MCP server. Use /health or /healthz for health checks."); err != nil {
-				slog.Warn("failed to write response", "error", err)
-			}
-		})
-		handlerWithCORSMiddleware := createCORSMiddleware(mux)
+		os.Exit(1)
+	}
+	if degraded := toolRegistrationStatus().Degraded; len(degraded) > 0 {
+		slog.Warn("MCP tools added with some tools degraded", "degraded", degraded)
+	} else {
+		slog.Info("MCP tools added successfully")
+	}
+
+	// Tell clients how the registered tools are meant to be used, rendered with the live configuration
+	if instructions, err := renderInstructions(toolRegistrationStatus().Registered, instructionsMaxLength); err != nil {
+		slog.Warn("Failed to render instructions - clients will not receive any", "error", err)
+	} else {
+		server.AddReceivingMiddleware(instructionsMiddleware(instructions))
+	}
+
+	if transport_flag == "http" || transport_flag == "unix" {
+		handler := newHTTPHandler(server, enableRequestResponseLogging)
+		var listener net.Listener
+		var address string
+		var err error
+		if transport_flag == "unix" {
+			listener, err = listenUnix(socket_path, socket_mode)
+			address = "unix://" + socket_path
+		} else {
+			listener, err = net.Listen("tcp", server_host+":"+fmt.Sprint(server_port))
+			address = "http://" + server_host + ":" + fmt.Sprint(server_port)
+		}
+		if err != nil {
+			slog.Error("Server failed to start", "error", err)
+			panic(err)
+		}
+		// Also removes the socket file of the unix transport, however the server stops
+		defer listener.Close()
 		serverProcessStartTime = time.Now()
-		// ASCII art: https://patorjk.com/software/taag/#p=display&f=Pagga&t=OPUS+MCP
-		fmt.Println(`
-░█▀█░█▀█░█░█░█▀▀░░░█▄█░█▀▀░█▀█
-░█░█░█▀▀░█░█░▀▀█░░░█░█░█░░░█▀▀
-░▀▀▀░▀░░░▀▀▀░▀▀▀░░░▀░▀░▀▀▀░▀░░
-		`)
-		slog.Info("Build Version: " + metadata.BuildVersion + " | Build Time: " + metadata.BuildTime + " | OS: " + runtime.GOOS + " | CPU Architecture: " + runtime.GOARCH)
-		slog.Info("Starting HTTP server on http://" + server_host + ":" + fmt.Sprint(server_port) + ", press Ctrl+C to stop")
+		announceStartup(consoleOutput(transport_flag), startupBanner(), transport_flag, address)
+		slog.Info("Press Ctrl+C to stop")
 
 		httpServer := &http.Server{
-			Addr:         server_host + ":" + fmt.Sprint(server_port),
-			Handler:      handlerWithCORSMiddleware,
+			Handler:      handler,
 			ReadTimeout:  15 * time.Second,
 			WriteTimeout: 15 * time.Second,
 			IdleTimeout:  60 * time.Second,
@@ -329,7 +529,7 @@ func runServer(transport_flag string, server_host string, server_port int, enabl
 
 		// Start server in a goroutine
 		go func() {
-			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
 				serverErrors <- err
 			}
 		}()
@@ -354,18 +554,24 @@ func runServer(transport_flag string, server_host string, server_port int, enabl
 			slog.Info("Server stopped gracefully")
 		}
 	} else {
-		if err := server.Run(ctx, &mcp.StdioTransport{}); err != nil {
+		// There is only one session over stdio, so its recent queries can be tracked without a session ID
+		recentQueries.trackAnonymous = true
+		announceStartup(consoleOutput("stdio"), startupBanner(), "stdio", "")
+		noticeInteractiveStdio(os.Stderr, os.Stdout)
+		protocol, restore := reserveStdout()
+		defer restore()
+		if err := serveStdio(ctx, server, os.Stdin, protocol); err != nil {
 			panic(err)
 		}
 	}
 }
 
-func Serve(transport_flag string, server_host string, server_port int, enableRequestResponseLogging bool) {
+func Serve(transport_flag string, server_host string, server_port int, socket_path string, socket_mode os.FileMode, enableRequestResponseLogging bool) {
 	// Deferred function to recover from a panic
 	defer func() {
 		if r := recover(); r != nil {
 			slog.Error("server crashed,", "error", r)
 		}
 	}()
-	runServer(transport_flag, server_host, server_port, enableRequestResponseLogging)
+	runServer(transport_flag, server_host, server_port, socket_path, socket_mode, enableRequestResponseLogging)
 }
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"opus-mcp/internal/settings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	// recentQueriesPerSession bounds the number of queries remembered for each session
+	recentQueriesPerSession = 16
+	// recentQuerySessions bounds the number of sessions whose queries are remembered
+	recentQuerySessions = 256
+)
+
+// SessionConfig holds the HTTP session configuration loaded from environment variables
+type SessionConfig struct {
+	// Stateful makes the HTTP transport keep MCP sessions across requests, which enables
+	// session-scoped features such as tracking the queries that led to a download
+	Stateful bool `env:"OPUS_MCP_HTTP_STATEFUL,default=false"`
+}
+
+// LoadSessionConfig loads the HTTP session configuration from environment variables
+func LoadSessionConfig() (*SessionConfig, error) {
+	var config SessionConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process session configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// callInfo identifies the tool call being handled and the session it belongs to
+type callInfo struct {
+	Tool      string
+	SessionID string
+	Client    string
+	// ClientID is the identity of the HTTP client: a bearer token fingerprint or an address
+	ClientID string
+	// Admin is set when the client may use the admin tool
+	Admin bool
+	// tracked is set when the session's recent queries are being tracked
+	tracked bool
+	// session is the MCP session of the call, which the server can send requests to, if any
+	session *mcp.ServerSession
+}
+
+type callInfoKey struct{}
+
+// withCallInfo returns a context carrying information about the current tool call
+func withCallInfo(ctx context.Context, info callInfo) context.Context {
+	return context.WithValue(ctx, callInfoKey{}, info)
+}
+
+// callInfoFrom returns information about the current tool call, if any
+func callInfoFrom(ctx context.Context) (callInfo, bool) {
+	info, ok := ctx.Value(callInfoKey{}).(callInfo)
+	return info, ok
+}
+
+// newCallInfo extracts the session and client identity from a tool call request
+func newCallInfo(req *mcp.CallToolRequest) callInfo {
+	info := callInfo{Tool: req.Params.Name, ClientID: clientIdentityOf(req), Admin: isAdminCall(req)}
+	if req.Session == nil {
+		return info
+	}
+	info.session = req.Session
+	info.SessionID = req.Session.ID()
+	if params := req.Session.InitializeParams(); params != nil && params.ClientInfo != nil {
+		info.Client = params.ClientInfo.Name
+		if params.ClientInfo.Version != "" {
+			info.Client += "/" + params.ClientInfo.Version
+		}
+	}
+	// Sessions without an ID can only be told apart when there is a single one, i.e., over stdio
+	info.tracked = info.SessionID != "" || recentQueries.trackAnonymous
+	return info
+}
+
+// recentQuery is a query made by a tool call, with the identifiers of the articles it returned
+type recentQuery struct {
+	Tool       string
+	Query      string
+	IDList     []string
+	ArticleIDs []string
+	Time       time.Time
+}
+
+// queryRing is a bounded buffer of the most recent queries of a session, oldest first
+type queryRing struct {
+	queries  []recentQuery
+	lastUsed time.Time
+}
+
+// recentQueryTracker remembers the recent queries of each session so that later tool calls in the
+// same session, such as downloads, can tell which query led to them
+type recentQueryTracker struct {
+	mu          sync.Mutex
+	perSession  int
+	maxSessions int
+	sessions    map[string]*queryRing
+	// trackAnonymous enables tracking for sessions without an ID, which is only safe over stdio
+	trackAnonymous bool
+}
+
+func newRecentQueryTracker(perSession, maxSessions int) *recentQueryTracker {
+	return &recentQueryTracker{
+		perSession:  perSession,
+		maxSessions: maxSessions,
+		sessions:    make(map[string]*queryRing),
+	}
+}
+
+// recentQueries is the tracker shared by all tool handlers
+var recentQueries = newRecentQueryTracker(recentQueriesPerSession, recentQuerySessions)
+
+// record remembers a query for the given session, evicting the oldest query of the session and
+// the least recently used session when the bounds are exceeded
+func (t *recentQueryTracker) record(sessionID string, query recentQuery) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ring, ok := t.sessions[sessionID]
+	if !ok {
+		if len(t.sessions) >= t.maxSessions {
+			t.evictLeastRecentlyUsed()
+		}
+		ring = &queryRing{}
+		t.sessions[sessionID] = ring
+	}
+	ring.lastUsed = query.Time
+	ring.queries = append(ring.queries, query)
+	if len(ring.queries) > t.perSession {
+		ring.queries = ring.queries[len(ring.queries)-t.perSession:]
+	}
+}
+
+func (t *recentQueryTracker) evictLeastRecentlyUsed() {
+	var oldestID string
+	var oldest time.Time
+	first := true
+	for id, ring := range t.sessions {
+		if first || ring.lastUsed.Before(oldest) {
+			oldestID, oldest, first = id, ring.lastUsed, false
+		}
+	}
+	delete(t.sessions, oldestID)
+}
+
+// findArticle returns the most recent query of the session whose results contained the article
+func (t *recentQueryTracker) findArticle(sessionID, articleID string) (recentQuery, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ring, ok := t.sessions[sessionID]
+	if !ok {
+		return recentQuery{}, false
+	}
+	for i := len(ring.queries) - 1; i >= 0; i-- {
+		if slices.Contains(ring.queries[i].ArticleIDs, articleID) {
+			return ring.queries[i], true
+		}
+	}
+	return recentQuery{}, false
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"opus-mcp/internal/attestation"
+	"opus-mcp/internal/settings"
+	"opus-mcp/internal/storage"
+)
+
+// SigningConfig holds the attestation signing configuration loaded from environment variables
+type SigningConfig struct {
+	// KeyFile is the path to a PEM encoded PKCS #8 Ed25519 private key. Signing is disabled when empty.
+	KeyFile string `env:"OPUS_MCP_SIGNING_KEY_FILE"`
+}
+
+// globalSigner signs attestations for stored objects; nil when no signing key is configured
+var globalSigner *attestation.Signer
+
+// LoadSigner loads the attestation signing key configured in the environment.
+// It returns nil without an error when no signing key is configured.
+func LoadSigner() (*attestation.Signer, error) {
+	var config SigningConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process signing configuration from environment", "error", err)
+		return nil, err
+	}
+	if config.KeyFile == "" {
+		return nil, nil
+	}
+	privateKey, err := attestation.LoadSigningKey(config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	signer := attestation.NewSigner(privateKey)
+	slog.Info("Attestation signing key loaded", "key_file", config.KeyFile, "key_id", signer.KeyID())
+	return signer, nil
+}
+
+// attestUpload signs a claim about an uploaded object, returning nil if signing is disabled or fails.
+// A signing failure is logged rather than failing the upload, which has already succeeded.
+func attestUpload(signer *attestation.Signer, upload storage.UploadResult, sourceURL string, storedAt time.Time) *attestation.Attestation {
+	if signer == nil {
+		return nil
+	}
+	signed, err := signer.Sign(attestation.Claim{
+		Bucket:     upload.Bucket,
+		ObjectName: upload.Key,
+		SHA256:     upload.SHA256,
+		Size:       upload.Size,
+		SourceURL:  sourceURL,
+		Timestamp:  storedAt.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		slog.Error("Failed to sign attestation for stored object", "bucket", upload.Bucket, "object", upload.Key, "error", err)
+		return nil
+	}
+	return signed
+}
+
+// VerifyAttestationArgs defines the input parameters for verifying an attestation
+type VerifyAttestationArgs struct {
+	Attestation attestation.Attestation `json:"attestation" jsonschema:"The attestation exactly as returned by the download tool"`
+}
+
+// VerifyAttestationOutput defines the output structure for attestation verification
+type VerifyAttestationOutput struct {
+	Valid          bool     `json:"valid" jsonschema:"Whether the signature is valid and the stored object still matches the claim"`
+	SignatureValid bool     `json:"signatureValid" jsonschema:"Whether the attestation was signed by this server's key and the claim is unaltered"`
+	ObjectMatches  bool     `json:"objectMatches" jsonschema:"Whether the object currently stored in the bucket has the claimed digest and size"`
+	KeyID          string   `json:"keyId" jsonschema:"Identifier of this server's signing key"`
+	Problems       []string `json:"problems,omitempty" jsonschema:"Reasons the attestation did not verify, if any"`
+}
+
+// objectHasher returns the SHA-256 digest and size of a stored object; replaced in tests
+var objectHasher = func(ctx context.Context, bucket, objectName string) (string, int64, error) {
+	if globalS3Config == nil {
+		return "", 0, fmt.Errorf("S3 configuration not loaded")
+	}
+	return storage.HashObject(ctx, globalS3Config, bucket, objectName)
+}
+
+// verifyAttestation checks an attestation against the server's public key and the current object state
+func verifyAttestation(ctx context.Context, input json.RawMessage) (any, error) {
+	var args VerifyAttestationArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+	if globalSigner == nil {
+		return nil, fmt.Errorf("attestation signing is not configured. Please set the OPUS_MCP_SIGNING_KEY_FILE environment variable")
+	}
+
+	output := VerifyAttestationOutput{KeyID: globalSigner.KeyID()}
+	if err := attestation.Verify(globalSigner.PublicKey(), &args.Attestation); err != nil {
+		output.Problems = append(output.Problems, err.Error())
+		return output, nil
+	}
+	output.SignatureValid = true
+
+	// Only objects this server stores are worth hashing; a signed claim for
+	// another bucket cannot have come from attestUpload.
+	claim := args.Attestation.Claim
+	if claim.Bucket != S3_ARTICLES_BUCKET {
+		output.Problems = append(output.Problems, fmt.Sprintf("claimed bucket '%s' is not the articles bucket", claim.Bucket))
+		return output, nil
+	}
+
+	digest, size, err := objectHasher(ctx, claim.Bucket, claim.ObjectName)
+	switch {
+	case err != nil:
+		output.Problems = append(output.Problems, fmt.Sprintf("failed to read stored object: %v", err))
+	case digest != claim.SHA256:
+		output.Problems = append(output.Problems, "stored object digest does not match the claimed digest")
+	case size != claim.Size:
+		output.Problems = append(output.Problems, "stored object size does not match the claimed size")
+	default:
+		output.ObjectMatches = true
+	}
+
+	output.Valid = output.SignatureValid && output.ObjectMatches
+	return output, nil
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/attestation"
+	"opus-mcp/internal/storage"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestVerifyAttestationTool(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	signer := attestation.NewSigner(privateKey)
+
+	upload := storage.UploadResult{
+		UploadInfo: minio.UploadInfo{Bucket: S3_ARTICLES_BUCKET, Key: "arxiv/2405.12345.pdf", Size: 42},
+		SHA256:     "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+	}
+	signed := attestUpload(signer, upload, "https://arxiv.org/pdf/2405.12345", time.Date(2026, 1, 7, 10, 0, 0, 0, time.UTC))
+	if signed == nil {
+		t.Fatal("attestUpload() returned nil with a signer configured")
+	}
+	if signed.Claim.Timestamp != "2026-01-07T10:00:00Z" {
+		t.Errorf("claim timestamp = %q, want RFC 3339 UTC", signed.Claim.Timestamp)
+	}
+	if attestUpload(nil, upload, "https://arxiv.org/pdf/2405.12345", time.Now()) != nil {
+		t.Error("attestUpload() without a signer should return nil")
+	}
+
+	originalSigner, originalHasher := globalSigner, objectHasher
+	t.Cleanup(func() {
+		globalSigner, objectHasher = originalSigner, originalHasher
+	})
+	globalSigner = signer
+
+	tests := []struct {
+		name               string
+		tamper             func(a *attestation.Attestation)
+		storedDigest       string
+		storedSize         int64
+		storedErr          error
+		wantSignatureValid bool
+		wantObjectMatches  bool
+		wantHashed         bool
+	}{
+		{"Untampered and unchanged", func(a *attestation.Attestation) {}, upload.SHA256, 42, nil, true, true, true},
+		{"Object replaced in bucket", func(a *attestation.Attestation) {}, "0000", 42, nil, true, false, true},
+		{"Object truncated in bucket", func(a *attestation.Attestation) {}, upload.SHA256, 41, nil, true, false, true},
+		{"Object missing from bucket", func(a *attestation.Attestation) {}, "", 0, errors.New("not found"), true, false, true},
+		{"Claim tampered to match a replaced object", func(a *attestation.Attestation) { a.Claim.SHA256 = "0000" }, "0000", 42, nil, false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hashed := false
+			objectHasher = func(ctx context.Context, bucket, objectName string) (string, int64, error) {
+				hashed = true
+				return tt.storedDigest, tt.storedSize, tt.storedErr
+			}
+			candidate := *signed
+			tt.tamper(&candidate)
+			input, err := json.Marshal(VerifyAttestationArgs{Attestation: candidate})
+			if err != nil {
+				t.Fatalf("failed to marshal input: %v", err)
+			}
+
+			result, err := verifyAttestation(context.Background(), input)
+			if err != nil {
+				t.Fatalf("verifyAttestation() unexpected error: %v", err)
+			}
+			output := result.(VerifyAttestationOutput)
+			if output.SignatureValid != tt.wantSignatureValid {
+				t.Errorf("SignatureValid = %v, want %v (problems: %v)", output.SignatureValid, tt.wantSignatureValid, output.Problems)
+			}
+			if output.ObjectMatches != tt.wantObjectMatches {
+				t.Errorf("ObjectMatches = %v, want %v (problems: %v)", output.ObjectMatches, tt.wantObjectMatches, output.Problems)
+			}
+			if hashed != tt.wantHashed {
+				t.Errorf("stored object hashed = %v, want %v", hashed, tt.wantHashed)
+			}
+			for _, problem := range output.Problems {
+				if tt.storedDigest != "" && tt.storedDigest != upload.SHA256 && strings.Contains(problem, tt.storedDigest) {
+					t.Errorf("problem %q reveals the stored digest", problem)
+				}
+			}
+			wantValid := tt.wantSignatureValid && tt.wantObjectMatches
+			if output.Valid != wantValid {
+				t.Errorf("Valid = %v, want %v", output.Valid, wantValid)
+			}
+			if !wantValid && len(output.Problems) == 0 {
+				t.Error("an invalid attestation should report at least one problem")
+			}
+		})
+	}
+
+	t.Run("Signed claim for another bucket", func(t *testing.T) {
+		objectHasher = func(ctx context.Context, bucket, objectName string) (string, int64, error) {
+			t.Errorf("objectHasher called for bucket %q", bucket)
+			return upload.SHA256, 42, nil
+		}
+		foreign := upload
+		foreign.Bucket = "private"
+		input, err := json.Marshal(VerifyAttestationArgs{Attestation: *attestUpload(signer, foreign, "https://arxiv.org/pdf/2405.12345", time.Now())})
+		if err != nil {
+			t.Fatalf("failed to marshal input: %v", err)
+		}
+		result, err := verifyAttestation(context.Background(), input)
+		if err != nil {
+			t.Fatalf("verifyAttestation() unexpected error: %v", err)
+		}
+		output := result.(VerifyAttestationOutput)
+		if !output.SignatureValid || output.ObjectMatches || output.Valid {
+			t.Errorf("output = %+v, want a valid signature but no object match", output)
+		}
+	})
+}
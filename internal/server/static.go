@@ -0,0 +1,35 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"opus-mcp/internal/taxonomy"
+)
+
+// staticMaxAge is how long clients may cache the static data, which only changes with the server
+// binary or its configuration; the ETag lets them revalidate cheaply after that
+const staticMaxAge = 24 * time.Hour
+
+// snapshotDateHeader names the date the embedded data was taken from its upstream source
+const snapshotDateHeader = "X-Snapshot-Date"
+
+// staticTaxonomyHandler serves the embedded taxonomy snapshot as it is compiled into the binary,
+// without any request to arXiv
+func staticTaxonomyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(snapshotDateHeader, taxonomy.Embedded().SnapshotDate)
+	writeCacheable(w, r, taxonomy.SnapshotJSON(), "application/json", staticMaxAge)
+}
+
+// staticExamplesHandler serves the examples of the registered tools like /examples.json, with an
+// ETag and a Cache-Control max-age so that offline clients can keep a copy
+func staticExamplesHandler(w http.ResponseWriter, r *http.Request) {
+	jsonData, err := toolExamplesJSON()
+	if err != nil {
+		slog.Error("tool examples could not be rendered", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeCacheable(w, r, jsonData, "application/json", staticMaxAge)
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"opus-mcp/internal/taxonomy"
+)
+
+func TestStaticRoutes(t *testing.T) {
+	registerAllTools(t)
+	mux := newHTTPMux(httpRoutes(http.NotFoundHandler()))
+	examples, err := toolExamplesJSON()
+	if err != nil {
+		t.Fatalf("toolExamplesJSON() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		path         string
+		want         []byte
+		snapshotDate string
+	}{
+		{"/static/taxonomy.json", taxonomy.SnapshotJSON(), taxonomy.Embedded().SnapshotDate},
+		{"/static/examples.json", examples, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), tt.want) {
+				t.Fatalf("GET %s = %d, want 200 with the embedded data", tt.path, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != "max-age=86400" {
+				t.Errorf("Cache-Control = %q, want max-age=86400", got)
+			}
+			if got := rec.Header().Get(snapshotDateHeader); got != tt.snapshotDate {
+				t.Errorf("%s = %q, want %q", snapshotDateHeader, got, tt.snapshotDate)
+			}
+
+			// A client holding the current copy revalidates it without a body
+			etag := rec.Header().Get("ETag")
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("If-None-Match", etag)
+			rec = httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if etag == "" || rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+				t.Errorf("GET %s with If-None-Match %q = %d with %d bytes, want 304 without a body", tt.path, etag, rec.Code, rec.Body.Len())
+			}
+		})
+	}
+}
+
+func TestCategoryTaxonomyForcedEmbedded(t *testing.T) {
+	taxonomyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected taxonomy request %s for the embedded snapshot", r.URL)
+	}))
+	defer taxonomyServer.Close()
+	original := categoryTaxonomyURL
+	t.Cleanup(func() { categoryTaxonomyURL = original })
+	categoryTaxonomyURL = taxonomyServer.URL
+
+	output, err := fetchCategoryTaxonomy(context.Background(), json.RawMessage(`{"source": "embedded"}`))
+	if err != nil {
+		t.Fatalf("fetchCategoryTaxonomy() unexpected error: %v", err)
+	}
+	result := output.(Taxonomy)
+	snapshot := taxonomy.Embedded()
+	if result.Provenance == nil || result.Provenance.Source != taxonomy.SourceEmbedded || result.Provenance.SnapshotDate != snapshot.SnapshotDate {
+		t.Errorf("provenance = %+v, want the embedded snapshot of %s", result.Provenance, snapshot.SnapshotDate)
+	}
+	if len(result.Groups) != len(snapshot.Groups) || len(result.Categories) != len(snapshot.Categories) {
+		t.Errorf("taxonomy has %d groups and %d categories, want the snapshot's %d and %d", len(result.Groups), len(result.Categories), len(snapshot.Groups), len(snapshot.Categories))
+	}
+	if group := result.Groups["cs"]; group.Name != "Computer Science" || group.Classification != "Computer Science" {
+		t.Errorf("group cs = %+v, want Computer Science", group)
+	}
+	if category := result.Categories["cs.AI"]; category.Name != "Artificial Intelligence" {
+		t.Errorf("category cs.AI = %+v, want Artificial Intelligence", category)
+	}
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"opus-mcp/internal/metrics"
+)
+
+// statsEWMAWeight is the weight given to the latest sample in the moving average of call durations
+const statsEWMAWeight = 0.2
+
+// responseSizeSamples is the number of recent response sizes per tool the percentiles are taken from
+const responseSizeSamples = 256
+
+// allTools is the name under which the statistics of the responses of all tools are kept
+const allTools = "*"
+
+// responseSizeWarnBytes is the response size above which a tool call is logged as a warning; 0
+// disables the warning
+var responseSizeWarnBytes = 1 << 20
+
+// ToolStats is a snapshot of the call statistics of a single tool
+type ToolStats struct {
+	Calls           int64         `json:"calls"`
+	Errors          int64         `json:"errors"`
+	AverageDuration time.Duration `json:"averageDuration"`
+}
+
+// toolStatsRegistry keeps in-process call statistics per tool, complementing the exported
+// metrics with values the server itself can act on (e.g., admission control)
+type toolStatsRegistry struct {
+	mu    sync.Mutex
+	tools map[string]*ToolStats
+	// sizes holds the most recent response sizes by tool, and of all tools under allTools
+	sizes map[string]*sizeRing
+}
+
+func newToolStatsRegistry() *toolStatsRegistry {
+	return &toolStatsRegistry{tools: make(map[string]*ToolStats), sizes: make(map[string]*sizeRing)}
+}
+
+// toolStats is the registry shared by all tool handlers
+var toolStats = newToolStatsRegistry()
+
+// record adds a completed call to the statistics of the given tool and to the exported metrics
+func (r *toolStatsRegistry) record(tool string, duration time.Duration, outcome string) {
+	metrics.ToolCallsTotal.WithLabelValues(tool, outcome).Inc()
+	metrics.ToolCallDuration.WithLabelValues(tool).Observe(duration.Seconds())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.tools[tool]
+	if !ok {
+		s = &ToolStats{}
+		r.tools[tool] = s
+	}
+	s.Calls++
+	if outcome != "ok" {
+		s.Errors++
+	}
+	if s.AverageDuration == 0 {
+		s.AverageDuration = duration
+	} else {
+		s.AverageDuration = time.Duration(statsEWMAWeight*float64(duration) + (1-statsEWMAWeight)*float64(s.AverageDuration))
+	}
+}
+
+// averageDuration returns the moving average call duration of the given tool, or 0 if it was never called
+func (r *toolStatsRegistry) averageDuration(tool string) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.tools[tool]; ok {
+		return s.AverageDuration
+	}
+	return 0
+}
+
+// snapshot returns a copy of the statistics of all tools
+func (r *toolStatsRegistry) snapshot() map[string]ToolStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]ToolStats, len(r.tools))
+	for name, s := range r.tools {
+		out[name] = *s
+	}
+	return out
+}
+
+// sizeRing keeps the most recent response sizes
+type sizeRing struct {
+	samples []int
+	next    int
+}
+
+func (r *sizeRing) add(size int) {
+	if len(r.samples) < responseSizeSamples {
+		r.samples = append(r.samples, size)
+		return
+	}
+	r.samples[r.next] = size
+	r.next = (r.next + 1) % responseSizeSamples
+}
+
+// percentile returns the nearest-rank percentile p, between 0 and 100, of the kept sizes
+func (r *sizeRing) percentile(p float64) int {
+	sorted := slices.Clone(r.samples)
+	slices.Sort(sorted)
+	rank := int(p/100*float64(len(sorted))+0.999999) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
+
+// ResponseSizes summarises the sizes of the recent responses of a tool
+type ResponseSizes struct {
+	// Samples is the number of recent responses the sizes are taken from, at most responseSizeSamples
+	Samples  int `json:"samples"`
+	P50Bytes int `json:"p50Bytes"`
+	P95Bytes int `json:"p95Bytes"`
+	MaxBytes int `json:"maxBytes"`
+}
+
+// recordResponseSize adds the size of a serialized tool response to the statistics of the tool and
+// of all tools and to the exported metrics, warning about responses larger than responseSizeWarnBytes
+func (r *toolStatsRegistry) recordResponseSize(tool string, size int) {
+	metrics.ToolResponseBytes.WithLabelValues(tool).Observe(float64(size))
+	if responseSizeWarnBytes > 0 && size > responseSizeWarnBytes {
+		slog.Warn("Tool response exceeds the size warning threshold", "tool", tool, "bytes", size, "threshold_bytes", responseSizeWarnBytes)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range []string{tool, allTools} {
+		ring, ok := r.sizes[name]
+		if !ok {
+			ring = &sizeRing{}
+			r.sizes[name] = ring
+		}
+		ring.add(size)
+	}
+}
+
+// responseSizes returns the response size statistics of every tool that responded, and of all
+// tools together under "*"
+func (r *toolStatsRegistry) responseSizes() map[string]ResponseSizes {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]ResponseSizes, len(r.sizes))
+	for name, ring := range r.sizes {
+		out[name] = ResponseSizes{
+			Samples:  len(ring.samples),
+			P50Bytes: ring.percentile(50),
+			P95Bytes: ring.percentile(95),
+			MaxBytes: ring.percentile(100),
+		}
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"opus-mcp/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestToolCallsRecordResponseSizes(t *testing.T) {
+	originalStats, originalThreshold := toolStats, responseSizeWarnBytes
+	t.Cleanup(func() {
+		toolStats, responseSizeWarnBytes = originalStats, originalThreshold
+	})
+	toolStats = newToolStatsRegistry()
+	responseSizeWarnBytes = 5000
+	var logs bytes.Buffer
+	originalLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(originalLogger) })
+
+	// Outputs of known size: {"data":"..."} adds 11 bytes to the payload
+	var payload int
+	handler := newTestToolHandler(t, func(ctx context.Context, input json.RawMessage) (any, error) {
+		return map[string]string{"data": strings.Repeat("x", payload)}, nil
+	})
+	const toolName = "test_response_sizes"
+	observedBefore := testutil.CollectAndCount(metrics.ToolResponseBytes)
+	for _, size := range []int{989, 1989, 2989, 3989, 9989} {
+		payload = size
+		if result, _ := handler.Handle(context.Background(), newTestCallToolRequest(toolName, `{}`)); result.IsError {
+			t.Fatalf("Handle() returned an error result: %+v", result.Content)
+		}
+	}
+	other := newTestToolHandler(t, func(ctx context.Context, input json.RawMessage) (any, error) {
+		return map[string]string{}, nil
+	})
+	if result, _ := other.Handle(context.Background(), newTestCallToolRequest("test_other_sizes", `{}`)); result.IsError {
+		t.Fatalf("Handle() returned an error result: %+v", result.Content)
+	}
+
+	sizes := toolStats.responseSizes()
+	if got, want := sizes[toolName], (ResponseSizes{Samples: 5, P50Bytes: 3000, P95Bytes: 10000, MaxBytes: 10000}); got != want {
+		t.Errorf("response sizes of %s = %+v, want %+v", toolName, got, want)
+	}
+	if got, want := sizes[allTools], (ResponseSizes{Samples: 6, P50Bytes: 2000, P95Bytes: 10000, MaxBytes: 10000}); got != want {
+		t.Errorf("response sizes of all tools = %+v, want %+v", got, want)
+	}
+	if got := testutil.CollectAndCount(metrics.ToolResponseBytes) - observedBefore; got != 2 {
+		t.Errorf("response size histograms grew by %d series, want one per tool", got)
+	}
+
+	// Only the response above the threshold is logged
+	if got := strings.Count(logs.String(), "Tool response exceeds the size warning threshold"); got != 1 || !strings.Contains(logs.String(), "bytes=10000") {
+		t.Errorf("logged %d size warnings, want one for the 10000 byte response:\n%s", got, logs.String())
+	}
+}
+
+func TestSizeRingKeepsRecentSamples(t *testing.T) {
+	ring := &sizeRing{}
+	for size := 1; size <= responseSizeSamples+10; size++ {
+		ring.add(size)
+	}
+	if len(ring.samples) != responseSizeSamples || ring.percentile(0) != 11 || ring.percentile(100) != responseSizeSamples+10 {
+		t.Errorf("ring holds %d samples from %d to %d, want the last %d", len(ring.samples), ring.percentile(0), ring.percentile(100), responseSizeSamples)
+	}
+}
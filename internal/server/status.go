@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// ServerStatusOutput is the readiness report of the server, as served by /ready and the server
+// status tool
+type ServerStatusOutput struct {
+	Status     string           `json:"status" jsonschema:"Always ready while the server answers"`
+	Admission  AdmissionStatus  `json:"admission" jsonschema:"Queue depth and estimated wait of rate-limited tool calls, and the longest wait admitted before calls are refused as busy"`
+	ArxivQuota ArxivQuotaStatus `json:"arxivQuota" jsonschema:"Requests to arXiv made today against OPUS_MCP_ARXIV_DAILY_LIMIT, with the number remaining when there is a limit and when the count resets"`
+	// Clock is only reported once the skew has been measured
+	Clock *ClockStatus `json:"clock,omitempty" jsonschema:"The skew of the server clock against arXiv and S3 storage, once measured"`
+	// Storage is only reported when S3 is configured
+	Storage map[string]any `json:"storage,omitempty" jsonschema:"The last known capacity of the storage and the minimum free space downloads require"`
+	// DownloadJobs is only reported when S3 is configured
+	DownloadJobs *DownloadJobsStatus `json:"downloadJobs,omitempty" jsonschema:"The number of queued and running background downloads and of those failed during the last hour"`
+	// ResponseSizes is only reported once tools have responded
+	ResponseSizes map[string]ResponseSizes `json:"responseSizes,omitempty" jsonschema:"The median, 95th percentile and largest size in bytes of the recent responses of each tool, and of all tools under '*'"`
+	// TransferEstimates is only reported once downloads have been measured
+	TransferEstimates *TransferEstimates `json:"transferEstimates,omitempty" jsonschema:"Rolling estimates of the time to first byte, origin and S3 throughput and typical size of downloads"`
+}
+
+// serverStatusReport collects the current readiness report
+func serverStatusReport() ServerStatusOutput {
+	report := ServerStatusOutput{
+		Status:            "ready",
+		Admission:         arxivAdmission.status(),
+		ArxivQuota:        arxivQuota.status(),
+		Clock:             clockStatus(),
+		TransferEstimates: transferEstimates(),
+	}
+	if storageCapacity != nil {
+		report.Storage = storageCapacity.status()
+	}
+	if downloadJobs != nil {
+		status := downloadJobs.status()
+		report.DownloadJobs = &status
+	}
+	if sizes := toolStats.responseSizes(); len(sizes) > 0 {
+		report.ResponseSizes = sizes
+	}
+	return report
+}
+
+// serverStatus contains the handler function of the server status tool
+func serverStatus(ctx context.Context, input json.RawMessage) (any, error) {
+	return serverStatusReport(), nil
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServerStatusTool(t *testing.T) {
+	originalCapacity, originalJobs := storageCapacity, downloadJobs
+	t.Cleanup(func() { storageCapacity, downloadJobs = originalCapacity, originalJobs })
+	storageCapacity, downloadJobs = nil, nil
+
+	tool, handler, err := newServerStatusTool()
+	if err != nil {
+		t.Fatalf("newServerStatusTool() unexpected error: %v", err)
+	}
+	if tool.Annotations == nil || !tool.Annotations.ReadOnlyHint {
+		t.Error("server_status should be annotated as read-only")
+	}
+
+	result, err := handler.Handle(context.Background(), newTestCallToolRequest("server_status", `{}`))
+	if err != nil {
+		t.Fatalf("Handle() returned protocol error: %v", err)
+	}
+	if result.IsError {
+		t.Fatalf("server_status failed: %s", resultText(t, result))
+	}
+	var output map[string]any
+	if err := json.Unmarshal([]byte(resultText(t, result)), &output); err != nil {
+		t.Fatalf("failed to unmarshal output: %v", err)
+	}
+	if output["status"] != "ready" || output["admission"] == nil || output["arxivQuota"] == nil {
+		t.Errorf("output = %v, want the readiness report", output)
+	}
+	// Without S3, there is neither a capacity nor background downloads to report
+	if _, ok := output["storage"]; ok {
+		t.Error("output reports storage without S3 configured")
+	}
+	if _, ok := output["downloadJobs"]; ok {
+		t.Error("output reports download jobs without S3 configured")
+	}
+
+	// The readiness endpoint serves the same report, without the schema version of tool outputs
+	recorder := httptest.NewRecorder()
+	readinessHandler(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	var ready map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &ready); err != nil {
+		t.Fatalf("failed to unmarshal readiness response: %v", err)
+	}
+	for key := range output {
+		if _, ok := ready[key]; !ok && key != schemaVersionProperty {
+			t.Errorf("readiness response lacks %q reported by server_status", key)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"opus-mcp/internal/metadata"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// stdioNotice tells someone who started the server from a terminal that it is not stuck
+const stdioNotice = `%s is using the stdio transport and is waiting for an MCP client on standard input.
+Nothing else is printed here: start it from an MCP client, or run it as an HTTP server with
+-transport http (see -host and -port). Press Ctrl+C to stop.
+`
+
+// noticeInteractiveStdio prints stdioNotice to w when stdout is a terminal, i.e., when the stdio
+// transport was started by hand rather than by an MCP client. It reports whether it did.
+func noticeInteractiveStdio(w io.Writer, stdout *os.File) bool {
+	if !isTerminal(stdout) {
+		return false
+	}
+	if _, err := fmt.Fprintf(w, stdioNotice, metadata.APP_NAME); err != nil {
+		slog.Warn("Failed to print the stdio transport notice", "error", err)
+	}
+	return true
+}
+
+// consoleOutput returns where human-readable output, such as the banner, is written for a
+// transport: stdout carries the protocol over stdio, so it goes to stderr there
+func consoleOutput(transport string) io.Writer {
+	if transport == "stdio" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// reserveStdout reserves stdout for the stdio transport: it returns the original stdout, to be
+// written only by the transport, and points os.Stdout to stderr so that any other write to it
+// cannot corrupt the protocol. restore points os.Stdout back to the original.
+func reserveStdout() (protocol *os.File, restore func()) {
+	protocol = os.Stdout
+	os.Stdout = os.Stderr
+	return protocol, func() { os.Stdout = protocol }
+}
+
+// serveStdio runs the server over a single stdio session until the client disconnects
+func serveStdio(ctx context.Context, server *mcp.Server, stdin io.ReadCloser, stdout io.WriteCloser) error {
+	return server.Run(ctx, &mcp.IOTransport{Reader: stdin, Writer: stdout})
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestNoticeInteractiveStdio(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	// An MCP client attaches stdout to a pipe, where the notice would only be noise
+	var out strings.Builder
+	if noticeInteractiveStdio(&out, writer) || out.Len() != 0 {
+		t.Errorf("noticeInteractiveStdio() with stdout on a pipe printed %q, want nothing", out.String())
+	}
+	if !strings.Contains(stdioNotice, "-transport http") {
+		t.Error("stdioNotice does not explain how to switch to the HTTP transport")
+	}
+	if consoleOutput("stdio") != os.Stderr || consoleOutput("http") != os.Stdout {
+		t.Error("consoleOutput() should write to stderr over stdio and to stdout over HTTP")
+	}
+}
+
+// TestStdioSessionWritesOnlyProtocolToStdout runs a scripted stdio session with a tool that prints
+// to stdout, and checks that stdout carries nothing but JSON-RPC messages
+func TestStdioSessionWritesOnlyProtocolToStdout(t *testing.T) {
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	defer stdoutReader.Close()
+	stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatalf("failed to create temporary file: %v", err)
+	}
+	defer stderr.Close()
+	originalStdout, originalStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdoutWriter, stderr
+	defer func() { os.Stdout, os.Stderr = originalStdout, originalStderr }()
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test-server", Version: "v0.0.1"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "noisy"}, func(ctx context.Context, req *mcp.CallToolRequest, input struct{}) (*mcp.CallToolResult, any, error) {
+		fmt.Println("stray output")
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "done"}}}, nil, nil
+	})
+	protocol, restore := reserveStdout()
+	if protocol != stdoutWriter || os.Stdout != stderr {
+		t.Fatal("reserveStdout() should return the original stdout and point os.Stdout to stderr")
+	}
+	done := make(chan error, 1)
+	go func() { done <- serveStdio(context.Background(), server, stdinReader, protocol) }()
+
+	lines := bufio.NewScanner(stdoutReader)
+	exchange := func(request string) string {
+		t.Helper()
+		if _, err := fmt.Fprintln(stdinWriter, request); err != nil {
+			t.Fatalf("failed to write request: %v", err)
+		}
+		if strings.Contains(request, `"id"`) {
+			if !lines.Scan() {
+				t.Fatalf("no response to %s: %v", request, lines.Err())
+			}
+			return lines.Text()
+		}
+		return ""
+	}
+	responses := []string{
+		exchange(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"script","version":"1.0.0"}}}`),
+		exchange(`{"jsonrpc":"2.0","method":"notifications/initialized"}`),
+		exchange(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"noisy","arguments":{}}}`),
+	}
+	stdinWriter.Close()
+	if err := <-done; err != nil {
+		t.Errorf("serveStdio() unexpected error: %v", err)
+	}
+	restore()
+	if os.Stdout != stdoutWriter {
+		t.Error("restore() did not point os.Stdout back to the original stdout")
+	}
+	for lines.Scan() {
+		responses = append(responses, lines.Text())
+	}
+
+	for _, response := range responses {
+		if response == "" {
+			continue
+		}
+		var message struct {
+			JSONRPC string `json:"jsonrpc"`
+		}
+		if err := json.Unmarshal([]byte(response), &message); err != nil || message.JSONRPC != "2.0" {
+			t.Errorf("stdout carried %q, which is not a JSON-RPC message", response)
+		}
+	}
+	if !strings.Contains(responses[2], `"done"`) {
+		t.Errorf("tools/call response = %s, want the tool result", responses[2])
+	}
+	written, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatalf("failed to read stderr: %v", err)
+	}
+	if !strings.Contains(string(written), "stray output") {
+		t.Errorf("stderr = %q, want the tool's stray output", written)
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"opus-mcp/internal/settings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// InputConfig holds how strictly the arguments of tool calls are validated, loaded from environment
+// variables
+type InputConfig struct {
+	// Strict rejects arguments that the input schema of a tool does not declare. Models misname
+	// arguments, e.g., maxResults for fetchSize, and would otherwise believe that they took effect.
+	// Lenient validation drops them instead, for clients that send benign extra metadata.
+	Strict bool `env:"OPUS_MCP_STRICT_INPUT,default=true"`
+}
+
+// LoadInputConfig loads the tool argument validation configuration from environment variables
+func LoadInputConfig() (*InputConfig, error) {
+	var config InputConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process input validation configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// strictInput rejects tool calls with arguments their input schema does not declare
+var strictInput = true
+
+// closedObject is the additionalProperties schema of objects that declare all their properties
+func closedObject() *jsonschema.Schema {
+	return &jsonschema.Schema{Not: &jsonschema.Schema{}}
+}
+
+// isClosedObject reports whether an object schema forbids properties it does not declare
+func isClosedObject(schema *jsonschema.Schema) bool {
+	return schema.AdditionalProperties != nil && len(schema.PatternProperties) == 0 &&
+		reflect.DeepEqual(schema.AdditionalProperties, closedObject())
+}
+
+// checkUnknownFields finds the arguments of a tool call that its input schema does not declare, at
+// any depth. In strict mode they are reported as a *SchemaValidationError, every one with the
+// closest declared name as a suggestion; otherwise they are dropped and the remaining arguments are
+// returned for validation.
+func checkUnknownFields(data []byte, schema *jsonschema.Schema) ([]byte, error) {
+	var args any
+	if err := json.Unmarshal(data, &args); err != nil {
+		// Arguments that are not JSON are reported by the schema validation
+		return data, nil
+	}
+	violations := unknownFields(args, schema, "", !strictInput)
+	if len(violations) == 0 {
+		return data, nil
+	}
+	if strictInput {
+		messages := make([]string, len(violations))
+		for i, violation := range violations {
+			messages[i] = violation.Message
+		}
+		return nil, &SchemaValidationError{Violations: violations, err: errors.New(strings.Join(messages, "; "))}
+	}
+	for _, violation := range violations {
+		slog.Debug("Dropping an undeclared argument", "pointer", violation.Pointer)
+	}
+	return json.Marshal(args)
+}
+
+// unknownFields walks a value along its schema, listing the members of closed objects that the
+// schema does not declare and, if drop is set, removing them from their object
+func unknownFields(value any, schema *jsonschema.Schema, pointer string, drop bool) []SchemaViolation {
+	if schema == nil {
+		return nil
+	}
+	var violations []SchemaViolation
+	switch value := value.(type) {
+	case map[string]any:
+		for _, name := range slices.Sorted(maps.Keys(value)) {
+			member := pointer + "/" + escapePointerToken(name)
+			if property, ok := schema.Properties[name]; ok {
+				violations = append(violations, unknownFields(value[name], property, member, drop)...)
+				continue
+			}
+			if !isClosedObject(schema) {
+				violations = append(violations, unknownFields(value[name], schema.AdditionalProperties, member, drop)...)
+				continue
+			}
+			violations = append(violations, unknownFieldViolation(member, name, slices.Sorted(maps.Keys(schema.Properties))))
+			if drop {
+				delete(value, name)
+			}
+		}
+	case []any:
+		for i, item := range value {
+			violations = append(violations, unknownFields(item, schema.Items, fmt.Sprintf("%s/%d", pointer, i), drop)...)
+		}
+	}
+	return violations
+}
+
+// unknownFieldViolation reports an undeclared argument, suggesting the declared one it most likely
+// means or, failing that, listing them all
+func unknownFieldViolation(pointer, name string, known []string) SchemaViolation {
+	violation := SchemaViolation{Pointer: pointer, Constraint: "additionalProperties"}
+	switch suggestion := closestField(name, known); {
+	case suggestion != "":
+		violation.Suggestion = suggestion
+		violation.Message = fmt.Sprintf("unknown field %q at %s; did you mean %q?", name, pointer, suggestion)
+	case len(known) > 0:
+		violation.Message = fmt.Sprintf("unknown field %q at %s; valid fields are %s", name, pointer, joinFields(known))
+	default:
+		violation.Message = fmt.Sprintf("unknown field %q at %s; no arguments are accepted here", name, pointer)
+	}
+	return violation
+}
+
+// closestField returns the declared name nearest to an unknown one by edit distance, ignoring case,
+// or "" if none is near enough to be a likely misspelling: within a third of the name's length, and
+// at least two edits
+func closestField(name string, known []string) string {
+	best, bestDistance := "", max(2, len([]rune(name))/3)+1
+	for _, candidate := range known {
+		if distance := editDistance(strings.ToLower(name), strings.ToLower(candidate)); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between two strings: the number of runes to insert,
+// delete or substitute to turn one into the other
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			substitution := previous[j-1]
+			if ra[i-1] != rb[j-1] {
+				substitution++
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, substitution)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// TestUnknownFields checks that undeclared arguments are rejected with the closest declared name
+// as a suggestion, at any depth, and dropped instead in lenient mode
+func TestUnknownFields(t *testing.T) {
+	_, categoryFetch, err := newCategoryFetchLatestTool()
+	if err != nil {
+		t.Fatalf("newCategoryFetchLatestTool() unexpected error: %v", err)
+	}
+	_, cleanup, err := newLibraryCleanupTool()
+	if err != nil {
+		t.Fatalf("newLibraryCleanupTool() unexpected error: %v", err)
+	}
+	_, taxonomy, err := newCategoryTaxonomyTool()
+	if err != nil {
+		t.Fatalf("newCategoryTaxonomyTool() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		handler *ArxivToolHandler
+		lenient bool
+		input   string
+		// want are the violations reported, without their messages; none when the call succeeds
+		want        []SchemaViolation
+		wantMessage string
+	}{
+		{
+			name:        "Misspelled field",
+			handler:     categoryFetch,
+			input:       `{"category": "cs.CL", "fetchsise": 5}`,
+			want:        []SchemaViolation{{Pointer: "/fetchsise", Constraint: "additionalProperties", Suggestion: "fetchSize"}},
+			wantMessage: `did you mean "fetchSize"?`,
+		},
+		{
+			name:        "Unrelated field",
+			handler:     taxonomy,
+			input:       `{"source": "embedded", "maxResults": 5}`,
+			want:        []SchemaViolation{{Pointer: "/maxResults", Constraint: "additionalProperties"}},
+			wantMessage: "valid fields are source",
+		},
+		{
+			name:    "Nested fields",
+			handler: cleanup,
+			input:   `{"rules": {"olderThanDay": {"exports/": 30}, "keepLatestVersionOnly": true}, "confrim": true}`,
+			want: []SchemaViolation{
+				{Pointer: "/confrim", Constraint: "additionalProperties", Suggestion: "confirm"},
+				{Pointer: "/rules/olderThanDay", Constraint: "additionalProperties", Suggestion: "olderThanDays"},
+			},
+		},
+		{
+			name:    "Extra field when lenient",
+			handler: taxonomy,
+			lenient: true,
+			input:   `{"source": "embedded", "_clientTrace": {"id": "abc"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := strictInput
+			t.Cleanup(func() { strictInput = original })
+			strictInput = !tt.lenient
+
+			result := tt.handler.handle(context.Background(), newTestCallToolRequest("test_tool", tt.input))
+			if len(tt.want) == 0 {
+				if result.IsError {
+					t.Fatalf("handle() = %s, want success", resultText(t, result))
+				}
+				return
+			}
+			if !result.IsError {
+				t.Fatalf("handle() = %s, want an invalid input error", resultText(t, result))
+			}
+			var payload struct {
+				Error ToolError `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(resultText(t, result)), &payload); err != nil {
+				t.Fatalf("failed to unmarshal error: %v", err)
+			}
+			if payload.Error.Code != ErrCodeInvalidInput {
+				t.Errorf("error code = %s, want %s", payload.Error.Code, ErrCodeInvalidInput)
+			}
+			if !strings.Contains(payload.Error.Message, tt.wantMessage) {
+				t.Errorf("error message = %q, want it to contain %q", payload.Error.Message, tt.wantMessage)
+			}
+			got := payload.Error.ValidationErrors
+			if len(got) != len(tt.want) {
+				t.Fatalf("validationErrors = %+v, want %+v", got, tt.want)
+			}
+			for i, violation := range got {
+				violation.Message = ""
+				if violation != tt.want[i] {
+					t.Errorf("validationErrors[%d] = %+v, want %+v", i, violation, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestLenientInputDropsUnknownFields checks that in lenient mode the argument checks and the
+// handler only see the arguments the schema declares
+func TestLenientInputDropsUnknownFields(t *testing.T) {
+	original := strictInput
+	t.Cleanup(func() { strictInput = original })
+	strictInput = false
+
+	var validated, handled json.RawMessage
+	schema := &jsonschema.Schema{
+		Type:                 "object",
+		Properties:           map[string]*jsonschema.Schema{"query": {Type: "string"}},
+		AdditionalProperties: closedObject(),
+	}
+	handler, err := NewArxivToolHandler(schema, &jsonschema.Schema{Type: "object"}, func(ctx context.Context, input json.RawMessage) (any, error) {
+		handled = input
+		return map[string]any{}, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to create tool handler: %v", err)
+	}
+	handler.validateArgs = func(input json.RawMessage) []ValidationIssue {
+		validated = input
+		return nil
+	}
+
+	result := handler.handle(context.Background(), newTestCallToolRequest("test_tool", `{"query": "attention", "_clientTrace": {"id": "abc"}}`))
+	if result.IsError {
+		t.Fatalf("handle() = %s, want success", resultText(t, result))
+	}
+	for name, input := range map[string]json.RawMessage{"validateArgs": validated, "handler": handled} {
+		var args map[string]any
+		if err := json.Unmarshal(input, &args); err != nil {
+			t.Fatalf("%s got invalid arguments %s: %v", name, input, err)
+		}
+		if _, ok := args["_clientTrace"]; ok || args["query"] != "attention" {
+			t.Errorf("%s got arguments %s, want only the declared query", name, input)
+		}
+	}
+}
+
+// TestInputSchemasAreClosed checks that every object in the input schemas of all tools declares
+// its properties, so that strict mode can tell misnamed arguments apart
+func TestInputSchemasAreClosed(t *testing.T) {
+	catalog := registerAllTools(t)
+	var check func(tool, path string, schema *jsonschema.Schema)
+	check = func(tool, path string, schema *jsonschema.Schema) {
+		if schema == nil {
+			return
+		}
+		if schema.Type == "object" && schema.AdditionalProperties == nil {
+			t.Errorf("tool %s: input schema object at %q allows undeclared properties", tool, path)
+		}
+		for name, property := range schema.Properties {
+			check(tool, path+"/properties/"+name, property)
+		}
+		check(tool, path+"/items", schema.Items)
+		if !isClosedObject(schema) {
+			check(tool, path+"/additionalProperties", schema.AdditionalProperties)
+		}
+	}
+	for name, handler := range catalog.handlers {
+		check(name, "", handler.inputSchema.Schema())
+	}
+}
+
+func TestClosestField(t *testing.T) {
+	known := []string{"category", "fetchSize", "sortBy", "sortOrder", "startIndex"}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"fetchsize", "fetchSize"},
+		{"FetchSize", "fetchSize"},
+		{"fetch_size", "fetchSize"},
+		{"sortby", "sortBy"},
+		{"categories", "category"},
+		{"maxResults", ""},
+		{"limit", ""},
+	}
+	for _, tt := range tests {
+		if got := closestField(tt.name, known); got != tt.want {
+			t.Errorf("closestField(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
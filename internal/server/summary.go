@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/settings"
+	"opus-mcp/internal/storage"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// summaryObjectPrefix is the bucket prefix under which generated summaries are stored
+const summaryObjectPrefix = "summaries/"
+
+// SummaryConfig holds the configuration of the summaries generated for downloaded articles
+type SummaryConfig struct {
+	// Disabled refuses every summary, e.g., where clients must not be asked to sample
+	Disabled bool `env:"OPUS_MCP_SUMMARY_DISABLED,default=false"`
+	// MaxInputTokens caps the article text sent to the client for summarization, estimated at four
+	// characters per token
+	MaxInputTokens int `env:"OPUS_MCP_SUMMARY_MAX_INPUT_TOKENS,default=1500"`
+	// MaxTokens caps the length of the summary the client is asked for
+	MaxTokens int `env:"OPUS_MCP_SUMMARY_MAX_TOKENS,default=600"`
+}
+
+// Validate reports the problems of the summary configuration together
+func (c *SummaryConfig) Validate() error {
+	var errs []error
+	if c.MaxInputTokens <= 0 {
+		errs = append(errs, fmt.Errorf("OPUS_MCP_SUMMARY_MAX_INPUT_TOKENS must be positive, got %d", c.MaxInputTokens))
+	}
+	if c.MaxTokens <= 0 {
+		errs = append(errs, fmt.Errorf("OPUS_MCP_SUMMARY_MAX_TOKENS must be positive, got %d", c.MaxTokens))
+	}
+	return errors.Join(errs...)
+}
+
+// LoadSummaryConfig loads the summary configuration from environment variables
+func LoadSummaryConfig() (*SummaryConfig, error) {
+	var config SummaryConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process summary configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// summaryConfig is the summary configuration loaded at server startup
+var summaryConfig = SummaryConfig{MaxInputTokens: 1500, MaxTokens: 600}
+
+// summarySystemPrompt asks the client's model for a summary that stands on its own in the library
+const summarySystemPrompt = "You summarize scientific papers for a research library. Use only the text you are given, do not speculate beyond it, and answer with the summary alone."
+
+// summaryPrompt is the request sent to the client's model, followed by the article text
+const summaryPrompt = "Summarize the arXiv paper below in Markdown: a one-sentence TL;DR, followed by short bullet points on the problem, the approach and the main results."
+
+// paperText is the text of an article that is summarized
+type paperText struct {
+	Title    string
+	Abstract string
+}
+
+// paperTextFetcher returns the text of an article to summarize: its title and abstract, as listed
+// by the arXiv API; replaced in tests
+var paperTextFetcher = func(ctx context.Context, id arxivid.ID) (paperText, error) {
+	result, err := fetchIDList(ctx, []string{id.Canonical()}, 1, false)
+	if err != nil {
+		return paperText{}, err
+	}
+	if len(result.Items) == 0 || result.Items[0].Item == nil {
+		return paperText{}, fmt.Errorf("arXiv returned no entry for %s", id.Canonical())
+	}
+	item := result.Items[0].Item
+	return paperText{Title: strings.TrimSpace(item.Title), Abstract: strings.TrimSpace(item.Description)}, nil
+}
+
+// summaryUploader stores a generated summary in the articles bucket; replaced in tests
+var summaryUploader = func(ctx context.Context, objectName string, data []byte) error {
+	if globalS3Config == nil {
+		return fmt.Errorf("S3 configuration not loaded")
+	}
+	return storage.PutObjectBytes(ctx, globalS3Config, S3_ARTICLES_BUCKET, objectName, data, "text/markdown; charset=utf-8")
+}
+
+// summaryObjectName returns the name of the object holding the summary of an article
+func summaryObjectName(id arxivid.ID) string {
+	return summaryObjectPrefix + id.StorageKey() + ".md"
+}
+
+// paperSummarizer summarizes articles through MCP sampling by the client that asked for them
+type paperSummarizer struct {
+	session *mcp.ServerSession
+}
+
+// newPaperSummarizer returns a summarizer sampling from the client of the current tool call. A
+// session that cannot sample is reported when summarizing, so that the download goes ahead.
+func newPaperSummarizer(ctx context.Context) *paperSummarizer {
+	info, _ := callInfoFrom(ctx)
+	return &paperSummarizer{session: info.session}
+}
+
+// available returns why summaries cannot be generated, if they cannot
+func (s *paperSummarizer) available() error {
+	switch {
+	case summaryConfig.Disabled:
+		return errors.New("summaries are disabled by OPUS_MCP_SUMMARY_DISABLED")
+	case s.session == nil:
+		return errors.New("the tool call has no MCP session to sample from")
+	}
+	params := s.session.InitializeParams()
+	if params == nil || params.Capabilities == nil || params.Capabilities.Sampling == nil {
+		return errors.New("the MCP client does not support sampling")
+	}
+	return nil
+}
+
+// summarize asks the client to summarize an article and stores the summary as Markdown, returning
+// the name of the object it is stored as
+func (s *paperSummarizer) summarize(ctx context.Context, id arxivid.ID) (string, error) {
+	if err := s.available(); err != nil {
+		return "", err
+	}
+	text, err := paperTextFetcher(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the text to summarize: %w", err)
+	}
+	if text.Abstract == "" {
+		return "", fmt.Errorf("there is no text to summarize for %s", id.Canonical())
+	}
+
+	result, err := s.session.CreateMessage(ctx, &mcp.CreateMessageParams{
+		SystemPrompt:   summarySystemPrompt,
+		IncludeContext: "none",
+		MaxTokens:      int64(summaryConfig.MaxTokens),
+		Messages: []*mcp.SamplingMessage{{
+			Role:    "user",
+			Content: &mcp.TextContent{Text: summaryRequestText(text, summaryConfig.MaxInputTokens)},
+		}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("sampling failed: %w", err)
+	}
+	content, ok := result.Content.(*mcp.TextContent)
+	if !ok || strings.TrimSpace(content.Text) == "" {
+		return "", errors.New("the client returned no text summary")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", strings.Join(strings.Fields(text.Title), " "))
+	fmt.Fprintf(&b, "Summary of arXiv:%s", id.Canonical())
+	if result.Model != "" {
+		fmt.Fprintf(&b, ", generated by %s", result.Model)
+	}
+	fmt.Fprintf(&b, ".\n\n%s\n", strings.TrimSpace(content.Text))
+
+	objectName := summaryObjectName(id)
+	if err := summaryUploader(ctx, objectName, []byte(b.String())); err != nil {
+		return "", fmt.Errorf("failed to store the summary: %w", err)
+	}
+	slog.Info("Stored article summary", "article_id", id.Canonical(), "object", objectName, "model", result.Model)
+	return objectName, nil
+}
+
+// summaryRequestText builds the summarization request from the article text, capping the text at
+// about maxTokens tokens of four characters, cut at a word boundary
+func summaryRequestText(text paperText, maxTokens int) string {
+	var body strings.Builder
+	if text.Abstract != "" {
+		fmt.Fprintf(&body, "Abstract:\n%s\n", text.Abstract)
+	}
+	capped := []rune(body.String())
+	if maxChars := maxTokens * 4; len(capped) > maxChars {
+		cut := string(capped[:maxChars])
+		if i := strings.LastIndexAny(cut, " \n"); i > 0 {
+			cut = cut[:i]
+		}
+		capped = []rune(cut + " [truncated]\n")
+	}
+	return fmt.Sprintf("%s\n\nTitle: %s\n\n%s", summaryPrompt, text.Title, string(capped))
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/storage"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// connectSummaryClient connects a client to a server serving the download and provenance tools.
+// With a createMessage handler, the client supports sampling.
+func connectSummaryClient(t *testing.T, createMessage func(context.Context, *mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error)) *mcp.ClientSession {
+	t.Helper()
+	server := mcp.NewServer(&mcp.Implementation{Name: "test-server", Version: "v0.0.1"}, nil)
+	for _, build := range []func() (*mcp.Tool, *ArxivToolHandler, error){newDownloadPDFTool, newLibraryProvenanceTool} {
+		tool, handler, err := build()
+		if err != nil {
+			t.Fatalf("failed to build tool: %v", err)
+		}
+		server.AddTool(tool, handler.Handle)
+	}
+	ctx := context.Background()
+	clientTransport, serverTransport := mcp.NewInMemoryTransports()
+	serverSession, err := server.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect server: %v", err)
+	}
+	t.Cleanup(func() { serverSession.Close() })
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.2.3"}, &mcp.ClientOptions{CreateMessageHandler: createMessage})
+	clientSession, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect client: %v", err)
+	}
+	t.Cleanup(func() { clientSession.Close() })
+	return clientSession
+}
+
+// callTool calls a tool and decodes its structured output
+func callTool[T any](t *testing.T, session *mcp.ClientSession, name, arguments string) T {
+	t.Helper()
+	result, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: name, Arguments: json.RawMessage(arguments)})
+	if err != nil {
+		t.Fatalf("CallTool(%s) unexpected error: %v", name, err)
+	}
+	if result.IsError {
+		t.Fatalf("CallTool(%s) failed: %s", name, resultText(t, result))
+	}
+	var output T
+	if err := json.Unmarshal([]byte(resultText(t, result)), &output); err != nil {
+		t.Fatalf("failed to unmarshal output of %s: %v", name, err)
+	}
+	return output
+}
+
+// TestDownloadPDFStoresSummary downloads an article with a scripted sampling client and checks
+// that the summary is stored, indexed and returned by library_provenance
+func TestDownloadPDFStoresSummary(t *testing.T) {
+	withUnlimitedArxiv(t)
+	originalConfig, originalLibrary, originalUploader := globalS3Config, globalLibrary, urlUploader
+	originalFetcher, originalSummaryUploader, originalReader, originalSummaryConfig := paperTextFetcher, summaryUploader, objectRangeReader, summaryConfig
+	t.Cleanup(func() {
+		globalS3Config, globalLibrary, urlUploader = originalConfig, originalLibrary, originalUploader
+		paperTextFetcher, summaryUploader, objectRangeReader, summaryConfig = originalFetcher, originalSummaryUploader, originalReader, originalSummaryConfig
+	})
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	globalLibrary = library.New(&library.MemoryStore{})
+	urlUploader = func(ctx context.Context, sourceURL string, config *storage.S3Config, bucketName, objectName string, metadata map[string]string, policy storage.CollisionPolicy) (storage.UploadResult, error) {
+		return storage.UploadResult{UploadInfo: minio.UploadInfo{Bucket: bucketName, Key: objectName, Size: 42}}, nil
+	}
+	abstract := "The dominant sequence transduction models are based on complex recurrent or convolutional neural networks. " + strings.Repeat("We propose a new simple network architecture. ", 20)
+	paperTextFetcher = func(ctx context.Context, id arxivid.ID) (paperText, error) {
+		return paperText{Title: "Attention Is All\n  You Need", Abstract: abstract}, nil
+	}
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	summaryUploader = func(ctx context.Context, objectName string, data []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		objects[objectName] = data
+		return nil
+	}
+	objectRangeReader = func(ctx context.Context, objectName string, offset, length int64) ([]byte, int64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return objects[objectName], int64(len(objects[objectName])), nil
+	}
+	summaryConfig = SummaryConfig{MaxInputTokens: 40, MaxTokens: 300}
+
+	var sampled []*mcp.CreateMessageParams
+	session := connectSummaryClient(t, func(ctx context.Context, req *mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+		sampled = append(sampled, req.Params)
+		return &mcp.CreateMessageResult{Model: "test-model", Role: "assistant", Content: &mcp.TextContent{Text: "**TL;DR:** attention replaces recurrence.\n"}}, nil
+	})
+
+	output := callTool[ArxivDownloadPDFOutput](t, session, "arxiv_download_pdf", `{"articleId":"1706.03762v7","generateSummary":true}`)
+	if !output.Success || output.SummaryObjectName != "summaries/1706.03762v7.md" || output.SummaryError != "" {
+		t.Fatalf("download output = %+v, want the summary stored as summaries/1706.03762v7.md", output)
+	}
+	if len(sampled) != 1 {
+		t.Fatalf("client was asked for %d samples, want 1", len(sampled))
+	}
+	prompt := sampled[0].Messages[0].Content.(*mcp.TextContent).Text
+	if !strings.Contains(prompt, "Title: Attention Is All\n  You Need") || !strings.Contains(prompt, "The dominant sequence transduction models") {
+		t.Errorf("sampling prompt = %q, want the title and abstract", prompt)
+	}
+	if !strings.HasSuffix(prompt, " [truncated]\n") || strings.Count(prompt, "We propose") >= 20 {
+		t.Errorf("sampling prompt = %q, want the abstract capped at the token limit", prompt)
+	}
+	if sampled[0].MaxTokens != 300 {
+		t.Errorf("sampling maxTokens = %d, want 300", sampled[0].MaxTokens)
+	}
+	wantSummary := "# Attention Is All You Need\n\nSummary of arXiv:1706.03762v7, generated by test-model.\n\n**TL;DR:** attention replaces recurrence.\n"
+	if got := string(objects["summaries/1706.03762v7.md"]); got != wantSummary {
+		t.Errorf("stored summary = %q, want %q", got, wantSummary)
+	}
+
+	provenance := callTool[LibraryProvenanceOutput](t, session, "library_provenance", `{"objectName":"arxiv/1706.03762v7.pdf"}`)
+	if provenance.Entry == nil || provenance.Entry.Summary != "summaries/1706.03762v7.md" || provenance.Summary != wantSummary {
+		t.Errorf("library_provenance output = %+v, want the entry's summary object and its content", provenance)
+	}
+
+	// A client that cannot sample still gets its download, with the reason the summary is missing
+	withoutSampling := connectSummaryClient(t, nil)
+	output = callTool[ArxivDownloadPDFOutput](t, withoutSampling, "arxiv_download_pdf", `{"articleId":"2405.12345","generateSummary":true}`)
+	if !output.Success || output.SummaryObjectName != "" || !strings.Contains(output.SummaryError, "does not support sampling") {
+		t.Errorf("download output without sampling = %+v, want the download stored and the summary error reported", output)
+	}
+
+	// Summaries can be disabled by the operator
+	summaryConfig.Disabled = true
+	output = callTool[ArxivDownloadPDFOutput](t, session, "arxiv_download_pdf", `{"articleId":"2405.12346","generateSummary":true}`)
+	if !output.Success || !strings.Contains(output.SummaryError, "OPUS_MCP_SUMMARY_DISABLED") || len(sampled) != 1 {
+		t.Errorf("download output with summaries disabled = %+v, want no sampling request", output)
+	}
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+
+	"opus-mcp/internal/metrics"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// taxonomyParseMu bounds parsing of the taxonomy page to one at a time. goquery builds the whole
+// DOM of the page, about 1 MB of HTML, and there is never a reason to hold two of them at once.
+var taxonomyParseMu sync.Mutex
+
+// parseTaxonomyPage parses a taxonomy page and reads the groups and categories off it, logging at
+// debug and exporting how long that took, how many elements the page has and how much memory it
+// took. The memory statistics are sampled before parsing and while the document is still alive,
+// so the heap growth approximates the peak held by the document.
+func parseTaxonomyPage(page []byte) (Taxonomy, error) {
+	taxonomyParseMu.Lock()
+	defer taxonomyParseMu.Unlock()
+
+	var before, parsed runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return Taxonomy{}, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+	result := extractTaxonomy(doc)
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&parsed)
+	nodes := doc.Find("*").Length()
+
+	allocated := parsed.TotalAlloc - before.TotalAlloc
+	heapGrowth := int64(parsed.HeapAlloc) - int64(before.HeapAlloc)
+	metrics.TaxonomyParseDuration.Observe(elapsed.Seconds())
+	metrics.TaxonomyParseAllocatedBytes.Observe(float64(allocated))
+	metrics.TaxonomyParseNodes.Set(float64(nodes))
+	slog.Debug("Parsed arXiv category taxonomy page", "bytes", len(page), "duration", elapsed, "nodes", nodes,
+		"allocated_bytes", allocated, "heap_growth_bytes", max(0, heapGrowth), "categories", len(result.Categories))
+	return result, nil
+}
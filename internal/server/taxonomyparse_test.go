@@ -0,0 +1,53 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"opus-mcp/internal/metrics"
+	"opus-mcp/internal/taxonomy"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// readTaxonomyFixture reads the taxonomy page fixture, laid out like the arXiv page with every
+// category of the embedded snapshot
+func readTaxonomyFixture(tb testing.TB) []byte {
+	tb.Helper()
+	page, err := os.ReadFile(filepath.Join("testdata", "category_taxonomy.html"))
+	if err != nil {
+		tb.Fatalf("failed to read taxonomy fixture: %v", err)
+	}
+	return page
+}
+
+func TestParseTaxonomyPage(t *testing.T) {
+	result, err := parseTaxonomyPage(readTaxonomyFixture(t))
+	if err != nil {
+		t.Fatalf("parseTaxonomyPage() unexpected error: %v", err)
+	}
+	if got, want := len(result.Categories), len(taxonomy.Embedded().Categories); got != want {
+		t.Errorf("parsed %d categories, want %d", got, want)
+	}
+	if category := result.Categories["cs.AI"]; category.Name != "Artificial Intelligence" || category.Description == "" {
+		t.Errorf("cs.AI = %+v, want its name and description", category)
+	}
+	if group := result.Groups["cs"]; group.Classification != "Computer Science" || group.Description == "" {
+		t.Errorf("cs group = %+v, want its area and description", group)
+	}
+	if nodes := testutil.ToFloat64(metrics.TaxonomyParseNodes); nodes < float64(len(result.Categories)) {
+		t.Errorf("taxonomy_parse_nodes = %v, want at least an element per category", nodes)
+	}
+}
+
+func BenchmarkParseTaxonomyPage(b *testing.B) {
+	page := readTaxonomyFixture(b)
+	b.SetBytes(int64(len(page)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := parseTaxonomyPage(page); err != nil {
+			b.Fatalf("parseTaxonomyPage() unexpected error: %v", err)
+		}
+	}
+}
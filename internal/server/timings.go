@@ -0,0 +1,52 @@
+package server
+
+import "opus-mcp/internal/storage"
+
+// DownloadTimings tells whether a download was slow because of its origin or because of S3
+type DownloadTimings struct {
+	OriginTTFBMs         int64 `json:"originTtfbMs" jsonschema:"Milliseconds from sending the request to the origin until its response headers arrived"`
+	OriginTransferMs     int64 `json:"originTransferMs" jsonschema:"Milliseconds from the origin's response headers until the last byte of the body was read"`
+	OriginBytesPerSecond int64 `json:"originBytesPerSecond" jsonschema:"Rate at which the body was read from the origin, in bytes per second"`
+	UploadMs             int64 `json:"uploadMs" jsonschema:"Milliseconds spent writing the object to S3, including retries"`
+	UploadBytesPerSecond int64 `json:"uploadBytesPerSecond" jsonschema:"Rate at which the object was written to S3, in bytes per second"`
+	// Streamed uploads read the origin while writing to S3, so the two phases overlap
+	Streamed bool `json:"streamed,omitempty" jsonschema:"Whether the body was too large to hold and was uploaded while it was read, so that the origin transfer and the upload overlap and the slower one bounds both"`
+}
+
+// downloadTimings converts the phase timings of an upload for a tool output
+func downloadTimings(timings storage.TransferTimings) *DownloadTimings {
+	return &DownloadTimings{
+		OriginTTFBMs:         timings.OriginTTFB.Milliseconds(),
+		OriginTransferMs:     timings.OriginTransfer.Milliseconds(),
+		OriginBytesPerSecond: int64(timings.OriginThroughput()),
+		UploadMs:             timings.Upload.Milliseconds(),
+		UploadBytesPerSecond: int64(timings.UploadThroughput()),
+		Streamed:             timings.Streamed,
+	}
+}
+
+// TransferEstimates are rolling estimates of recent downloads, for predicting how long the next
+// ones will take
+type TransferEstimates struct {
+	Samples              int   `json:"samples" jsonschema:"Number of downloads the estimates are based on"`
+	OriginTTFBMs         int64 `json:"originTtfbMs" jsonschema:"Estimated milliseconds until an origin's response headers arrive"`
+	OriginBytesPerSecond int64 `json:"originBytesPerSecond" jsonschema:"Estimated rate at which a body is read from its origin, in bytes per second"`
+	UploadBytesPerSecond int64 `json:"uploadBytesPerSecond" jsonschema:"Estimated rate at which an object is written to S3, in bytes per second"`
+	TypicalBytes         int64 `json:"typicalBytes" jsonschema:"Smoothed size of recent downloads, in bytes"`
+}
+
+// transferEstimates converts the current transfer estimates for a status report, or returns nil if
+// no download has been measured yet
+func transferEstimates() *TransferEstimates {
+	estimate, ok := storage.Transfers.Estimate()
+	if !ok {
+		return nil
+	}
+	return &TransferEstimates{
+		Samples:              estimate.Samples,
+		OriginTTFBMs:         estimate.OriginTTFB.Milliseconds(),
+		OriginBytesPerSecond: int64(estimate.OriginBytesPerSecond),
+		UploadBytesPerSecond: int64(estimate.UploadBytesPerSecond),
+		TypicalBytes:         int64(estimate.TypicalBytes),
+	}
+}
@@ -1,33 +1,40 @@
 package server
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
+	"math"
+	"net/http"
 	"strings"
 	"time"
 
 	"opus-mcp/internal"
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/attestation"
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/metrics"
 	"opus-mcp/internal/parser"
 	"opus-mcp/internal/storage"
+	"opus-mcp/internal/taxonomy"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/google/jsonschema-go/jsonschema"
 	"github.com/mmcdole/gofeed"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
-	"golang.org/x/time/rate"
 )
 
 const arxivApiEndpoint string = "https://export.arxiv.org/api/query"
 const arxivAbsBaseURL string = "https://arxiv.org/abs/"
 const arxivPDFBaseURL string = "https://arxiv.org/pdf/"
-const S3_ARTICLES_BUCKET string = "opus-mcp-articles"
 
-// arxivRateLimiter enforces arXiv API rate limit: max 1 request per 3 seconds
-// See: https://info.arxiv.org/help/api/tou.html
-var arxivRateLimiter = rate.NewLimiter(rate.Every(3*time.Second), 1)
+// categoryTaxonomyURL is the page listing the arXiv category taxonomy; replaced in tests
+var categoryTaxonomyURL = "https://arxiv.org/category_taxonomy"
+
+const S3_ARTICLES_BUCKET string = "opus-mcp-articles"
 
 func mcp_tool_errorf(format string, args ...any) *mcp.CallToolResult {
 	slog.Warn(fmt.Sprintf(format, args...))
@@ -40,19 +47,41 @@ func mcp_tool_errorf(format string, args ...any) *mcp.CallToolResult {
 func unmarshalAndValidate(data []byte, res *jsonschema.Resolved) error {
 	/*
 		Unmarshal the given data into a map[string]any and validate it against the given JSON schema.
+		Validation failures are returned as a *SchemaValidationError listing the violated constraints.
 	*/
 	var m map[string]any
 	if err := json.Unmarshal(data, &m); err != nil {
 		return err
 	}
-	return res.Validate(m)
+	if err := res.Validate(m); err != nil {
+		return newSchemaValidationError(err)
+	}
+	return nil
 }
 
 type ArxivCategoryFetchLatestArgs struct {
-	Category             string `json:"category" jsonschema:"The arXiv categories to fetch latest publications from. See taxonomy at https://arxiv.org/category_taxonomy"`
-	CategoryJoinStrategy string `json:"categoryJoinStrategy,omitempty" jsonschema:"Strategy to join multiple categories. Valid values are 'AND' or 'OR'. Defaults to 'AND' if not provided. This has no effect if only one category is provided"`
-	StartIndex           uint   `json:"startIndex,omitempty" jsonschema:"The starting index of results to fetch (0-based)"`
-	FetchSize            uint   `json:"fetchSize,omitempty" jsonschema:"The number of results to fetch"`
+	Category             string   `json:"category" jsonschema:"The arXiv categories to fetch latest publications from, optionally mixed with keywords and quoted phrases. See taxonomy at https://arxiv.org/category_taxonomy"`
+	KeywordField         string   `json:"keywordField,omitempty" jsonschema:"The arXiv search field that keywords and quoted phrases in the category expression are matched against. Valid values are 'all', 'abs' or 'ti'. Defaults to 'all'"`
+	CategoryJoinStrategy string   `json:"categoryJoinStrategy,omitempty" jsonschema:"How to join a plain list of category codes separated by commas or spaces, e.g., 'cs.AI, cs.CL'. Valid values are 'AND' or 'OR'. Defaults to 'AND'. Expressions with operators, parentheses or keywords are joined as written"`
+	StartIndex           uint     `json:"startIndex,omitempty" jsonschema:"The starting index of results to fetch (0-based)"`
+	FetchSize            uint     `json:"fetchSize,omitempty" jsonschema:"The number of results to fetch"`
+	AnnouncedOn          string   `json:"announcedOn,omitempty" jsonschema:"Only fetch papers announced on this date (YYYY-MM-DD, US Eastern time)"`
+	WeekOf               string   `json:"weekOf,omitempty" jsonschema:"Only fetch papers announced in the week, Monday to Sunday, containing this date (YYYY-MM-DD, US Eastern time)"`
+	MonthOf              string   `json:"monthOf,omitempty" jsonschema:"Only fetch papers announced in this month (YYYY-MM, US Eastern time)"`
+	CollapseRevisions    bool     `json:"collapseRevisions,omitempty" jsonschema:"Keep only the newest version of every article in the result, listing the collapsed versions in previousVersionsInWindow. Defaults to false"`
+	StrictParse          bool     `json:"strictParse,omitempty" jsonschema:"Fail on any XML error in the arXiv feed instead of removing invalid characters and escaping bare ampersands before parsing. Defaults to false"`
+	SortBy               string   `json:"sortBy,omitempty" jsonschema:"How to order the fetched entries: by 'submittedDate', 'lastUpdatedDate' or 'relevance' as arXiv sorts them, or 'categoryRelevance' (entries submitted to a queried category before cross-lists, newest first within each). Defaults to 'submittedDate'"`
+	SortOrder            string   `json:"sortOrder,omitempty" jsonschema:"The direction arXiv sorts the entries in: 'descending' or 'ascending'. Defaults to 'descending'"`
+	IncludeRawEntry      bool     `json:"includeRawEntry,omitempty" jsonschema:"Return the XML of every entry exactly as arXiv sent it in rawXml, for archiving the upstream record. Defaults to false"`
+	GroupBy              string   `json:"groupBy,omitempty" jsonschema:"Also return the entries in groups: by 'queriedCategory', 'primaryCategory' or 'announcedDate'. Not grouped by default"`
+	RecordToLibrary      bool     `json:"recordToLibrary,omitempty" jsonschema:"Also record the metadata of every returned article in the library index as a metadata-only entry, without downloading its PDF, for later triage; a later download of the article replaces the entry. Repeating a query records nothing new. Defaults to false"`
+	ExpandRelated        bool     `json:"expandRelated,omitempty" jsonschema:"Also search the categories adjacent to every category code in the expression, as listed by arxiv_related_categories. Defaults to false"`
+	Fields               string   `json:"fields,omitempty" jsonschema:"How much of every entry to return: 'full' or 'headline', only the identifier, title, primary category and announcement date. Defaults to 'full'"`
+	Raw                  bool     `json:"raw,omitempty" jsonschema:"Return the feed as parsed, with the feed's metadata and every entry's RSS, iTunes and Dublin Core fields and extensions, instead of flattened entries. Defaults to false"`
+	MaxAbstractLength    uint     `json:"maxAbstractLength,omitempty" jsonschema:"Truncate every abstract longer than this many characters, ending it in an ellipsis. Not truncated by default"`
+	IncludeFields        []string `json:"includeFields,omitempty" jsonschema:"Only return these fields of every flattened entry, e.g., ['title', 'authors', 'pdfUrl'], besides its errors. All fields when empty"`
+	NormalizeText        *bool    `json:"normalizeText,omitempty" jsonschema:"Return the titles and abstracts of flattened entries as plain text, with the feed's line breaks, HTML entities and LaTeX markup resolved, instead of as arXiv sent them. Defaults to true"`
+	MaxTokensHint        uint     `json:"maxTokensHint,omitempty" jsonschema:"The number of tokens of the client's context the entries may take up. Entries estimated not to fit are left out and reported in budget, which also suggests a fetchSize for the next call. Not limited by default"`
 }
 
 type CategoryFetchLatestOutput struct {
@@ -64,6 +93,21 @@ type ArxivToolHandler struct {
 	inputSchema  *jsonschema.Resolved
 	outputSchema *jsonschema.Resolved
 	handlerFunc  func(ctx context.Context, input json.RawMessage) (any, error)
+	// admission, when set, rejects calls up front if they would queue too long on a rate limiter
+	admission *admissionController
+	// supportsEstimate means the tool answers calls with estimateOnly set without querying a rate
+	// limited service, so that such calls skip admission
+	supportsEstimate bool
+	// describeQuery, when set, describes a successful call as a query to remember for the session
+	describeQuery func(input json.RawMessage, output any) *recentQuery
+	// coalesce makes concurrent calls with identical arguments share a single execution
+	coalesce bool
+	inflight callGroup
+	// schemaVersion, when set, is added to every output as the schemaVersion field
+	schemaVersion int
+	// validateArgs, when set, checks schema-valid arguments for problems the schema does not express,
+	// such as mutually exclusive arguments; any issues reject the call as INVALID_INPUT
+	validateArgs func(input json.RawMessage) []ValidationIssue
 }
 
 // NewArxivToolHandler creates a new tool handler with the given schemas and handler function
@@ -85,32 +129,147 @@ func NewArxivToolHandler(inputSchema, outputSchema *jsonschema.Schema, handlerFu
 
 // Handle is the generic MCP handler that validates input, calls the handler function, and validates output
 func (h *ArxivToolHandler) Handle(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	// Validate input against schema
-	if err := unmarshalAndValidate(req.Params.Arguments, h.inputSchema); err != nil {
-		return mcp_tool_errorf("invalid input: %v", err), nil
+	start := time.Now()
+	toolName := req.Params.Name
+	info := newCallInfo(req)
+	ctx = withCallInfo(ctx, info)
+	// Arguments the client leaves out default to what was negotiated for its session
+	profile := sessionOutputProfile(req)
+	if profile.adjusted() {
+		params := *req.Params
+		params.Arguments = h.withDefaultArguments(params.Arguments, profile)
+		req = &mcp.CallToolRequest{Session: req.Session, Params: &params, Extra: req.Extra}
+	}
+
+	var result *mcp.CallToolResult
+	var outcome string
+	if h.coalesce {
+		result, outcome = h.coalesced(ctx, req)
+	} else {
+		result, outcome = h.admitAndHandle(ctx, req)
+	}
+	if outcome == "busy" {
+		metrics.ToolCallsTotal.WithLabelValues(toolName, outcome).Inc()
+		return result, nil
+	}
+	toolStats.record(toolName, time.Since(start), outcome)
+	toolStats.recordResponseSize(toolName, responseSize(result))
+
+	if outcome == "ok" && h.describeQuery != nil && info.tracked {
+		// Remember the query so that later calls in the same session can refer back to it
+		if query := h.describeQuery(req.Params.Arguments, unwrapOutput(result.StructuredContent)); query != nil {
+			query.Tool = toolName
+			query.Time = time.Now()
+			recentQueries.record(info.SessionID, *query)
+		}
+	}
+	if result.StructuredContent != nil && !wantsStructuredContent(req, profile) {
+		// Coalesced calls share their result, so leave it as it is for the others
+		textOnly := *result
+		textOnly.StructuredContent = nil
+		result = &textOnly
 	}
+	return result, nil
+}
+
+// responseSize is the size of the serialized output of a tool call, i.e., of its text content,
+// which the structured content of a successful call repeats
+func responseSize(result *mcp.CallToolResult) int {
+	size := 0
+	for _, content := range result.Content {
+		if text, ok := content.(*mcp.TextContent); ok {
+			size += len(text.Text)
+		}
+	}
+	return size
+}
+
+// admitAndHandle runs a call through admission control and the handler, returning its result and outcome
+func (h *ArxivToolHandler) admitAndHandle(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, string) {
+	// Reject rate-limited calls up front when they would queue for too long; estimates do not queue
+	if h.admission != nil && !h.estimateOnly(req.Params.Arguments) {
+		release, busyErr := h.admission.admit(req.Params.Name)
+		if busyErr != nil {
+			return mcp_tool_error(busyErr), "busy"
+		}
+		defer release()
+	}
+
+	result := h.handle(ctx, req)
+	if result.IsError {
+		if ctx.Err() != nil {
+			return result, "cancelled"
+		}
+		return result, "error"
+	}
+	return result, "ok"
+}
 
-	// Call the handler function
-	result, err := h.handlerFunc(ctx, req.Params.Arguments)
+// estimateOnly reports whether a call asks a tool supporting estimates for one, with arguments
+// that pass input validation
+func (h *ArxivToolHandler) estimateOnly(input json.RawMessage) bool {
+	if !h.supportsEstimate {
+		return false
+	}
+	args, err := checkUnknownFields(input, h.inputSchema.Schema())
+	return err == nil && unmarshalAndValidate(args, h.inputSchema) == nil && isEstimateOnly(args)
+}
+
+// handle validates the input, calls the handler function and validates its output
+func (h *ArxivToolHandler) handle(ctx context.Context, req *mcp.CallToolRequest) *mcp.CallToolResult {
+	// Validate input against schema, after rejecting or dropping the arguments it does not declare
+	args, err := checkUnknownFields(req.Params.Arguments, h.inputSchema.Schema())
 	if err != nil {
-		return mcp_tool_errorf("handler error: %v", err), nil
+		return mcp_tool_error(schemaInvalidInputError(err))
+	}
+	if err := unmarshalAndValidate(args, h.inputSchema); err != nil {
+		return mcp_tool_error(schemaInvalidInputError(err))
+	}
+	if h.validateArgs != nil {
+		if issues := h.validateArgs(args); len(issues) > 0 {
+			return mcp_tool_error(invalidInputError(issues))
+		}
+	}
+
+	// Call the handler function with the arguments the schema declares
+	result, err := h.handlerFunc(ctx, args)
+	if err != nil {
+		if cancelErr := cancelledToolError(ctx); cancelErr != nil {
+			return mcp_tool_error(cancelErr)
+		}
+		var toolErr *ToolError
+		if errors.As(err, &toolErr) {
+			return mcp_tool_error(toolErr)
+		}
+		return mcp_tool_error(executionToolError(err))
+	}
+
+	// Outputs linking to resources carry the links as content too, for clients to fetch them
+	var links []mcp.Content
+	if linker, ok := result.(resourceLinker); ok {
+		for _, link := range linker.resourceLinks() {
+			links = append(links, link)
+		}
+	}
+	if h.schemaVersion > 0 {
+		result = versionedOutput{output: result, version: h.schemaVersion}
 	}
 
 	// Marshal result to JSON
-	outputJSON, err := json.Marshal(result)
+	outputJSON, err := marshalOutput(result)
 	if err != nil {
-		return mcp_tool_errorf("output failed to marshal: %v", err), nil
+		return mcp_tool_errorf("output failed to marshal: %v", err)
 	}
 
 	// Validate output against schema
 	if err := unmarshalAndValidate(outputJSON, h.outputSchema); err != nil {
-		return mcp_tool_errorf("invalid output: %v", err), nil
+		return mcp_tool_errorf("invalid output: %v", err)
 	}
 
 	return &mcp.CallToolResult{
-		Content:           []mcp.Content{&mcp.TextContent{Text: string(outputJSON)}},
-		StructuredContent: result,
-	}, nil
+		Content:           append([]mcp.Content{&mcp.TextContent{Text: string(outputJSON)}}, links...),
+		StructuredContent: structuredOutput(result, outputJSON),
+	}
 }
 
 // categoryFetchLatest contains the handler function for fetching latest publications by category.
@@ -122,46 +281,197 @@ func categoryFetchLatest(ctx context.Context, input json.RawMessage) (any, error
 	if err := json.Unmarshal(input, &args); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
 	}
+	if args.RecordToLibrary && globalLibrary == nil {
+		return nil, errLibraryUnavailable
+	}
+	shape := entryShape{raw: args.Raw, maxAbstractLength: int(args.MaxAbstractLength), includeFields: args.IncludeFields, rawText: !normalizeText(args.NormalizeText)}
 
-	// Build search query for multiple categories
-	searchQuery, err := parser.ParseReconstructCategoryExpression(args.Category)
+	// A plain list of category codes is joined as asked; operators in the expression take precedence
+	expression, joined, err := parser.JoinCategoryList(args.Category, args.CategoryJoinStrategy)
+	if err != nil {
+		return nil, err
+	}
+	// Build search query for multiple categories, interleaved with any keywords and phrases
+	parse := parser.ParseMixedExpression
+	if args.ExpandRelated {
+		parse = parser.ParseMixedExpressionRelated
+	}
+	interpretation, err := parse(expression, args.KeywordField)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse category expression: %w", err)
 	}
+	if joined {
+		interpretation.JoinStrategy = cmp.Or(args.CategoryJoinStrategy, parser.JoinAnd)
+	} else if args.CategoryJoinStrategy != "" {
+		interpretation.Notes = append(interpretation.Notes, fmt.Sprintf("categoryJoinStrategy %s was ignored because the expression is not a plain list of category codes; its own operators and implicit AND decide the joining", args.CategoryJoinStrategy))
+	}
+	searchQuery := interpretation.Query
+
+	// Restrict the search to the submission window of the requested announcements
+	restriction, err := resolveDateRestriction(args)
+	if err != nil {
+		return nil, err
+	}
+	if restriction != nil {
+		if restriction.empty != nil {
+			result := processFeed(restriction.empty)
+			result.Interpretation = interpretation
+			if args.RecordToLibrary {
+				result.Library = &LibraryRecording{}
+			}
+			return shape.output(result), nil
+		}
+		searchQuery = "(" + searchQuery + "+AND+" + restriction.query + ")"
+	}
 
-	// Enforce rate limit: wait until we're allowed to make a request
-	// This ensures compliance with arXiv API terms (max 1 request per 3 seconds)
-	if err := arxivRateLimiter.Wait(ctx); err != nil {
-		return nil, fmt.Errorf("rate limiter error: %w", err)
+	// Fail fast while arXiv has asked for requests to be held back
+	if cooldownErr := arxivCooldown.check(); cooldownErr != nil {
+		return nil, cooldownErr
+	}
+	// Count the request against the daily quota, refusing it once the quota is used up
+	if err := takeArxivTurn(ctx, arxivRequestAPI); err != nil {
+		return nil, err
 	}
 
 	// Fetch contents from arXiv API
-	url := arxivApiEndpoint + "?search_query=" + searchQuery + "&start=" + fmt.Sprint(args.StartIndex) + "&max_results=" + fmt.Sprint(args.FetchSize) + "&sortBy=submittedDate&sortOrder=descending"
+	url := arxivQueryEndpoint + "?search_query=" + searchQuery + "&start=" + fmt.Sprint(args.StartIndex) + "&max_results=" + fmt.Sprint(args.FetchSize) +
+		"&sortBy=" + arxivSortBy(args.SortBy) + "&sortOrder=" + cmp.Or(args.SortOrder, sortOrderDescending)
 	slog.Info("Fetching Atom feed from arXiv", "url", url)
-	httpClient, err := internal.CreateConfiguredHTTPClient()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create configured HTTP client: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	resp, err := httpClient.Get(url)
+	timer := metrics.StartOperation(metrics.SlowArxivQuery)
+	// Transient failures are retried within the rate limit, if so configured
+	resp, err := internal.DoWithRetry(ctx, toolDeps.HTTPClient, req, arxivRetryPolicy(arxivRequestAPI))
 	if err != nil {
-		// Return error immediately - no retry logic
 		return nil, fmt.Errorf("failed to fetch from arXiv: %w", err)
 	}
 	defer resp.Body.Close()
+	clockSkew.Observe("arxiv", resp.Header, time.Now())
+	if cooldownErr := arxivCooldown.observe(resp); cooldownErr != nil {
+		return nil, cooldownErr
+	}
+	if err := checkArxivStatus(resp); err != nil {
+		return nil, err
+	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := internal.ReadAll(ctx, resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
+	timer.Done(int64(len(body)), "url", url)
+	// A call cancelled while the feed was read is not worth parsing
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
+	output, err := parseCategoryFeed(body, args.StrictParse)
+	if err != nil {
+		return nil, err
+	}
+	// Ranks are taken from arXiv's order before any stage drops or reorders entries
+	if args.SortBy == sortByRelevance {
+		rankByRelevance(output.Items, int(args.StartIndex))
+	}
+	if args.IncludeRawEntry {
+		attachRawEntries(body, output)
+	}
+	if restriction != nil {
+		restriction.apply(output)
+	}
+	if args.CollapseRevisions {
+		collapseRevisions(output)
+	}
+	// arXiv sorts by submission date for category relevance; the fetched page is reordered here
+	if args.SortBy == sortByCategoryRelevance {
+		rankByCategoryRelevance(output.Items, queryCategories(interpretation))
+	}
+	// Headlines are what is measured against the budget, while the full entries are grouped and recorded
+	entries := output.Items
+	if args.Fields == entryFieldsHeadline {
+		output.Items = headlineEntries(entries)
+	}
+	// Entries that do not fit the client's budget are left out before they are grouped or recorded
+	if args.MaxTokensHint > 0 {
+		output.Budget = fitToBudget(output, int(args.MaxTokensHint), args.GroupBy != "", shape.entry)
+	}
+	entries = entries[:len(output.Items)]
+	if args.GroupBy != "" {
+		output.Groups = groupEntries(entries, args.GroupBy, queryCategories(interpretation))
+	}
+	output.Interpretation = interpretation
+	if args.RecordToLibrary {
+		output.Library = recordFetchedMetadata(ctx, entries, args.Category, nil)
+	}
+
+	return shape.output(output), nil
+}
+
+// parseCategoryFeed parses an arXiv API Atom feed and runs its entries through the per-entry stages.
+// Only a feed that cannot be parsed at all is an error; problems with single entries are reported
+// on those entries.
+//
+// Unless strict, the body is first sanitized of the minor XML violations arXiv occasionally emits,
+// which would otherwise cost the whole page of results; the raw body is left untouched.
+func parseCategoryFeed(body []byte, strict bool) (*CategoryFetchResult, error) {
+	text := body
+	var sanitization FeedSanitization
+	if !strict {
+		text, sanitization = sanitizeFeedXML(body)
+		if sanitization.Altered() {
+			slog.Warn("Sanitized malformed XML in arXiv feed",
+				"invalid_characters", sanitization.InvalidCharacters,
+				"ampersands", sanitization.Ampersands)
+		}
+	}
 	fp := gofeed.NewParser()
-	output, err := fp.ParseString(string(body))
+	feed, err := fp.ParseString(string(text))
 	if err != nil {
-		// Return error immediately - no retry logic
 		return nil, fmt.Errorf("failed to parse feed: %w", err)
 	}
+	if rejection := arxivRejection(feed); rejection != nil {
+		return nil, rejection
+	}
+	result := processFeed(feed, feedEntryStages...)
+	result.Sanitized = sanitization.Altered()
+	result.Pagination = feedPagination(feed)
+	return result, nil
+}
 
-	return output, nil
+// arxivRejection returns the error arXiv reports, with HTTP 200, as the only entry of a feed when it
+// cannot answer a request, e.g., a search query it cannot parse, or nil if the feed is a result set.
+// The entry's identifier points into the API error documentation and its title is "Error".
+func arxivRejection(feed *gofeed.Feed) *ToolError {
+	if len(feed.Items) != 1 {
+		return nil
+	}
+	item := feed.Items[0]
+	if !strings.Contains(item.GUID, "api/errors") && strings.TrimSpace(item.Title) != "Error" {
+		return nil
+	}
+	message := strings.TrimSpace(item.Description)
+	if message == "" {
+		message = "no reason given"
+	}
+	details := map[string]any{"arxivMessage": message}
+	if item.Link != "" {
+		details["documentation"] = item.Link
+	}
+	return &ToolError{
+		Code:    ErrCodeArxivRejected,
+		Message: "arXiv rejected the request: " + message,
+		Details: details,
+	}
+}
+
+// describeCategoryFetch describes a category fetch as the category expression and the articles it returned
+func describeCategoryFetch(input json.RawMessage, output any) *recentQuery {
+	var args ArxivCategoryFetchLatestArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil
+	}
+	return &recentQuery{Query: args.Category, ArticleIDs: resultArticleIDs(output)}
 }
 
 // Group represents an arXiv archive or subject group
@@ -183,69 +493,126 @@ type Category struct {
 type Taxonomy struct {
 	Groups     map[string]Group    `json:"groups"`     // keyed by group code
 	Categories map[string]Category `json:"categories"` // keyed by category code
+	// Provenance tells live data from the embedded snapshot
+	Provenance *taxonomy.Provenance `json:"provenance,omitempty" jsonschema:"Where the taxonomy came from, live from arXiv or the snapshot embedded in the server, and its date"`
+}
+
+// Sources of the category taxonomy tool
+const (
+	taxonomySourceLive     = "live"
+	taxonomySourceEmbedded = "embedded"
+)
+
+// ArxivGetCategoryTaxonomyArgs defines the input parameters for the category taxonomy tool
+type ArxivGetCategoryTaxonomyArgs struct {
+	Source string `json:"source,omitempty"`
 }
 
-// deriveAreaCode converts arXiv area names to their standard codes
+// embeddedTaxonomy converts the embedded taxonomy snapshot to the output of the taxonomy tool. The
+// snapshot has no descriptions of single categories.
+func embeddedTaxonomy() Taxonomy {
+	snapshot := taxonomy.Embedded()
+	provenance := snapshot.Provenance()
+	result := Taxonomy{
+		Groups:     make(map[string]Group, len(snapshot.Groups)),
+		Categories: make(map[string]Category, len(snapshot.Categories)),
+		Provenance: &provenance,
+	}
+	for _, group := range snapshot.Groups {
+		result.Groups[group.Code] = Group{
+			Code:           group.Code,
+			Name:           group.Name,
+			Classification: group.Area,
+			Description:    group.Description,
+		}
+	}
+	for _, category := range snapshot.Categories {
+		result.Categories[category.Code] = Category{Code: category.Code, Name: category.Name}
+	}
+	return result
+}
+
+// deriveAreaCode converts arXiv area names to their standard codes using the embedded taxonomy snapshot
 // e.g., "Computer Science" → "cs", "Physics" → "physics"
 func deriveAreaCode(areaName string) string {
-	// Map of known area names to their codes
-	areaMap := map[string]string{
-		"Computer Science": "cs",
-		"Economics":        "econ",
-		"Electrical Engineering and Systems Science": "eess",
-		"Mathematics":          "math",
-		"Physics":              "physics",
-		"Quantitative Biology": "q-bio",
-		"Quantitative Finance": "q-fin",
-		"Statistics":           "stat",
-	}
-
-	if code, ok := areaMap[areaName]; ok {
+	if code, ok := taxonomy.Embedded().AreaCode(areaName); ok {
 		return code
 	}
 
-	// Fallback: convert to lowercase and remove spaces
+	// Fallback: convert to lowercase and replace spaces. This is unlikely to match a real
+	// arXiv code, so flag it as a sign that the embedded snapshot needs refreshing.
+	slog.Warn("arXiv area not found in embedded taxonomy snapshot", "area", areaName)
 	return strings.ToLower(strings.ReplaceAll(areaName, " ", "-"))
 }
 
 // deriveGroupCode extracts the group code from a category code
 // e.g., "cs.AI" → "cs", "astro-ph.CO" → "astro-ph", "hep-ph" → "hep-ph"
 func deriveGroupCode(categoryCode string) string {
-	// Find the first dot
-	if idx := strings.Index(categoryCode, "."); idx > 0 {
-		return categoryCode[:idx]
-	}
-	// No dot found, the entire code is the group
-	return categoryCode
+	return taxonomy.GroupForCategory(categoryCode)
 }
 
 // fetchCategoryTaxonomy fetches and parses the arXiv category taxonomy from the web.
 // Returns a Taxonomy structure with groups and categories in a flattened format.
 func fetchCategoryTaxonomy(ctx context.Context, input json.RawMessage) (any, error) {
-	const taxonomyURL = "https://arxiv.org/category_taxonomy"
+	var args ArxivGetCategoryTaxonomyArgs
+	if len(input) > 0 {
+		if err := json.Unmarshal(input, &args); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+		}
+	}
+	// The embedded snapshot is served without touching the network, for reproducible results
+	if args.Source == taxonomySourceEmbedded {
+		slog.Info("Returning the embedded arXiv category taxonomy snapshot", "snapshot_date", taxonomy.Embedded().SnapshotDate)
+		return embeddedTaxonomy(), nil
+	}
 
+	taxonomyURL := categoryTaxonomyURL
 	slog.Info("Fetching and parsing arXiv category taxonomy from", "url", taxonomyURL)
-	httpClient, err := internal.CreateConfiguredHTTPClient()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, taxonomyURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create configured HTTP client: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	resp, err := httpClient.Get(taxonomyURL)
+	timer := metrics.StartOperation(metrics.SlowTaxonomyFetch)
+	// The page is on arxiv.org, so the request and its retries wait their turn on the arXiv rate limiter
+	if err := waitForHost(ctx, taxonomyURL); err != nil {
+		return nil, err
+	}
+	resp, err := internal.DoWithRetry(ctx, toolDeps.HTTPClient, req, arxivRetryPolicy(""))
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch taxonomy: %w", err)
 	}
 	defer resp.Body.Close()
+	clockSkew.Observe("arxiv", resp.Header, time.Now())
 
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf("failed to fetch taxonomy: HTTP %d", resp.StatusCode)
 	}
 
 	// Parse HTML using goquery
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	page, err := internal.ReadAll(ctx, resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read taxonomy page: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	result, err := parseTaxonomyPage(page)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+		return nil, err
+	}
+	timer.Done(int64(len(page)), "url", taxonomyURL)
+
+	if len(result.Categories) == 0 {
+		return nil, fmt.Errorf("no categories found in taxonomy")
 	}
+	result.Provenance = &taxonomy.Provenance{Source: taxonomy.SourceLive, SnapshotDate: time.Now().UTC().Format(time.DateOnly)}
 
-	taxonomy := Taxonomy{
+	return result, nil
+}
+
+// extractTaxonomy reads the groups and categories off a parsed taxonomy page
+func extractTaxonomy(doc *goquery.Document) Taxonomy {
+	result := Taxonomy{
 		Groups:     make(map[string]Group),
 		Categories: make(map[string]Category),
 	}
@@ -262,6 +629,16 @@ func fetchCategoryTaxonomy(ctx context.Context, input json.RawMessage) (any, err
 		areaName := strings.TrimSpace(areaHeading.Text())
 		areaCode := deriveAreaCode(areaName)
 
+		// Paragraphs placed directly in the accordion body (rather than next to a category)
+		// describe the area-level group as a whole
+		var areaParagraphs []string
+		accordionBody.ChildrenFiltered("p").Each(func(_ int, p *goquery.Selection) {
+			if text := strings.TrimSpace(p.Text()); text != "" {
+				areaParagraphs = append(areaParagraphs, text)
+			}
+		})
+		areaDescription := strings.Join(areaParagraphs, "\n\n")
+
 		// Find all category entries within this area
 		accordionBody.Find("h4").Each(func(j int, categoryHeading *goquery.Selection) {
 			// Extract category code and name from h4
@@ -292,47 +669,78 @@ func fetchCategoryTaxonomy(ctx context.Context, input json.RawMessage) (any, err
 				seenGroups[groupCode] = true
 				// Determine group name
 				groupName := areaName
-				if groupCode != areaCode {
+				groupDescription := ""
+				if groupCode == areaCode {
+					groupDescription = areaDescription
+				} else {
 					// This is a sub-group within the area, try to derive a better name
 					// For single-category groups (like "hep-ph"), use the category name
 					groupName = categoryName
 				}
-				taxonomy.Groups[groupCode] = Group{
+				// Prefer the snapshot's name for known groups and fill in descriptions the page lacks
+				if snapshotGroup, ok := taxonomy.Embedded().Group(groupCode); ok {
+					groupName = snapshotGroup.Name
+					if groupDescription == "" {
+						groupDescription = snapshotGroup.Description
+					}
+				}
+				result.Groups[groupCode] = Group{
 					Code:           groupCode,
 					Name:           groupName,
 					Classification: areaName,
+					Description:    groupDescription,
 				}
 			}
 
 			// Add category
-			taxonomy.Categories[categoryCode] = Category{
+			result.Categories[categoryCode] = Category{
 				Code:        categoryCode,
 				Name:        categoryName,
 				Description: description,
 			}
 		})
 	})
-
-	if len(taxonomy.Categories) == 0 {
-		return nil, fmt.Errorf("no categories found in taxonomy")
-	}
-
-	return taxonomy, nil
+	return result
 }
 
 // ArxivDownloadPDFArgs defines the input parameters for downloading an arXiv PDF to S3 storage
 type ArxivDownloadPDFArgs struct {
-	ArticleURL string `json:"articleUrl" jsonschema:"The arXiv article URL to download (e.g., https://arxiv.org/abs/2601.05525 or https://arxiv.org/pdf/2601.05525)"`
+	ArticleURL string `json:"articleUrl,omitempty" jsonschema:"The arXiv article URL to download (e.g., https://arxiv.org/abs/2601.05525 or https://arxiv.org/pdf/2601.05525). Either this or articleId must be provided"`
+	ArticleID  string `json:"articleId,omitempty" jsonschema:"The arXiv identifier of the article to download, as a bare ID (e.g., 2601.05525v2), a citation (e.g., arXiv:2601.05525 [cs.CL]) or a DataCite DOI (e.g., 10.48550/arXiv.2601.05525). Either this or articleUrl must be provided"`
+	Async      bool   `json:"async,omitempty" jsonschema:"Queue the download in the background and return a jobId immediately instead of waiting for the transfer. Check on the job with the download_job_status tool"`
+	// GenerateSummary asks the calling client, through MCP sampling, for a summary stored next to the PDF
+	GenerateSummary bool `json:"generateSummary,omitempty" jsonschema:"After the download, ask this client through MCP sampling to summarize the article's abstract and store the summary as Markdown under the 'summaries/' prefix. Requires a client that supports sampling; a summary that cannot be generated never fails the download. Defaults to false"`
+	// OnCollision defaults to overwrite because an object name derived from an arXiv identifier
+	// names the same article, which is downloaded again to refresh it
+	OnCollision string `json:"onCollision,omitempty" jsonschema:"What to do when the object the PDF would be stored as already exists: overwrite replaces it, error fails with a CONFLICT error naming where the existing object was downloaded from, and rename stores the PDF under the name with a suffix of its SHA-256 digest. Defaults to overwrite"`
 }
 
 // ArxivDownloadPDFOutput defines the output structure for the PDF download operation
 type ArxivDownloadPDFOutput struct {
 	Success    bool   `json:"success" jsonschema:"Whether the download and upload operation was successful"`
 	Message    string `json:"message" jsonschema:"Status message describing the result of the operation"`
+	Input      string `json:"input,omitempty" jsonschema:"The article URL or identifier exactly as it was provided"`
+	ArticleID  string `json:"articleId,omitempty" jsonschema:"The canonical arXiv identifier the input was resolved to"`
 	ObjectName string `json:"objectName,omitempty" jsonschema:"The expected name/path of the object in the S3 bucket, which is the key if the upload was successful"`
-	Bucket     string `json:"bucket,omitempty" jsonschema:"The S3 bucket where the file was uploaded"`
-	Size       int64  `json:"size,omitempty" jsonschema:"Size of the uploaded file in bytes"`
-	ETag       string `json:"etag,omitempty" jsonschema:"ETag of the uploaded file for integrity verification"`
+	// RequestedObjectName is only present when the PDF was renamed to avoid a collision
+	RequestedObjectName string `json:"requestedObjectName,omitempty" jsonschema:"The name derived from the article identifier, when it was taken and onCollision=rename stored the PDF under objectName instead"`
+	Bucket              string `json:"bucket,omitempty" jsonschema:"The S3 bucket where the file was uploaded"`
+	Size                int64  `json:"size,omitempty" jsonschema:"Size of the uploaded file in bytes"`
+	ETag                string `json:"etag,omitempty" jsonschema:"ETag of the uploaded file for integrity verification"`
+	SHA256              string `json:"sha256,omitempty" jsonschema:"Lowercase hex-encoded SHA-256 digest of the uploaded file"`
+	// OriginalFilename and ServedArticleID come from the Content-Disposition header of the download
+	OriginalFilename  string `json:"originalFilename,omitempty" jsonschema:"The sanitized filename arXiv gave the PDF in its Content-Disposition header, also recorded in the object's original-filename metadata"`
+	ServedArticleID   string `json:"servedArticleId,omitempty" jsonschema:"The versioned arXiv identifier of the PDF that was actually served, as named by its filename; for an unversioned articleId this pins down the version that was stored"`
+	SummaryObjectName string `json:"summaryObjectName,omitempty" jsonschema:"The object the generated Markdown summary of the article was stored as, when generateSummary was set and the summary was generated"`
+	SummaryError      string `json:"summaryError,omitempty" jsonschema:"Why the summary requested with generateSummary was not generated; the PDF is stored regardless"`
+	// Coalesced is only present when another call was downloading the same article at the same time
+	Coalesced bool   `json:"coalesced,omitempty" jsonschema:"Whether the PDF was being downloaded by another call at the same time, whose result this is, so that arXiv was asked for it only once"`
+	JobID     string `json:"jobId,omitempty" jsonschema:"The background job the download was queued as, when async was set; the other upload fields are then reported by the download_job_status tool"`
+	// EstimatedDurationSeconds is only present for queued jobs once earlier downloads have been measured
+	EstimatedDurationSeconds float64          `json:"estimatedDurationSeconds,omitempty" jsonschema:"An estimate, not a promise, of the seconds until the queued job finishes, from the jobs ahead of it and the throughput of recent downloads; absent while no download has been measured"`
+	Timings                  *DownloadTimings `json:"timings,omitempty" jsonschema:"How long the download waited for and read from the origin and how long it took to write to S3, telling a slow origin from slow storage"`
+	// Attestation is only present when the server has a signing key configured
+	Attestation *attestation.Attestation `json:"attestation,omitempty" jsonschema:"Signed statement of the stored object's digest, size and source, present when the server has a signing key"`
 }
 
 // downloadPDFToS3 handles downloading an arXiv PDF and uploading it to S3 storage
@@ -342,58 +750,227 @@ func downloadPDFToS3(ctx context.Context, input json.RawMessage) (any, error) {
 		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
 	}
 
-	// Auto-convert Abs URL to PDF URL if needed
-	if strings.HasPrefix(args.ArticleURL, arxivAbsBaseURL) {
-		// Example: https://arxiv.org/abs/2301.00001 -> https://arxiv.org/pdf/2301.00001
-		parts := strings.Split(args.ArticleURL, "/")
-		identifier := parts[len(parts)-1]
-		args.ArticleURL = arxivPDFBaseURL + identifier
-		slog.Info("Auto-converted arXiv Abs URL to PDF URL", "abs_url", arxivAbsBaseURL+"/"+identifier, "pdf_url", args.ArticleURL)
+	// Resolve the URL, citation or DOI to a canonical arXiv identifier
+	if issues := downloadPDFIssues(args); len(issues) > 0 {
+		return nil, invalidInputError(issues)
+	}
+	rawInput := args.ArticleURL
+	if rawInput == "" {
+		rawInput = args.ArticleID
 	}
-	// Validate the PDF URL
-	if !strings.HasPrefix(args.ArticleURL, arxivPDFBaseURL) {
-		return nil, fmt.Errorf("invalid PDF URL: must start with %s", arxivPDFBaseURL)
+	articleID, err := arxivid.Parse(rawInput)
+	if err != nil {
+		return nil, fmt.Errorf("invalid article URL or identifier: %w", err)
 	}
 
-	// Extract filename from URL for object naming
-	// Example: https://arxiv.org/pdf/2301.00001.pdf -> 2301.00001.pdf
-	parts := strings.Split(args.ArticleURL, "/")
-	filename := parts[len(parts)-1]
-	if !strings.HasSuffix(filename, ".pdf") {
-		filename = filename + ".pdf"
+	// Example: https://arxiv.org/abs/2301.00001 -> https://arxiv.org/pdf/2301.00001
+	pdfURL := articleID.PDFURL(arxivPDFBaseURL)
+	if pdfURL != rawInput {
+		slog.Info("Resolved arXiv article input to PDF URL", "input", rawInput, "article_id", articleID.Canonical(), "pdf_url", pdfURL)
 	}
 
-	// Create object name with arxiv prefix for organisation
-	objectName := "arxiv/" + filename
+	onCollision, err := collisionPolicy(args.OnCollision, storage.CollisionOverwrite)
+	if err != nil {
+		return nil, err
+	}
 
 	// Check if S3 configuration is loaded
 	if globalS3Config == nil {
 		return nil, fmt.Errorf("S3 configuration not loaded. Please ensure OPUS_MCP_S3_ENDPOINT, OPUS_MCP_S3_ACCESS_KEY, and OPUS_MCP_S3_SECRET_KEY environment variables are set")
 	}
+	// Refuse before downloading anything if the upload would run out of space
+	if fullErr := storageCapacity.checkDownload(); fullErr != nil {
+		return nil, fullErr
+	}
+	// Refuse up front, also for background downloads, once today's arXiv requests are used up
+	if quotaErr := arxivQuota.check(); quotaErr != nil {
+		return nil, quotaErr
+	}
+	if cooldownErr := arxivCooldown.check(); cooldownErr != nil {
+		return nil, cooldownErr
+	}
+
+	// Name the object by the configured template
+	// Example: hep-th/9901001v1 -> arxiv/hep-th_9901001v1.pdf
+	var primaryCategory string
+	if objectNames.usesPrimaryCategory {
+		if primaryCategory, err = articlePrimaryCategory(ctx, articleID); err != nil {
+			return nil, fmt.Errorf("failed to name the object: %w", err)
+		}
+	}
+	objectName, err := pdfObjectName(articleID, primaryCategory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to name the object: %w", err)
+	}
+
+	// Record why the article is stored now, while the tool call is known
+	provenance := downloadProvenance(ctx, articleID.Base(), time.Now())
+	// The client that asked for a summary is the one to sample it from, also for background downloads
+	var summarizer *paperSummarizer
+	if args.GenerateSummary {
+		summarizer = newPaperSummarizer(ctx)
+	}
+	if args.Async {
+		if downloadJobs == nil {
+			return nil, fmt.Errorf("background downloads are not available")
+		}
+		job, err := downloadJobs.submit(DownloadJob{Input: rawInput, ArticleID: articleID.Canonical(), ObjectName: objectName}, func(ctx context.Context) (ArxivDownloadPDFOutput, error) {
+			return storePDF(ctx, rawInput, articleID, pdfURL, objectName, onCollision, provenance, summarizer)
+		})
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Queued arXiv PDF download", "job_id", job.JobID, "pdf_url", pdfURL, "object", objectName)
+		output := ArxivDownloadPDFOutput{
+			Success:    true,
+			Message:    fmt.Sprintf("Queued the download as job '%s'; check on it with the download_job_status tool", job.JobID),
+			Input:      rawInput,
+			ArticleID:  articleID.Canonical(),
+			ObjectName: objectName,
+			JobID:      job.JobID,
+		}
+		// The job itself is among the queued ones
+		status := downloadJobs.status()
+		if estimate, ok := downloadJobs.estimateCompletion(status.Queued + status.Running - 1); ok {
+			output.EstimatedDurationSeconds = math.Round(estimate.Seconds()*10) / 10
+			output.Message += fmt.Sprintf(", which is estimated to take about %s", estimate.Round(time.Second))
+		}
+		return output, nil
+	}
+	return storePDF(ctx, rawInput, articleID, pdfURL, objectName, onCollision, provenance, summarizer)
+}
 
+// storePDF downloads an arXiv PDF, uploads it to S3 and records it in the library index, together
+// with a summary of the article if a summarizer is given
+func storePDF(ctx context.Context, rawInput string, articleID arxivid.ID, pdfURL, objectName string, onCollision storage.CollisionPolicy, provenance *library.Provenance, summarizer *paperSummarizer) (ArxivDownloadPDFOutput, error) {
 	slog.Info("Starting arXiv PDF download to S3 storage",
-		"pdf_url", args.ArticleURL,
+		"pdf_url", pdfURL,
 		"bucket", S3_ARTICLES_BUCKET,
 		"object", objectName,
 		"endpoint", globalS3Config.Endpoint,
 		"insecure_tls", globalS3Config.InsecureSkipVerify)
 
-	// Download and upload to S3
-	uploadInfo, err := storage.DownloadURLToS3(ctx, args.ArticleURL, globalS3Config, S3_ARTICLES_BUCKET, objectName)
+	// Only the request to arXiv waits for the arXiv rate limiter and counts against the daily quota,
+	// not the upload to S3 or a download sharing the transfer of another
+	ctx = storage.WithBeforeRequest(ctx, func(ctx context.Context) error {
+		if err := waitForHost(ctx, pdfURL); err != nil {
+			return err
+		}
+		return arxivQuota.take(ctx, arxivRequestPDF)
+	})
+	// Download and upload to S3, recording why the article was stored in the object metadata
+	upload, err := urlUploader(ctx, pdfURL, globalS3Config, S3_ARTICLES_BUCKET, objectName, provenanceMetadata(provenance), onCollision)
 	if err != nil {
+		if policyErr := policyToolError(err); policyErr != nil {
+			return ArxivDownloadPDFOutput{}, policyErr
+		}
+		if conflictErr := conflictToolError(err); conflictErr != nil {
+			return ArxivDownloadPDFOutput{}, conflictErr
+		}
+		if inProgressErr := inProgressToolError(err); inProgressErr != nil {
+			return ArxivDownloadPDFOutput{}, inProgressErr
+		}
+		if storageErr := storageToolError(err); storageErr != nil {
+			return ArxivDownloadPDFOutput{}, storageErr
+		}
 		return ArxivDownloadPDFOutput{
 			Success:    false,
 			Message:    fmt.Sprintf("Failed to download and upload PDF: %v", err),
+			Input:      rawInput,
+			ArticleID:  articleID.Canonical(),
 			ObjectName: objectName,
 		}, err
 	}
 
-	return ArxivDownloadPDFOutput{
-		Success:    true,
-		Message:    fmt.Sprintf("Successfully downloaded arXiv PDF and uploaded to S3 bucket '%s' as '%s'", S3_ARTICLES_BUCKET, uploadInfo.Key),
-		ObjectName: uploadInfo.Key,
-		Bucket:     uploadInfo.Bucket,
-		Size:       uploadInfo.Size,
-		ETag:       uploadInfo.ETag,
-	}, nil
+	// The filename arXiv gave the PDF names the version it served, which an unversioned request leaves open
+	served, servedOK := servedArticleID(articleID, upload.OriginalFilename)
+	message := fmt.Sprintf("Successfully downloaded arXiv PDF and uploaded to S3 bucket '%s' as '%s'", S3_ARTICLES_BUCKET, upload.Key)
+	if upload.RequestedName != "" {
+		message += fmt.Sprintf(" because '%s' was taken", upload.RequestedName)
+	}
+	if upload.Coalesced {
+		message += ", shared with another call downloading it at the same time"
+	}
+	recordedID := articleID.Canonical()
+	if servedOK {
+		recordedID = served.Canonical()
+		if articleID.Version != 0 && served.Version != articleID.Version {
+			slog.Warn("arXiv served a different version than requested", "requested", articleID.Canonical(), "served", served.Canonical(), "filename", upload.OriginalFilename)
+			message += fmt.Sprintf("; note that arXiv served %s instead of the requested %s", served.Canonical(), articleID.Canonical())
+		}
+	} else if upload.OriginalFilename != "" {
+		slog.Info("Downloaded PDF filename does not name a version of the requested article", "article_id", articleID.Canonical(), "filename", upload.OriginalFilename)
+	}
+
+	// A summary is a by-product: failing to generate one never fails the download
+	var summaryObject, summaryError string
+	if summarizer != nil {
+		summarized := articleID
+		if servedOK {
+			summarized = served
+		}
+		if summaryObject, err = summarizer.summarize(ctx, summarized); err != nil {
+			slog.Warn("Failed to generate article summary", "article_id", summarized.Canonical(), "error", err)
+			summaryError = err.Error()
+			message += "; the summary was not generated"
+		}
+	}
+
+	if globalLibrary != nil {
+		if err := globalLibrary.Record(ctx, library.Entry{
+			ObjectName:    upload.Key,
+			RequestedName: upload.RequestedName,
+			Bucket:        upload.Bucket,
+			ArticleID:     recordedID,
+			SourceURL:     pdfURL,
+			SHA256:        upload.SHA256,
+			Size:          upload.Size,
+			Provenance:    provenance,
+			Summary:       summaryObject,
+		}); err != nil {
+			// The PDF is stored; a stale index is preferable to failing the whole download
+			slog.Warn("Failed to record stored article in the library index", "object", upload.Key, "error", err)
+		}
+	}
+
+	output := ArxivDownloadPDFOutput{
+		Success:             true,
+		Message:             message,
+		Input:               rawInput,
+		ArticleID:           articleID.Canonical(),
+		ObjectName:          upload.Key,
+		RequestedObjectName: upload.RequestedName,
+		Bucket:              upload.Bucket,
+		Size:                upload.Size,
+		ETag:                upload.ETag,
+		SHA256:              upload.SHA256,
+		OriginalFilename:    upload.OriginalFilename,
+		SummaryObjectName:   summaryObject,
+		SummaryError:        summaryError,
+		Coalesced:           upload.Coalesced,
+		Timings:             downloadTimings(upload.Timings),
+		Attestation:         attestUpload(globalSigner, upload, pdfURL, time.Now()),
+	}
+	if servedOK {
+		output.ServedArticleID = served.Canonical()
+	}
+	return output, nil
+}
+
+// servedArticleID returns the versioned identifier named by the filename of a downloaded PDF, e.g.,
+// 2301.00001v3.pdf, when it is a version of the requested article
+func servedArticleID(requested arxivid.ID, filename string) (arxivid.ID, bool) {
+	// Only the .pdf extension is removed, since old-style identifiers such as math.AG/0101001 contain a dot
+	stem := strings.TrimSuffix(filename, ".pdf")
+	if stem == "" {
+		return arxivid.ID{}, false
+	}
+	// Old-style identifiers cannot carry their slash in a filename
+	for _, candidate := range []string{stem, strings.Replace(stem, "_", "/", 1)} {
+		id, err := arxivid.Parse(candidate)
+		if err == nil && id.Version > 0 && id.Base() == requested.Base() {
+			return id, true
+		}
+	}
+	return arxivid.ID{}, false
 }
@@ -3,7 +3,21 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
+
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/calendar"
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/storage"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/time/rate"
 )
 
 // TestFetchCategoryTaxonomy tests the taxonomy fetcher against the real arXiv website.
@@ -74,6 +88,13 @@ func TestFetchCategoryTaxonomy(t *testing.T) {
 		}
 	}
 
+	// Verify group-level descriptions are populated for well-known groups
+	for _, groupCode := range []string{"cs", "math"} {
+		if group, ok := taxonomy.Groups[groupCode]; ok && group.Description == "" {
+			t.Errorf("expected group %q to have a non-empty description", groupCode)
+		}
+	}
+
 	// Verify minimum category counts
 	minCategories := 100 // Should have at least 100 total categories
 	if len(taxonomy.Categories) < minCategories {
@@ -133,3 +154,476 @@ func TestFetchCategoryTaxonomy(t *testing.T) {
 		}
 	}
 }
+
+// TestCategoryFetchLatestWithoutAnnouncement checks that days without an announcement return
+// an informative empty feed without querying arXiv
+func TestCategoryFetchLatestWithoutAnnouncement(t *testing.T) {
+	ctx := context.Background()
+
+	result, err := categoryFetchLatest(ctx, json.RawMessage(`{"category":"cs.CL","announcedOn":"2024-11-09"}`))
+	if err != nil {
+		t.Fatalf("categoryFetchLatest() unexpected error: %v", err)
+	}
+	feed, ok := result.(*CategoryFetchSummary)
+	if !ok {
+		t.Fatalf("expected *CategoryFetchSummary, got %T", result)
+	}
+	if len(feed.Items) != 0 {
+		t.Errorf("expected no items on a Saturday, got %d", len(feed.Items))
+	}
+	if feed.Custom["nextAnnouncement"] != "2024-11-10" {
+		t.Errorf("nextAnnouncement = %q, want 2024-11-10", feed.Custom["nextAnnouncement"])
+	}
+	if !strings.Contains(feed.Description, "2024-11-10") {
+		t.Errorf("description %q should name the next announcement date", feed.Description)
+	}
+
+	if _, err := categoryFetchLatest(ctx, json.RawMessage(`{"category":"cs.CL","announcedOn":"11/07/2024"}`)); err == nil {
+		t.Error("categoryFetchLatest() with a malformed announcedOn should fail")
+	}
+}
+
+// TestCategoryFetchLatestJoinStrategy checks that plain category lists are joined with the join
+// strategy, that expressions with operators ignore it and say so in the interpretation notes, and
+// that an invalid join strategy is refused before querying arXiv
+func TestCategoryFetchLatestJoinStrategy(t *testing.T) {
+	var queries []string
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("search_query"))
+		_, _ = w.Write([]byte(idListFeed([]string{"2410.01234"})))
+	})
+
+	tests := []struct {
+		input        string
+		wantQuery    string
+		wantStrategy string
+	}{
+		{`{"category":"cs.AI, cs.CL"}`, "(cat:cs.AI AND cat:cs.CL)", "AND"},
+		{`{"category":"cs.AI cs.CL","categoryJoinStrategy":"OR"}`, "(cat:cs.AI OR cat:cs.CL)", "OR"},
+		{`{"category":"cs.AI AND cs.CL","categoryJoinStrategy":"OR"}`, "(cat:cs.AI AND cat:cs.CL)", ""},
+	}
+	for _, tt := range tests {
+		queries = nil
+		output, err := categoryFetchLatest(context.Background(), json.RawMessage(tt.input))
+		if err != nil {
+			t.Fatalf("categoryFetchLatest(%s) unexpected error: %v", tt.input, err)
+		}
+		if len(queries) != 1 || queries[0] != tt.wantQuery {
+			t.Errorf("categoryFetchLatest(%s) queried %q, want %q", tt.input, queries, tt.wantQuery)
+		}
+		interpretation := output.(*CategoryFetchSummary).Interpretation
+		if interpretation.JoinStrategy != tt.wantStrategy {
+			t.Errorf("categoryFetchLatest(%s) join strategy = %q, want %q", tt.input, interpretation.JoinStrategy, tt.wantStrategy)
+		}
+		// An ignored join strategy is reported with the interpretation
+		ignored := strings.Contains(tt.input, "categoryJoinStrategy") && tt.wantStrategy == ""
+		if noted := len(interpretation.Notes) == 1 && strings.Contains(interpretation.Notes[0], "categoryJoinStrategy OR was ignored"); noted != ignored {
+			t.Errorf("categoryFetchLatest(%s) interpretation notes = %q, want a note only for an ignored join strategy", tt.input, interpretation.Notes)
+		}
+	}
+
+	_, err := categoryFetchLatest(context.Background(), json.RawMessage(`{"category":"cs.AI, cs.CL","categoryJoinStrategy":"XOR"}`))
+	if err == nil || !strings.Contains(err.Error(), "invalid category join strategy") {
+		t.Errorf("categoryFetchLatest() error = %v, want the join strategy to be refused", err)
+	}
+}
+
+// arxivErrorFeed is the feed arXiv answers a search query it cannot parse with, with HTTP 200
+const arxivErrorFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:opensearch="http://a9.com/-/spec/opensearch/1.1/">
+  <title type="html">ArXiv Query: search_query=cat:cs.AI+AND+&amp;id_list=&amp;start=0&amp;max_results=10</title>
+  <id>http://arxiv.org/api/Y6O1hqVqbnuH3cFsVaqG9PzCBY8</id>
+  <opensearch:totalResults>1</opensearch:totalResults>
+  <opensearch:startIndex>0</opensearch:startIndex>
+  <opensearch:itemsPerPage>1</opensearch:itemsPerPage>
+  <entry>
+    <id>http://arxiv.org/api/errors#malformed_search_query</id>
+    <title>Error</title>
+    <summary>malformed search query</summary>
+    <updated>2024-05-20T00:00:00-04:00</updated>
+    <link href="http://arxiv.org/api/errors#malformed_search_query" rel="alternate" type="text/html"/>
+    <author><name>arXiv api core</name></author>
+  </entry>
+</feed>`
+
+// TestCategoryFetchLatestArxivErrors checks that error feeds and error statuses of the arXiv API are
+// reported as errors rather than as results
+func TestCategoryFetchLatestArxivErrors(t *testing.T) {
+	status, feed := http.StatusOK, arxivErrorFeed
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(feed))
+	})
+
+	_, err := categoryFetchLatest(context.Background(), json.RawMessage(`{"category":"cs.AI"}`))
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeArxivRejected || toolErr.Retryable {
+		t.Fatalf("categoryFetchLatest() error = %v, want a non-retryable %s", err, ErrCodeArxivRejected)
+	}
+	if toolErr.Message != "arXiv rejected the request: malformed search query" || toolErr.Details["documentation"] != "http://arxiv.org/api/errors#malformed_search_query" {
+		t.Errorf("categoryFetchLatest() error = %+v, want arXiv's message and documentation link", toolErr)
+	}
+
+	status, feed = http.StatusInternalServerError, idListFeed([]string{"2410.01234"})
+	_, err = categoryFetchLatest(context.Background(), json.RawMessage(`{"category":"cs.AI"}`))
+	if err == nil || !strings.Contains(err.Error(), "arXiv returned HTTP 500") {
+		t.Errorf("categoryFetchLatest() error = %v, want the HTTP status reported", err)
+	}
+}
+
+// TestCategoryFetchLatestSortParameters checks that the chosen sort is sent to arXiv and that the
+// input schema refuses sorts that contradict the ranking or the date window
+func TestCategoryFetchLatestSortParameters(t *testing.T) {
+	var queries []string
+	fakeIDListAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		_, _ = w.Write([]byte(idListFeed([]string{"2410.01234"})))
+	})
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`{"category": "cs.CL"}`, "&sortBy=submittedDate&sortOrder=descending"},
+		{`{"category": "cs.CL", "sortBy": "lastUpdatedDate", "sortOrder": "ascending"}`, "&sortBy=lastUpdatedDate&sortOrder=ascending"},
+		{`{"category": "cs.CL", "sortBy": "relevance"}`, "&sortBy=relevance&sortOrder=descending"},
+		{`{"category": "cs.CL", "sortBy": "categoryRelevance"}`, "&sortBy=submittedDate&sortOrder=descending"},
+	}
+	for _, tt := range tests {
+		queries = nil
+		if _, err := categoryFetchLatest(context.Background(), json.RawMessage(tt.input)); err != nil {
+			t.Fatalf("categoryFetchLatest(%s) unexpected error: %v", tt.input, err)
+		}
+		if len(queries) != 1 || !strings.HasSuffix(queries[0], tt.want) {
+			t.Errorf("categoryFetchLatest(%s) queried %q, want a query ending in %q", tt.input, queries, tt.want)
+		}
+	}
+
+	_, handler, err := newCategoryFetchLatestTool()
+	if err != nil {
+		t.Fatalf("newCategoryFetchLatestTool() unexpected error: %v", err)
+	}
+	queries = nil
+	for _, input := range []string{
+		`{"category": "cs.CL", "sortBy": "citations"}`,
+		`{"category": "cs.CL", "sortOrder": "newest"}`,
+		`{"category": "cs.CL", "sortBy": "categoryRelevance", "sortOrder": "ascending"}`,
+		`{"category": "cs.CL", "weekOf": "2024-03-04", "sortBy": "relevance"}`,
+		`{"category": "cs.CL", "announcedOn": "2024-03-04", "sortOrder": "ascending"}`,
+	} {
+		if result := handler.handle(context.Background(), newTestCallToolRequest("arxiv_category_fetch_latest", input)); !result.IsError {
+			t.Errorf("handle(%s) = %+v, want an invalid input error", input, result)
+		}
+	}
+	if len(queries) != 0 {
+		t.Errorf("invalid sorts queried arXiv %d times, want none", len(queries))
+	}
+}
+
+// TestCategoryFetchLatestDateInputs checks that weekOf and monthOf are validated, mutually exclusive
+// with announcedOn, and that a period without announcements is reported without querying arXiv
+func TestCategoryFetchLatestDateInputs(t *testing.T) {
+	ctx := context.Background()
+	for _, input := range []string{
+		`{"category":"cs.LG","announcedOn":"2024-03-04","weekOf":"2024-03-04"}`,
+		`{"category":"cs.LG","weekOf":"2024-03-04","monthOf":"2024-03"}`,
+		`{"category":"cs.LG","announcedOn":"2024-03-04","monthOf":"2024-03"}`,
+	} {
+		if _, err := categoryFetchLatest(ctx, json.RawMessage(input)); err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+			t.Errorf("categoryFetchLatest(%s) error = %v, want the date inputs to be mutually exclusive", input, err)
+		}
+	}
+	for _, input := range []string{
+		`{"category":"cs.LG","weekOf":"2024-W10"}`,
+		`{"category":"cs.LG","monthOf":"2024-03-04"}`,
+	} {
+		if _, err := categoryFetchLatest(ctx, json.RawMessage(input)); err == nil {
+			t.Errorf("categoryFetchLatest(%s) should fail", input)
+		}
+	}
+
+	previous := announcementCalendar
+	t.Cleanup(func() { announcementCalendar = previous })
+	var err error
+	announcementCalendar, err = calendar.New([]string{"2024-12-23", "2024-12-24", "2024-12-25", "2024-12-26", "2024-12-29"})
+	if err != nil {
+		t.Fatalf("calendar.New() unexpected error: %v", err)
+	}
+	result, err := categoryFetchLatest(ctx, json.RawMessage(`{"category":"cs.LG","weekOf":"2024-12-25"}`))
+	if err != nil {
+		t.Fatalf("categoryFetchLatest() unexpected error: %v", err)
+	}
+	feed := result.(*CategoryFetchSummary)
+	if len(feed.Items) != 0 || feed.Custom["weekOf"] != "2024-12-25" {
+		t.Errorf("week of holidays returned %d items and custom fields %v, want an empty result naming the week", len(feed.Items), feed.Custom)
+	}
+}
+
+// TestDateRestrictionApply checks that date-restricted results are sorted deterministically,
+// deduplicated by article and tagged with the window used
+func TestDateRestrictionApply(t *testing.T) {
+	day, _ := calendar.ParseDate("2024-03-04")
+	period, ok := announcementCalendar.Week(day)
+	if !ok {
+		t.Fatal("expected announcements in the week of 2024-03-04")
+	}
+	restriction := periodRestriction("weekOf", "2024-03-04", period, ok)
+	if want := "submittedDate:[202403011900+TO+202403081900]"; restriction.query != want {
+		t.Errorf("query = %q, want %q", restriction.query, want)
+	}
+
+	entry := func(id, published string, errors ...string) *FeedEntry {
+		ts, _ := time.Parse(time.RFC3339, published)
+		return &FeedEntry{Item: &gofeed.Item{Link: "http://arxiv.org/abs/" + id, PublishedParsed: &ts}, ArticleID: id, Errors: errors}
+	}
+	result := &CategoryFetchResult{
+		Feed: &gofeed.Feed{},
+		Items: []*FeedEntry{
+			entry("2403.00002v1", "2024-03-04T10:00:00Z"),
+			entry("2403.00003v1", "2024-03-05T10:00:00Z"),
+			entry("2403.00001v1", "2024-03-04T10:00:00Z"),
+			entry("2403.00003v1", "2024-03-05T10:00:00Z", "duplicate with an error"),
+			entry("2403.00002v2", "2024-03-04T10:00:00Z"),
+		},
+		Warnings: 1,
+	}
+	restriction.apply(result)
+
+	var ids []string
+	for _, item := range result.Items {
+		ids = append(ids, item.ArticleID)
+	}
+	if got, want := strings.Join(ids, " "), "2403.00003v1 2403.00001v1 2403.00002v1 2403.00002v2"; got != want {
+		t.Errorf("entries = %s, want %s", got, want)
+	}
+	if result.Warnings != 0 {
+		t.Errorf("warnings = %d, want 0 after dropping the duplicate with an error", result.Warnings)
+	}
+	for name, want := range map[string]string{
+		"weekOf":            "2024-03-04",
+		"firstAnnouncement": "2024-03-04",
+		"lastAnnouncement":  "2024-03-10",
+		"windowStart":       "2024-03-01T19:00:00Z",
+		"windowEnd":         "2024-03-08T19:00:00Z",
+	} {
+		if result.Custom[name] != want {
+			t.Errorf("custom %s = %q, want %q", name, result.Custom[name], want)
+		}
+	}
+}
+
+// TestCategoryFetchLatestInterpretation checks that the result echoes how a category expression
+// mixed with keywords was turned into the arXiv search query
+func TestCategoryFetchLatestInterpretation(t *testing.T) {
+	ctx := context.Background()
+
+	result, err := categoryFetchLatest(ctx, json.RawMessage(`{"category":"cs.CL AND llm \"model evaluation\"","keywordField":"abs","announcedOn":"2024-11-09"}`))
+	if err != nil {
+		t.Fatalf("categoryFetchLatest() unexpected error: %v", err)
+	}
+	feed := result.(*CategoryFetchSummary)
+	if feed.Interpretation == nil {
+		t.Fatal("result has no interpretation")
+	}
+	if want := "(cat:cs.CL+AND+abs:llm+AND+abs:%22model+evaluation%22)"; feed.Interpretation.Query != want {
+		t.Errorf("interpretation query = %q, want %q", feed.Interpretation.Query, want)
+	}
+
+	data, err := json.Marshal(feed)
+	if err != nil {
+		t.Fatalf("failed to marshal result: %v", err)
+	}
+	for _, want := range []string{`"kind":"category"`, `"kind":"keyword"`, `"kind":"phrase"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("serialized result should contain %s, got %s", want, data)
+		}
+	}
+
+	if _, err := categoryFetchLatest(ctx, json.RawMessage(`{"category":"cs.CL llm","keywordField":"au"}`)); err == nil {
+		t.Error("categoryFetchLatest() with an invalid keywordField should fail")
+	}
+}
+
+// TestDownloadPDFPolicyViolation checks that downloads refused by the download policy are reported
+// as structured errors naming the policy, without contacting S3
+func TestDownloadPDFPolicyViolation(t *testing.T) {
+	withUnlimitedArxiv(t)
+	original := globalS3Config
+	t.Cleanup(func() { globalS3Config = original })
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	t.Setenv("OPUS_MCP_DOWNLOAD_ALLOWED_HOSTS", "example.org")
+
+	handler := newTestToolHandler(t, downloadPDFToS3)
+	result, err := handler.Handle(context.Background(), newTestCallToolRequest("arxiv_download_pdf", `{"articleId":"2405.12345"}`))
+	if err != nil {
+		t.Fatalf("Handle() returned protocol error: %v", err)
+	}
+	if !result.IsError {
+		t.Fatal("expected a policy violation error result")
+	}
+
+	var payload struct {
+		Error ToolError `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(resultText(t, result)), &payload); err != nil {
+		t.Fatalf("failed to unmarshal error payload: %v", err)
+	}
+	if payload.Error.Code != ErrCodePolicyViolation {
+		t.Errorf("error code = %q, want %q", payload.Error.Code, ErrCodePolicyViolation)
+	}
+	if payload.Error.Details["policy"] != storage.PolicyAllowedHosts || payload.Error.Details["host"] != "arxiv.org" {
+		t.Errorf("error details = %v, want the allowed-hosts policy and host arxiv.org", payload.Error.Details)
+	}
+}
+
+func TestServedArticleID(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested string
+		filename  string
+		want      string
+	}{
+		{"pins the version of an unversioned request", "2405.12345", "2405.12345v3.pdf", "2405.12345v3"},
+		{"confirms a versioned request", "2405.12345v2", "2405.12345v2.pdf", "2405.12345v2"},
+		{"reports a different version", "2405.12345v2", "2405.12345v3.pdf", "2405.12345v3"},
+		{"old-style identifier", "hep-th/9901001", "hep-th_9901001v2.pdf", "hep-th/9901001v2"},
+		{"old-style identifier with a subject class", "math.AG/0101001", "math.AG_0101001v2.pdf", "math.AG/0101001v2"},
+		{"old-style identifier with a subject class and no extension", "math.AG/0101001", "math.AG_0101001v2", "math.AG/0101001v2"},
+		{"unversioned filename", "2405.12345", "2405.12345.pdf", ""},
+		{"another article", "2405.12345", "2405.54321v1.pdf", ""},
+		{"title as filename", "2405.12345", "Attention Is All You Need.pdf", ""},
+		{"no filename", "2405.12345", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := servedArticleID(arxivid.MustParse(tt.requested), tt.filename)
+			if ok != (tt.want != "") {
+				t.Fatalf("servedArticleID(%s, %q) ok = %v, want %v", tt.requested, tt.filename, ok, tt.want != "")
+			}
+			if ok && got.Canonical() != tt.want {
+				t.Errorf("servedArticleID(%s, %q) = %s, want %s", tt.requested, tt.filename, got.Canonical(), tt.want)
+			}
+		})
+	}
+}
+
+// TestDownloadPDFReportsServedVersion checks that the filename arXiv gives a PDF pins down the
+// version stored for an unversioned request, in the output and the library index
+func TestDownloadPDFReportsServedVersion(t *testing.T) {
+	withUnlimitedArxiv(t)
+	originalConfig, originalLibrary, originalUploader := globalS3Config, globalLibrary, urlUploader
+	t.Cleanup(func() {
+		globalS3Config, globalLibrary, urlUploader = originalConfig, originalLibrary, originalUploader
+	})
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	globalLibrary = library.New(&library.MemoryStore{})
+	urlUploader = func(ctx context.Context, sourceURL string, config *storage.S3Config, bucketName, objectName string, metadata map[string]string, policy storage.CollisionPolicy) (storage.UploadResult, error) {
+		return storage.UploadResult{
+			UploadInfo:       minio.UploadInfo{Bucket: bucketName, Key: objectName, Size: 42},
+			OriginalFilename: "2405.12345v3.pdf",
+		}, nil
+	}
+
+	result, err := downloadPDFToS3(context.Background(), json.RawMessage(`{"articleId":"2405.12345"}`))
+	if err != nil {
+		t.Fatalf("downloadPDFToS3() unexpected error: %v", err)
+	}
+	output := result.(ArxivDownloadPDFOutput)
+	if output.ArticleID != "2405.12345" || output.ServedArticleID != "2405.12345v3" || output.OriginalFilename != "2405.12345v3.pdf" {
+		t.Errorf("output identifies the article as %s, served as %s from %q, want 2405.12345 served as 2405.12345v3", output.ArticleID, output.ServedArticleID, output.OriginalFilename)
+	}
+	entry, err := globalLibrary.Get(context.Background(), output.ObjectName)
+	if err != nil {
+		t.Fatalf("library Get() unexpected error: %v", err)
+	}
+	if entry.ArticleID != "2405.12345v3" {
+		t.Errorf("library entry article ID = %s, want the served version 2405.12345v3", entry.ArticleID)
+	}
+
+	// A versioned request served another version is still stored, but the mismatch is reported
+	result, err = downloadPDFToS3(context.Background(), json.RawMessage(`{"articleId":"2405.12345v2"}`))
+	if err != nil {
+		t.Fatalf("downloadPDFToS3() unexpected error: %v", err)
+	}
+	output = result.(ArxivDownloadPDFOutput)
+	if output.ServedArticleID != "2405.12345v3" || !strings.Contains(output.Message, "instead of the requested 2405.12345v2") {
+		t.Errorf("output served %s with message %q, want the version mismatch reported", output.ServedArticleID, output.Message)
+	}
+}
+
+// TestDownloadPDFCountsOnlyRequestsSent checks that a PDF download counts against the daily quota
+// only when its request to arXiv is sent, not when it shares another's transfer or is refused by the
+// rate limiter
+func TestDownloadPDFCountsOnlyRequestsSent(t *testing.T) {
+	withUnlimitedArxiv(t)
+	originalConfig, originalLibrary, originalUploader, originalQuota := globalS3Config, globalLibrary, urlUploader, arxivQuota
+	t.Cleanup(func() {
+		globalS3Config, globalLibrary, urlUploader, arxivQuota = originalConfig, originalLibrary, originalUploader, originalQuota
+	})
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	globalLibrary = nil
+	arxivQuota = newDailyQuota(0, nil, time.Now)
+	var coalesced bool
+	urlUploader = func(ctx context.Context, sourceURL string, config *storage.S3Config, bucketName, objectName string, metadata map[string]string, policy storage.CollisionPolicy) (storage.UploadResult, error) {
+		// Like the real uploader, a download sharing another's transfer sends no request
+		if !coalesced {
+			if err := storage.BeforeRequest(ctx); err != nil {
+				return storage.UploadResult{}, err
+			}
+		}
+		return storage.UploadResult{UploadInfo: minio.UploadInfo{Bucket: bucketName, Key: objectName, Size: 42}, Coalesced: coalesced}, nil
+	}
+	download := func(ctx context.Context) error {
+		_, err := downloadPDFToS3(ctx, json.RawMessage(`{"articleId":"2405.12345v1"}`))
+		return err
+	}
+
+	if err := download(context.Background()); err != nil {
+		t.Fatalf("downloadPDFToS3() unexpected error: %v", err)
+	}
+	coalesced = true
+	if err := download(context.Background()); err != nil {
+		t.Fatalf("downloadPDFToS3() sharing a transfer unexpected error: %v", err)
+	}
+	coalesced = false
+	// The only request of the hour has been made, so the deadline passes before the next one
+	toolDeps.ArxivLimiter = rate.NewLimiter(rate.Every(time.Hour), 1)
+	toolDeps.ArxivLimiter.Allow()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var toolErr *ToolError
+	if err := download(ctx); !errors.As(err, &toolErr) || toolErr.Code != ErrCodeRateLimited {
+		t.Errorf("downloadPDFToS3() refused by the rate limiter error = %v, want %s", err, ErrCodeRateLimited)
+	}
+	if used := arxivQuota.status().Used; used != 1 {
+		t.Errorf("requests counted = %d, want only the download that sent its request", used)
+	}
+}
+
+func TestHandleReportsCancelledCalls(t *testing.T) {
+	started := make(chan struct{})
+	handler := newTestToolHandler(t, func(ctx context.Context, input json.RawMessage) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, fmt.Errorf("failed to read response body: %w", ctx.Err())
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	result, err := handler.Handle(ctx, newTestCallToolRequest("test_tool", `{}`))
+	if err != nil {
+		t.Fatalf("Handle() unexpected error: %v", err)
+	}
+	var payload struct {
+		Error ToolError `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(resultText(t, result)), &payload); err != nil {
+		t.Fatalf("cancelled call result is not a structured error: %v", err)
+	}
+	if !result.IsError || payload.Error.Code != ErrCodeCancelled {
+		t.Errorf("cancelled call returned %s, want a %s error", resultText(t, result), ErrCodeCancelled)
+	}
+}
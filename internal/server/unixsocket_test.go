@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// socketDir returns a short temporary directory, since unix socket paths are limited to about a
+// hundred bytes
+func socketDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "opus")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestListenUnixSocketFiles(t *testing.T) {
+	dir := socketDir(t)
+	path := filepath.Join(dir, "stale.sock")
+
+	// A socket file left behind by a crashed server is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	listener, err := listenUnix(path, 0o660)
+	if err != nil {
+		t.Fatalf("listenUnix() over a stale socket unexpected error: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat socket: %v", err)
+	}
+	if info.Mode().Perm() != 0o660 {
+		t.Errorf("socket mode = %o, want 660", info.Mode().Perm())
+	}
+
+	// A socket in use by another server is not
+	if _, err := listenUnix(path, 0o600); err == nil {
+		t.Error("listenUnix() on a socket in use should fail")
+	}
+	listener.Close()
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file still exists after closing the listener: %v", err)
+	}
+
+	// Nor is any other file
+	regular := filepath.Join(dir, "regular")
+	if err := os.WriteFile(regular, []byte("data"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := listenUnix(regular, 0o600); err == nil {
+		t.Error("listenUnix() on a regular file should fail")
+	}
+	if _, err := os.Stat(regular); err != nil {
+		t.Errorf("listenUnix() removed a regular file: %v", err)
+	}
+	if _, err := listenUnix("", 0o600); err == nil {
+		t.Error("listenUnix() without a path should fail")
+	}
+}
+
+// TestUnixSocketRoundTrip serves the HTTP handler chain on a unix socket and calls a tool and the
+// health endpoint through it
+func TestUnixSocketRoundTrip(t *testing.T) {
+	path := filepath.Join(socketDir(t), "opus-mcp.sock")
+	listener, err := listenUnix(path, 0o600)
+	if err != nil {
+		t.Fatalf("listenUnix() unexpected error: %v", err)
+	}
+	server := mcp.NewServer(&mcp.Implementation{Name: "test-server", Version: "v0.0.1"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "echo"}, func(ctx context.Context, req *mcp.CallToolRequest, input struct{}) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "over the socket"}}}, nil, nil
+	})
+	httpServer := &http.Server{Handler: newHTTPHandler(server, false)}
+	go httpServer.Serve(listener)
+	defer httpServer.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	ctx := context.Background()
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.2.3"}, nil).Connect(ctx,
+		&mcp.StreamableClientTransport{Endpoint: "http://opus-mcp/mcp", HTTPClient: client}, nil)
+	if err != nil {
+		t.Fatalf("failed to connect over the unix socket: %v", err)
+	}
+	defer session.Close()
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "echo"})
+	if err != nil {
+		t.Fatalf("CallTool() unexpected error: %v", err)
+	}
+	if text := result.Content[0].(*mcp.TextContent).Text; text != "over the socket" {
+		t.Errorf("tool result = %q, want %q", text, "over the socket")
+	}
+
+	resp, err := client.Get("http://opus-mcp/health")
+	if err != nil {
+		t.Fatalf("GET /health over the unix socket unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("GET /health status = %d, want a health report", resp.StatusCode)
+	}
+}
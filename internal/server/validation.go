@@ -0,0 +1,268 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"opus-mcp/internal/arxivid"
+	"opus-mcp/internal/calendar"
+)
+
+// ErrCodeInvalidInput means the arguments match the input schema but are inconsistent with each other
+const ErrCodeInvalidInput = "INVALID_INPUT"
+
+// ValidationIssue is a problem with the arguments of a tool call that the input schema does not
+// express, such as mutually exclusive or co-dependent arguments
+type ValidationIssue struct {
+	// Fields are the arguments involved
+	Fields []string `json:"fields"`
+	// Message explains the problem in plain language
+	Message string `json:"message"`
+}
+
+// argsValidator adapts a check of typed tool arguments to the validateArgs hook of a tool handler.
+// Arguments that do not unmarshal are left to the handler function, which reports them.
+func argsValidator[T any](check func(args T) []ValidationIssue) func(input json.RawMessage) []ValidationIssue {
+	return func(input json.RawMessage) []ValidationIssue {
+		var args T
+		if err := json.Unmarshal(input, &args); err != nil {
+			return nil
+		}
+		return check(args)
+	}
+}
+
+// invalidInputError reports every validation issue of a call in a single structured error
+func invalidInputError(issues []ValidationIssue) *ToolError {
+	message := issues[0].Message
+	if len(issues) > 1 {
+		var b strings.Builder
+		fmt.Fprintf(&b, "the arguments have %d problems:", len(issues))
+		for i, issue := range issues {
+			fmt.Fprintf(&b, " (%d) %s;", i+1, issue.Message)
+		}
+		message = strings.TrimSuffix(b.String(), ";")
+	}
+	return &ToolError{
+		Code:    ErrCodeInvalidInput,
+		Message: message,
+		Details: map[string]any{"issues": issues},
+	}
+}
+
+// SchemaViolation is a constraint of the input schema that the arguments of a tool call break
+type SchemaViolation struct {
+	// Pointer is the JSON pointer of the offending argument, e.g., /fetchSize; an argument inside an
+	// array points to the array, and "" is the arguments as a whole
+	Pointer string `json:"pointer"`
+	// Constraint is the schema keyword that failed, e.g., type, maximum, enum or required
+	Constraint string `json:"constraint,omitempty"`
+	// SchemaPath locates the failing constraint in the input schema
+	SchemaPath string `json:"schemaPath,omitempty"`
+	Message    string `json:"message"`
+	// Suggestion is the declared argument an unknown one most likely means, e.g., fetchSize for
+	// fetchsize
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// SchemaValidationError is the failure of arguments to validate against an input schema, keeping
+// the violations the schema validator reports instead of only its prose
+type SchemaValidationError struct {
+	Violations []SchemaViolation
+	err        error
+}
+
+func (e *SchemaValidationError) Error() string {
+	return e.err.Error()
+}
+
+func (e *SchemaValidationError) Unwrap() error {
+	return e.err
+}
+
+// newSchemaValidationError extracts the violations from an error of jsonschema validation. The
+// validator stops at the first failing constraint and reports it as a chain of "validating <schema
+// path>" prefixes ending in "<keyword>: <detail>", so the violations are those of that constraint:
+// one for most keywords, one per property for required and unexpected additional properties.
+func newSchemaValidationError(err error) *SchemaValidationError {
+	rest := err.Error()
+	schemaPath := ""
+	for strings.HasPrefix(rest, "validating ") {
+		var path string
+		path, rest, _ = strings.Cut(strings.TrimPrefix(rest, "validating "), ": ")
+		if path != "root" {
+			schemaPath = path
+		}
+	}
+	pointer := instancePointer(schemaPath)
+	violation := func(pointer, constraint string) SchemaViolation {
+		return SchemaViolation{Pointer: pointer, Constraint: constraint, SchemaPath: schemaPath, Message: rest}
+	}
+
+	var violations []SchemaViolation
+	keyword, detail, found := strings.Cut(rest, ": ")
+	switch {
+	case strings.HasPrefix(rest, "unexpected additional properties "):
+		for _, name := range quotedNames(strings.TrimPrefix(rest, "unexpected additional properties ")) {
+			violations = append(violations, violation(pointer+"/"+escapePointerToken(name), "additionalProperties"))
+		}
+	case found && keyword == "required":
+		for _, name := range quotedNames(strings.TrimPrefix(detail, "missing properties: ")) {
+			violations = append(violations, violation(pointer+"/"+escapePointerToken(name), "required"))
+		}
+	case found && !strings.Contains(keyword, " "):
+		// dependentRequired["a"] names the property it depends on; the keyword is the same for all
+		keyword, _, _ = strings.Cut(keyword, "[")
+		violations = append(violations, violation(pointer, keyword))
+	}
+	if len(violations) == 0 {
+		violations = append(violations, violation(pointer, ""))
+	}
+	return &SchemaValidationError{Violations: violations, err: err}
+}
+
+// instancePointer converts the schema path of a constraint into the JSON pointer of the value it
+// applies to: every properties/<name> step is an object member, while combinators and conditions
+// apply to the same value. The index of an array item is not part of the path, so items stop at
+// the array, as do additional properties at their object.
+func instancePointer(schemaPath string) string {
+	var pointer strings.Builder
+	steps := strings.Split(strings.TrimPrefix(schemaPath, "/"), "/")
+	for i := 0; i < len(steps); i++ {
+		switch steps[i] {
+		case "properties":
+			if i+1 < len(steps) {
+				pointer.WriteString("/" + steps[i+1])
+				i++
+			}
+		case "allOf", "anyOf", "oneOf", "$defs", "definitions":
+			i++
+		case "items", "prefixItems", "additionalProperties", "patternProperties":
+			return pointer.String()
+		}
+	}
+	return pointer.String()
+}
+
+// quotedNames parses the property names the validator lists as a Go-quoted string slice, e.g.,
+// ["category" "ids"]
+func quotedNames(list string) []string {
+	var names []string
+	rest := strings.TrimPrefix(strings.TrimSpace(list), "[")
+	for {
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return names
+		}
+		name, _ := strconv.Unquote(quoted)
+		names = append(names, name)
+		rest = strings.TrimSpace(rest[len(quoted):])
+	}
+}
+
+// escapePointerToken escapes a property name as a token of a JSON pointer
+func escapePointerToken(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
+
+// schemaInvalidInputError reports arguments that break the input schema as INVALID_INPUT, listing
+// the violations in validationErrors so that clients can fix the arguments they point to
+func schemaInvalidInputError(err error) *ToolError {
+	var schemaErr *SchemaValidationError
+	if !errors.As(err, &schemaErr) {
+		// The arguments are not even a JSON object
+		return &ToolError{
+			Code:             ErrCodeInvalidInput,
+			Message:          "invalid input: " + err.Error(),
+			ValidationErrors: []SchemaViolation{{Pointer: "", Constraint: "type", Message: err.Error()}},
+		}
+	}
+	return &ToolError{
+		Code:             ErrCodeInvalidInput,
+		Message:          "invalid input: " + schemaErr.Error(),
+		ValidationErrors: schemaErr.Violations,
+	}
+}
+
+// joinFields lists argument names in prose, e.g., "announcedOn, weekOf and monthOf"
+func joinFields(fields []string) string {
+	if len(fields) == 1 {
+		return fields[0]
+	}
+	return strings.Join(fields[:len(fields)-1], ", ") + " and " + fields[len(fields)-1]
+}
+
+// categoryFetchIssues checks the date inputs of a category fetch: at most one of them may be set,
+// and dates must exist; the input schema already constrains the form of monthOf
+func categoryFetchIssues(args ArxivCategoryFetchLatestArgs) []ValidationIssue {
+	var issues []ValidationIssue
+	var set []string
+	for _, input := range []struct{ name, value string }{
+		{"announcedOn", args.AnnouncedOn},
+		{"weekOf", args.WeekOf},
+		{"monthOf", args.MonthOf},
+	} {
+		if input.value != "" {
+			set = append(set, input.name)
+		}
+	}
+	if len(set) > 1 {
+		issues = append(issues, ValidationIssue{
+			Fields:  set,
+			Message: fmt.Sprintf("%s are mutually exclusive: each selects a different announcement period, so set at most one of them", joinFields(set)),
+		})
+	}
+	for _, input := range []struct{ name, value string }{
+		{"announcedOn", args.AnnouncedOn},
+		{"weekOf", args.WeekOf},
+	} {
+		if input.value == "" {
+			continue
+		}
+		if _, err := calendar.ParseDate(input.value); err != nil {
+			issues = append(issues, ValidationIssue{
+				Fields:  []string{input.name},
+				Message: fmt.Sprintf("%s %q is not a valid date of the form YYYY-MM-DD", input.name, input.value),
+			})
+		}
+	}
+	return issues
+}
+
+// downloadPDFIssues checks that a PDF download names its article exactly once
+func downloadPDFIssues(args ArxivDownloadPDFArgs) []ValidationIssue {
+	switch {
+	case args.ArticleURL == "" && args.ArticleID == "":
+		return []ValidationIssue{{
+			Fields:  []string{"articleUrl", "articleId"},
+			Message: "neither articleUrl nor articleId is set: set one of them to name the article to download",
+		}}
+	case args.ArticleURL != "" && args.ArticleID != "":
+		return []ValidationIssue{{
+			Fields:  []string{"articleUrl", "articleId"},
+			Message: "articleUrl and articleId are mutually exclusive: both name the article to download, so set only one of them",
+		}}
+	}
+	return nil
+}
+
+// fetchByIDIssues rejects a fetch by ID none of whose identifiers can be parsed, which could not
+// query arXiv at all; lists with some valid identifiers are fetched, with the others resolved as
+// invalid
+func fetchByIDIssues(args ArxivFetchByIDArgs) []ValidationIssue {
+	var issues []ValidationIssue
+	for i, raw := range args.IDs {
+		_, err := arxivid.Parse(raw)
+		if err == nil {
+			return nil
+		}
+		issues = append(issues, ValidationIssue{
+			Fields:  []string{"ids"},
+			Message: fmt.Sprintf("ids[%d] %q is not an arXiv identifier (%v); expected a new-style identifier such as 2301.00001 or 2301.00001v2, or an old-style one such as cs/0112017", i, raw, err),
+		})
+	}
+	return issues
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestValidateArgsReportsEveryIssue checks that a call with two simultaneous problems is rejected
+// before the handler runs, with one INVALID_INPUT error that explains both in plain language
+func TestValidateArgsReportsEveryIssue(t *testing.T) {
+	_, handler, err := newCategoryFetchLatestTool()
+	if err != nil {
+		t.Fatalf("newCategoryFetchLatestTool() unexpected error: %v", err)
+	}
+	called := false
+	handler.handlerFunc = func(ctx context.Context, input json.RawMessage) (any, error) {
+		called = true
+		return nil, nil
+	}
+
+	result, err := handler.Handle(context.Background(), newTestCallToolRequest("arxiv_category_fetch_latest",
+		`{"category":"cs.LG","announcedOn":"2024-02-30","weekOf":"2024-03-04"}`))
+	if err != nil {
+		t.Fatalf("Handle() unexpected error: %v", err)
+	}
+	if !result.IsError || called {
+		t.Fatalf("Handle() = %s, want the call rejected before the handler runs", resultText(t, result))
+	}
+	var payload struct {
+		Error struct {
+			Code    string                       `json:"code"`
+			Message string                       `json:"message"`
+			Details map[string][]ValidationIssue `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(resultText(t, result)), &payload); err != nil {
+		t.Fatalf("failed to unmarshal error: %v", err)
+	}
+	if payload.Error.Code != ErrCodeInvalidInput {
+		t.Errorf("error code = %q, want %q", payload.Error.Code, ErrCodeInvalidInput)
+	}
+	wantMessage := `the arguments have 2 problems: ` +
+		`(1) announcedOn and weekOf are mutually exclusive: each selects a different announcement period, so set at most one of them; ` +
+		`(2) announcedOn "2024-02-30" is not a valid date of the form YYYY-MM-DD`
+	if payload.Error.Message != wantMessage {
+		t.Errorf("error message = %q, want %q", payload.Error.Message, wantMessage)
+	}
+	issues := payload.Error.Details["issues"]
+	if len(issues) != 2 || !slices.Equal(issues[0].Fields, []string{"announcedOn", "weekOf"}) || !slices.Equal(issues[1].Fields, []string{"announcedOn"}) {
+		t.Errorf("issues = %+v, want the conflicting date inputs and the invalid date", issues)
+	}
+}
+
+// TestSchemaValidationErrors checks that arguments breaking the input schema are rejected with the
+// JSON pointers of the offending arguments and the constraints they break
+func TestSchemaValidationErrors(t *testing.T) {
+	_, handler, err := newCategoryFetchLatestTool()
+	if err != nil {
+		t.Fatalf("newCategoryFetchLatestTool() unexpected error: %v", err)
+	}
+	_, fetchByID, err := newFetchByIDTool()
+	if err != nil {
+		t.Fatalf("newFetchByIDTool() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		handler *ArxivToolHandler
+		input   string
+		want    []SchemaViolation
+	}{
+		{
+			"Wrong-typed field",
+			handler,
+			`{"category": "cs.CL", "fetchSize": "ten"}`,
+			[]SchemaViolation{{Pointer: "/fetchSize", Constraint: "type", SchemaPath: "/properties/fetchSize"}},
+		},
+		{
+			"Out-of-range number",
+			handler,
+			`{"category": "cs.CL", "fetchSize": 500}`,
+			[]SchemaViolation{{Pointer: "/fetchSize", Constraint: "maximum", SchemaPath: "/properties/fetchSize"}},
+		},
+		{
+			"Missing required field",
+			handler,
+			`{"fetchSize": 5}`,
+			[]SchemaViolation{{Pointer: "/category", Constraint: "required"}},
+		},
+		{
+			"Conditional constraint",
+			handler,
+			`{"category": "cs.CL", "sortBy": "categoryRelevance", "sortOrder": "ascending"}`,
+			[]SchemaViolation{{Pointer: "/sortOrder", Constraint: "enum", SchemaPath: "/allOf/0/then/properties/sortOrder"}},
+		},
+		{
+			"Array item",
+			fetchByID,
+			`{"ids": ["2410.01234", 3]}`,
+			[]SchemaViolation{{Pointer: "/ids", Constraint: "type", SchemaPath: "/properties/ids/items"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.handler.handle(context.Background(), newTestCallToolRequest("test_tool", tt.input))
+			if !result.IsError {
+				t.Fatalf("handle() = %s, want an invalid input error", resultText(t, result))
+			}
+			var payload struct {
+				Error ToolError `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(resultText(t, result)), &payload); err != nil {
+				t.Fatalf("failed to unmarshal error: %v", err)
+			}
+			if payload.Error.Code != ErrCodeInvalidInput || payload.Error.Retryable {
+				t.Errorf("error = %+v, want a non-retryable %s", payload.Error, ErrCodeInvalidInput)
+			}
+			got := payload.Error.ValidationErrors
+			if len(got) != len(tt.want) {
+				t.Fatalf("validationErrors = %+v, want %+v", got, tt.want)
+			}
+			for i, violation := range got {
+				if violation.Message == "" {
+					t.Errorf("validationErrors[%d] has no message", i)
+				}
+				violation.Message = ""
+				if violation != tt.want[i] {
+					t.Errorf("validationErrors[%d] = %+v, want %+v", i, violation, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestInstancePointer(t *testing.T) {
+	tests := map[string]string{
+		"":                                     "",
+		"/properties/fetchSize":                "/fetchSize",
+		"/properties/rules/properties/confirm": "/rules/confirm",
+		"/allOf/1/then/properties/sortBy":      "/sortBy",
+		"/properties/ids/items":                "/ids",
+		"/properties/rules/additionalProperties/properties/x": "/rules",
+	}
+	for schemaPath, want := range tests {
+		if got := instancePointer(schemaPath); got != want {
+			t.Errorf("instancePointer(%q) = %q, want %q", schemaPath, got, want)
+		}
+	}
+}
+
+func TestDownloadPDFIssues(t *testing.T) {
+	tests := []struct {
+		args ArxivDownloadPDFArgs
+		want string
+	}{
+		{ArxivDownloadPDFArgs{ArticleID: "2405.12345"}, ""},
+		{ArxivDownloadPDFArgs{ArticleURL: "https://arxiv.org/abs/2405.12345"}, ""},
+		{ArxivDownloadPDFArgs{}, "neither articleUrl nor articleId is set: set one of them to name the article to download"},
+		{ArxivDownloadPDFArgs{ArticleID: "2405.12345", ArticleURL: "https://arxiv.org/abs/2405.12345"}, "articleUrl and articleId are mutually exclusive: both name the article to download, so set only one of them"},
+	}
+	for _, tt := range tests {
+		issues := downloadPDFIssues(tt.args)
+		if tt.want == "" {
+			if len(issues) != 0 {
+				t.Errorf("downloadPDFIssues(%+v) = %+v, want no issues", tt.args, issues)
+			}
+			continue
+		}
+		if len(issues) != 1 || issues[0].Message != tt.want {
+			t.Errorf("downloadPDFIssues(%+v) = %+v, want %q", tt.args, issues, tt.want)
+		}
+		if err := invalidInputError(issues); err.Message != tt.want || err.Code != ErrCodeInvalidInput {
+			t.Errorf("invalidInputError() of a single issue = %v, want the issue's message", err)
+		}
+	}
+}
+
+func TestFetchByIDIssues(t *testing.T) {
+	// A list with one valid identifier is fetched, the others resolving as invalid
+	if issues := fetchByIDIssues(ArxivFetchByIDArgs{IDs: []string{"not-an-id", "cs/0112017v2"}}); len(issues) != 0 {
+		t.Errorf("fetchByIDIssues() = %+v, want no issues with a valid identifier", issues)
+	}
+	if issues := fetchByIDIssues(ArxivFetchByIDArgs{IDs: []string{"2301.00001"}}); len(issues) != 0 {
+		t.Errorf("fetchByIDIssues() = %+v, want no issues", issues)
+	}
+
+	issues := fetchByIDIssues(ArxivFetchByIDArgs{IDs: []string{"2301.1", "cs/01"}})
+	if len(issues) != 2 {
+		t.Fatalf("fetchByIDIssues() = %+v, want an issue per malformed identifier", issues)
+	}
+	for i, want := range []string{`ids[0] "2301.1" is not an arXiv identifier`, `ids[1] "cs/01" is not an arXiv identifier`} {
+		if !strings.HasPrefix(issues[i].Message, want) || !strings.Contains(issues[i].Message, "such as 2301.00001") {
+			t.Errorf("issue %d = %q, want it to start with %q and give examples", i, issues[i].Message, want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"opus-mcp/internal/attestation"
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/settings"
+	"opus-mcp/internal/storage"
+)
+
+const (
+	// webObjectPrefix is the bucket prefix under which generic URL downloads are stored
+	webObjectPrefix = "web/"
+	// maxWebObjectNameLength caps caller-chosen object names, well below the S3 key limit of 1024 bytes
+	maxWebObjectNameLength = 512
+)
+
+// GenericDownloadConfig holds the generic URL download configuration loaded from environment variables
+type GenericDownloadConfig struct {
+	// Enabled exposes the url_download_to_storage tool; it is off by default because it lets clients
+	// store arbitrary content from any allowlisted host
+	Enabled bool `env:"OPUS_MCP_ENABLE_GENERIC_DOWNLOAD,default=false"`
+}
+
+// genericDownloadEnabled is whether the url_download_to_storage tool is registered
+var genericDownloadEnabled bool
+
+// LoadGenericDownloadConfig loads the generic URL download configuration from environment variables
+func LoadGenericDownloadConfig() (*GenericDownloadConfig, error) {
+	var config GenericDownloadConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process generic download configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// URLDownloadArgs defines the input parameters for downloading a URL to S3 storage
+type URLDownloadArgs struct {
+	URL        string `json:"url" jsonschema:"The http or https URL to download. The host must be allowed by OPUS_MCP_DOWNLOAD_ALLOWED_HOSTS"`
+	ObjectName string `json:"objectName" jsonschema:"The name to store the download under, relative to the 'web/' prefix (e.g., supplements/2405.12345/data.zip). Characters other than letters, digits, '.', '_', '-' and '/' are replaced with '_'"`
+	// OnCollision defaults to error because two sites can serve different files under the same name
+	OnCollision string `json:"onCollision,omitempty" jsonschema:"What to do when an object with the name already exists: error fails with a CONFLICT error naming where the existing object was downloaded from, overwrite replaces it, and rename stores the download under the name with a suffix of its SHA-256 digest. Defaults to error"`
+}
+
+// URLDownloadOutput defines the output structure for the URL download operation
+type URLDownloadOutput struct {
+	Success    bool   `json:"success" jsonschema:"Whether the download and upload operation was successful"`
+	Message    string `json:"message" jsonschema:"Status message describing the result of the operation"`
+	SourceURL  string `json:"sourceUrl" jsonschema:"The URL that was downloaded"`
+	ObjectName string `json:"objectName,omitempty" jsonschema:"The sanitized name/path of the object in the S3 bucket, including the 'web/' prefix"`
+	// RequestedObjectName is only present when the download was renamed to avoid a collision
+	RequestedObjectName string           `json:"requestedObjectName,omitempty" jsonschema:"The sanitized name that was asked for, when it was taken and onCollision=rename stored the download under objectName instead"`
+	Bucket              string           `json:"bucket,omitempty" jsonschema:"The S3 bucket where the file was uploaded"`
+	Size                int64            `json:"size,omitempty" jsonschema:"Size of the uploaded file in bytes"`
+	ETag                string           `json:"etag,omitempty" jsonschema:"ETag of the uploaded file for integrity verification"`
+	SHA256              string           `json:"sha256,omitempty" jsonschema:"Lowercase hex-encoded SHA-256 digest of the uploaded file"`
+	Coalesced           bool             `json:"coalesced,omitempty" jsonschema:"Whether the URL was being downloaded to the same object by another call at the same time, whose result this is, so that it was downloaded only once"`
+	Timings             *DownloadTimings `json:"timings,omitempty" jsonschema:"How long the download waited for and read from the origin and how long it took to write to S3, telling a slow origin from slow storage"`
+	// Attestation is only present when the server has a signing key configured
+	Attestation *attestation.Attestation `json:"attestation,omitempty" jsonschema:"Signed statement of the stored object's digest, size and source, present when the server has a signing key"`
+}
+
+// sanitizeWebObjectName turns a caller-chosen object name into a key under the web/ prefix.
+// Characters outside a conservative set are replaced with '_', and names that are empty, absolute
+// or contain empty, '.' or '..' segments are refused with a *storage.KeyError, so that the key
+// cannot escape the prefix.
+func sanitizeWebObjectName(name string) (string, error) {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-', r == '/':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	sanitized := b.String()
+	if err := storage.ValidateObjectKey(sanitized, storage.KeyRules{MaxLength: maxWebObjectNameLength}); err != nil {
+		return "", err
+	}
+	return webObjectPrefix + sanitized, nil
+}
+
+// downloadURLToS3 handles downloading an allowlisted URL and uploading it to S3 storage under the
+// web/ prefix
+func downloadURLToS3(ctx context.Context, input json.RawMessage) (any, error) {
+	var args URLDownloadArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal arguments: %w", err)
+	}
+
+	sourceURL, err := url.Parse(args.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if sourceURL.Scheme != "http" && sourceURL.Scheme != "https" {
+		return nil, fmt.Errorf("URL scheme must be http or https, got %q", sourceURL.Scheme)
+	}
+	objectName, err := sanitizeWebObjectName(args.ObjectName)
+	if err != nil {
+		if keyErr := objectKeyToolError("objectName", err); keyErr != nil {
+			return nil, keyErr
+		}
+		return nil, err
+	}
+	onCollision, err := collisionPolicy(args.OnCollision, storage.CollisionError)
+	if err != nil {
+		return nil, err
+	}
+
+	if globalS3Config == nil {
+		return nil, fmt.Errorf("S3 configuration not loaded. Please ensure OPUS_MCP_S3_ENDPOINT, OPUS_MCP_S3_ACCESS_KEY, and OPUS_MCP_S3_SECRET_KEY environment variables are set")
+	}
+	// Refuse before downloading anything if the upload would run out of space
+	if fullErr := storageCapacity.checkDownload(); fullErr != nil {
+		return nil, fullErr
+	}
+
+	slog.Info("Starting URL download to S3 storage",
+		"url", args.URL,
+		"bucket", S3_ARTICLES_BUCKET,
+		"object", objectName,
+		"endpoint", globalS3Config.Endpoint)
+
+	// The download policy is enforced by the uploader on the URL, every connection and every redirect
+	provenance := downloadProvenance(ctx, "", time.Now())
+	// A request to arxiv.org waits for the arXiv rate limiter like the arXiv tools do
+	ctx = storage.WithBeforeRequest(ctx, func(ctx context.Context) error {
+		return waitForHost(ctx, args.URL)
+	})
+	upload, err := urlUploader(ctx, args.URL, globalS3Config, S3_ARTICLES_BUCKET, objectName, provenanceMetadata(provenance), onCollision)
+	auditWebDownload(ctx, args.URL, objectName, upload, err)
+	if err != nil {
+		if policyErr := policyToolError(err); policyErr != nil {
+			return nil, policyErr
+		}
+		if conflictErr := conflictToolError(err); conflictErr != nil {
+			return nil, conflictErr
+		}
+		if inProgressErr := inProgressToolError(err); inProgressErr != nil {
+			return nil, inProgressErr
+		}
+		if storageErr := storageToolError(err); storageErr != nil {
+			return nil, storageErr
+		}
+		return URLDownloadOutput{
+			Success:    false,
+			Message:    fmt.Sprintf("Failed to download and upload URL: %v", err),
+			SourceURL:  args.URL,
+			ObjectName: objectName,
+		}, err
+	}
+
+	if globalLibrary != nil {
+		if err := globalLibrary.Record(ctx, library.Entry{
+			ObjectName:    upload.Key,
+			RequestedName: upload.RequestedName,
+			Bucket:        upload.Bucket,
+			SourceURL:     args.URL,
+			SHA256:        upload.SHA256,
+			Size:          upload.Size,
+			Provenance:    provenance,
+		}); err != nil {
+			// The object is stored; a stale index is preferable to failing the whole download
+			slog.Warn("Failed to record stored object in the library index", "object", upload.Key, "error", err)
+		}
+	}
+
+	message := fmt.Sprintf("Successfully downloaded URL and uploaded to S3 bucket '%s' as '%s'", S3_ARTICLES_BUCKET, upload.Key)
+	if upload.RequestedName != "" {
+		message += fmt.Sprintf(" because '%s' was taken", upload.RequestedName)
+	}
+	if upload.Coalesced {
+		message += ", shared with another call downloading it at the same time"
+	}
+	return URLDownloadOutput{
+		Success:             true,
+		Message:             message,
+		SourceURL:           args.URL,
+		ObjectName:          upload.Key,
+		RequestedObjectName: upload.RequestedName,
+		Bucket:              upload.Bucket,
+		Size:                upload.Size,
+		ETag:                upload.ETag,
+		SHA256:              upload.SHA256,
+		Coalesced:           upload.Coalesced,
+		Timings:             downloadTimings(upload.Timings),
+		Attestation:         attestUpload(globalSigner, upload, args.URL, time.Now()),
+	}, nil
+}
+
+// auditWebDownload records a download of an arbitrary URL in the audit log, whether it succeeded or
+// failed, since the URL is chosen by the client rather than resolved from an arXiv identifier
+func auditWebDownload(ctx context.Context, sourceURL, objectName string, upload storage.UploadResult, uploadErr error) {
+	if globalAuditLog == nil {
+		return
+	}
+	info, _ := callInfoFrom(ctx)
+	record := library.AuditRecord{
+		Action:    "web_download",
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Tool:      info.Tool,
+		SessionID: info.SessionID,
+		Client:    info.Client,
+		ClientID:  info.ClientID,
+		Source:    sourceURL,
+	}
+	if uploadErr != nil {
+		record.Failed = []string{objectName}
+	} else {
+		record.Objects = []string{upload.Key}
+		record.Bytes = upload.Size
+	}
+	// The audit log is updated even if the call was cancelled meanwhile
+	if err := globalAuditLog.Append(context.WithoutCancel(ctx), record); err != nil {
+		slog.Warn("Failed to record the download in the audit log", "url", sourceURL, "object", objectName, "error", err)
+	}
+}
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"opus-mcp/internal/library"
+	"opus-mcp/internal/storage"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestSanitizeWebObjectName(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"plain name", "data.zip", "web/data.zip", false},
+		{"nested name", "supplements/2405.12345/data-v2_final.tar.gz", "web/supplements/2405.12345/data-v2_final.tar.gz", false},
+		{"surrounding whitespace", "  data.zip ", "web/data.zip", false},
+		{"spaces and punctuation", "my file (1).pdf", "web/my_file__1_.pdf", false},
+		{"non-ASCII characters", "résumé.pdf", "web/r_sum_.pdf", false},
+		{"query-like characters", "a?b=c&d#e", "web/a_b_c_d_e", false},
+		{"backslash is not a separator", `..\..\etc\passwd`, "web/.._.._etc_passwd", false},
+		{"empty", "", "", true},
+		{"whitespace only", "   ", "", true},
+		{"absolute path", "/etc/passwd", "", true},
+		{"parent segment", "../arxiv/2405.12345.pdf", "", true},
+		{"nested parent segment", "a/../../b", "", true},
+		{"current segment", "a/./b", "", true},
+		{"empty segment", "a//b", "", true},
+		{"trailing slash", "dir/", "", true},
+		{"dot only", ".", "", true},
+		{"too long", string(make([]byte, maxWebObjectNameLength+1)), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sanitizeWebObjectName(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sanitizeWebObjectName(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("sanitizeWebObjectName(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadURLToS3AllowedHost(t *testing.T) {
+	originalConfig, originalLibrary, originalUploader := globalS3Config, globalLibrary, urlUploader
+	t.Cleanup(func() {
+		globalS3Config, globalLibrary, urlUploader = originalConfig, originalLibrary, originalUploader
+	})
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	globalLibrary = library.New(&library.MemoryStore{})
+
+	var uploadedURL, uploadedObject string
+	urlUploader = func(ctx context.Context, sourceURL string, config *storage.S3Config, bucketName, objectName string, metadata map[string]string, policy storage.CollisionPolicy) (storage.UploadResult, error) {
+		uploadedURL, uploadedObject = sourceURL, objectName
+		return storage.UploadResult{UploadInfo: minio.UploadInfo{Bucket: bucketName, Key: objectName, Size: 7}, SHA256: "abc123"}, nil
+	}
+
+	sourceURL := "https://github.com/example/project/releases/download/v1.0/data set.zip"
+	output, err := downloadURLToS3(context.Background(), json.RawMessage(mustMarshal(t, URLDownloadArgs{URL: sourceURL, ObjectName: "project/data set.zip"})))
+	if err != nil {
+		t.Fatalf("downloadURLToS3() unexpected error: %v", err)
+	}
+	got := output.(URLDownloadOutput)
+	if !got.Success || got.ObjectName != "web/project/data_set.zip" || got.SHA256 != "abc123" {
+		t.Errorf("downloadURLToS3() = %+v, want a successful upload as web/project/data_set.zip", got)
+	}
+	if uploadedURL != sourceURL || uploadedObject != "web/project/data_set.zip" {
+		t.Errorf("uploaded %q as %q, want the source URL under the sanitized name", uploadedURL, uploadedObject)
+	}
+
+	entry, err := globalLibrary.Get(context.Background(), "web/project/data_set.zip")
+	if err != nil {
+		t.Fatalf("library entry missing after download: %v", err)
+	}
+	if entry.SourceURL != sourceURL || entry.ArticleID != "" || entry.Provenance == nil {
+		t.Errorf("library entry = %+v, want the source URL, no article ID and provenance", entry)
+	}
+}
+
+func TestDownloadURLToS3CollisionPolicy(t *testing.T) {
+	originalConfig, originalLibrary, originalUploader, originalAudit := globalS3Config, globalLibrary, urlUploader, globalAuditLog
+	t.Cleanup(func() {
+		globalS3Config, globalLibrary, urlUploader, globalAuditLog = originalConfig, originalLibrary, originalUploader, originalAudit
+	})
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	globalLibrary = library.New(&library.MemoryStore{})
+	globalAuditLog = library.NewAuditLog(&library.MemoryStore{})
+
+	// The fake store already holds web/paper.pdf, downloaded from another site
+	const taken, renamed = "web/paper.pdf", "web/paper-5d41402abc4b.pdf"
+	var policies []storage.CollisionPolicy
+	urlUploader = func(ctx context.Context, sourceURL string, config *storage.S3Config, bucketName, objectName string, metadata map[string]string, policy storage.CollisionPolicy) (storage.UploadResult, error) {
+		policies = append(policies, policy)
+		switch policy {
+		case storage.CollisionError:
+			return storage.UploadResult{}, &storage.ConflictError{Bucket: bucketName, ObjectName: objectName, SourceURL: "https://example.org/paper.pdf"}
+		case storage.CollisionRename:
+			return storage.UploadResult{UploadInfo: minio.UploadInfo{Bucket: bucketName, Key: renamed}, RequestedName: objectName}, nil
+		}
+		return storage.UploadResult{UploadInfo: minio.UploadInfo{Bucket: bucketName, Key: objectName}}, nil
+	}
+
+	sourceURL := "https://github.com/example/project/releases/download/v2.0/paper.pdf"
+	_, err := downloadURLToS3(context.Background(), json.RawMessage(mustMarshal(t, URLDownloadArgs{URL: sourceURL, ObjectName: "paper.pdf"})))
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeConflict || toolErr.Details["sourceUrl"] != "https://example.org/paper.pdf" {
+		t.Fatalf("downloadURLToS3() by default error = %v, want %s naming the existing object's source", err, ErrCodeConflict)
+	}
+
+	output, err := downloadURLToS3(context.Background(), json.RawMessage(mustMarshal(t, URLDownloadArgs{URL: sourceURL, ObjectName: "paper.pdf", OnCollision: "rename"})))
+	if err != nil {
+		t.Fatalf("downloadURLToS3() renaming unexpected error: %v", err)
+	}
+	if got := output.(URLDownloadOutput); got.ObjectName != renamed || got.RequestedObjectName != taken {
+		t.Errorf("downloadURLToS3() renaming = %+v, want %s requested as %s", got, renamed, taken)
+	}
+	entry, err := globalLibrary.Get(context.Background(), renamed)
+	if err != nil {
+		t.Fatalf("library entry missing after renamed download: %v", err)
+	}
+	if entry.RequestedName != taken {
+		t.Errorf("library entry requested name = %q, want %q", entry.RequestedName, taken)
+	}
+
+	if _, err := downloadURLToS3(context.Background(), json.RawMessage(mustMarshal(t, URLDownloadArgs{URL: sourceURL, ObjectName: "paper.pdf", OnCollision: "overwrite"}))); err != nil {
+		t.Fatalf("downloadURLToS3() overwriting unexpected error: %v", err)
+	}
+	want := []storage.CollisionPolicy{storage.CollisionError, storage.CollisionRename, storage.CollisionOverwrite}
+	if !slices.Equal(policies, want) {
+		t.Errorf("uploads used policies %v, want %v", policies, want)
+	}
+
+	// Every download is audited, the refused one included
+	records, err := globalAuditLog.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() unexpected error: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("audit log = %+v, want a record of every download", records)
+	}
+	for i, wantObjects := range [][]string{nil, {renamed}, {taken}} {
+		record := records[i]
+		if record.Action != "web_download" || record.Source != sourceURL || !slices.Equal(record.Objects, wantObjects) {
+			t.Errorf("audit record %d = %+v, want a web_download of %s storing %v", i, record, sourceURL, wantObjects)
+		}
+	}
+	if !slices.Equal(records[0].Failed, []string{taken}) {
+		t.Errorf("audit record of the refused download failed = %v, want [%s]", records[0].Failed, taken)
+	}
+}
+
+func TestDownloadURLToS3RejectsInput(t *testing.T) {
+	originalConfig, originalUploader := globalS3Config, urlUploader
+	t.Cleanup(func() { globalS3Config, urlUploader = originalConfig, originalUploader })
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	urlUploader = func(ctx context.Context, sourceURL string, config *storage.S3Config, bucketName, objectName string, metadata map[string]string, policy storage.CollisionPolicy) (storage.UploadResult, error) {
+		t.Errorf("uploader called for invalid input %q -> %q", sourceURL, objectName)
+		return storage.UploadResult{}, nil
+	}
+
+	for _, args := range []URLDownloadArgs{
+		{URL: "ftp://example.org/data.zip", ObjectName: "data.zip"},
+		{URL: "file:///etc/passwd", ObjectName: "passwd"},
+		{URL: "https://example.org/data.zip", ObjectName: "../arxiv/2405.12345.pdf"},
+		{URL: "https://example.org/data.zip", ObjectName: ""},
+		{URL: "https://example.org/data.zip", ObjectName: "data.zip", OnCollision: "skip"},
+	} {
+		if _, err := downloadURLToS3(context.Background(), json.RawMessage(mustMarshal(t, args))); err == nil {
+			t.Errorf("downloadURLToS3(%+v) should fail", args)
+		}
+	}
+}
+
+// TestDownloadURLToS3BlockedHost checks that hosts outside the allowlist and private addresses are
+// refused with structured policy errors, without contacting S3
+func TestDownloadURLToS3BlockedHost(t *testing.T) {
+	original := globalS3Config
+	t.Cleanup(func() { globalS3Config = original })
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	t.Setenv("OPUS_MCP_DOWNLOAD_ALLOWED_HOSTS", "github.com")
+
+	tests := []struct {
+		url        string
+		wantPolicy string
+		wantHost   string
+	}{
+		{"https://evil.example.com/payload.bin", storage.PolicyAllowedHosts, "evil.example.com"},
+		{"http://169.254.169.254/latest/meta-data/", storage.PolicyAllowedHosts, "169.254.169.254"},
+		{"https://githubusercontent.com.evil.net/data.zip", storage.PolicyAllowedHosts, "githubusercontent.com.evil.net"},
+	}
+
+	handler := newTestToolHandler(t, downloadURLToS3)
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			arguments := mustMarshal(t, URLDownloadArgs{URL: tt.url, ObjectName: "data.bin"})
+			result, err := handler.Handle(context.Background(), newTestCallToolRequest("url_download_to_storage", arguments))
+			if err != nil {
+				t.Fatalf("Handle() returned protocol error: %v", err)
+			}
+			if !result.IsError {
+				t.Fatal("expected a policy violation error result")
+			}
+			var payload struct {
+				Error ToolError `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(resultText(t, result)), &payload); err != nil {
+				t.Fatalf("failed to unmarshal error payload: %v", err)
+			}
+			if payload.Error.Code != ErrCodePolicyViolation {
+				t.Errorf("error code = %q, want %q", payload.Error.Code, ErrCodePolicyViolation)
+			}
+			if payload.Error.Details["policy"] != tt.wantPolicy || payload.Error.Details["host"] != tt.wantHost {
+				t.Errorf("error details = %v, want policy %s and host %s", payload.Error.Details, tt.wantPolicy, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestDownloadURLToS3TooLarge(t *testing.T) {
+	originalConfig, originalUploader := globalS3Config, urlUploader
+	t.Cleanup(func() { globalS3Config, urlUploader = originalConfig, originalUploader })
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+	urlUploader = func(ctx context.Context, sourceURL string, config *storage.S3Config, bucketName, objectName string, metadata map[string]string, policy storage.CollisionPolicy) (storage.UploadResult, error) {
+		return storage.UploadResult{}, fmt.Errorf("failed to spool download after 1000 bytes: %w", &storage.DownloadTooLargeError{Limit: 1000, ContentLength: -1})
+	}
+
+	handler := newTestToolHandler(t, downloadURLToS3)
+	arguments := mustMarshal(t, URLDownloadArgs{URL: "https://github.com/owner/repo/releases/download/v1/data.zip", ObjectName: "data.zip"})
+	result, err := handler.Handle(context.Background(), newTestCallToolRequest("url_download_to_storage", arguments))
+	if err != nil {
+		t.Fatalf("Handle() returned protocol error: %v", err)
+	}
+	var payload struct {
+		Error ToolError `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(resultText(t, result)), &payload); err != nil {
+		t.Fatalf("failed to unmarshal error payload: %v", err)
+	}
+	if !result.IsError || payload.Error.Code != ErrCodePolicyViolation || payload.Error.Details["policy"] != "max-download-size" {
+		t.Errorf("result = %s, want a max-download-size policy violation", resultText(t, result))
+	}
+}
+
+func TestGenericDownloadToolRegistration(t *testing.T) {
+	originalConfig, originalEnabled := globalS3Config, genericDownloadEnabled
+	t.Cleanup(func() { globalS3Config, genericDownloadEnabled = originalConfig, originalEnabled })
+	globalS3Config = &storage.S3Config{Endpoint: "localhost:9000"}
+
+	for _, enabled := range []bool{false, true} {
+		genericDownloadEnabled = enabled
+		server := mcp.NewServer(&mcp.Implementation{Name: "test-server", Version: "v0.0.1"}, nil)
+		if err := addMCPTools(server, toolDeps); err != nil {
+			t.Fatalf("addMCPTools() unexpected error: %v", err)
+		}
+
+		ctx := context.Background()
+		clientTransport, serverTransport := mcp.NewInMemoryTransports()
+		serverSession, err := server.Connect(ctx, serverTransport, nil)
+		if err != nil {
+			t.Fatalf("failed to connect server: %v", err)
+		}
+		client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "v0.0.1"}, nil)
+		clientSession, err := client.Connect(ctx, clientTransport, nil)
+		if err != nil {
+			t.Fatalf("failed to connect client: %v", err)
+		}
+		tools, err := clientSession.ListTools(ctx, nil)
+		if err != nil {
+			t.Fatalf("ListTools() failed: %v", err)
+		}
+		clientSession.Close()
+		serverSession.Close()
+
+		var tool *mcp.Tool
+		for _, listed := range tools.Tools {
+			if listed.Name == "url_download_to_storage" {
+				tool = listed
+			}
+		}
+		if (tool != nil) != enabled {
+			t.Fatalf("url_download_to_storage registered = %v, want %v", tool != nil, enabled)
+		}
+		if tool != nil && (tool.Annotations == nil || tool.Annotations.ReadOnlyHint) {
+			t.Errorf("url_download_to_storage annotations = %+v, want a write tool", tool.Annotations)
+		}
+	}
+}
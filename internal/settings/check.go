@@ -0,0 +1,199 @@
+package settings
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+// Validator is implemented by configuration structs whose values depend on each other or have
+// limits beyond their type. Process and Check call Validate once every variable has been decoded;
+// it reports all its problems at once, joined with errors.Join.
+type Validator interface {
+	Validate() error
+}
+
+// Problem is a configuration value that cannot be loaded
+type Problem struct {
+	// Section is the name of the configuration struct
+	Section string
+	// Env is the variable that could not be decoded, empty for problems reported by Validate
+	Env string
+	Err error
+}
+
+func (p Problem) Error() string {
+	if p.Env == "" {
+		return p.Section + ": " + p.Err.Error()
+	}
+	return p.Section + ": " + p.Env + ": " + p.Err.Error()
+}
+
+func (p Problem) Unwrap() error {
+	return p.Err
+}
+
+// Problems are all the problems of a configuration, reported together
+type Problems []Problem
+
+func (p Problems) Error() string {
+	var b strings.Builder
+	if len(p) == 1 {
+		b.WriteString("1 configuration problem:")
+	} else {
+		fmt.Fprintf(&b, "%d configuration problems:", len(p))
+	}
+	for _, problem := range p {
+		b.WriteString("\n  - " + problem.Error())
+	}
+	return b.String()
+}
+
+// optionalConfig is a configuration struct that is only checked when one of its variables is set
+type optionalConfig struct {
+	config any
+}
+
+// Optional marks a configuration struct passed to Check as optional, e.g., storage that is only
+// used when configured: it is only checked when at least one of its variables is set, so that its
+// required variables are not reported missing when none is.
+func Optional(config any) any {
+	return optionalConfig{config: config}
+}
+
+// Check loads configuration structs like Process, without recording them, and reports every
+// problem found in any of them as Problems rather than stopping at the first: the variables that
+// cannot be decoded or are required but missing, and the problems reported by Validate for the
+// structs whose variables all decoded. It returns nil if there is no problem.
+func Check(ctx context.Context, configs ...any) error {
+	var problems Problems
+	for _, config := range configs {
+		optional := false
+		if o, ok := config.(optionalConfig); ok {
+			config, optional = o.config, true
+		}
+		structType := reflect.Indirect(reflect.ValueOf(config)).Type()
+		if optional && !anyVariableSet(structType, "") {
+			continue
+		}
+		section := structType.Name()
+		fieldProblems := checkFields(ctx, section, structType, "")
+		if len(fieldProblems) > 0 {
+			problems = append(problems, fieldProblems...)
+			continue
+		}
+		if err := envconfig.Process(ctx, config); err != nil {
+			problems = append(problems, Problem{Section: section, Err: err})
+			continue
+		}
+		if validator, ok := config.(Validator); ok {
+			for _, err := range splitErrors(validator.Validate()) {
+				problems = append(problems, Problem{Section: section, Err: err})
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return problems
+}
+
+// checkFields decodes every field of a configuration struct on its own, recursing into nested
+// structs with the environment variable prefix they are loaded with, and returns the fields that
+// fail to decode
+func checkFields(ctx context.Context, section string, structType reflect.Type, prefix string) []Problem {
+	var problems []Problem
+	for i := range structType.NumField() {
+		structField := structType.Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+		tag := structField.Tag.Get("env")
+		key, options := parseTag(tag)
+		if nested := nestedStructType(structField.Type); nested != nil && key == "" {
+			problems = append(problems, checkFields(ctx, section, nested, prefix+options["prefix"])...)
+			continue
+		}
+		if key == "" {
+			continue
+		}
+		// A struct of the single field, with the prefix folded into its variable, decodes the
+		// field like the whole struct would
+		single := reflect.New(reflect.StructOf([]reflect.StructField{{
+			Name: structField.Name,
+			Type: structField.Type,
+			Tag:  reflect.StructTag("env:" + strconv.Quote(prefix+tag)),
+		}}))
+		if err := envconfig.Process(ctx, single.Interface()); err != nil {
+			problems = append(problems, Problem{Section: section, Env: prefix + key, Err: fieldError(structField.Name, prefix+key, err)})
+		}
+	}
+	return problems
+}
+
+// fieldError removes the name of the field envconfig starts its errors with, and the variable
+// some of them end with, which Problem reports instead
+func fieldError(name, key string, err error) error {
+	message, found := strings.CutPrefix(err.Error(), name)
+	if !found {
+		return err
+	}
+	message = strings.TrimSuffix(message, ": "+key)
+	message = strings.TrimLeft(message, ": ")
+	if strings.HasPrefix(message, "(") {
+		// Decoding errors quote the value after the field name, as in Name("value")
+		if end := strings.Index(message, "): "); end >= 0 {
+			message = message[end+len("): "):]
+		}
+	}
+	return fmt.Errorf("%s", message)
+}
+
+// anyVariableSet reports whether any variable of a configuration struct is set
+func anyVariableSet(structType reflect.Type, prefix string) bool {
+	for i := range structType.NumField() {
+		structField := structType.Field(i)
+		key, options := parseTag(structField.Tag.Get("env"))
+		if nested := nestedStructType(structField.Type); nested != nil && key == "" {
+			if anyVariableSet(nested, prefix+options["prefix"]) {
+				return true
+			}
+			continue
+		}
+		if _, set := os.LookupEnv(prefix + key); key != "" && set {
+			return true
+		}
+	}
+	return false
+}
+
+// nestedStructType returns the struct type of a field that is a struct or a pointer to one, or nil
+func nestedStructType(fieldType reflect.Type) reflect.Type {
+	if fieldType.Kind() == reflect.Pointer {
+		fieldType = fieldType.Elem()
+	}
+	if fieldType.Kind() != reflect.Struct {
+		return nil
+	}
+	// Types decoding themselves, e.g., from text, are values rather than nested configuration
+	if reflect.PointerTo(fieldType).Implements(reflect.TypeFor[envconfig.DecoderCtx]()) {
+		return nil
+	}
+	return fieldType
+}
+
+// splitErrors returns the errors joined in an error, or the error on its own
+func splitErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
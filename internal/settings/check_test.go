@@ -0,0 +1,88 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type testLimits struct {
+	Timeout Duration `env:"TIMEOUT,default=30s"`
+}
+
+type testCheckedConfig struct {
+	MaxBytes Size        `env:"TEST_CHECK_MAX_BYTES,default=64MiB"`
+	Workers  int         `env:"TEST_CHECK_WORKERS,default=2"`
+	Queue    int         `env:"TEST_CHECK_QUEUE,default=4"`
+	Limits   *testLimits `env:",prefix=TEST_CHECK_"`
+}
+
+func (c *testCheckedConfig) Validate() error {
+	var errs []error
+	if c.Workers < 1 {
+		errs = append(errs, fmt.Errorf("TEST_CHECK_WORKERS must be at least 1, got %d", c.Workers))
+	}
+	if c.Queue < c.Workers {
+		errs = append(errs, fmt.Errorf("TEST_CHECK_QUEUE must be at least TEST_CHECK_WORKERS, got %d", c.Queue))
+	}
+	return errors.Join(errs...)
+}
+
+type testStorageConfig struct {
+	Endpoint string `env:"TEST_CHECK_S3_ENDPOINT,required"`
+	Key      string `env:"TEST_CHECK_S3_KEY,required" secret:"true"`
+}
+
+func TestCheckCollectsAllProblems(t *testing.T) {
+	t.Setenv("TEST_CHECK_MAX_BYTES", "200MBs")
+	t.Setenv("TEST_CHECK_WORKERS", "many")
+	t.Setenv("TEST_CHECK_TIMEOUT", "-1m")
+	t.Setenv("TEST_CHECK_S3_ENDPOINT", "localhost:9000")
+
+	err := Check(context.Background(), &testCheckedConfig{}, Optional(&testStorageConfig{}))
+	var problems Problems
+	if !errors.As(err, &problems) {
+		t.Fatalf("Check() error = %v, want Problems", err)
+	}
+	want := `4 configuration problems:
+  - testCheckedConfig: TEST_CHECK_MAX_BYTES: invalid size "200MBs": unknown unit "MBs", valid units are B, kB, MB, GB, TB, KiB, MiB, GiB and TiB
+  - testCheckedConfig: TEST_CHECK_WORKERS: strconv.ParseInt: parsing "many": invalid syntax
+  - testCheckedConfig: TEST_CHECK_TIMEOUT: invalid duration "-1m": cannot be negative
+  - testStorageConfig: TEST_CHECK_S3_KEY: missing required value`
+	if err.Error() != want {
+		t.Errorf("Check() error =\n%s\nwant\n%s", err, want)
+	}
+}
+
+func TestCheckValidates(t *testing.T) {
+	t.Setenv("TEST_CHECK_WORKERS", "0")
+	t.Setenv("TEST_CHECK_QUEUE", "-1")
+
+	// Optional configuration without any variable set is not checked
+	err := Check(context.Background(), &testCheckedConfig{}, Optional(&testStorageConfig{}))
+	want := `2 configuration problems:
+  - testCheckedConfig: TEST_CHECK_WORKERS must be at least 1, got 0
+  - testCheckedConfig: TEST_CHECK_QUEUE must be at least TEST_CHECK_WORKERS, got -1`
+	if err == nil || err.Error() != want {
+		t.Errorf("Check() error =\n%v\nwant\n%s", err, want)
+	}
+
+	// Process reports the same problems of Validate
+	resetState(t)
+	if err := Process(context.Background(), &testCheckedConfig{}); err == nil || err.Error() != "TEST_CHECK_WORKERS must be at least 1, got 0\nTEST_CHECK_QUEUE must be at least TEST_CHECK_WORKERS, got -1" {
+		t.Errorf("Process() error = %v, want the problems of Validate", err)
+	}
+	if len(Snapshot()) != 0 {
+		t.Errorf("Process() recorded %+v, want an invalid configuration left out", Snapshot())
+	}
+
+	t.Setenv("TEST_CHECK_WORKERS", "2")
+	t.Setenv("TEST_CHECK_QUEUE", "8")
+	if err := Check(context.Background(), &testCheckedConfig{}); err != nil {
+		t.Errorf("Check() unexpected error: %v", err)
+	}
+	if got := (Problems{{Section: "testStorageConfig", Env: "TEST_CHECK_S3_KEY", Err: errors.New("missing required value")}}).Error(); got != "1 configuration problem:\n  - testStorageConfig: TEST_CHECK_S3_KEY: missing required value" {
+		t.Errorf("Problems.Error() = %q for a single problem", got)
+	}
+}
@@ -0,0 +1,270 @@
+// Package settings loads configuration from environment variables and records where every value
+// came from, so that the effective configuration can be reported without revealing secrets.
+//
+// Configuration structs are loaded with Process instead of envconfig.Process. Every field is
+// labelled with its source:
+//   - "default" when no environment variable set it
+//   - "env" when it was set in the environment of the process
+//   - "file" when it was set in a .env file loaded with LoadDotEnv
+//   - "flag" for command line flags recorded with RecordFlags that were given explicitly
+//
+// Fields tagged secret:"true" are reported as a fingerprint, their length and a prefix of their
+// SHA-256 digest, which tells whether two deployments share a value without revealing it.
+//
+// Sizes and durations are read with the Size and Duration types, which take units such as 64MiB
+// and 7d. Check loads many configuration structs at once and reports all their problems together.
+package settings
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+	"github.com/sethvargo/go-envconfig"
+)
+
+// Source is where a configuration value came from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceEnv     Source = "env"
+	SourceFile    Source = "file"
+	SourceFlag    Source = "flag"
+)
+
+// FlagsSection is the name of the section holding the command line flags
+const FlagsSection = "flags"
+
+// fingerprintPrefixLength is the number of hex characters of the digest in a secret's fingerprint
+const fingerprintPrefixLength = 8
+
+// Fingerprint identifies a secret value without revealing it
+type Fingerprint struct {
+	Length       int    `json:"length" jsonschema:"Length of the value in bytes"`
+	SHA256Prefix string `json:"sha256Prefix" jsonschema:"First hex characters of the SHA-256 digest of the value"`
+}
+
+// Field is the effective value of a configuration field and where it came from
+type Field struct {
+	Name string `json:"name" jsonschema:"Name of the field, dotted for nested structs"`
+	Env  string `json:"env,omitempty" jsonschema:"Environment variable the field is read from"`
+	Flag string `json:"flag,omitempty" jsonschema:"Command line flag the field is read from"`
+	// Value is left out for secrets, which are reported by their fingerprint instead
+	Value       any          `json:"value,omitempty" jsonschema:"Effective value of the field, left out for secrets and unset values"`
+	Secret      bool         `json:"secret,omitempty" jsonschema:"Whether the value is a secret, reported by its fingerprint"`
+	Fingerprint *Fingerprint `json:"fingerprint,omitempty" jsonschema:"Fingerprint of a non-empty secret value"`
+	Source      Source       `json:"source" jsonschema:"Where the value came from: default, env, file or flag"`
+}
+
+// Section is the configuration loaded into one struct, or the command line flags
+type Section struct {
+	Name   string  `json:"name" jsonschema:"Name of the configuration struct, or flags for the command line flags"`
+	Fields []Field `json:"fields" jsonschema:"Fields of the section, in declaration order"`
+}
+
+var (
+	mu sync.Mutex
+	// fileKeys are the environment variables that were set from a .env file
+	fileKeys = map[string]bool{}
+	// sections are the configuration sections loaded so far, by name
+	sections = map[string]Section{}
+)
+
+// LoadDotEnv loads environment variables from .env files, the one in the working directory if none
+// is given, without overriding variables that are already set. The variables it sets are reported
+// as coming from a file.
+func LoadDotEnv(filenames ...string) error {
+	if len(filenames) == 0 {
+		filenames = []string{".env"}
+	}
+	values, err := godotenv.Read(filenames...)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for key, value := range values {
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("failed to set %s: %w", key, err)
+		}
+		fileKeys[key] = true
+	}
+	return nil
+}
+
+// Process loads a configuration struct from environment variables like envconfig.Process, checks
+// it with its Validate method if it is a Validator, and records the provenance of its fields under
+// the name of the struct type
+func Process(ctx context.Context, config any) error {
+	if err := envconfig.Process(ctx, config); err != nil {
+		return err
+	}
+	if validator, ok := config.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return err
+		}
+	}
+	value := reflect.Indirect(reflect.ValueOf(config))
+	section := Section{Name: value.Type().Name()}
+	mu.Lock()
+	defer mu.Unlock()
+	section.Fields = describeStruct(value, "", "")
+	sections[section.Name] = section
+	return nil
+}
+
+// RecordFlags records the values of the flags of a parsed flag set, labelling the flags given on
+// the command line as coming from flags
+func RecordFlags(flags *flag.FlagSet) {
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	section := Section{Name: FlagsSection}
+	flags.VisitAll(func(f *flag.Flag) {
+		field := Field{Name: f.Name, Flag: "-" + f.Name, Value: f.Value.String(), Source: SourceDefault}
+		if set[f.Name] {
+			field.Source = SourceFlag
+		}
+		section.Fields = append(section.Fields, field)
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	sections[section.Name] = section
+}
+
+// Snapshot returns the sections recorded so far, sorted by name
+func Snapshot() []Section {
+	mu.Lock()
+	defer mu.Unlock()
+	snapshot := make([]Section, 0, len(sections))
+	for _, section := range sections {
+		snapshot = append(snapshot, section)
+	}
+	slices.SortFunc(snapshot, func(a, b Section) int { return strings.Compare(a.Name, b.Name) })
+	return snapshot
+}
+
+// describeStruct describes the fields of a configuration struct, recursing into nested structs with
+// the environment variable prefix they are loaded with
+func describeStruct(value reflect.Value, name, prefix string) []Field {
+	var fields []Field
+	for i := range value.NumField() {
+		structField := value.Type().Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+		fieldName := structField.Name
+		if name != "" {
+			fieldName = name + "." + fieldName
+		}
+		key, options := parseTag(structField.Tag.Get("env"))
+		fieldValue := value.Field(i)
+		if nested, ok := nestedStruct(fieldValue); ok && key == "" {
+			fields = append(fields, describeStruct(nested, fieldName, prefix+options["prefix"])...)
+			continue
+		}
+		if key == "" {
+			continue
+		}
+		key = prefix + key
+		field := Field{Name: fieldName, Env: key, Source: sourceOf(key, options["default"])}
+		rendered := render(fieldValue)
+		if structField.Tag.Get("secret") == "true" {
+			field.Secret = true
+			if s := fmt.Sprint(rendered); rendered != nil && s != "" {
+				field.Fingerprint = fingerprint(s)
+			}
+		} else {
+			field.Value = rendered
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// parseTag splits an env struct tag into the variable name and its options. The default option
+// runs to the end of the tag, since default values may contain commas.
+func parseTag(tag string) (string, map[string]string) {
+	key, rest, _ := strings.Cut(tag, ",")
+	options := map[string]string{}
+	for rest != "" {
+		var option string
+		if strings.HasPrefix(rest, "default=") {
+			option, rest = rest, ""
+		} else {
+			option, rest, _ = strings.Cut(rest, ",")
+		}
+		name, value, _ := strings.Cut(option, "=")
+		options[name] = value
+	}
+	return key, options
+}
+
+// nestedStruct returns the struct held by a field that is a struct or a non-nil pointer to one
+func nestedStruct(value reflect.Value) (reflect.Value, bool) {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() || value.Elem().Kind() != reflect.Struct {
+			return reflect.Value{}, false
+		}
+		return value.Elem(), true
+	}
+	return value, value.Kind() == reflect.Struct
+}
+
+// sourceOf returns where the variable's value came from. A default referring to another variable,
+// e.g., default=$HTTP_PROXY, takes the source of that variable when it is set.
+func sourceOf(key, defaultValue string) Source {
+	if source, ok := envSource(key); ok {
+		return source
+	}
+	if alias, ok := strings.CutPrefix(defaultValue, "$"); ok {
+		if source, ok := envSource(alias); ok {
+			return source
+		}
+	}
+	return SourceDefault
+}
+
+// envSource returns whether the variable is set and whether it was set from a .env file. Callers
+// hold mu.
+func envSource(key string) (Source, bool) {
+	if _, set := os.LookupEnv(key); !set {
+		return "", false
+	}
+	if fileKeys[key] {
+		return SourceFile, true
+	}
+	return SourceEnv, true
+}
+
+// render converts a field value for JSON output: nil pointers to nil, and values with a String
+// method, such as durations, to their string form
+func render(value reflect.Value) any {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if stringer, ok := value.Interface().(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return value.Interface()
+}
+
+// fingerprint returns the fingerprint of a secret value
+func fingerprint(secret string) *Fingerprint {
+	digest := sha256.Sum256([]byte(secret))
+	return &Fingerprint{Length: len(secret), SHA256Prefix: hex.EncodeToString(digest[:])[:fingerprintPrefixLength]}
+}
@@ -0,0 +1,150 @@
+package settings
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testTimeouts struct {
+	Read time.Duration `env:"READ_TIMEOUT,default=5s"`
+}
+
+type testConfig struct {
+	Endpoint string        `env:"TEST_SETTINGS_ENDPOINT,default=localhost:9000"`
+	Region   string        `env:"TEST_SETTINGS_REGION,default=us-east-1"`
+	Bucket   string        `env:"TEST_SETTINGS_BUCKET"`
+	Secret   string        `env:"TEST_SETTINGS_SECRET" secret:"true"`
+	Unset    string        `env:"TEST_SETTINGS_UNSET_SECRET" secret:"true"`
+	Proxy    string        `env:"TEST_SETTINGS_PROXY,default=$TEST_SETTINGS_PROXY_ALIAS"`
+	Timeouts *testTimeouts `env:",prefix=TEST_SETTINGS_"`
+}
+
+// resetState forgets the sections and .env variables recorded by earlier tests
+func resetState(t *testing.T) {
+	t.Helper()
+	mu.Lock()
+	defer mu.Unlock()
+	fileKeys = map[string]bool{}
+	sections = map[string]Section{}
+}
+
+// findSection returns the recorded section with the given name
+func findSection(t *testing.T, name string) Section {
+	t.Helper()
+	for _, section := range Snapshot() {
+		if section.Name == name {
+			return section
+		}
+	}
+	t.Fatalf("section %s was not recorded", name)
+	return Section{}
+}
+
+func fieldsByName(section Section) map[string]Field {
+	fields := make(map[string]Field, len(section.Fields))
+	for _, field := range section.Fields {
+		fields[field.Name] = field
+	}
+	return fields
+}
+
+func TestProcessRecordsProvenanceAndRedactsSecrets(t *testing.T) {
+	resetState(t)
+	const secret = "s3cr3t-access-key"
+
+	// The .env file sets the bucket, but not the region, which is already set in the environment
+	dotEnv := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(dotEnv, []byte("TEST_SETTINGS_BUCKET=from-file\nTEST_SETTINGS_REGION=from-file\n"), 0o600); err != nil {
+		t.Fatalf("failed to write .env file: %v", err)
+	}
+	t.Setenv("TEST_SETTINGS_REGION", "eu-west-1")
+	t.Setenv("TEST_SETTINGS_SECRET", secret)
+	t.Setenv("TEST_SETTINGS_PROXY_ALIAS", "http://proxy:3128")
+	t.Setenv("TEST_SETTINGS_READ_TIMEOUT", "90s")
+	t.Cleanup(func() { os.Unsetenv("TEST_SETTINGS_BUCKET") })
+	if err := LoadDotEnv(dotEnv); err != nil {
+		t.Fatalf("LoadDotEnv() unexpected error: %v", err)
+	}
+
+	var config testConfig
+	if err := Process(context.Background(), &config); err != nil {
+		t.Fatalf("Process() unexpected error: %v", err)
+	}
+	if config.Region != "eu-west-1" || config.Bucket != "from-file" {
+		t.Fatalf("Process() loaded region %q and bucket %q, want eu-west-1 from the environment and from-file", config.Region, config.Bucket)
+	}
+
+	fields := fieldsByName(findSection(t, "testConfig"))
+	tests := []struct {
+		name   string
+		value  any
+		source Source
+	}{
+		{"Endpoint", "localhost:9000", SourceDefault},
+		{"Region", "eu-west-1", SourceEnv},
+		{"Bucket", "from-file", SourceFile},
+		{"Proxy", "http://proxy:3128", SourceEnv},
+		{"Timeouts.Read", "1m30s", SourceEnv},
+	}
+	for _, tt := range tests {
+		field, ok := fields[tt.name]
+		if !ok {
+			t.Errorf("field %s was not recorded", tt.name)
+			continue
+		}
+		if field.Value != tt.value || field.Source != tt.source {
+			t.Errorf("field %s = %v from %s, want %v from %s", tt.name, field.Value, field.Source, tt.value, tt.source)
+		}
+	}
+	if env := fields["Timeouts.Read"].Env; env != "TEST_SETTINGS_READ_TIMEOUT" {
+		t.Errorf("nested field env = %q, want the prefixed TEST_SETTINGS_READ_TIMEOUT", env)
+	}
+
+	// Secrets are reported by their length and digest prefix only
+	digest := sha256.Sum256([]byte(secret))
+	wantFingerprint := Fingerprint{Length: len(secret), SHA256Prefix: hex.EncodeToString(digest[:])[:fingerprintPrefixLength]}
+	secretField := fields["Secret"]
+	if !secretField.Secret || secretField.Value != nil || secretField.Fingerprint == nil || *secretField.Fingerprint != wantFingerprint {
+		t.Errorf("secret field = %+v, want no value and fingerprint %+v", secretField, wantFingerprint)
+	}
+	if secretField.Source != SourceEnv {
+		t.Errorf("secret field source = %s, want %s", secretField.Source, SourceEnv)
+	}
+	if unset := fields["Unset"]; !unset.Secret || unset.Fingerprint != nil || unset.Source != SourceDefault {
+		t.Errorf("unset secret field = %+v, want a secret without fingerprint from the default", unset)
+	}
+	data, err := json.Marshal(Snapshot())
+	if err != nil {
+		t.Fatalf("failed to marshal snapshot: %v", err)
+	}
+	if strings.Contains(string(data), secret) {
+		t.Errorf("snapshot %s reveals the secret", data)
+	}
+}
+
+func TestRecordFlags(t *testing.T) {
+	resetState(t)
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.String("transport", "stdio", "")
+	flags.Int("port", 8000, "")
+	if err := flags.Parse([]string{"-transport", "http"}); err != nil {
+		t.Fatalf("Parse() unexpected error: %v", err)
+	}
+	RecordFlags(flags)
+
+	fields := fieldsByName(findSection(t, FlagsSection))
+	if got := fields["transport"]; got.Value != "http" || got.Source != SourceFlag || got.Flag != "-transport" {
+		t.Errorf("transport flag = %+v, want http from a flag", got)
+	}
+	if got := fields["port"]; got.Value != "8000" || got.Source != SourceDefault {
+		t.Errorf("port flag = %+v, want 8000 from the default", got)
+	}
+}
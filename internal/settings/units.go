@@ -0,0 +1,135 @@
+package settings
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Size is a number of bytes read from a human-friendly size, e.g., 512, 64KiB or 1.5GB. Binary
+// units (KiB, MiB, GiB, TiB) are powers of 1024 and decimal units (kB, MB, GB, TB) powers of 1000;
+// units are case-insensitive, and a bare number is a number of bytes. Sizes cannot be negative.
+type Size int64
+
+// sizeUnits are the multipliers of the units of sizes, by their lower case name
+var sizeUnits = map[string]int64{
+	"": 1, "b": 1,
+	"kb": 1000, "mb": 1000 * 1000, "gb": 1000 * 1000 * 1000, "tb": 1000 * 1000 * 1000 * 1000,
+	"kib": 1 << 10, "mib": 1 << 20, "gib": 1 << 30, "tib": 1 << 40,
+}
+
+// ParseSize parses a human-friendly size, e.g., 64MiB or 1.5GB
+func ParseSize(s string) (Size, error) {
+	trimmed := strings.TrimSpace(s)
+	if strings.HasPrefix(trimmed, "-") {
+		return 0, fmt.Errorf("invalid size %q: cannot be negative", s)
+	}
+	split := strings.IndexFunc(trimmed, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' })
+	if split < 0 {
+		split = len(trimmed)
+	}
+	number, unit := trimmed[:split], strings.TrimSpace(trimmed[split:])
+	multiplier, ok := sizeUnits[strings.ToLower(unit)]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q, valid units are B, kB, MB, GB, TB, KiB, MiB, GiB and TiB", s, unit)
+	}
+	if number == "" {
+		return 0, fmt.Errorf("invalid size %q: missing number", s)
+	}
+	if whole, err := strconv.ParseInt(number, 10, 64); err == nil {
+		if whole > math.MaxInt64/multiplier {
+			return 0, fmt.Errorf("invalid size %q: too large", s)
+		}
+		return Size(whole * multiplier), nil
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %q is not a number", s, number)
+	}
+	bytes := value * float64(multiplier)
+	if bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+	if bytes != math.Trunc(bytes) {
+		return 0, fmt.Errorf("invalid size %q: not a whole number of bytes", s)
+	}
+	return Size(bytes), nil
+}
+
+// EnvDecode reads a size from an environment variable
+func (s *Size) EnvDecode(_ context.Context, value string) error {
+	size, err := ParseSize(value)
+	if err != nil {
+		return err
+	}
+	*s = size
+	return nil
+}
+
+// String returns the size in the largest binary unit that divides it, e.g., 64MiB, or in bytes
+func (s Size) String() string {
+	for _, unit := range []struct {
+		name       string
+		multiplier int64
+	}{{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}} {
+		if s != 0 && int64(s)%unit.multiplier == 0 {
+			return strconv.FormatInt(int64(s)/unit.multiplier, 10) + unit.name
+		}
+	}
+	return strconv.FormatInt(int64(s), 10) + "B"
+}
+
+// Duration is a length of time read from a Go duration, e.g., 90s or 1h30m, which may also count
+// days, e.g., 7d or 1d12h. Durations cannot be negative.
+type Duration time.Duration
+
+// ParseDuration parses a duration, e.g., 30s or 7d
+func ParseDuration(s string) (Duration, error) {
+	trimmed := strings.TrimSpace(s)
+	var days int64
+	if before, after, ok := strings.Cut(trimmed, "d"); ok {
+		n, err := strconv.ParseInt(before, 10, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q: days must be a whole number, e.g., 7d", s)
+		}
+		days, trimmed = n, after
+	}
+	var rest time.Duration
+	if trimmed != "" {
+		var err error
+		if rest, err = time.ParseDuration(trimmed); err != nil {
+			return 0, fmt.Errorf("invalid duration %q: use a number with a unit such as 30s, 5m, 1h30m or 7d", s)
+		}
+	}
+	if rest < 0 {
+		return 0, fmt.Errorf("invalid duration %q: cannot be negative", s)
+	}
+	if days > int64((math.MaxInt64-rest)/(24*time.Hour)) {
+		return 0, fmt.Errorf("invalid duration %q: too long", s)
+	}
+	return Duration(time.Duration(days)*24*time.Hour + rest), nil
+}
+
+// EnvDecode reads a duration from an environment variable
+func (d *Duration) EnvDecode(_ context.Context, value string) error {
+	duration, err := ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = duration
+	return nil
+}
+
+// Duration returns the duration as a time.Duration
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// String returns the duration like time.Duration does, e.g., 1m30s
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
@@ -0,0 +1,104 @@
+package settings
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input     string
+		want      Size
+		wantError string
+	}{
+		{"0", 0, ""},
+		{"1048576", 1 << 20, ""},
+		{"512B", 512, ""},
+		{"64KiB", 64 << 10, ""},
+		{"64MiB", 64 << 20, ""},
+		{"200MB", 200_000_000, ""},
+		{"1.5GB", 1_500_000_000, ""},
+		{"1.5GiB", 3 << 29, ""},
+		{"2TiB", 2 << 40, ""},
+		{"64 mib", 64 << 20, ""},
+		{" 10kb ", 10_000, ""},
+		{"", 0, "missing number"},
+		{"MiB", 0, "missing number"},
+		{"-1MiB", 0, "cannot be negative"},
+		{"12QB", 0, `unknown unit "QB"`},
+		{"1.2.3MB", 0, "is not a number"},
+		{"1.5B", 0, "not a whole number of bytes"},
+		{"0.1KiB", 0, "not a whole number of bytes"},
+		{"9999999TiB", 0, "too large"},
+		{"99999999999999999999", 0, "too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSize(tt.input)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Errorf("ParseSize(%q) error = %v, want error containing %q", tt.input, err, tt.wantError)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, %v, want %d", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSizeString(t *testing.T) {
+	for size, want := range map[Size]string{
+		0:             "0B",
+		1000:          "1000B",
+		1 << 20:       "1MiB",
+		256 << 20:     "256MiB",
+		1536 << 20:    "1536MiB",
+		3 << 40:       "3TiB",
+		1_500_000_000: "1500000000B",
+	} {
+		if got := size.String(); got != want {
+			t.Errorf("Size(%d).String() = %q, want %q", int64(size), got, want)
+		}
+		if parsed, err := ParseSize(want); err != nil || parsed != size {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", want, parsed, err, int64(size))
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input     string
+		want      time.Duration
+		wantError string
+	}{
+		{"0", 0, ""},
+		{"30s", 30 * time.Second, ""},
+		{"1h30m", 90 * time.Minute, ""},
+		{"7d", 7 * 24 * time.Hour, ""},
+		{"1d12h", 36 * time.Hour, ""},
+		{"", 0, ""},
+		{"-5s", 0, "cannot be negative"},
+		{"-1d", 0, "days must be a whole number"},
+		{"1.5d", 0, "days must be a whole number"},
+		{"30", 0, "use a number with a unit"},
+		{"5 minutes", 0, "use a number with a unit"},
+		{"200000000d", 0, "too long"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseDuration(tt.input)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Errorf("ParseDuration(%q) error = %v, want error containing %q", tt.input, err, tt.wantError)
+				}
+				return
+			}
+			if err != nil || got.Duration() != tt.want {
+				t.Errorf("ParseDuration(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	"opus-mcp/internal/metrics"
+	"opus-mcp/internal/settings"
+)
+
+// UploadBufferConfig bounds the memory that downloads held for retryable uploads may use, and the
+// size of each download
+type UploadBufferConfig struct {
+	// MaxBufferedBytes is the total size of the downloads held in memory at any one time
+	MaxBufferedBytes settings.Size `env:"OPUS_MCP_MAX_BUFFERED_BYTES,default=256MiB"`
+	// SpoolDir, when set, is a directory where downloads that do not fit the budget are held instead
+	SpoolDir string `env:"OPUS_MCP_SPOOL_DIR"`
+	// MaxDownloadBytes is the size above which a download is refused, whether it is held or streamed
+	MaxDownloadBytes settings.Size `env:"OPUS_MCP_MAX_DOWNLOAD_BYTES,default=1GiB"`
+}
+
+// Validate checks that the spool directory, when set, is a directory and that downloads may have content
+func (c *UploadBufferConfig) Validate() error {
+	if c.MaxDownloadBytes <= 0 {
+		return fmt.Errorf("OPUS_MCP_MAX_DOWNLOAD_BYTES must be positive, got %s", c.MaxDownloadBytes)
+	}
+	if c.SpoolDir != "" {
+		if info, err := os.Stat(c.SpoolDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("OPUS_MCP_SPOOL_DIR %q is not a directory", c.SpoolDir)
+		}
+	}
+	return nil
+}
+
+// LoadUploadBufferConfig loads the upload buffer configuration from environment variables
+func LoadUploadBufferConfig() (*UploadBufferConfig, error) {
+	var config UploadBufferConfig
+	if err := settings.Process(context.Background(), &config); err != nil {
+		slog.Error("Failed to process upload buffer configuration from environment", "error", err)
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Ways in which the content of an upload is held
+const (
+	// HoldMemory keeps the content in memory, within the buffer budget
+	HoldMemory = "memory"
+	// HoldSpool keeps the content in a temporary file in the spool directory
+	HoldSpool = "spool"
+	// HoldStream streams the content straight into the upload, which then cannot be retried
+	HoldStream = "stream"
+)
+
+// BufferBudget is a weighted semaphore over the bytes of downloads held in memory by all
+// concurrent uploads. Acquiring never blocks: a download that does not fit is spooled or streamed.
+type BufferBudget struct {
+	mu       sync.Mutex
+	max      int64
+	buffered int64
+	spoolDir string
+	// maxDownload is the size above which a download is refused; zero means no limit
+	maxDownload int64
+}
+
+// NewBufferBudget creates a buffer budget of maxBytes, spilling to spoolDir when it is not empty
+func NewBufferBudget(maxBytes int64, spoolDir string) *BufferBudget {
+	return &BufferBudget{max: maxBytes, spoolDir: spoolDir}
+}
+
+// uploadBuffers is the buffer budget shared by all uploads of downloaded content
+var uploadBuffers = &BufferBudget{max: 256 << 20, maxDownload: 1 << 30}
+
+// ConfigureUploadBuffers replaces the buffer budget shared by all uploads
+func ConfigureUploadBuffers(config *UploadBufferConfig) {
+	budget := NewBufferBudget(int64(config.MaxBufferedBytes), config.SpoolDir)
+	budget.maxDownload = int64(config.MaxDownloadBytes)
+	uploadBuffers = budget
+}
+
+func init() {
+	metrics.NewGaugeFunc("upload_buffered_bytes", "Bytes of downloaded content currently held in memory for retryable uploads.", func() float64 {
+		return float64(uploadBuffers.Buffered())
+	})
+}
+
+// Buffered returns the number of bytes currently held in memory
+func (b *BufferBudget) Buffered() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffered
+}
+
+// tryAcquire reserves n bytes of the budget, unless that would exceed it
+func (b *BufferBudget) tryAcquire(n int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.buffered+n > b.max {
+		return false
+	}
+	b.buffered += n
+	return true
+}
+
+func (b *BufferBudget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buffered -= n
+}
+
+// DownloadTooLargeError reports a download refused for being larger than OPUS_MCP_MAX_DOWNLOAD_BYTES
+type DownloadTooLargeError struct {
+	Limit int64
+	// ContentLength is the length the server declared, or -1 when the content outgrew the limit
+	// while it was received
+	ContentLength int64
+}
+
+func (e *DownloadTooLargeError) Error() string {
+	if e.ContentLength >= 0 {
+		return fmt.Sprintf("download of %d bytes exceeds the maximum download size of %d bytes", e.ContentLength, e.Limit)
+	}
+	return fmt.Sprintf("download exceeds the maximum download size of %d bytes", e.Limit)
+}
+
+// limit refuses a download whose declared length exceeds the maximum download size, and otherwise
+// returns its body capped at that size, so that a server sending more than it declared, or not
+// declaring a length at all, cannot fill the spool or the bucket
+func (b *BufferBudget) limit(body io.Reader, contentLength int64) (io.Reader, error) {
+	if b.maxDownload <= 0 {
+		return body, nil
+	}
+	if contentLength > b.maxDownload {
+		return nil, &DownloadTooLargeError{Limit: b.maxDownload, ContentLength: contentLength}
+	}
+	return &cappedReader{reader: body, limit: b.maxDownload, remaining: b.maxDownload}, nil
+}
+
+// cappedReader reads at most limit bytes and fails with a *DownloadTooLargeError once the content
+// goes on beyond them
+type cappedReader struct {
+	reader    io.Reader
+	limit     int64
+	remaining int64
+	exceeded  bool
+}
+
+func (r *cappedReader) Read(p []byte) (int, error) {
+	if r.exceeded {
+		return 0, &DownloadTooLargeError{Limit: r.limit, ContentLength: -1}
+	}
+	// Reading one byte more than remains tells content ending at the limit from content beyond it
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.reader.Read(p)
+	if int64(n) <= r.remaining {
+		r.remaining -= int64(n)
+		return n, err
+	}
+	n, r.remaining, r.exceeded = int(r.remaining), 0, true
+	return n, &DownloadTooLargeError{Limit: r.limit, ContentLength: -1}
+}
+
+// errNotReplayable is returned when a streamed upload body is read a second time
+var errNotReplayable = errors.New("streamed upload content cannot be read again")
+
+// heldBody is the content of a download held for its upload. Memory and spooled content can be
+// read again for every upload attempt; streamed content can only be read once.
+type heldBody struct {
+	mode   string
+	size   int64
+	data   []byte
+	file   *os.File
+	stream *receivingReader
+	read   bool
+	hasher hash.Hash
+	close  func()
+}
+
+// hold takes the content of a download. Content of a known length that fits the remaining budget is
+// read into memory; other content is spooled to a temporary file when a spool directory is set and
+// streamed otherwise. Content larger than the maximum download size is refused with a
+// *DownloadTooLargeError. The held body must be closed, which returns its bytes to the budget.
+func (b *BufferBudget) hold(body io.Reader, contentLength int64) (*heldBody, error) {
+	body, err := b.limit(body, contentLength)
+	if err != nil {
+		return nil, err
+	}
+	hasher := sha256.New()
+	if contentLength >= 0 && b.tryAcquire(contentLength) {
+		held := &heldBody{mode: HoldMemory, size: contentLength, hasher: hasher, close: func() { b.release(contentLength) }}
+		held.data = make([]byte, contentLength)
+		if n, err := io.ReadFull(io.TeeReader(body, hasher), held.data); err != nil {
+			held.Close()
+			return nil, fmt.Errorf("download ended after %d of %d bytes: %w", n, contentLength, err)
+		}
+		// Content beyond the declared length would not be uploaded
+		if n, _ := body.Read(make([]byte, 1)); n > 0 {
+			held.Close()
+			return nil, fmt.Errorf("download is longer than its Content-Length of %d bytes", contentLength)
+		}
+		return held, nil
+	}
+
+	if b.spoolDir != "" {
+		file, err := os.CreateTemp(b.spoolDir, "opus-mcp-upload-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create spool file: %w", err)
+		}
+		held := &heldBody{mode: HoldSpool, file: file, hasher: hasher, close: func() {
+			file.Close()
+			if err := os.Remove(file.Name()); err != nil {
+				slog.Warn("Failed to remove spool file", "file", file.Name(), "error", err)
+			}
+		}}
+		held.size, err = io.Copy(io.MultiWriter(file, hasher), body)
+		if err != nil {
+			held.Close()
+			return nil, fmt.Errorf("failed to spool download after %d bytes: %w", held.size, err)
+		}
+		if contentLength >= 0 && held.size != contentLength {
+			held.Close()
+			return nil, fmt.Errorf("download is incomplete: expected %d bytes, received %d", contentLength, held.size)
+		}
+		return held, nil
+	}
+
+	return &heldBody{mode: HoldStream, size: contentLength, stream: &receivingReader{reader: io.TeeReader(body, hasher)}, hasher: hasher, close: func() {}}, nil
+}
+
+// receivingReader counts the bytes read from a download and records the error that ended it, since
+// an upload may stop reading at an error without failing, e.g., S3 clients treat an unexpected EOF
+// of content of unknown length as its end
+type receivingReader struct {
+	reader   io.Reader
+	received int64
+	err      error
+}
+
+func (r *receivingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.received += int64(n)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// verify checks that the whole download was received: that reading it did not fail and that the
+// uploaded size matches its Content-Length, when the server sent one
+func (r *receivingReader) verify(contentLength, uploaded int64) error {
+	if r.err != nil {
+		return fmt.Errorf("download ended after %d bytes: %w", r.received, r.err)
+	}
+	return verifyUploadedSize(contentLength, uploaded)
+}
+
+// verifyUploadedSize checks that the uploaded size matches the Content-Length of the download, if any
+func verifyUploadedSize(contentLength, uploaded int64) error {
+	if contentLength >= 0 && uploaded != contentLength {
+		return fmt.Errorf("download is incomplete: expected %d bytes, received %d", contentLength, uploaded)
+	}
+	return nil
+}
+
+// replayable reports whether the content can be uploaded again after a failed attempt
+func (h *heldBody) replayable() bool {
+	return h.mode != HoldStream
+}
+
+// reader returns a reader over the whole content, for a new upload attempt
+func (h *heldBody) reader() (io.Reader, error) {
+	switch h.mode {
+	case HoldMemory:
+		return bytes.NewReader(h.data), nil
+	case HoldSpool:
+		if _, err := h.file.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to rewind spool file: %w", err)
+		}
+		return h.file, nil
+	}
+	if h.read {
+		return nil, errNotReplayable
+	}
+	h.read = true
+	return h.stream, nil
+}
+
+// sha256 returns the lowercase hex-encoded SHA-256 digest of the content; streamed content is only
+// hashed once it has been uploaded
+func (h *heldBody) sha256() string {
+	return hex.EncodeToString(h.hasher.Sum(nil))
+}
+
+// verify checks that the whole download was received, which for memory and spooled content was
+// already checked while holding it
+func (h *heldBody) verify(contentLength, uploaded int64) error {
+	if h.stream != nil {
+		return h.stream.verify(contentLength, uploaded)
+	}
+	return verifyUploadedSize(contentLength, uploaded)
+}
+
+// Close releases the content, returning its bytes to the budget or removing its spool file
+func (h *heldBody) Close() {
+	if h.close != nil {
+		h.close()
+		h.close = nil
+	}
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBufferBudgetCapsConcurrentTransfers(t *testing.T) {
+	const budget = 1 << 20
+	const transferSize = 300 << 10
+	spoolDir := t.TempDir()
+	buffers := NewBufferBudget(budget, spoolDir)
+
+	content := bytes.Repeat([]byte("%PDF"), transferSize/4)
+	digest := sha256.Sum256(content)
+
+	// Every transfer holds its content until all of them have taken theirs
+	const transfers = 8
+	var mu sync.Mutex
+	modes := map[string]int{}
+	var held sync.WaitGroup
+	held.Add(transfers)
+	release := make(chan struct{})
+	var done sync.WaitGroup
+	for range transfers {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			body, err := buffers.hold(bytes.NewReader(content), transferSize)
+			if err != nil {
+				t.Errorf("hold() unexpected error: %v", err)
+				held.Done()
+				return
+			}
+			defer body.Close()
+			if got := buffers.Buffered(); got > budget {
+				t.Errorf("buffered bytes = %d, exceeding the budget of %d", got, budget)
+			}
+			mu.Lock()
+			modes[body.mode]++
+			mu.Unlock()
+			held.Done()
+			<-release
+
+			// Held content can be read for every upload attempt
+			for attempt := 1; attempt <= 2; attempt++ {
+				reader, err := body.reader()
+				if err != nil {
+					t.Errorf("reader() attempt %d unexpected error: %v", attempt, err)
+					return
+				}
+				data, err := io.ReadAll(reader)
+				if err != nil || !bytes.Equal(data, content) {
+					t.Errorf("attempt %d read %d bytes (error %v), want the whole content", attempt, len(data), err)
+				}
+			}
+			if body.sha256() != hex.EncodeToString(digest[:]) {
+				t.Errorf("sha256() = %s, want the digest of the content", body.sha256())
+			}
+		}()
+	}
+	held.Wait()
+	if got := buffers.Buffered(); got != 3*transferSize {
+		t.Errorf("buffered bytes with every transfer held = %d, want %d", got, 3*transferSize)
+	}
+	close(release)
+	done.Wait()
+
+	if modes[HoldMemory] != 3 || modes[HoldSpool] != transfers-3 {
+		t.Errorf("transfers held by mode = %v, want 3 in memory and the rest spooled", modes)
+	}
+	if got := buffers.Buffered(); got != 0 {
+		t.Errorf("buffered bytes after all transfers = %d, want 0", got)
+	}
+	entries, err := os.ReadDir(spoolDir)
+	if err != nil {
+		t.Fatalf("failed to read spool directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("spool directory holds %d files after all transfers, want none", len(entries))
+	}
+}
+
+func TestBufferBudgetStreamsWithoutSpoolDir(t *testing.T) {
+	buffers := NewBufferBudget(4, "")
+
+	// Content of unknown length, or larger than the budget, is streamed and can only be read once
+	for _, length := range []int64{-1, 11} {
+		body, err := buffers.hold(strings.NewReader("hello world"), length)
+		if err != nil {
+			t.Fatalf("hold() unexpected error: %v", err)
+		}
+		if body.mode != HoldStream || body.replayable() {
+			t.Errorf("content of length %d held as %s, want it streamed", length, body.mode)
+		}
+		reader, err := body.reader()
+		if err != nil {
+			t.Fatalf("reader() unexpected error: %v", err)
+		}
+		if data, _ := io.ReadAll(reader); string(data) != "hello world" {
+			t.Errorf("streamed content = %q", data)
+		}
+		if _, err := body.reader(); !errors.Is(err, errNotReplayable) {
+			t.Errorf("second reader() error = %v, want %v", err, errNotReplayable)
+		}
+		body.Close()
+	}
+	if got := buffers.Buffered(); got != 0 {
+		t.Errorf("buffered bytes = %d, want 0", got)
+	}
+}
+
+func TestBufferBudgetRejectsContentLongerThanDeclared(t *testing.T) {
+	buffers := NewBufferBudget(1<<10, "")
+	if _, err := buffers.hold(strings.NewReader("more than declared"), 4); err == nil {
+		t.Error("hold() of content longer than its Content-Length should fail")
+	}
+	if _, err := buffers.hold(strings.NewReader("short"), 10); err == nil {
+		t.Error("hold() of content shorter than its Content-Length should fail")
+	}
+	if got := buffers.Buffered(); got != 0 {
+		t.Errorf("buffered bytes after failed holds = %d, want 0", got)
+	}
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrCapacityUnsupported is returned by capacity probes on backends that cannot report capacity
+var ErrCapacityUnsupported = errors.New("storage backend does not report capacity")
+
+// Capacity is a snapshot of the space available to storage
+type Capacity struct {
+	// TotalBytes is the size of the storage
+	TotalBytes uint64 `json:"totalBytes"`
+	// FreeBytes is the space available for new objects
+	FreeBytes uint64 `json:"freeBytes"`
+}
+
+// CapacityProber reports the capacity of a storage backend
+type CapacityProber interface {
+	Capacity(ctx context.Context) (Capacity, error)
+}
+
+// FilesystemProber reports the capacity of the filesystem holding a directory, e.g., the data
+// directory of a MinIO server running on the same host
+type FilesystemProber struct {
+	Path string
+}
+
+// statfs returns the capacity of the filesystem holding a path; replaced in tests
+var statfs = filesystemCapacity
+
+// Capacity returns the capacity of the filesystem, counting as free only the space available to
+// unprivileged users
+func (p *FilesystemProber) Capacity(ctx context.Context) (Capacity, error) {
+	capacity, err := statfs(p.Path)
+	if err != nil {
+		if errors.Is(err, ErrCapacityUnsupported) {
+			return Capacity{}, err
+		}
+		return Capacity{}, fmt.Errorf("failed to read filesystem capacity of %s: %w", p.Path, err)
+	}
+	return capacity, nil
+}
+
+// S3Prober reports the capacity of S3 storage. The S3 API has no capacity or quota call (MinIO
+// only exposes them through its admin API), so it always reports ErrCapacityUnsupported.
+type S3Prober struct{}
+
+// Capacity always returns ErrCapacityUnsupported
+func (S3Prober) Capacity(ctx context.Context) (Capacity, error) {
+	return Capacity{}, ErrCapacityUnsupported
+}
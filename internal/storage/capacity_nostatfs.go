@@ -0,0 +1,7 @@
+//go:build !(linux || darwin || freebsd)
+
+package storage
+
+func filesystemCapacity(path string) (Capacity, error) {
+	return Capacity{}, ErrCapacityUnsupported
+}
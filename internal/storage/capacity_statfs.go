@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd
+
+package storage
+
+import "syscall"
+
+func filesystemCapacity(path string) (Capacity, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return Capacity{}, err
+	}
+	blockSize := uint64(stat.Bsize)
+	return Capacity{
+		TotalBytes: uint64(stat.Blocks) * blockSize,
+		FreeBytes:  uint64(stat.Bavail) * blockSize,
+	}, nil
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFilesystemProber(t *testing.T) {
+	prober := &FilesystemProber{Path: t.TempDir()}
+	capacity, err := prober.Capacity(context.Background())
+	if errors.Is(err, ErrCapacityUnsupported) {
+		t.Skip("filesystem capacity is not supported on this platform")
+	}
+	if err != nil {
+		t.Fatalf("Capacity() unexpected error: %v", err)
+	}
+	if capacity.TotalBytes == 0 || capacity.FreeBytes > capacity.TotalBytes {
+		t.Errorf("Capacity() = %+v, want a non-empty filesystem with free space at most its size", capacity)
+	}
+
+	if _, err := (&FilesystemProber{Path: "/nonexistent/opus-mcp"}).Capacity(context.Background()); err == nil || errors.Is(err, ErrCapacityUnsupported) {
+		t.Errorf("Capacity() for a missing directory error = %v, want a probe failure", err)
+	}
+}
+
+func TestFilesystemProberUsesStatfs(t *testing.T) {
+	original := statfs
+	t.Cleanup(func() { statfs = original })
+
+	// A 1 MiB filesystem with 4 KiB left
+	statfs = func(path string) (Capacity, error) {
+		return Capacity{TotalBytes: 1 << 20, FreeBytes: 4 << 10}, nil
+	}
+	capacity, err := (&FilesystemProber{Path: "/data"}).Capacity(context.Background())
+	if err != nil || capacity.FreeBytes != 4<<10 {
+		t.Errorf("Capacity() = %+v, %v, want 4096 bytes free", capacity, err)
+	}
+}
+
+func TestS3ProberIsUnsupported(t *testing.T) {
+	if _, err := (S3Prober{}).Capacity(context.Background()); !errors.Is(err, ErrCapacityUnsupported) {
+		t.Errorf("Capacity() error = %v, want ErrCapacityUnsupported", err)
+	}
+}
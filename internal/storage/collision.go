@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// CollisionPolicy decides what an upload does when an object with its name already exists
+type CollisionPolicy string
+
+const (
+	// CollisionError refuses the upload with a ConflictError
+	CollisionError CollisionPolicy = "error"
+	// CollisionOverwrite replaces the existing object
+	CollisionOverwrite CollisionPolicy = "overwrite"
+	// CollisionRename stores the upload under its name with a suffix derived from its content
+	CollisionRename CollisionPolicy = "rename"
+)
+
+// CollisionPolicies are the valid collision policies
+var CollisionPolicies = []CollisionPolicy{CollisionError, CollisionOverwrite, CollisionRename}
+
+// hashSuffixLength is the number of hex characters of the content digest appended by CollisionRename
+const hashSuffixLength = 12
+
+// ConflictError is returned when an upload's object name is taken and the collision policy is
+// CollisionError
+type ConflictError struct {
+	Bucket     string
+	ObjectName string
+	// SourceURL is where the existing object was downloaded from, if its metadata records it
+	SourceURL string
+}
+
+func (e *ConflictError) Error() string {
+	message := fmt.Sprintf("object '%s' already exists in bucket '%s'", e.ObjectName, e.Bucket)
+	if e.SourceURL != "" {
+		message += fmt.Sprintf(", downloaded from %s", e.SourceURL)
+	}
+	return message
+}
+
+// HashedObjectName inserts a prefix of a content digest before the extension of an object name,
+// e.g., web/paper.pdf becomes web/paper-0123456789ab.pdf
+func HashedObjectName(objectName, sha256 string) string {
+	suffix := "-" + sha256[:min(hashSuffixLength, len(sha256))]
+	ext := path.Ext(objectName)
+	// A name that is all extension, e.g., .env, has none
+	if ext == "" || ext == path.Base(objectName) {
+		return objectName + suffix
+	}
+	return strings.TrimSuffix(objectName, ext) + suffix + ext
+}
+
+// checkCollision looks up the object an upload would replace and applies the collision policy: it
+// returns a ConflictError under CollisionError, and reports under CollisionRename whether the
+// upload has to be renamed. Under CollisionOverwrite, nothing is looked up.
+func checkCollision(ctx context.Context, minioClient *minio.Client, bucketName, objectName string, policy CollisionPolicy) (bool, error) {
+	switch policy {
+	case CollisionOverwrite:
+		return false, nil
+	case CollisionError, CollisionRename:
+	default:
+		return false, fmt.Errorf("unknown collision policy %q", policy)
+	}
+
+	var info minio.ObjectInfo
+	var err error
+	err = withS3Retry(ctx, "stat_object", func() error {
+		info, err = minioClient.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check for an existing object: %w", err)
+	}
+	if policy == CollisionRename {
+		return true, nil
+	}
+	conflict := &ConflictError{Bucket: bucketName, ObjectName: objectName}
+	for key, value := range info.UserMetadata {
+		if strings.EqualFold(key, "source-url") {
+			if decoded, err := new(mime.WordDecoder).DecodeHeader(value); err == nil {
+				value = decoded
+			}
+			conflict.SourceURL = value
+		}
+	}
+	return false, conflict
+}
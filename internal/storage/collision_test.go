@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHashedObjectName(t *testing.T) {
+	const digest = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name       string
+		objectName string
+		want       string
+	}{
+		{"before the extension", "web/paper.pdf", "web/paper-0123456789ab.pdf"},
+		{"only the last extension", "web/data.tar.gz", "web/data.tar-0123456789ab.gz"},
+		{"without extension", "web/README", "web/README-0123456789ab"},
+		{"dotted directory", "web/v1.2/README", "web/v1.2/README-0123456789ab"},
+		{"name that is all extension", "web/.env", "web/.env-0123456789ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HashedObjectName(tt.objectName, digest); got != tt.want {
+				t.Errorf("HashedObjectName(%q) = %q, want %q", tt.objectName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransferURLToObjectCollisionPolicies(t *testing.T) {
+	withoutRetryDelay(t)
+	const content = "%PDF-1.7"
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte(content))
+	}))
+	defer source.Close()
+	digest := sha256.Sum256([]byte(content))
+	renamed := HashedObjectName("web/paper.pdf", hex.EncodeToString(digest[:]))
+
+	tests := []struct {
+		name         string
+		policy       CollisionPolicy
+		exists       bool
+		wantUpload   string
+		wantConflict bool
+	}{
+		{"error on a free name", CollisionError, false, "web/paper.pdf", false},
+		{"error on a taken name", CollisionError, true, "", true},
+		{"overwrite a taken name", CollisionOverwrite, true, "web/paper.pdf", false},
+		{"rename on a free name", CollisionRename, false, "web/paper.pdf", false},
+		{"rename on a taken name", CollisionRename, true, renamed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withUploadBuffers(t, NewBufferBudget(1<<20, ""))
+			store, client := newFakeObjectStore(t)
+			if tt.exists {
+				store.existing["/bucket/web/paper.pdf"] = map[string]string{"Source-Url": "https://example.org/paper.pdf"}
+			}
+
+			result, err := transferURLToObject(context.Background(), http.DefaultClient, client, source.URL, "bucket", "web/paper.pdf", nil, tt.policy)
+			var conflict *ConflictError
+			if tt.wantConflict {
+				if !errors.As(err, &conflict) {
+					t.Fatalf("transferURLToObject() error = %v, want a ConflictError", err)
+				}
+				if conflict.ObjectName != "web/paper.pdf" || conflict.SourceURL != "https://example.org/paper.pdf" {
+					t.Errorf("conflict = %+v, want the taken name and the existing object's source URL", conflict)
+				}
+			} else if err != nil {
+				t.Fatalf("transferURLToObject() unexpected error: %v", err)
+			}
+
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			if tt.wantUpload == "" {
+				if len(store.uploads) != 0 {
+					t.Errorf("uploaded %v, want nothing", store.uploads)
+				}
+				return
+			}
+			if len(store.uploads) != 1 || store.uploads[0] != "/bucket/"+tt.wantUpload {
+				t.Errorf("uploaded %v, want /bucket/%s", store.uploads, tt.wantUpload)
+			}
+			wantRequested := ""
+			if tt.wantUpload != "web/paper.pdf" {
+				wantRequested = "web/paper.pdf"
+			}
+			if result.RequestedName != wantRequested {
+				t.Errorf("RequestedName = %q, want %q", result.RequestedName, wantRequested)
+			}
+		})
+	}
+}
+
+func TestTransferURLToObjectRefusesToRenameStreamedContent(t *testing.T) {
+	withUploadBuffers(t, NewBufferBudget(0, ""))
+	store, client := newFakeObjectStore(t)
+	store.existing["/bucket/web/paper.pdf"] = map[string]string{}
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("%PDF-1.7"))
+	}))
+	defer source.Close()
+
+	if _, err := transferURLToObject(context.Background(), http.DefaultClient, client, source.URL, "bucket", "web/paper.pdf", nil, CollisionRename); err == nil {
+		t.Fatal("transferURLToObject() renaming streamed content should fail")
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.uploads) != 0 {
+		t.Errorf("uploaded %v, want nothing", store.uploads)
+	}
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFilenameLength caps a Content-Disposition filename, in bytes, like common file systems do
+const maxFilenameLength = 255
+
+// originalFilenameMetadataKey is the user metadata key recording the filename that the server of a
+// download named in its Content-Disposition header
+const originalFilenameMetadataKey = "original-filename"
+
+// DispositionFilename returns the filename named by a Content-Disposition header value, preferring
+// an RFC 5987 encoded filename* parameter over a plain filename. The filename is controlled by the
+// remote server and is sanitized: only its last path element is kept, control characters are
+// removed and it is truncated to 255 bytes, keeping its extension. It returns an empty string when
+// the header is missing, malformed or names no usable filename.
+func DispositionFilename(header string) string {
+	if strings.TrimSpace(header) == "" {
+		return ""
+	}
+	// The mime package decodes filename* into filename
+	_, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return ""
+	}
+	return sanitizeFilename(params["filename"])
+}
+
+// sanitizeFilename reduces a filename chosen by a remote server to a single harmless path element
+func sanitizeFilename(name string) string {
+	name = strings.ToValidUTF8(name, "")
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	// Neither slashes nor backslashes may reach a path, whichever platform the name ends up on
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	if name == "" {
+		return ""
+	}
+	if len(name) <= maxFilenameLength {
+		return name
+	}
+	ext := filepath.Ext(name)
+	if len(ext) > maxFilenameLength/4 {
+		ext = ""
+	}
+	stem := name[:maxFilenameLength-len(ext)]
+	for !utf8.ValidString(stem) {
+		stem = stem[:len(stem)-1]
+	}
+	return stem + ext
+}
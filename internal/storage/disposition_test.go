@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDispositionFilename(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"arXiv PDF", `inline; filename="2405.12345v2.pdf"`, "2405.12345v2.pdf"},
+		{"unquoted", `attachment; filename=2405.12345v2.pdf`, "2405.12345v2.pdf"},
+		{"RFC 5987 encoded", `attachment; filename*=UTF-8''%C3%9Cber%20Graphen%20v2.pdf`, "Über Graphen v2.pdf"},
+		{"RFC 5987 with a language", `attachment; filename*=utf-8'en'Na%C3%AFve%20Bayes.pdf`, "Naïve Bayes.pdf"},
+		{"RFC 5987 preferred over plain", `attachment; filename="fallback.pdf"; filename*=UTF-8''%E8%AB%96%E6%96%87.pdf`, "論文.pdf"},
+		{"missing", "", ""},
+		{"no filename", "inline", ""},
+		{"malformed", `attachment; filename="unterminated`, ""},
+		{"malformed encoding", `attachment; filename*=UTF-8''%ZZ.pdf`, ""},
+		// Hostile values are reduced to a harmless last path element
+		{"path traversal", `attachment; filename="../../etc/passwd"`, "passwd"},
+		{"absolute path", `attachment; filename="/var/lib/opus-mcp/secret.pdf"`, "secret.pdf"},
+		{"windows path", `attachment; filename="..\\..\\boot.ini"`, "boot.ini"},
+		{"encoded traversal", `attachment; filename*=UTF-8''..%2F..%2Fpaper.pdf`, "paper.pdf"},
+		{"dot dot", `attachment; filename=".."`, ""},
+		{"hidden file", `attachment; filename=".bashrc"`, "bashrc"},
+		{"trailing separator", `attachment; filename="papers/"`, ""},
+		{"control characters", "attachment; filename*=UTF-8''paper%0D%0AX-Injected%3A%20yes.pdf", "paperX-Injected: yes.pdf"},
+		{"NUL byte", "attachment; filename*=UTF-8''paper%00.pdf.exe", "paper.pdf.exe"},
+		{"invalid UTF-8", "attachment; filename*=UTF-8''paper%FF.pdf", "paper.pdf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DispositionFilename(tt.header); got != tt.want {
+				t.Errorf("DispositionFilename(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispositionFilenameTruncatesOverlongNames(t *testing.T) {
+	for _, stem := range []string{strings.Repeat("a", 1000), strings.Repeat("é", 500)} {
+		got := DispositionFilename(`attachment; filename="` + stem + `.pdf"`)
+		if len(got) > maxFilenameLength || !utf8.ValidString(got) {
+			t.Errorf("filename of %d bytes truncated to %d bytes (valid UTF-8: %v), want at most %d", len(stem)+4, len(got), utf8.ValidString(got), maxFilenameLength)
+		}
+		if !strings.HasSuffix(got, ".pdf") {
+			t.Errorf("truncated filename %q lost its extension", got)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Errors of S3 operations that callers branch on. They are returned wrapped together with the S3
+// error response they were classified from, so that both errors.Is and errors.As work.
+var (
+	// ErrBucketNotFound is returned when the bucket of an operation does not exist
+	ErrBucketNotFound = errors.New("bucket not found")
+	// ErrObjectNotFound is returned when a requested object does not exist in the bucket
+	ErrObjectNotFound = errors.New("object not found")
+	// ErrQuotaExceeded is returned when storage refused a write for lack of space or quota
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+	// ErrAccessDenied is returned when the configured credentials are refused or lack permission
+	ErrAccessDenied = errors.New("access denied")
+	// ErrChecksumMismatch is returned when storage found the uploaded content to differ from its digest
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// s3ErrorKinds maps the S3 error codes that callers branch on to their errors
+var s3ErrorKinds = map[string]error{
+	"NoSuchBucket":                   ErrBucketNotFound,
+	"NoSuchKey":                      ErrObjectNotFound,
+	"QuotaExceeded":                  ErrQuotaExceeded,
+	"XMinioAdminBucketQuotaExceeded": ErrQuotaExceeded,
+	"XMinioStorageFull":              ErrQuotaExceeded,
+	"AccessDenied":                   ErrAccessDenied,
+	"AllAccessDisabled":              ErrAccessDenied,
+	"InvalidAccessKeyId":             ErrAccessDenied,
+	"SignatureDoesNotMatch":          ErrAccessDenied,
+	"ExpiredToken":                   ErrAccessDenied,
+	"InvalidToken":                   ErrAccessDenied,
+	"BadDigest":                      ErrChecksumMismatch,
+	"InvalidDigest":                  ErrChecksumMismatch,
+	"XAmzContentSHA256Mismatch":      ErrChecksumMismatch,
+}
+
+// classifyError wraps an error carrying an S3 error response with the error its code maps to.
+// Other errors, S3 error codes that map to nothing and errors classified before are returned
+// unchanged.
+func classifyError(err error) error {
+	var errResp minio.ErrorResponse
+	if !errors.As(err, &errResp) {
+		return err
+	}
+	kind, ok := s3ErrorKinds[errResp.Code]
+	if !ok || errors.Is(err, kind) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestClassifyError(t *testing.T) {
+	sentinels := []error{ErrBucketNotFound, ErrObjectNotFound, ErrQuotaExceeded, ErrAccessDenied, ErrChecksumMismatch}
+	tests := []struct {
+		code   string
+		status int
+		want   error
+	}{
+		{"NoSuchBucket", http.StatusNotFound, ErrBucketNotFound},
+		{"NoSuchKey", http.StatusNotFound, ErrObjectNotFound},
+		{"QuotaExceeded", http.StatusForbidden, ErrQuotaExceeded},
+		{"XMinioAdminBucketQuotaExceeded", http.StatusBadRequest, ErrQuotaExceeded},
+		{"XMinioStorageFull", http.StatusInsufficientStorage, ErrQuotaExceeded},
+		{"AccessDenied", http.StatusForbidden, ErrAccessDenied},
+		{"AllAccessDisabled", http.StatusForbidden, ErrAccessDenied},
+		{"InvalidAccessKeyId", http.StatusForbidden, ErrAccessDenied},
+		{"SignatureDoesNotMatch", http.StatusForbidden, ErrAccessDenied},
+		{"ExpiredToken", http.StatusBadRequest, ErrAccessDenied},
+		{"InvalidToken", http.StatusBadRequest, ErrAccessDenied},
+		{"BadDigest", http.StatusBadRequest, ErrChecksumMismatch},
+		{"InvalidDigest", http.StatusBadRequest, ErrChecksumMismatch},
+		{"XAmzContentSHA256Mismatch", http.StatusBadRequest, ErrChecksumMismatch},
+		// Codes callers do not branch on map to no sentinel
+		{"MalformedXML", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			errResp := minio.ErrorResponse{Code: tt.code, StatusCode: tt.status}
+			err := classifyError(fmt.Errorf("failed to upload object: %w", errResp))
+			for _, sentinel := range sentinels {
+				if errors.Is(err, sentinel) != (sentinel == tt.want) {
+					t.Errorf("classifyError() = %v, errors.Is(%v) = %v", err, sentinel, !(sentinel == tt.want))
+				}
+			}
+			// The S3 error response stays reachable, e.g., for the retry classification
+			var got minio.ErrorResponse
+			if !errors.As(err, &got) || got.Code != tt.code {
+				t.Errorf("classifyError() = %v, want it to wrap the %s error response", err, tt.code)
+			}
+		})
+	}
+
+	// Errors that are not S3 error responses, and errors classified before, are returned unchanged
+	plain := errors.New("HTTP request failed with status 503")
+	if err := classifyError(plain); err != plain {
+		t.Errorf("classifyError() = %v, want the error unchanged", err)
+	}
+	classified := classifyError(minio.ErrorResponse{Code: "NoSuchKey"})
+	if err := classifyError(classified); err != classified {
+		t.Errorf("classifyError() = %v, want a classified error unchanged", err)
+	}
+	if classifyError(nil) != nil {
+		t.Error("classifyError(nil) should be nil")
+	}
+}
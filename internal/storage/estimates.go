@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// estimateSmoothing is the weight of the newest download in the transfer estimates, so that the
+// last handful of downloads dominate and the estimates follow changes in the network within minutes
+const estimateSmoothing = 0.3
+
+// ewma is an exponentially weighted moving average
+type ewma struct {
+	value   float64
+	samples int
+}
+
+func (e *ewma) add(sample float64) {
+	if e.samples == 0 {
+		e.value = sample
+	} else {
+		e.value += estimateSmoothing * (sample - e.value)
+	}
+	e.samples++
+}
+
+// TransferEstimator keeps rolling estimates of the phases of recent downloads, from which the
+// duration of the next ones can be predicted
+type TransferEstimator struct {
+	mu     sync.Mutex
+	ttfb   ewma
+	origin ewma
+	upload ewma
+	size   ewma
+}
+
+// Transfers is the estimator fed by every finished download
+var Transfers = &TransferEstimator{}
+
+// Observe adds the phase timings of a finished download to the estimates. Phases without a
+// measurable rate, e.g., an empty body, leave the throughput estimates untouched.
+func (e *TransferEstimator) Observe(t TransferTimings) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ttfb.add(t.OriginTTFB.Seconds())
+	if rate := t.OriginThroughput(); rate > 0 {
+		e.origin.add(rate)
+	}
+	if rate := t.UploadThroughput(); rate > 0 {
+		e.upload.add(rate)
+	}
+	if t.OriginBytes > 0 {
+		e.size.add(float64(t.OriginBytes))
+	}
+}
+
+// TransferEstimate is a snapshot of the rolling estimates of recent downloads
+type TransferEstimate struct {
+	// Samples is the number of downloads the estimates are based on
+	Samples              int
+	OriginTTFB           time.Duration
+	OriginBytesPerSecond float64
+	UploadBytesPerSecond float64
+	// TypicalBytes is the smoothed size of recent downloads, used when a download's size is unknown
+	TypicalBytes float64
+}
+
+// Estimate returns the current estimates, or false if no download has measured both the origin
+// and the S3 throughput yet
+func (e *TransferEstimator) Estimate() (TransferEstimate, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.origin.samples == 0 || e.upload.samples == 0 {
+		return TransferEstimate{}, false
+	}
+	return TransferEstimate{
+		Samples:              e.ttfb.samples,
+		OriginTTFB:           time.Duration(e.ttfb.value * float64(time.Second)),
+		OriginBytesPerSecond: e.origin.value,
+		UploadBytesPerSecond: e.upload.value,
+		TypicalBytes:         e.size.value,
+	}, true
+}
+
+// Duration estimates how long downloading and storing size bytes takes: the time to the origin's
+// first byte, then reading and uploading one after the other, as for downloads held for retryable
+// uploads. A size that is not positive, e.g., an unknown Content-Length, is taken to be typical.
+func (e TransferEstimate) Duration(size int64) time.Duration {
+	bytes := float64(size)
+	if size <= 0 {
+		bytes = e.TypicalBytes
+	}
+	seconds := bytes/e.OriginBytesPerSecond + bytes/e.UploadBytesPerSecond
+	return e.OriginTTFB + time.Duration(seconds*float64(time.Second))
+}
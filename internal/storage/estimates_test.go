@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTransferEstimator(t *testing.T) {
+	var e TransferEstimator
+	if _, ok := e.Estimate(); ok {
+		t.Fatal("Estimate() without history reported estimates")
+	}
+
+	// 1 MB in 1 s from the origin and 0.5 s to S3, then 1 MB in 0.25 s and 0.5 s
+	e.Observe(TransferTimings{OriginTTFB: 200 * time.Millisecond, OriginTransfer: time.Second, OriginBytes: 1_000_000, Upload: 500 * time.Millisecond, UploadBytes: 1_000_000})
+	e.Observe(TransferTimings{OriginTTFB: 400 * time.Millisecond, OriginTransfer: 250 * time.Millisecond, OriginBytes: 1_000_000, Upload: 500 * time.Millisecond, UploadBytes: 1_000_000})
+	// An empty body measures no throughput
+	e.Observe(TransferTimings{OriginTTFB: 400 * time.Millisecond})
+
+	got, ok := e.Estimate()
+	if !ok {
+		t.Fatal("Estimate() after three downloads reported no estimates")
+	}
+	// Origin: 1e6 + 0.3*(4e6-1e6); upload: 2e6 throughout; TTFB: 0.2, then 0.26, then 0.26 + 0.3*(0.4-0.26)
+	want := TransferEstimate{
+		Samples:              3,
+		OriginTTFB:           302 * time.Millisecond,
+		OriginBytesPerSecond: 1_900_000,
+		UploadBytesPerSecond: 2_000_000,
+		TypicalBytes:         1_000_000,
+	}
+	if got.Samples != want.Samples || !near(got.OriginBytesPerSecond, want.OriginBytesPerSecond) || !near(got.UploadBytesPerSecond, want.UploadBytesPerSecond) ||
+		!near(got.TypicalBytes, want.TypicalBytes) || got.OriginTTFB.Round(time.Millisecond) != want.OriginTTFB {
+		t.Errorf("Estimate() = %+v, want %+v", got, want)
+	}
+}
+
+func TestTransferEstimateDuration(t *testing.T) {
+	estimate := TransferEstimate{
+		OriginTTFB:           time.Second,
+		OriginBytesPerSecond: 2_000_000,
+		UploadBytesPerSecond: 4_000_000,
+		TypicalBytes:         1_000_000,
+	}
+	tests := []struct {
+		name string
+		size int64
+		want time.Duration
+	}{
+		// 1 s + 8 MB / 2 MB/s + 8 MB / 4 MB/s
+		{"known size", 8_000_000, 7 * time.Second},
+		// 1 s + 1 MB / 2 MB/s + 1 MB / 4 MB/s
+		{"unknown size", 0, 1750 * time.Millisecond},
+		{"negative size", -1, 1750 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimate.Duration(tt.size); got != tt.want {
+				t.Errorf("Duration(%d) = %s, want %s", tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func near(got, want float64) bool {
+	return math.Abs(got-want) < 1e-6*want
+}
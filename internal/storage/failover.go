@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"opus-mcp/internal/metrics"
+)
+
+// ErrEndpointInactive is returned for a request of an S3 client bound to an endpoint that is no
+// longer the active one, so that an operation never continues on another site than it started on
+var ErrEndpointInactive = errors.New("S3 endpoint is no longer active")
+
+// defaultFailoverThreshold is the number of consecutive failures demoting an endpoint when the
+// configuration does not set one
+const defaultFailoverThreshold = 3
+
+// endpointProbeTimeout bounds a probe of a demoted endpoint
+const endpointProbeTimeout = 5 * time.Second
+
+// endpointPool tracks the health of the endpoints of an S3 configuration. Operations are performed
+// against a single active endpoint at a time: the first healthy one in order of preference. An
+// endpoint whose requests fail FailoverThreshold times in a row is demoted and the next healthy one
+// becomes active; demoted endpoints are probed and, once they answer again, restored, taking over
+// again if they are preferred. It is safe for concurrent use.
+type endpointPool struct {
+	mu        sync.Mutex
+	endpoints []string
+	threshold int
+	active    int
+	failures  []int
+	demoted   []bool
+}
+
+var (
+	endpointPoolsMu sync.Mutex
+	// endpointPools holds the pool of every endpoint list, so that all operations share its health
+	endpointPools = map[string]*endpointPool{}
+)
+
+// endpointPoolFor returns the pool of the endpoints of a configuration, creating it on first use
+func endpointPoolFor(config *S3Config) *endpointPool {
+	endpointPoolsMu.Lock()
+	defer endpointPoolsMu.Unlock()
+	if pool, ok := endpointPools[config.Endpoint]; ok {
+		return pool
+	}
+	endpoints := config.Endpoints()
+	if len(endpoints) == 0 {
+		// minio.New reports the missing endpoint
+		endpoints = []string{""}
+	}
+	threshold := config.FailoverThreshold
+	if threshold < 1 {
+		threshold = defaultFailoverThreshold
+	}
+	pool := &endpointPool{
+		endpoints: endpoints,
+		threshold: threshold,
+		failures:  make([]int, len(endpoints)),
+		demoted:   make([]bool, len(endpoints)),
+	}
+	pool.recordActive()
+	endpointPools[config.Endpoint] = pool
+	return pool
+}
+
+// activeEndpoint returns the endpoint operations are performed against
+func (p *endpointPool) activeEndpoint() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.endpoints[p.active]
+}
+
+// recordActive publishes the active endpoint in the metrics; the caller holds the lock or owns the pool
+func (p *endpointPool) recordActive() {
+	for i, endpoint := range p.endpoints {
+		value := 0.0
+		if i == p.active {
+			value = 1
+		}
+		metrics.S3ActiveEndpoint.WithLabelValues(endpoint).Set(value)
+	}
+}
+
+// switchTo makes the endpoint at index i active; the caller holds the lock
+func (p *endpointPool) switchTo(i int) {
+	from := p.endpoints[p.active]
+	p.active = i
+	p.recordActive()
+	metrics.S3FailoversTotal.WithLabelValues(from, p.endpoints[i]).Inc()
+}
+
+// observe records the outcome of a request to an endpoint. A request that failed in the active
+// endpoint's turn counts towards demoting it; outcomes of other endpoints no longer matter.
+func (p *endpointPool) observe(endpoint string, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.endpoints[p.active] != endpoint {
+		return
+	}
+	if !failed {
+		p.failures[p.active] = 0
+		return
+	}
+	p.failures[p.active]++
+	if p.failures[p.active] < p.threshold {
+		return
+	}
+	next := -1
+	for i := range p.endpoints {
+		if i != p.active && !p.demoted[i] {
+			next = i
+			break
+		}
+	}
+	if next < 0 {
+		// Without another healthy endpoint there is nothing to fail over to
+		if p.failures[p.active] == p.threshold && len(p.endpoints) > 1 {
+			slog.Error("S3 endpoint keeps failing and no other endpoint is healthy",
+				"endpoint", endpoint, "consecutive_failures", p.failures[p.active])
+		}
+		return
+	}
+	p.demoted[p.active] = true
+	slog.Warn("S3 endpoint demoted after consecutive failures, failing over",
+		"endpoint", endpoint, "consecutive_failures", p.failures[p.active], "active_endpoint", p.endpoints[next])
+	p.switchTo(next)
+}
+
+// restore marks a demoted endpoint healthy again after a successful probe, making it active again
+// if it is preferred to the active one
+func (p *endpointPool) restore(i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.demoted[i] {
+		return
+	}
+	p.demoted[i], p.failures[i] = false, 0
+	if i < p.active {
+		slog.Info("S3 endpoint recovered, failing back", "endpoint", p.endpoints[i], "previous_endpoint", p.endpoints[p.active])
+		p.switchTo(i)
+		return
+	}
+	slog.Info("S3 endpoint recovered", "endpoint", p.endpoints[i], "active_endpoint", p.endpoints[p.active])
+}
+
+// transport binds the requests of a client to an endpoint: they are refused once the endpoint is no
+// longer active, and their outcomes are observed to decide when to fail over
+func (p *endpointPool) transport(endpoint string, next http.RoundTripper) http.RoundTripper {
+	return &endpointTransport{pool: p, endpoint: endpoint, next: next}
+}
+
+// endpointTransport sends the requests of a client bound to an endpoint
+type endpointTransport struct {
+	pool     *endpointPool
+	endpoint string
+	next     http.RoundTripper
+}
+
+func (t *endpointTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.pool.activeEndpoint() != t.endpoint {
+		return nil, fmt.Errorf("%w: %s", ErrEndpointInactive, t.endpoint)
+	}
+	resp, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil:
+		// Requests given up by the caller say nothing about the endpoint
+		if req.Context().Err() == nil {
+			t.pool.observe(t.endpoint, true)
+		}
+	case resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusGatewayTimeout:
+		t.pool.observe(t.endpoint, true)
+	default:
+		t.pool.observe(t.endpoint, false)
+	}
+	return resp, err
+}
+
+// EndpointState is the health of an S3 endpoint
+type EndpointState struct {
+	Endpoint            string `json:"endpoint"`
+	Active              bool   `json:"active"`
+	Demoted             bool   `json:"demoted"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+}
+
+// EndpointStates returns the health of the endpoints of a configuration in order of preference
+func EndpointStates(config *S3Config) []EndpointState {
+	pool := endpointPoolFor(config)
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	states := make([]EndpointState, len(pool.endpoints))
+	for i, endpoint := range pool.endpoints {
+		states[i] = EndpointState{
+			Endpoint:            endpoint,
+			Active:              i == pool.active,
+			Demoted:             pool.demoted[i],
+			ConsecutiveFailures: pool.failures[i],
+		}
+	}
+	return states
+}
+
+// ActiveEndpoint returns the endpoint the operations of a configuration are performed against
+func ActiveEndpoint(config *S3Config) string {
+	return endpointPoolFor(config).activeEndpoint()
+}
+
+// ProbeEndpoints probes the demoted endpoints of a configuration once and restores those that
+// answer. Any response but a gateway or availability error counts as an answer, since the probe
+// is unsigned and storage that is up refuses it.
+func ProbeEndpoints(ctx context.Context, config *S3Config) {
+	pool := endpointPoolFor(config)
+	pool.mu.Lock()
+	var demoted []int
+	for i := range pool.endpoints {
+		if pool.demoted[i] {
+			demoted = append(demoted, i)
+		}
+	}
+	pool.mu.Unlock()
+	if len(demoted) == 0 {
+		return
+	}
+
+	transport, err := s3Transport(config)
+	if err != nil {
+		slog.Warn("Failed to create the transport probing S3 endpoints", "error", err)
+		return
+	}
+	client := &http.Client{Transport: transport, Timeout: endpointProbeTimeout}
+	scheme := "http"
+	if config.UseSSL {
+		scheme = "https"
+	}
+	for _, i := range demoted {
+		endpoint := pool.endpoints[i]
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, scheme+"://"+endpoint+"/", nil)
+		if err != nil {
+			slog.Warn("Failed to create the probe of an S3 endpoint", "endpoint", endpoint, "error", err)
+			continue
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			slog.Debug("Demoted S3 endpoint is still unreachable", "endpoint", endpoint, "error", err)
+			continue
+		}
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			slog.Debug("Demoted S3 endpoint is still unavailable", "endpoint", endpoint, "status", resp.StatusCode)
+		default:
+			pool.restore(i)
+		}
+	}
+}
+
+// StartEndpointProbes probes the demoted endpoints of a configuration with several endpoints at
+// every probe interval until the context is done
+func StartEndpointProbes(ctx context.Context, config *S3Config) {
+	interval := config.ProbeInterval.Duration()
+	if len(config.Endpoints()) < 2 || interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ProbeEndpoints(ctx, config)
+			}
+		}
+	}()
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/metrics"
+	"opus-mcp/internal/settings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeSite is a fake S3 site that accepts uploads and records the objects written to it, or answers
+// every request with 503 Service Unavailable while it is down
+type fakeSite struct {
+	endpoint string
+	down     atomic.Bool
+	mu       sync.Mutex
+	writes   []string
+}
+
+func newFakeSite(t *testing.T) *fakeSite {
+	t.Helper()
+	site := &fakeSite{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case site.down.Load():
+			http.Error(w, "site is down", http.StatusServiceUnavailable)
+		case r.URL.Query().Has("location"):
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`)
+		case r.Method == http.MethodPut:
+			site.mu.Lock()
+			site.writes = append(site.writes, r.URL.Path)
+			site.mu.Unlock()
+			w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+		default:
+			// Storage that is up refuses the unsigned probe
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	t.Cleanup(server.Close)
+	site.endpoint = strings.TrimPrefix(server.URL, "http://")
+	return site
+}
+
+// written returns the paths of the objects written to the site
+func (s *fakeSite) written() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.writes...)
+}
+
+func TestS3FailoverAndRecovery(t *testing.T) {
+	original := s3RetryBaseDelay
+	t.Cleanup(func() { s3RetryBaseDelay = original })
+	s3RetryBaseDelay = time.Millisecond
+
+	primary, secondary := newFakeSite(t), newFakeSite(t)
+	config := &S3Config{
+		Endpoint:          primary.endpoint + ", " + secondary.endpoint,
+		AccessKey:         "access",
+		SecretKey:         "secret",
+		FailoverThreshold: 2,
+	}
+	ctx := context.Background()
+	put := func(name string) error {
+		return PutObjectBytes(ctx, config, "bucket", name, []byte("data"), "text/plain")
+	}
+	active := func(endpoint string) {
+		t.Helper()
+		if got := ActiveEndpoint(config); got != endpoint {
+			t.Fatalf("active endpoint = %s, want %s", got, endpoint)
+		}
+		if got := testutil.ToFloat64(metrics.S3ActiveEndpoint.WithLabelValues(endpoint)); got != 1 {
+			t.Errorf("s3_active_endpoint{endpoint=%q} = %v, want 1", endpoint, got)
+		}
+	}
+
+	// Operations are performed against the first endpoint while it is healthy
+	active(primary.endpoint)
+	if err := put("before"); err != nil {
+		t.Fatalf("put() unexpected error: %v", err)
+	}
+	boundToPrimary, err := createMinIOClient(config)
+	if err != nil {
+		t.Fatalf("createMinIOClient() unexpected error: %v", err)
+	}
+
+	// The primary fails: the write failing on it is not repeated on the secondary
+	primary.down.Store(true)
+	if err := put("during"); err == nil {
+		t.Fatal("put() to a failing primary succeeded, want an error")
+	}
+	active(secondary.endpoint)
+	if written := secondary.written(); len(written) != 0 {
+		t.Errorf("secondary received %v from the write started on the primary, want nothing", written)
+	}
+
+	// Later operations are performed against the secondary, and a client still bound to the primary
+	// refuses to write anywhere
+	if err := put("after"); err != nil {
+		t.Fatalf("put() after failover unexpected error: %v", err)
+	}
+	if written := secondary.written(); len(written) != 1 || written[0] != "/bucket/after" {
+		t.Errorf("secondary received %v, want /bucket/after", written)
+	}
+	_, err = boundToPrimary.PutObject(ctx, "bucket", "stale", bytes.NewReader([]byte("data")), 4, minio.PutObjectOptions{})
+	if !errors.Is(err, ErrEndpointInactive) {
+		t.Errorf("write of a client bound to the demoted primary = %v, want %v", err, ErrEndpointInactive)
+	}
+	states := EndpointStates(config)
+	if !states[0].Demoted || states[0].Active || !states[1].Active {
+		t.Errorf("endpoint states = %+v, want the primary demoted and the secondary active", states)
+	}
+
+	// Probes leave the primary demoted while it is down
+	ProbeEndpoints(ctx, config)
+	active(secondary.endpoint)
+
+	// Once it recovers, a probe restores it and operations fail back to it
+	primary.down.Store(false)
+	ProbeEndpoints(ctx, config)
+	active(primary.endpoint)
+	if err := put("recovered"); err != nil {
+		t.Fatalf("put() after recovery unexpected error: %v", err)
+	}
+	if written := primary.written(); len(written) != 2 || written[1] != "/bucket/recovered" {
+		t.Errorf("primary received %v, want /bucket/before and /bucket/recovered", written)
+	}
+	if written := secondary.written(); len(written) != 1 {
+		t.Errorf("secondary received %v after the primary recovered, want only /bucket/after", written)
+	}
+	if got := testutil.ToFloat64(metrics.S3FailoversTotal.WithLabelValues(primary.endpoint, secondary.endpoint)); got != 1 {
+		t.Errorf("s3_failovers_total from the primary = %v, want 1", got)
+	}
+}
+
+func TestS3FailoverWithoutHealthyEndpoint(t *testing.T) {
+	original := s3RetryBaseDelay
+	t.Cleanup(func() { s3RetryBaseDelay = original })
+	s3RetryBaseDelay = time.Millisecond
+
+	only := newFakeSite(t)
+	config := &S3Config{Endpoint: only.endpoint, AccessKey: "access", SecretKey: "secret", FailoverThreshold: 1}
+	only.down.Store(true)
+	_ = PutObjectBytes(context.Background(), config, "bucket", "object", []byte("data"), "text/plain")
+
+	// With nothing to fail over to, the endpoint stays active rather than leaving none
+	states := EndpointStates(config)
+	if len(states) != 1 || !states[0].Active || states[0].Demoted || states[0].ConsecutiveFailures == 0 {
+		t.Errorf("endpoint states = %+v, want the only endpoint active with its failures counted", states)
+	}
+}
+
+func TestS3ConfigEndpoints(t *testing.T) {
+	config := &S3Config{Endpoint: " minio-a:9000 ,minio-b:9000,, ", FailoverThreshold: 3}
+	if got := config.Endpoints(); len(got) != 2 || got[0] != "minio-a:9000" || got[1] != "minio-b:9000" {
+		t.Errorf("Endpoints() = %q, want minio-a:9000 then minio-b:9000", got)
+	}
+	config.ProbeInterval = settings.Duration(time.Second)
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate() unexpected error: %v", err)
+	}
+	config.Endpoint, config.FailoverThreshold = " , ", 0
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "OPUS_MCP_S3_ENDPOINT") || !strings.Contains(err.Error(), "OPUS_MCP_S3_FAILOVER_THRESHOLD") {
+		t.Errorf("Validate() = %v, want both problems", err)
+	}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"opus-mcp/internal/metrics"
+)
+
+// defaultCoalesceWait is how long a download waits for the transfer of the same object already in
+// progress before reporting it as in progress instead
+const defaultCoalesceWait = 2 * time.Minute
+
+// InProgressError reports a download of an object that another request was still transferring from
+// the same URL when the download stopped waiting for it
+type InProgressError struct {
+	Bucket     string
+	ObjectName string
+	SourceURL  string
+	// Since is when the transfer in progress started
+	Since time.Time
+}
+
+func (e *InProgressError) Error() string {
+	return fmt.Sprintf("object '%s' in bucket '%s' is already being downloaded from %s since %s",
+		e.ObjectName, e.Bucket, e.SourceURL, e.Since.UTC().Format(time.RFC3339))
+}
+
+// inflightTransfer is a transfer to an object that concurrent downloads of the same object can
+// wait on and share
+type inflightTransfer struct {
+	sourceURL string
+	started   time.Time
+	done      chan struct{}
+	result    UploadResult
+	err       error
+	// cancelled reports that the transfer failed because its own request was cancelled, which says
+	// nothing about the downloads waiting on it
+	cancelled bool
+}
+
+// transferGroup coalesces concurrent downloads of the same object from the same URL, so that
+// clients asking for the same article at the same moment cause a single download from the origin
+type transferGroup struct {
+	mu        sync.Mutex
+	transfers map[string]*inflightTransfer
+	// wait is how long a download waits for a transfer in progress
+	wait time.Duration
+	now  func() time.Time
+}
+
+// inflightTransfers tracks the transfers in progress of every download to S3
+var inflightTransfers = newTransferGroup(defaultCoalesceWait)
+
+func newTransferGroup(wait time.Duration) *transferGroup {
+	return &transferGroup{transfers: make(map[string]*inflightTransfer), wait: wait, now: time.Now}
+}
+
+// do runs transfer unless the same object is already being transferred from the same URL, in which
+// case it waits for that transfer and returns its result with Coalesced set. A download that waits
+// longer than the group's wait fails with an *InProgressError instead of hanging, and one whose
+// context is cancelled stops waiting without affecting the transfer. If the transfer it waited on
+// was cancelled by its own request, the download runs again itself. A transfer of the same object
+// from a different URL is not shared and runs on its own.
+func (g *transferGroup) do(ctx context.Context, bucketName, objectName, sourceURL string, transfer func() (UploadResult, error)) (UploadResult, error) {
+	key := bucketName + "/" + objectName
+	for {
+		g.mu.Lock()
+		current, ok := g.transfers[key]
+		if !ok {
+			return g.run(ctx, key, sourceURL, transfer)
+		}
+		g.mu.Unlock()
+		if current.sourceURL != sourceURL {
+			return transfer()
+		}
+
+		timer := time.NewTimer(g.wait)
+		select {
+		case <-current.done:
+			timer.Stop()
+		case <-timer.C:
+			return UploadResult{}, &InProgressError{Bucket: bucketName, ObjectName: objectName, SourceURL: sourceURL, Since: current.started}
+		case <-ctx.Done():
+			timer.Stop()
+			return UploadResult{}, ctx.Err()
+		}
+		if current.cancelled {
+			continue
+		}
+		metrics.UploadsCoalescedTotal.Inc()
+		result := current.result
+		result.Coalesced = true
+		return result, current.err
+	}
+}
+
+// run registers and runs a transfer that others can wait on, removing it once it completes; the
+// caller holds mu, which run releases
+func (g *transferGroup) run(ctx context.Context, key, sourceURL string, transfer func() (UploadResult, error)) (UploadResult, error) {
+	current := &inflightTransfer{sourceURL: sourceURL, started: g.now(), done: make(chan struct{})}
+	g.transfers[key] = current
+	g.mu.Unlock()
+
+	// Removed even if the transfer panics, so that later downloads of the object do not wait forever
+	defer func() {
+		g.mu.Lock()
+		delete(g.transfers, key)
+		g.mu.Unlock()
+		close(current.done)
+	}()
+	current.result, current.err = transfer()
+	current.cancelled = current.err != nil && ctx.Err() != nil
+	return current.result, current.err
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingOrigin serves a PDF once release is closed and counts the requests it received
+func countingOrigin(t *testing.T, release <-chan struct{}) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		_, _ = w.Write([]byte("%PDF-1.7 coalesced"))
+	}))
+	t.Cleanup(source.Close)
+	return source, &requests
+}
+
+func TestTransferGroupCoalescesConcurrentDownloads(t *testing.T) {
+	store, client := newFakeObjectStore(t)
+	release := make(chan struct{})
+	source, requests := countingOrigin(t, release)
+	group := newTransferGroup(time.Minute)
+
+	var wg sync.WaitGroup
+	results := make([]UploadResult, 2)
+	errs := make([]error, 2)
+	download := func(i int) {
+		defer wg.Done()
+		results[i], errs[i] = group.do(context.Background(), "bucket", "arxiv/2405.12345v1.pdf", source.URL, func() (UploadResult, error) {
+			return transferURLToObject(context.Background(), http.DefaultClient, client, source.URL, "bucket", "arxiv/2405.12345v1.pdf", nil, CollisionOverwrite)
+		})
+	}
+	wg.Add(2)
+	go download(0)
+	// The second download starts while the first waits for the origin
+	for requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go download(1)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("download %d unexpected error: %v", i, err)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("origin received %d requests, want 1", got)
+	}
+	if len(store.uploads) != 1 {
+		t.Errorf("uploaded %q, want a single upload", store.uploads)
+	}
+	if results[0].Coalesced || !results[1].Coalesced || results[1].SHA256 != results[0].SHA256 {
+		t.Errorf("results = %+v, want the second to share the first", results)
+	}
+	if len(group.transfers) != 0 {
+		t.Errorf("%d transfers still tracked after completion", len(group.transfers))
+	}
+}
+
+func TestTransferGroupReportsTransferInProgress(t *testing.T) {
+	group := newTransferGroup(20 * time.Millisecond)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		_, _ = group.do(context.Background(), "bucket", "web/data.zip", "https://example.org/data.zip", func() (UploadResult, error) {
+			close(started)
+			<-release
+			return UploadResult{}, nil
+		})
+	}()
+	<-started
+	defer close(release)
+
+	_, err := group.do(context.Background(), "bucket", "web/data.zip", "https://example.org/data.zip", func() (UploadResult, error) {
+		t.Error("the object in progress was downloaded again")
+		return UploadResult{}, nil
+	})
+	var inProgressErr *InProgressError
+	if !errors.As(err, &inProgressErr) || inProgressErr.ObjectName != "web/data.zip" || inProgressErr.Since.IsZero() {
+		t.Fatalf("do() error = %v, want an InProgressError for web/data.zip", err)
+	}
+
+	// A different URL for the same object is not shared
+	ran := false
+	if _, err := group.do(context.Background(), "bucket", "web/data.zip", "https://example.org/other.zip", func() (UploadResult, error) {
+		ran = true
+		return UploadResult{}, nil
+	}); err != nil || !ran {
+		t.Errorf("do() of a different URL ran = %v, error = %v, want it run on its own", ran, err)
+	}
+}
+
+func TestTransferGroupCancellation(t *testing.T) {
+	group := newTransferGroup(time.Minute)
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	leaderDone := make(chan error)
+	go func() {
+		_, err := group.do(leaderCtx, "bucket", "arxiv/1.pdf", "https://arxiv.org/pdf/1", func() (UploadResult, error) {
+			close(started)
+			<-leaderCtx.Done()
+			return UploadResult{}, leaderCtx.Err()
+		})
+		leaderDone <- err
+	}()
+	<-started
+
+	// A waiter that gives up does not affect the transfer
+	waiterCtx, cancelWaiter := context.WithCancel(context.Background())
+	cancelWaiter()
+	if _, err := group.do(waiterCtx, "bucket", "arxiv/1.pdf", "https://arxiv.org/pdf/1", nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("do() of a cancelled waiter error = %v, want context.Canceled", err)
+	}
+
+	// A waiter on a transfer its own caller cancelled downloads the object itself
+	result := make(chan UploadResult)
+	go func() {
+		r, _ := group.do(context.Background(), "bucket", "arxiv/1.pdf", "https://arxiv.org/pdf/1", func() (UploadResult, error) {
+			return UploadResult{SHA256: "own"}, nil
+		})
+		result <- r
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancelLeader()
+	if err := <-leaderDone; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled transfer error = %v, want context.Canceled", err)
+	}
+	if r := <-result; r.SHA256 != "own" || r.Coalesced {
+		t.Errorf("waiter result = %+v, want its own transfer", r)
+	}
+	if len(group.transfers) != 0 {
+		t.Errorf("%d transfers still tracked after cancellation", len(group.transfers))
+	}
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxObjectKeyLength is the S3 limit on the length of an object key, in bytes
+const MaxObjectKeyLength = 1024
+
+// KeyRules configure which object keys ValidateObjectKey accepts
+type KeyRules struct {
+	// MaxLength is the longest key accepted, in bytes; zero means MaxObjectKeyLength
+	MaxLength int
+	// AllowedPrefixes are the prefixes a key must start with; none means any prefix
+	AllowedPrefixes []string
+}
+
+// KeyError reports an object key refused by ValidateObjectKey
+type KeyError struct {
+	Key    string
+	Reason string
+	// Char is the offending character, if the key was refused for one
+	Char string
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("object name %q %s", e.Key, e.Reason)
+}
+
+// ValidateObjectKey checks that an object key cannot address anything but the object it names, on
+// any backend: it must be valid UTF-8, relative, without backslashes, control characters, or
+// empty, '.' or '..' path segments, no longer than the maximum length and under an allowed prefix.
+// Backends call it with the default rules before every request; tools call it with their own.
+// It returns a *KeyError describing the first problem found.
+func ValidateObjectKey(key string, rules KeyRules) error {
+	if key == "" {
+		return &KeyError{Key: key, Reason: "cannot be empty"}
+	}
+	maxLength := rules.MaxLength
+	if maxLength <= 0 {
+		maxLength = MaxObjectKeyLength
+	}
+	if len(key) > maxLength {
+		return &KeyError{Key: key, Reason: fmt.Sprintf("is %d bytes long, at most %d are allowed", len(key), maxLength)}
+	}
+	if !utf8.ValidString(key) {
+		return &KeyError{Key: key, Reason: "is not valid UTF-8"}
+	}
+	for _, r := range key {
+		switch {
+		case r == '\\':
+			return &KeyError{Key: key, Reason: `must not contain the backslash character '\'`, Char: string(r)}
+		case unicode.IsControl(r):
+			return &KeyError{Key: key, Reason: fmt.Sprintf("must not contain the control character %U", r), Char: string(r)}
+		}
+	}
+	if strings.HasPrefix(key, "/") {
+		return &KeyError{Key: key, Reason: "must be a relative path, without a leading '/'", Char: "/"}
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return &KeyError{Key: key, Reason: "must not contain empty, '.' or '..' path segments"}
+		}
+	}
+	if len(rules.AllowedPrefixes) == 0 {
+		return nil
+	}
+	for _, prefix := range rules.AllowedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return nil
+		}
+	}
+	return &KeyError{Key: key, Reason: fmt.Sprintf("is not under an allowed prefix (%s)", strings.Join(rules.AllowedPrefixes, ", "))}
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+// adversarialKeys are object keys that try to address something other than the object they name
+var adversarialKeys = []string{
+	"",
+	"/etc/passwd",
+	"//bucket/arxiv/2405.12345.pdf",
+	"../library/index.json",
+	"arxiv/../library/index.json",
+	"arxiv/..",
+	"arxiv/./2405.12345.pdf",
+	"arxiv//2405.12345.pdf",
+	"arxiv/",
+	".",
+	`arxiv\..\library\index.json`,
+	`\\server\share`,
+	"arxiv/2405.12345.pdf\x00.txt",
+	"arxiv/2405.12345.pdf\r\nX-Amz-Acl: public-read",
+	"arxiv/\x1b[31m.pdf",
+	"arxiv/\u0085.pdf",
+	"arxiv/\x7f.pdf",
+	"arxiv/\xff\xfe.pdf",
+	"arxiv/" + strings.Repeat("a", MaxObjectKeyLength),
+}
+
+func TestValidateObjectKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		rules    KeyRules
+		wantErr  string
+		wantChar string
+	}{
+		{"plain key", "arxiv/2405.12345.pdf", KeyRules{}, "", ""},
+		{"old-style identifier", "arxiv/hep-th/9901001.pdf", KeyRules{}, "", ""},
+		{"dots inside a segment", "web/a..b/v1.2.tar.gz", KeyRules{}, "", ""},
+		{"non-ASCII characters", "web/résumé.pdf", KeyRules{}, "", ""},
+		{"spaces", "web/my file.pdf", KeyRules{}, "", ""},
+		{"allowed prefix", "summaries/2405.12345.md", KeyRules{AllowedPrefixes: []string{"arxiv/", "summaries/"}}, "", ""},
+		{"at the maximum length", strings.Repeat("a", 16), KeyRules{MaxLength: 16}, "", ""},
+		{"empty", "", KeyRules{}, "cannot be empty", ""},
+		{"leading slash", "/arxiv/2405.12345.pdf", KeyRules{}, "relative path", "/"},
+		{"parent segment", "arxiv/../library/index.json", KeyRules{}, "'..' path segments", ""},
+		{"current segment", "arxiv/./2405.12345.pdf", KeyRules{}, "'..' path segments", ""},
+		{"empty segment", "arxiv//2405.12345.pdf", KeyRules{}, "'..' path segments", ""},
+		{"trailing slash", "arxiv/", KeyRules{}, "'..' path segments", ""},
+		{"backslash", `arxiv\..\library`, KeyRules{}, "backslash", `\`},
+		{"NUL", "arxiv/a\x00b", KeyRules{}, "control character U+0000", "\x00"},
+		{"newline", "arxiv/a\nb", KeyRules{}, "control character U+000A", "\n"},
+		{"DEL", "arxiv/a\x7fb", KeyRules{}, "control character U+007F", "\x7f"},
+		{"C1 control", "arxiv/a\u0085b", KeyRules{}, "control character U+0085", "\u0085"},
+		{"invalid UTF-8", "arxiv/a\xffb", KeyRules{}, "not valid UTF-8", ""},
+		{"above the default maximum length", strings.Repeat("a", MaxObjectKeyLength+1), KeyRules{}, "at most 1024", ""},
+		{"above a configured maximum length", strings.Repeat("a", 17), KeyRules{MaxLength: 16}, "at most 16", ""},
+		{"outside the allowed prefixes", "library/index.json", KeyRules{AllowedPrefixes: []string{"arxiv/"}}, "not under an allowed prefix (arxiv/)", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateObjectKey(tt.key, tt.rules)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateObjectKey(%q) unexpected error: %v", tt.key, err)
+				}
+				return
+			}
+			var keyErr *KeyError
+			if !errors.As(err, &keyErr) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidateObjectKey(%q) error = %v, want a *KeyError containing %q", tt.key, err, tt.wantErr)
+			}
+			if keyErr.Key != tt.key || keyErr.Char != tt.wantChar {
+				t.Errorf("ValidateObjectKey(%q) error = %+v, want the key and character %q", tt.key, keyErr, tt.wantChar)
+			}
+		})
+	}
+}
+
+// FuzzValidateObjectKey checks that every accepted key is one no backend can resolve outside its
+// prefix, whatever the input
+func FuzzValidateObjectKey(f *testing.F) {
+	for _, key := range adversarialKeys {
+		f.Add(key)
+	}
+	f.Add("arxiv/2405.12345.pdf")
+	f.Fuzz(func(t *testing.T, key string) {
+		rules := KeyRules{MaxLength: 64, AllowedPrefixes: []string{"arxiv/", "web/"}}
+		if err := ValidateObjectKey(key, rules); err != nil {
+			var keyErr *KeyError
+			if !errors.As(err, &keyErr) {
+				t.Fatalf("ValidateObjectKey(%q) error = %v, want a *KeyError", key, err)
+			}
+			return
+		}
+		switch {
+		case len(key) > rules.MaxLength:
+			t.Errorf("accepted key %q longer than %d bytes", key, rules.MaxLength)
+		case !utf8.ValidString(key):
+			t.Errorf("accepted key %q that is not valid UTF-8", key)
+		case strings.HasPrefix(key, "/") || strings.Contains(key, `\`):
+			t.Errorf("accepted key %q with a leading slash or backslash", key)
+		case strings.IndexFunc(key, unicode.IsControl) >= 0:
+			t.Errorf("accepted key %q with a control character", key)
+		case !strings.HasPrefix(key, "arxiv/") && !strings.HasPrefix(key, "web/"):
+			t.Errorf("accepted key %q outside the allowed prefixes", key)
+		}
+		for _, segment := range strings.Split(key, "/") {
+			if segment == "" || segment == "." || segment == ".." {
+				t.Errorf("accepted key %q with the path segment %q", key, segment)
+			}
+		}
+	})
+}
+
+func TestS3OperationsRefuseAdversarialKeys(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNotImplemented)
+	}))
+	t.Cleanup(server.Close)
+	config := &S3Config{Endpoint: strings.TrimPrefix(server.URL, "http://"), AccessKey: "test-access-key", SecretKey: "test-secret-key"}
+
+	ctx := context.Background()
+	operations := map[string]func(key string) error{
+		"StatObject": func(key string) error {
+			_, err := StatObject(ctx, config, "bucket", key)
+			return err
+		},
+		"GetObjectBytes": func(key string) error {
+			_, err := GetObjectBytes(ctx, config, "bucket", key)
+			return err
+		},
+		"ReadObjectRange": func(key string) error {
+			_, _, err := ReadObjectRange(ctx, config, "bucket", key, 0, 1)
+			return err
+		},
+		"HashObject": func(key string) error {
+			_, _, err := HashObject(ctx, config, "bucket", key)
+			return err
+		},
+		"PutObjectBytes": func(key string) error {
+			return PutObjectBytes(ctx, config, "bucket", key, []byte("data"), "text/plain")
+		},
+		"PutObjectStream": func(key string) error {
+			_, err := PutObjectStream(ctx, config, "bucket", key, strings.NewReader("data"), "text/plain")
+			return err
+		},
+		"PresignGetObject": func(key string) error {
+			_, err := PresignGetObject(ctx, config, "bucket", key, 0)
+			return err
+		},
+		"RemoveObject": func(key string) error {
+			return RemoveObject(ctx, config, "bucket", key)
+		},
+		"DownloadURLToS3": func(key string) error {
+			_, err := DownloadURLToS3(ctx, server.URL, config, "bucket", key, nil, CollisionOverwrite)
+			return err
+		},
+	}
+	for name, operation := range operations {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range adversarialKeys {
+				var keyErr *KeyError
+				if err := operation(key); !errors.As(err, &keyErr) {
+					t.Errorf("%s(%q) error = %v, want a *KeyError", name, key, err)
+				}
+			}
+		})
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("S3 received %d requests for refused keys, want none", n)
+	}
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"mime"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxMetadataValueLength caps a user metadata value, after encoding, so that all values of an
+	// object stay well within the 2 KiB S3 limit on user metadata
+	maxMetadataValueLength = 256
+)
+
+// SanitizeMetadata makes user metadata safe to send to S3, which only accepts printable US-ASCII
+// header values. Non-ASCII values are RFC 2047 encoded (decodable with mime.WordDecoder), control
+// characters are replaced with spaces, keys are reduced to lowercase letters, digits and dashes,
+// and values are truncated so that the upload is never rejected because of its metadata. Callers
+// that need the original values should record them elsewhere, e.g., in the library index.
+func SanitizeMetadata(metadata map[string]string) map[string]string {
+	sanitized := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		key = sanitizeMetadataKey(key)
+		if key == "" {
+			continue
+		}
+		sanitized[key] = sanitizeMetadataValue(value)
+	}
+	return sanitized
+}
+
+func sanitizeMetadataKey(key string) string {
+	key = strings.ToLower(strings.TrimSpace(key))
+	var b strings.Builder
+	for _, r := range key {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+func sanitizeMetadataValue(value string) string {
+	value = strings.ToValidUTF8(value, "�")
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, value)
+	value = strings.TrimSpace(value)
+
+	if isPrintableASCII(value) {
+		return truncateRunes(value, maxMetadataValueLength)
+	}
+	// Keep the longest prefix whose encoded form fits
+	runes := []rune(value)
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if len(mime.BEncoding.Encode("utf-8", string(runes[:mid]))) <= maxMetadataValueLength {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	if lo == 0 {
+		return ""
+	}
+	return mime.BEncoding.Encode("utf-8", string(runes[:lo]))
+}
+
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// truncateRunes truncates a string to at most n characters
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"mime"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// decodeMetadataValue decodes a sanitized metadata value as a client would
+func decodeMetadataValue(t *testing.T, value string) string {
+	t.Helper()
+	decoded, err := new(mime.WordDecoder).DecodeHeader(value)
+	if err != nil {
+		t.Fatalf("failed to decode metadata value %q: %v", value, err)
+	}
+	return decoded
+}
+
+func TestSanitizeMetadata(t *testing.T) {
+	longTitle := strings.Repeat("A very long title about transformers ", 40)
+	longCJK := strings.Repeat("大規模言語モデルの推論能力に関する研究", 20)
+
+	tests := []struct {
+		name  string
+		value string
+		// wantDecoded is the expected decoded value, or a prefix of it when truncated
+		wantDecoded string
+		truncated   bool
+	}{
+		{"ASCII is unchanged", "cs.AI OR cs.LG", "cs.AI OR cs.LG", false},
+		{"CJK characters", "注意力机制就是你所需要的", "注意力机制就是你所需要的", false},
+		{"emoji", "Attention 🤖 is all you need 🚀", "Attention 🤖 is all you need 🚀", false},
+		{"accented letters", "Élaboration d'un modèle", "Élaboration d'un modèle", false},
+		{"control characters", "line one\r\nX-Injected: yes", "line one  X-Injected: yes", false},
+		{"invalid UTF-8", "bad \xff byte", "bad � byte", false},
+		{"long ASCII", longTitle, longTitle[:maxMetadataValueLength], true},
+		{"long CJK", longCJK, "大規模言語モデル", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SanitizeMetadata(map[string]string{"title": tt.value})["title"]
+			if !isPrintableASCII(got) {
+				t.Fatalf("sanitized value %q is not printable US-ASCII", got)
+			}
+			if len(got) > maxMetadataValueLength {
+				t.Errorf("sanitized value is %d bytes, want at most %d", len(got), maxMetadataValueLength)
+			}
+			decoded := decodeMetadataValue(t, got)
+			if !utf8.ValidString(decoded) {
+				t.Errorf("decoded value %q is not valid UTF-8", decoded)
+			}
+			if tt.truncated {
+				if !strings.HasPrefix(decoded, strings.TrimSpace(tt.wantDecoded)) || len(decoded) >= len(tt.value) {
+					t.Errorf("decoded value %q, want a truncated prefix of the original", decoded)
+				}
+			} else if decoded != tt.wantDecoded {
+				t.Errorf("decoded value = %q, want %q", decoded, tt.wantDecoded)
+			}
+		})
+	}
+}
+
+func TestSanitizeMetadataKeys(t *testing.T) {
+	got := SanitizeMetadata(map[string]string{
+		"Provenance-Query": "a",
+		"original name":    "b",
+		"タイトル":             "dropped",
+		"":                 "dropped",
+	})
+	want := map[string]string{"provenance-query": "a", "original-name": "b"}
+	if len(got) != len(want) {
+		t.Fatalf("SanitizeMetadata() = %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("SanitizeMetadata()[%q] = %q, want %q", key, got[key], value)
+		}
+	}
+}
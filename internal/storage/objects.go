@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// ObjectAttributes are the size, user metadata and tags of a stored object
+type ObjectAttributes struct {
+	Size        int64
+	ContentType string
+	// Metadata holds the user metadata, keyed by lowercase name without the x-amz-meta- prefix, with
+	// the values encoded by SanitizeMetadata decoded
+	Metadata map[string]string
+	Tags     map[string]string
+}
+
+// StatObject returns the attributes of an object without reading its content.
+// It returns ErrObjectNotFound if the object does not exist.
+func StatObject(ctx context.Context, config *S3Config, bucketName, objectName string) (ObjectAttributes, error) {
+	if err := ValidateObjectKey(objectName, KeyRules{}); err != nil {
+		return ObjectAttributes{}, err
+	}
+	minioClient, err := createMinIOClient(config)
+	if err != nil {
+		return ObjectAttributes{}, fmt.Errorf("failed to create MinIO client: %w", err)
+	}
+
+	var info minio.ObjectInfo
+	err = withS3Retry(ctx, "stat_object", func() error {
+		info, err = minioClient.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return ObjectAttributes{}, fmt.Errorf("%w: %s/%s", ErrObjectNotFound, bucketName, objectName)
+		}
+		return ObjectAttributes{}, fmt.Errorf("failed to stat object: %w", err)
+	}
+	attributes := ObjectAttributes{
+		Size:        info.Size,
+		ContentType: info.ContentType,
+		Metadata:    make(map[string]string, len(info.UserMetadata)),
+		Tags:        map[string]string{},
+	}
+	decoder := new(mime.WordDecoder)
+	for key, value := range info.UserMetadata {
+		if decoded, err := decoder.DecodeHeader(value); err == nil {
+			value = decoded
+		}
+		attributes.Metadata[strings.ToLower(key)] = value
+	}
+
+	if info.UserTagCount > 0 {
+		err = withS3Retry(ctx, "get_object_tagging", func() error {
+			objectTags, err := minioClient.GetObjectTagging(ctx, bucketName, objectName, minio.GetObjectTaggingOptions{})
+			if err != nil {
+				return err
+			}
+			attributes.Tags = objectTags.ToMap()
+			return nil
+		})
+		if err != nil {
+			return ObjectAttributes{}, fmt.Errorf("failed to get object tags: %w", err)
+		}
+	}
+	return attributes, nil
+}
+
+// PutObjectStream uploads content of unknown length, e.g., as it is being generated, without holding
+// it in memory, and returns the number of bytes uploaded. Since the content is read only once, the
+// upload is not retried.
+func PutObjectStream(ctx context.Context, config *S3Config, bucketName, objectName string, content io.Reader, contentType string) (int64, error) {
+	if err := ValidateObjectKey(objectName, KeyRules{}); err != nil {
+		return 0, err
+	}
+	minioClient, err := createMinIOClient(config)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create MinIO client: %w", err)
+	}
+	info, err := minioClient.PutObject(ctx, bucketName, objectName, content, -1, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to upload object: %w", classifyError(err))
+	}
+	return info.Size, nil
+}
+
+// PresignGetObject returns a URL that allows anyone holding it to download an object until it expires
+func PresignGetObject(ctx context.Context, config *S3Config, bucketName, objectName string, expiry time.Duration) (string, error) {
+	if err := ValidateObjectKey(objectName, KeyRules{}); err != nil {
+		return "", err
+	}
+	minioClient, err := createMinIOClient(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to create MinIO client: %w", err)
+	}
+	presigned, err := minioClient.PresignedGetObject(ctx, bucketName, objectName, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign object URL: %w", err)
+	}
+	return presigned.String(), nil
+}
+
+// RemoveObject deletes an object. Deleting an object that does not exist is not an error.
+func RemoveObject(ctx context.Context, config *S3Config, bucketName, objectName string) error {
+	if err := ValidateObjectKey(objectName, KeyRules{}); err != nil {
+		return err
+	}
+	minioClient, err := createMinIOClient(config)
+	if err != nil {
+		return fmt.Errorf("failed to create MinIO client: %w", err)
+	}
+	err = withS3Retry(ctx, "remove_object", func() error {
+		return minioClient.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove object: %w", err)
+	}
+	return nil
+}
+
+// ObjectInfo is the name, size and modification time of a listed object
+type ObjectInfo struct {
+	Name         string
+	Size         int64
+	LastModified time.Time
+}
+
+// ListObjects returns every object whose name starts with prefix, in name order; an empty prefix
+// lists the whole bucket
+func ListObjects(ctx context.Context, config *S3Config, bucketName, prefix string) ([]ObjectInfo, error) {
+	minioClient, err := createMinIOClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MinIO client: %w", err)
+	}
+	var objects []ObjectInfo
+	err = withS3Retry(ctx, "list_objects", func() error {
+		objects = objects[:0]
+		for info := range minioClient.ListObjects(ctx, bucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+			if info.Err != nil {
+				return info.Err
+			}
+			objects = append(objects, ObjectInfo{Name: info.Key, Size: info.Size, LastModified: info.LastModified})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	return objects, nil
+}
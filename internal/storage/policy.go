@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"opus-mcp/internal"
+	"opus-mcp/internal/settings"
+)
+
+// DownloadPolicy restricts the URLs that may be downloaded into storage, so that callers cannot
+// make the server fetch from arbitrary hosts, in particular from the internal network
+type DownloadPolicy struct {
+	// AllowedHosts are host names that may be downloaded from, including their subdomains
+	AllowedHosts []string `env:"OPUS_MCP_DOWNLOAD_ALLOWED_HOSTS,default=arxiv.org"`
+}
+
+// Policy names reported in policy violations
+const (
+	PolicyAllowedHosts   = "allowed-hosts"
+	PolicyPrivateAddress = "private-address"
+)
+
+// PolicyError reports a download refused by the download policy
+type PolicyError struct {
+	// Policy is the name of the violated policy
+	Policy string
+	Host   string
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("download from %q refused by the %s policy: %s", e.Host, e.Policy, e.Reason)
+}
+
+// LoadDownloadPolicy loads the download policy from environment variables
+func LoadDownloadPolicy() (*DownloadPolicy, error) {
+	var policy DownloadPolicy
+	if err := settings.Process(context.Background(), &policy); err != nil {
+		slog.Error("Failed to process download policy from environment", "error", err)
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// AllowsHost reports whether a host name is on the allowlist, either exactly or as a subdomain
+// of an allowed host. Matching is on whole DNS labels, so "evilarxiv.org" does not match "arxiv.org".
+func (p *DownloadPolicy) AllowsHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, allowed := range p.AllowedHosts {
+		allowed = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(allowed)), ".")
+		if allowed == "" {
+			continue
+		}
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckURL checks a URL's host against the allowlist
+func (p *DownloadPolicy) CheckURL(u *url.URL) error {
+	host := u.Hostname()
+	if !p.AllowsHost(host) {
+		return &PolicyError{
+			Policy: PolicyAllowedHosts,
+			Host:   host,
+			Reason: fmt.Sprintf("host is not in OPUS_MCP_DOWNLOAD_ALLOWED_HOSTS (%s)", strings.Join(p.AllowedHosts, ", ")),
+		}
+	}
+	return nil
+}
+
+// isForbiddenIP reports whether an address is on the loopback, link-local, private (RFC 1918 or
+// unique local) or unspecified ranges, none of which downloads may connect to
+func isForbiddenIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsPrivate() || ip.IsUnspecified()
+}
+
+// ipResolver resolves host names; *net.Resolver implements it
+type ipResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// guardedDialContext returns a dial function that resolves the host itself, refuses to connect if
+// any resolved address is forbidden, and then connects to the validated address. Connecting to the
+// address that was checked, rather than resolving again, prevents DNS rebinding. Addresses in
+// exempt, such as a configured proxy, are dialled without checks.
+func guardedDialContext(resolver ipResolver, dialer *net.Dialer, exempt map[string]bool) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if exempt[addr] {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("no addresses found for %s", host)
+		}
+		for _, ipAddr := range addrs {
+			if isForbiddenIP(ipAddr.IP) {
+				return nil, &PolicyError{
+					Policy: PolicyPrivateAddress,
+					Host:   host,
+					Reason: fmt.Sprintf("host resolves to %s, which is a loopback, link-local or private address", ipAddr.IP),
+				}
+			}
+		}
+		return dialer.DialContext(ctx, network, net.JoinHostPort(addrs[0].IP.String(), port))
+	}
+}
+
+// proxyAddress returns the host:port of the proxy used for a URL, if any
+func proxyAddress(proxy func(*http.Request) (*url.URL, error), target *url.URL) string {
+	if proxy == nil {
+		return ""
+	}
+	proxyURL, err := proxy(&http.Request{URL: target})
+	if err != nil || proxyURL == nil {
+		return ""
+	}
+	port := proxyURL.Port()
+	if port == "" {
+		port = "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
+
+// newDownloadHTTPClient checks a URL against the download policy and returns a configured HTTP
+// client that enforces the policy on every connection and redirect. Downloads call it before
+// touching storage, so that URLs outside the policy are refused without any S3 request.
+func newDownloadHTTPClient(target *url.URL) (*http.Client, error) {
+	return newGuardedHTTPClient(target, net.DefaultResolver)
+}
+
+func newGuardedHTTPClient(target *url.URL, resolver ipResolver) (*http.Client, error) {
+	policy, err := LoadDownloadPolicy()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load download policy: %w", err)
+	}
+	if err := policy.CheckURL(target); err != nil {
+		return nil, err
+	}
+
+	shared, err := internal.GetSharedHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create configured HTTP client: %w", err)
+	}
+	userAgent, ok := shared.Transport.(*internal.UserAgentTransport)
+	if !ok {
+		return nil, errors.New("unexpected HTTP transport type")
+	}
+	sharedTransport, ok := userAgent.Next.(*http.Transport)
+	if !ok {
+		return nil, errors.New("unexpected HTTP transport type")
+	}
+	// The guard depends on the target, so the download gets a copy of the shared transport with the
+	// same proxy and TLS settings rather than the shared one itself, sending the same User-Agent
+	transport := sharedTransport.Clone()
+	client := &http.Client{
+		Transport: &internal.UserAgentTransport{UserAgent: userAgent.UserAgent, Next: transport},
+		Timeout:   shared.Timeout,
+	}
+	exempt := map[string]bool{}
+	if addr := proxyAddress(transport.Proxy, target); addr != "" {
+		// The proxy makes the connection to the target; the allowlist still applies to the target host
+		exempt[addr] = true
+	}
+	transport.DialContext = guardedDialContext(resolver, &net.Dialer{}, exempt)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return policy.CheckURL(req.URL)
+	}
+	return client, nil
+}
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"opus-mcp/internal"
+)
+
+func TestDownloadPolicyAllowsHost(t *testing.T) {
+	policy := &DownloadPolicy{AllowedHosts: []string{"arxiv.org", " Example.COM "}}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"arxiv.org", true},
+		{"export.arxiv.org", true},
+		{"ARXIV.ORG", true},
+		{"arxiv.org.", true},
+		{"example.com", true},
+		{"cdn.example.com", true},
+		// Suffix matching is on whole labels
+		{"evilarxiv.org", false},
+		{"arxiv.org.evil.com", false},
+		{"arxiv.org-evil.com", false},
+		{"169.254.169.254", false},
+		{"localhost", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := policy.AllowsHost(tt.host); got != tt.want {
+				t.Errorf("AllowsHost(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadPolicyCheckURL(t *testing.T) {
+	policy := &DownloadPolicy{AllowedHosts: []string{"arxiv.org"}}
+
+	if err := policy.CheckURL(&url.URL{Scheme: "https", Host: "arxiv.org"}); err != nil {
+		t.Errorf("CheckURL() for an allowlisted host unexpected error: %v", err)
+	}
+
+	err := policy.CheckURL(&url.URL{Scheme: "http", Host: "169.254.169.254", Path: "/latest/meta-data/"})
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("CheckURL() error = %v, want a *PolicyError", err)
+	}
+	if policyErr.Policy != PolicyAllowedHosts || policyErr.Host != "169.254.169.254" {
+		t.Errorf("PolicyError = %+v, want the allowed-hosts policy and the host", policyErr)
+	}
+	if !strings.Contains(err.Error(), "OPUS_MCP_DOWNLOAD_ALLOWED_HOSTS") {
+		t.Errorf("error %q should name the configuration that defines the policy", err)
+	}
+}
+
+func TestLoadDownloadPolicyDefault(t *testing.T) {
+	// Setenv restores the original value after the test; the variable is unset for the test itself
+	t.Setenv("OPUS_MCP_DOWNLOAD_ALLOWED_HOSTS", "")
+	if err := os.Unsetenv("OPUS_MCP_DOWNLOAD_ALLOWED_HOSTS"); err != nil {
+		t.Fatalf("failed to unset environment variable: %v", err)
+	}
+	policy, err := LoadDownloadPolicy()
+	if err != nil {
+		t.Fatalf("LoadDownloadPolicy() unexpected error: %v", err)
+	}
+	if len(policy.AllowedHosts) != 1 || policy.AllowedHosts[0] != "arxiv.org" {
+		t.Errorf("default AllowedHosts = %v, want [arxiv.org]", policy.AllowedHosts)
+	}
+}
+
+// fakeResolver resolves host names from a fixed table, like a DNS server under an attacker's control
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	var addrs []net.IPAddr
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func TestGuardedDialContext(t *testing.T) {
+	resolver := fakeResolver{
+		// Allowlisted-looking names that resolve to internal addresses
+		"metadata.arxiv.org":  {"169.254.169.254"},
+		"internal.arxiv.org":  {"10.0.0.5"},
+		"loopback.arxiv.org":  {"127.0.0.1"},
+		"loopback6.arxiv.org": {"::1"},
+		"ula.arxiv.org":       {"fd00::1"},
+		"zero.arxiv.org":      {"0.0.0.0"},
+		"mixed.arxiv.org":     {"151.101.3.42", "192.168.1.1"},
+		"public.arxiv.org":    {"151.101.3.42"},
+	}
+
+	// The dialer records the address it was asked to connect to and never opens a connection
+	var dialed string
+	dialer := &net.Dialer{Control: func(network, address string, c syscall.RawConn) error {
+		dialed = address
+		return errors.New("test dialer does not connect")
+	}}
+	dial := guardedDialContext(resolver, dialer, map[string]bool{"proxy.internal:3128": true})
+
+	for _, host := range []string{"metadata.arxiv.org", "internal.arxiv.org", "loopback.arxiv.org", "loopback6.arxiv.org", "ula.arxiv.org", "zero.arxiv.org", "mixed.arxiv.org"} {
+		t.Run(host, func(t *testing.T) {
+			dialed = ""
+			_, err := dial(context.Background(), "tcp", net.JoinHostPort(host, "443"))
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) || policyErr.Policy != PolicyPrivateAddress {
+				t.Fatalf("dial error = %v, want a private-address policy violation", err)
+			}
+			if dialed != "" {
+				t.Errorf("dialer connected to %s despite the violation", dialed)
+			}
+		})
+	}
+
+	t.Run("public address is pinned", func(t *testing.T) {
+		dialed = ""
+		_, err := dial(context.Background(), "tcp", "public.arxiv.org:443")
+		var policyErr *PolicyError
+		if errors.As(err, &policyErr) {
+			t.Fatalf("public address was refused: %v", err)
+		}
+		// The connection goes to the validated address, not to a second resolution of the name
+		if dialed != "151.101.3.42:443" {
+			t.Errorf("dialed %q, want the validated address 151.101.3.42:443", dialed)
+		}
+	})
+
+	t.Run("exempt proxy address", func(t *testing.T) {
+		_, err := dial(context.Background(), "tcp", "proxy.internal:3128")
+		var policyErr *PolicyError
+		if errors.As(err, &policyErr) {
+			t.Errorf("exempt proxy address was refused: %v", err)
+		}
+	})
+}
+
+func TestGuardedHTTPClientRefusesLoopbackServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached the loopback server")
+	}))
+	defer server.Close()
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("failed to parse server URL: %v", err)
+	}
+
+	// Not on the allowlist: refused before any connection
+	t.Setenv("OPUS_MCP_DOWNLOAD_ALLOWED_HOSTS", "arxiv.org")
+	_, err = newGuardedHTTPClient(target, net.DefaultResolver)
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) || policyErr.Policy != PolicyAllowedHosts {
+		t.Fatalf("newGuardedHTTPClient() error = %v, want an allowed-hosts policy violation", err)
+	}
+
+	// Even when an operator allowlists it, a loopback address is refused at connection time
+	t.Setenv("OPUS_MCP_DOWNLOAD_ALLOWED_HOSTS", "127.0.0.1")
+	t.Setenv("HTTP_PROXY", "")
+	t.Setenv("http_proxy", "")
+	client, err := newGuardedHTTPClient(target, net.DefaultResolver)
+	if err != nil {
+		t.Fatalf("newGuardedHTTPClient() unexpected error: %v", err)
+	}
+	_, err = client.Get(server.URL)
+	if !errors.As(err, &policyErr) || policyErr.Policy != PolicyPrivateAddress {
+		t.Errorf("GET error = %v, want a private-address policy violation", err)
+	}
+}
+
+func TestGuardedHTTPClientUserAgent(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+	}))
+	defer server.Close()
+	t.Setenv("OPUS_MCP_DOWNLOAD_ALLOWED_HOSTS", "127.0.0.1")
+	t.Setenv("OPUS_MCP_HTTP_USER_AGENT", "library-bot/2.0")
+	t.Setenv("OPUS_MCP_HTTP_CONTACT_EMAIL", "ops@example.org")
+	internal.ResetSharedHTTPClient()
+	t.Cleanup(internal.ResetSharedHTTPClient)
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("failed to parse server URL: %v", err)
+	}
+
+	client, err := newGuardedHTTPClient(target, net.DefaultResolver)
+	if err != nil {
+		t.Fatalf("newGuardedHTTPClient() unexpected error: %v", err)
+	}
+	// PDF downloads send the User-Agent of the shared client; the guard, which refuses the loopback
+	// server, is bypassed to observe it
+	userAgent, ok := client.Transport.(*internal.UserAgentTransport)
+	if !ok {
+		t.Fatalf("guarded client transport = %T, want *internal.UserAgentTransport", client.Transport)
+	}
+	userAgent.Next = server.Client().Transport
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if want := "library-bot/2.0 (mailto:ops@example.org)"; got != want {
+		t.Errorf("User-Agent = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,21 @@
+package storage
+
+import "context"
+
+type beforeRequestKey struct{}
+
+// WithBeforeRequest returns a context whose downloads call before right before they send their
+// request to the origin, e.g., to wait for a rate limiter or count the request against a quota. An
+// error from it fails the download without a request. Downloads that send no request, such as those
+// sharing a transfer in progress or skipped by the collision policy, do not call it.
+func WithBeforeRequest(ctx context.Context, before func(ctx context.Context) error) context.Context {
+	return context.WithValue(ctx, beforeRequestKey{}, before)
+}
+
+// BeforeRequest calls the function the context was given with WithBeforeRequest, if any
+func BeforeRequest(ctx context.Context) error {
+	if before, ok := ctx.Value(beforeRequestKey{}).(func(ctx context.Context) error); ok {
+		return before(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"opus-mcp/internal/metrics"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// s3MaxAttempts bounds the attempts of an S3 operation that keeps failing with transient errors
+const s3MaxAttempts = 3
+
+// s3RetryBaseDelay is the wait before the first retry, doubled for each further retry; replaced in tests
+var s3RetryBaseDelay = 200 * time.Millisecond
+
+// transientS3Codes are S3 error codes reported by a server under load, for which waiting and
+// trying again is expected to succeed
+var transientS3Codes = map[string]bool{
+	"SlowDown":       true,
+	"SlowDownRead":   true,
+	"SlowDownWrite":  true,
+	"InternalError":  true,
+	"RequestTimeout": true,
+}
+
+// permanentS3Codes are S3 error codes that no amount of retrying fixes: authentication and access
+// problems, and missing or invalid buckets
+var permanentS3Codes = map[string]bool{
+	"AccessDenied":                 true,
+	"AllAccessDisabled":            true,
+	"InvalidAccessKeyId":           true,
+	"SignatureDoesNotMatch":        true,
+	"ExpiredToken":                 true,
+	"InvalidToken":                 true,
+	"NoSuchBucket":                 true,
+	"InvalidBucketName":            true,
+	"AuthorizationHeaderMalformed": true,
+}
+
+// classifyS3Error reports the S3 error code of an error and whether the operation that failed with
+// it should be retried. Only S3 error responses are classified; other errors, such as those of the
+// HTTP download feeding an upload, are never retried here.
+func classifyS3Error(err error) (code string, retry bool) {
+	var errResp minio.ErrorResponse
+	if !errors.As(err, &errResp) {
+		return "", false
+	}
+	switch {
+	case permanentS3Codes[errResp.Code]:
+		return errResp.Code, false
+	case transientS3Codes[errResp.Code]:
+		return errResp.Code, true
+	case errResp.StatusCode == http.StatusServiceUnavailable:
+		// Responses without a body, e.g., to HEAD requests, only carry the status
+		return errResp.Code, true
+	}
+	return errResp.Code, false
+}
+
+// observeS3Operation records the duration of an S3 operation that started at start and ended with err
+func observeS3Operation(operation string, start time.Time, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	metrics.S3OperationDuration.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+}
+
+// withS3Retry runs an S3 operation, retrying it with exponential backoff while it fails with
+// transient errors, at most s3MaxAttempts times in total. The operation must be safe to repeat.
+// Its duration, including retries, is observed in the S3 operation latency histogram.
+// The error it finally fails with is classified by classifyError.
+func withS3Retry(ctx context.Context, operation string, fn func() error) (err error) {
+	start := time.Now()
+	defer func() { observeS3Operation(operation, start, err) }()
+
+	delay := s3RetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		code, retry := classifyS3Error(err)
+		if !retry || attempt >= s3MaxAttempts {
+			return classifyError(err)
+		}
+
+		metrics.S3RetriesTotal.WithLabelValues(operation, code).Inc()
+		slog.Warn("Transient S3 error, retrying",
+			"operation", operation,
+			"code", code,
+			"attempt", attempt,
+			"delay", delay,
+			"error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return classifyError(err)
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"opus-mcp/internal/metrics"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestClassifyS3Error(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCode  string
+		wantRetry bool
+	}{
+		{"slow down", minio.ErrorResponse{Code: "SlowDown", StatusCode: http.StatusServiceUnavailable}, "SlowDown", true},
+		{"slow down write", minio.ErrorResponse{Code: "SlowDownWrite", StatusCode: http.StatusServiceUnavailable}, "SlowDownWrite", true},
+		{"internal error", minio.ErrorResponse{Code: "InternalError", StatusCode: http.StatusInternalServerError}, "InternalError", true},
+		{"request timeout", minio.ErrorResponse{Code: "RequestTimeout", StatusCode: http.StatusBadRequest}, "RequestTimeout", true},
+		{"wrapped slow down", fmt.Errorf("failed to upload: %w", minio.ErrorResponse{Code: "SlowDown", StatusCode: http.StatusServiceUnavailable}), "SlowDown", true},
+		{"503 without a body", minio.ErrorResponse{Code: "503 Service Unavailable", StatusCode: http.StatusServiceUnavailable}, "503 Service Unavailable", true},
+		{"access denied", minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}, "AccessDenied", false},
+		{"invalid access key", minio.ErrorResponse{Code: "InvalidAccessKeyId", StatusCode: http.StatusForbidden}, "InvalidAccessKeyId", false},
+		{"signature mismatch", minio.ErrorResponse{Code: "SignatureDoesNotMatch", StatusCode: http.StatusForbidden}, "SignatureDoesNotMatch", false},
+		{"missing bucket", minio.ErrorResponse{Code: "NoSuchBucket", StatusCode: http.StatusNotFound}, "NoSuchBucket", false},
+		// A permanent code is not retried even if a proxy reports it with a 503
+		{"access denied with 503", minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusServiceUnavailable}, "AccessDenied", false},
+		{"missing key", minio.ErrorResponse{Code: "NoSuchKey", StatusCode: http.StatusNotFound}, "NoSuchKey", false},
+		{"not an S3 error", errors.New("HTTP request failed with status 503"), "", false},
+		{"context canceled", context.Canceled, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, retry := classifyS3Error(tt.err)
+			if code != tt.wantCode || retry != tt.wantRetry {
+				t.Errorf("classifyS3Error() = %q, %v, want %q, %v", code, retry, tt.wantCode, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func withoutRetryDelay(t *testing.T) {
+	t.Helper()
+	original := s3RetryBaseDelay
+	t.Cleanup(func() { s3RetryBaseDelay = original })
+	s3RetryBaseDelay = time.Millisecond
+}
+
+func TestWithS3Retry(t *testing.T) {
+	withoutRetryDelay(t)
+	slowDown := minio.ErrorResponse{Code: "SlowDown", StatusCode: http.StatusServiceUnavailable}
+
+	t.Run("succeeds after transient errors", func(t *testing.T) {
+		before := testutil.ToFloat64(metrics.S3RetriesTotal.WithLabelValues("test_transient", "SlowDown"))
+		calls := 0
+		err := withS3Retry(context.Background(), "test_transient", func() error {
+			calls++
+			if calls < s3MaxAttempts {
+				return slowDown
+			}
+			return nil
+		})
+		if err != nil || calls != s3MaxAttempts {
+			t.Errorf("withS3Retry() = %v after %d calls, want success after %d", err, calls, s3MaxAttempts)
+		}
+		if got := testutil.ToFloat64(metrics.S3RetriesTotal.WithLabelValues("test_transient", "SlowDown")) - before; got != s3MaxAttempts-1 {
+			t.Errorf("retries counted = %v, want %d", got, s3MaxAttempts-1)
+		}
+	})
+
+	t.Run("observes the latency of the whole operation", func(t *testing.T) {
+		observed := func(outcome string) (uint64, float64) {
+			t.Helper()
+			var metric dto.Metric
+			if err := metrics.S3OperationDuration.WithLabelValues("test_latency", outcome).(prometheus.Histogram).Write(&metric); err != nil {
+				t.Fatalf("failed to read histogram: %v", err)
+			}
+			return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+		}
+		okCount, okSum := observed("ok")
+		errorCount, _ := observed("error")
+
+		err := withS3Retry(context.Background(), "test_latency", func() error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("withS3Retry() unexpected error: %v", err)
+		}
+		_ = withS3Retry(context.Background(), "test_latency", func() error {
+			return minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}
+		})
+
+		if count, sum := observed("ok"); count-okCount != 1 || sum-okSum < 0.01 {
+			t.Errorf("ok observations = %d with %vs, want 1 of at least 10ms", count-okCount, sum-okSum)
+		}
+		if count, _ := observed("error"); count-errorCount != 1 {
+			t.Errorf("error observations = %d, want 1", count-errorCount)
+		}
+	})
+
+	t.Run("gives up after the attempt limit", func(t *testing.T) {
+		calls := 0
+		err := withS3Retry(context.Background(), "test_exhausted", func() error {
+			calls++
+			return slowDown
+		})
+		if !errors.As(err, new(minio.ErrorResponse)) || calls != s3MaxAttempts {
+			t.Errorf("withS3Retry() = %v after %d calls, want the last error after %d", err, calls, s3MaxAttempts)
+		}
+	})
+
+	t.Run("permanent errors are not retried", func(t *testing.T) {
+		calls := 0
+		err := withS3Retry(context.Background(), "test_permanent", func() error {
+			calls++
+			return minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}
+		})
+		if !errors.Is(err, ErrAccessDenied) || calls != 1 {
+			t.Errorf("withS3Retry() = %v after %d calls, want a single attempt failing with ErrAccessDenied", err, calls)
+		}
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		err := withS3Retry(ctx, "test_canceled", func() error {
+			calls++
+			cancel()
+			return slowDown
+		})
+		if err == nil || calls != 1 {
+			t.Errorf("withS3Retry() = %v after %d calls, want to stop after the context is canceled", err, calls)
+		}
+	})
+}
+
+// TestPutObjectBytesRetriesSlowDown runs an upload against a fake S3 server that answers the first
+// upload attempt with 503 SlowDown, as MinIO does under load, and the second with success
+func TestPutObjectBytesRetriesSlowDown(t *testing.T) {
+	withoutRetryDelay(t)
+
+	var puts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Query().Has("location"):
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`)
+		case r.Method == http.MethodPut:
+			if puts.Add(1) == 1 {
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>SlowDown</Code><Message>Please reduce your request rate.</Message></Error>`)
+				return
+			}
+			w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+	defer server.Close()
+
+	config := &S3Config{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		AccessKey: "test-access-key",
+		SecretKey: "test-secret-key",
+		UseSSL:    false,
+	}
+	before := testutil.ToFloat64(metrics.S3RetriesTotal.WithLabelValues("put_object", "SlowDown"))
+
+	if err := PutObjectBytes(context.Background(), config, "bucket", "object.json", []byte(`{}`), "application/json"); err != nil {
+		t.Fatalf("PutObjectBytes() unexpected error: %v", err)
+	}
+	if got := puts.Load(); got != 2 {
+		t.Errorf("server received %d uploads, want 2", got)
+	}
+	if got := testutil.ToFloat64(metrics.S3RetriesTotal.WithLabelValues("put_object", "SlowDown")) - before; got != 1 {
+		t.Errorf("retries counted = %v, want 1", got)
+	}
+}
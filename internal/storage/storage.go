@@ -1,17 +1,27 @@
 package storage
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"opus-mcp/internal"
+	"opus-mcp/internal/clock"
+	"opus-mcp/internal/metrics"
+	"opus-mcp/internal/settings"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -19,36 +29,102 @@ import (
 
 // S3Config holds S3 configuration loaded from environment variables
 type S3Config struct {
+	// Endpoint is the host and port of the S3 storage, or a comma-separated list of them in order of
+	// preference, e.g., replicated sites sharing the credentials and buckets; see endpointPool
 	Endpoint           string `env:"OPUS_MCP_S3_ENDPOINT,required,default="`
-	AccessKey          string `env:"OPUS_MCP_S3_ACCESS_KEY,required,default="`
-	SecretKey          string `env:"OPUS_MCP_S3_SECRET_KEY,required,default="`
+	AccessKey          string `env:"OPUS_MCP_S3_ACCESS_KEY,required,default=" secret:"true"`
+	SecretKey          string `env:"OPUS_MCP_S3_SECRET_KEY,required,default=" secret:"true"`
 	UseSSL             bool   `env:"OPUS_MCP_S3_USE_SSL,default=true"`
 	InsecureSkipVerify bool   `env:"OPUS_MCP_S3_INSECURE_SKIP_VERIFY,default=false"`
+	// FailoverThreshold is the number of consecutive failed requests after which an endpoint is
+	// demoted in favour of the next healthy one
+	FailoverThreshold int `env:"OPUS_MCP_S3_FAILOVER_THRESHOLD,default=3"`
+	// ProbeInterval is how often demoted endpoints are probed to find out whether they recovered
+	ProbeInterval settings.Duration `env:"OPUS_MCP_S3_PROBE_INTERVAL,default=30s"`
 }
 
-// createMinIOClient creates a configured S3 client with the given config
-func createMinIOClient(config *S3Config) (*minio.Client, error) {
-	minioOptions := &minio.Options{
-		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
-		Secure: config.UseSSL,
+// Validate checks that there is at least one endpoint and that failover is configured sensibly
+func (c *S3Config) Validate() error {
+	var errs []error
+	if len(c.Endpoints()) == 0 {
+		errs = append(errs, errors.New("OPUS_MCP_S3_ENDPOINT must name at least one endpoint"))
+	}
+	if c.FailoverThreshold < 1 {
+		errs = append(errs, fmt.Errorf("OPUS_MCP_S3_FAILOVER_THRESHOLD must be at least 1, got %d", c.FailoverThreshold))
+	}
+	if c.ProbeInterval.Duration() <= 0 {
+		errs = append(errs, fmt.Errorf("OPUS_MCP_S3_PROBE_INTERVAL must be positive, got %s", c.ProbeInterval))
 	}
+	return errors.Join(errs...)
+}
+
+// Endpoints returns the endpoints of the configuration in order of preference
+func (c *S3Config) Endpoints() []string {
+	var endpoints []string
+	for endpoint := range strings.SplitSeq(c.Endpoint, ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
 
-	// Configure custom transport for insecure TLS if needed
+// s3Transport creates the HTTP transport of S3 requests, skipping TLS verification if so configured
+func s3Transport(config *S3Config) (http.RoundTripper, error) {
 	if config.InsecureSkipVerify {
 		slog.Warn("🚨 TLS certificate verification is DISABLED for S3 connection")
-		minioOptions.Transport = &http.Transport{
+		return &http.Transport{
 			TLSClientConfig: &tls.Config{
 				InsecureSkipVerify: true,
 			},
-		}
+		}, nil
+	}
+	return minio.DefaultTransport(config.UseSSL)
+}
+
+// createMinIOClient creates a configured S3 client with the given config, bound to the active
+// endpoint of its endpoints
+func createMinIOClient(config *S3Config) (*minio.Client, error) {
+	minioOptions := &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: config.UseSSL,
+		// Retries are left to withS3Retry, which classifies S3 errors and counts every retry
+		MaxRetries: 1,
+	}
+
+	transport, err := s3Transport(config)
+	if err != nil {
+		return nil, err
 	}
+	pool := endpointPoolFor(config)
+	endpoint := pool.activeEndpoint()
+	// Storage responses tell how far the server clock is off, and their failures when to fail over
+	minioOptions.Transport = pool.transport(endpoint, clock.Transport(transport, clock.Shared, "s3"))
+
+	return minio.New(endpoint, minioOptions)
+}
 
-	return minio.New(config.Endpoint, minioOptions)
+// UploadResult is the outcome of a successful upload, extending the S3 upload information with
+// the SHA-256 digest of the uploaded content computed while streaming it
+type UploadResult struct {
+	minio.UploadInfo
+	SHA256 string
+	// OriginalFilename is the sanitized filename named by the Content-Disposition header of the
+	// download, if any
+	OriginalFilename string
+	// RequestedName is the object name the upload asked for, when it was taken and the upload was
+	// stored under a content-hash suffix instead
+	RequestedName string
+	// Timings splits the duration of the download into its origin and S3 phases
+	Timings TransferTimings
+	// Coalesced reports that the object was being transferred from the same URL by another request,
+	// whose result this is, so that it was not downloaded again
+	Coalesced bool
 }
 
 // DownloadURLToS3 downloads a file from an HTTP(s) URL and uploads it to an S3 bucket.
-// It uses the CreateConfiguredHTTPClient function for the HTTP download to support proxy
-// configurations and custom CA certificates.
+// It downloads with a copy of the shared configured HTTP client (see internal.GetSharedHTTPClient) to
+// support proxy configurations and custom CA certificates.
 //
 // Parameters:
 //   - ctx: Context for cancellation and timeout control
@@ -56,42 +132,55 @@ func createMinIOClient(config *S3Config) (*minio.Client, error) {
 //   - config: S3 configuration (endpoint, credentials, SSL settings)
 //   - bucketName: Target S3 bucket name
 //   - objectName: Target object name in the bucket (file name/path)
+//   - metadata: Optional additional user metadata to store with the object
+//   - policy: What to do when an object with the name already exists
 //
-// Returns the upload information and an error if any step fails (download, upload, or S3 operations).
-func DownloadURLToS3(ctx context.Context, sourceURL string, config *S3Config, bucketName, objectName string) (minio.UploadInfo, error) {
+// Returns the upload information, including the SHA-256 digest of the uploaded content, and an error
+// if any step fails (download, upload, or S3 operations). A name taken under CollisionError is
+// reported as a *ConflictError before anything is downloaded.
+func DownloadURLToS3(ctx context.Context, sourceURL string, config *S3Config, bucketName, objectName string, metadata map[string]string, policy CollisionPolicy) (UploadResult, error) {
 	// Validate inputs
 	if sourceURL == "" {
-		return minio.UploadInfo{}, fmt.Errorf("source URL cannot be empty")
+		return UploadResult{}, fmt.Errorf("source URL cannot be empty")
 	}
 	if bucketName == "" {
-		return minio.UploadInfo{}, fmt.Errorf("bucket name cannot be empty")
+		return UploadResult{}, fmt.Errorf("bucket name cannot be empty")
 	}
-	if objectName == "" {
-		return minio.UploadInfo{}, fmt.Errorf("object name cannot be empty")
+	if err := ValidateObjectKey(objectName, KeyRules{}); err != nil {
+		return UploadResult{}, err
 	}
 
 	// Parse and validate the source URL
 	parsedURL, err := url.Parse(sourceURL)
 	if err != nil {
-		return minio.UploadInfo{}, fmt.Errorf("invalid source URL: %w", err)
+		return UploadResult{}, fmt.Errorf("invalid source URL: %w", err)
 	}
 	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-		return minio.UploadInfo{}, fmt.Errorf("unsupported URL scheme: %s (only http and https are supported)", parsedURL.Scheme)
+		return UploadResult{}, fmt.Errorf("unsupported URL scheme: %s (only http and https are supported)", parsedURL.Scheme)
+	}
+
+	httpClient, err := newDownloadHTTPClient(parsedURL)
+	if err != nil {
+		return UploadResult{}, err
 	}
 
 	// Initialize MinIO client
 	minioClient, err := createMinIOClient(config)
 	if err != nil {
-		return minio.UploadInfo{}, fmt.Errorf("failed to create MinIO client: %w", err)
+		return UploadResult{}, fmt.Errorf("failed to create MinIO client: %w", err)
 	}
 
 	// Check if bucket exists and is accessible
-	exists, err := minioClient.BucketExists(ctx, bucketName)
+	var exists bool
+	err = withS3Retry(ctx, "bucket_exists", func() error {
+		exists, err = minioClient.BucketExists(ctx, bucketName)
+		return err
+	})
 	if err != nil {
-		return minio.UploadInfo{}, fmt.Errorf("failed to check if bucket exists: %w", err)
+		return UploadResult{}, fmt.Errorf("failed to check if bucket exists: %w", err)
 	}
 	if !exists {
-		return minio.UploadInfo{}, fmt.Errorf("bucket '%s' does not exist", bucketName)
+		return UploadResult{}, fmt.Errorf("%w: %s", ErrBucketNotFound, bucketName)
 	}
 
 	slog.Info("Starting download from URL to S3 storage",
@@ -100,53 +189,138 @@ func DownloadURLToS3(ctx context.Context, sourceURL string, config *S3Config, bu
 		"object", objectName,
 		"endpoint", config.Endpoint)
 
-	// Download the file from the URL using the configured HTTP client
-	httpClient, err := internal.CreateConfiguredHTTPClient()
+	// Metadata is sanitized so that non-ASCII values, e.g., file names or search queries, cannot
+	// make the upload fail after the download
+	userMetadata := map[string]string{
+		"source-url":    sourceURL,
+		"download-date": time.Now().Format(time.RFC3339),
+		"original-name": filepath.Base(parsedURL.Path),
+	}
+	for key, value := range metadata {
+		userMetadata[key] = value
+	}
+	userMetadata = SanitizeMetadata(userMetadata)
+
+	// Concurrent downloads of the same object from the same URL share a single transfer
+	return inflightTransfers.do(ctx, bucketName, objectName, sourceURL, func() (UploadResult, error) {
+		return transferURLToObject(ctx, httpClient, minioClient, sourceURL, bucketName, objectName, userMetadata, policy)
+	})
+}
+
+// transferURLToObject downloads a URL and uploads it to an object, hashing the content on the way.
+// The content is held within the upload buffer budget, so that an upload failing with a transient
+// S3 error is retried without downloading again; content that is streamed is uploaded only once.
+// An upload renamed by the collision policy needs its digest for its name, so it cannot be streamed.
+func transferURLToObject(ctx context.Context, httpClient *http.Client, minioClient *minio.Client, sourceURL, bucketName, objectName string, userMetadata map[string]string, policy CollisionPolicy) (UploadResult, error) {
+	rename, err := checkCollision(ctx, minioClient, bucketName, objectName, policy)
 	if err != nil {
-		return minio.UploadInfo{}, fmt.Errorf("failed to create configured HTTP client: %w", err)
+		return UploadResult{}, err
 	}
 
+	if err := BeforeRequest(ctx); err != nil {
+		return UploadResult{}, err
+	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
 	if err != nil {
-		return minio.UploadInfo{}, fmt.Errorf("failed to create HTTP request: %w", err)
+		return UploadResult{}, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
 	startTime := time.Now()
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return minio.UploadInfo{}, fmt.Errorf("failed to download file from URL: %w", err)
+		return UploadResult{}, fmt.Errorf("failed to download file from URL: %w", err)
 	}
 	defer resp.Body.Close()
+	var timings TransferTimings
+	timings.OriginTTFB = time.Since(startTime)
 
 	if resp.StatusCode != http.StatusOK {
-		return minio.UploadInfo{}, fmt.Errorf("HTTP request failed with status %d: %s", resp.StatusCode, resp.Status)
+		return UploadResult{}, fmt.Errorf("HTTP request failed with status %d: %s", resp.StatusCode, resp.Status)
 	}
 
-	// Determine content type and size
-	contentType := resp.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	// Record the filename the server gave the download, which the URL may not tell, e.g., its version
+	filename := DispositionFilename(resp.Header.Get("Content-Disposition"))
+	if filename != "" {
+		userMetadata = maps.Clone(userMetadata)
+		userMetadata[originalFilenameMetadataKey] = sanitizeMetadataValue(filename)
+	}
+	origin := &progressReader{reader: internal.ContextReader(ctx, resp.Body), totalBytes: resp.ContentLength, start: time.Now()}
+	contentType, content := sniffContentType(origin)
+	held, err := uploadBuffers.hold(content, resp.ContentLength)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	defer held.Close()
+	// Held content has been read in full, so its origin side is known before the upload
+	timings.Streamed = !held.replayable()
+	if !timings.Streamed {
+		timings.OriginTransfer, timings.OriginBytes = origin.elapsed(), origin.bytesTransferred
+		originMetadata := timings.originMetadata()
+		maps.Copy(originMetadata, userMetadata)
+		userMetadata = originMetadata
+	}
+
+	var requestedName string
+	if rename {
+		if !held.replayable() {
+			return UploadResult{}, fmt.Errorf("object '%s' already exists and the download is too large to hold for naming it by its content; set OPUS_MCP_SPOOL_DIR to allow it", objectName)
+		}
+		requestedName, objectName = objectName, HashedObjectName(objectName, held.sha256())
+		slog.Info("Object name is taken - storing the download under its content hash", "requested", requestedName, "object", objectName)
 	}
-	contentLength := resp.ContentLength
 
 	slog.Info("File download started",
 		"content_type", contentType,
-		"content_length", contentLength,
-		"status_code", resp.StatusCode)
-
-	// Upload to S3 using PutObject
-	// PutObject automatically handles streaming the data
-	uploadInfo, err := minioClient.PutObject(ctx, bucketName, objectName, resp.Body, contentLength, minio.PutObjectOptions{
-		ContentType: contentType,
-		UserMetadata: map[string]string{
-			"source-url":    sourceURL,
-			"download-date": time.Now().Format(time.RFC3339),
-			"original-name": filepath.Base(parsedURL.Path),
-		},
-	})
+		"declared_content_type", resp.Header.Get("Content-Type"),
+		"content_length", resp.ContentLength,
+		"status_code", resp.StatusCode,
+		"held_in", held.mode)
+
+	var uploadInfo minio.UploadInfo
+	upload := func() error {
+		body, err := held.reader()
+		if err != nil {
+			return err
+		}
+		uploadInfo, err = minioClient.PutObject(ctx, bucketName, objectName, body, held.size, minio.PutObjectOptions{
+			ContentType:  contentType,
+			UserMetadata: userMetadata,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to upload file to S3: %w", err)
+		}
+		return nil
+	}
+	timer := metrics.StartOperation(metrics.SlowS3Upload)
+	uploadStart := time.Now()
+	if held.replayable() {
+		err = withS3Retry(ctx, "put_object", upload)
+	} else {
+		// Streamed content cannot be read again, so the upload gets a single attempt
+		start := time.Now()
+		err = upload()
+		observeS3Operation("put_object", start, err)
+	}
 	if err != nil {
-		return minio.UploadInfo{}, fmt.Errorf("failed to upload file to S3: %w", err)
+		if cancelErr := cancelledUpload(ctx, minioClient, bucketName, objectName, uploadInfo, err, nil); cancelErr != nil {
+			return UploadResult{}, cancelErr
+		}
+		return UploadResult{}, err
 	}
+	// A download cut short can still be uploaded, so a truncated object is removed again
+	if verifyErr := held.verify(resp.ContentLength, uploadInfo.Size); verifyErr != nil {
+		if cancelErr := cancelledUpload(ctx, minioClient, bucketName, objectName, uploadInfo, nil, verifyErr); cancelErr != nil {
+			return UploadResult{}, cancelErr
+		}
+		removeTruncatedObject(ctx, minioClient, bucketName, objectName, uploadInfo.VersionID)
+		return UploadResult{}, verifyErr
+	}
+	timer.Done(uploadInfo.Size, "bucket", bucketName, "object", objectName, "held_in", held.mode)
+	timings.Upload, timings.UploadBytes = time.Since(uploadStart), uploadInfo.Size
+	if timings.Streamed {
+		timings.OriginTransfer, timings.OriginBytes = origin.elapsed(), origin.bytesTransferred
+	}
+	timings.observe()
 
 	duration := time.Since(startTime)
 	slog.Info("Successfully uploaded file to S3 storage",
@@ -155,9 +329,85 @@ func DownloadURLToS3(ctx context.Context, sourceURL string, config *S3Config, bu
 		"size", uploadInfo.Size,
 		"etag", uploadInfo.ETag,
 		"duration", duration,
+		"origin_ttfb", timings.OriginTTFB,
+		"origin_transfer", timings.OriginTransfer,
+		"upload", timings.Upload,
 		"version_id", uploadInfo.VersionID)
 
-	return uploadInfo, nil
+	return UploadResult{
+		UploadInfo:       uploadInfo,
+		SHA256:           held.sha256(),
+		OriginalFilename: filename,
+		RequestedName:    requestedName,
+		Timings:          timings,
+	}, nil
+}
+
+// sniffContentType determines the content type of a download from its first 512 bytes rather than
+// trusting the type the server declares, and returns a reader over the whole content
+func sniffContentType(body io.Reader) (string, io.Reader) {
+	buffered := bufio.NewReader(body)
+	// A download shorter than 512 bytes is sniffed whole; a failed read surfaces when the content is read
+	head, _ := buffered.Peek(512)
+	return http.DetectContentType(head), buffered
+}
+
+// downloadMetadata is the user metadata describing where and when a download was made
+func downloadMetadata(sourceURL string, parsedURL *url.URL, resp *http.Response) map[string]string {
+	metadata := map[string]string{
+		"source-url":    sourceURL,
+		"download-date": time.Now().Format(time.RFC3339),
+		"original-name": filepath.Base(parsedURL.Path),
+	}
+	if filename := DispositionFilename(resp.Header.Get("Content-Disposition")); filename != "" {
+		metadata[originalFilenameMetadataKey] = filename
+	}
+	return metadata
+}
+
+// cleanupTimeout bounds the requests that clean up after an upload, which outlive its context
+const cleanupTimeout = 30 * time.Second
+
+// removeTruncatedObject deletes an object uploaded from an incomplete download. The deletion goes
+// ahead when the context of the upload was cancelled, which may be why the download was cut short.
+func removeTruncatedObject(ctx context.Context, minioClient *minio.Client, bucketName, objectName, versionID string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+	err := withS3Retry(ctx, "remove_object", func() error {
+		return minioClient.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{VersionID: versionID})
+	})
+	if err != nil {
+		slog.Error("Failed to remove object uploaded from an incomplete download",
+			"bucket", bucketName,
+			"object", objectName,
+			"error", err)
+		return
+	}
+	slog.Warn("Removed object uploaded from an incomplete download", "bucket", bucketName, "object", objectName)
+}
+
+// cancelledUpload cleans up after an upload that failed, or uploaded a truncated download, because
+// its context was cancelled, and returns the cancellation as the error; it returns nil otherwise.
+// minio-go aborts a failed multipart upload with the upload's own context, which no longer works
+// once it is cancelled, so the parts already uploaded are aborted here instead.
+func cancelledUpload(ctx context.Context, minioClient *minio.Client, bucketName, objectName string, uploadInfo minio.UploadInfo, uploadErr, verifyErr error) error {
+	ctxErr := ctx.Err()
+	if ctxErr == nil || (uploadErr == nil && verifyErr == nil) {
+		return nil
+	}
+	if uploadErr == nil {
+		removeTruncatedObject(ctx, minioClient, bucketName, objectName, uploadInfo.VersionID)
+	}
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+	if err := minioClient.RemoveIncompleteUpload(cleanupCtx, bucketName, objectName); err != nil {
+		slog.Error("Failed to abort the upload of a cancelled download",
+			"bucket", bucketName,
+			"object", objectName,
+			"error", err)
+	}
+	slog.Warn("Upload cancelled", "bucket", bucketName, "object", objectName)
+	return fmt.Errorf("upload of %s cancelled: %w", objectName, ctxErr)
 }
 
 // DownloadURLToS3Stream is a streaming variant that doesn't require knowing the content length upfront.
@@ -179,8 +429,8 @@ func DownloadURLToS3Stream(ctx context.Context, sourceURL string, config S3Confi
 	if bucketName == "" {
 		return minio.UploadInfo{}, fmt.Errorf("bucket name cannot be empty")
 	}
-	if objectName == "" {
-		return minio.UploadInfo{}, fmt.Errorf("object name cannot be empty")
+	if err := ValidateObjectKey(objectName, KeyRules{}); err != nil {
+		return minio.UploadInfo{}, err
 	}
 
 	// Parse and validate the source URL
@@ -192,6 +442,11 @@ func DownloadURLToS3Stream(ctx context.Context, sourceURL string, config S3Confi
 		return minio.UploadInfo{}, fmt.Errorf("unsupported URL scheme: %s (only http and https are supported)", parsedURL.Scheme)
 	}
 
+	httpClient, err := newDownloadHTTPClient(parsedURL)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+
 	// Initialize S3 client
 	minioClient, err := createMinIOClient(&config)
 	if err != nil {
@@ -199,12 +454,16 @@ func DownloadURLToS3Stream(ctx context.Context, sourceURL string, config S3Confi
 	}
 
 	// Check if bucket exists and is accessible
-	exists, err := minioClient.BucketExists(ctx, bucketName)
+	var exists bool
+	err = withS3Retry(ctx, "bucket_exists", func() error {
+		exists, err = minioClient.BucketExists(ctx, bucketName)
+		return err
+	})
 	if err != nil {
 		return minio.UploadInfo{}, fmt.Errorf("failed to check if bucket exists: %w", err)
 	}
 	if !exists {
-		return minio.UploadInfo{}, fmt.Errorf("bucket '%s' does not exist", bucketName)
+		return minio.UploadInfo{}, fmt.Errorf("%w: %s", ErrBucketNotFound, bucketName)
 	}
 
 	slog.Info("Starting streaming download from URL to S3 storage",
@@ -213,12 +472,9 @@ func DownloadURLToS3Stream(ctx context.Context, sourceURL string, config S3Confi
 		"object", objectName,
 		"endpoint", config.Endpoint)
 
-	// Download the file from the URL using the configured HTTP client
-	httpClient, err := internal.CreateConfiguredHTTPClient()
-	if err != nil {
-		return minio.UploadInfo{}, fmt.Errorf("failed to create configured HTTP client: %w", err)
+	if err := BeforeRequest(ctx); err != nil {
+		return minio.UploadInfo{}, err
 	}
-
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
 	if err != nil {
 		return minio.UploadInfo{}, fmt.Errorf("failed to create HTTP request: %w", err)
@@ -235,27 +491,36 @@ func DownloadURLToS3Stream(ctx context.Context, sourceURL string, config S3Confi
 		return minio.UploadInfo{}, fmt.Errorf("HTTP request failed with status %d: %s", resp.StatusCode, resp.Status)
 	}
 
-	// Determine content type
-	contentType := resp.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	limited, err := uploadBuffers.limit(internal.ContextReader(ctx, resp.Body), resp.ContentLength)
+	if err != nil {
+		return minio.UploadInfo{}, err
 	}
+	contentType, content := sniffContentType(limited)
 
 	slog.Info("File download started (streaming mode)",
 		"content_type", contentType,
+		"declared_content_type", resp.Header.Get("Content-Type"),
 		"status_code", resp.StatusCode)
 
 	// Upload to S3 using PutObject with -1 for unknown size (streaming mode)
-	uploadInfo, err := minioClient.PutObject(ctx, bucketName, objectName, resp.Body, -1, minio.PutObjectOptions{
-		ContentType: contentType,
-		UserMetadata: map[string]string{
-			"source-url":    sourceURL,
-			"download-date": time.Now().Format(time.RFC3339),
-			"original-name": filepath.Base(parsedURL.Path),
-		},
+	body := &receivingReader{reader: content}
+	uploadInfo, err := minioClient.PutObject(ctx, bucketName, objectName, body, -1, minio.PutObjectOptions{
+		ContentType:  contentType,
+		UserMetadata: SanitizeMetadata(downloadMetadata(sourceURL, parsedURL, resp)),
 	})
 	if err != nil {
-		return minio.UploadInfo{}, fmt.Errorf("failed to upload file to S3: %w", err)
+		if cancelErr := cancelledUpload(ctx, minioClient, bucketName, objectName, uploadInfo, err, nil); cancelErr != nil {
+			return minio.UploadInfo{}, cancelErr
+		}
+		return minio.UploadInfo{}, fmt.Errorf("failed to upload file to S3: %w", classifyError(err))
+	}
+	// A download cut short can still be uploaded, so a truncated object is removed again
+	if verifyErr := body.verify(resp.ContentLength, uploadInfo.Size); verifyErr != nil {
+		if cancelErr := cancelledUpload(ctx, minioClient, bucketName, objectName, uploadInfo, nil, verifyErr); cancelErr != nil {
+			return minio.UploadInfo{}, cancelErr
+		}
+		removeTruncatedObject(ctx, minioClient, bucketName, objectName, uploadInfo.VersionID)
+		return minio.UploadInfo{}, verifyErr
 	}
 
 	duration := time.Since(startTime)
@@ -290,8 +555,8 @@ func DownloadURLToS3WithProgress(ctx context.Context, sourceURL string, config S
 	if bucketName == "" {
 		return minio.UploadInfo{}, fmt.Errorf("bucket name cannot be empty")
 	}
-	if objectName == "" {
-		return minio.UploadInfo{}, fmt.Errorf("object name cannot be empty")
+	if err := ValidateObjectKey(objectName, KeyRules{}); err != nil {
+		return minio.UploadInfo{}, err
 	}
 
 	// Parse and validate the source URL
@@ -303,6 +568,11 @@ func DownloadURLToS3WithProgress(ctx context.Context, sourceURL string, config S
 		return minio.UploadInfo{}, fmt.Errorf("unsupported URL scheme: %s (only http and https are supported)", parsedURL.Scheme)
 	}
 
+	httpClient, err := newDownloadHTTPClient(parsedURL)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+
 	// Initialize S3 client
 	minioClient, err := createMinIOClient(&config)
 	if err != nil {
@@ -310,12 +580,16 @@ func DownloadURLToS3WithProgress(ctx context.Context, sourceURL string, config S
 	}
 
 	// Check if bucket exists and is accessible
-	exists, err := minioClient.BucketExists(ctx, bucketName)
+	var exists bool
+	err = withS3Retry(ctx, "bucket_exists", func() error {
+		exists, err = minioClient.BucketExists(ctx, bucketName)
+		return err
+	})
 	if err != nil {
 		return minio.UploadInfo{}, fmt.Errorf("failed to check if bucket exists: %w", err)
 	}
 	if !exists {
-		return minio.UploadInfo{}, fmt.Errorf("bucket '%s' does not exist", bucketName)
+		return minio.UploadInfo{}, fmt.Errorf("%w: %s", ErrBucketNotFound, bucketName)
 	}
 
 	slog.Info("Starting download from URL to S3 storage with progress tracking",
@@ -324,12 +598,9 @@ func DownloadURLToS3WithProgress(ctx context.Context, sourceURL string, config S
 		"object", objectName,
 		"endpoint", config.Endpoint)
 
-	// Download the file from the URL using the configured HTTP client
-	httpClient, err := internal.CreateConfiguredHTTPClient()
-	if err != nil {
-		return minio.UploadInfo{}, fmt.Errorf("failed to create configured HTTP client: %w", err)
+	if err := BeforeRequest(ctx); err != nil {
+		return minio.UploadInfo{}, err
 	}
-
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
 	if err != nil {
 		return minio.UploadInfo{}, fmt.Errorf("failed to create HTTP request: %w", err)
@@ -347,22 +618,25 @@ func DownloadURLToS3WithProgress(ctx context.Context, sourceURL string, config S
 	}
 
 	// Determine content type and size
-	contentType := resp.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/octet-stream"
-	}
 	contentLength := resp.ContentLength
+	limited, err := uploadBuffers.limit(internal.ContextReader(ctx, resp.Body), contentLength)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	contentType, content := sniffContentType(limited)
 
 	slog.Info("File download started with progress tracking",
 		"content_type", contentType,
+		"declared_content_type", resp.Header.Get("Content-Type"),
 		"content_length", contentLength,
 		"status_code", resp.StatusCode)
 
 	// Wrap the reader with progress tracking if callback provided
-	var reader io.Reader = resp.Body
+	body := &receivingReader{reader: content}
+	var reader io.Reader = body
 	if progressFunc != nil {
 		reader = &progressReader{
-			reader:       resp.Body,
+			reader:       body,
 			totalBytes:   contentLength,
 			progressFunc: progressFunc,
 		}
@@ -370,15 +644,22 @@ func DownloadURLToS3WithProgress(ctx context.Context, sourceURL string, config S
 
 	// Upload to S3 using PutObject
 	uploadInfo, err := minioClient.PutObject(ctx, bucketName, objectName, reader, contentLength, minio.PutObjectOptions{
-		ContentType: contentType,
-		UserMetadata: map[string]string{
-			"source-url":    sourceURL,
-			"download-date": time.Now().Format(time.RFC3339),
-			"original-name": filepath.Base(parsedURL.Path),
-		},
+		ContentType:  contentType,
+		UserMetadata: SanitizeMetadata(downloadMetadata(sourceURL, parsedURL, resp)),
 	})
 	if err != nil {
-		return minio.UploadInfo{}, fmt.Errorf("failed to upload file to S3: %w", err)
+		if cancelErr := cancelledUpload(ctx, minioClient, bucketName, objectName, uploadInfo, err, nil); cancelErr != nil {
+			return minio.UploadInfo{}, cancelErr
+		}
+		return minio.UploadInfo{}, fmt.Errorf("failed to upload file to S3: %w", classifyError(err))
+	}
+	// A download cut short can still be uploaded, so a truncated object is removed again
+	if verifyErr := body.verify(contentLength, uploadInfo.Size); verifyErr != nil {
+		if cancelErr := cancelledUpload(ctx, minioClient, bucketName, objectName, uploadInfo, nil, verifyErr); cancelErr != nil {
+			return minio.UploadInfo{}, cancelErr
+		}
+		removeTruncatedObject(ctx, minioClient, bucketName, objectName, uploadInfo.VersionID)
+		return minio.UploadInfo{}, verifyErr
 	}
 
 	duration := time.Since(startTime)
@@ -393,17 +674,31 @@ func DownloadURLToS3WithProgress(ctx context.Context, sourceURL string, config S
 	return uploadInfo, nil
 }
 
-// progressReader wraps an io.Reader to provide progress callbacks
+// progressReader wraps an io.Reader to provide progress callbacks and to time the transfer
 type progressReader struct {
 	reader           io.Reader
 	bytesTransferred int64
 	totalBytes       int64
 	progressFunc     func(bytesTransferred, totalBytes int64)
+	// start is when the transfer started; lastRead is when the latest byte was read
+	start    time.Time
+	lastRead time.Time
+}
+
+// elapsed is the time from the start of the transfer until the latest byte was read
+func (pr *progressReader) elapsed() time.Duration {
+	if pr.start.IsZero() || pr.lastRead.IsZero() {
+		return 0
+	}
+	return pr.lastRead.Sub(pr.start)
 }
 
 func (pr *progressReader) Read(p []byte) (int, error) {
 	n, err := pr.reader.Read(p)
 	pr.bytesTransferred += int64(n)
+	if n > 0 {
+		pr.lastRead = time.Now()
+	}
 
 	if pr.progressFunc != nil && n > 0 {
 		pr.progressFunc(pr.bytesTransferred, pr.totalBytes)
@@ -411,3 +706,159 @@ func (pr *progressReader) Read(p []byte) (int, error) {
 
 	return n, err
 }
+
+// HashObject streams an object from S3 storage and returns the lowercase hex-encoded SHA-256 digest
+// of its content together with its size in bytes.
+func HashObject(ctx context.Context, config *S3Config, bucketName, objectName string) (string, int64, error) {
+	if bucketName == "" {
+		return "", 0, fmt.Errorf("bucket name cannot be empty")
+	}
+	if err := ValidateObjectKey(objectName, KeyRules{}); err != nil {
+		return "", 0, err
+	}
+
+	minioClient, err := createMinIOClient(config)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create MinIO client: %w", err)
+	}
+
+	var digest string
+	var size int64
+	err = withS3Retry(ctx, "get_object", func() error {
+		object, err := minioClient.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get object: %w", err)
+		}
+		defer object.Close()
+
+		hasher := sha256.New()
+		size, err = io.Copy(hasher, object)
+		if err != nil {
+			return fmt.Errorf("failed to read object: %w", err)
+		}
+		digest = hex.EncodeToString(hasher.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return digest, size, nil
+}
+
+// GetObjectBytes reads a small object from S3 storage entirely into memory.
+// It returns ErrObjectNotFound if the object does not exist.
+func GetObjectBytes(ctx context.Context, config *S3Config, bucketName, objectName string) ([]byte, error) {
+	if err := ValidateObjectKey(objectName, KeyRules{}); err != nil {
+		return nil, err
+	}
+	minioClient, err := createMinIOClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MinIO client: %w", err)
+	}
+
+	var data []byte
+	err = withS3Retry(ctx, "get_object", func() error {
+		object, err := minioClient.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get object: %w", err)
+		}
+		defer object.Close()
+
+		data, err = io.ReadAll(object)
+		if err != nil {
+			return fmt.Errorf("failed to read object: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, fmt.Errorf("%w: %s/%s", ErrObjectNotFound, bucketName, objectName)
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// PutObjectBytes writes a small in-memory object to S3 storage, replacing any existing object with the same name.
+func PutObjectBytes(ctx context.Context, config *S3Config, bucketName, objectName string, data []byte, contentType string) error {
+	if err := ValidateObjectKey(objectName, KeyRules{}); err != nil {
+		return err
+	}
+	minioClient, err := createMinIOClient(config)
+	if err != nil {
+		return fmt.Errorf("failed to create MinIO client: %w", err)
+	}
+
+	err = withS3Retry(ctx, "put_object", func() error {
+		_, err := minioClient.PutObject(ctx, bucketName, objectName, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+			ContentType: contentType,
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	return nil
+}
+
+// ReadObjectRange reads up to length bytes of an object starting at offset and returns them together
+// with the total size of the object. Reading at or beyond the end of the object is an error, except
+// at offset 0 of an empty object.
+func ReadObjectRange(ctx context.Context, config *S3Config, bucketName, objectName string, offset, length int64) ([]byte, int64, error) {
+	if err := ValidateObjectKey(objectName, KeyRules{}); err != nil {
+		return nil, 0, err
+	}
+	if offset < 0 {
+		return nil, 0, fmt.Errorf("offset cannot be negative")
+	}
+	if length <= 0 {
+		return nil, 0, fmt.Errorf("length must be positive")
+	}
+
+	minioClient, err := createMinIOClient(config)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create MinIO client: %w", err)
+	}
+
+	var info minio.ObjectInfo
+	err = withS3Retry(ctx, "stat_object", func() error {
+		info, err = minioClient.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, 0, fmt.Errorf("%w: %s/%s", ErrObjectNotFound, bucketName, objectName)
+		}
+		return nil, 0, fmt.Errorf("failed to stat object: %w", err)
+	}
+	if info.Size == 0 && offset == 0 {
+		return []byte{}, 0, nil
+	}
+	if offset >= info.Size {
+		return nil, info.Size, fmt.Errorf("offset %d is beyond the end of the object (size %d)", offset, info.Size)
+	}
+
+	end := min(offset+length, info.Size) - 1
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, end); err != nil {
+		return nil, info.Size, fmt.Errorf("invalid range: %w", err)
+	}
+	var data []byte
+	err = withS3Retry(ctx, "get_object", func() error {
+		object, err := minioClient.GetObject(ctx, bucketName, objectName, opts)
+		if err != nil {
+			return fmt.Errorf("failed to get object: %w", err)
+		}
+		defer object.Close()
+
+		data, err = io.ReadAll(object)
+		if err != nil {
+			return fmt.Errorf("failed to read object range: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, info.Size, err
+	}
+	return data, info.Size, nil
+}
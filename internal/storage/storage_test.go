@@ -0,0 +1,454 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// fakeObjectStore is a fake S3 server that accepts every upload, in one request or in parts, and
+// records the uploaded and deleted objects
+type fakeObjectStore struct {
+	mu      sync.Mutex
+	uploads []string
+	deletes []string
+	// headers are the request headers of the uploads, which carry the object metadata
+	headers []http.Header
+	// incomplete are the objects whose multipart uploads were started but neither completed nor aborted
+	incomplete []string
+	// existing are the objects found by stat requests, with their user metadata
+	existing map[string]map[string]string
+	// putDelay throttles every upload request
+	putDelay time.Duration
+	// denyPuts refuses every upload request with AccessDenied
+	denyPuts bool
+}
+
+func newFakeObjectStore(t *testing.T) (*fakeObjectStore, *minio.Client) {
+	t.Helper()
+	store := &fakeObjectStore{existing: map[string]map[string]string{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		switch {
+		case r.URL.Query().Has("location"):
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`)
+		case r.Method == http.MethodGet && r.URL.Query().Has("uploads"):
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><ListMultipartUploadsResult><Bucket>bucket</Bucket>`)
+			for _, path := range store.incomplete {
+				_, key, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+				fmt.Fprintf(w, `<Upload><Key>%s</Key><UploadId>upload-1</UploadId></Upload>`, key)
+			}
+			fmt.Fprint(w, `</ListMultipartUploadsResult>`)
+		case r.Method == http.MethodPost && r.URL.Query().Has("uploads"):
+			// Content of unknown length is uploaded in parts
+			store.incomplete = append(store.incomplete, r.URL.Path)
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>object</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPost && r.URL.Query().Has("uploadId"):
+			store.incomplete = slices.DeleteFunc(store.incomplete, func(path string) bool { return path == r.URL.Path })
+			store.uploads = append(store.uploads, r.URL.Path)
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>object</Key><ETag>"d41d8cd98f00b204e9800998ecf8427e-1"</ETag></CompleteMultipartUploadResult>`)
+		case r.Method == http.MethodPut && store.denyPuts:
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>AccessDenied</Code><Message>Access Denied.</Message></Error>`)
+		case r.Method == http.MethodPut:
+			time.Sleep(store.putDelay)
+			if _, err := io.Copy(io.Discard, r.Body); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if !r.URL.Query().Has("uploadId") {
+				store.uploads = append(store.uploads, r.URL.Path)
+				store.headers = append(store.headers, r.Header.Clone())
+			}
+			w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodDelete && r.URL.Query().Has("uploadId"):
+			store.incomplete = slices.DeleteFunc(store.incomplete, func(path string) bool { return path == r.URL.Path })
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodDelete:
+			store.deletes = append(store.deletes, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodHead:
+			metadata, ok := store.existing[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			for key, value := range metadata {
+				w.Header().Set("X-Amz-Meta-"+key, value)
+			}
+			w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			w.Header().Set("Content-Length", "8")
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := minio.New(strings.TrimPrefix(server.URL, "http://"), &minio.Options{
+		Creds:      credentials.NewStaticV4("test-access-key", "test-secret-key", ""),
+		MaxRetries: 1,
+	})
+	if err != nil {
+		t.Fatalf("failed to create MinIO client: %v", err)
+	}
+	return store, client
+}
+
+func withUploadBuffers(t *testing.T, buffers *BufferBudget) {
+	t.Helper()
+	original := uploadBuffers
+	t.Cleanup(func() { uploadBuffers = original })
+	uploadBuffers = buffers
+}
+
+// truncatedSource is a download server that advertises a larger Content-Length than it sends
+func truncatedSource(t *testing.T, advertised, sent int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Length", fmt.Sprint(advertised))
+		w.Write([]byte(strings.Repeat("x", sent)))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTransferURLToObjectRejectsTruncatedDownload(t *testing.T) {
+	withoutRetryDelay(t)
+	source := truncatedSource(t, 1000, 100)
+
+	for _, tc := range []struct {
+		name    string
+		buffers *BufferBudget
+		// uploadFails is whether the upload itself fails on the short body, which is then reported
+		// instead of the truncation
+		uploadFails bool
+	}{
+		{"held in memory", NewBufferBudget(1<<20, ""), false},
+		{"spooled", NewBufferBudget(0, t.TempDir()), false},
+		{"streamed", NewBufferBudget(0, ""), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			withUploadBuffers(t, tc.buffers)
+			store, client := newFakeObjectStore(t)
+
+			_, err := transferURLToObject(context.Background(), http.DefaultClient, client, source.URL, "bucket", "paper.pdf", nil, CollisionOverwrite)
+			if err == nil {
+				t.Fatal("transferURLToObject() of a truncated download should fail")
+			}
+			if tc.uploadFails {
+				if !strings.Contains(err.Error(), "failed to upload file to S3") {
+					t.Errorf("error = %v, want the upload failure", err)
+				}
+			} else if !errors.Is(err, io.ErrUnexpectedEOF) || !strings.Contains(err.Error(), "100") {
+				t.Errorf("error = %v, want an unexpected EOF after the 100 bytes received", err)
+			}
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			if len(store.uploads) != len(store.deletes) {
+				t.Errorf("uploaded %v but deleted %v, want every truncated object removed", store.uploads, store.deletes)
+			}
+		})
+	}
+}
+
+func TestTransferURLToObjectReportsFailedUpload(t *testing.T) {
+	withoutRetryDelay(t)
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer source.Close()
+
+	for _, tc := range []struct {
+		name    string
+		buffers *BufferBudget
+	}{
+		{"held in memory", NewBufferBudget(1<<20, "")},
+		{"spooled", NewBufferBudget(0, t.TempDir())},
+		{"streamed", NewBufferBudget(0, "")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			withUploadBuffers(t, tc.buffers)
+			store, client := newFakeObjectStore(t)
+			store.denyPuts = true
+
+			// The upload fails without reporting a size, which must not be taken for a truncated download
+			_, err := transferURLToObject(context.Background(), http.DefaultClient, client, source.URL, "bucket", "paper.pdf", nil, CollisionOverwrite)
+			if err == nil || !strings.Contains(err.Error(), "failed to upload file to S3") || !strings.Contains(err.Error(), "Access Denied") {
+				t.Fatalf("transferURLToObject() error = %v, want the upload failure", err)
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("error = %v, reported as a truncated download", err)
+			}
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			if len(store.deletes) != 0 {
+				t.Errorf("deleted %v after a failed upload, want nothing removed", store.deletes)
+			}
+		})
+	}
+}
+
+func TestTransferURLToObjectCallsBeforeRequest(t *testing.T) {
+	withUploadBuffers(t, NewBufferBudget(1<<20, ""))
+	_, client := newFakeObjectStore(t)
+	var requests int
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-1.4"))
+	}))
+	defer source.Close()
+
+	var calls int
+	ctx := WithBeforeRequest(context.Background(), func(ctx context.Context) error {
+		calls++
+		return nil
+	})
+	if _, err := transferURLToObject(ctx, http.DefaultClient, client, source.URL, "bucket", "paper.pdf", nil, CollisionOverwrite); err != nil {
+		t.Fatalf("transferURLToObject() unexpected error: %v", err)
+	}
+	if calls != 1 || requests != 1 {
+		t.Errorf("before request called %d times for %d requests, want once for the one request", calls, requests)
+	}
+
+	// A refusal fails the download without a request
+	refused := errors.New("rate limited")
+	ctx = WithBeforeRequest(context.Background(), func(ctx context.Context) error { return refused })
+	if _, err := transferURLToObject(ctx, http.DefaultClient, client, source.URL, "bucket", "paper.pdf", nil, CollisionOverwrite); !errors.Is(err, refused) {
+		t.Errorf("transferURLToObject() error = %v, want the refusal", err)
+	}
+	if requests != 1 {
+		t.Errorf("source received %d requests, want none after the refusal", requests-1)
+	}
+}
+
+func TestTransferURLToObjectRemovesObjectCutShort(t *testing.T) {
+	withUploadBuffers(t, NewBufferBudget(0, ""))
+	store, client := newFakeObjectStore(t)
+
+	// A response of unknown length whose connection is cut mid-body is read by the S3 client as
+	// content that ended early, which it uploads
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte(strings.Repeat("x", 100)))
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("failed to hijack connection: %v", err)
+			return
+		}
+		conn.Close()
+	}))
+	defer source.Close()
+
+	_, err := transferURLToObject(context.Background(), http.DefaultClient, client, source.URL, "bucket", "paper.pdf", nil, CollisionOverwrite)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("transferURLToObject() error = %v, want an unexpected EOF", err)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.uploads) != 1 || len(store.deletes) != 1 || store.deletes[0] != "/bucket/paper.pdf" {
+		t.Errorf("uploaded %v and deleted %v, want the truncated object uploaded and removed", store.uploads, store.deletes)
+	}
+}
+
+func TestTransferURLToObjectCancelledMidDownload(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// contentLength is the advertised length of the download, none when empty
+		contentLength string
+		buffers       *BufferBudget
+		// multipart is whether the download is uploaded in parts while it is received
+		multipart bool
+	}{
+		{"held in memory", "1000", NewBufferBudget(1<<20, ""), false},
+		{"streamed", "", NewBufferBudget(0, ""), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			withUploadBuffers(t, tc.buffers)
+			store, client := newFakeObjectStore(t)
+
+			// A slow server that sends the start of the download, enough to sniff its type, and then stalls
+			sent := make(chan struct{})
+			source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/pdf")
+				if tc.contentLength != "" {
+					w.Header().Set("Content-Length", tc.contentLength)
+				}
+				w.Write([]byte(strings.Repeat("x", 600)))
+				w.(http.Flusher).Flush()
+				close(sent)
+				<-r.Context().Done()
+			}))
+			defer source.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				<-sent
+				// A multipart upload is cancelled once it has started
+				for tc.multipart {
+					store.mu.Lock()
+					started := len(store.incomplete) > 0
+					store.mu.Unlock()
+					if started {
+						break
+					}
+					time.Sleep(time.Millisecond)
+				}
+				cancel()
+			}()
+
+			start := time.Now()
+			_, err := transferURLToObject(ctx, http.DefaultClient, client, source.URL, "bucket", "paper.pdf", nil, CollisionOverwrite)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("transferURLToObject() error = %v, want the cancellation", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("transferURLToObject() returned %v after the download started, want promptly after the cancellation", elapsed)
+			}
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			if len(store.incomplete) != 0 || len(store.uploads) != len(store.deletes) {
+				t.Errorf("incomplete uploads %v, uploaded %v and deleted %v, want nothing left in the bucket", store.incomplete, store.uploads, store.deletes)
+			}
+		})
+	}
+}
+
+func TestTransferURLToObjectRefusesOversizedDownloads(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// contentLength is the advertised length of the download, none when empty
+		contentLength string
+		spool         bool
+	}{
+		{"declared too large", "2000", false},
+		{"undeclared and spooled", "", true},
+		{"undeclared and streamed", "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			buffers := NewBufferBudget(1<<20, "")
+			if tc.spool {
+				buffers = NewBufferBudget(0, t.TempDir())
+			} else if tc.contentLength == "" {
+				buffers = NewBufferBudget(0, "")
+			}
+			buffers.maxDownload = 1000
+			withUploadBuffers(t, buffers)
+			store, client := newFakeObjectStore(t)
+			source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/pdf")
+				if tc.contentLength != "" {
+					w.Header().Set("Content-Length", tc.contentLength)
+				}
+				w.Write([]byte("%PDF-1.7 " + strings.Repeat("x", 1991)))
+			}))
+			defer source.Close()
+
+			_, err := transferURLToObject(context.Background(), http.DefaultClient, client, source.URL, "bucket", "paper.pdf", nil, CollisionOverwrite)
+			var tooLarge *DownloadTooLargeError
+			if !errors.As(err, &tooLarge) {
+				t.Fatalf("transferURLToObject() error = %v, want a DownloadTooLargeError", err)
+			}
+			if tooLarge.Limit != 1000 {
+				t.Errorf("Limit = %d, want 1000", tooLarge.Limit)
+			}
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			if len(store.incomplete) != 0 || len(store.uploads) != len(store.deletes) {
+				t.Errorf("incomplete uploads %v, uploaded %v and deleted %v, want nothing left in the bucket", store.incomplete, store.uploads, store.deletes)
+			}
+		})
+	}
+}
+
+func TestTransferURLToObjectSniffsContentType(t *testing.T) {
+	withUploadBuffers(t, NewBufferBudget(1<<20, ""))
+	store, client := newFakeObjectStore(t)
+	// An HTML error page served as if it were the PDF that was asked for
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("<!DOCTYPE html><html><body>Access denied</body></html>"))
+	}))
+	defer source.Close()
+
+	if _, err := transferURLToObject(context.Background(), http.DefaultClient, client, source.URL, "bucket", "paper.pdf", nil, CollisionOverwrite); err != nil {
+		t.Fatalf("transferURLToObject() unexpected error: %v", err)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.headers) != 1 {
+		t.Fatalf("recorded %d uploads, want 1", len(store.headers))
+	}
+	if got := store.headers[0].Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("uploaded Content-Type = %q, want the sniffed text/html", got)
+	}
+}
+
+func TestTransferURLToObjectRecordsDispositionFilename(t *testing.T) {
+	withUploadBuffers(t, NewBufferBudget(1<<20, ""))
+	store, client := newFakeObjectStore(t)
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `inline; filename="../../2405.12345v3.pdf"`)
+		w.Write([]byte("%PDF-1.7"))
+	}))
+	defer source.Close()
+
+	result, err := transferURLToObject(context.Background(), http.DefaultClient, client, source.URL, "bucket", "paper.pdf", map[string]string{"source-url": source.URL}, CollisionOverwrite)
+	if err != nil {
+		t.Fatalf("transferURLToObject() unexpected error: %v", err)
+	}
+	if result.OriginalFilename != "2405.12345v3.pdf" {
+		t.Errorf("OriginalFilename = %q, want the sanitized disposition filename", result.OriginalFilename)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.headers) != 1 {
+		t.Fatalf("recorded %d uploads, want 1", len(store.headers))
+	}
+	if got := store.headers[0].Get("X-Amz-Meta-Original-Filename"); got != "2405.12345v3.pdf" {
+		t.Errorf("original-filename metadata = %q, want 2405.12345v3.pdf", got)
+	}
+	if got := store.headers[0].Get("X-Amz-Meta-Source-Url"); got != source.URL {
+		t.Errorf("source-url metadata = %q, want the metadata passed in to be kept", got)
+	}
+}
+
+func TestVerifyUploadedSize(t *testing.T) {
+	if err := verifyUploadedSize(-1, 42); err != nil {
+		t.Errorf("verifyUploadedSize() without Content-Length error = %v", err)
+	}
+	if err := verifyUploadedSize(42, 42); err != nil {
+		t.Errorf("verifyUploadedSize() of the whole content error = %v", err)
+	}
+	err := verifyUploadedSize(1000, 100)
+	if err == nil || !strings.Contains(err.Error(), "expected 1000 bytes, received 100") {
+		t.Errorf("verifyUploadedSize() of truncated content error = %v, want expected and received bytes", err)
+	}
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"strconv"
+	"time"
+
+	"opus-mcp/internal/metrics"
+)
+
+// Download phases, as labelled in the download phase metrics
+const (
+	PhaseOriginTTFB     = "origin_ttfb"
+	PhaseOriginTransfer = "origin_transfer"
+	PhaseS3Upload       = "s3_upload"
+)
+
+// TransferTimings tells where the time of a download went: waiting for the origin, reading from
+// it, or writing to S3
+type TransferTimings struct {
+	// OriginTTFB is the time from sending the request to the origin until its response headers arrived
+	OriginTTFB time.Duration
+	// OriginTransfer is the time from the response headers until the last byte of the body was read
+	OriginTransfer time.Duration
+	OriginBytes    int64
+	// Upload is the time spent writing the object to S3, including retries
+	Upload      time.Duration
+	UploadBytes int64
+	// Streamed reports that the body was uploaded while it was read, so that the origin transfer and
+	// the upload overlap and the slower of the two bounds both
+	Streamed bool
+}
+
+// OriginThroughput is the origin transfer rate in bytes per second, or 0 if unknown
+func (t TransferTimings) OriginThroughput() float64 {
+	return throughput(t.OriginBytes, t.OriginTransfer)
+}
+
+// UploadThroughput is the S3 upload rate in bytes per second, or 0 if unknown
+func (t TransferTimings) UploadThroughput() float64 {
+	return throughput(t.UploadBytes, t.Upload)
+}
+
+func throughput(bytes int64, d time.Duration) float64 {
+	if bytes <= 0 || d <= 0 {
+		return 0
+	}
+	return float64(bytes) / d.Seconds()
+}
+
+// originMetadata is the user metadata recording the origin side of a download, which is known
+// before the upload unless the body is streamed
+func (t TransferTimings) originMetadata() map[string]string {
+	return map[string]string{
+		"origin-ttfb-ms":          strconv.FormatInt(t.OriginTTFB.Milliseconds(), 10),
+		"origin-transfer-ms":      strconv.FormatInt(t.OriginTransfer.Milliseconds(), 10),
+		"origin-bytes-per-second": strconv.FormatInt(int64(t.OriginThroughput()), 10),
+	}
+}
+
+// observe records the phases of a finished download in the download phase metrics and the
+// transfer estimates
+func (t TransferTimings) observe() {
+	Transfers.Observe(t)
+	metrics.DownloadPhaseDuration.WithLabelValues(PhaseOriginTTFB).Observe(t.OriginTTFB.Seconds())
+	metrics.DownloadPhaseDuration.WithLabelValues(PhaseOriginTransfer).Observe(t.OriginTransfer.Seconds())
+	metrics.DownloadPhaseDuration.WithLabelValues(PhaseS3Upload).Observe(t.Upload.Seconds())
+	if rate := t.OriginThroughput(); rate > 0 {
+		metrics.DownloadPhaseThroughput.WithLabelValues(PhaseOriginTransfer).Observe(rate)
+	}
+	if rate := t.UploadThroughput(); rate > 0 {
+		metrics.DownloadPhaseThroughput.WithLabelValues(PhaseS3Upload).Observe(rate)
+	}
+}
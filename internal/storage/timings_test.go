@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// throttledSource is a download server that waits before its response headers and again halfway
+// through its body
+func throttledSource(t *testing.T, ttfb, stall time.Duration, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(ttfb)
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Length", "256")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(body[:len(body)/2]))
+		w.(http.Flusher).Flush()
+		time.Sleep(stall)
+		w.Write([]byte(body[len(body)/2:]))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTransferURLToObjectAttributesPhases(t *testing.T) {
+	withoutRetryDelay(t)
+	const ttfb, stall, putDelay = 100 * time.Millisecond, 150 * time.Millisecond, 200 * time.Millisecond
+	// Durations are only checked to within this tolerance, to allow for slow test machines
+	const slack = 90 * time.Millisecond
+	body := strings.Repeat("x", 256)
+	source := throttledSource(t, ttfb, stall, body)
+
+	for _, tc := range []struct {
+		name     string
+		buffers  *BufferBudget
+		streamed bool
+	}{
+		{"held in memory", NewBufferBudget(1<<20, ""), false},
+		{"streamed", NewBufferBudget(0, ""), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			withUploadBuffers(t, tc.buffers)
+			store, client := newFakeObjectStore(t)
+			store.putDelay = putDelay
+
+			result, err := transferURLToObject(context.Background(), http.DefaultClient, client, source.URL, "bucket", "paper.pdf", map[string]string{}, CollisionOverwrite)
+			if err != nil {
+				t.Fatalf("transferURLToObject() unexpected error: %v", err)
+			}
+			timings := result.Timings
+			if timings.Streamed != tc.streamed {
+				t.Errorf("Streamed = %v, want %v", timings.Streamed, tc.streamed)
+			}
+			if timings.OriginTTFB < ttfb || timings.OriginTTFB > ttfb+slack {
+				t.Errorf("OriginTTFB = %v, want about %v", timings.OriginTTFB, ttfb)
+			}
+			// The first bytes of the body can reach the client with the headers, so the transfer may
+			// appear a little shorter than the stall
+			if timings.OriginTransfer < stall*9/10 || timings.OriginTransfer > stall+slack {
+				t.Errorf("OriginTransfer = %v, want about %v", timings.OriginTransfer, stall)
+			}
+			if timings.OriginBytes != int64(len(body)) || timings.OriginThroughput() <= 0 {
+				t.Errorf("origin bytes = %d at %.0f B/s, want %d", timings.OriginBytes, timings.OriginThroughput(), len(body))
+			}
+			if timings.Upload < putDelay {
+				t.Errorf("Upload = %v, want at least %v", timings.Upload, putDelay)
+			}
+			if timings.UploadBytes != int64(len(body)) || timings.UploadThroughput() <= 0 {
+				t.Errorf("upload bytes = %d at %.0f B/s, want %d", timings.UploadBytes, timings.UploadThroughput(), len(body))
+			}
+
+			// Only content read in full before the upload can record its origin side on the object
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			recorded := store.headers[0].Get("X-Amz-Meta-Origin-Ttfb-Ms")
+			if tc.streamed && recorded != "" {
+				t.Errorf("streamed upload recorded origin TTFB %q, want none", recorded)
+			}
+			if !tc.streamed && recorded == "" {
+				t.Error("held upload did not record its origin TTFB in the object metadata")
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package taxonomy
+
+import (
+	_ "embed"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// relatedJSON is a curated table of categories in different groups or fields that are well known
+// to cover adjacent research, which the taxonomy itself does not record
+//
+//go:embed related.json
+var relatedJSON []byte
+
+// adjacency is a pair of adjacent categories and why they are adjacent
+type adjacency struct {
+	Categories [2]string `json:"categories"`
+	Reason     string    `json:"reason"`
+}
+
+var (
+	adjacencies     []adjacency
+	adjacenciesOnce sync.Once
+)
+
+// curatedAdjacencies returns the embedded adjacency table, parsed once
+func curatedAdjacencies() []adjacency {
+	adjacenciesOnce.Do(func() {
+		var table struct {
+			Adjacent []adjacency `json:"adjacent"`
+		}
+		if err := json.Unmarshal(relatedJSON, &table); err != nil {
+			// The table is compiled into the binary, so this can only be a programming error.
+			panic("taxonomy: invalid embedded adjacency table: " + err.Error())
+		}
+		adjacencies = table.Adjacent
+	})
+	return adjacencies
+}
+
+// Adjacent is a category adjacent to another and why
+type Adjacent struct {
+	Category
+	Reason string
+}
+
+// Adjacent returns the categories the curated adjacency table lists next to the category with the
+// given code, in the order of the table. Categories missing from the snapshot are left out.
+func (s *Snapshot) Adjacent(code string) []Adjacent {
+	c, ok := s.Category(code)
+	if !ok {
+		return nil
+	}
+	var related []Adjacent
+	for _, a := range curatedAdjacencies() {
+		other := ""
+		switch c.Code {
+		case a.Categories[0]:
+			other = a.Categories[1]
+		case a.Categories[1]:
+			other = a.Categories[0]
+		default:
+			continue
+		}
+		if o, ok := s.Category(other); ok {
+			related = append(related, Adjacent{Category: o, Reason: a.Reason})
+		}
+	}
+	return related
+}
+
+// Siblings returns the other categories of the group of the category with the given code, sorted
+// by code. A category that is an archive of its own, e.g., hep-th, has no other categories in its
+// group, so its siblings are the other single-category archives of its area, e.g., hep-ph and gr-qc.
+func (s *Snapshot) Siblings(code string) []Category {
+	c, ok := s.Category(code)
+	if !ok {
+		return nil
+	}
+	area := ""
+	if c.Code == c.Group {
+		if g, ok := s.Group(c.Group); ok {
+			area = g.Area
+		}
+	}
+	var siblings []Category
+	for _, other := range s.Categories {
+		if other.Code == c.Code {
+			continue
+		}
+		if other.Group == c.Group {
+			siblings = append(siblings, other)
+			continue
+		}
+		if area != "" && other.Code == other.Group {
+			if g, ok := s.Group(other.Group); ok && g.Area == area {
+				siblings = append(siblings, other)
+			}
+		}
+	}
+	slices.SortFunc(siblings, func(a, b Category) int { return strings.Compare(a.Code, b.Code) })
+	return siblings
+}
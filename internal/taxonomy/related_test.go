@@ -0,0 +1,77 @@
+package taxonomy
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAdjacent(t *testing.T) {
+	codes := func(adjacent []Adjacent) []string {
+		var codes []string
+		for _, a := range adjacent {
+			if a.Reason == "" {
+				t.Errorf("adjacent category %s has no reason", a.Code)
+			}
+			codes = append(codes, a.Code)
+		}
+		return codes
+	}
+	tests := []struct {
+		code string
+		want []string
+	}{
+		{"cs.CL", []string{"cs.AI", "cs.LG"}},
+		{"CS.lg", []string{"cs.AI", "cs.CL", "stat.ML"}},
+		{"eess.AS", []string{"cs.SD"}},
+		{"hep-th", nil},
+		{"cs.ZZ", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if got := codes(Embedded().Adjacent(tt.code)); !slices.Equal(got, tt.want) {
+				t.Errorf("Adjacent(%q) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+
+	// Every category of the curated table is in the snapshot, so that none is silently left out
+	for _, a := range curatedAdjacencies() {
+		for _, code := range a.Categories {
+			if _, ok := Embedded().Category(code); !ok {
+				t.Errorf("adjacency table names %s, which is not in the snapshot", code)
+			}
+		}
+	}
+}
+
+func TestSiblings(t *testing.T) {
+	s := Embedded()
+
+	// A category of a large archive has every other category of it as a sibling
+	siblings := s.Siblings("cs.CL")
+	if len(siblings) != 39 {
+		t.Errorf("cs.CL has %d siblings, want the 39 other cs categories", len(siblings))
+	}
+	for i, sibling := range siblings {
+		if sibling.Group != "cs" || sibling.Code == "cs.CL" {
+			t.Errorf("sibling %s of cs.CL is in group %s", sibling.Code, sibling.Group)
+		}
+		if i > 0 && siblings[i-1].Code >= sibling.Code {
+			t.Errorf("siblings are not sorted by code: %s before %s", siblings[i-1].Code, sibling.Code)
+		}
+	}
+
+	// An archive without a dot in its code has the other such archives of its area as siblings
+	var codes []string
+	for _, sibling := range s.Siblings("hep-th") {
+		codes = append(codes, sibling.Code)
+	}
+	want := []string{"gr-qc", "hep-ex", "hep-lat", "hep-ph", "math-ph", "nucl-ex", "nucl-th", "quant-ph"}
+	if !slices.Equal(codes, want) {
+		t.Errorf("Siblings(hep-th) = %v, want %v", codes, want)
+	}
+
+	if got := s.Siblings("cs.ZZ"); got != nil {
+		t.Errorf("Siblings(cs.ZZ) = %v, want none for an unknown category", got)
+	}
+}
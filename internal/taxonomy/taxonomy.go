@@ -0,0 +1,178 @@
+package taxonomy
+
+import (
+	_ "embed"
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// snapshotJSON is a point-in-time copy of the arXiv category taxonomy.
+// See: https://arxiv.org/category_taxonomy
+//
+//go:embed snapshot.json
+var snapshotJSON []byte
+
+// Area is a broad subject area (e.g., "Computer Science", "Physics")
+type Area struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// Group is an arXiv archive (e.g., "cs", "astro-ph", "hep-ph") within an area
+type Group struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Area        string `json:"area"`
+	Description string `json:"description"`
+}
+
+// Category is a single arXiv category (e.g., "cs.AI") and the group it belongs to
+type Category struct {
+	Code  string `json:"code"`
+	Name  string `json:"name"`
+	Group string `json:"group"`
+}
+
+// Sources of taxonomy data, from the most to the least current
+const (
+	// SourceLive is taxonomy data fetched from arXiv for the current request
+	SourceLive = "live"
+	// SourceCached is taxonomy data fetched from arXiv earlier and kept since
+	SourceCached = "cached"
+	// SourceEmbedded is the snapshot compiled into the binary
+	SourceEmbedded = "embedded"
+)
+
+// Provenance says where taxonomy data came from, so that results depending on it can tell how
+// current they are
+type Provenance struct {
+	Source       string `json:"source" jsonschema:"Where the taxonomy data came from: live, cached or embedded"`
+	SnapshotDate string `json:"snapshotDate" jsonschema:"The date (YYYY-MM-DD) the taxonomy data was taken from arXiv"`
+}
+
+// Live reports whether the taxonomy data was fetched from arXiv for the current request
+func (p Provenance) Live() bool {
+	return p.Source == SourceLive
+}
+
+// String describes the taxonomy data, e.g., "an embedded snapshot from 2025-06-01"
+func (p Provenance) String() string {
+	switch p.Source {
+	case SourceLive:
+		return "live data from " + p.SnapshotDate
+	case SourceCached:
+		return "a cached copy from " + p.SnapshotDate
+	}
+	return "an embedded snapshot from " + p.SnapshotDate
+}
+
+// Snapshot is a copy of the taxonomy, by default the embedded one
+type Snapshot struct {
+	SnapshotDate string     `json:"snapshotDate"`
+	Source       string     `json:"source"`
+	Areas        []Area     `json:"areas"`
+	Groups       []Group    `json:"groups"`
+	Categories   []Category `json:"categories"`
+
+	areasByName     map[string]Area
+	groupsByCode    map[string]Group
+	categoryByCode  map[string]Category
+	categoryByLower map[string]Category
+	provenance      Provenance
+}
+
+var (
+	snapshot     *Snapshot
+	snapshotOnce sync.Once
+)
+
+// Embedded returns the embedded taxonomy snapshot. The snapshot is parsed once and shared;
+// callers must not modify it.
+func Embedded() *Snapshot {
+	snapshotOnce.Do(func() {
+		var s Snapshot
+		if err := json.Unmarshal(snapshotJSON, &s); err != nil {
+			// The snapshot is compiled into the binary, so this can only be a programming error.
+			panic("taxonomy: invalid embedded snapshot: " + err.Error())
+		}
+		s.index()
+		s.provenance = Provenance{Source: SourceEmbedded, SnapshotDate: s.SnapshotDate}
+		snapshot = &s
+	})
+	return snapshot
+}
+
+// SnapshotJSON returns the embedded snapshot exactly as compiled into the binary, e.g., to serve it
+// to clients as it is. Callers must not modify it.
+func SnapshotJSON() []byte {
+	return snapshotJSON
+}
+
+func (s *Snapshot) index() {
+	s.areasByName = make(map[string]Area, len(s.Areas))
+	for _, a := range s.Areas {
+		s.areasByName[strings.ToLower(a.Name)] = a
+	}
+	s.groupsByCode = make(map[string]Group, len(s.Groups))
+	for _, g := range s.Groups {
+		s.groupsByCode[g.Code] = g
+	}
+	s.categoryByCode = make(map[string]Category, len(s.Categories))
+	s.categoryByLower = make(map[string]Category, len(s.Categories))
+	for _, c := range s.Categories {
+		s.categoryByCode[c.Code] = c
+		s.categoryByLower[strings.ToLower(c.Code)] = c
+	}
+}
+
+// Provenance returns where the snapshot's data came from
+func (s *Snapshot) Provenance() Provenance {
+	return s.provenance
+}
+
+// WithProvenance returns a copy of the snapshot attributed to the given source, for taxonomy data
+// that was fetched from arXiv rather than embedded. The copy shares the snapshot's data.
+func (s *Snapshot) WithProvenance(provenance Provenance) *Snapshot {
+	c := *s
+	c.provenance = provenance
+	return &c
+}
+
+// AreaCode returns the code of the area with the given (case-insensitive) name,
+// e.g., "Computer Science" → "cs", "Physics" → "physics".
+func (s *Snapshot) AreaCode(areaName string) (string, bool) {
+	a, ok := s.areasByName[strings.ToLower(strings.TrimSpace(areaName))]
+	return a.Code, ok
+}
+
+// Group returns the group with the given code.
+func (s *Snapshot) Group(code string) (Group, bool) {
+	g, ok := s.groupsByCode[code]
+	return g, ok
+}
+
+// Category returns the category with the given code. The lookup falls back to a
+// case-insensitive match so that "CS.ai" resolves to "cs.AI".
+func (s *Snapshot) Category(code string) (Category, bool) {
+	if c, ok := s.categoryByCode[code]; ok {
+		return c, true
+	}
+	c, ok := s.categoryByLower[strings.ToLower(code)]
+	return c, ok
+}
+
+// GroupForCategory returns the group code for a category code,
+// e.g., "cs.AI" → "cs", "astro-ph.CO" → "astro-ph", "hep-ph" → "hep-ph".
+// Known categories are resolved from the snapshot; unknown ones fall back to the
+// part of the code before the first dot.
+func GroupForCategory(categoryCode string) string {
+	if c, ok := Embedded().Category(categoryCode); ok {
+		return c.Group
+	}
+	if idx := strings.Index(categoryCode, "."); idx > 0 {
+		return categoryCode[:idx]
+	}
+	// No dot found, the entire code is the group
+	return categoryCode
+}
@@ -0,0 +1,111 @@
+package taxonomy
+
+import (
+	"testing"
+)
+
+func TestEmbeddedSnapshot(t *testing.T) {
+	s := Embedded()
+	if s.SnapshotDate == "" {
+		t.Error("snapshot date should not be empty")
+	}
+	if len(s.Areas) == 0 || len(s.Groups) == 0 || len(s.Categories) == 0 {
+		t.Fatalf("snapshot is incomplete: %d areas, %d groups, %d categories", len(s.Areas), len(s.Groups), len(s.Categories))
+	}
+
+	areaNames := make(map[string]bool)
+	for _, a := range s.Areas {
+		areaNames[a.Name] = true
+	}
+	for _, g := range s.Groups {
+		if !areaNames[g.Area] {
+			t.Errorf("group %s references unknown area %q", g.Code, g.Area)
+		}
+		if g.Description == "" {
+			t.Errorf("group %s has empty description", g.Code)
+		}
+	}
+	for _, c := range s.Categories {
+		if _, ok := s.Group(c.Group); !ok {
+			t.Errorf("category %s references unknown group %q", c.Code, c.Group)
+		}
+	}
+}
+
+func TestAreaCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   string
+		wantOk bool
+	}{
+		{"Computer Science", "cs", true},
+		{"Electrical Engineering and Systems Science", "eess", true},
+		{"  physics  ", "physics", true},
+		{"Quantitative Biology", "q-bio", true},
+		{"Alchemy", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Embedded().AreaCode(tt.name)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("AreaCode(%q) = (%q, %v), want (%q, %v)", tt.name, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestGroupForCategory(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"cs.AI", "cs"},
+		{"astro-ph.CO", "astro-ph"},
+		{"cond-mat.stat-mech", "cond-mat"},
+		{"hep-ph", "hep-ph"},
+		{"math-ph", "math-ph"},
+		{"physics.optics", "physics"},
+		{"CS.ai", "cs"},
+		// Unknown codes fall back to the prefix before the first dot
+		{"newarchive.XY", "newarchive"},
+		{"newarchive", "newarchive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if got := GroupForCategory(tt.code); got != tt.want {
+				t.Errorf("GroupForCategory(%q) = %q, want %q", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	s := Embedded()
+	if got := s.Provenance(); got.Source != SourceEmbedded || got.SnapshotDate != s.SnapshotDate || got.Live() {
+		t.Errorf("Provenance() of the embedded snapshot = %+v, want embedded from %s", got, s.SnapshotDate)
+	}
+
+	live := s.WithProvenance(Provenance{Source: SourceLive, SnapshotDate: "2026-02-03"})
+	if !live.Provenance().Live() || s.Provenance().Live() {
+		t.Errorf("WithProvenance() = %+v, original %+v, want only the copy to be live", live.Provenance(), s.Provenance())
+	}
+	if _, ok := live.Category("cs.AI"); !ok {
+		t.Error("WithProvenance() copy does not share the snapshot's categories")
+	}
+
+	tests := []struct {
+		provenance Provenance
+		want       string
+	}{
+		{Provenance{Source: SourceLive, SnapshotDate: "2026-02-03"}, "live data from 2026-02-03"},
+		{Provenance{Source: SourceCached, SnapshotDate: "2026-01-20"}, "a cached copy from 2026-01-20"},
+		{Provenance{Source: SourceEmbedded, SnapshotDate: "2025-06-01"}, "an embedded snapshot from 2025-06-01"},
+	}
+	for _, tt := range tests {
+		if got := tt.provenance.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.provenance, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+// Package textutil turns the titles and abstracts of arXiv articles into plain text. The arXiv
+// API wraps them with hard newlines and indentation, and authors write them with LaTeX: inline
+// math between dollar signs, escaped special characters, accents such as Schr\"odinger and text
+// formatting such as \emph{not}.
+//
+// Only markup with a plain text equivalent is resolved. Commands without one, e.g., \frac, are
+// kept as written, so that nothing the authors wrote is lost.
+package textutil
+
+import (
+	"html"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize returns a title or abstract as plain text:
+//   - HTML entities such as &amp; unescaped
+//   - LaTeX escapes such as \% and \& replaced by the character, and ~ and \\ by spaces
+//   - accents such as \'e and \"{o} applied to their letter
+//   - text formatting such as \emph{x} and {\it x} reduced to its text, and grouping braces dropped
+//   - TeX quotes, opened by two backquotes and closed by two apostrophes, made typographic
+//   - the dollar signs around inline and display math stripped, with common symbols such as
+//     \alpha and \leq written as Unicode; subscripts, superscripts and braces within are kept
+//   - runs of whitespace, including the newlines of the feed, collapsed into single spaces
+//
+// The result is in Unicode normalization form C.
+func Normalize(s string) string {
+	return CollapseSpace(norm.NFC.String(convert(html.UnescapeString(s), false)))
+}
+
+// CollapseSpace trims a string and collapses its runs of whitespace into single spaces
+func CollapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// convert resolves the LaTeX markup of text, or of math when math is set
+func convert(s string, math bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\':
+			i += command(&b, s[i:], math)
+		case c == '$' && !math:
+			delimiter := "$"
+			if strings.HasPrefix(s[i:], "$$") {
+				delimiter = "$$"
+			}
+			start := i + len(delimiter)
+			end := closingDelimiter(s[start:], delimiter)
+			if end < 0 {
+				// An unmatched dollar sign is a dollar sign
+				b.WriteString(delimiter)
+				i = start
+				continue
+			}
+			b.WriteString(convert(s[start:start+end], true))
+			i = start + end + len(delimiter)
+		case math:
+			b.WriteByte(c)
+			i++
+		case c == '{' || c == '}':
+			i++
+		case c == '~':
+			b.WriteByte(' ')
+			i++
+		case strings.HasPrefix(s[i:], "``"):
+			b.WriteString("“")
+			i += 2
+		case strings.HasPrefix(s[i:], "''"):
+			b.WriteString("”")
+			i += 2
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// closingDelimiter returns the index of the first unescaped delimiter in s, or -1 if there is none
+func closingDelimiter(s, delimiter string) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case strings.HasPrefix(s[i:], delimiter):
+			return i
+		}
+	}
+	return -1
+}
+
+// escapedCharacters are the special characters LaTeX escapes with a backslash
+const escapedCharacters = `%&_#${}`
+
+// accentMarks are the combining marks of LaTeX accents, by the accent command
+var accentMarks = map[string]string{
+	"'": "\u0301", "`": "\u0300", "^": "\u0302", `"`: "\u0308", "~": "\u0303", "=": "\u0304",
+	".": "\u0307", "c": "\u0327", "v": "\u030C", "u": "\u0306", "H": "\u030B", "r": "\u030A",
+	"k": "\u0328",
+}
+
+// symbols are the plain text or Unicode equivalents of LaTeX commands
+var symbols = map[string]string{
+	// Greek letters
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε",
+	"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+	"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "varpi": "ϖ", "rho": "ρ",
+	"varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+	"Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+	// Relations, operators and arrows
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠", "approx": "≈",
+	"sim": "∼", "simeq": "≃", "equiv": "≡", "propto": "∝", "ll": "≪", "gg": "≫",
+	"in": "∈", "notin": "∉", "subset": "⊂", "subseteq": "⊆", "cup": "∪", "cap": "∩",
+	"times": "×", "cdot": "·", "pm": "±", "mp": "∓", "div": "÷", "circ": "∘",
+	"infty": "∞", "partial": "∂", "nabla": "∇", "sum": "∑", "prod": "∏", "int": "∫",
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "Rightarrow": "⇒", "leftrightarrow": "↔",
+	"mapsto": "↦", "forall": "∀", "exists": "∃", "emptyset": "∅", "ell": "ℓ", "hbar": "ℏ",
+	"langle": "⟨", "rangle": "⟩", "dagger": "†", "prime": "′",
+	"ldots": "…", "dots": "…", "cdots": "⋯",
+	// Operator names are written as words
+	"log": "log", "ln": "ln", "exp": "exp", "sin": "sin", "cos": "cos", "tan": "tan",
+	"max": "max", "min": "min", "sup": "sup", "inf": "inf", "lim": "lim", "arg": "arg",
+	"det": "det", "dim": "dim", "ker": "ker",
+	// Logos of text mode
+	"TeX": "TeX", "LaTeX": "LaTeX", "textasciitilde": "~", "textbackslash": `\`,
+	// Spacing
+	"quad": " ", "qquad": " ",
+}
+
+// letters are the letters LaTeX writes as commands, which end at the next space like in TeX, as
+// in Stra\ss e
+var letters = map[string]string{
+	"ss": "ß", "o": "ø", "O": "Ø", "aa": "å", "AA": "Å", "ae": "æ", "AE": "Æ", "oe": "œ",
+	"OE": "Œ", "l": "ł", "L": "Ł", "i": "ı", "j": "ȷ",
+}
+
+// unwrapped are the commands whose argument is written as is, in the mode of the command:
+// formatting, such as \emph{x} or \mathbf{x}, and text within math, such as \text{if}
+var unwrapped = map[string]bool{
+	"emph": true, "textit": true, "textbf": true, "textrm": true, "texttt": true, "textsc": true,
+	"textsf": true, "textsl": true, "textup": true, "textnormal": true, "underline": true,
+	"mbox": true, "hbox": true, "url": true, "text": true, "mathrm": true, "mathbf": true,
+	"mathit": true, "mathsf": true, "mathtt": true, "mathcal": true, "mathbb": true,
+	"mathfrak": true, "boldsymbol": true, "operatorname": true,
+}
+
+// textInMath are the unwrapped commands whose argument is text even within math
+var textInMath = map[string]bool{"text": true, "mbox": true, "hbox": true, "textrm": true, "textit": true, "textbf": true}
+
+// dropped are the commands that only change the look of what follows, which plain text has no use for
+var dropped = map[string]bool{
+	"it": true, "bf": true, "em": true, "rm": true, "sl": true, "sc": true, "tt": true, "sf": true,
+	"small": true, "large": true, "Large": true, "footnotesize": true, "normalsize": true,
+	"displaystyle": true, "textstyle": true, "left": true, "right": true, "big": true,
+	"Big": true, "bigl": true, "bigr": true, "Bigl": true, "Bigr": true, "noindent": true,
+}
+
+// command writes the plain text of the LaTeX command s starts with and returns its length in bytes
+func command(b *strings.Builder, s string, math bool) int {
+	if len(s) < 2 {
+		b.WriteString(s)
+		return len(s)
+	}
+	next := s[1:2]
+	switch {
+	case strings.Contains(escapedCharacters, next):
+		b.WriteString(next)
+		return 2
+	case next == `\` || next == "," || next == ";" || next == ":" || next == " ":
+		b.WriteByte(' ')
+		return 2
+	case next == "!":
+		return 2
+	case accentMarks[next] != "" && !isLetter(next[0]):
+		if n := accent(b, s[2:], accentMarks[next]); n > 0 {
+			return 2 + n
+		}
+		b.WriteString(s[:2])
+		return 2
+	case !isLetter(next[0]):
+		b.WriteString(s[:2])
+		return 2
+	}
+
+	end := 1
+	for end < len(s) && isLetter(s[end]) {
+		end++
+	}
+	name := s[1:end]
+	switch {
+	case accentMarks[name] != "" && len(name) == 1:
+		// Accents named by a letter are separated from a single letter by a space, as in \c c
+		rest := strings.TrimLeft(s[end:], " ")
+		if n := accent(b, rest, accentMarks[name]); n > 0 {
+			return len(s) - len(rest) + n
+		}
+		b.WriteString(s[:end])
+	case unwrapped[name]:
+		rest := strings.TrimLeft(s[end:], " ")
+		argument, n, ok := group(rest)
+		if !ok {
+			return end
+		}
+		switch {
+		case name == "url":
+			b.WriteString(argument)
+		default:
+			b.WriteString(convert(argument, math && !textInMath[name]))
+		}
+		return len(s) - len(rest) + n
+	case letters[name] != "":
+		b.WriteString(letters[name])
+		return len(s) - len(strings.TrimLeft(s[end:], " "))
+	case symbols[name] != "":
+		b.WriteString(symbols[name])
+	case dropped[name]:
+	default:
+		// Commands without a plain text equivalent are kept with their arguments
+		b.WriteString(s[:end])
+		for {
+			_, n, ok := group(s[end:])
+			if !ok {
+				break
+			}
+			b.WriteString(s[end : end+n])
+			end += n
+		}
+	}
+	return end
+}
+
+// accent writes the letter an accent applies to with its combining mark, and returns how many
+// bytes of s the letter took: a single letter, as in \'e, or a group, as in \'{e} or \'{\i}. It
+// writes nothing and returns 0 if s does not start with a letter.
+func accent(b *strings.Builder, s string, mark string) int {
+	argument, n := s, -1
+	if inner, length, ok := group(s); ok {
+		argument, n = strings.TrimSpace(inner), length
+	}
+	var base string
+	switch {
+	// The dotless i and j take accents in place of the dotted ones
+	case len(argument) >= 2 && argument[0] == '\\' && (argument[1] == 'i' || argument[1] == 'j') &&
+		(len(argument) == 2 || !isLetter(argument[2])):
+		base = argument[:2]
+	case argument != "" && isLetter(argument[0]):
+		base = argument[:1]
+	default:
+		return max(n, 0)
+	}
+	b.WriteString(base[len(base)-1:] + mark)
+	if n < 0 && len(base) > 1 {
+		// A dotless i or j ends at the next space, as in \'\i nez
+		return len(s) - len(strings.TrimLeft(s[len(base):], " "))
+	}
+	if n < 0 {
+		return len(base)
+	}
+	b.WriteString(convert(argument[len(base):], false))
+	return n
+}
+
+// group returns the content of the braced group s starts with and its length including the braces
+func group(s string) (string, int, bool) {
+	if !strings.HasPrefix(s, "{") {
+		return "", 0, false
+	}
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return s[1:i], i + 1, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// isLetter reports whether a byte is an ASCII letter, which LaTeX command names are made of
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
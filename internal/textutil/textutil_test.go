@@ -0,0 +1,117 @@
+package textutil
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		// Whitespace and entities
+		{"feed line wrapping", "  Sparse Attention\n  Transformers for Long\n  Documents\n", "Sparse Attention Transformers for Long Documents"},
+		{"HTML entities", "Q&amp;A over &lt;tables&gt; &quot;in the wild&quot;", `Q&A over <tables> "in the wild"`},
+		{"plain text unchanged", "A Study of Everything", "A Study of Everything"},
+
+		// Text mode
+		{"escaped characters", `a 50\% gain in R\&D at \$3 \#1`, "a 50% gain in R&D at $3 #1"},
+		{"non-breaking space and line break", `Fig.~1\\and Sec.~2`, "Fig. 1 and Sec. 2"},
+		{"accent on a letter", `Schr\"odinger and Poincar\'e`, "Schrödinger and Poincaré"},
+		{"accent on a group", `G\"{o}del, Erd\H{o}s and \c{C}ivi`, "Gödel, Erdős and Çivi"},
+		{"accent within braces", `Schr{\"o}dinger`, "Schrödinger"},
+		{"accent named by a letter", `Ha\v sek and \v{S}ilov`, "Hašek and Šilov"},
+		{"accent on a dotless i", `Mart\'{\i}nez and Mart\'\i nez`, "Martínez and Martínez"},
+		{"letters", `Stra\ss e, \O stergaard and \L ukasiewicz`, "Straße, Østergaard and Łukasiewicz"},
+		{"formatting commands", `we do \emph{not} need \textbf{any} {\it labels}`, "we do not need any labels"},
+		{"grouping braces", `{BERT} and {GPT}-style models`, "BERT and GPT-style models"},
+		{"TeX quotes", "``attention is all you need''", "“attention is all you need”"},
+		{"URL kept verbatim", `code at \url{https://github.com/~user/a_b}`, "code at https://github.com/~user/a_b"},
+		{"unknown command kept", `see \cite{vaswani}`, `see \cite{vaswani}`},
+
+		// Math
+		{"inline math", `the large $N$ limit`, "the large N limit"},
+		{"symbols", `$\alpha$-stable with $p \leq 2$ and $\epsilon \to 0$`, "α-stable with p ≤ 2 and ϵ → 0"},
+		{"scripts and braces kept", `$O(n^{2})$ time and $x_i$`, "O(n^{2}) time and x_i"},
+		{"math fonts", `$\mathbb{R}^d$ and $\mathcal{O}(n \log n)$`, "R^d and O(n log n)"},
+		{"text within math", `$f(x) = 0 \text{ if } x \in \{0\}$`, "f(x) = 0 if x ∈ {0}"},
+		{"display math", `solves $$\nabla \cdot u = 0$$ exactly`, "solves ∇ · u = 0 exactly"},
+		{"unknown math command kept", `$\frac{1}{2}$`, `\frac{1}{2}`},
+		{"escaped dollar within math", `$\$5$ per query`, "$5 per query"},
+		{"unmatched dollar", `costs $5 per query`, "costs $5 per query"},
+		{"thin spaces", `$5\,\mathrm{GeV}$`, "5 GeV"},
+
+		// Malformed markup is kept rather than lost
+		{"trailing backslash", `ends with \`, `ends with \`},
+		{"accent without a letter", `a \" quote`, `a \" quote`},
+		{"unclosed group", `\emph{unclosed`, `unclosed`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.input); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNormalizeArxivAbstracts normalizes abstracts and titles as the arXiv API returns them,
+// wrapped at about 80 characters and indented by two spaces
+func TestNormalizeArxivAbstracts(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name: "1706.03762 title",
+			input: `Attention Is All
+  You Need`,
+			want: "Attention Is All You Need",
+		},
+		{
+			name: "1706.03762",
+			input: `  The dominant sequence transduction models are based on complex recurrent or
+convolutional neural networks in an encoder-decoder configuration. The best
+performing models also connect the encoder and decoder through an attention
+mechanism.
+`,
+			want: "The dominant sequence transduction models are based on complex recurrent or convolutional neural networks in an encoder-decoder configuration. The best performing models also connect the encoder and decoder through an attention mechanism.",
+		},
+		{
+			name: "hep-th/9711200",
+			input: `  We show that the large $N$ limit of certain conformal field theories in
+various dimensions include in their Hilbert space a sector describing
+supergravity on the product of Anti-deSitter spacetimes, spheres and other
+compact manifolds.
+`,
+			want: "We show that the large N limit of certain conformal field theories in various dimensions include in their Hilbert space a sector describing supergravity on the product of Anti-deSitter spacetimes, spheres and other compact manifolds.",
+		},
+		{
+			name: "1807.06209",
+			input: `  We find good consistency with the standard spatially-flat
+6-parameter $\Lambda$CDM cosmology having a power-law spectrum of
+adiabatic scalar perturbations, from polarization, temperature, and lensing,
+separately and in combination. Combined results give dark matter density
+$\Omega_c h^2 = 0.120\pm 0.001$, baryon density $\Omega_b h^2 = 0.0224\pm
+0.0001$, scalar spectral index $n_s = 0.965\pm 0.004$, and optical depth
+$\tau = 0.054\pm 0.007$ (in this abstract we quote $68\,\%$ confidence
+regions on measured parameters and $95\,\%$ on upper limits).
+`,
+			want: "We find good consistency with the standard spatially-flat 6-parameter ΛCDM cosmology having a power-law spectrum of adiabatic scalar perturbations, from polarization, temperature, and lensing, separately and in combination. Combined results give dark matter density Ω_c h^2 = 0.120± 0.001, baryon density Ω_b h^2 = 0.0224± 0.0001, scalar spectral index n_s = 0.965± 0.004, and optical depth τ = 0.054± 0.007 (in this abstract we quote 68 % confidence regions on measured parameters and 95 % on upper limits).",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Normalize(tt.input)
+			if got != tt.want {
+				t.Errorf("Normalize() =\n%q\nwant\n%q", got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("Normalize() = %q, want valid UTF-8", got)
+			}
+		})
+	}
+}
@@ -4,10 +4,11 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
-
-	"github.com/joho/godotenv"
+	"os"
+	"strconv"
 
 	server "opus-mcp/internal/server"
+	"opus-mcp/internal/settings"
 )
 
 type TransportFlag string
@@ -17,16 +18,32 @@ func (t *TransportFlag) String() string {
 }
 
 func (t *TransportFlag) Set(value string) error {
-	if value != "stdio" && value != "http" {
-		return fmt.Errorf("must be 'stdio' or 'http'")
+	if value != "stdio" && value != "http" && value != "unix" {
+		return fmt.Errorf("must be 'stdio', 'http' or 'unix'")
 	}
 	*t = TransportFlag(value)
 	return nil
 }
 
+// FileModeFlag is a file mode given in octal, e.g., 0660
+type FileModeFlag os.FileMode
+
+func (m *FileModeFlag) String() string {
+	return fmt.Sprintf("%#o", uint32(*m))
+}
+
+func (m *FileModeFlag) Set(value string) error {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0o777 {
+		return fmt.Errorf("must be an octal file mode such as 0600")
+	}
+	*m = FileModeFlag(mode)
+	return nil
+}
+
 func main() {
-	// Load .env file if present (optional, for local development)
-	if err := godotenv.Load(); err != nil {
+	// Load .env file if present (optional, for local development). Its values are reported as coming from a file.
+	if err := settings.LoadDotEnv(); err != nil {
 		// .env file not found or couldn't be loaded - this is OK, continue with system env vars
 		slog.Debug("No .env file loaded", "info", "Using system environment variables only")
 	} else {
@@ -34,13 +51,28 @@ func main() {
 	}
 
 	var transport TransportFlag = "stdio"
-	flag.Var(&transport, "transport", "The transport mechanism to use: 'stdio' or 'http'. The 'http' transport implies streamable HTTP. Note that 'sse' is disbled because it is deprecated.")
+	flag.Var(&transport, "transport", "The transport mechanism to use: 'stdio' or 'http'. The 'http' transport implies streamable HTTP, and 'unix' serves the same HTTP endpoints on a unix domain socket. Note that 'sse' is disbled because it is deprecated.")
 	var server_host string = "localhost"
 	flag.StringVar(&server_host, "host", "localhost", "The host address for the HTTP server (only relevant if transport is 'http').")
 	var server_port int = 8000
 	flag.IntVar(&server_port, "port", 8000, "The port for the HTTP server (only relevant if transport is 'http').")
+	var socket_path string = ""
+	flag.StringVar(&socket_path, "socket-path", "", "The path of the unix domain socket (required if transport is 'unix').")
+	var socket_mode FileModeFlag = 0o600
+	flag.Var(&socket_mode, "socket-mode", "The file mode of the unix domain socket, in octal (only relevant if transport is 'unix'). Use 0660 to let the socket's group connect.")
 	var enableRequestResponseLogging bool = false
 	flag.BoolVar(&enableRequestResponseLogging, "enableLogging", false, "Whether to enable request and response logging middleware.")
+	var listTools bool = false
+	flag.BoolVar(&listTools, "list-tools", false, "List the tools the current configuration registers, including degraded and disabled ones, and exit. Exits with status 1 if any tool is degraded.")
+	var checkConfig bool = false
+	flag.BoolVar(&checkConfig, "check-config", false, "Check the configuration from the environment, report every problem found and exit. Exits with status 1 if there is any problem.")
 	flag.Parse()
-	server.Serve(string(transport), server_host, server_port, enableRequestResponseLogging)
+	settings.RecordFlags(flag.CommandLine)
+	if checkConfig {
+		os.Exit(server.CheckConfig(os.Stdout))
+	}
+	if listTools {
+		os.Exit(server.ListTools(os.Stdout))
+	}
+	server.Serve(string(transport), server_host, server_port, socket_path, os.FileMode(socket_mode), enableRequestResponseLogging)
 }